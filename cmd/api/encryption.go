@@ -0,0 +1,24 @@
+package main
+
+import (
+	"api/config"
+	"api/internal/encryption"
+	"context"
+	"time"
+)
+
+// loadKeyring builds the keyring of the encrypted columns; nil without keys
+func loadKeyring(cfg *config.EncryptionConfig) (*encryption.Keyring, error) {
+	keys := make([]encryption.KeyConfig, 0, len(cfg.Keys))
+	for _, key := range cfg.Keys {
+		keys = append(keys, encryption.KeyConfig{ID: key.ID, Key: key.Key, EncryptedKey: key.EncryptedKey})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return encryption.LoadKeyring(ctx, keys, encryption.KMSConfig{
+		Region:          cfg.KMS.Region,
+		AccessKeyID:     cfg.KMS.AccessKeyID,
+		SecretAccessKey: cfg.KMS.SecretAccessKey,
+		Endpoint:        cfg.KMS.Endpoint,
+	})
+}
@@ -2,24 +2,28 @@ package main
 
 import (
 	"api/config"
-	"api/internal/handlers"
-	"api/internal/middleware"
-	"api/internal/models"
+	"api/internal/database"
+	"api/internal/encryption"
+	"api/internal/logging"
+	"api/internal/proxyproto"
+	"api/internal/repository"
+	"api/internal/telemetry"
+	"api/server"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"time"
+	_ "time/tzdata" // report schedules use IANA timezones; the runtime image has no zoneinfo
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
-	_ "github.com/lib/pq"
 	"github.com/sirupsen/logrus"
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
-	ginprometheus "github.com/zsais/go-gin-prometheus"
-
-	docs "api/docs"
 )
 
 // @title           User Management API
@@ -42,7 +46,12 @@ import (
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token.
 
-func setupLogger(cfg *config.Config) *logrus.Logger {
+// @securityDefinitions.apikey ApiKey
+// @in header
+// @name X-API-Key
+// @description API key created via POST /users/api-keys, accepted on profile and admin routes.
+
+func setupLogger(cfg *config.Config) (*logrus.Logger, *logging.Output) {
 	logger := logrus.New()
 
 	// Set log level
@@ -51,68 +60,162 @@ func setupLogger(cfg *config.Config) *logrus.Logger {
 		level = logrus.InfoLevel
 	}
 	logger.SetLevel(level)
+	logger.SetFormatter(&logrus.JSONFormatter{})
 
-	// Ensure log directory exists
-	logDir := filepath.Dir(cfg.Log.File)
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		logger.WithError(err).Fatal("Failed to create log directory")
-	}
-
-	// Set up log file
-	file, err := os.OpenFile(cfg.Log.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	fallbackLevel, err := logrus.ParseLevel(cfg.Log.FallbackLevel)
 	if err != nil {
-		logger.WithError(err).Fatal("Failed to open log file")
+		fallbackLevel = logrus.WarnLevel
 	}
 
-	logger.SetOutput(file)
-	logger.SetFormatter(&logrus.JSONFormatter{})
+	// Log to the file, falling back to stdout when it is unwritable or the disk is full
+	output := logging.Open(logging.Config{
+		File:                cfg.Log.File,
+		MaxSizeMB:           cfg.Log.MaxSizeMB,
+		MaxDiskUsagePercent: cfg.Log.MaxDiskUsagePercent,
+		FallbackLevel:       fallbackLevel,
+	}, logger)
 
-	return logger
+	return logger, output
 }
 
-func setupDatabase(cfg *config.DatabaseConfig, logger *logrus.Logger) *gorm.DB {
-	// First, connect to the default postgres database to check if our database exists
-	defaultDBInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=postgres sslmode=%s",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.SSLMode)
-
-	defaultDB, err := gorm.Open("postgres", defaultDBInfo)
-	if err != nil {
-		logger.WithError(err).Fatal("Failed to connect to postgres database")
+// databaseConfig locates the database of cfg
+func databaseConfig(cfg *config.DatabaseConfig) database.Config {
+	return database.Config{
+		Driver:           cfg.Driver,
+		Host:             cfg.Host,
+		Port:             cfg.Port,
+		User:             cfg.User,
+		DBName:           cfg.DBName,
+		SSLMode:          cfg.SSLMode,
+		Path:             cfg.Path,
+		StatementTimeout: time.Duration(cfg.StatementTimeoutSeconds) * time.Second,
 	}
-	defer defaultDB.Close()
+}
 
-	// Check if database exists
-	var dbExists bool
-	err = defaultDB.Raw("SELECT EXISTS(SELECT datname FROM pg_catalog.pg_database WHERE datname = ?)", cfg.DBName).Row().Scan(&dbExists)
+// setupDatabase connects with the password returned by password, asked again for every
+// new connection so a rotated password is picked up
+func setupDatabase(cfg *config.DatabaseConfig, password func() string, logger *logrus.Logger) *gorm.DB {
+	dbConfig := databaseConfig(cfg)
+	dialect, err := database.Dialect(cfg.Driver)
 	if err != nil {
-		logger.WithError(err).Fatal("Failed to check if database exists")
+		logger.WithError(err).Fatal("Invalid database configuration")
 	}
-
-	// Create database if it doesn't exist
-	if !dbExists {
-		logger.Info("Creating database: ", cfg.DBName)
-		err = defaultDB.Exec(fmt.Sprintf("CREATE DATABASE %s", cfg.DBName)).Error
+	timeout := time.Duration(cfg.ConnectTimeoutSeconds) * time.Second
+	logger.WithField("driver", cfg.Driver).Info("Connecting to the database")
+
+	if cfg.Driver == database.SQLite && cfg.Path == database.InMemory {
+		logger.Warn("The database is kept in memory, its data is lost when the server stops")
+	} else if cfg.Driver == database.SQLite {
+		// SQLite creates the file, but not its directory
+		if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o750); err != nil {
+			logger.WithError(err).Fatal("Failed to create the database directory")
+		}
+	} else {
+		// First, connect to the server to check if our database exists
+		serverConnector, err := database.ServerConnector(dbConfig, password)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid database configuration")
+		}
+		// The database may still be starting, e.g. alongside this service in docker compose
+		serverDB, err := openDatabase(dialect, serverConnector, timeout, logger)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to connect to the database server")
+		}
+		created, err := database.CreateDatabase(serverDB, dbConfig)
+		serverDB.Close()
 		if err != nil {
 			logger.WithError(err).Fatal("Failed to create database")
 		}
-		logger.Info("Database created successfully")
+		if created {
+			logger.Info("Created database: ", cfg.DBName)
+		}
 	}
 
 	// Connect to the actual database
-	dbInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode)
-
-	db, err := gorm.Open("postgres", dbInfo)
+	connector, err := database.Connector(dbConfig, password)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid database configuration")
+	}
+	db, err := openDatabase(dialect, connector, timeout, logger)
 	if err != nil {
 		logger.WithError(err).Fatal("Failed to connect to database")
 	}
+	if cfg.MaxOpenConns > 0 {
+		db.DB().SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		db.DB().SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	// An in-memory database lives as long as a connection to it, so they are kept
+	if cfg.ConnMaxLifetimeMinutes > 0 && cfg.Path != database.InMemory {
+		db.DB().SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetimeMinutes) * time.Minute)
+	}
 
-	// Auto-migrate models
-	db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.UserProfile{})
-
+	if err := server.Migrate(db, logger); err != nil {
+		logger.WithError(err).Fatal("Failed to migrate the database")
+	}
 	return db
 }
 
+// setupReplicas opens the read replicas. One that cannot be reached is still returned:
+// its monitor keeps reads away from it until it answers.
+func setupReplicas(cfg *config.DatabaseConfig, maxIdleConns int, logger *logrus.Logger) []repository.ReadReplica {
+	interval := time.Duration(cfg.PingIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	if len(cfg.Replicas) > 0 && cfg.Driver == database.SQLite {
+		logger.Fatal("Read replicas need a postgres or mysql database")
+	}
+	dialect, _ := database.Dialect(cfg.Driver)
+	var replicas []repository.ReadReplica
+	for i, dsn := range cfg.Replicas {
+		name := fmt.Sprintf("replica-%d", i+1)
+		sqlDB, err := sql.Open(dialect, dsn)
+		if err != nil {
+			logger.WithError(err).WithField("replica", name).Fatal("Invalid read replica")
+		}
+		if cfg.MaxOpenConns > 0 {
+			sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+		}
+		sqlDB.SetMaxIdleConns(maxIdleConns)
+		if cfg.ConnMaxLifetimeMinutes > 0 {
+			sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetimeMinutes) * time.Minute)
+		}
+		// gorm pings a connection it is handed but keeps it when that fails
+		db, err := gorm.Open(dialect, sqlDB)
+		if err != nil {
+			logger.WithError(err).WithField("replica", name).Warn("Read replica unreachable, reading from the primary until it answers")
+		}
+		replicas = append(replicas, repository.ReadReplica{
+			Name:    name,
+			DB:      db,
+			Monitor: repository.NewDBMonitor(sqlDB, maxIdleConns, interval, logger),
+		})
+	}
+	return replicas
+}
+
+// openDatabase connects, retrying with exponential backoff until timeout has passed
+func openDatabase(dialect string, connector driver.Connector, timeout time.Duration, logger *logrus.Logger) (*gorm.DB, error) {
+	sqlDB := sql.OpenDB(connector)
+	deadline := time.Now().Add(timeout)
+	delay := time.Second
+	for {
+		db, err := gorm.Open(dialect, sqlDB)
+		if err == nil {
+			return db, nil
+		}
+		if time.Now().Add(delay).After(deadline) {
+			sqlDB.Close()
+			return nil, err
+		}
+		logger.WithError(err).WithField("retry_in", delay.String()).Warn("Database not reachable yet, retrying")
+		time.Sleep(delay)
+		delay = min(delay*2, 30*time.Second)
+	}
+}
+
 func main() {
 	// Load configuration
 	cfg, err := config.LoadConfig()
@@ -120,127 +223,205 @@ func main() {
 		panic(fmt.Sprintf("Failed to load config: %v", err))
 	}
 
+	// Maintenance subcommands
+	if len(os.Args) > 1 && os.Args[1] == "migrate-refresh-tokens" {
+		os.Exit(runMigrateRefreshTokens(cfg, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		os.Exit(runSeed(cfg, os.Args[2:]))
+	}
+
 	// Setup logger
-	logger := setupLogger(cfg)
+	logger, logOutput := setupLogger(cfg)
+	stopLogOutput := make(chan struct{})
+	defer close(stopLogOutput)
+	go logOutput.Run(30*time.Second, stopLogOutput)
+
+	// Debug logging for selected users or requests, managed through the admin API
+	debugFilter := logging.NewDebugFilter(logger.Formatter, logOutput)
+	logger.SetFormatter(debugFilter)
+	go debugFilter.Run(10*time.Second, stopLogOutput)
+
+	// Distributed tracing, exported over OTLP when enabled; trace IDs are added to request logs
+	shutdownTracing, err := telemetry.Setup(context.Background(), telemetry.Config{
+		Enabled:     cfg.Telemetry.Enabled,
+		ServiceName: cfg.Telemetry.ServiceName,
+		Endpoint:    cfg.Telemetry.Endpoint,
+		Insecure:    cfg.Telemetry.Insecure,
+		Headers:     cfg.Telemetry.Headers,
+		SampleRatio: cfg.Telemetry.SampleRatio,
+	})
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to set up tracing")
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownTracing(ctx)
+	}()
+	logger.AddHook(telemetry.LogHook{})
+
+	// Secrets from Vault or AWS Secrets Manager replace the ones in the configuration file
+	secretStore, err := loadSecrets(cfg, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load secrets")
+	}
+	stopSecrets := make(chan struct{})
+	defer close(stopSecrets)
+
+	// Sensitive profile fields are encrypted at rest once keys are configured
+	keyring, err := loadKeyring(&cfg.Encryption)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load encryption keys")
+	}
+	encryption.SetDefault(keyring)
 
 	// Setup database
-	db := setupDatabase(&cfg.Database, logger)
+	db := setupDatabase(&cfg.Database, databasePassword(&cfg.Database, secretStore), logger)
 	defer db.Close()
+	maxIdleConns := cfg.Database.MaxIdleConns
+	if maxIdleConns <= 0 {
+		maxIdleConns = 2 // the database/sql default
+	}
+	stopDBMonitor := make(chan struct{})
+	defer close(stopDBMonitor)
+	if cfg.Database.PingIntervalSeconds > 0 {
+		dbMonitor := repository.NewDBMonitor(db.DB(), maxIdleConns, time.Duration(cfg.Database.PingIntervalSeconds)*time.Second, logger)
+		go dbMonitor.Run(stopDBMonitor)
+	}
+	replicas := setupReplicas(&cfg.Database, maxIdleConns, logger)
+	defer func() {
+		for _, replica := range replicas {
+			replica.DB.Close()
+		}
+	}()
+	readReplicas := repository.NewReadReplicas(replicas, logger)
+	readReplicas.Run(stopDBMonitor)
+	if cfg.Telemetry.Enabled {
+		telemetry.InstrumentGORM(db)
+	}
+
+	// Reload the configuration file on change; components subscribe to the settings they can apply live
+	configWatcher := config.Watch(cfg, logger)
+	configWatcher.Subscribe(func(next *config.Config) {
+		level, err := logrus.ParseLevel(next.Log.Level)
+		if err != nil {
+			logger.WithField("level", next.Log.Level).Warn("Ignoring invalid log level")
+			return
+		}
+		logOutput.SetLevel(level)
+	})
 
-	// Initialize Gin
+	// Build the API; its background work ends with the process
+	stopServer := make(chan struct{})
+	defer close(stopServer)
 	gin.SetMode(gin.ReleaseMode)
-	router := gin.New()
-
-	// Initialize Prometheus middleware
-	p := ginprometheus.NewPrometheus("gin")
-	p.Use(router)
-
-	// Initialize Swagger
-	docs.SwaggerInfo.Title = "User Management API"
-	docs.SwaggerInfo.Description = "A complete RESTful API for user management with authentication, authorization, and logging."
-	docs.SwaggerInfo.Version = "1.0"
-	docs.SwaggerInfo.Host = "localhost:8080"
-	docs.SwaggerInfo.BasePath = "/api/v1"
-	docs.SwaggerInfo.Schemes = []string{"http", "https"}
-
-	// Middleware
-	router.Use(gin.Recovery())
-	router.Use(middleware.LoggingMiddleware(logger))
-
-	// CORS configuration
-	corsConfig := cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}
-	router.Use(cors.New(corsConfig))
-
-	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, logger, &struct {
-		AccessSecret  string
-		RefreshSecret string
-		AccessExpiry  int
-		RefreshExpiry int
-	}{
-		AccessSecret:  cfg.JWT.AccessSecret,
-		RefreshSecret: cfg.JWT.RefreshSecret,
-		AccessExpiry:  cfg.JWT.AccessExpiry,
-		RefreshExpiry: cfg.JWT.RefreshExpiry,
+	router, err := server.NewServer(cfg, server.Deps{
+		DB:          db,
+		Replicas:    readReplicas,
+		Logger:      logger,
+		LogOutput:   logOutput,
+		DebugFilter: debugFilter,
+		Config:      configWatcher,
+		Secrets:     secretStore,
+		Stop:        stopServer,
 	})
-	userHandler := handlers.NewUserHandler(db, logger)
-	adminHandler := handlers.NewAdminHandler(db, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to set up the server")
+	}
+	if secretStore != nil && cfg.Secrets.RefreshSeconds > 0 {
+		rotateDatabasePassword(secretStore, db.DB(), maxIdleConns)
+		go secretStore.Run(time.Duration(cfg.Secrets.RefreshSeconds)*time.Second, stopSecrets)
+	}
 
-	// Serve Scalar documentation
-	// Serve the main documentation page
-	router.StaticFile("/", "./statics/index.html") // Serve at root for better UX
+	// Start server
+	logger.WithField("port", cfg.Server.Port).Info("Starting server")
 
-	// Serve the OpenAPI/Swagger specification
-	router.GET("/docs/swagger.json", func(c *gin.Context) {
-		c.File("./docs/swagger.json")
-	})
+	// Print startup message with links
+	scheme := "http"
+	if cfg.Server.TLS.Enabled() {
+		scheme = "https"
+	}
+	fmt.Printf("\n🚀 Server started successfully!\n\n")
+	fmt.Printf("📡 API is running at: \033[36m%s://localhost:%s/api/v1\033[0m\n", scheme, cfg.Server.Port)
+	fmt.Printf("📚 API Documentation (Scalar UI): \033[36m%s://localhost:%s\033[0m\n", scheme, cfg.Server.Port)
+	fmt.Printf("📖 API Documentation (Swagger UI): \033[36m%s://localhost:%s/swagger/index.html\033[0m\n\n", scheme, cfg.Server.Port)
+	fmt.Printf("🏥 Health check: \033[36m%s://localhost:%s/api/v1/health\033[0m\n\n", scheme, cfg.Server.Port)
 
-	// Legacy Swagger UI (optional)
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-
-	// API routes
-	v1 := router.Group("/api/v1")
-	{
-		// Health check
-		// @Summary Check API health
-		// @Description Get the health status of the API
-		// @Tags health
-		// @Produce json
-		// @Success 200 {object} map[string]string "status: OK"
-		// @Router /health [get]
-		v1.GET("/health", func(c *gin.Context) {
-			c.JSON(200, gin.H{
-				"status": "OK",
-				"time":   time.Now().Format(time.RFC3339),
-			})
-		})
+	if err := serve(router, &cfg.Server, logger); err != nil {
+		logger.WithError(err).Fatal("Failed to start server")
+	}
+}
 
-		// Auth routes
-		auth := v1.Group("/auth")
-		{
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
-			auth.POST("/refresh", authHandler.RefreshToken)
-			auth.POST("/logout", middleware.AuthMiddleware(cfg.JWT.AccessSecret), authHandler.Logout)
-		}
+// serve runs the router on every configured listener, over HTTPS when TLS is
+// configured, until one of them fails
+func serve(handler http.Handler, cfg *config.ServerConfig, logger *logrus.Logger) error {
+	listeners := cfg.Listeners
+	if len(listeners) == 0 {
+		listeners = []config.ListenerConfig{{Address: ":" + cfg.Port}}
+	}
 
-		// Protected user routes
-		user := v1.Group("/users")
-		user.Use(middleware.AuthMiddleware(cfg.JWT.AccessSecret))
-		{
-			user.GET("/profile", userHandler.GetProfile)
-			user.PUT("/profile", userHandler.UpdateProfile)
-			user.PUT("/change-password", userHandler.ChangePassword)
-			user.DELETE("/account", userHandler.DeleteAccount)
+	server := &http.Server{Handler: handler}
+	errs := make(chan error, len(listeners)+2)
+	if cfg.TLS.Enabled() {
+		tlsConfig, redirect, err := serverTLS(&cfg.TLS, listeners[0].Address)
+		if err != nil {
+			return err
 		}
-
-		// Admin routes
-		admin := v1.Group("/admin")
-		admin.Use(middleware.AuthMiddleware(cfg.JWT.AccessSecret), middleware.AdminMiddleware())
-		{
-			admin.GET("/users", adminHandler.ListUsers)
-			admin.PUT("/users/:id/role", adminHandler.ChangeUserRole)
+		server.TLSConfig = tlsConfig
+		if !cfg.TLS.HTTP2 {
+			// A non-nil empty map keeps net/http from negotiating h2
+			server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		}
+		if cfg.TLS.RedirectAddress != "" {
+			logger.WithField("address", cfg.TLS.RedirectAddress).Info("Redirecting HTTP to HTTPS")
+			go func() {
+				errs <- http.ListenAndServe(cfg.TLS.RedirectAddress, redirect)
+			}()
 		}
 	}
 
-	// Start server
-	logger.WithField("port", cfg.Server.Port).Info("Starting server")
+	if cfg.PprofAddress != "" {
+		listener, err := pprofListener(cfg.PprofAddress)
+		if err != nil {
+			return err
+		}
+		logger.WithField("address", cfg.PprofAddress).Info("Serving pprof")
+		go func() {
+			errs <- http.Serve(listener, pprofHandler())
+		}()
+	}
 
-	// Print startup message with links
-	fmt.Printf("\n🚀 Server started successfully!\n\n")
-	fmt.Printf("📡 API is running at: \033[36mhttp://localhost:%s/api/v1\033[0m\n", cfg.Server.Port)
-	fmt.Printf("📚 API Documentation (Scalar UI): \033[36mhttp://localhost:%s\033[0m\n", cfg.Server.Port)
-	fmt.Printf("📖 API Documentation (Swagger UI): \033[36mhttp://localhost:%s/swagger/index.html\033[0m\n\n", cfg.Server.Port)
-	fmt.Printf("🏥 Health check: \033[36mhttp://localhost:%s/api/v1/health\033[0m\n\n", cfg.Server.Port)
+	for _, lc := range listeners {
+		policy, err := proxyproto.ParsePolicy(lc.ProxyProtocol)
+		if err != nil {
+			return fmt.Errorf("listener %s: %w", lc.Address, err)
+		}
+		inner, err := net.Listen("tcp", lc.Address)
+		if err != nil {
+			return err
+		}
+		listener, err := proxyproto.NewListener(inner, proxyproto.Config{
+			Policy:         policy,
+			TrustedProxies: lc.TrustedProxies,
+			HeaderTimeout:  time.Duration(lc.HeaderTimeoutSeconds) * time.Second,
+		})
+		if err != nil {
+			return fmt.Errorf("listener %s: %w", lc.Address, err)
+		}
 
-	if err := router.Run(":" + cfg.Server.Port); err != nil {
-		logger.WithError(err).Fatal("Failed to start server")
+		logger.WithFields(logrus.Fields{
+			"address":        lc.Address,
+			"proxy_protocol": policy,
+			"tls":            server.TLSConfig != nil,
+		}).Info("Listening")
+		go func() {
+			if server.TLSConfig != nil {
+				errs <- server.ServeTLS(listener, "", "")
+				return
+			}
+			errs <- server.Serve(listener)
+		}()
 	}
+	return <-errs
 }
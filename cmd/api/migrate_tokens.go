@@ -0,0 +1,86 @@
+package main
+
+import (
+	"api/config"
+	"api/internal/compat"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runMigrateRefreshTokens implements the migrate-refresh-tokens subcommand, which
+// rewrites refresh tokens stored in plaintext into the hashed format without
+// invalidating them. It can run while the API is serving traffic.
+//
+//	api migrate-refresh-tokens [-batch-size 500] [-keep-plaintext] [-dry-run]
+func runMigrateRefreshTokens(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("migrate-refresh-tokens", flag.ContinueOnError)
+	batchSize := fs.Int("batch-size", 500, "rows updated per transaction")
+	keepPlaintext := fs.Bool("keep-plaintext", false, "only add digests, keeping a rollback to raw storage mode possible")
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing")
+	force := fs.Bool("force", false, "migrate even though compat.refreshTokenStorage is raw")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(os.Stdout)
+
+	// Instances in raw mode look tokens up by their plaintext, so removing it would
+	// sign out every session they serve
+	if cfg.Compat.RefreshTokenStorage == compat.ModeRaw && !*keepPlaintext && !*dryRun && !*force {
+		fmt.Fprintln(os.Stderr, "compat.refreshTokenStorage is raw: switch every instance to dual first, or use -keep-plaintext")
+		return 1
+	}
+
+	secretStore, err := loadSecrets(cfg, logger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load secrets:", err)
+		return 1
+	}
+	db := setupDatabase(&cfg.Database, databasePassword(&cfg.Database, secretStore), logger)
+	defer db.Close()
+
+	logger.WithFields(logrus.Fields{
+		"batch_size":     *batchSize,
+		"keep_plaintext": *keepPlaintext,
+		"dry_run":        *dryRun,
+	}).Info("Migrating refresh tokens")
+
+	result, err := compat.MigrateRefreshTokens(db, compat.MigrateOptions{
+		BatchSize:     *batchSize,
+		KeepPlaintext: *keepPlaintext,
+		DryRun:        *dryRun,
+	}, func(p compat.MigrateProgress) {
+		logger.WithFields(logrus.Fields{
+			"scanned":  p.Scanned,
+			"total":    p.Total,
+			"migrated": p.Migrated,
+			"skipped":  p.Skipped,
+			"last_id":  p.LastID,
+		}).Info("Batch processed")
+	})
+	entry := logger.WithFields(logrus.Fields{
+		"scanned":  result.Scanned,
+		"migrated": result.Migrated,
+		"skipped":  result.Skipped,
+		"last_id":  result.LastID,
+	})
+	if err != nil {
+		// Batches before the failing one are committed; running again continues from there
+		entry.WithError(err).Error("Migration stopped, completed batches are kept")
+		return 1
+	}
+	if result.Skipped > 0 {
+		entry.Warn("Migration finished; rows changed while it ran were skipped, run it again to pick them up")
+		return 0
+	}
+	entry.Info("Migration finished")
+	return 0
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"api/config"
+	"api/internal/secrets"
+	"context"
+	"database/sql"
+
+	"github.com/sirupsen/logrus"
+)
+
+// loadSecrets reads the configured secrets manager; nil when no provider is configured.
+// Its values are applied where they are used, so the configuration file's stay
+// comparable when it is reloaded.
+func loadSecrets(cfg *config.Config, logger *logrus.Logger) (*secrets.Store, error) {
+	if cfg.Secrets.Provider == "" {
+		return nil, nil
+	}
+	keys := secrets.Keys{
+		JWTAccessSecret:  cfg.Secrets.Keys.JWTAccessSecret,
+		JWTRefreshSecret: cfg.Secrets.Keys.JWTRefreshSecret,
+		DatabasePassword: cfg.Secrets.Keys.DatabasePassword,
+	}
+	provider, err := secrets.NewProvider(secrets.Config{
+		Provider: cfg.Secrets.Provider,
+		Keys:     keys,
+		Vault: secrets.VaultConfig{
+			Address:   cfg.Secrets.Vault.Address,
+			Token:     cfg.Secrets.Vault.Token,
+			Namespace: cfg.Secrets.Vault.Namespace,
+			Mount:     cfg.Secrets.Vault.Mount,
+			Path:      cfg.Secrets.Vault.Path,
+			KVVersion: cfg.Secrets.Vault.KVVersion,
+		},
+		AWS: secrets.AWSConfig{
+			Region:          cfg.Secrets.AWS.Region,
+			AccessKeyID:     cfg.Secrets.AWS.AccessKeyID,
+			SecretAccessKey: cfg.Secrets.AWS.SecretAccessKey,
+			SecretID:        cfg.Secrets.AWS.SecretID,
+			Endpoint:        cfg.Secrets.AWS.Endpoint,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	store, err := secrets.Load(context.Background(), provider, keys, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.WithField("provider", cfg.Secrets.Provider).Info("Secrets loaded")
+	return store, nil
+}
+
+// databasePassword returns the password new database connections use: the current
+// one from the secrets manager when it holds it, otherwise the configured one
+func databasePassword(cfg *config.DatabaseConfig, store *secrets.Store) func() string {
+	if store == nil || store.Current().DatabasePassword == "" {
+		password := cfg.Password
+		return func() string { return password }
+	}
+	return func() string { return store.Current().DatabasePassword }
+}
+
+// rotateDatabasePassword drops the idle connections after the database password was
+// rotated, so the pool reconnects with the new one instead of keeping connections the
+// database may end once the old password is revoked
+func rotateDatabasePassword(store *secrets.Store, db *sql.DB, maxIdle int) {
+	store.Subscribe(func(old, next secrets.Values) {
+		if next.DatabasePassword != old.DatabasePassword {
+			db.SetMaxIdleConns(0)
+			db.SetMaxIdleConns(maxIdle)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"api/config"
+	"api/internal/auth"
+	"api/internal/encryption"
+	"api/internal/repository"
+	"api/internal/service"
+	"api/server"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runSeed implements the seed subcommand, which creates the bootstrap admin when the
+// database has none and, for development, sample users. It refuses to run when the
+// environment is production unless forced.
+//
+//	api seed [-admin-email admin@example.com] [-sample-users 20] [-sample-password ...] [-force]
+func runSeed(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	adminEmail := fs.String("admin-email", cfg.Bootstrap.AdminEmail, "email of the admin created when there is none")
+	adminUsername := fs.String("admin-username", cfg.Bootstrap.AdminUsername, "username of that admin, the local part of the email when empty")
+	adminPassword := fs.String("admin-password", cfg.Bootstrap.AdminPassword, "password of that admin, generated and printed once when empty")
+	sampleUsers := fs.Int("sample-users", 0, "sample users to create, sample1@example.com and on")
+	samplePassword := fs.String("sample-password", "", "password of the sample users, generated and printed once when empty")
+	force := fs.Bool("force", false, "seed even though the environment is production")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(os.Stdout)
+
+	if cfg.Environment == "production" && !*force {
+		fmt.Fprintln(os.Stderr, "environment is production: seeding is refused without -force; the bootstrap settings create the first admin at startup")
+		return 1
+	}
+	if *adminEmail == "" && *sampleUsers <= 0 {
+		fmt.Fprintln(os.Stderr, "nothing to seed: give -admin-email (or bootstrap.adminEmail) or -sample-users")
+		return 2
+	}
+
+	secretStore, err := loadSecrets(cfg, logger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load secrets:", err)
+		return 1
+	}
+	// Sample profiles are written like any other, encrypted when keys are configured
+	keyring, err := loadKeyring(&cfg.Encryption)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load encryption keys:", err)
+		return 1
+	}
+	encryption.SetDefault(keyring)
+	db := setupDatabase(&cfg.Database, databasePassword(&cfg.Database, secretStore), logger)
+	defer db.Close()
+
+	userRepo := repository.NewUserRepository(db, repository.NewReadReplicas(nil, logger))
+	passwordValidator, err := server.SetupPasswords(&cfg.Security, repository.NewPasswordHistoryRepository(db), logger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	seeds := service.NewSeedService(userRepo, passwordValidator, logger)
+
+	if *adminEmail != "" {
+		if err := server.BootstrapAdmin(seeds, config.BootstrapConfig{
+			AdminEmail:    *adminEmail,
+			AdminUsername: *adminUsername,
+			AdminPassword: *adminPassword,
+		}, logger); err != nil {
+			fmt.Fprintln(os.Stderr, "create admin:", err)
+			return 1
+		}
+	}
+	if *sampleUsers > 0 {
+		password := *samplePassword
+		if password == "" {
+			if password, err = auth.GenerateTemporaryPassword(16); err != nil {
+				fmt.Fprintln(os.Stderr, "generate password:", err)
+				return 1
+			}
+			fmt.Printf("Sample users get the password %s\n", password)
+		}
+		created, err := seeds.SeedSampleUsers(*sampleUsers, password)
+		if err != nil {
+			logger.WithError(err).WithField("created", created).Error("Seeding sample users stopped")
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"api/config"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// serverTLS builds the TLS configuration of the HTTPS listeners and the handler of
+// the plain HTTP listener next to them, which redirects to httpsAddress and, with
+// autocert, answers the ACME HTTP-01 challenges
+func serverTLS(cfg *config.TLSConfig, httpsAddress string) (*tls.Config, http.Handler, error) {
+	redirect := redirectToHTTPS(httpsAddress)
+
+	if len(cfg.AutocertDomains) > 0 {
+		if cfg.CertFile != "" {
+			return nil, nil, errors.New("tls: set either certFile/keyFile or autocertDomains")
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Email:      cfg.AutocertEmail,
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+		}
+		tlsConfig := manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, manager.HTTPHandler(redirect), nil
+	}
+
+	if cfg.KeyFile == "" {
+		return nil, nil, errors.New("tls: certFile is set without keyFile")
+	}
+	// Loaded once, restart the server after renewing the certificate
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, redirect, nil
+}
+
+// redirectToHTTPS sends every request to the same host and path over HTTPS on the
+// port of httpsAddress
+func redirectToHTTPS(httpsAddress string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddress)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
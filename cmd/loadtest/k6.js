@@ -0,0 +1,50 @@
+// The scenarios of cmd/loadtest for k6 (https://k6.io), at a constant arrival rate:
+//
+//   k6 run -e BASE_URL=http://localhost:8080 -e SCENARIO=profile \
+//     -e LOGIN=ada@example.com -e PASSWORD=... -e RATE=200 -e DURATION=30s cmd/loadtest/k6.js
+//
+// SCENARIO is profile (GET /users/profile with the token of one login) or login
+// (POST /auth/login, a new session per request, so use a throwaway database).
+import http from 'k6/http';
+import { check } from 'k6';
+
+const base = (__ENV.BASE_URL || 'http://localhost:8080') + '/api/v1';
+const scenario = __ENV.SCENARIO || 'profile';
+const credentials = JSON.stringify({ login: __ENV.LOGIN, password: __ENV.PASSWORD });
+const json = { headers: { 'Content-Type': 'application/json' } };
+
+export const options = {
+  scenarios: {
+    [scenario]: {
+      executor: 'constant-arrival-rate',
+      rate: parseInt(__ENV.RATE || '50', 10),
+      timeUnit: '1s',
+      duration: __ENV.DURATION || '30s',
+      preAllocatedVUs: parseInt(__ENV.VUS || '64', 10),
+    },
+  },
+  thresholds: {
+    checks: ['rate==1'],
+  },
+};
+
+export function setup() {
+  if (scenario !== 'profile' || __ENV.TOKEN) {
+    return { token: __ENV.TOKEN };
+  }
+  const res = http.post(`${base}/auth/login`, credentials, json);
+  if (res.status !== 200) {
+    throw new Error(`sign in: ${res.status} ${res.body}`);
+  }
+  return { token: res.json('access_token') };
+}
+
+export default function (data) {
+  let res;
+  if (scenario === 'login') {
+    res = http.post(`${base}/auth/login`, credentials, json);
+  } else {
+    res = http.get(`${base}/users/profile`, { headers: { Authorization: `Bearer ${data.token}` } });
+  }
+  check(res, { 'status is 200': (r) => r.status === 200 });
+}
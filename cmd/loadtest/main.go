@@ -0,0 +1,138 @@
+// Command loadtest sends requests of one scenario to the API at a fixed rate and
+// reports throughput and latency percentiles, to measure per-request costs such as the
+// database lookups behind authentication before and after a change:
+//
+//	go run ./cmd/loadtest -scenario profile -login ada@example.com -password "$PASSWORD" -rate 200 -duration 30s
+//
+// Scenarios:
+//
+//	profile  GET /users/profile with the access token of one login
+//	login    POST /auth/login with the credentials, each request starting a session
+//
+// The same scenarios run with vegeta, from targets printed with -vegeta, or with k6
+// and the script next to this file:
+//
+//	go run ./cmd/loadtest -scenario profile -login ... -password ... -vegeta | vegeta attack -format=json -rate 200 -duration 30s | vegeta report
+//	k6 run -e BASE_URL=http://localhost:8080 -e SCENARIO=profile -e LOGIN=... -e PASSWORD=... cmd/loadtest/k6.js
+//
+// Run it against a throwaway database: the login scenario leaves a session per request.
+// Requests are sent open-loop, so a slow server shows up as latency and as requests
+// skipped because every worker was busy, rather than as a lower request rate.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// target is a request of a scenario, sent again and again
+type target struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"` // base64 in JSON, as vegeta expects
+}
+
+func main() {
+	base := flag.String("base", "http://localhost:8080", "URL of the running API")
+	scenario := flag.String("scenario", "profile", "profile or login")
+	login := flag.String("login", "", "email or username to sign in with")
+	password := flag.String("password", "", "password of -login")
+	token := flag.String("token", "", "access token for the profile scenario instead of signing in")
+	rate := flag.Int("rate", 50, "requests per second")
+	duration := flag.Duration("duration", 30*time.Second, "how long to send requests")
+	workers := flag.Int("workers", 64, "most requests in flight")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of each request")
+	vegeta := flag.Bool("vegeta", false, "print the scenario as vegeta JSON targets instead of running it")
+	flag.Parse()
+
+	if *rate <= 0 || *workers <= 0 || *duration <= 0 {
+		fmt.Fprintln(os.Stderr, "loadtest: -rate, -workers and -duration must be positive")
+		os.Exit(2)
+	}
+	client := &http.Client{Timeout: *timeout}
+	apiURL := strings.TrimSuffix(*base, "/") + "/api/v1"
+
+	t, err := scenarioTarget(client, apiURL, *scenario, *login, *password, *token)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loadtest: %v\n", err)
+		os.Exit(2)
+	}
+	if *vegeta {
+		if err := json.NewEncoder(os.Stdout).Encode(t); err != nil {
+			fmt.Fprintf(os.Stderr, "loadtest: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Printf("loadtest: %s %s at %d/s for %s\n", t.Method, t.URL, *rate, *duration)
+	r := &runner{client: client, target: t, workers: *workers}
+	result := r.run(*rate, *duration)
+	result.print(os.Stdout)
+	if result.failed() {
+		os.Exit(1)
+	}
+}
+
+// scenarioTarget builds the request of scenario, signing in first when it needs a token
+func scenarioTarget(client *http.Client, apiURL, scenario, login, password, token string) (target, error) {
+	switch scenario {
+	case "login":
+		if login == "" || password == "" {
+			return target{}, errors.New("the login scenario needs -login and -password")
+		}
+		body, _ := json.Marshal(map[string]string{"login": login, "password": password})
+		return target{
+			Method: http.MethodPost,
+			URL:    apiURL + "/auth/login",
+			Header: http.Header{"Content-Type": {"application/json"}},
+			Body:   body,
+		}, nil
+	case "profile":
+		if token == "" {
+			if login == "" || password == "" {
+				return target{}, errors.New("the profile scenario needs -token, or -login and -password")
+			}
+			var err error
+			if token, err = signIn(client, apiURL, login, password); err != nil {
+				return target{}, err
+			}
+		}
+		return target{
+			Method: http.MethodGet,
+			URL:    apiURL + "/users/profile",
+			Header: http.Header{"Authorization": {"Bearer " + token}},
+		}, nil
+	}
+	return target{}, fmt.Errorf("unknown scenario %q, use profile or login", scenario)
+}
+
+// signIn returns the access token of a new session
+func signIn(client *http.Client, apiURL, login, password string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"login": login, "password": password})
+	resp, err := client.Post(apiURL+"/auth/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("sign in: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("sign in: %d %s", resp.StatusCode, data)
+	}
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil || tokens.AccessToken == "" {
+		return "", fmt.Errorf("sign in: no access token in %s", data)
+	}
+	return tokens.AccessToken, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// runner sends one target from a fixed number of workers
+type runner struct {
+	client  *http.Client
+	target  target
+	workers int
+}
+
+// result holds the outcome of every request of a run
+type result struct {
+	elapsed   time.Duration
+	latencies []time.Duration // of requests that got a response
+	statuses  map[int]int
+	errors    map[string]int // by message, for requests without a response
+	skipped   int            // ticks that found every worker busy
+}
+
+// run sends rate requests per second for duration, skipping a tick when every worker
+// is still waiting for a response
+func (r *runner) run(rate int, duration time.Duration) *result {
+	res := &result{statuses: make(map[int]int), errors: make(map[string]int)}
+	var mu sync.Mutex
+	ticks := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < r.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range ticks {
+				status, latency, err := r.send()
+				mu.Lock()
+				if err != nil {
+					res.errors[err.Error()]++
+				} else {
+					res.statuses[status]++
+					res.latencies = append(res.latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	stop := time.After(duration)
+loop:
+	for {
+		select {
+		case <-stop:
+			break loop
+		case <-ticker.C:
+			select {
+			case ticks <- struct{}{}:
+			default:
+				res.skipped++
+			}
+		}
+	}
+	ticker.Stop()
+	close(ticks)
+	wg.Wait()
+	res.elapsed = time.Since(start)
+	return res
+}
+
+// send makes one request, reading the whole response
+func (r *runner) send() (int, time.Duration, error) {
+	req, err := http.NewRequest(r.target.Method, r.target.URL, bytes.NewReader(r.target.Body))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header = r.target.Header.Clone()
+	start := time.Now()
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, time.Since(start), err
+}
+
+// failed reports whether any request went without a response or got one other than 2xx
+func (res *result) failed() bool {
+	if len(res.errors) > 0 {
+		return true
+	}
+	for status := range res.statuses {
+		if status < 200 || status > 299 {
+			return true
+		}
+	}
+	return false
+}
+
+func (res *result) print(w io.Writer) {
+	sent := len(res.latencies)
+	for _, n := range res.errors {
+		sent += n
+	}
+	fmt.Fprintf(w, "requests  %d in %s (%.1f/s), %d skipped with every worker busy\n",
+		sent, res.elapsed.Round(time.Millisecond), float64(sent)/res.elapsed.Seconds(), res.skipped)
+
+	if len(res.latencies) > 0 {
+		sorted := append([]time.Duration(nil), res.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		var total time.Duration
+		for _, l := range sorted {
+			total += l
+		}
+		fmt.Fprintf(w, "latency   mean %s  p50 %s  p90 %s  p99 %s  max %s\n",
+			round(total/time.Duration(len(sorted))), round(percentile(sorted, 50)),
+			round(percentile(sorted, 90)), round(percentile(sorted, 99)), round(sorted[len(sorted)-1]))
+	}
+
+	statuses := make([]int, 0, len(res.statuses))
+	for status := range res.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(w, "status    %d: %d\n", status, res.statuses[status])
+	}
+	for message, n := range res.errors {
+		fmt.Fprintf(w, "error     %s: %d\n", message, n)
+	}
+}
+
+// percentile returns the p-th percentile of sorted, by the nearest-rank method
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
@@ -0,0 +1,173 @@
+// Command rotate-keys re-encrypts the encrypted profile columns with the current
+// encryption key (the first of encryption.keys), including values still stored in
+// plaintext. Once it reports no rows left, retired keys can be removed from the
+// configuration. It reads the same config.yaml as the server and can run while the
+// server is serving traffic:
+//
+//	go run ./cmd/rotate-keys [-batch-size 500] [-dry-run]
+package main
+
+import (
+	"api/config"
+	"api/internal/database"
+	"api/internal/encryption"
+	"api/internal/repository"
+	"api/internal/secrets"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	batchSize := flag.Int("batch-size", 500, "rows updated per transaction")
+	dryRun := flag.Bool("dry-run", false, "report what would change without writing")
+	flag.Parse()
+
+	logger := logrus.New()
+	logger.SetOutput(os.Stdout)
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load config:", err)
+		return 1
+	}
+	keyring, err := loadKeyring(&cfg.Encryption)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load encryption keys:", err)
+		return 1
+	}
+	if keyring == nil {
+		fmt.Fprintln(os.Stderr, "encryption.keys is empty: configure a key first")
+		return 1
+	}
+
+	password, err := databasePassword(cfg, logger)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load secrets:", err)
+		return 1
+	}
+	db, err := openDatabase(&cfg.Database, password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "connect to database:", err)
+		return 1
+	}
+	defer db.Close()
+
+	logger.WithFields(logrus.Fields{
+		"key_id":     keyring.CurrentKeyID(),
+		"batch_size": *batchSize,
+		"dry_run":    *dryRun,
+	}).Info("Rotating encryption keys")
+
+	result, err := repository.RotateEncryptedColumns(db, keyring, repository.RotationOptions{
+		BatchSize: *batchSize,
+		DryRun:    *dryRun,
+	}, func(p repository.RotationProgress) {
+		logger.WithFields(logrus.Fields{
+			"scanned": p.Scanned,
+			"total":   p.Total,
+			"rotated": p.Rotated,
+			"skipped": p.Skipped,
+			"last_id": p.LastID,
+		}).Info("Batch processed")
+	})
+	entry := logger.WithFields(logrus.Fields{
+		"scanned": result.Scanned,
+		"rotated": result.Rotated,
+		"skipped": result.Skipped,
+		"last_id": result.LastID,
+	})
+	if err != nil {
+		// Batches before the failing one are committed; running again continues from there
+		entry.WithError(err).Error("Rotation stopped, completed batches are kept")
+		return 1
+	}
+	if result.Skipped > 0 {
+		entry.Warn("Rotation finished; rows changed while it ran were skipped, run it again to pick them up")
+		return 0
+	}
+	entry.Info("Rotation finished")
+	return 0
+}
+
+// loadKeyring builds the keyring from the configured keys, as the server does
+func loadKeyring(cfg *config.EncryptionConfig) (*encryption.Keyring, error) {
+	keys := make([]encryption.KeyConfig, 0, len(cfg.Keys))
+	for _, key := range cfg.Keys {
+		keys = append(keys, encryption.KeyConfig{ID: key.ID, Key: key.Key, EncryptedKey: key.EncryptedKey})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return encryption.LoadKeyring(ctx, keys, encryption.KMSConfig{
+		Region:          cfg.KMS.Region,
+		AccessKeyID:     cfg.KMS.AccessKeyID,
+		SecretAccessKey: cfg.KMS.SecretAccessKey,
+		Endpoint:        cfg.KMS.Endpoint,
+	})
+}
+
+// databasePassword returns the password from the secrets manager when one holds it,
+// otherwise database.password
+func databasePassword(cfg *config.Config, logger *logrus.Logger) (string, error) {
+	if cfg.Secrets.Provider == "" || cfg.Secrets.Keys.DatabasePassword == "" {
+		return cfg.Database.Password, nil
+	}
+	keys := secrets.Keys{DatabasePassword: cfg.Secrets.Keys.DatabasePassword}
+	provider, err := secrets.NewProvider(secrets.Config{
+		Provider: cfg.Secrets.Provider,
+		Keys:     keys,
+		Vault: secrets.VaultConfig{
+			Address:   cfg.Secrets.Vault.Address,
+			Token:     cfg.Secrets.Vault.Token,
+			Namespace: cfg.Secrets.Vault.Namespace,
+			Mount:     cfg.Secrets.Vault.Mount,
+			Path:      cfg.Secrets.Vault.Path,
+			KVVersion: cfg.Secrets.Vault.KVVersion,
+		},
+		AWS: secrets.AWSConfig{
+			Region:          cfg.Secrets.AWS.Region,
+			AccessKeyID:     cfg.Secrets.AWS.AccessKeyID,
+			SecretAccessKey: cfg.Secrets.AWS.SecretAccessKey,
+			SecretID:        cfg.Secrets.AWS.SecretID,
+			Endpoint:        cfg.Secrets.AWS.Endpoint,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	store, err := secrets.Load(context.Background(), provider, keys, logger)
+	if err != nil {
+		return "", err
+	}
+	return store.Current().DatabasePassword, nil
+}
+
+// openDatabase connects to the database of cfg
+func openDatabase(cfg *config.DatabaseConfig, password string) (*gorm.DB, error) {
+	dialect, err := database.Dialect(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+	dsn, err := database.DSN(database.Config{
+		Driver:  cfg.Driver,
+		Host:    cfg.Host,
+		Port:    cfg.Port,
+		User:    cfg.User,
+		DBName:  cfg.DBName,
+		SSLMode: cfg.SSLMode,
+		Path:    cfg.Path,
+	}, password)
+	if err != nil {
+		return nil, err
+	}
+	return gorm.Open(dialect, dsn)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"api/internal/service"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiBackend calls the admin endpoints of /api/v1
+type apiBackend struct {
+	baseURL string
+	token   string
+	apiKey  string
+	client  *http.Client
+}
+
+func newAPIBackend(baseURL, token, apiKey string) *apiBackend {
+	return &apiBackend{
+		baseURL: strings.TrimSuffix(baseURL, "/") + "/api/v1",
+		token:   token,
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (a *apiBackend) Close() error { return nil }
+
+// call sends body as JSON, or as contentType when given, and decodes the response
+// into result; error responses are returned with their message
+func (a *apiBackend) call(method, path, contentType string, body, result interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+		if contentType == "" {
+			contentType = "application/json"
+		}
+	}
+	req, err := http.NewRequest(method, a.baseURL+path, payload)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	} else {
+		req.Header.Set("X-API-Key", a.apiKey)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &failure) == nil && failure.Error != "" {
+			return fmt.Errorf("%s (HTTP %d)", failure.Error, resp.StatusCode)
+		}
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// CreateUser invites the address: accounts created through the API choose their own
+// username and password
+func (a *apiBackend) CreateUser(account service.OperatorAccount) (*user, string, error) {
+	if account.Username != "" || account.Password != "" || account.EmailVerified {
+		return nil, "", errors.New("over the API the user is invited and picks a username and password; -username, -password and -verified need the database")
+	}
+	err := a.call(http.MethodPost, "/admin/invitations", "", map[string]string{
+		"email": account.Email,
+		"role":  account.Role,
+	}, nil)
+	return nil, "", err
+}
+
+func (a *apiBackend) SetRole(id uint, role string) (*user, error) {
+	if err := a.call(http.MethodPut, fmt.Sprintf("/admin/users/%d/role", id), "", map[string]string{"role": role}, nil); err != nil {
+		return nil, err
+	}
+	return a.findUser(id)
+}
+
+// ResetPassword emails the user a reset link
+func (a *apiBackend) ResetPassword(id uint, password string) (string, error) {
+	if password != "" {
+		return "", errors.New("over the API the user sets the password through the emailed link; -password needs the database")
+	}
+	return "", a.call(http.MethodPost, fmt.Sprintf("/admin/users/%d/password-reset", id), "", nil, nil)
+}
+
+func (a *apiBackend) RevokeSessions(id uint, notify bool) (int, error) {
+	var result struct {
+		RevokedSessions int `json:"revokedSessions"`
+	}
+	err := a.call(http.MethodPost, fmt.Sprintf("/admin/users/%d/revoke-sessions", id), "", map[string]bool{"notify": notify}, &result)
+	return result.RevokedSessions, err
+}
+
+func (a *apiBackend) ListUsers() ([]user, error) {
+	var result struct {
+		Users []user `json:"users"`
+	}
+	if err := a.call(http.MethodGet, "/admin/users", "", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Users, nil
+}
+
+func (a *apiBackend) VerifyEmail(id uint) (*user, error) {
+	err := a.call(http.MethodPatch, fmt.Sprintf("/admin/users/%d", id), "application/merge-patch+json", map[string]bool{"emailVerified": true}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return a.findUser(id)
+}
+
+func (a *apiBackend) findUser(id uint) (*user, error) {
+	users, err := a.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		if users[i].ID == id {
+			return &users[i], nil
+		}
+	}
+	return nil, service.ErrUserNotFound
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"api/config"
+	"api/internal/auth"
+	"api/internal/compat"
+	"api/internal/database"
+	"api/internal/repository"
+	"api/internal/revocation"
+	"api/internal/secrets"
+	"api/internal/service"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+// databaseBackend changes accounts in the database of config.yaml, which the server
+// must have migrated. Running servers pick up revoked sessions when they next sync
+// token revocations.
+type databaseBackend struct {
+	db        *gorm.DB
+	operators service.OperatorService
+}
+
+func openDatabaseBackend() (*databaseBackend, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	// Service logs would interleave with the results
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	password, err := databasePassword(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("load secrets: %w", err)
+	}
+	db, err := openDatabase(&cfg.Database, password)
+	if err != nil {
+		return nil, err
+	}
+	passwords, err := passwordValidator(&cfg.Security, repository.NewPasswordHistoryRepository(db), logger)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	tokenStore, err := compat.NewRefreshTokenStore(cfg.Compat.RefreshTokenStorage)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	revocations, err := revocation.NewStore(db, logger, time.Minute*time.Duration(max(cfg.JWT.AccessExpiry, cfg.JWT.ImpersonationExpiry)))
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("load token revocations: %w", err)
+	}
+
+	replicas := repository.NewReadReplicas(nil, logger)
+	return &databaseBackend{
+		db: db,
+		operators: service.NewOperatorService(
+			repository.NewUserRepository(db, replicas),
+			repository.NewTokenRepository(db, replicas, tokenStore),
+			revocations, passwords, logger),
+	}, nil
+}
+
+func (d *databaseBackend) Close() error { return d.db.Close() }
+
+func (d *databaseBackend) CreateUser(account service.OperatorAccount) (*user, string, error) {
+	if account.Username == "" {
+		return nil, "", errors.New("-username is required on the database")
+	}
+	created, password, err := d.operators.CreateUser(account)
+	if err != nil {
+		return nil, "", err
+	}
+	u := userFromModel(created)
+	return &u, password, nil
+}
+
+func (d *databaseBackend) SetRole(id uint, role string) (*user, error) {
+	updated, err := d.operators.SetRole(id, role)
+	if err != nil {
+		return nil, err
+	}
+	u := userFromModel(updated)
+	return &u, nil
+}
+
+func (d *databaseBackend) ResetPassword(id uint, password string) (string, error) {
+	return d.operators.ResetPassword(id, password)
+}
+
+// RevokeSessions cannot notify the user, as no mail is sent from here
+func (d *databaseBackend) RevokeSessions(id uint, notify bool) (int, error) {
+	if notify {
+		return 0, errors.New("--notify needs the API, the database backend sends no email")
+	}
+	return d.operators.RevokeSessions(id)
+}
+
+func (d *databaseBackend) ListUsers() ([]user, error) {
+	found, err := d.operators.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	users := make([]user, 0, len(found))
+	for i := range found {
+		users = append(users, userFromModel(&found[i]))
+	}
+	return users, nil
+}
+
+func (d *databaseBackend) VerifyEmail(id uint) (*user, error) {
+	verified, err := d.operators.VerifyEmail(id)
+	if err != nil {
+		return nil, err
+	}
+	u := userFromModel(verified)
+	return &u, nil
+}
+
+// passwordValidator applies the server's password hashing and policy, so accounts
+// created here can sign in and meet the same rules
+func passwordValidator(cfg *config.SecurityConfig, history repository.PasswordHistoryRepository, logger *logrus.Logger) (service.PasswordValidator, error) {
+	hasher, err := auth.NewPasswordHasher(auth.HashingConfig{
+		Algorithm:  cfg.PasswordHashing.Algorithm,
+		BcryptCost: cfg.PasswordHashing.BcryptCost,
+		Argon2: auth.Argon2Params{
+			MemoryKB:    cfg.PasswordHashing.Argon2.MemoryKB,
+			Iterations:  cfg.PasswordHashing.Argon2.Iterations,
+			Parallelism: cfg.PasswordHashing.Argon2.Parallelism,
+			SaltLength:  cfg.PasswordHashing.Argon2.SaltLength,
+			KeyLength:   cfg.PasswordHashing.Argon2.KeyLength,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("password hashing: %w", err)
+	}
+	auth.SetPasswordHasher(hasher)
+	policy, err := auth.NewPasswordPolicy(auth.PasswordPolicy{
+		MinLength:        cfg.PasswordPolicy.MinLength,
+		RequireUpper:     cfg.PasswordPolicy.RequireUppercase,
+		RequireLower:     cfg.PasswordPolicy.RequireLowercase,
+		RequireDigit:     cfg.PasswordPolicy.RequireDigit,
+		RequireSymbol:    cfg.PasswordPolicy.RequireSymbol,
+		DisallowUserInfo: cfg.PasswordPolicy.DisallowUserInfo,
+	}, cfg.PasswordPolicy.BannedPasswordsFile)
+	if err != nil {
+		return nil, fmt.Errorf("password policy: %w", err)
+	}
+	var breaches auth.BreachChecker
+	if cfg.PasswordPolicy.BreachCheck.Enabled {
+		breaches = auth.NewHIBPChecker(auth.HIBPConfig{
+			Endpoint: cfg.PasswordPolicy.BreachCheck.Endpoint,
+			Timeout:  time.Duration(cfg.PasswordPolicy.BreachCheck.TimeoutSeconds) * time.Second,
+		})
+	}
+	return service.NewPasswordValidator(policy, breaches, history, service.PasswordConfig{
+		Breach: service.BreachCheckConfig{
+			Threshold: cfg.PasswordPolicy.BreachCheck.Threshold,
+			FailOpen:  cfg.PasswordPolicy.BreachCheck.FailOpen,
+		},
+		History: cfg.PasswordPolicy.HistorySize,
+	}, logger), nil
+}
+
+// databasePassword returns the password from the secrets manager when one holds it,
+// otherwise database.password
+func databasePassword(cfg *config.Config, logger *logrus.Logger) (string, error) {
+	if cfg.Secrets.Provider == "" || cfg.Secrets.Keys.DatabasePassword == "" {
+		return cfg.Database.Password, nil
+	}
+	keys := secrets.Keys{DatabasePassword: cfg.Secrets.Keys.DatabasePassword}
+	provider, err := secrets.NewProvider(secrets.Config{
+		Provider: cfg.Secrets.Provider,
+		Keys:     keys,
+		Vault: secrets.VaultConfig{
+			Address:   cfg.Secrets.Vault.Address,
+			Token:     cfg.Secrets.Vault.Token,
+			Namespace: cfg.Secrets.Vault.Namespace,
+			Mount:     cfg.Secrets.Vault.Mount,
+			Path:      cfg.Secrets.Vault.Path,
+			KVVersion: cfg.Secrets.Vault.KVVersion,
+		},
+		AWS: secrets.AWSConfig{
+			Region:          cfg.Secrets.AWS.Region,
+			AccessKeyID:     cfg.Secrets.AWS.AccessKeyID,
+			SecretAccessKey: cfg.Secrets.AWS.SecretAccessKey,
+			SecretID:        cfg.Secrets.AWS.SecretID,
+			Endpoint:        cfg.Secrets.AWS.Endpoint,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	store, err := secrets.Load(context.Background(), provider, keys, logger)
+	if err != nil {
+		return "", err
+	}
+	return store.Current().DatabasePassword, nil
+}
+
+// openDatabase connects to the database of cfg
+func openDatabase(cfg *config.DatabaseConfig, password string) (*gorm.DB, error) {
+	dialect, err := database.Dialect(cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+	dsn, err := database.DSN(database.Config{
+		Driver:  cfg.Driver,
+		Host:    cfg.Host,
+		Port:    cfg.Port,
+		User:    cfg.User,
+		DBName:  cfg.DBName,
+		SSLMode: cfg.SSLMode,
+		Path:    cfg.Path,
+	}, password)
+	if err != nil {
+		return nil, err
+	}
+	return gorm.Open(dialect, dsn)
+}
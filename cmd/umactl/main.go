@@ -0,0 +1,393 @@
+// Command umactl manages accounts from the command line. It talks to the API with an
+// admin access token or API key when an API URL is given, and to the database named
+// in config.yaml otherwise:
+//
+//	umactl [--api URL] [--token TOKEN | --api-key KEY] [--json] <command> [flags] [args]
+//
+// The URL, token and API key can also be set with UMACTL_API_URL, UMACTL_TOKEN and
+// UMACTL_API_KEY. Users are given by ID or email address. Commands:
+//
+//	create-user --email EMAIL [--username NAME] [--role user|admin] [--password PASSWORD] [--verified]
+//	set-role USER user|admin
+//	reset-password [--password PASSWORD] USER
+//	revoke-sessions [--notify] USER
+//	list-users
+//	verify-email USER
+//
+// Over the API, create-user invites the address, the user choosing a username and
+// password through the emailed link, and reset-password emails a reset link. On the
+// database they set the password, generated and printed once when not given, and no
+// email is sent. umactl help COMMAND describes a command.
+package main
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// user is an account as both backends report it
+type user struct {
+	ID       uint      `json:"id"`
+	Email    string    `json:"email"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	Verified bool      `json:"verified"`
+	Status   string    `json:"status"`
+	Created  time.Time `json:"createdAt"`
+}
+
+func userFromModel(u *models.User) user {
+	return user{
+		ID:       u.ID,
+		Email:    u.Email,
+		Username: u.Username,
+		Role:     u.Role,
+		Verified: u.EmailVerified,
+		Status:   u.AccountStatus(time.Now()),
+		Created:  u.CreatedAt,
+	}
+}
+
+// backend carries out the commands, through the API or on the database
+type backend interface {
+	// CreateUser creates or invites the account and returns a generated password
+	CreateUser(account service.OperatorAccount) (*user, string, error)
+	SetRole(id uint, role string) (*user, error)
+	// ResetPassword returns the new password when it was generated
+	ResetPassword(id uint, password string) (string, error)
+	RevokeSessions(id uint, notify bool) (int, error)
+	ListUsers() ([]user, error)
+	VerifyEmail(id uint) (*user, error)
+	Close() error
+}
+
+// commandError is an error of a command that ran, as opposed to one rejecting the
+// command line; it exits with status 1 instead of 2
+type commandError struct {
+	command string
+	err     error
+}
+
+func (e *commandError) Error() string {
+	return e.command + ": " + e.err.Error()
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	c := &cli{out: &output{w: stdout}}
+	root := c.rootCommand()
+	root.SetArgs(args)
+	root.SetOut(stdout)
+	root.SetErr(stderr)
+
+	err := root.Execute()
+	if c.backend != nil {
+		c.backend.Close()
+	}
+	var failed *commandError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &failed):
+		fmt.Fprintln(stderr, failed)
+		return 1
+	default:
+		fmt.Fprintln(stderr, "Error:", err)
+		fmt.Fprintln(stderr, "Run 'umactl --help' for usage.")
+		return 2
+	}
+}
+
+// cli holds the global flags and the backend the commands run against
+type cli struct {
+	apiURL  string
+	token   string
+	apiKey  string
+	json    bool
+	backend backend
+	out     *output
+}
+
+func (c *cli) rootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:   "umactl",
+		Short: "Manage user accounts through the API or on the database",
+		Long: `umactl manages accounts from scripts. With --api it calls the admin API with an admin
+access token or API key; otherwise it works on the database of config.yaml, which the
+server must have migrated. USER arguments are an ID or an email address.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	flags := root.PersistentFlags()
+	flags.StringVar(&c.apiURL, "api", os.Getenv("UMACTL_API_URL"), "API base URL, e.g. https://api.example.com; the database is used when empty")
+	flags.StringVar(&c.token, "token", os.Getenv("UMACTL_TOKEN"), "admin access token for the API")
+	flags.StringVar(&c.apiKey, "api-key", os.Getenv("UMACTL_API_KEY"), "admin API key for the API, instead of a token")
+	flags.BoolVar(&c.json, "json", false, "print results as JSON")
+
+	root.AddCommand(
+		c.createUserCommand(),
+		c.setRoleCommand(),
+		c.resetPasswordCommand(),
+		c.revokeSessionsCommand(),
+		c.listUsersCommand(),
+		c.verifyEmailCommand(),
+	)
+	return root
+}
+
+// open connects to the backend the global flags name
+func (c *cli) open() error {
+	c.out.json = c.json
+	if c.apiURL != "" {
+		if c.token == "" && c.apiKey == "" {
+			return errors.New("--api needs --token or --api-key (UMACTL_TOKEN, UMACTL_API_KEY)")
+		}
+		c.backend = newAPIBackend(c.apiURL, c.token, c.apiKey)
+		return nil
+	}
+	b, err := openDatabaseBackend()
+	if err != nil {
+		return &commandError{command: "open database", err: err}
+	}
+	c.backend = b
+	return nil
+}
+
+// runE adapts a command's work to cobra: once the command line is accepted it opens the
+// backend and runs work, marking its errors as those of a command that ran
+func (c *cli) runE(name string, work func(args []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := c.open(); err != nil {
+			return err
+		}
+		if err := work(args); err != nil {
+			return &commandError{command: name, err: err}
+		}
+		return nil
+	}
+}
+
+func (c *cli) createUserCommand() *cobra.Command {
+	var account service.OperatorAccount
+	cmd := &cobra.Command{
+		Use:   "create-user --email EMAIL [flags]",
+		Short: "Create an account, or invite the address over the API",
+		Args:  cobra.NoArgs,
+	}
+	cmd.RunE = c.runE("create-user", func(args []string) error {
+		created, generated, err := c.backend.CreateUser(account)
+		if err != nil {
+			return err
+		}
+		if created == nil {
+			return c.out.message("Invitation sent to "+account.Email, nil)
+		}
+		return c.out.user(created, generated)
+	})
+	flags := cmd.Flags()
+	flags.StringVar(&account.Email, "email", "", "email address (required)")
+	flags.StringVar(&account.Username, "username", "", "username (required on the database)")
+	flags.StringVar(&account.Role, "role", "user", "user or admin")
+	flags.StringVar(&account.Password, "password", "", "password; generated and printed when empty")
+	flags.BoolVar(&account.EmailVerified, "verified", false, "mark the email address verified")
+	cmd.MarkFlagRequired("email")
+	return cmd
+}
+
+func (c *cli) setRoleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set-role USER user|admin",
+		Short: "Change a user's role",
+		Args:  cobra.ExactArgs(2),
+	}
+	cmd.RunE = c.runE("set-role", func(args []string) error {
+		id, err := resolveUser(c.backend, args[0])
+		if err != nil {
+			return err
+		}
+		updated, err := c.backend.SetRole(id, args[1])
+		if err != nil {
+			return err
+		}
+		return c.out.user(updated, "")
+	})
+	return cmd
+}
+
+func (c *cli) resetPasswordCommand() *cobra.Command {
+	var password string
+	cmd := &cobra.Command{
+		Use:   "reset-password [--password PASSWORD] USER",
+		Short: "Set a new password, or email a reset link over the API",
+		Args:  cobra.ExactArgs(1),
+	}
+	cmd.RunE = c.runE("reset-password", func(args []string) error {
+		id, err := resolveUser(c.backend, args[0])
+		if err != nil {
+			return err
+		}
+		generated, err := c.backend.ResetPassword(id, password)
+		if err != nil {
+			return err
+		}
+		if _, remote := c.backend.(*apiBackend); remote {
+			return c.out.message("Password reset link sent", map[string]interface{}{"id": id})
+		}
+		return c.out.message("Password reset, sessions ended", map[string]interface{}{"id": id, "password": generated})
+	})
+	cmd.Flags().StringVar(&password, "password", "", "new password, on the database only; generated and printed when empty")
+	return cmd
+}
+
+func (c *cli) revokeSessionsCommand() *cobra.Command {
+	var notify bool
+	cmd := &cobra.Command{
+		Use:   "revoke-sessions [--notify] USER",
+		Short: "End every session of a user",
+		Args:  cobra.ExactArgs(1),
+	}
+	cmd.RunE = c.runE("revoke-sessions", func(args []string) error {
+		id, err := resolveUser(c.backend, args[0])
+		if err != nil {
+			return err
+		}
+		revoked, err := c.backend.RevokeSessions(id, notify)
+		if err != nil {
+			return err
+		}
+		return c.out.message(fmt.Sprintf("%d session(s) revoked", revoked), map[string]interface{}{"id": id, "revokedSessions": revoked})
+	})
+	cmd.Flags().BoolVar(&notify, "notify", false, "tell the user by email, over the API only")
+	return cmd
+}
+
+func (c *cli) listUsersCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list-users",
+		Short: "List every user",
+		Args:  cobra.NoArgs,
+	}
+	cmd.RunE = c.runE("list-users", func(args []string) error {
+		users, err := c.backend.ListUsers()
+		if err != nil {
+			return err
+		}
+		return c.out.users(users)
+	})
+	return cmd
+}
+
+func (c *cli) verifyEmailCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify-email USER",
+		Short: "Mark a user's email address verified",
+		Args:  cobra.ExactArgs(1),
+	}
+	cmd.RunE = c.runE("verify-email", func(args []string) error {
+		id, err := resolveUser(c.backend, args[0])
+		if err != nil {
+			return err
+		}
+		verified, err := c.backend.VerifyEmail(id)
+		if err != nil {
+			return err
+		}
+		return c.out.user(verified, "")
+	})
+	return cmd
+}
+
+// resolveUser returns the ID of ref, an ID or an email address
+func resolveUser(b backend, ref string) (uint, error) {
+	if id, err := strconv.ParseUint(ref, 10, 32); err == nil {
+		return uint(id), nil
+	}
+	if !strings.Contains(ref, "@") {
+		return 0, fmt.Errorf("%q is neither a user ID nor an email address", ref)
+	}
+	users, err := b.ListUsers()
+	if err != nil {
+		return 0, err
+	}
+	for _, u := range users {
+		if strings.EqualFold(u.Email, ref) {
+			return u.ID, nil
+		}
+	}
+	return 0, service.ErrUserNotFound
+}
+
+// output prints results as text for people or as JSON for scripts
+type output struct {
+	w    io.Writer
+	json bool
+}
+
+func (o *output) encode(v interface{}) error {
+	enc := json.NewEncoder(o.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (o *output) message(text string, fields map[string]interface{}) error {
+	if o.json {
+		if fields == nil {
+			fields = map[string]interface{}{}
+		}
+		fields["message"] = text
+		return o.encode(fields)
+	}
+	fmt.Fprintln(o.w, text)
+	if password, _ := fields["password"].(string); password != "" {
+		fmt.Fprintf(o.w, "New password: %s (shown only once)\n", password)
+	}
+	return nil
+}
+
+func (o *output) user(u *user, password string) error {
+	if o.json {
+		if password == "" {
+			return o.encode(u)
+		}
+		return o.encode(struct {
+			*user
+			Password string `json:"password"`
+		}{u, password})
+	}
+	if err := o.users([]user{*u}); err != nil {
+		return err
+	}
+	if password != "" {
+		fmt.Fprintf(o.w, "Password: %s (shown only once)\n", password)
+	}
+	return nil
+}
+
+func (o *output) users(users []user) error {
+	if o.json {
+		if users == nil {
+			users = []user{}
+		}
+		return o.encode(users)
+	}
+	tw := tabwriter.NewWriter(o.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tEMAIL\tUSERNAME\tROLE\tVERIFIED\tSTATUS\tCREATED")
+	for _, u := range users {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%t\t%s\t%s\n", u.ID, u.Email, u.Username, u.Role, u.Verified, u.Status, u.Created.UTC().Format("2006-01-02"))
+	}
+	return tw.Flush()
+}
@@ -5,35 +5,667 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	Log      LogConfig
+	// Environment is development, staging or production; the seed command refuses to
+	// run in production unless forced. APP_ENV overrides it.
+	Environment    string
+	Bootstrap      BootstrapConfig
+	Server         ServerConfig
+	Database       DatabaseConfig
+	JWT            JWTConfig
+	Secrets        SecretsConfig
+	Encryption     EncryptionConfig
+	Log            LogConfig
+	Email          EmailConfig
+	Compat         CompatConfig
+	Cache          CacheConfig
+	Storage        StorageConfig
+	Security       SecurityConfig
+	APIKeys        APIKeysConfig
+	Exports        ExportsConfig
+	Imports        ImportsConfig
+	Privacy        PrivacyConfig
+	Profiles       ProfilesConfig
+	DSAR           DSARConfig
+	Jobs           JobsConfig
+	Analytics      AnalyticsConfig
+	CORS           CORSConfig
+	IPFilter       IPFilterConfig
+	FeatureFlags   FeatureFlagsConfig
+	Telemetry      TelemetryConfig
+	AdminUI        AdminUIConfig
+	Authentication AuthenticationConfig
+	LDAP           LDAPConfig
+	SAML           SAMLConfig
+	Organizations  OrganizationsConfig
+	Events         EventsConfig
+	API            APIConfig
+}
+
+// BootstrapConfig creates the first admin account at startup while no admin exists,
+// so a new deployment needs no manual database edits. BOOTSTRAP_ADMIN_EMAIL,
+// BOOTSTRAP_ADMIN_USERNAME and BOOTSTRAP_ADMIN_PASSWORD override it.
+type BootstrapConfig struct {
+	AdminEmail    string // empty creates no admin
+	AdminUsername string // the local part of the email when empty
+	AdminPassword string // generated and printed once when empty
 }
 
 type ServerConfig struct {
 	Port string
+	// Listeners overrides Port when set, e.g. to accept PROXY protocol from a load balancer
+	Listeners []ListenerConfig
+	// TrustedProxies are the reverse proxies (IPs or CIDRs) whose X-Forwarded-For and
+	// X-Real-IP headers name the client. Empty trusts none: the client is the peer of the
+	// connection, as headers from any other peer can be forged.
+	TrustedProxies []string
+	// MaxBodyKB is the largest request body accepted, except uploads with their own
+	// limit (avatars, imports); 0 disables the limit
+	MaxBodyKB int
+	// TLS terminates HTTPS in the server itself, for deployments without a reverse proxy
+	TLS TLSConfig
+	// PprofAddress serves net/http/pprof on its own listener, e.g. 127.0.0.1:6060; it
+	// must be a loopback address, and empty disables it
+	PprofAddress string
+}
+
+// TLSConfig is off until a certificate pair or autocert domains are set
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// AutocertDomains obtains and renews certificates from Let's Encrypt for these
+	// hosts instead of CertFile/KeyFile
+	AutocertDomains  []string
+	AutocertEmail    string
+	AutocertCacheDir string
+	// RedirectAddress serves plain HTTP redirecting to HTTPS, and the ACME HTTP-01
+	// challenges with autocert; empty disables it
+	RedirectAddress string
+	HTTP2           bool
+}
+
+// Enabled reports whether the server terminates TLS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || len(c.AutocertDomains) > 0
+}
+
+type ListenerConfig struct {
+	Address              string
+	ProxyProtocol        string   // off, optional or required
+	TrustedProxies       []string // CIDRs allowed to send PROXY headers, empty trusts all peers
+	HeaderTimeoutSeconds int
 }
 
 type DatabaseConfig struct {
+	Driver   string // postgres, mysql or sqlite
+	Path     string // SQLite database file
 	Host     string
 	Port     string
 	User     string
 	Password string
 	DBName   string
 	SSLMode  string
+	// Connection pool; 0 leaves the database/sql default (unlimited open connections, 2 idle)
+	MaxOpenConns           int
+	MaxIdleConns           int
+	ConnMaxLifetimeMinutes int // connections are replaced after this, 0 keeps them
+	// StatementTimeoutSeconds aborts queries running longer (0 disables)
+	StatementTimeoutSeconds int
+	// ConnectTimeoutSeconds is how long startup keeps retrying to reach the database
+	ConnectTimeoutSeconds int
+	// PingIntervalSeconds is how often the connection is checked while running (0 disables)
+	PingIntervalSeconds int
+	// Replicas are read-only copies of the database as connection strings of the
+	// driver: libpq strings or postgres:// URLs, or MySQL DSNs. User lists, profiles
+	// and refresh token lookups are read from them, falling back to the primary while
+	// none is reachable.
+	Replicas []string
 }
 
 type JWTConfig struct {
-	AccessSecret  string
-	RefreshSecret string
-	AccessExpiry  int // minutes
-	RefreshExpiry int // days
+	Algorithm      string // access token signing: HS256 (AccessSecret), RS256 or EdDSA (PrivateKeyFile)
+	AccessSecret   string
+	PrivateKeyFile string // PEM encoded RSA or Ed25519 private key
+	RefreshSecret  string
+	Issuer         string // "iss" of every token
+	Audience       string // "aud" of access tokens, checked by this service and others
+	AccessExpiry   int    // minutes
+	RefreshExpiry  int    // days
+	// ImpersonationExpiry is the lifetime in minutes of the tokens admins get to act as a user
+	ImpersonationExpiry int
+	// Validated access tokens are cached in memory for up to CacheTTLSeconds (0 disables)
+	CacheTTLSeconds int
+	CacheMaxEntries int
+	// Retired keys, still accepted until the tokens they signed expire, so keys can be
+	// rotated without ending sessions
+	PreviousAccessKeys     []JWTKeyConfig
+	PreviousRefreshSecrets []string
+	Claims                 JWTClaimsConfig
+}
+
+// JWTClaimsConfig adds deployment specific claims to access tokens
+type JWTClaimsConfig struct {
+	// Enrichers are the registered claims enrichers to run, in order; empty runs the
+	// fields enricher when Fields are set
+	Enrichers []string
+	// Fields are claims the fields enricher copies from the user, profile or custom attributes
+	Fields []ClaimFieldConfig
+}
+
+type ClaimFieldConfig struct {
+	Claim  string
+	Source string // user.<field>, profile.<field> or attribute.<key>
+}
+
+// JWTKeyConfig is a retired access token key
+type JWTKeyConfig struct {
+	Algorithm     string // HS256, RS256 or EdDSA
+	Secret        string // HS256
+	PublicKeyFile string // RS256 and EdDSA, PEM encoded
+}
+
+// SecretsConfig reads the JWT secrets and the database password from a secrets
+// manager, overriding the values in this file
+type SecretsConfig struct {
+	Provider string // empty (off), vault or aws
+	// RefreshSeconds is how often rotated values are picked up, 0 reads them once
+	RefreshSeconds int
+	Keys           SecretKeysConfig
+	Vault          VaultConfig
+	AWS            AWSSecretsConfig
+}
+
+// SecretKeysConfig names the entries of the secret holding each value; an empty name
+// keeps the value from this file
+type SecretKeysConfig struct {
+	JWTAccessSecret  string
+	JWTRefreshSecret string
+	DatabasePassword string
+}
+
+type VaultConfig struct {
+	Address   string
+	Token     string
+	Namespace string
+	Mount     string
+	Path      string
+	KVVersion int
+}
+
+type AWSSecretsConfig struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SecretID        string // name or ARN
+	Endpoint        string
+}
+
+// EncryptionConfig encrypts sensitive profile fields at rest with AES-256-GCM
+type EncryptionConfig struct {
+	// Keys[0] encrypts new values, the others only decrypt until cmd/rotate-keys has
+	// re-encrypted their values; without keys the fields are stored in plaintext
+	Keys []EncryptionKeyConfig
+	KMS  KMSConfig
+}
+
+type EncryptionKeyConfig struct {
+	ID           string // stored with every value, never reuse one for another key
+	Key          string // base64 encoded 32 bytes
+	EncryptedKey string // base64 encoded KMS data key, decrypted with KMS at startup instead of Key
+}
+
+type KMSConfig struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Endpoint        string
 }
 
 type LogConfig struct {
-	Level string
-	File  string
+	Level               string
+	File                string
+	MaxSizeMB           int    // soft quota; above it the level is raised to FallbackLevel
+	MaxDiskUsagePercent int    // above it logs are written to stdout
+	FallbackLevel       string // level used while the soft quota is exceeded
+}
+
+type EmailConfig struct {
+	WebhookSecret string // shared secret expected from provider webhooks
+	Provider      string // log, smtp, sendgrid or ses
+	From          string
+	SMTP          SMTPConfig
+	SendGrid      SendGridConfig
+	SES           SESConfig
+	Queue         EmailQueueConfig
+}
+
+type SMTPConfig struct {
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	ImplicitTLS bool // TLS from the first byte (port 465) instead of STARTTLS
+}
+
+type SendGridConfig struct {
+	APIKey   string
+	Endpoint string
+}
+
+type SESConfig struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Endpoint        string
+}
+
+type EmailQueueConfig struct {
+	Workers           int
+	Size              int
+	MaxAttempts       int
+	RetryDelaySeconds int
+}
+
+type CORSConfig struct {
+	AllowOrigins     []string // exact origins, wildcard subdomains ("https://*.example.com") or "*"
+	AllowMethods     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool // not allowed together with "*"
+	MaxAgeSeconds    int  // how long browsers may cache preflight results
+}
+
+// IPFilterConfig restricts client addresses per route, before authentication.
+// Rules added through the admin API apply together with Rules.
+type IPFilterConfig struct {
+	Rules         []IPRuleConfig
+	ReloadSeconds int // how often each instance reloads the rules managed through the API
+}
+
+// FeatureFlagsConfig sets how fast flag changes made on one instance reach the others
+type FeatureFlagsConfig struct {
+	ReloadSeconds int
+}
+
+type IPRuleConfig struct {
+	Path   string // route template, "/*" matches below a prefix, empty for every route
+	Action string // allow or deny
+	CIDR   string // CIDR range or single address
+}
+
+type TelemetryConfig struct {
+	Enabled     bool
+	ServiceName string
+	Endpoint    string // host:port of the OTLP/HTTP collector
+	Insecure    bool   // send over plain HTTP
+	Headers     map[string]string
+	SampleRatio float64 // fraction of new traces recorded
+}
+
+// APIConfig controls the API versions served next to each other
+type APIConfig struct {
+	V1 APIVersionConfig
+}
+
+// APIVersionConfig announces the retirement of a version; dates are YYYY-MM-DD and
+// nothing is announced while DeprecatedAt is empty
+type APIVersionConfig struct {
+	DeprecatedAt string
+	Sunset       string // when the version stops being served
+	DocsURL      string // migration guide
+}
+
+type AdminUIConfig struct {
+	Enabled bool // serve the embedded admin UI at /admin-ui
+}
+
+// AuthenticationConfig picks the backends checking sign-in credentials
+type AuthenticationConfig struct {
+	// Providers are tried in order until one accepts the credentials: local, ldap or
+	// another registered provider. Empty tries ldap (when enabled), then local.
+	Providers []string
+}
+
+// LDAPConfig enables sign-in against an LDAP directory or Active Directory
+type LDAPConfig struct {
+	Enabled        bool
+	URL            string // ldap://host:389 or ldaps://host:636
+	StartTLS       bool   // upgrade ldap:// connections before binding
+	CAFile         string // PEM CA bundle for the server certificate; system roots when empty
+	BindDN         string // service account used to look users up; anonymous when empty
+	BindPassword   string
+	BaseDN         string
+	LoginAttribute string // uid, or sAMAccountName for Active Directory
+	EmailAttribute string
+	GroupAttribute string
+	GroupRoles     []GroupRoleConfig // first matching group wins; members of none get the "user" role
+	TimeoutSeconds int
+}
+
+// GroupRoleConfig grants Role to members of Group
+type GroupRoleConfig struct {
+	Group string // LDAP group DN or common name, or SAML group attribute value
+	Role  string
+}
+
+// SAMLConfig configures SAML 2.0 sign-in; this service is the service provider for
+// every identity provider listed
+type SAMLConfig struct {
+	Enabled bool
+	// BaseURL is the public URL of /api/v1/auth/saml; provider endpoints are below it
+	BaseURL         string
+	CertificateFile string // optional PEM certificate and RSA key to sign requests and decrypt assertions
+	PrivateKeyFile  string
+	CompleteURL     string // receives the tokens in its fragment after sign-in; JSON is returned when empty
+	Providers       []SAMLProviderConfig
+}
+
+// SAMLProviderConfig is one identity provider, usually one per customer organization
+type SAMLProviderConfig struct {
+	Name              string // path segment: /api/v1/auth/saml/<name>/login
+	MetadataURL       string
+	MetadataFile      string // used instead of MetadataURL when set
+	EmailAttribute    string // the NameID is used when it is an email address and the attribute is missing
+	UsernameAttribute string // the local part of the email when empty
+	GroupsAttribute   string
+	GroupRoles        []GroupRoleConfig
+}
+
+type OrganizationsConfig struct {
+	InvitationURL      string // the invitation token is appended to this link
+	InvitationTTLHours int
+	TransferURL        string // the ownership transfer token is appended to this link
+	TransferTTLHours   int
+}
+
+type CompatConfig struct {
+	RefreshTokenStorage string // raw, dual or hashed
+}
+
+type CacheConfig struct {
+	Default string // policy for routes without a matching rule
+	Rules   []CacheRuleConfig
+}
+
+type CacheRuleConfig struct {
+	Path    string
+	Methods []string
+	Policy  string
+}
+
+type StorageConfig struct {
+	Backend         string // local or s3
+	LocalDir        string
+	ServeMode       string // redirect (signed URLs when supported) or proxy
+	SignedURLExpiry int    // minutes
+	S3              S3Config
+	Avatars         AvatarConfig
+}
+
+type AvatarConfig struct {
+	MaxUploadBytes int64
+	MaxDimension   int
+	ThumbnailSizes []int
+}
+
+type S3Config struct {
+	Bucket          string
+	Region          string
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+	UsePathStyle    bool
+}
+
+type SecurityConfig struct {
+	RevokeSessionsOnPasswordChange bool
+	Sessions                       SessionsConfig
+	PasswordReset                  PasswordResetConfig
+	EmailChange                    EmailChangeConfig
+	Invitation                     InvitationConfig
+	Reactivation                   ReactivationConfig
+	DeviceVerification             DeviceVerificationConfig
+	AccountLinking                 AccountLinkingConfig
+	GeoIP                          GeoIPConfig
+	Captcha                        CaptchaConfig
+	Throttle                       ThrottleConfig
+	UsernameChangeCooldownHours    int // minimum time between username changes, 0 disables
+	PasswordPolicy                 PasswordPolicyConfig
+	PasswordHashing                PasswordHashingConfig
+}
+
+// SessionsConfig limits where and how often an account is signed in
+type SessionsConfig struct {
+	// BindDevice only accepts a refresh token from the device it was issued to, by the
+	// X-Device-ID header or else the browser's user agent and content negotiation headers
+	BindDevice bool
+	// MaxPerUser ends the oldest sessions when a sign-in exceeds it; 0 for no limit
+	MaxPerUser int
+}
+
+// PasswordHashingConfig selects how new password hashes are made. Hashes of either
+// algorithm are accepted; one made differently is replaced at the user's next sign-in.
+type PasswordHashingConfig struct {
+	Algorithm  string // argon2id or bcrypt
+	BcryptCost int
+	Argon2     Argon2Config
+}
+
+type Argon2Config struct {
+	MemoryKB    uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type PasswordPolicyConfig struct {
+	MinLength           int
+	RequireUppercase    bool
+	RequireLowercase    bool
+	RequireDigit        bool
+	RequireSymbol       bool
+	DisallowUserInfo    bool   // reject passwords containing the username or email address
+	BannedPasswordsFile string // extra common passwords, one per line, on top of the built-in list
+	BreachCheck         BreachCheckConfig
+	HistorySize         int // recent passwords, the current one included, that cannot be reused; 0 disables
+	MinAgeHours         int // minimum time between password changes; 0 disables
+	MaxAgeDays          int // passwords older than this must be reset before signing in; 0 disables
+}
+
+// BreachCheckConfig configures the Have I Been Pwned lookup of new passwords
+type BreachCheckConfig struct {
+	Enabled        bool
+	Endpoint       string // Pwned Passwords API base URL
+	Threshold      int    // reject passwords seen in at least this many breaches
+	FailOpen       bool   // accept the password when the API cannot be reached
+	TimeoutSeconds int
+}
+
+type EmailChangeConfig struct {
+	URL             string // the confirmation token is appended to this link
+	TokenTTLMinutes int
+}
+
+// GeoIPConfig resolves sign-in locations with a MaxMind database to block countries
+// and detect impossible travel
+type GeoIPConfig struct {
+	Enabled          bool
+	DatabaseFile     string   // GeoIP2 or GeoLite2 City (or Country, without travel checks) .mmdb
+	BlockedCountries []string // ISO 3166-1 alpha-2 codes
+	ImpossibleTravel ImpossibleTravelConfig
+}
+
+type ImpossibleTravelConfig struct {
+	Enabled       bool
+	MaxSpeedKmh   float64 // faster travel between two sign-ins is impossible
+	MinDistanceKm float64 // shorter distances are ignored, as locations are approximate
+	Action        string  // alert or deny
+}
+
+// CaptchaConfig protects registration, password reset requests and, after repeated
+// failures, login with a CAPTCHA
+type CaptchaConfig struct {
+	Enabled        bool
+	Provider       string  // recaptcha, hcaptcha or turnstile
+	Secret         string  // the site's secret key
+	MinScore       float64 // reCAPTCHA v3 score required, 0 accepts any
+	TimeoutSeconds int
+	FailOpen       bool // accept requests while the provider cannot be reached
+	// Login asks for a CAPTCHA once an address failed LoginFailures times within the window
+	LoginFailures             int
+	LoginFailureWindowMinutes int
+}
+
+// ThrottleConfig delays logins and password reset requests after repeated failures,
+// doubling the delay with every failure past the allowance
+type ThrottleConfig struct {
+	Enabled         bool
+	Store           string // memory (per instance) or redis (shared)
+	AccountFree     int    // failures per login or email before delays start
+	IPFree          int    // failures per client address before delays start
+	BaseDelayMs     int
+	MaxDelaySeconds int
+	WindowMinutes   int // failures are forgotten this long after the last one
+	Redis           RedisConfig
+}
+
+type RedisConfig struct {
+	Address   string
+	Username  string
+	Password  string
+	DB        int
+	TLS       bool
+	KeyPrefix string
+}
+
+// DeviceVerificationConfig controls the confirmation of sign-ins from unrecognized devices
+type DeviceVerificationConfig struct {
+	Enabled         bool
+	URL             string // the confirmation token is appended to this link
+	TokenTTLMinutes int
+	MaxPerHour      int // confirmation emails per account and hour
+}
+
+// AccountLinkingConfig controls the confirmation that binds an existing account to an
+// LDAP or SAML identity with the same email
+type AccountLinkingConfig struct {
+	URL             string // the confirmation token is appended to this link
+	TokenTTLMinutes int
+	MaxPerHour      int // confirmation emails per account and hour
+}
+
+type ReactivationConfig struct {
+	URL             string // the reactivation token is appended to this link
+	TokenTTLMinutes int
+	MaxPerHour      int // reactivation emails per account and hour
+}
+
+type InvitationConfig struct {
+	URL           string // the invitation token is appended to this link
+	TokenTTLHours int
+}
+
+type PasswordResetConfig struct {
+	URL                 string // the reset token is appended to this link
+	TokenTTLMinutes     int
+	MaxPerHour          int // reset emails per account and hour
+	SetPasswordTTLHours int // of the link mailed to imported accounts to choose their password
+}
+
+type JobsConfig struct {
+	Instance                string // name of this instance in logs and metrics; defaults to hostname-pid
+	LockKey                 int64  // database lock shared by all instances: the Postgres advisory lock, or api-jobs-<key> on MySQL
+	ElectionIntervalSeconds int
+}
+
+// AnalyticsConfig controls the growth and retention figures aggregated from sign-ins
+type AnalyticsConfig struct {
+	BackfillDays            int // days aggregated by the first run
+	RetentionWeeks          int // weeks after signup cohorts are followed
+	LoginEventRetentionDays int // raw sign-ins are deleted after this
+}
+
+// EventsConfig controls publishing the user lifecycle events of the outbox table
+type EventsConfig struct {
+	Publisher            string // log or webhook
+	Webhook              EventWebhookConfig
+	Broker               EventBrokerConfig // published to as well when enabled
+	RelayIntervalSeconds int
+	BatchSize            int
+	MaxAttempts          int
+	RetryDelaySeconds    int // doubles after each failed attempt, up to an hour
+	RetentionDays        int // delivered events are purged after this
+}
+
+type EventWebhookConfig struct {
+	URLs           []string
+	Secret         string // signs every request, see events.WebhookConfig
+	TimeoutSeconds int
+}
+
+type EventBrokerConfig struct {
+	Enabled        bool
+	Type           string   // kafka or nats
+	Brokers        []string // Kafka bootstrap brokers or NATS server URLs
+	TopicPrefix    string   // the topic or subject is the prefix and the event name
+	Format         string   // json or avro
+	TimeoutSeconds int
+}
+
+type DSARConfig struct {
+	DeadlineDays     int
+	MaxExtensionDays int
+	ReminderDays     []int
+}
+
+type PrivacyConfig struct {
+	ErasureMode string // soft, anonymize or hard; applied when accounts are deleted
+	// DeletionGraceDays keeps accounts deleted by their users restorable this long before
+	// they are erased; 0 erases them at once
+	DeletionGraceDays int
+	DeletionUndoURL   string // the token of the link undoing a deletion is appended to this link
+}
+
+type ProfilesConfig struct {
+	Completeness CompletenessConfig
+}
+
+// CompletenessConfig scores how much of a profile is filled in. Without rules the
+// names are required and weigh 2 with the avatar; preferred name, pronouns, bio, locale
+// and timezone weigh 1.
+type CompletenessConfig struct {
+	Rules     []CompletenessRuleConfig
+	Threshold int // scores below this are listed by the incomplete profiles report
+}
+
+type CompletenessRuleConfig struct {
+	Field    string // profile field as named in the API, e.g. firstName or avatarURL
+	Weight   int
+	Required bool
+}
+
+type ExportsConfig struct {
+	TTLHours int // how long finished archives can be downloaded
+	Workers  int
+}
+
+type ImportsConfig struct {
+	MaxRows   int
+	MaxFileMB int
+	TTLHours  int // how long import reports can be downloaded
+}
+
+type APIKeysConfig struct {
+	Anomaly AnomalyConfig
+}
+
+type AnomalyConfig struct {
+	Enabled       bool
+	VolumeFactor  float64
+	MinRequests   int
+	LearningHours int
+	BaselineDays  int
+	AutoSuspend   bool
 }
 
 func LoadConfig() (*Config, error) {
@@ -42,12 +674,12 @@ func LoadConfig() (*Config, error) {
 	viper.AddConfigPath(".")
 	viper.AddConfigPath("./config")
 
-	viper.SetDefault("server.port", "8080")
-	viper.SetDefault("database.sslmode", "disable")
-	viper.SetDefault("jwt.accessExpiry", 15) // 15 minutes
-	viper.SetDefault("jwt.refreshExpiry", 7) // 7 days
-	viper.SetDefault("log.level", "info")
-	viper.SetDefault("log.file", "logs/app.log")
+	viper.BindEnv("environment", "APP_ENV")
+	viper.BindEnv("bootstrap.adminEmail", "BOOTSTRAP_ADMIN_EMAIL")
+	viper.BindEnv("bootstrap.adminUsername", "BOOTSTRAP_ADMIN_USERNAME")
+	viper.BindEnv("bootstrap.adminPassword", "BOOTSTRAP_ADMIN_PASSWORD")
+	viper.BindEnv("database.driver", "DATABASE_DRIVER")
+	setDefaults(viper.GetViper())
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, err
@@ -60,3 +692,195 @@ func LoadConfig() (*Config, error) {
 
 	return &config, nil
 }
+
+// Defaults returns the configuration of a file setting nothing, without reading the
+// file or the environment
+func Defaults() (*Config, error) {
+	v := viper.New()
+	setDefaults(v)
+	var config Config
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// setDefaults sets the value of every setting the configuration file may leave out
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("environment", "development")
+	v.SetDefault("server.port", "8080")
+	v.SetDefault("server.maxBodyKB", 1024)
+	v.SetDefault("server.tls.autocertCacheDir", "certs")
+	v.SetDefault("server.tls.redirectAddress", ":80")
+	v.SetDefault("server.tls.http2", true)
+	v.SetDefault("database.driver", "sqlite")
+	v.SetDefault("database.path", "data/api.db")
+	v.SetDefault("database.sslmode", "disable")
+	v.SetDefault("database.maxOpenConns", 25)
+	v.SetDefault("database.maxIdleConns", 10)
+	v.SetDefault("database.connMaxLifetimeMinutes", 30)
+	v.SetDefault("database.statementTimeoutSeconds", 0)
+	v.SetDefault("database.connectTimeoutSeconds", 60)
+	v.SetDefault("database.pingIntervalSeconds", 15)
+	v.SetDefault("jwt.algorithm", "HS256")
+	v.SetDefault("jwt.privateKeyFile", "")
+	v.SetDefault("jwt.issuer", "user-management-api")
+	v.SetDefault("jwt.audience", "user-management-api")
+	v.SetDefault("jwt.accessExpiry", 15) // 15 minutes
+	v.SetDefault("jwt.refreshExpiry", 7) // 7 days
+	v.SetDefault("jwt.impersonationExpiry", 15)
+	v.SetDefault("jwt.cacheTTLSeconds", 30)
+	v.SetDefault("jwt.cacheMaxEntries", 10000)
+	v.SetDefault("secrets.refreshSeconds", 300)
+	v.SetDefault("secrets.keys.jwtAccessSecret", "jwt_access_secret")
+	v.SetDefault("secrets.keys.jwtRefreshSecret", "jwt_refresh_secret")
+	v.SetDefault("secrets.keys.databasePassword", "database_password")
+	v.SetDefault("secrets.vault.mount", "secret")
+	v.SetDefault("secrets.vault.kvVersion", 2)
+	v.SetDefault("analytics.backfillDays", 90)
+	v.SetDefault("analytics.retentionWeeks", 12)
+	v.SetDefault("analytics.loginEventRetentionDays", 180)
+	v.SetDefault("log.level", "info")
+	v.SetDefault("log.file", "logs/app.log")
+	v.SetDefault("compat.refreshTokenStorage", "hashed")
+	v.SetDefault("email.provider", "log")
+	v.SetDefault("email.from", "no-reply@localhost")
+	v.SetDefault("email.smtp.port", 587)
+	v.SetDefault("email.queue.workers", 2)
+	v.SetDefault("email.queue.size", 1000)
+	v.SetDefault("email.queue.maxAttempts", 5)
+	v.SetDefault("email.queue.retryDelaySeconds", 30)
+	v.SetDefault("cache.default", "no-store")
+	v.SetDefault("cors.allowOrigins", []string{"http://localhost:3000"})
+	v.SetDefault("cors.allowMethods", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
+	v.SetDefault("cors.allowHeaders", []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Request-ID", "X-Device-ID", "X-Captcha-Token", "If-None-Match", "If-Modified-Since"})
+	v.SetDefault("cors.exposeHeaders", []string{"Content-Length", "Content-Language", "X-Locale-Source", "X-Request-ID", "ETag", "Deprecation", "Sunset", "Link"})
+	v.SetDefault("cors.allowCredentials", true)
+	v.SetDefault("cors.maxAgeSeconds", 43200)
+	v.SetDefault("ipFilter.reloadSeconds", 60)
+	v.SetDefault("featureFlags.reloadSeconds", 30)
+	v.SetDefault("telemetry.enabled", false)
+	v.SetDefault("telemetry.serviceName", "user-management-api")
+	v.SetDefault("telemetry.endpoint", "localhost:4318")
+	v.SetDefault("telemetry.insecure", true)
+	v.SetDefault("telemetry.sampleRatio", 1.0)
+	v.SetDefault("adminUI.enabled", false)
+	v.SetDefault("ldap.enabled", false)
+	v.SetDefault("ldap.startTLS", false)
+	v.SetDefault("ldap.loginAttribute", "uid")
+	v.SetDefault("ldap.emailAttribute", "mail")
+	v.SetDefault("ldap.groupAttribute", "memberOf")
+	v.SetDefault("ldap.timeoutSeconds", 5)
+	v.SetDefault("saml.enabled", false)
+	v.SetDefault("saml.baseURL", "http://localhost:8080/api/v1/auth/saml")
+	v.SetDefault("organizations.invitationURL", "http://localhost:3000/join-organization?token=")
+	v.SetDefault("organizations.invitationTTLHours", 168)
+	v.SetDefault("organizations.transferURL", "http://localhost:3000/accept-ownership?token=")
+	v.SetDefault("organizations.transferTTLHours", 72)
+	v.SetDefault("security.revokeSessionsOnPasswordChange", true)
+	v.SetDefault("security.sessions.bindDevice", true)
+	v.SetDefault("security.sessions.maxPerUser", 5)
+	v.SetDefault("security.passwordReset.url", "http://localhost:3000/reset-password?token=")
+	v.SetDefault("security.passwordReset.tokenTTLMinutes", 60)
+	v.SetDefault("security.passwordReset.maxPerHour", 3)
+	v.SetDefault("security.passwordReset.setPasswordTTLHours", 72)
+	v.SetDefault("security.emailChange.url", "http://localhost:3000/confirm-email?token=")
+	v.SetDefault("security.emailChange.tokenTTLMinutes", 1440)
+	v.SetDefault("security.deviceVerification.enabled", false)
+	v.SetDefault("security.deviceVerification.url", "http://localhost:3000/confirm-device?token=")
+	v.SetDefault("security.deviceVerification.tokenTTLMinutes", 30)
+	v.SetDefault("security.deviceVerification.maxPerHour", 5)
+	v.SetDefault("security.accountLinking.url", "http://localhost:3000/confirm-link?token=")
+	v.SetDefault("security.accountLinking.tokenTTLMinutes", 30)
+	v.SetDefault("security.accountLinking.maxPerHour", 5)
+	v.SetDefault("security.captcha.enabled", false)
+	v.SetDefault("security.captcha.provider", "turnstile")
+	v.SetDefault("security.captcha.timeoutSeconds", 5)
+	v.SetDefault("security.captcha.loginFailures", 3)
+	v.SetDefault("security.captcha.loginFailureWindowMinutes", 15)
+	v.SetDefault("security.throttle.enabled", true)
+	v.SetDefault("security.throttle.store", "memory")
+	v.SetDefault("security.throttle.accountFree", 3)
+	v.SetDefault("security.throttle.ipFree", 10)
+	v.SetDefault("security.throttle.baseDelayMs", 500)
+	v.SetDefault("security.throttle.maxDelaySeconds", 10)
+	v.SetDefault("security.throttle.windowMinutes", 15)
+	v.SetDefault("security.throttle.redis.address", "localhost:6379")
+	v.SetDefault("security.throttle.redis.keyPrefix", "throttle:")
+	v.SetDefault("security.geoIP.enabled", false)
+	v.SetDefault("security.geoIP.databaseFile", "GeoLite2-City.mmdb")
+	v.SetDefault("security.geoIP.impossibleTravel.enabled", true)
+	v.SetDefault("security.geoIP.impossibleTravel.maxSpeedKmh", 1000)
+	v.SetDefault("security.geoIP.impossibleTravel.minDistanceKm", 500)
+	v.SetDefault("security.geoIP.impossibleTravel.action", "alert")
+	v.SetDefault("security.reactivation.url", "http://localhost:3000/reactivate?token=")
+	v.SetDefault("security.reactivation.tokenTTLMinutes", 1440)
+	v.SetDefault("security.reactivation.maxPerHour", 3)
+	v.SetDefault("security.invitation.url", "http://localhost:3000/register?invitation=")
+	v.SetDefault("security.invitation.tokenTTLHours", 168)
+	v.SetDefault("security.usernameChangeCooldownHours", 720)
+	v.SetDefault("security.passwordPolicy.minLength", 8)
+	v.SetDefault("security.passwordPolicy.requireUppercase", false)
+	v.SetDefault("security.passwordPolicy.requireLowercase", false)
+	v.SetDefault("security.passwordPolicy.requireDigit", false)
+	v.SetDefault("security.passwordPolicy.requireSymbol", false)
+	v.SetDefault("security.passwordPolicy.disallowUserInfo", true)
+	v.SetDefault("security.passwordPolicy.bannedPasswordsFile", "")
+	v.SetDefault("security.passwordPolicy.breachCheck.enabled", false)
+	v.SetDefault("security.passwordPolicy.breachCheck.endpoint", "https://api.pwnedpasswords.com")
+	v.SetDefault("security.passwordPolicy.breachCheck.threshold", 1)
+	v.SetDefault("security.passwordPolicy.breachCheck.failOpen", true)
+	v.SetDefault("security.passwordPolicy.breachCheck.timeoutSeconds", 3)
+	v.SetDefault("security.passwordPolicy.historySize", 5)
+	v.SetDefault("security.passwordPolicy.minAgeHours", 0)
+	v.SetDefault("security.passwordPolicy.maxAgeDays", 0)
+	v.SetDefault("security.passwordHashing.algorithm", "argon2id")
+	v.SetDefault("security.passwordHashing.bcryptCost", 10)
+	v.SetDefault("security.passwordHashing.argon2.memoryKB", 65536)
+	v.SetDefault("security.passwordHashing.argon2.iterations", 3)
+	v.SetDefault("security.passwordHashing.argon2.parallelism", 4)
+	v.SetDefault("security.passwordHashing.argon2.saltLength", 16)
+	v.SetDefault("security.passwordHashing.argon2.keyLength", 32)
+	v.SetDefault("apiKeys.anomaly.enabled", true)
+	v.SetDefault("apiKeys.anomaly.volumeFactor", 10)
+	v.SetDefault("apiKeys.anomaly.minRequests", 100)
+	v.SetDefault("apiKeys.anomaly.learningHours", 24)
+	v.SetDefault("apiKeys.anomaly.baselineDays", 7)
+	v.SetDefault("apiKeys.anomaly.autoSuspend", false)
+	v.SetDefault("log.maxSizeMB", 512)
+	v.SetDefault("log.maxDiskUsagePercent", 95)
+	v.SetDefault("log.fallbackLevel", "warn")
+	v.SetDefault("privacy.erasureMode", "soft")
+	v.SetDefault("privacy.deletionGraceDays", 30)
+	v.SetDefault("profiles.completeness.threshold", 80)
+	v.SetDefault("privacy.deletionUndoURL", "http://localhost:3000/reactivate?token=")
+	v.SetDefault("events.publisher", "log")
+	v.SetDefault("events.webhook.timeoutSeconds", 10)
+	v.SetDefault("events.broker.enabled", false)
+	v.SetDefault("events.broker.type", "kafka")
+	v.SetDefault("events.broker.topicPrefix", "identity.")
+	v.SetDefault("events.broker.format", "json")
+	v.SetDefault("events.broker.timeoutSeconds", 10)
+	v.SetDefault("events.relayIntervalSeconds", 5)
+	v.SetDefault("events.batchSize", 100)
+	v.SetDefault("events.maxAttempts", 10)
+	v.SetDefault("events.retryDelaySeconds", 30)
+	v.SetDefault("events.retentionDays", 7)
+	v.SetDefault("jobs.lockKey", 727274)
+	v.SetDefault("jobs.electionIntervalSeconds", 15)
+	v.SetDefault("dsar.deadlineDays", 30)
+	v.SetDefault("dsar.maxExtensionDays", 60)
+	v.SetDefault("dsar.reminderDays", []int{7, 2})
+	v.SetDefault("exports.ttlHours", 24)
+	v.SetDefault("exports.workers", 2)
+	v.SetDefault("imports.maxRows", 5000)
+	v.SetDefault("imports.maxFileMB", 5)
+	v.SetDefault("imports.ttlHours", 24)
+	v.SetDefault("storage.backend", "local")
+	v.SetDefault("storage.avatars.maxUploadBytes", 5<<20)
+	v.SetDefault("storage.avatars.maxDimension", 1024)
+	v.SetDefault("storage.avatars.thumbnailSizes", []int{256, 64})
+	v.SetDefault("storage.localDir", "uploads")
+	v.SetDefault("storage.serveMode", "redirect")
+	v.SetDefault("storage.signedURLExpiry", 15) // 15 minutes
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Watcher reloads the configuration file when it changes and hands the new
+// configuration to its subscribers. Settings read only at startup are reported
+// with a warning that a restart is required.
+type Watcher struct {
+	logger *logrus.Logger
+
+	mu          sync.Mutex
+	current     *Config
+	subscribers []func(*Config)
+}
+
+// Watch starts watching the file LoadConfig read initial from
+func Watch(initial *Config, logger *logrus.Logger) *Watcher {
+	w := &Watcher{logger: logger, current: initial}
+	viper.OnConfigChange(func(event fsnotify.Event) {
+		w.reload(event.Name)
+	})
+	viper.WatchConfig()
+	return w
+}
+
+// Current returns the most recently loaded configuration
+func (w *Watcher) Current() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Subscribe registers fn to be called with every reloaded configuration.
+// Subscribers are called one at a time and must not block.
+func (w *Watcher) Subscribe(fn func(*Config)) {
+	w.mu.Lock()
+	w.subscribers = append(w.subscribers, fn)
+	w.mu.Unlock()
+}
+
+func (w *Watcher) reload(file string) {
+	var next Config
+	if err := viper.Unmarshal(&next); err != nil {
+		w.logger.WithError(err).WithField("file", file).Error("Failed to reload configuration, keeping the current one")
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, setting := range restartRequired(w.current, &next) {
+		w.logger.WithField("setting", setting).Warn("Configuration change requires a restart to take effect")
+	}
+	w.current = &next
+	for _, fn := range w.subscribers {
+		fn(&next)
+	}
+	w.logger.WithField("file", file).Info("Configuration reloaded")
+}
+
+// restartRequired lists the changed settings that are only read at startup
+func restartRequired(old, next *Config) []string {
+	immutable := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"environment", old.Environment, next.Environment},
+		{"bootstrap", old.Bootstrap, next.Bootstrap},
+		{"server", old.Server, next.Server},
+		{"database", old.Database, next.Database},
+		{"jwt.algorithm", old.JWT.Algorithm, next.JWT.Algorithm},
+		{"jwt.accessSecret", old.JWT.AccessSecret, next.JWT.AccessSecret},
+		{"jwt.privateKeyFile", old.JWT.PrivateKeyFile, next.JWT.PrivateKeyFile},
+		{"jwt.refreshSecret", old.JWT.RefreshSecret, next.JWT.RefreshSecret},
+		{"jwt.issuer", old.JWT.Issuer, next.JWT.Issuer},
+		{"jwt.audience", old.JWT.Audience, next.JWT.Audience},
+		{"jwt.previousAccessKeys", old.JWT.PreviousAccessKeys, next.JWT.PreviousAccessKeys},
+		{"jwt.previousRefreshSecrets", old.JWT.PreviousRefreshSecrets, next.JWT.PreviousRefreshSecrets},
+		{"jwt.cacheTTLSeconds", old.JWT.CacheTTLSeconds, next.JWT.CacheTTLSeconds},
+		{"jwt.cacheMaxEntries", old.JWT.CacheMaxEntries, next.JWT.CacheMaxEntries},
+		{"jwt.claims", old.JWT.Claims, next.JWT.Claims},
+		{"secrets", old.Secrets, next.Secrets},
+		{"encryption", old.Encryption, next.Encryption},
+		{"log.file", old.Log.File, next.Log.File},
+		{"log.maxSizeMB", old.Log.MaxSizeMB, next.Log.MaxSizeMB},
+		{"log.maxDiskUsagePercent", old.Log.MaxDiskUsagePercent, next.Log.MaxDiskUsagePercent},
+		{"log.fallbackLevel", old.Log.FallbackLevel, next.Log.FallbackLevel},
+		{"email", old.Email, next.Email},
+		{"compat", old.Compat, next.Compat},
+		{"cache", old.Cache, next.Cache},
+		{"storage", old.Storage, next.Storage},
+		{"adminUI", old.AdminUI, next.AdminUI},
+		{"security", old.Security, next.Security},
+		{"apiKeys", old.APIKeys, next.APIKeys},
+		{"exports", old.Exports, next.Exports},
+		{"privacy", old.Privacy, next.Privacy},
+		{"profiles", old.Profiles, next.Profiles},
+		{"dsar", old.DSAR, next.DSAR},
+		{"jobs", old.Jobs, next.Jobs},
+		{"analytics", old.Analytics, next.Analytics},
+		{"telemetry", old.Telemetry, next.Telemetry},
+		{"authentication", old.Authentication, next.Authentication},
+		{"ldap", old.LDAP, next.LDAP},
+		{"saml", old.SAML, next.SAML},
+		{"organizations", old.Organizations, next.Organizations},
+		{"ipFilter.reloadSeconds", old.IPFilter.ReloadSeconds, next.IPFilter.ReloadSeconds},
+		{"featureFlags.reloadSeconds", old.FeatureFlags.ReloadSeconds, next.FeatureFlags.ReloadSeconds},
+	}
+
+	var changed []string
+	for _, setting := range immutable {
+		if !reflect.DeepEqual(setting.old, setting.new) {
+			changed = append(changed, setting.name)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,336 @@
+// Admin UI for the User Management API. Tokens are kept in sessionStorage, so closing
+// the tab signs the admin out. All user data is rendered with textContent.
+(function () {
+  'use strict';
+
+  var API = '/api/v1';
+  var PAGE = 50;
+
+  var state = {
+    users: [],
+    selected: null,
+    timelineLimit: PAGE,
+  };
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function tokens() {
+    return {
+      access: sessionStorage.getItem('adminui.access'),
+      refresh: sessionStorage.getItem('adminui.refresh'),
+    };
+  }
+
+  function storeTokens(access, refresh) {
+    sessionStorage.setItem('adminui.access', access);
+    sessionStorage.setItem('adminui.refresh', refresh);
+  }
+
+  function clearTokens() {
+    sessionStorage.removeItem('adminui.access');
+    sessionStorage.removeItem('adminui.refresh');
+    sessionStorage.removeItem('adminui.user');
+  }
+
+  function notify(message, isError) {
+    var el = $('notice');
+    el.textContent = message;
+    el.className = isError ? 'error' : '';
+    el.hidden = !message;
+  }
+
+  // request calls the API, refreshing the access token once if it has expired
+  async function request(method, path, body, retried) {
+    var headers = { Accept: 'application/json' };
+    var access = tokens().access;
+    if (access) {
+      headers.Authorization = 'Bearer ' + access;
+    }
+    if (body !== undefined) {
+      headers['Content-Type'] = 'application/json';
+    }
+    var resp = await fetch(API + path, {
+      method: method,
+      headers: headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (resp.status === 401 && !retried && tokens().refresh) {
+      if (await refresh()) {
+        return request(method, path, body, true);
+      }
+      signedOut('Your session expired, please sign in again.');
+      throw new Error('Session expired');
+    }
+    var data = null;
+    if ((resp.headers.get('Content-Type') || '').indexOf('application/json') === 0) {
+      data = await resp.json();
+    }
+    if (!resp.ok) {
+      throw new Error((data && data.error) || 'Request failed with status ' + resp.status);
+    }
+    return data;
+  }
+
+  async function refresh() {
+    var resp = await fetch(API + '/auth/refresh', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refresh_token: tokens().refresh }),
+    });
+    if (!resp.ok) {
+      return false;
+    }
+    var data = await resp.json();
+    storeTokens(data.access_token, data.refresh_token);
+    return true;
+  }
+
+  function signedOut(message) {
+    clearTokens();
+    $('session').hidden = true;
+    $('main-view').hidden = true;
+    $('login-view').hidden = false;
+    notify(message || '', Boolean(message));
+  }
+
+  function signedIn() {
+    var user = JSON.parse(sessionStorage.getItem('adminui.user') || '{}');
+    $('whoami').textContent = user.username || '';
+    $('session').hidden = false;
+    $('login-view').hidden = true;
+    $('main-view').hidden = false;
+    loadUsers();
+  }
+
+  async function login(event) {
+    event.preventDefault();
+    var form = event.target;
+    try {
+      var data = await request('POST', '/auth/login', {
+        login: form.login.value,
+        password: form.password.value,
+      });
+      if (data.user.role !== 'admin') {
+        throw new Error('This account is not an admin');
+      }
+      storeTokens(data.access_token, data.refresh_token);
+      sessionStorage.setItem('adminui.user', JSON.stringify(data.user));
+      form.reset();
+      notify('');
+      signedIn();
+    } catch (err) {
+      clearTokens();
+      notify(err.message, true);
+    }
+  }
+
+  async function logout() {
+    var refreshToken = tokens().refresh;
+    try {
+      await request('POST', '/auth/logout', { refresh_token: refreshToken });
+    } catch (err) {
+      // Signed out locally either way
+    }
+    signedOut('');
+  }
+
+  function cell(row, text, className) {
+    var td = document.createElement('td');
+    td.textContent = text === undefined || text === null ? '' : String(text);
+    if (className) {
+      td.className = className;
+    }
+    row.appendChild(td);
+    return td;
+  }
+
+  function displayName(user) {
+    var p = user.profile || {};
+    return [p.preferredName || p.firstName, p.lastName].filter(Boolean).join(' ');
+  }
+
+  async function loadUsers() {
+    try {
+      var data = await request('GET', '/admin/users');
+      state.users = data.users || [];
+      renderUsers();
+    } catch (err) {
+      notify(err.message, true);
+    }
+  }
+
+  function renderUsers() {
+    var query = $('search').value.trim().toLowerCase();
+    var rows = $('user-rows');
+    rows.textContent = '';
+    var shown = 0;
+    state.users.forEach(function (user) {
+      var haystack = [user.id, user.email, user.username, displayName(user)].join(' ').toLowerCase();
+      if (query && haystack.indexOf(query) === -1) {
+        return;
+      }
+      shown++;
+      var row = document.createElement('tr');
+      if (state.selected === user.id) {
+        row.className = 'selected';
+      }
+      cell(row, user.id);
+      cell(row, user.username);
+      cell(row, user.email);
+      cell(row, user.role);
+      cell(row, user.status, 'status-' + user.status);
+      cell(row, user.verified ? 'yes' : 'no');
+      row.addEventListener('click', function () {
+        selectUser(user.id);
+      });
+      rows.appendChild(row);
+    });
+    $('user-count').textContent = shown + ' of ' + state.users.length + ' users';
+  }
+
+  function findUser(id) {
+    return state.users.find(function (u) {
+      return u.id === id;
+    });
+  }
+
+  async function selectUser(id) {
+    state.selected = id;
+    state.timelineLimit = PAGE;
+    renderUsers();
+    try {
+      var preview = await request('GET', '/admin/users/' + id + '/preview');
+      renderDetail(preview);
+      await loadTimeline();
+      $('detail').hidden = false;
+    } catch (err) {
+      notify(err.message, true);
+    }
+  }
+
+  function renderDetail(preview) {
+    var user = preview.profile.user;
+    var profile = preview.profile.profile;
+    var listed = findUser(user.id) || {};
+    $('detail-title').textContent = user.username + ' (#' + user.id + ')';
+
+    var fields = [
+      ['Email', user.email],
+      ['Role', user.role],
+      ['Status', listed.status],
+      ['Verified', listed.verified ? 'yes' : 'no'],
+      ['Created', listed.createdAt],
+      ['Name', [profile.honorific, profile.firstName, profile.lastName].filter(Boolean).join(' ')],
+      ['Preferred name', profile.preferredName],
+      ['Pronouns', profile.pronouns],
+      ['Locale', profile.locale],
+      ['Timezone', profile.timezone],
+      ['Bio', profile.bio],
+    ];
+    var dl = $('detail-fields');
+    dl.textContent = '';
+    fields.forEach(function (field) {
+      var dt = document.createElement('dt');
+      dt.textContent = field[0];
+      var dd = document.createElement('dd');
+      dd.textContent = field[1] || '';
+      dl.appendChild(dt);
+      dl.appendChild(dd);
+    });
+
+    $('role-form').role.value = user.role;
+    $('status-line').textContent = 'Current status: ' + (listed.status || 'unknown');
+  }
+
+  async function loadTimeline() {
+    var data = await request('GET', '/admin/users/' + state.selected + '/timeline?limit=' + state.timelineLimit);
+    var items = data.items || [];
+    var rows = $('timeline-rows');
+    rows.textContent = '';
+    items.forEach(function (item) {
+      var row = document.createElement('tr');
+      cell(row, new Date(item.at).toLocaleString());
+      cell(row, item.kind);
+      cell(row, item.type);
+      cell(row, item.actorId);
+      var details = cell(row, '');
+      var pre = document.createElement('pre');
+      pre.textContent = item.details ? JSON.stringify(item.details, null, 2) : '';
+      details.appendChild(pre);
+      rows.appendChild(row);
+    });
+    $('more').hidden = items.length < state.timelineLimit || state.timelineLimit >= 200;
+  }
+
+  async function refreshSelected(message) {
+    notify(message);
+    await loadUsers();
+    await selectUser(state.selected);
+  }
+
+  async function changeRole(event) {
+    event.preventDefault();
+    var role = event.target.role.value;
+    try {
+      await request('PUT', '/admin/users/' + state.selected + '/role', { role: role });
+      await refreshSelected('Role changed to ' + role + '.');
+    } catch (err) {
+      notify(err.message, true);
+    }
+  }
+
+  async function suspend(event) {
+    event.preventDefault();
+    var form = event.target;
+    var body = { reason: form.reason.value, ban: form.ban.checked };
+    if (form.until.value && !body.ban) {
+      body.until = new Date(form.until.value).toISOString();
+    }
+    var what = body.ban ? 'Ban' : 'Suspend';
+    if (!window.confirm(what + ' this user? All of their sessions end immediately.')) {
+      return;
+    }
+    try {
+      await request('PUT', '/admin/users/' + state.selected + '/suspend', body);
+      form.reset();
+      await refreshSelected(body.ban ? 'User banned.' : 'User suspended.');
+    } catch (err) {
+      notify(err.message, true);
+    }
+  }
+
+  async function reinstate() {
+    try {
+      await request('PUT', '/admin/users/' + state.selected + '/reinstate');
+      await refreshSelected('User reinstated.');
+    } catch (err) {
+      notify(err.message, true);
+    }
+  }
+
+  async function more() {
+    state.timelineLimit = Math.min(state.timelineLimit + PAGE, 200);
+    try {
+      await loadTimeline();
+    } catch (err) {
+      notify(err.message, true);
+    }
+  }
+
+  $('login-form').addEventListener('submit', login);
+  $('logout').addEventListener('click', logout);
+  $('search').addEventListener('input', renderUsers);
+  $('reload').addEventListener('click', loadUsers);
+  $('role-form').addEventListener('submit', changeRole);
+  $('suspend-form').addEventListener('submit', suspend);
+  $('reinstate').addEventListener('click', reinstate);
+  $('more').addEventListener('click', more);
+
+  if (tokens().access) {
+    signedIn();
+  } else {
+    signedOut('');
+  }
+})();
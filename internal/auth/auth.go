@@ -1,11 +1,17 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type TokenPair struct {
@@ -13,38 +19,160 @@ type TokenPair struct {
 	RefreshToken string
 }
 
+// HashPassword hashes password with the configured PasswordHasher
 func HashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
+	return passwordHasher().Hash(password)
+}
+
+// ComparePasswords checks password against a hash of any supported algorithm
+func ComparePasswords(hashedPassword, password string) error {
+	return passwordHasher().Compare(hashedPassword, password)
+}
+
+// GenerateRandomToken returns a hex encoded random string built from n random bytes
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	return string(hashedBytes), nil
+	return hex.EncodeToString(b), nil
 }
 
-func ComparePasswords(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+// Character classes of temporary passwords. Look-alikes such as 0/O and 1/l are left
+// out since the passwords are read and typed by people, and so are the symbols
+// spreadsheets take as the start of a formula (= + - @).
+var temporaryPasswordClasses = []string{
+	"ABCDEFGHJKLMNPQRSTUVWXYZ",
+	"abcdefghijkmnpqrstuvwxyz",
+	"23456789",
+	"!#$%&*?",
 }
 
-func GenerateTokenPair(userID uint, role string, accessSecret, refreshSecret string, accessExpiry int, refreshExpiry int) (*TokenPair, error) {
-	// Generate access token
-	accessToken := jwt.New(jwt.SigningMethodHS256)
-	accessClaims := accessToken.Claims.(jwt.MapClaims)
-	accessClaims["userID"] = userID
-	accessClaims["role"] = role
-	accessClaims["exp"] = time.Now().Add(time.Minute * time.Duration(accessExpiry)).Unix()
+// GenerateTemporaryPassword returns a random password of length characters with at
+// least one upper case letter, lower case letter, digit and symbol
+func GenerateTemporaryPassword(length int) (string, error) {
+	if length < len(temporaryPasswordClasses) {
+		length = len(temporaryPasswordClasses)
+	}
+	all := strings.Join(temporaryPasswordClasses, "")
+	password := make([]byte, length)
+	for i := range password {
+		// The first characters cover every class; they are shuffled below
+		alphabet := all
+		if i < len(temporaryPasswordClasses) {
+			alphabet = temporaryPasswordClasses[i]
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = alphabet[n.Int64()]
+	}
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+	return string(password), nil
+}
+
+// HashToken returns the hex encoded SHA-256 digest of a token for storage
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenSettings controls how GenerateTokenPair signs tokens
+type TokenSettings struct {
+	AccessKeys    *KeySet
+	RefreshKeys   *KeySet
+	Issuer        string // "iss" of every token
+	Audience      string // "aud" of access tokens; refresh tokens are only for the issuer
+	AccessExpiry  int    // minutes
+	RefreshExpiry int    // days
+	// Claims adds deployment specific claims to access tokens; nil adds none
+	Claims *ClaimsChain
+	// Clock tells the time tokens are issued at; nil for SystemClock
+	Clock Clock
+}
+
+func (s TokenSettings) now() time.Time {
+	if s.Clock == nil {
+		return time.Now()
+	}
+	return s.Clock.Now()
+}
+
+// refreshAudience is the "aud" of refresh tokens, which only the issuer accepts
+func refreshAudience(issuer string) string {
+	return issuer + "/refresh"
+}
+
+// Organization is the organization an access token acts for and the user's role in it
+type Organization struct {
+	ID   uint
+	Role string
+}
+
+// Subject is who an access token is issued to
+type Subject struct {
+	UserID uint
+	Role   string
+	// SessionID identifies the login session (refresh token family), the "sid" claim
+	SessionID string
+	// Organization is embedded as the "org" and "org_role" claims when set
+	Organization *Organization
+	// Groups are the names of the user's groups, the "groups" claim
+	Groups []string
+	// Scopes limit the token to the routes requiring one of them, the "scopes" claim;
+	// none leave it unrestricted
+	Scopes []string
+	// Impersonator is the admin acting as the user, the "impersonator" and
+	// "impersonator_sid" claims; only set on tokens from GenerateAccessToken
+	Impersonator *Impersonator
+}
 
-	accessTokenString, err := accessToken.SignedString([]byte(accessSecret))
+// Impersonator is an admin acting as another user and the admin's own session
+type Impersonator struct {
+	UserID    uint
+	SessionID string
+}
+
+// HasScope reports whether granted allows required: a scope allows itself and the
+// scopes nested under it, so "admin" allows "admin:users"
+func HasScope(granted []string, required string) bool {
+	for _, scope := range granted {
+		if scope == required || strings.HasPrefix(required, scope+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateTokenPair issues an access and refresh token for subject
+func GenerateTokenPair(subject Subject, settings TokenSettings) (*TokenPair, error) {
+	now := settings.now()
+
+	// Generate access token
+	accessClaims, err := accessTokenClaims(subject, settings, now)
+	if err != nil {
+		return nil, err
+	}
+	accessTokenString, err := settings.AccessKeys.Sign(accessClaims)
 	if err != nil {
 		return nil, err
 	}
 
 	// Generate refresh token
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
-	refreshClaims := refreshToken.Claims.(jwt.MapClaims)
-	refreshClaims["userID"] = userID
-	refreshClaims["exp"] = time.Now().Add(time.Hour * 24 * time.Duration(refreshExpiry)).Unix()
+	refreshClaims, err := standardClaims(settings.Issuer, refreshAudience(settings.Issuer), now, time.Hour*24*time.Duration(settings.RefreshExpiry))
+	if err != nil {
+		return nil, err
+	}
+	refreshClaims["userID"] = subject.UserID
 
-	refreshTokenString, err := refreshToken.SignedString([]byte(refreshSecret))
+	refreshTokenString, err := settings.RefreshKeys.Sign(refreshClaims)
 	if err != nil {
 		return nil, err
 	}
@@ -55,18 +183,147 @@ func GenerateTokenPair(userID uint, role string, accessSecret, refreshSecret str
 	}, nil
 }
 
-func ValidateRefreshToken(tokenString, refreshSecret string) (uint, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(refreshSecret), nil
-	})
+// GenerateAccessToken issues an access token for subject without a refresh token, valid
+// for settings.AccessExpiry minutes, and returns it with its expiry
+func GenerateAccessToken(subject Subject, settings TokenSettings) (string, time.Time, error) {
+	now := settings.now()
+	claims, err := accessTokenClaims(subject, settings, now)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if imp := subject.Impersonator; imp != nil {
+		claims["impersonator"] = imp.UserID
+		claims["impersonator_sid"] = imp.SessionID
+	}
+	token, err := settings.AccessKeys.Sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, time.Unix(claims["exp"].(int64), 0), nil
+}
 
-	if err != nil || !token.Valid {
-		return 0, errors.New("invalid refresh token")
+func accessTokenClaims(subject Subject, settings TokenSettings, now time.Time) (jwt.MapClaims, error) {
+	claims, err := standardClaims(settings.Issuer, settings.Audience, now, time.Minute*time.Duration(settings.AccessExpiry))
+	if err != nil {
+		return nil, err
+	}
+	claims["userID"] = subject.UserID
+	claims["role"] = subject.Role
+	claims["sid"] = subject.SessionID
+	if org := subject.Organization; org != nil {
+		claims["org"] = org.ID
+		claims["org_role"] = org.Role
+	}
+	groups := subject.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+	claims["groups"] = groups
+	if len(subject.Scopes) > 0 {
+		claims["scopes"] = subject.Scopes
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, errors.New("invalid token claims")
+	extra, err := settings.Claims.Claims(subject)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range extra {
+		claims[name] = value
+	}
+	return claims, nil
+}
+
+// standardClaims returns the registered claims of a token valid from now for ttl.
+// The random jti keeps tokens issued within the same second apart. iat has microsecond
+// precision, so revoking a user's tokens spares those issued right after.
+func standardClaims(issuer, audience string, now time.Time, ttl time.Duration) (jwt.MapClaims, error) {
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	return jwt.MapClaims{
+		"iss": issuer,
+		"aud": audience,
+		"iat": IssuedAtClaim(now),
+		"nbf": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+		"jti": jti,
+	}, nil
+}
+
+// IssuedAtClaim is the iat of a token issued at t: seconds since the epoch with
+// microseconds as fraction
+func IssuedAtClaim(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1e6
+}
+
+// IssuedAt reads an iat claim written by IssuedAtClaim, or a whole number of seconds
+func IssuedAt(iat float64) time.Time {
+	return time.UnixMicro(int64(math.Round(iat * 1e6)))
+}
+
+// TokenVerifier checks the signature and registered claims of tokens of one kind
+type TokenVerifier struct {
+	keys     *KeySet
+	issuer   string
+	audience string
+	// Refresh tokens issued before tokens carried iss and aud are still accepted; they
+	// are single use and replaced by fully claimed tokens when exchanged
+	allowLegacy bool
+}
+
+// NewAccessTokenVerifier verifies access tokens issued with the same settings
+func NewAccessTokenVerifier(keys *KeySet, issuer, audience string) *TokenVerifier {
+	return &TokenVerifier{keys: keys, issuer: issuer, audience: audience}
+}
+
+// NewRefreshTokenVerifier verifies refresh tokens issued by issuer
+func NewRefreshTokenVerifier(keys *KeySet, issuer string) *TokenVerifier {
+	return &TokenVerifier{keys: keys, issuer: issuer, audience: refreshAudience(issuer), allowLegacy: true}
+}
+
+// Verify returns the claims of a valid token. The token must be signed with one of
+// the key set's algorithms by a known key, come from the expected issuer for the
+// expected audience, be within its iat, nbf and exp window and carry a jti.
+func (v *TokenVerifier) Verify(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, v.keys.Keyfunc,
+		jwt.WithValidMethods(v.keys.Algorithms()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if jti, _ := claims["jti"].(string); jti == "" {
+		return nil, errors.New("token has no jti")
+	}
+	if _, ok := claims["iss"]; !ok && v.allowLegacy {
+		return claims, nil
+	}
+
+	for _, name := range []string{"iat", "nbf"} {
+		if _, ok := claims[name]; !ok {
+			return nil, fmt.Errorf("token has no %s", name)
+		}
+	}
+	err = jwt.NewValidator(
+		jwt.WithIssuer(v.issuer),
+		jwt.WithAudience(v.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	).Validate(claims)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// ValidateRefreshToken returns the user a refresh token was issued to
+func ValidateRefreshToken(tokenString string, verifier *TokenVerifier) (uint, error) {
+	claims, err := verifier.Verify(tokenString)
+	if err != nil {
+		return 0, errors.New("invalid refresh token")
 	}
 
 	userID, ok := claims["userID"].(float64)
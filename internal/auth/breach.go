@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"api/internal/telemetry"
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BreachChecker reports how often a password appears in known data breaches
+type BreachChecker interface {
+	BreachCount(ctx context.Context, password string) (int, error)
+}
+
+// HIBPConfig configures the Have I Been Pwned password range API
+type HIBPConfig struct {
+	Endpoint string        // defaults to https://api.pwnedpasswords.com
+	Timeout  time.Duration // defaults to 3 seconds
+}
+
+// HIBPChecker looks passwords up with k-anonymity: only the first five hex characters
+// of the SHA-1 digest leave the process, and the match is done locally
+type HIBPChecker struct {
+	cfg    HIBPConfig
+	client *http.Client
+}
+
+func NewHIBPChecker(cfg HIBPConfig) *HIBPChecker {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://api.pwnedpasswords.com"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 3 * time.Second
+	}
+	return &HIBPChecker{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout, Transport: telemetry.Transport(nil)},
+	}
+}
+
+func (c *HIBPChecker) BreachCount(ctx context.Context, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := digest[:5], digest[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.Endpoint+"/range/"+prefix, nil)
+	if err != nil {
+		return 0, err
+	}
+	// Padding hides the number of real matches from anyone watching the response size
+	req.Header.Set("Add-Padding", "true")
+	req.Header.Set("User-Agent", "user-management-api")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("hibp: %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		hash, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(hash, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return 0, fmt.Errorf("hibp: invalid count %q", count)
+		}
+		// Padding entries have a count of 0
+		return n, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("hibp: read response: %w", err)
+	}
+	return 0, nil
+}
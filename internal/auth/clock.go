@@ -0,0 +1,37 @@
+package auth
+
+import "time"
+
+// Clock tells the time tokens are issued at; tests substitute one to control expiry
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the wall clock, used when no other clock is configured
+var SystemClock Clock = systemClock{}
+
+// FixedClock is a clock that always tells the same time
+type FixedClock time.Time
+
+func (c FixedClock) Now() time.Time { return time.Time(c) }
+
+// TokenGenerator issues signed tokens. JWTGenerator is the one used outside tests.
+type TokenGenerator interface {
+	GenerateTokenPair(subject Subject, settings TokenSettings) (*TokenPair, error)
+	GenerateAccessToken(subject Subject, settings TokenSettings) (string, time.Time, error)
+}
+
+// JWTGenerator issues tokens with GenerateTokenPair and GenerateAccessToken
+type JWTGenerator struct{}
+
+func (JWTGenerator) GenerateTokenPair(subject Subject, settings TokenSettings) (*TokenPair, error) {
+	return GenerateTokenPair(subject, settings)
+}
+
+func (JWTGenerator) GenerateAccessToken(subject Subject, settings TokenSettings) (string, time.Time, error) {
+	return GenerateAccessToken(subject, settings)
+}
@@ -0,0 +1,301 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// minRSABits is the smallest RSA key accepted for signing or verification
+const minRSABits = 2048
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// verificationKey checks the signatures of tokens carrying its key ID
+type verificationKey struct {
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+// KeySet signs tokens with its current key and verifies them with the current key or
+// any retired key added to it, selected by the "kid" header. Key IDs are derived from
+// the key material, so the same key always has the same ID on every instance.
+// Asymmetric public keys are published so other services can verify tokens themselves.
+type KeySet struct {
+	mu      sync.RWMutex
+	kid     string
+	method  jwt.SigningMethod
+	signKey interface{}
+	verify  map[string]verificationKey
+	public  []JWK
+}
+
+// NewHMACKeySet signs and verifies tokens with a shared HS256 secret
+func NewHMACKeySet(secret string) *KeySet {
+	kid := hmacKeyID(secret)
+	return &KeySet{
+		kid:     kid,
+		method:  jwt.SigningMethodHS256,
+		signKey: []byte(secret),
+		verify:  map[string]verificationKey{kid: {method: jwt.SigningMethodHS256, key: []byte(secret)}},
+	}
+}
+
+// LoadKeySet reads the PEM encoded private key for algorithm: an RSA key (PKCS #1 or
+// PKCS #8) for RS256 or an Ed25519 key (PKCS #8) for EdDSA
+func LoadKeySet(algorithm, privateKeyFile string) (*KeySet, error) {
+	block, err := readPEM(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	var private interface{}
+	if block.Type == "RSA PRIVATE KEY" {
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+
+	method, jwk, err := publicJWK(algorithm, signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &KeySet{
+		kid:     jwk.Kid,
+		method:  method,
+		signKey: private,
+		verify:  map[string]verificationKey{jwk.Kid: {method: method, key: signer.Public()}},
+		public:  []JWK{jwk},
+	}, nil
+}
+
+// AddHMAC accepts tokens signed with a retired HS256 secret
+func (k *KeySet) AddHMAC(secret string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.verify[hmacKeyID(secret)] = verificationKey{method: jwt.SigningMethodHS256, key: []byte(secret)}
+}
+
+// RotateHMAC signs new tokens with secret. The previous key stays a verification key,
+// so tokens issued before the rotation remain valid until they expire.
+func (k *KeySet) RotateHMAC(secret string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.kid = hmacKeyID(secret)
+	k.method = jwt.SigningMethodHS256
+	k.signKey = []byte(secret)
+	k.verify[k.kid] = verificationKey{method: jwt.SigningMethodHS256, key: []byte(secret)}
+}
+
+// AddPublicKey accepts tokens signed by the private half of a retired RSA or Ed25519
+// key, read from a PEM encoded public key file, and publishes it in the JWKS
+func (k *KeySet) AddPublicKey(algorithm, publicKeyFile string) error {
+	block, err := readPEM(publicKeyFile)
+	if err != nil {
+		return err
+	}
+	var public interface{}
+	if block.Type == "RSA PUBLIC KEY" {
+		public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return fmt.Errorf("parse public key: %w", err)
+	}
+
+	method, jwk, err := publicJWK(algorithm, public)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.verify[jwk.Kid]; !ok {
+		k.verify[jwk.Kid] = verificationKey{method: method, key: public}
+		k.public = append(k.public, jwk)
+	}
+	return nil
+}
+
+// Algorithm returns the JWS algorithm of issued tokens
+func (k *KeySet) Algorithm() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.method.Alg()
+}
+
+// Algorithms returns the JWS algorithms of all verification keys
+func (k *KeySet) Algorithms() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	seen := make(map[string]bool)
+	var algorithms []string
+	for _, entry := range k.verify {
+		if alg := entry.method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algorithms = append(algorithms, alg)
+		}
+	}
+	return algorithms
+}
+
+// KeyID returns the ID of the current signing key
+func (k *KeySet) KeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.kid
+}
+
+// Sign returns a token carrying claims, signed with the current key
+func (k *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.kid
+	return token.SignedString(k.signKey)
+}
+
+// Keyfunc returns the verification key for jwt.Parse. Unknown key IDs are rejected, as
+// are tokens signed with another algorithm than their key's, so a public key can never
+// be used as an HMAC secret. Tokens without a key ID predate key IDs and are only
+// checked against the current key.
+func (k *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	kid := k.kid
+	if value, ok := token.Header["kid"]; ok {
+		if kid, ok = value.(string); !ok {
+			return nil, errors.New("invalid key ID")
+		}
+	}
+	entry, ok := k.verify[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	if token.Method.Alg() != entry.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return entry.key, nil
+}
+
+// JWKS returns the public verification keys, current key first. HS256 secrets cannot
+// be published, so the set is empty when only HMAC keys are in use.
+func (k *KeySet) JWKS() JWKSet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return JWKSet{Keys: append([]JWK{}, k.public...)}
+}
+
+func readPEM(file string) (*pem.Block, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", file)
+	}
+	return block, nil
+}
+
+// publicJWK checks that public suits algorithm and returns its JWK, identified by its
+// RFC 7638 thumbprint
+func publicJWK(algorithm string, public interface{}) (jwt.SigningMethod, JWK, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		key, ok := public.(*rsa.PublicKey)
+		if !ok {
+			return nil, JWK{}, errors.New("RS256 requires an RSA key")
+		}
+		if key.N.BitLen() < minRSABits {
+			return nil, JWK{}, fmt.Errorf("RSA key must be at least %d bits", minRSABits)
+		}
+		jwk := JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: AlgorithmRS256,
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+		// Members in lexicographic order, as RFC 7638 requires
+		jwk.Kid = thumbprint(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N})
+		return jwt.SigningMethodRS256, jwk, nil
+	case AlgorithmEdDSA:
+		key, ok := public.(ed25519.PublicKey)
+		if !ok {
+			return nil, JWK{}, errors.New("EdDSA requires an Ed25519 key")
+		}
+		jwk := JWK{
+			Kty: "OKP",
+			Use: "sig",
+			Alg: AlgorithmEdDSA,
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}
+		jwk.Kid = thumbprint(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X})
+		return jwt.SigningMethodEdDSA, jwk, nil
+	}
+	return nil, JWK{}, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+}
+
+func thumbprint(members interface{}) string {
+	canonical, _ := json.Marshal(members)
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// hmacKeyID derives a key ID from an HS256 secret without revealing it
+func hmacKeyID(secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("jwt key id"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:12])
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+// ErrPasswordMismatch is returned when a password does not match its hash
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// PasswordHasher hashes new passwords and verifies passwords against stored hashes
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Compare returns nil when password matches hash, whichever supported
+	// algorithm produced it
+	Compare(hash, password string) error
+	// NeedsRehash reports whether hash was made with another algorithm or other
+	// parameters than new hashes, so it should be replaced after a successful Compare
+	NeedsRehash(hash string) bool
+}
+
+// Argon2Params are the Argon2id cost parameters (RFC 9106)
+type Argon2Params struct {
+	MemoryKB    uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// HashingConfig selects the algorithm of new hashes
+type HashingConfig struct {
+	Algorithm  string // argon2id or bcrypt
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// hasher hashes with the configured algorithm and verifies Argon2id (PHC string
+// format) and bcrypt hashes alike, so accounts keep signing in while their hashes
+// are migrated
+type hasher struct {
+	cfg HashingConfig
+}
+
+// NewPasswordHasher validates cfg and returns its hasher
+func NewPasswordHasher(cfg HashingConfig) (PasswordHasher, error) {
+	switch cfg.Algorithm {
+	case HashArgon2id:
+		p := cfg.Argon2
+		if p.MemoryKB < 8*uint32(p.Parallelism) || p.Iterations < 1 || p.Parallelism < 1 {
+			return nil, errors.New("argon2id needs iterations and parallelism of at least 1 and 8 KB of memory per lane")
+		}
+		if p.SaltLength < 16 || p.KeyLength < 16 {
+			return nil, errors.New("argon2id salt and key need at least 16 bytes")
+		}
+	case HashBcrypt:
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", cfg.Algorithm)
+	}
+	return &hasher{cfg: cfg}, nil
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	if h.cfg.Algorithm == HashBcrypt {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hashed), nil
+	}
+
+	p := h.cfg.Argon2
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.MemoryKB, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.MemoryKB, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *hasher) Compare(hash, password string) error {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return ErrPasswordMismatch
+			}
+			return err
+		}
+		return nil
+	}
+
+	p, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	computed := argon2.IDKey([]byte(password), salt, p.Iterations, p.MemoryKB, p.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h *hasher) NeedsRehash(hash string) bool {
+	if h.cfg.Algorithm == HashBcrypt {
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.cfg.BcryptCost
+	}
+	p, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	want := h.cfg.Argon2
+	return p.MemoryKB != want.MemoryKB || p.Iterations != want.Iterations || p.Parallelism != want.Parallelism ||
+		uint32(len(salt)) != want.SaltLength || uint32(len(key)) != want.KeyLength
+}
+
+// parseArgon2id reads a hash in the PHC string format,
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+func parseArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return p, nil, nil, errors.New("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, errors.New("unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.MemoryKB, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, errors.New("malformed argon2id parameters")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, errors.New("malformed argon2id salt")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, errors.New("malformed argon2id key")
+	}
+	p.SaltLength, p.KeyLength = uint32(len(salt)), uint32(len(key))
+	return p, salt, key, nil
+}
+
+var (
+	hasherMu      sync.RWMutex
+	defaultHasher PasswordHasher = &hasher{cfg: HashingConfig{Algorithm: HashBcrypt, BcryptCost: bcrypt.DefaultCost}}
+)
+
+// SetPasswordHasher replaces the hasher behind HashPassword, ComparePasswords and
+// PasswordNeedsRehash, which hashes with bcrypt until it is configured
+func SetPasswordHasher(h PasswordHasher) {
+	hasherMu.Lock()
+	defaultHasher = h
+	hasherMu.Unlock()
+}
+
+func passwordHasher() PasswordHasher {
+	hasherMu.RLock()
+	defer hasherMu.RUnlock()
+	return defaultHasher
+}
+
+// PasswordNeedsRehash reports whether a hash that just verified a password should be
+// replaced by a new hash of it
+func PasswordNeedsRehash(hash string) bool {
+	return passwordHasher().NeedsRehash(hash)
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// bcryptMaxBytes is the longest password bcrypt hashes; later bytes are ignored
+const bcryptMaxBytes = 72
+
+// PasswordViolation is one rule a password breaks
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy describes the passwords users may choose
+type PasswordPolicy struct {
+	MinLength        int // in characters
+	RequireUpper     bool
+	RequireLower     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	DisallowUserInfo bool // reject passwords containing the username or the email address
+	banned           map[string]bool
+}
+
+// NewPasswordPolicy returns policy with the built-in list of common passwords and, when
+// bannedFile is set, the passwords listed in it (one per line, # starts a comment)
+func NewPasswordPolicy(policy PasswordPolicy, bannedFile string) (*PasswordPolicy, error) {
+	policy.banned = make(map[string]bool)
+	addBanned(policy.banned, strings.NewReader(commonPasswords))
+	if bannedFile != "" {
+		f, err := os.Open(bannedFile)
+		if err != nil {
+			return nil, fmt.Errorf("open banned passwords file: %w", err)
+		}
+		defer f.Close()
+		if err := addBanned(policy.banned, f); err != nil {
+			return nil, fmt.Errorf("read banned passwords file: %w", err)
+		}
+	}
+	return &policy, nil
+}
+
+func addBanned(banned map[string]bool, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		banned[strings.ToLower(line)] = true
+	}
+	return scanner.Err()
+}
+
+// Check returns the rules password breaks, or nil if it is acceptable. email and
+// username belong to the account and are only used with DisallowUserInfo.
+func (p *PasswordPolicy) Check(password, email, username string) []PasswordViolation {
+	var violations []PasswordViolation
+	add := func(code, format string, args ...interface{}) {
+		violations = append(violations, PasswordViolation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		add("too_short", "Password must be at least %d characters long", p.MinLength)
+	}
+	if len(password) > bcryptMaxBytes {
+		add("too_long", "Password must be at most %d bytes long", bcryptMaxBytes)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		add("missing_uppercase", "Password must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		add("missing_lowercase", "Password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		add("missing_digit", "Password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		add("missing_symbol", "Password must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	if p.banned[lowered] {
+		add("common_password", "Password is too common")
+	}
+	if p.DisallowUserInfo {
+		local, _, _ := strings.Cut(strings.ToLower(email), "@")
+		for _, part := range []string{strings.ToLower(username), local} {
+			// Very short names would match by coincidence
+			if len(part) >= 3 && strings.Contains(lowered, part) {
+				add("contains_user_info", "Password must not contain your username or email address")
+				break
+			}
+		}
+	}
+	return violations
+}
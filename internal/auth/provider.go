@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrUnknownLogin is returned by an AuthProvider that has no account for the login
+	ErrUnknownLogin = errors.New("auth: unknown login")
+	// ErrWrongPassword is returned by an AuthProvider that has the account but not
+	// this password
+	ErrWrongPassword = errors.New("auth: wrong password")
+	// ErrProviderUnavailable is returned by an AuthProvider that could not check the
+	// credentials, e.g. because its server is down
+	ErrProviderUnavailable = errors.New("auth: provider unavailable")
+)
+
+// Identity is an account whose credentials an AuthProvider accepted
+type Identity struct {
+	// UserID is the local account, set by providers checking local passwords; the
+	// fields below describe the identity of an external account instead
+	UserID   uint
+	Source   string // AuthSource of the accounts the provider manages, e.g. ldap
+	Subject  string // the provider's ID of the account, such as a DN, for logs
+	Email    string
+	Username string
+	Role     string
+}
+
+// AuthProvider checks sign-in credentials against one backend: the local database,
+// a directory or another identity provider
+type AuthProvider interface {
+	// Authenticate returns ErrUnknownLogin, ErrWrongPassword or ErrProviderUnavailable
+	// when the next provider should be tried; any other error ends the sign-in
+	Authenticate(login, password string) (*Identity, error)
+}
+
+// ProviderRegistry holds the available providers by name, so the configuration can
+// pick and order them
+type ProviderRegistry struct {
+	mu        sync.RWMutex
+	providers map[string]AuthProvider
+}
+
+func NewProviderRegistry() *ProviderRegistry {
+	return &ProviderRegistry{providers: make(map[string]AuthProvider)}
+}
+
+// Register makes provider available under name; registering a name twice panics
+func (r *ProviderRegistry) Register(name string, provider AuthProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.providers[name]; ok {
+		panic(fmt.Sprintf("auth provider %q registered twice", name))
+	}
+	r.providers[name] = provider
+}
+
+// Chain returns the named providers in the given order
+func (r *ProviderRegistry) Chain(names []string) (*ProviderChain, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(names) == 0 {
+		return nil, errors.New("no auth providers configured")
+	}
+	chain := &ProviderChain{}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		provider, ok := r.providers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown auth provider %q, registered: %v", name, r.names())
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("auth provider %q listed twice", name)
+		}
+		seen[name] = true
+		chain.names = append(chain.names, name)
+		chain.providers = append(chain.providers, provider)
+	}
+	return chain, nil
+}
+
+func (r *ProviderRegistry) names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProviderChain tries its providers in order until one accepts the credentials
+type ProviderChain struct {
+	names     []string
+	providers []AuthProvider
+}
+
+// Authenticate returns the identity from the first provider accepting the
+// credentials, with the name of that provider. When none does it returns
+// ErrWrongPassword if a provider knew the login and ErrUnknownLogin otherwise.
+func (c *ProviderChain) Authenticate(login, password string) (*Identity, string, error) {
+	failure := ErrUnknownLogin
+	for i, provider := range c.providers {
+		identity, err := provider.Authenticate(login, password)
+		switch {
+		case err == nil:
+			return identity, c.names[i], nil
+		case errors.Is(err, ErrWrongPassword):
+			failure = ErrWrongPassword
+		case errors.Is(err, ErrUnknownLogin), errors.Is(err, ErrProviderUnavailable):
+		default:
+			return nil, c.names[i], err
+		}
+	}
+	return nil, "", failure
+}
+
+// Names returns the provider names in the order they are tried
+func (c *ProviderChain) Names() []string {
+	return append([]string(nil), c.names...)
+}
@@ -0,0 +1,114 @@
+// Package captcha verifies CAPTCHA response tokens with reCAPTCHA, hCaptcha or
+// Cloudflare Turnstile
+package captcha
+
+import (
+	"api/internal/telemetry"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Supported providers
+const (
+	ProviderRecaptcha = "recaptcha"
+	ProviderHCaptcha  = "hcaptcha"
+	ProviderTurnstile = "turnstile"
+)
+
+// ErrRejected is returned for missing, invalid, expired or reused tokens
+var ErrRejected = errors.New("captcha rejected")
+
+// The providers share the siteverify protocol: a form POST of the secret, the response
+// token and optionally the client IP, answered with {"success": bool, ...}
+var endpoints = map[string]string{
+	ProviderRecaptcha: "https://www.google.com/recaptcha/api/siteverify",
+	ProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	ProviderTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// Config selects the provider and the site's secret key
+type Config struct {
+	Provider string
+	Secret   string
+	Endpoint string        // overrides the provider's siteverify URL
+	MinScore float64       // reCAPTCHA v3 responses scoring lower are rejected; 0 accepts any
+	Timeout  time.Duration // defaults to 5 seconds
+}
+
+// Verifier checks response tokens with the provider
+type Verifier struct {
+	cfg    Config
+	client *http.Client
+}
+
+func New(cfg Config) (*Verifier, error) {
+	if cfg.Endpoint == "" {
+		endpoint, ok := endpoints[cfg.Provider]
+		if !ok {
+			return nil, fmt.Errorf("unknown captcha provider %q (recaptcha, hcaptcha or turnstile)", cfg.Provider)
+		}
+		cfg.Endpoint = endpoint
+	}
+	if cfg.Secret == "" {
+		return nil, errors.New("captcha secret is required")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	return &Verifier{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout, Transport: telemetry.Transport(nil)},
+	}, nil
+}
+
+// siteverifyResponse holds the fields of interest of every provider's answer
+type siteverifyResponse struct {
+	Success    bool     `json:"success"`
+	Score      *float64 `json:"score"` // reCAPTCHA v3 only
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// Verify returns ErrRejected unless the provider accepts token. Other errors mean the
+// provider could not be asked.
+func (v *Verifier) Verify(ctx context.Context, token, remoteIP string) error {
+	if strings.TrimSpace(token) == "" {
+		return fmt.Errorf("%w: no token", ErrRejected)
+	}
+
+	form := url.Values{"secret": {v.cfg.Secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.cfg.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha siteverify: %s", resp.Status)
+	}
+
+	var result siteverifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("captcha siteverify: decode response: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrRejected, strings.Join(result.ErrorCodes, ", "))
+	}
+	if v.cfg.MinScore > 0 && result.Score != nil && *result.Score < v.cfg.MinScore {
+		return fmt.Errorf("%w: score %.1f below %.1f", ErrRejected, *result.Score, v.cfg.MinScore)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package compat
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"errors"
+
+	"github.com/jinzhu/gorm"
+)
+
+// MigrateOptions controls MigrateRefreshTokens
+type MigrateOptions struct {
+	BatchSize int
+	// KeepPlaintext only fills in the digest and leaves the plaintext column alone, so
+	// the deployment can still be rolled back to a release running in raw mode
+	KeepPlaintext bool
+	// DryRun counts the rows that would change without writing them
+	DryRun bool
+}
+
+// MigrateProgress reports how far a migration has come
+type MigrateProgress struct {
+	Total    int // legacy rows found when the migration started
+	Scanned  int
+	Migrated int
+	Skipped  int // rows changed by a running server between read and update
+	LastID   uint
+}
+
+// legacyRows matches refresh tokens still holding the plaintext or lacking a digest
+const legacyRows = "token_digest IS NULL OR token_digest = '' OR token_hash <> token_digest"
+
+// legacyRowsKeepPlaintext matches refresh tokens lacking a digest
+const legacyRowsKeepPlaintext = "token_digest IS NULL OR token_digest = ''"
+
+// MigrateRefreshTokens rewrites legacy refresh tokens into the hashed format, in
+// batches ordered by ID. Every batch is committed in its own transaction, so an
+// interrupted run leaves only whole batches migrated and can simply be started
+// again. Revoked (soft deleted) tokens are included so no plaintext stays behind.
+// progress, if set, is called after every batch.
+func MigrateRefreshTokens(db *gorm.DB, opts MigrateOptions, progress func(MigrateProgress)) (MigrateProgress, error) {
+	if opts.BatchSize <= 0 {
+		return MigrateProgress{}, errors.New("batch size must be positive")
+	}
+	condition := legacyRows
+	if opts.KeepPlaintext {
+		condition = legacyRowsKeepPlaintext
+	}
+
+	var p MigrateProgress
+	if err := db.Unscoped().Model(&models.RefreshToken{}).Where(condition).Count(&p.Total).Error; err != nil {
+		return p, err
+	}
+
+	for {
+		var batch []models.RefreshToken
+		err := db.Unscoped().Select("id, token_hash, token_digest").
+			Where("id > ?", p.LastID).Where(condition).
+			Order("id").Limit(opts.BatchSize).Find(&batch).Error
+		if err != nil {
+			return p, err
+		}
+		if len(batch) == 0 {
+			return p, nil
+		}
+
+		migrated, skipped := len(batch), 0
+		if !opts.DryRun {
+			migrated, skipped, err = migrateBatch(db, batch, opts.KeepPlaintext)
+			if err != nil {
+				return p, err
+			}
+		}
+		p.Scanned += len(batch)
+		p.Migrated += migrated
+		p.Skipped += skipped
+		p.LastID = batch[len(batch)-1].ID
+		if progress != nil {
+			progress(p)
+		}
+	}
+}
+
+// migrateBatch updates one batch in a transaction. A row is only updated if its
+// stored token is still the one read, so a row a running server changed in the
+// meantime is skipped rather than overwritten.
+func migrateBatch(db *gorm.DB, batch []models.RefreshToken, keepPlaintext bool) (migrated, skipped int, err error) {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return 0, 0, tx.Error
+	}
+	for _, rt := range batch {
+		// Rows in hashed mode store the digest in both columns; anything else holds the plaintext
+		digest := rt.TokenDigest
+		if digest == "" {
+			digest = auth.HashToken(rt.TokenHash)
+		}
+		updates := map[string]interface{}{"token_digest": digest}
+		if !keepPlaintext {
+			updates["token_hash"] = digest
+		}
+
+		result := tx.Unscoped().Model(&models.RefreshToken{}).
+			Where("id = ? AND token_hash = ?", rt.ID, rt.TokenHash).
+			UpdateColumns(updates)
+		if result.Error != nil {
+			tx.Rollback()
+			return 0, 0, result.Error
+		}
+		if result.RowsAffected == 0 {
+			skipped++
+		} else {
+			migrated++
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return 0, 0, err
+	}
+	return migrated, skipped, nil
+}
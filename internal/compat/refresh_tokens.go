@@ -0,0 +1,71 @@
+package compat
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Refresh token storage modes
+const (
+	// ModeRaw stores and looks up refresh tokens in plaintext (legacy behaviour)
+	ModeRaw = "raw"
+	// ModeDual writes both the plaintext and the digest, and accepts either on lookup,
+	// so instances on the old and new release can serve the same sessions during a
+	// rollout. It keeps tokens readable in the database and is meant to be temporary.
+	ModeDual = "dual"
+	// ModeHashed only stores and matches the digest; the default
+	ModeHashed = "hashed"
+)
+
+// RefreshTokenStore decides how refresh tokens are written to and matched in the
+// refresh_tokens table for the configured storage mode.
+type RefreshTokenStore struct {
+	mode string
+}
+
+func NewRefreshTokenStore(mode string) (*RefreshTokenStore, error) {
+	switch mode {
+	case ModeRaw, ModeDual, ModeHashed:
+		return &RefreshTokenStore{mode: mode}, nil
+	case "":
+		return &RefreshTokenStore{mode: ModeHashed}, nil
+	default:
+		return nil, fmt.Errorf("unknown refresh token storage mode %q", mode)
+	}
+}
+
+// Mode returns the active storage mode
+func (s *RefreshTokenStore) Mode() string {
+	return s.mode
+}
+
+// Apply fills the storage columns of rt for the given plaintext token
+func (s *RefreshTokenStore) Apply(rt *models.RefreshToken, token string) {
+	switch s.mode {
+	case ModeRaw:
+		rt.TokenHash = token
+		rt.TokenDigest = ""
+	case ModeDual:
+		rt.TokenHash = token
+		rt.TokenDigest = auth.HashToken(token)
+	default:
+		digest := auth.HashToken(token)
+		rt.TokenHash = digest
+		rt.TokenDigest = digest
+	}
+}
+
+// Where scopes db to the refresh token rows matching the given plaintext token
+func (s *RefreshTokenStore) Where(db *gorm.DB, token string) *gorm.DB {
+	switch s.mode {
+	case ModeRaw:
+		return db.Where("token_hash = ?", token)
+	case ModeDual:
+		return db.Where("token_digest = ? OR token_hash = ?", auth.HashToken(token), token)
+	default:
+		return db.Where("token_digest = ?", auth.HashToken(token))
+	}
+}
@@ -0,0 +1,217 @@
+// Package database builds the connections to the SQL database the API keeps its data
+// in: Postgres, MySQL or an SQLite file. The rest of the code talks to GORM and only
+// looks at the dialect for the few queries the databases disagree on.
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Drivers, as set in the configuration
+const (
+	Postgres = "postgres"
+	MySQL    = "mysql"
+	SQLite   = "sqlite"
+)
+
+// Config locates the database. Host, Port, User, DBName and SSLMode apply to
+// Postgres and MySQL, Path to SQLite, where InMemory keeps the database in memory.
+type Config struct {
+	Driver  string
+	Host    string
+	Port    string
+	User    string
+	DBName  string
+	SSLMode string // disable, require, verify-ca or verify-full
+	Path    string
+	// StatementTimeout aborts queries running longer, 0 disables. MySQL only limits
+	// SELECT statements and SQLite has no such limit.
+	StatementTimeout time.Duration
+}
+
+// InMemory is the SQLite path of a database kept in memory, shared by the connections
+// of one connector and gone once they are all closed
+const InMemory = ":memory:"
+
+// memoryDatabases names the in-memory databases, one per connector
+var memoryDatabases atomic.Int64
+
+// Dialect returns the GORM dialect of driver, which is also its database/sql driver name
+func Dialect(driver string) (string, error) {
+	switch driver {
+	case Postgres, MySQL:
+		return driver, nil
+	case SQLite:
+		return "sqlite3", nil
+	}
+	return "", fmt.Errorf("unknown database driver %q, use postgres, mysql or sqlite", driver)
+}
+
+// Connector returns a connector to the configured database. It builds the connection
+// string for every new connection, so connections opened after the password was
+// rotated use the new one.
+func Connector(cfg Config, password func() string) (driver.Connector, error) {
+	switch cfg.Driver {
+	case Postgres:
+		return connector{driver: pq.Driver{}, dsn: func() string { return postgresDSN(cfg, cfg.DBName, password()) }}, nil
+	case MySQL:
+		return connector{driver: mysql.MySQLDriver{}, dsn: func() string { return mysqlDSN(cfg, cfg.DBName, password()) }}, nil
+	case SQLite:
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("sqlite needs a database path")
+		}
+		dsn := sqliteDSN(cfg.Path)
+		return connector{driver: &sqlite3.SQLiteDriver{}, dsn: func() string { return dsn }}, nil
+	}
+	_, err := Dialect(cfg.Driver)
+	return nil, err
+}
+
+// ServerConnector returns a connector to the database server rather than the
+// configured database, which may not exist yet. SQLite has no server.
+func ServerConnector(cfg Config, password func() string) (driver.Connector, error) {
+	switch cfg.Driver {
+	case Postgres:
+		return connector{driver: pq.Driver{}, dsn: func() string { return postgresDSN(cfg, "postgres", password()) }}, nil
+	case MySQL:
+		return connector{driver: mysql.MySQLDriver{}, dsn: func() string { return mysqlDSN(cfg, "", password()) }}, nil
+	}
+	return nil, fmt.Errorf("%s has no database server", cfg.Driver)
+}
+
+// DSN returns the connection string of the configured database, for tools opening a
+// single connection
+func DSN(cfg Config, password string) (string, error) {
+	switch cfg.Driver {
+	case Postgres:
+		return postgresDSN(cfg, cfg.DBName, password), nil
+	case MySQL:
+		return mysqlDSN(cfg, cfg.DBName, password), nil
+	case SQLite:
+		return sqliteDSN(cfg.Path), nil
+	}
+	_, err := Dialect(cfg.Driver)
+	return "", err
+}
+
+// CreateDatabase creates the configured database through server, a connection made
+// with ServerConnector, unless it exists. It reports whether it was created.
+func CreateDatabase(server *gorm.DB, cfg Config) (bool, error) {
+	var exists bool
+	var err error
+	switch cfg.Driver {
+	case Postgres:
+		err = server.Raw("SELECT EXISTS(SELECT datname FROM pg_catalog.pg_database WHERE datname = ?)", cfg.DBName).Row().Scan(&exists)
+	case MySQL:
+		err = server.Raw("SELECT EXISTS(SELECT schema_name FROM information_schema.schemata WHERE schema_name = ?)", cfg.DBName).Row().Scan(&exists)
+	default:
+		return false, fmt.Errorf("%s has no database server", cfg.Driver)
+	}
+	if err != nil || exists {
+		return false, err
+	}
+	statement := "CREATE DATABASE " + server.Dialect().Quote(cfg.DBName)
+	if cfg.Driver == MySQL {
+		statement += " CHARACTER SET utf8mb4"
+	}
+	if err := server.Exec(statement).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func postgresDSN(cfg Config, dbName, password string) string {
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.User, quoteDSN(password), dbName, cfg.SSLMode)
+	if cfg.StatementTimeout > 0 {
+		// Sent as a run-time parameter, so it applies to every connection of the pool
+		dsn += fmt.Sprintf(" statement_timeout=%d", cfg.StatementTimeout.Milliseconds())
+	}
+	return dsn
+}
+
+// quoteDSN quotes a connection string value, which may contain spaces or quotes when
+// it was generated by a secrets manager
+func quoteDSN(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// mysqlTLS maps the Postgres style sslmode onto the MySQL driver's tls parameter
+var mysqlTLS = map[string]string{
+	"":            "false",
+	"disable":     "false",
+	"allow":       "preferred",
+	"prefer":      "preferred",
+	"require":     "skip-verify",
+	"verify-ca":   "true",
+	"verify-full": "true",
+}
+
+func mysqlDSN(cfg Config, dbName, password string) string {
+	c := mysql.NewConfig()
+	c.User = cfg.User
+	c.Passwd = password
+	c.Net = "tcp"
+	c.Addr = net.JoinHostPort(cfg.Host, cfg.Port)
+	c.DBName = dbName
+	c.ParseTime = true
+	c.TLSConfig = mysqlTLS[cfg.SSLMode]
+	c.Params = map[string]string{
+		"charset": "utf8mb4",
+		// Queries quote identifiers such as key with double quotes and concatenate
+		// with ||, as in standard SQL
+		"sql_mode": "CONCAT(@@sql_mode, ',ANSI_QUOTES,PIPES_AS_CONCAT')",
+	}
+	if cfg.StatementTimeout > 0 {
+		c.Params["max_execution_time"] = fmt.Sprint(cfg.StatementTimeout.Milliseconds())
+	}
+	return c.FormatDSN()
+}
+
+// sqliteDSN waits for locks rather than failing while another connection writes, and
+// takes the write lock when a transaction starts so two cannot deadlock upgrading
+func sqliteDSN(path string) string {
+	if path == InMemory {
+		// A named database in the shared cache, as each connection to ":memory:" has its own
+		return fmt.Sprintf("file:memory-%d?mode=memory&cache=shared&_busy_timeout=5000&_txlock=immediate", memoryDatabases.Add(1))
+	}
+	return "file:" + path + "?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+}
+
+type connector struct {
+	driver driver.Driver
+	dsn    func() string
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	var opened driver.Connector
+	var err error
+	switch d := c.driver.(type) {
+	case driver.DriverContext:
+		opened, err = d.OpenConnector(c.dsn())
+	case pq.Driver:
+		// pq connects with a context through its connector only
+		opened, err = pq.NewConnector(c.dsn())
+	default:
+		return c.driver.Open(c.dsn())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return opened.Connect(ctx)
+}
+
+func (c connector) Driver() driver.Driver {
+	return c.driver
+}
@@ -0,0 +1,154 @@
+// Package encryption encrypts sensitive column values at rest with AES-256-GCM.
+// Ciphertexts name the key that produced them, so keys can be rotated: new values
+// are encrypted with the current key while retired keys still decrypt the old ones
+// until cmd/rotate-keys has re-encrypted them.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// prefix marks an encrypted value: "enc:v1:<key ID>:<base64 nonce and ciphertext>".
+// Values without it were written before encryption was enabled and are read as is.
+const prefix = "enc:v1:"
+
+// ErrNoKey is returned for an encrypted value whose key is not configured
+var ErrNoKey = errors.New("encryption key not configured")
+
+// Key is a 256-bit AES key and the ID stored with the values it encrypts
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Keyring encrypts with its first key and decrypts with any of them
+type Keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring; keys[0] is the current key
+func NewKeyring(keys []Key) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no encryption keys")
+	}
+	k := &Keyring{current: keys[0].ID, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for _, key := range keys {
+		if key.ID == "" || strings.Contains(key.ID, ":") {
+			return nil, fmt.Errorf("invalid encryption key ID %q", key.ID)
+		}
+		if len(key.Secret) != 32 {
+			return nil, fmt.Errorf("encryption key %s: must be 32 bytes, got %d", key.ID, len(key.Secret))
+		}
+		if _, ok := k.aeads[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate encryption key ID %q", key.ID)
+		}
+		block, err := aes.NewCipher(key.Secret)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[key.ID] = aead
+	}
+	return k, nil
+}
+
+// CurrentKeyID returns the ID of the key new values are encrypted with
+func (k *Keyring) CurrentKeyID() string {
+	return k.current
+}
+
+// CurrentPrefix returns the prefix of values encrypted with the current key
+func (k *Keyring) CurrentPrefix() string {
+	return prefix + k.current + ":"
+}
+
+// Encrypt encrypts plaintext with the current key. The empty string stays empty so
+// unset fields remain recognizable.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	aead := k.aeads[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(k.current))
+	return prefix + k.current + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of value; values that are not encrypted are returned
+// unchanged
+func (k *Keyring) Decrypt(value string) (string, error) {
+	keyID, data, ok := parse(value)
+	if !ok {
+		return value, nil
+	}
+	aead, ok := k.aeads[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNoKey, keyID)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return "", fmt.Errorf("decrypt with key %s: %w", keyID, err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether value is stored in plaintext or with a retired key
+func (k *Keyring) NeedsRotation(value string) bool {
+	if value == "" {
+		return false
+	}
+	keyID, _, ok := parse(value)
+	return !ok || keyID != k.current
+}
+
+// KeyID returns the ID of the key value was encrypted with, empty for plaintext
+func KeyID(value string) string {
+	keyID, _, _ := parse(value)
+	return keyID
+}
+
+func parse(value string) (keyID, data string, ok bool) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, ":")
+}
+
+var (
+	mu       sync.RWMutex
+	defaults *Keyring
+)
+
+// SetDefault installs the keyring used by column types such as
+// models.EncryptedString; nil stores new values in plaintext
+func SetDefault(k *Keyring) {
+	mu.Lock()
+	defaults = k
+	mu.Unlock()
+}
+
+// Default returns the keyring installed with SetDefault, nil when encryption is off
+func Default() *Keyring {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaults
+}
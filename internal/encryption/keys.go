@@ -0,0 +1,47 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+)
+
+// KeyConfig is a configured key: either its base64 encoded secret or a KMS data key
+// in the base64 encoded form KMS returned it, decrypted at startup
+type KeyConfig struct {
+	ID           string
+	Key          string
+	EncryptedKey string
+}
+
+// LoadKeyring decodes the configured keys, the first being the current one, asking
+// KMS for the plaintext of encrypted ones; nil when no key is configured
+func LoadKeyring(ctx context.Context, keys []KeyConfig, kmsConfig KMSConfig) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	var kms *KMS
+	decoded := make([]Key, 0, len(keys))
+	for _, key := range keys {
+		var secret []byte
+		var err error
+		switch {
+		case key.Key != "" && key.EncryptedKey != "":
+			return nil, fmt.Errorf("encryption key %s: set either key or encryptedKey", key.ID)
+		case key.EncryptedKey != "":
+			if kms == nil {
+				if kms, err = NewKMS(kmsConfig); err != nil {
+					return nil, err
+				}
+			}
+			secret, err = kms.DecryptDataKey(ctx, key.EncryptedKey)
+		default:
+			secret, err = base64.StdEncoding.DecodeString(key.Key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", key.ID, err)
+		}
+		decoded = append(decoded, Key{ID: key.ID, Secret: secret})
+	}
+	return NewKeyring(decoded)
+}
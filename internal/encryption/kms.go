@@ -0,0 +1,85 @@
+package encryption
+
+import (
+	"api/internal/awssig"
+	"api/internal/telemetry"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// KMSConfig reaches AWS KMS to decrypt data keys stored encrypted in the configuration
+type KMSConfig struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Endpoint        string // optional override, defaults to the regional endpoint
+}
+
+// KMS decrypts data keys produced by KMS GenerateDataKey (envelope encryption), so the
+// plaintext keys never have to be written to disk
+type KMS struct {
+	endpoint string
+	creds    awssig.Credentials
+	client   *http.Client
+}
+
+func NewKMS(cfg KMSConfig) (*KMS, error) {
+	if cfg.Region == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("kms requires region and access credentials")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com", cfg.Region)
+	}
+	return &KMS{
+		endpoint: endpoint,
+		creds: awssig.Credentials{
+			AccessKeyID:     cfg.AccessKeyID,
+			SecretAccessKey: cfg.SecretAccessKey,
+			Region:          cfg.Region,
+			Service:         "kms",
+		},
+		client: &http.Client{Timeout: 10 * time.Second, Transport: telemetry.Transport(nil)},
+	}, nil
+}
+
+// DecryptDataKey returns the plaintext of a data key given as its base64 encoded
+// CiphertextBlob
+func (k *KMS) DecryptDataKey(ctx context.Context, ciphertext string) ([]byte, error) {
+	payload, err := json.Marshal(map[string]string{"CiphertextBlob": ciphertext})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.endpoint+"/", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService.Decrypt")
+	k.creds.SignRequest(req, awssig.SHA256Hex(payload), time.Now())
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("kms: %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+
+	var body struct {
+		Plaintext string `json:"Plaintext"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("kms: %w", err)
+	}
+	return base64.StdEncoding.DecodeString(body.Plaintext)
+}
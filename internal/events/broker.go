@@ -0,0 +1,238 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+// SchemaVersion is sent with every broker message. It only changes when a field is
+// removed or changes meaning; consumers should ignore fields they do not know.
+const SchemaVersion = 1
+
+// AvroSchema describes Message for the avro format
+const AvroSchema = `{
+	"type": "record",
+	"name": "UserEvent",
+	"namespace": "api.events",
+	"fields": [
+		{"name": "id", "type": "long"},
+		{"name": "type", "type": "string"},
+		{"name": "userId", "type": "long"},
+		{"name": "changed", "type": {"type": "array", "items": "string"}},
+		{"name": "occurredAt", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "schemaVersion", "type": "int"}
+	]
+}`
+
+// Message is the body of a broker message, in JSON or Avro
+type Message struct {
+	ID            uint      `json:"id"`
+	Type          string    `json:"type"` // event name, e.g. user.created
+	UserID        uint      `json:"userId"`
+	Changed       []string  `json:"changed"` // fields changed by user.updated
+	OccurredAt    time.Time `json:"occurredAt"`
+	SchemaVersion int       `json:"schemaVersion"`
+}
+
+// BrokerConfig configures publishing to a message broker in addition to the publisher
+type BrokerConfig struct {
+	Enabled bool
+	Type    string   // kafka or nats
+	Brokers []string // Kafka bootstrap brokers (host:port) or NATS server URLs
+	// TopicPrefix is put in front of the event name to get the Kafka topic or NATS
+	// subject, e.g. "identity." publishes user.created to identity.user.created
+	TopicPrefix string
+	Format      string // json or avro
+	Timeout     time.Duration
+}
+
+type encoder func(Message) ([]byte, string, error)
+
+// BrokerPublisher sends every event to the topic for its name
+type BrokerPublisher struct {
+	prefix string
+	encode encoder
+	send   func(ctx context.Context, topic string, event Event, body []byte, contentType string) error
+	close  func() error
+}
+
+// NewBrokerPublisher connects to the broker in cfg. When cfg is not enabled it returns
+// a publisher that does nothing.
+func NewBrokerPublisher(cfg BrokerConfig) (Publisher, error) {
+	if !cfg.Enabled {
+		return noopPublisher{}, nil
+	}
+	if len(cfg.Brokers) == 0 {
+		return nil, errors.New("broker publisher needs at least one broker address")
+	}
+	encode, err := newEncoder(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	p := &BrokerPublisher{prefix: cfg.TopicPrefix, encode: encode}
+	switch cfg.Type {
+	case "kafka":
+		p.send, p.close = kafkaSender(cfg.Brokers, timeout)
+	case "nats":
+		p.send, p.close, err = natsSender(cfg.Brokers, timeout)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown broker type %q", cfg.Type)
+	}
+	return p, nil
+}
+
+// Topic is the Kafka topic or NATS subject event is published to
+func (p *BrokerPublisher) Topic(event string) string {
+	return p.prefix + event
+}
+
+func (p *BrokerPublisher) Publish(ctx context.Context, event Event) error {
+	message := Message{
+		ID:            event.ID,
+		Type:          event.Name,
+		UserID:        event.UserID,
+		Changed:       []string{},
+		OccurredAt:    event.OccurredAt.UTC(),
+		SchemaVersion: SchemaVersion,
+	}
+	var payload struct {
+		Changed []string `json:"changed"`
+	}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return &PermanentError{Err: fmt.Errorf("decode event payload: %w", err)}
+	}
+	if payload.Changed != nil {
+		message.Changed = payload.Changed
+	}
+
+	body, contentType, err := p.encode(message)
+	if err != nil {
+		return &PermanentError{Err: fmt.Errorf("encode event: %w", err)}
+	}
+	return p.send(ctx, p.Topic(event.Name), event, body, contentType)
+}
+
+func (p *BrokerPublisher) Close() error {
+	return p.close()
+}
+
+func newEncoder(format string) (encoder, error) {
+	switch format {
+	case "", "json":
+		return func(m Message) ([]byte, string, error) {
+			body, err := json.Marshal(m)
+			return body, "application/json", err
+		}, nil
+	case "avro":
+		codec, err := goavro.NewCodec(AvroSchema)
+		if err != nil {
+			return nil, fmt.Errorf("avro schema: %w", err)
+		}
+		return func(m Message) ([]byte, string, error) {
+			body, err := codec.BinaryFromNative(nil, map[string]interface{}{
+				"id":            int64(m.ID),
+				"type":          m.Type,
+				"userId":        int64(m.UserID),
+				"changed":       m.Changed,
+				"occurredAt":    m.OccurredAt,
+				"schemaVersion": int32(m.SchemaVersion),
+			})
+			return body, "avro/binary", err
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown event format %q", format)
+	}
+}
+
+// headers sent with every message, so consumers can route without decoding the body
+func messageHeaders(event Event, contentType string) map[string]string {
+	return map[string]string{
+		"event-id":       strconv.FormatUint(uint64(event.ID), 10),
+		"event-type":     event.Name,
+		"content-type":   contentType,
+		"schema-version": strconv.Itoa(SchemaVersion),
+	}
+}
+
+// kafkaSender writes to the topic with the user ID as key, so a user's events stay in
+// order on one partition. Topics are not created automatically.
+func kafkaSender(brokers []string, timeout time.Duration) (func(context.Context, string, Event, []byte, string) error, func() error) {
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 10 * time.Millisecond,
+		WriteTimeout: timeout,
+		ReadTimeout:  timeout,
+	}
+	send := func(ctx context.Context, topic string, event Event, body []byte, contentType string) error {
+		message := kafka.Message{
+			Topic: topic,
+			Key:   []byte(strconv.FormatUint(uint64(event.UserID), 10)),
+			Value: body,
+		}
+		for key, value := range messageHeaders(event, contentType) {
+			message.Headers = append(message.Headers, kafka.Header{Key: key, Value: []byte(value)})
+		}
+		if err := writer.WriteMessages(ctx, message); err != nil {
+			return fmt.Errorf("kafka %s: %w", topic, err)
+		}
+		return nil
+	}
+	return send, writer.Close
+}
+
+// natsSender publishes through JetStream, which acknowledges once the message is
+// stored, with the event ID as message ID so retries within the stream's duplicate
+// window are dropped. A stream must cover the subjects.
+func natsSender(servers []string, timeout time.Duration) (func(context.Context, string, Event, []byte, string) error, func() error, error) {
+	conn, err := nats.Connect(strings.Join(servers, ","),
+		nats.Name("user-management-api"),
+		nats.Timeout(timeout),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to nats: %w", err)
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("nats jetstream: %w", err)
+	}
+	send := func(ctx context.Context, subject string, event Event, body []byte, contentType string) error {
+		message := nats.NewMsg(subject)
+		message.Data = body
+		for key, value := range messageHeaders(event, contentType) {
+			message.Header.Set(key, value)
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		if _, err := js.PublishMsg(message, nats.Context(ctx), nats.MsgId(strconv.FormatUint(uint64(event.ID), 10))); err != nil {
+			return fmt.Errorf("nats %s: %w", subject, err)
+		}
+		return nil
+	}
+	return send, conn.Drain, nil
+}
+
+type noopPublisher struct{}
+
+func (noopPublisher) Publish(context.Context, Event) error { return nil }
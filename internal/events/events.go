@@ -0,0 +1,121 @@
+// Package events publishes user lifecycle events taken from the outbox table to
+// webhook endpoints and, optionally, a Kafka or NATS broker. Delivery is at least once: receivers should ignore events whose
+// ID they have seen before.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Event is an outbox entry ready to be published
+type Event struct {
+	ID         uint   // outbox row ID, stable across retries
+	Name       string // e.g. user.updated
+	UserID     uint
+	Payload    []byte // JSON
+	OccurredAt time.Time
+}
+
+// Publisher delivers a single event
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// PermanentError marks a failure that retrying cannot fix, such as a rejected payload
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// IsPermanent reports whether err should not be retried
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// Config selects and configures the publisher
+type Config struct {
+	Publisher string // log or webhook
+	Webhook   WebhookConfig
+	Broker    BrokerConfig // also publishes to a broker when enabled
+}
+
+// New creates the publisher selected in cfg, combined with the broker when enabled
+func New(cfg Config, logger *logrus.Logger) (Publisher, error) {
+	var publisher Publisher
+	switch cfg.Publisher {
+	case "", "log":
+		publisher = NewLogPublisher(logger)
+	case "webhook":
+		webhook, err := NewWebhookPublisher(cfg.Webhook)
+		if err != nil {
+			return nil, err
+		}
+		publisher = webhook
+	default:
+		return nil, fmt.Errorf("unknown event publisher %q", cfg.Publisher)
+	}
+	if !cfg.Broker.Enabled {
+		return publisher, nil
+	}
+	broker, err := NewBrokerPublisher(cfg.Broker)
+	if err != nil {
+		return nil, err
+	}
+	return multiPublisher{publisher, broker}, nil
+}
+
+// Close releases the connections of a publisher created by New
+func Close(publisher Publisher) error {
+	if closer, ok := publisher.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// multiPublisher publishes to each in turn. A failure fails the event, so on retry the
+// earlier ones receive it again.
+type multiPublisher []Publisher
+
+func (m multiPublisher) Publish(ctx context.Context, event Event) error {
+	for _, publisher := range m {
+		if err := publisher.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiPublisher) Close() error {
+	var errs []error
+	for _, publisher := range m {
+		errs = append(errs, Close(publisher))
+	}
+	return errors.Join(errs...)
+}
+
+// LogPublisher only logs events; it is the default for development
+type LogPublisher struct {
+	logger *logrus.Logger
+}
+
+func NewLogPublisher(logger *logrus.Logger) *LogPublisher {
+	return &LogPublisher{logger: logger}
+}
+
+func (p *LogPublisher) Publish(ctx context.Context, event Event) error {
+	p.logger.WithFields(logrus.Fields{
+		"event_id": event.ID,
+		"event":    event.Name,
+		"user_id":  event.UserID,
+	}).Info("Event published (log publisher)")
+	return nil
+}
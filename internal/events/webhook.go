@@ -0,0 +1,96 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WebhookConfig lists the endpoints every event is posted to
+type WebhookConfig struct {
+	URLs []string
+	// Secret signs the body: X-Webhook-Signature is "sha256=" and the hex HMAC-SHA256
+	// of the timestamp in X-Webhook-Timestamp, a dot and the body
+	Secret  string
+	Timeout time.Duration
+}
+
+// WebhookPublisher posts each event as JSON to every configured URL
+type WebhookPublisher struct {
+	urls   []string
+	secret []byte
+	client *http.Client
+}
+
+func NewWebhookPublisher(cfg WebhookConfig) (*WebhookPublisher, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, errors.New("webhook publisher needs at least one URL")
+	}
+	if cfg.Secret == "" {
+		return nil, errors.New("webhook publisher needs a signing secret")
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &WebhookPublisher{
+		urls:   cfg.URLs,
+		secret: []byte(cfg.Secret),
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Publish succeeds once every URL accepted the event. A failure at one URL fails the
+// event, so on retry the others receive it again.
+func (p *WebhookPublisher) Publish(ctx context.Context, event Event) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(event.Payload)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	for _, url := range p.urls {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(event.Payload))
+		if err != nil {
+			return &PermanentError{Err: fmt.Errorf("webhook %s: %w", url, err)}
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Event-ID", strconv.FormatUint(uint64(event.ID), 10))
+		req.Header.Set("X-Event-Type", event.Name)
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", signature)
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("webhook %s: %w", url, err)
+		}
+		err = webhookError(url, resp)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// webhookError converts a response into an error, treating client errors other than
+// timeouts and rate limiting as permanent
+func webhookError(url string, resp *http.Response) error {
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err := fmt.Errorf("webhook %s: %s: %s", url, resp.Status, bytes.TrimSpace(body))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusRequestTimeout {
+		return &PermanentError{Err: err}
+	}
+	return err
+}
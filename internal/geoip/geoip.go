@@ -0,0 +1,107 @@
+// Package geoip resolves IP addresses to locations with a MaxMind GeoIP2 or GeoLite2
+// Country or City database
+package geoip
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// Location is where an address was found. Country databases have no coordinates.
+type Location struct {
+	Country        string // ISO 3166-1 alpha-2 code, e.g. "DE"
+	City           string // English name, when known
+	Latitude       float64
+	Longitude      float64
+	HasCoordinates bool
+}
+
+// String names the city and country, e.g. "Berlin, DE"
+func (l Location) String() string {
+	if l.City == "" {
+		return l.Country
+	}
+	return l.City + ", " + l.Country
+}
+
+// Reader looks up addresses in a database loaded into memory
+type Reader struct {
+	db *database
+}
+
+// Open loads the .mmdb file at path
+func Open(path string) (*Reader, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := parseDatabase(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &Reader{db: db}, nil
+}
+
+// DatabaseType is the type named in the metadata, e.g. "GeoLite2-City"
+func (r *Reader) DatabaseType() string {
+	return r.db.dbType
+}
+
+// Lookup returns the location of ip, or nil when the database does not know it, as for
+// private addresses
+func (r *Reader) Lookup(ip net.IP) (*Location, error) {
+	if ip == nil {
+		return nil, nil
+	}
+	value, err := r.db.lookup(ip)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	record, _ := value.(map[string]interface{})
+
+	var location Location
+	// Anonymous proxies and satellite providers only carry the registered country
+	for _, key := range []string{"country", "registered_country"} {
+		if code, ok := field(record, key, "iso_code").(string); ok && code != "" {
+			location.Country = code
+			break
+		}
+	}
+	location.City, _ = field(record, "city", "names", "en").(string)
+	latitude, hasLatitude := field(record, "location", "latitude").(float64)
+	longitude, hasLongitude := field(record, "location", "longitude").(float64)
+	if hasLatitude && hasLongitude {
+		location.Latitude, location.Longitude, location.HasCoordinates = latitude, longitude, true
+	}
+	if location.Country == "" && !location.HasCoordinates {
+		return nil, nil
+	}
+	return &location, nil
+}
+
+// field follows path through nested maps, returning nil when a step is missing
+func field(record map[string]interface{}, path ...string) interface{} {
+	var value interface{} = record
+	for _, key := range path {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = fields[key]
+	}
+	return value
+}
+
+// earthRadiusKm is the mean radius used for great-circle distances
+const earthRadiusKm = 6371.0
+
+// DistanceKm is the great-circle distance between two locations with coordinates
+func DistanceKm(a, b Location) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
@@ -0,0 +1,345 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+)
+
+// The MaxMind DB format (https://maxmind.github.io/MaxMind-DB/): a binary search tree
+// over the address bits, whose leaves point into a data section of typed values, and
+// a metadata map at the end of the file.
+
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// errCorrupt is returned for files that do not follow the format
+var errCorrupt = errors.New("corrupt MaxMind database")
+
+// Data section value types
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// database is a parsed MaxMind DB file held in memory
+type database struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint // node reached after the 96 zero bits of an IPv4-mapped address
+	dbType     string
+}
+
+func parseDatabase(file []byte) (*database, error) {
+	at := bytes.LastIndex(file, metadataMarker)
+	if at < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", errCorrupt)
+	}
+	metadata, _, err := decoder{buf: file[at+len(metadataMarker):]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+	fields, ok := metadata.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", errCorrupt)
+	}
+
+	db := &database{
+		nodeCount:  uint(asUint(fields["node_count"])),
+		recordSize: uint(asUint(fields["record_size"])),
+		ipVersion:  uint(asUint(fields["ip_version"])),
+	}
+	db.dbType, _ = fields["database_type"].(string)
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %d", errCorrupt, db.recordSize)
+	}
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", errCorrupt, db.ipVersion)
+	}
+
+	treeSize := db.nodeCount * db.recordSize / 4
+	// The tree is followed by 16 zero bytes separating it from the data section
+	if treeSize+16 > uint(at) {
+		return nil, fmt.Errorf("%w: search tree exceeds the file", errCorrupt)
+	}
+	db.tree = file[:treeSize]
+	db.data = file[treeSize+16 : at]
+
+	if db.ipVersion == 6 {
+		for i := 0; i < 96 && db.ipv4Start < db.nodeCount; i++ {
+			if db.ipv4Start, err = db.record(db.ipv4Start, 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return db, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node
+func (db *database) record(node, bit uint) (uint, error) {
+	size := db.recordSize / 4
+	offset := node * size
+	if offset+size > uint(len(db.tree)) {
+		return 0, fmt.Errorf("%w: node %d outside the search tree", errCorrupt, node)
+	}
+	b := db.tree[offset : offset+size]
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+	case 28:
+		// The middle byte holds the high nibbles of both records
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:])), nil
+	}
+}
+
+// lookup returns the data stored for ip, or nil when the database has none
+func (db *database) lookup(ip net.IP) (interface{}, error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else if db.ipVersion == 4 {
+		return nil, nil
+	}
+
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		next, err := db.record(node, bit)
+		if err != nil {
+			return nil, err
+		}
+		node = next
+	}
+	if node == db.nodeCount {
+		return nil, nil
+	}
+	if node < db.nodeCount {
+		return nil, fmt.Errorf("%w: search tree deeper than the address", errCorrupt)
+	}
+
+	value, _, err := decoder{buf: db.data}.decode(node-db.nodeCount-16, 0)
+	return value, err
+}
+
+// decoder reads values from a data section; pointers are offsets into buf
+type decoder struct {
+	buf []byte
+}
+
+// maxDepth bounds the nesting of maps and arrays so a corrupt file cannot recurse forever
+const maxDepth = 32
+
+// decode returns the value at offset and the offset following it
+func (d decoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("%w: values nested too deeply", errCorrupt)
+	}
+	kind, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if kind == typePointer {
+		target, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		// A pointer never points to another pointer
+		kind, size, valueOffset, err := d.control(target)
+		if err != nil {
+			return nil, 0, err
+		}
+		if kind == typePointer {
+			return nil, 0, fmt.Errorf("%w: pointer to a pointer", errCorrupt)
+		}
+		value, _, err := d.value(kind, size, valueOffset, depth)
+		return value, next, err
+	}
+	return d.value(kind, size, offset, depth)
+}
+
+// control reads a control byte and its extended type and size bytes
+func (d decoder) control(offset uint) (kind int, size uint, next uint, err error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, fmt.Errorf("%w: offset %d outside the data section", errCorrupt, offset)
+	}
+	ctrl := d.buf[offset]
+	offset++
+	kind = int(ctrl >> 5)
+	if kind == typePointer {
+		// The size bits of a pointer are decoded by pointer
+		return kind, uint(ctrl & 0x1f), offset, nil
+	}
+	if kind == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("%w: truncated type", errCorrupt)
+		}
+		kind = 7 + int(d.buf[offset])
+		offset++
+	}
+
+	size = uint(ctrl & 0x1f)
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("%w: truncated size", errCorrupt)
+		}
+		n := uint(0)
+		for _, b := range d.buf[offset : offset+extra] {
+			n = n<<8 | uint(b)
+		}
+		offset += extra
+		switch extra {
+		case 1:
+			size = 29 + n
+		case 2:
+			size = 285 + n
+		default:
+			size = 65821 + n
+		}
+	}
+	return kind, size, offset, nil
+}
+
+// pointer resolves a pointer whose control byte carried sizeBits
+func (d decoder) pointer(sizeBits, offset uint) (target uint, next uint, err error) {
+	length := sizeBits>>3&0x3 + 1
+	if offset+length > uint(len(d.buf)) {
+		return 0, 0, fmt.Errorf("%w: truncated pointer", errCorrupt)
+	}
+	n := uint(0)
+	for _, b := range d.buf[offset : offset+length] {
+		n = n<<8 | uint(b)
+	}
+	switch length {
+	case 1:
+		target = (sizeBits&0x7)<<8 | n
+	case 2:
+		target = ((sizeBits&0x7)<<16 | n) + 2048
+	case 3:
+		target = ((sizeBits&0x7)<<24 | n) + 526336
+	default:
+		target = n
+	}
+	return target, offset + length, nil
+}
+
+func (d decoder) value(kind int, size, offset uint, depth int) (interface{}, uint, error) {
+	switch kind {
+	case typeMap:
+		fields := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", errCorrupt)
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			fields[name] = value
+			offset = next
+		}
+		return fields, offset, nil
+	case typeArray:
+		items := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			item, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, item)
+			offset = next
+		}
+		return items, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, fmt.Errorf("%w: value exceeds the data section", errCorrupt)
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+	switch kind {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes, typeUint128:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: double of %d bytes", errCorrupt, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: float of %d bytes", errCorrupt, size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("%w: integer of %d bytes", errCorrupt, size)
+		}
+		n := uint64(0)
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("%w: int32 of %d bytes", errCorrupt, size)
+		}
+		n := uint32(0)
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), next, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unknown type %d", errCorrupt, kind)
+}
+
+// asUint converts a decoded integer, returning 0 for other values
+func asUint(value interface{}) uint64 {
+	switch n := value.(type) {
+	case uint64:
+		return n
+	case int64:
+		if n > 0 {
+			return uint64(n)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,78 @@
+package graph
+
+import (
+	"api/internal/service"
+	"context"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// maxComplexity bounds the number of fields a query may select
+const maxComplexity = 500
+
+type Handler struct {
+	server *handler.Server
+}
+
+func NewHandler(users service.UserService, attributes service.AttributeService, logger *logrus.Logger) *Handler {
+	server := handler.New(NewExecutableSchema(Config{Resolvers: &Resolver{
+		users:      users,
+		attributes: attributes,
+		logger:     logger,
+	}}))
+	server.AddTransport(transport.POST{})
+	server.Use(extension.Introspection{})
+	server.Use(extension.FixedComplexityLimit(maxComplexity))
+	server.SetRecoverFunc(func(ctx context.Context, err interface{}) error {
+		logger.WithField("panic", err).Error("GraphQL resolver panicked")
+		return &gqlerror.Error{
+			Message:    "Internal server error",
+			Extensions: map[string]interface{}{"code": "internal"},
+		}
+	})
+	return &Handler{server: server}
+}
+
+// Request is a GraphQL request
+type Request struct {
+	Query         string                 `json:"query" example:"{ viewer { id email profile { firstName } } }"`
+	OperationName string                 `json:"operationName,omitempty" example:""`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Response is a GraphQL response: the data selected, and the errors of the fields that
+// failed, each with a code under extensions
+type Response struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []ResponseError        `json:"errors,omitempty"`
+}
+
+// ResponseError is a GraphQL error
+type ResponseError struct {
+	Message    string                 `json:"message" example:"Admin access required"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Serve godoc
+// @Summary Query the API with GraphQL
+// @Description Run a GraphQL query or mutation: viewer (the signed-in user, scope profile:read), users (admins only, scope admin:users; filtered by role and custom attributes and paged with first and after) and updateProfile (scope profile:write). The schema is in internal/graph/schema.graphqls and can be introspected. Fields the caller may not see fail with an error whose extensions.code is insufficient_scope, forbidden, invalid_input, not_found or internal, while the other fields are still answered.
+// @Tags graphql
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body Request true "GraphQL request"
+// @Success 200 {object} Response
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Account blocked, code: account_suspended or account_banned"
+// @Failure 422 {object} Response "Query could not be parsed or does not match the schema"
+// @Router /graphql [post]
+func (h *Handler) Serve(c *gin.Context) {
+	ctx := context.WithValue(c.Request.Context(), ginContextKey{}, c)
+	h.server.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+}
@@ -0,0 +1,83 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package graph
+
+import (
+	"time"
+)
+
+type AttributeFilter struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type FieldVisibility struct {
+	Field string `json:"field"`
+	// public or private
+	Visibility string `json:"visibility"`
+}
+
+type Mutation struct {
+}
+
+type PageInfo struct {
+	// Cursor of the last user of the page, null when it is empty
+	EndCursor   *string `json:"endCursor,omitempty"`
+	HasNextPage bool    `json:"hasNextPage"`
+}
+
+type Profile struct {
+	FirstName     string `json:"firstName"`
+	LastName      string `json:"lastName"`
+	PreferredName string `json:"preferredName"`
+	Pronouns      string `json:"pronouns"`
+	Honorific     string `json:"honorific"`
+	Bio           string `json:"bio"`
+	AvatarURL     string `json:"avatarURL"`
+	Locale        string `json:"locale"`
+	// IANA name, e.g. Europe/Berlin
+	Timezone string `json:"timezone"`
+}
+
+type ProfileInput struct {
+	FirstName     *string `json:"firstName,omitempty"`
+	LastName      *string `json:"lastName,omitempty"`
+	PreferredName *string `json:"preferredName,omitempty"`
+	Pronouns      *string `json:"pronouns,omitempty"`
+	Honorific     *string `json:"honorific,omitempty"`
+	Bio           *string `json:"bio,omitempty"`
+	AvatarURL     *string `json:"avatarURL,omitempty"`
+	Locale        *string `json:"locale,omitempty"`
+	Timezone      *string `json:"timezone,omitempty"`
+	// Directory visibility of profile fields; omitted keeps the current settings
+	Visibility []*FieldVisibility `json:"visibility,omitempty"`
+}
+
+type Query struct {
+}
+
+type User struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	Username      string `json:"username"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"emailVerified"`
+	// active, suspended, banned, deactivated or pending_deletion
+	Status string `json:"status"`
+	// In the caller's timezone
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Profile   *Profile  `json:"profile"`
+}
+
+type UserConnection struct {
+	Nodes    []*User   `json:"nodes"`
+	PageInfo *PageInfo `json:"pageInfo"`
+}
+
+// Users must match every given condition
+type UserFilter struct {
+	Role *string `json:"role,omitempty"`
+	// Custom attribute values, as attr[key]=value filters the REST list
+	Attributes []*AttributeFilter `json:"attributes,omitempty"`
+}
@@ -0,0 +1,148 @@
+// Package graph serves the user management API over GraphQL. The schema is in
+// schema.graphqls; generated.go and models_gen.go are generated from it by gqlgen.
+package graph
+
+//go:generate go run github.com/99designs/gqlgen@v0.17.73 generate
+
+import (
+	"api/internal/handlers"
+	"api/internal/i18n"
+	"api/internal/middleware"
+	"api/internal/models"
+	"api/internal/service"
+	"context"
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Default and largest page size of the users query
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// Resolver resolves the queries and mutations of the schema with the services behind
+// the REST routes
+type Resolver struct {
+	users      service.UserService
+	attributes service.AttributeService
+	logger     *logrus.Logger
+}
+
+// ginContextKey holds the request's gin context, and with it the caller the auth
+// middleware identified
+type ginContextKey struct{}
+
+func ginContext(ctx context.Context) *gin.Context {
+	c, _ := ctx.Value(ginContextKey{}).(*gin.Context)
+	return c
+}
+
+// requireScope fails unless the caller's credentials allow scope, as RequireScope does
+// for the REST routes
+func requireScope(c *gin.Context, scope string) error {
+	if middleware.AllowsScope(c, scope) {
+		return nil
+	}
+	return &gqlerror.Error{
+		Message:    "Insufficient scope",
+		Extensions: map[string]interface{}{"code": "insufficient_scope", "scope": scope},
+	}
+}
+
+// requireAdmin fails unless the caller is an admin, as AdminMiddleware does for the
+// REST routes
+func requireAdmin(c *gin.Context) error {
+	if c.GetString("role") == "admin" {
+		return nil
+	}
+	return &gqlerror.Error{
+		Message:    "Admin access required",
+		Extensions: map[string]interface{}{"code": "forbidden"},
+	}
+}
+
+// inputError rejects an argument with a message in the caller's locale and, for
+// validation errors, every rejected field under "fields"
+func inputError(c *gin.Context, err error) error {
+	locale := c.GetString("locale")
+	if locale == "" {
+		locale = i18n.Default
+	}
+	extensions := map[string]interface{}{"code": "invalid_input"}
+	if fields := i18n.FieldErrors(locale, err); len(fields) > 0 {
+		extensions["fields"] = fields
+	}
+	return &gqlerror.Error{Message: i18n.Validation(locale, err), Extensions: extensions}
+}
+
+func invalidInput(message string) error {
+	return &gqlerror.Error{
+		Message:    message,
+		Extensions: map[string]interface{}{"code": "invalid_input"},
+	}
+}
+
+func notFound(message string) error {
+	return &gqlerror.Error{
+		Message:    message,
+		Extensions: map[string]interface{}{"code": "not_found"},
+	}
+}
+
+// internalError logs err and returns message, hiding the cause from the caller
+func (r *Resolver) internalError(err error, message string) error {
+	r.logger.WithError(err).Error(message)
+	return &gqlerror.Error{
+		Message:    message,
+		Extensions: map[string]interface{}{"code": "internal"},
+	}
+}
+
+func userNode(c *gin.Context, user *models.User, profile *models.UserProfile) *User {
+	return &User{
+		ID:            strconv.FormatUint(uint64(user.ID), 10),
+		Email:         user.Email,
+		Username:      user.Username,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
+		Status:        user.AccountStatus(time.Now()),
+		CreatedAt:     handlers.LocalTime(c, user.CreatedAt),
+		UpdatedAt:     handlers.LocalTime(c, user.UpdatedAt),
+		Profile:       profileNode(profile),
+	}
+}
+
+func profileNode(profile *models.UserProfile) *Profile {
+	return &Profile{
+		FirstName:     profile.FirstName,
+		LastName:      profile.LastName,
+		PreferredName: string(profile.PreferredName),
+		Pronouns:      string(profile.Pronouns),
+		Honorific:     profile.Honorific,
+		Bio:           string(profile.Bio),
+		AvatarURL:     handlers.AvatarURL(profile),
+		Locale:        profile.Locale,
+		Timezone:      profile.Timezone,
+	}
+}
+
+// encodeCursor and decodeCursor keep the position in the user list opaque to clients,
+// like the cursors of the v2 REST list
+func encodeCursor(lastID uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(lastID), 10)))
+}
+
+func decodeCursor(cursor string) (uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(string(raw), 10, 64)
+	return uint(id), err
+}
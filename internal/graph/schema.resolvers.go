@@ -0,0 +1,174 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.73
+
+import (
+	"api/internal/handlers"
+	"api/internal/service"
+	"context"
+	"errors"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+// UpdateProfile is the resolver for the updateProfile field.
+func (r *mutationResolver) UpdateProfile(ctx context.Context, input ProfileInput) (*Profile, error) {
+	c := ginContext(ctx)
+	if err := requireScope(c, service.ScopeProfileWrite); err != nil {
+		return nil, err
+	}
+	userID := c.GetUint("userID")
+	_, profile, err := r.users.GetProfile(userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return nil, notFound("User not found")
+		}
+		return nil, r.internalError(err, "Failed to update profile")
+	}
+
+	// Omitted fields keep their value; the result is checked like a PUT /users/profile body
+	request := handlers.UpdateProfileRequest{
+		FirstName:     profile.FirstName,
+		LastName:      profile.LastName,
+		Bio:           string(profile.Bio),
+		AvatarURL:     profile.AvatarURL,
+		Locale:        profile.Locale,
+		PreferredName: string(profile.PreferredName),
+		Pronouns:      string(profile.Pronouns),
+		Honorific:     profile.Honorific,
+		Timezone:      profile.Timezone,
+	}
+	set := func(field *string, value *string) {
+		if value != nil {
+			*field = *value
+		}
+	}
+	set(&request.FirstName, input.FirstName)
+	set(&request.LastName, input.LastName)
+	set(&request.Bio, input.Bio)
+	set(&request.AvatarURL, input.AvatarURL)
+	set(&request.Locale, input.Locale)
+	set(&request.PreferredName, input.PreferredName)
+	set(&request.Pronouns, input.Pronouns)
+	set(&request.Honorific, input.Honorific)
+	set(&request.Timezone, input.Timezone)
+	if input.Visibility != nil {
+		request.Visibility = make(map[string]string, len(input.Visibility))
+		for _, setting := range input.Visibility {
+			request.Visibility[setting.Field] = setting.Visibility
+		}
+	}
+	if err := binding.Validator.ValidateStruct(&request); err != nil {
+		return nil, inputError(c, err)
+	}
+
+	updated, err := r.users.UpdateProfile(userID, service.ProfileUpdate{
+		FirstName:     request.FirstName,
+		LastName:      request.LastName,
+		Bio:           request.Bio,
+		AvatarURL:     request.AvatarURL,
+		Locale:        request.Locale,
+		PreferredName: request.PreferredName,
+		Pronouns:      request.Pronouns,
+		Honorific:     request.Honorific,
+		Timezone:      request.Timezone,
+		Visibility:    request.Visibility,
+	})
+	if err != nil {
+		if response, ok := handlers.ProfileUpdateError(err); ok {
+			return nil, invalidInput(response["error"].(string))
+		}
+		return nil, r.internalError(err, "Failed to update profile")
+	}
+	return profileNode(updated), nil
+}
+
+// Viewer is the resolver for the viewer field.
+func (r *queryResolver) Viewer(ctx context.Context) (*User, error) {
+	c := ginContext(ctx)
+	if err := requireScope(c, service.ScopeProfileRead); err != nil {
+		return nil, err
+	}
+	user, profile, err := r.users.GetProfile(c.GetUint("userID"))
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return nil, notFound("User not found")
+		}
+		return nil, r.internalError(err, "Failed to fetch profile")
+	}
+	return userNode(c, user, profile), nil
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, filter *UserFilter, first *int, after *string) (*UserConnection, error) {
+	c := ginContext(ctx)
+	if err := requireAdmin(c); err != nil {
+		return nil, err
+	}
+	if err := requireScope(c, service.ScopeAdminUsers); err != nil {
+		return nil, err
+	}
+	limit := defaultPageSize
+	if first != nil {
+		limit = *first
+	}
+	if limit < 1 || limit > maxPageSize {
+		return nil, invalidInput("first must be between 1 and 200")
+	}
+	var afterID uint
+	if after != nil {
+		var err error
+		if afterID, err = decodeCursor(*after); err != nil {
+			return nil, invalidInput("Invalid cursor")
+		}
+	}
+	var role string
+	var attributes map[string]string
+	if filter != nil {
+		if filter.Role != nil {
+			role = *filter.Role
+		}
+		if len(filter.Attributes) > 0 {
+			values := make(map[string]string, len(filter.Attributes))
+			for _, attribute := range filter.Attributes {
+				values[attribute.Key] = attribute.Value
+			}
+			var err error
+			if attributes, err = r.attributes.Filter(values); err != nil {
+				if errors.Is(err, service.ErrInvalidAttribute) {
+					return nil, invalidInput(err.Error())
+				}
+				return nil, r.internalError(err, "Failed to fetch users")
+			}
+		}
+	}
+
+	// One more than the page tells whether another page follows
+	users, err := r.users.FilterUsersPage(c.GetUint("orgID"), role, attributes, afterID, limit+1)
+	if err != nil {
+		return nil, r.internalError(err, "Failed to fetch users")
+	}
+	connection := &UserConnection{
+		Nodes:    make([]*User, 0, min(len(users), limit)),
+		PageInfo: &PageInfo{HasNextPage: len(users) > limit},
+	}
+	for i := range users[:min(len(users), limit)] {
+		connection.Nodes = append(connection.Nodes, userNode(c, &users[i].User, &users[i].Profile))
+	}
+	if n := len(connection.Nodes); n > 0 {
+		cursor := encodeCursor(users[n-1].User.ID)
+		connection.PageInfo.EndCursor = &cursor
+	}
+	return connection, nil
+}
+
+// Mutation returns MutationResolver implementation.
+func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+type mutationResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"api/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultActivityLimit = 50
+	maxActivityLimit     = 200
+)
+
+type ActivityHandler struct {
+	activity service.ActivityService
+	logger   *logrus.Logger
+}
+
+func NewActivityHandler(activity service.ActivityService, logger *logrus.Logger) *ActivityHandler {
+	return &ActivityHandler{
+		activity: activity,
+		logger:   logger,
+	}
+}
+
+// GetActivity godoc
+// @Summary Get account activity
+// @Description List recent security-relevant activity on the authenticated user's account, such as password reset requests, newest first
+// @Tags users
+// @Produce json
+// @Security Bearer
+// @Param limit query int false "Maximum number of items (default 50, max 200)"
+// @Success 200 {object} ActivityResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/activity [get]
+func (h *ActivityHandler) GetActivity(c *gin.Context) {
+	items, err := h.activity.UserActivity(c.GetUint("userID"), activityLimit(c))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list account activity")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch activity"})
+		return
+	}
+	c.JSON(http.StatusOK, activityResponse(c, items))
+}
+
+// GetTimeline godoc
+// @Summary Get a user's timeline
+// @Description List a user's security events and audited account changes, newest first (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path string true "User ID"
+// @Param limit query int false "Maximum number of items (default 50, max 200)"
+// @Success 200 {object} ActivityResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/{id}/timeline [get]
+func (h *ActivityHandler) GetTimeline(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	items, err := h.activity.AdminTimeline(userID, activityLimit(c))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to build user timeline")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch timeline"})
+		return
+	}
+	c.JSON(http.StatusOK, activityResponse(c, items))
+}
+
+// activityLimit reads the limit query parameter, falling back to the default when it is invalid
+func activityLimit(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		return defaultActivityLimit
+	}
+	if limit > maxActivityLimit {
+		return maxActivityLimit
+	}
+	return limit
+}
+
+func activityResponse(c *gin.Context, items []service.ActivityItem) ActivityResponse {
+	response := ActivityResponse{Items: make([]ActivityItem, 0, len(items))}
+	for _, item := range items {
+		response.Items = append(response.Items, ActivityItem{
+			At:       localTime(c, item.At),
+			Kind:     item.Kind,
+			Type:     item.Type,
+			Severity: item.Severity,
+			ActorID:  item.ActorID,
+			Details:  item.Details,
+		})
+	}
+	return response
+}
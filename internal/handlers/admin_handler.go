@@ -1,68 +1,636 @@
 package handlers
 
 import (
+	"api/internal/jsonpatch"
+	"api/internal/middleware"
 	"api/internal/models"
+	"api/internal/service"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jinzhu/gorm"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/sirupsen/logrus"
 )
 
 type AdminHandler struct {
-	db     *gorm.DB
-	logger *logrus.Logger
+	users         service.UserService
+	erasure       service.ErasureService
+	bulk          service.BulkUserService
+	attributes    service.AttributeService
+	notifications service.NotificationService
+	resets        service.PasswordResetService
+	logger        *logrus.Logger
 }
 
-func NewAdminHandler(db *gorm.DB, logger *logrus.Logger) *AdminHandler {
+func NewAdminHandler(users service.UserService, erasure service.ErasureService, bulk service.BulkUserService, attributes service.AttributeService, notifications service.NotificationService, resets service.PasswordResetService, logger *logrus.Logger) *AdminHandler {
 	return &AdminHandler{
-		db:     db,
-		logger: logger,
+		users:         users,
+		erasure:       erasure,
+		bulk:          bulk,
+		attributes:    attributes,
+		notifications: notifications,
+		resets:        resets,
+		logger:        logger,
 	}
 }
 
 // ListUsers godoc
 // @Summary List all users
-// @Description Get a list of all users (admin only)
+// @Description Get a list of all users (admin only). When the access token acts for an organization only its members are listed. Custom attributes filter the list as attr[key]=value, e.g. attr[department]=sales; several filters must all match.
 // @Tags admin
 // @Accept json
 // @Produce json
 // @Security Bearer
+// @Param attr[key] query string false "Custom attribute value to filter by"
+// @Param fields query string false "Fields of each user to return, e.g. email,username,profile.firstName"
 // @Success 200 {object} UsersListResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid attribute value"
 // @Failure 401 {object} map[string]string "error: Unauthorized"
 // @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
 // @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
 // @Router /admin/users [get]
 func (h *AdminHandler) ListUsers(c *gin.Context) {
-	var users []models.User
-	if err := h.db.Find(&users).Error; err != nil {
+	var users []service.UserWithProfile
+	var err error
+	orgID := c.GetUint("orgID")
+	switch attributes := c.QueryMap("attr"); {
+	case len(attributes) > 0:
+		var filter map[string]string
+		if filter, err = h.attributes.Filter(attributes); err != nil {
+			if errors.Is(err, service.ErrInvalidAttribute) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			break
+		}
+		users, err = h.users.FilterUsers(orgID, filter)
+	case orgID != 0:
+		users, err = h.users.ListOrganizationUsers(orgID)
+	default:
+		users, err = h.users.ListUsers()
+	}
+	if err != nil {
 		h.logger.WithError(err).Error("Failed to fetch users list")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
 	}
 
-	var usersList []gin.H
-	for _, user := range users {
-		var profile models.UserProfile
-		h.db.Where("user_id = ?", user.ID).First(&profile)
-
+	now := time.Now()
+	usersList := make([]gin.H, 0, len(users))
+	for _, u := range users {
 		usersList = append(usersList, gin.H{
-			"id":        user.ID,
-			"email":     user.Email,
-			"username":  user.Username,
-			"role":      user.Role,
-			"verified":  user.EmailVerified,
-			"createdAt": user.CreatedAt,
+			"id":        u.User.ID,
+			"email":     u.User.Email,
+			"username":  u.User.Username,
+			"role":      u.User.Role,
+			"verified":  u.User.EmailVerified,
+			"status":    u.User.AccountStatus(now),
+			"createdAt": u.User.CreatedAt,
 			"profile": gin.H{
-				"firstName": profile.FirstName,
-				"lastName":  profile.LastName,
+				"firstName":     u.Profile.FirstName,
+				"lastName":      u.Profile.LastName,
+				"preferredName": u.Profile.PreferredName,
+				"pronouns":      u.Profile.Pronouns,
+				"honorific":     u.Profile.Honorific,
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": selectFields(c, usersList)})
+}
+
+// Default and largest number of users returned by a search
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchUsers godoc
+// @Summary Search users
+// @Description Find users by email, username or first and last name (admin only). Matching is fuzzy, so misspellings and partial words such as "jon smith" still find John Smith; results are ordered by relevance and the matching words are highlighted. When the access token acts for an organization only its members are searched.
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param q query string true "Search text, at least 2 characters"
+// @Param limit query int false "Maximum number of users (default 20, max 100)"
+// @Success 200 {object} UserSearchResponse
+// @Failure 400 {object} map[string]interface{} "error: search query must be at least 2 characters"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/search [get]
+func (h *AdminHandler) SearchUsers(c *gin.Context) {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	query := c.Query("q")
+	hits, err := h.users.Search(query, c.GetUint("orgID"), limit)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSearch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to search users")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		return
+	}
+
+	now := time.Now()
+	response := UserSearchResponse{Query: query, Users: make([]UserSearchItem, 0, len(hits))}
+	for _, hit := range hits {
+		response.Users = append(response.Users, UserSearchItem{
+			ID:         hit.User.ID,
+			Email:      hit.User.Email,
+			Username:   hit.User.Username,
+			Role:       hit.User.Role,
+			Verified:   hit.User.EmailVerified,
+			Status:     hit.User.AccountStatus(now),
+			FirstName:  hit.Profile.FirstName,
+			LastName:   hit.Profile.LastName,
+			Score:      hit.Score,
+			Highlights: hit.Highlights,
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// IncompleteProfiles godoc
+// @Summary Report incomplete profiles
+// @Description List the active users whose profile completeness score is below a threshold, least complete first, with the fields they have yet to fill in (admin only). The score is the percentage of the configured profile field weights that are filled in, as returned by GET /users/profile. When the access token acts for an organization only its members are listed.
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param below query int false "Threshold score, 1 to 100 (default profiles.completeness.threshold)"
+// @Success 200 {object} IncompleteProfilesResponse
+// @Failure 400 {object} map[string]interface{} "error: below must be between 1 and 100"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/incomplete-profiles [get]
+func (h *AdminHandler) IncompleteProfiles(c *gin.Context) {
+	threshold := 0
+	if value := c.Query("below"); value != "" {
+		var err error
+		threshold, err = strconv.Atoi(value)
+		if err != nil || threshold < 1 || threshold > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "below must be between 1 and 100"})
+			return
+		}
+	}
+
+	report, err := h.users.IncompleteProfiles(c.GetUint("orgID"), threshold)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to build incomplete profiles report")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incomplete profiles"})
+		return
+	}
+
+	response := IncompleteProfilesResponse{Threshold: report.Threshold, Users: make([]IncompleteProfileResponse, 0, len(report.Users))}
+	for _, user := range report.Users {
+		response.Users = append(response.Users, IncompleteProfileResponse{
+			ID:        user.User.ID,
+			Email:     user.User.Email,
+			Username:  user.User.Username,
+			CreatedAt: user.User.CreatedAt,
+			Completeness: ProfileCompletenessResponse{
+				Score:           user.Completeness.Score,
+				Missing:         user.Completeness.Missing,
+				MissingRequired: user.Completeness.MissingRequired,
 			},
 		})
 	}
+	c.JSON(http.StatusOK, response)
+}
+
+// PreviewUser godoc
+// @Summary Preview a user's view
+// @Description Return exactly what the user sees from their own profile and settings endpoints, so support can check user-visible state without impersonating them (admin only). Read-only: no token is issued.
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path string true "User ID"
+// @Success 200 {object} UserPreviewResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/{id}/preview [get]
+func (h *AdminHandler) PreviewUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	user, profile, err := h.users.GetProfile(userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to fetch user profile for preview")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build preview"})
+		return
+	}
+	prefs, err := h.notifications.Preferences(userID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch notification preferences for preview")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build preview"})
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"admin_id": c.GetUint("userID"),
+		"user_id":  userID,
+	}).Info("Admin previewed user view")
+
+	c.JSON(http.StatusOK, gin.H{
+		"profile":       profileView(user, profile, h.users.ProfileCompleteness(profile), middleware.EnabledFeaturesFor(c, user.ID, user.Role)),
+		"notifications": preferencesResponse(prefs),
+	})
+}
+
+// EraseUser godoc
+// @Summary Erase a user account
+// @Description Delete a user's account, overriding the configured privacy policy when a mode is given: soft (soft delete), anonymize (scrub personal data, keep the row) or hard (permanent deletion) (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "User ID"
+// @Param erasure body EraseUserRequest false "Erasure mode"
+// @Success 200 {object} EraseUserResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/{id}/erase [post]
+func (h *AdminHandler) EraseUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Mode string `json:"mode" binding:"omitempty,oneof=soft anonymize hard"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := bindJSON(c, &input); err != nil {
+			validationError(c, err)
+			return
+		}
+	}
+
+	mode, err := h.erasure.Erase(c.Request.Context(), userID, input.Mode)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to erase user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase user"})
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"admin_id": c.GetUint("userID"),
+		"mode":     mode,
+	}).Info("Admin erased user account")
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User erased successfully",
+		"mode":    mode,
+	})
+}
+
+// ListDeletedUsers godoc
+// @Summary List deleted users
+// @Description List soft deleted accounts, most recently deleted first, so they can be restored or purged (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} DeletedUsersResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/deleted [get]
+func (h *AdminHandler) ListDeletedUsers(c *gin.Context) {
+	users, err := h.users.ListDeleted()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch deleted users")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deleted users"})
+		return
+	}
+
+	usersList := make([]gin.H, 0, len(users))
+	for _, u := range users {
+		usersList = append(usersList, gin.H{
+			"id":        u.ID,
+			"email":     u.Email,
+			"username":  u.Username,
+			"role":      u.Role,
+			"createdAt": u.CreatedAt,
+			"deletedAt": u.DeletedAt,
+		})
+	}
 
 	c.JSON(http.StatusOK, gin.H{"users": usersList})
 }
 
+// RestoreUser godoc
+// @Summary Restore a deleted user
+// @Description Undelete a soft deleted account and its profile (admin only). Sessions are not restored; the user signs in again. The restore is recorded in the audit trail.
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]string "message: User restored successfully"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 409 {object} map[string]string "error: User is not deleted"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/{id}/restore [post]
+func (h *AdminHandler) RestoreUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if _, err := h.users.Restore(userID, c.GetUint("userID")); err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, service.ErrUserNotDeleted):
+			c.JSON(http.StatusConflict, gin.H{"error": "User is not deleted"})
+		default:
+			h.logger.WithError(err).Error("Failed to restore user")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore user"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User restored successfully"})
+}
+
+// PurgeUser godoc
+// @Summary Purge a deleted user
+// @Description Permanently delete a soft deleted account together with its profile, credentials, sessions, exports, media, audit trail and other linked records (admin only). Accounts that are not deleted are refused; use erase for those.
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]string "message: User purged successfully"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 409 {object} map[string]string "error: User is not deleted"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/{id}/purge [delete]
+func (h *AdminHandler) PurgeUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.erasure.Purge(c.Request.Context(), userID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, service.ErrUserNotDeleted):
+			c.JSON(http.StatusConflict, gin.H{"error": "User is not deleted"})
+		default:
+			h.logger.WithError(err).Error("Failed to purge user")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge user"})
+		}
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"admin_id": c.GetUint("userID"),
+	}).Info("Admin purged deleted user")
+
+	c.JSON(http.StatusOK, gin.H{"message": "User purged successfully"})
+}
+
+// SendPasswordReset godoc
+// @Summary Send a user a password reset link
+// @Description Email the user a password reset link, as when they ask for one; their password keeps working until the link is used. At most security.passwordReset.maxPerHour links are sent per hour (admin only).
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]string "message: Password reset link sent"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 409 {object} map[string]string "error: The password is managed by the identity provider"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/{id}/password-reset [post]
+func (h *AdminHandler) SendPasswordReset(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	user, _, err := h.users.GetProfile(userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to fetch user for password reset")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send password reset"})
+		return
+	}
+	if user.ExternallyManaged() {
+		c.JSON(http.StatusConflict, gin.H{"error": "The password is managed by the identity provider"})
+		return
+	}
+	if err := h.resets.Request(user.Email, clientInfo(c)); err != nil {
+		h.logger.WithError(err).Error("Failed to send password reset")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send password reset"})
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"admin_id": c.GetUint("userID"),
+	}).Info("Admin sent password reset link")
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset link sent"})
+}
+
+// RevokeSessions godoc
+// @Summary Sign a user out everywhere
+// @Description Delete all of a user's refresh tokens and revoke every access token issued so far, e.g. when the account is compromised (admin only). The action is recorded in the audit trail, and with notify set the user is told by email.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "User ID"
+// @Param options body RevokeSessionsRequest false "Notification option"
+// @Success 200 {object} RevokeSessionsResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/{id}/revoke-sessions [post]
+func (h *AdminHandler) RevokeSessions(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Notify bool `json:"notify"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := bindJSON(c, &input); err != nil {
+			validationError(c, err)
+			return
+		}
+	}
+
+	revoked, err := h.users.RevokeAllSessions(userID, c.GetUint("userID"), input.Notify)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to revoke user sessions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "All sessions revoked",
+		"revokedSessions": revoked,
+	})
+}
+
+// SuspendUser godoc
+// @Summary Suspend or ban a user
+// @Description Suspend a user, optionally until a given time, or ban them permanently (admin only). All of the user's sessions are ended and further sign-ins are refused with code account_suspended or account_banned. The change is recorded in the audit trail.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path string true "User ID"
+// @Param suspension body SuspendUserRequest true "Suspension"
+// @Success 200 {object} AccountStatusResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/{id}/suspend [put]
+func (h *AdminHandler) SuspendUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input SuspendUserRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	user, err := h.users.Suspend(userID, c.GetUint("userID"), service.SuspendInput{
+		Ban:    input.Ban,
+		Reason: input.Reason,
+		Until:  input.Until,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, service.ErrInvalidSuspension):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			h.logger.WithError(err).Error("Failed to suspend user")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to suspend user"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, accountStatusResponse(user))
+}
+
+// ReinstateUser godoc
+// @Summary Reinstate a suspended user
+// @Description Lift a suspension or ban, or undo a deactivation, and return the account to active (admin only). The user signs in again to get new sessions.
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path string true "User ID"
+// @Success 200 {object} AccountStatusResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/{id}/reinstate [put]
+func (h *AdminHandler) ReinstateUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	user, err := h.users.Reinstate(userID, c.GetUint("userID"))
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to reinstate user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reinstate user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, accountStatusResponse(user))
+}
+
+func accountStatusResponse(user *models.User) AccountStatusResponse {
+	return AccountStatusResponse{
+		UserID:           user.ID,
+		Status:           user.Status,
+		SuspensionReason: user.SuspensionReason,
+		SuspendedAt:      user.SuspendedAt,
+		SuspendedUntil:   user.SuspendedUntil,
+	}
+}
+
 // ChangeUserRole godoc
 // @Summary Change user role
 // @Description Change the role of a specific user (admin only)
@@ -73,42 +641,39 @@ func (h *AdminHandler) ListUsers(c *gin.Context) {
 // @Param id path string true "User ID"
 // @Param role body ChangeRoleRequest true "New Role"
 // @Success 200 {object} UserRoleResponse
-// @Failure 400 {object} map[string]string "error: Validation error"
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
 // @Failure 401 {object} map[string]string "error: Unauthorized"
 // @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
 // @Failure 404 {object} map[string]string "error: User not found"
 // @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
 // @Router /admin/users/{id}/role [put]
 func (h *AdminHandler) ChangeUserRole(c *gin.Context) {
-	userID := c.Param("id")
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
 
 	var input struct {
 		Role string `json:"role" binding:"required,oneof=user admin"`
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
 		return
 	}
 
-	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
-	}
-
-	user.Role = input.Role
-	if err := h.db.Save(&user).Error; err != nil {
+	user, err := h.users.ChangeRole(userID, input.Role)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
 		h.logger.WithError(err).Error("Failed to update user role")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user role"})
 		return
 	}
 
-	h.logger.WithFields(logrus.Fields{
-		"user_id":  userID,
-		"new_role": input.Role,
-	}).Info("User role updated")
-
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User role updated successfully",
 		"user": gin.H{
@@ -118,3 +683,317 @@ func (h *AdminHandler) ChangeUserRole(c *gin.Context) {
 		},
 	})
 }
+
+// BulkUpdateUsers godoc
+// @Summary Apply an action to many users
+// @Description Assign a role, suspend, verify the email address of or delete up to 500 users at once (admin only). Each user is handled on its own, so some may fail while the others are changed; the result of every user is returned in the order given. The admin's own account is refused for every action except verify_email.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body BulkUserRequest true "Users and action"
+// @Success 200 {object} BulkUserResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/bulk [post]
+func (h *AdminHandler) BulkUpdateUsers(c *gin.Context) {
+	var input BulkUserRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	request := service.BulkRequest{
+		Action:      input.Action,
+		UserIDs:     input.UserIDs,
+		Role:        input.Role,
+		ErasureMode: input.Mode,
+	}
+	if input.Suspension != nil {
+		request.Suspension = service.SuspendInput{
+			Ban:    input.Suspension.Ban,
+			Reason: input.Suspension.Reason,
+			Until:  input.Suspension.Until,
+		}
+	}
+
+	results, err := h.bulk.Apply(c.Request.Context(), c.GetUint("userID"), request)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidBulkRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to apply bulk user action")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply bulk user action"})
+		return
+	}
+
+	response := BulkUserResponse{Action: input.Action, Results: make([]BulkUserResult, len(results))}
+	for i, r := range results {
+		response.Results[i] = BulkUserResult{UserID: r.UserID, Success: r.Success, Error: r.Error}
+		if r.Success {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// patchableUserFields lists the JSON pointers admins may modify, and whether they may be removed
+var patchableUserFields = map[string]bool{
+	"/email":                 false,
+	"/username":              false,
+	"/role":                  false,
+	"/emailVerified":         false,
+	"/profile/firstName":     true,
+	"/profile/lastName":      true,
+	"/profile/bio":           true,
+	"/profile/avatarURL":     true,
+	"/profile/locale":        true,
+	"/profile/preferredName": true,
+	"/profile/pronouns":      true,
+	"/profile/honorific":     true,
+	"/profile/timezone":      true,
+}
+
+func allowUserPatch(op, path string) error {
+	// Visibility settings can be replaced per field, e.g. /profile/visibility/pronouns
+	if field, ok := strings.CutPrefix(path, "/profile/visibility/"); ok {
+		if _, known := service.DefaultProfileVisibility[field]; known {
+			if op == "remove" {
+				return fmt.Errorf("path %q cannot be removed", path)
+			}
+			return nil
+		}
+	}
+	removable, ok := patchableUserFields[path]
+	if !ok {
+		return fmt.Errorf("path %q cannot be modified", path)
+	}
+	if op == "remove" && !removable {
+		return fmt.Errorf("path %q cannot be removed", path)
+	}
+	return nil
+}
+
+// PatchUser godoc
+// @Summary Partially update a user
+// @Description Apply an RFC 6902 JSON Patch (Content-Type: application/json-patch+json) or an RFC 7396 JSON Merge Patch (application/merge-patch+json or application/json) to a user's email, username, role, verification flag and profile fields (admin only). Each JSON Patch operation is checked against the writable fields and the patched document is validated as a whole.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Param patch body []JSONPatchOperation true "JSON Patch operations or a partial AdminUserDocument merge patch"
+// @Success 200 {object} PatchedUserResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid patch or validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 409 {object} map[string]string "error: Test operation failed or email/username already exists"
+// @Failure 413 {object} map[string]string "error: Request body is too large"
+// @Failure 415 {object} map[string]string "error: Unsupported patch format"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/{id} [patch]
+func (h *AdminHandler) PatchUser(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			middleware.BodyTooLarge(c, tooLarge.Limit)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	user, profile, err := h.users.GetProfile(userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to fetch user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	current := AdminUserDocument{
+		Email:         user.Email,
+		Username:      user.Username,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
+		Profile: AdminUserProfileDocument{
+			FirstName:     profile.FirstName,
+			LastName:      profile.LastName,
+			Bio:           string(profile.Bio),
+			AvatarURL:     profile.AvatarURL,
+			Locale:        profile.Locale,
+			PreferredName: string(profile.PreferredName),
+			Pronouns:      string(profile.Pronouns),
+			Honorific:     profile.Honorific,
+			Timezone:      profile.Timezone,
+			Visibility:    service.ProfileVisibility(profile),
+		},
+	}
+	doc, err := toJSONMap(current)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to encode user document")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	switch c.ContentType() {
+	case "application/json-patch+json":
+		var ops []jsonpatch.Operation
+		if err := json.Unmarshal(body, &ops); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON Patch document"})
+			return
+		}
+		if err := jsonpatch.Apply(doc, ops, allowUserPatch); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, jsonpatch.ErrTestFailed) {
+				status = http.StatusConflict
+			}
+			response := gin.H{"error": err.Error()}
+			var opErr *jsonpatch.OperationError
+			if errors.As(err, &opErr) {
+				response["operation"] = opErr.Index
+			}
+			c.JSON(status, response)
+			return
+		}
+	case "application/merge-patch+json", "application/json":
+		var patch map[string]interface{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON Merge Patch document"})
+			return
+		}
+		for _, path := range jsonpatch.Paths(patch) {
+			op := "replace"
+			if value, _ := lookupPointer(patch, path); value == nil {
+				op = "remove"
+			}
+			if err := allowUserPatch(op, path); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		jsonpatch.MergePatch(doc, patch)
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported patch format, use application/json-patch+json or application/merge-patch+json"})
+		return
+	}
+
+	var patched AdminUserDocument
+	if err := fromJSONMap(doc, &patched); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Patched document has invalid field types"})
+		return
+	}
+	if err := binding.Validator.ValidateStruct(&patched); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	updated, err := h.users.UpdateUser(userID, service.UserUpdate{
+		Email:         patched.Email,
+		Username:      patched.Username,
+		Role:          patched.Role,
+		EmailVerified: patched.EmailVerified,
+		Profile: service.ProfileUpdate{
+			FirstName:     patched.Profile.FirstName,
+			LastName:      patched.Profile.LastName,
+			Bio:           patched.Profile.Bio,
+			AvatarURL:     patched.Profile.AvatarURL,
+			Locale:        patched.Profile.Locale,
+			PreferredName: patched.Profile.PreferredName,
+			Pronouns:      patched.Profile.Pronouns,
+			Honorific:     patched.Profile.Honorific,
+			Timezone:      patched.Profile.Timezone,
+			Visibility:    patched.Profile.Visibility,
+		},
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case userExists(c, err):
+		case errors.Is(err, service.ErrUnsupportedLocale):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported locale"})
+		case errors.Is(err, service.ErrInvalidTimezone), errors.Is(err, service.ErrInvalidVisibility):
+			response, _ := profileUpdateError(err)
+			c.JSON(http.StatusBadRequest, response)
+		default:
+			h.logger.WithError(err).Error("Failed to update user")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":            updated.User.ID,
+		"email":         updated.User.Email,
+		"username":      updated.User.Username,
+		"role":          updated.User.Role,
+		"emailVerified": updated.User.EmailVerified,
+		"profile": gin.H{
+			"firstName":     updated.Profile.FirstName,
+			"lastName":      updated.Profile.LastName,
+			"bio":           updated.Profile.Bio,
+			"avatarURL":     updated.Profile.AvatarURL,
+			"locale":        updated.Profile.Locale,
+			"preferredName": updated.Profile.PreferredName,
+			"pronouns":      updated.Profile.Pronouns,
+			"honorific":     updated.Profile.Honorific,
+			"timezone":      updated.Profile.Timezone,
+			"visibility":    service.ProfileVisibility(&updated.Profile),
+		},
+	})
+}
+
+func toJSONMap(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	err = json.Unmarshal(b, &m)
+	return m, err
+}
+
+func fromJSONMap(m map[string]interface{}, v interface{}) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// lookupPointer resolves a JSON pointer inside a decoded JSON object
+func lookupPointer(doc map[string]interface{}, pointer string) (interface{}, bool) {
+	tokens, err := jsonpatch.ParsePointer(pointer)
+	if err != nil {
+		return nil, false
+	}
+	var current interface{} = doc
+	for _, token := range tokens {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = obj[token]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,611 @@
+package handlers
+
+import (
+	"api/internal/middleware/authtest"
+	"api/internal/models"
+	"api/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testUserWithProfile(id uint) service.UserWithProfile {
+	return service.UserWithProfile{
+		User:    *testUser(id, "user"),
+		Profile: models.UserProfile{UserID: id, FirstName: "Ada", LastName: "Lovelace"},
+	}
+}
+
+func TestAdminHandlerListUsers(t *testing.T) {
+	admin := authtest.Admin(1)
+	orgAdmin := authtest.Admin(1).WithOrganization(5, "admin")
+	tests := []struct {
+		name      string
+		target    string
+		identity  *authtest.Identity
+		filterErr error
+		err       error
+		status    int
+		listed    string
+	}{
+		{name: "all users", target: "/api/v1/admin/users", identity: &admin, status: http.StatusOK, listed: "all"},
+		{name: "organization members", target: "/api/v1/admin/users", identity: &orgAdmin, status: http.StatusOK, listed: "organization"},
+		{name: "attribute filter", target: "/api/v1/admin/users?attr[team]=platform", identity: &admin, status: http.StatusOK, listed: "filtered"},
+		{name: "invalid attribute", target: "/api/v1/admin/users?attr[shoe]=42", identity: &admin, filterErr: service.ErrInvalidAttribute, status: http.StatusBadRequest},
+		{name: "attribute failure", target: "/api/v1/admin/users?attr[team]=platform", identity: &admin, filterErr: errDatabase, status: http.StatusInternalServerError},
+		{name: "failure", target: "/api/v1/admin/users", identity: &admin, err: errDatabase, status: http.StatusInternalServerError, listed: "all"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var listed string
+			list := func(kind string) ([]service.UserWithProfile, error) {
+				listed = kind
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return []service.UserWithProfile{testUserWithProfile(2)}, nil
+			}
+			h := NewAdminHandler(&fakeUserService{
+				listUsers: func() ([]service.UserWithProfile, error) { return list("all") },
+				listOrganizationUsers: func(orgID uint) ([]service.UserWithProfile, error) {
+					if orgID != 5 {
+						t.Errorf("orgID = %d, want 5", orgID)
+					}
+					return list("organization")
+				},
+				filterUsers: func(orgID uint, attributes map[string]string) ([]service.UserWithProfile, error) {
+					if attributes["team"] != `"platform"` {
+						t.Errorf("attributes = %v", attributes)
+					}
+					return list("filtered")
+				},
+			}, nil, nil, &fakeAttributeService{
+				filter: func(values map[string]string) (map[string]string, error) {
+					if tt.filterErr != nil {
+						return nil, tt.filterErr
+					}
+					return map[string]string{"team": `"` + values["team"] + `"`}, nil
+				},
+			}, nil, nil, testLogger())
+			w := serve(h.ListUsers, http.MethodGet, tt.target, "", tt.identity, "")
+			body := checkResponse(t, w, tt.status, "")
+			if listed != tt.listed {
+				t.Errorf("listed %q users, want %q", listed, tt.listed)
+			}
+			if tt.status == http.StatusOK {
+				if users, _ := body["users"].([]interface{}); len(users) != 1 {
+					t.Errorf("users = %v", body["users"])
+				}
+			}
+		})
+	}
+}
+
+func TestAdminHandlerSearchUsers(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		err    error
+		status int
+		limit  int
+	}{
+		{name: "default limit", target: "/api/v1/admin/users/search?q=ada", status: http.StatusOK, limit: defaultSearchLimit},
+		{name: "given limit", target: "/api/v1/admin/users/search?q=ada&limit=5", status: http.StatusOK, limit: 5},
+		{name: "limit capped", target: "/api/v1/admin/users/search?q=ada&limit=1000", status: http.StatusOK, limit: maxSearchLimit},
+		{name: "invalid limit", target: "/api/v1/admin/users/search?q=ada&limit=-3", status: http.StatusOK, limit: defaultSearchLimit},
+		{name: "invalid query", target: "/api/v1/admin/users/search?q=", err: service.ErrInvalidSearch, status: http.StatusBadRequest, limit: defaultSearchLimit},
+		{name: "failure", target: "/api/v1/admin/users/search?q=ada", err: errDatabase, status: http.StatusInternalServerError, limit: defaultSearchLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAdminHandler(&fakeUserService{
+				search: func(query string, orgID uint, limit int) ([]service.UserSearchHit, error) {
+					if limit != tt.limit {
+						t.Errorf("limit = %d, want %d", limit, tt.limit)
+					}
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return []service.UserSearchHit{{UserWithProfile: testUserWithProfile(2), Score: 0.8}}, nil
+				},
+			}, nil, nil, nil, nil, nil, testLogger())
+			admin := authtest.Admin(1)
+			w := serve(h.SearchUsers, http.MethodGet, tt.target, "", &admin, "")
+			body := checkResponse(t, w, tt.status, "")
+			if tt.status == http.StatusOK && body["query"] != "ada" {
+				t.Errorf("query = %v", body["query"])
+			}
+		})
+	}
+}
+
+func TestAdminHandlerIncompleteProfiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		err       error
+		status    int
+		threshold int
+	}{
+		{name: "configured threshold", target: "/api/v1/admin/users/incomplete-profiles", status: http.StatusOK},
+		{name: "given threshold", target: "/api/v1/admin/users/incomplete-profiles?below=80", status: http.StatusOK, threshold: 80},
+		{name: "threshold out of range", target: "/api/v1/admin/users/incomplete-profiles?below=101", status: http.StatusBadRequest, threshold: -1},
+		{name: "threshold not a number", target: "/api/v1/admin/users/incomplete-profiles?below=most", status: http.StatusBadRequest, threshold: -1},
+		{name: "failure", target: "/api/v1/admin/users/incomplete-profiles", err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			h := NewAdminHandler(&fakeUserService{
+				incompleteProfiles: func(orgID uint, threshold int) (*service.IncompleteProfilesReport, error) {
+					called = true
+					if threshold != tt.threshold {
+						t.Errorf("threshold = %d, want %d", threshold, tt.threshold)
+					}
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &service.IncompleteProfilesReport{Threshold: 60, Users: []service.IncompleteProfile{{
+						UserWithProfile: testUserWithProfile(2),
+						Completeness:    service.ProfileCompleteness{Score: 20, Missing: []string{"bio"}, MissingRequired: []string{}},
+					}}}, nil
+				},
+			}, nil, nil, nil, nil, nil, testLogger())
+			admin := authtest.Admin(1)
+			w := serve(h.IncompleteProfiles, http.MethodGet, tt.target, "", &admin, "")
+			checkResponse(t, w, tt.status, "")
+			if called != (tt.threshold >= 0) {
+				t.Errorf("report built: %v", called)
+			}
+		})
+	}
+}
+
+func TestAdminHandlerPreviewUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		err      error
+		prefsErr error
+		status   int
+	}{
+		{name: "previewed", id: "2", status: http.StatusOK},
+		{name: "invalid id", id: "abc", status: http.StatusBadRequest},
+		{name: "user gone", id: "2", err: service.ErrUserNotFound, status: http.StatusNotFound},
+		{name: "profile failure", id: "2", err: errDatabase, status: http.StatusInternalServerError},
+		{name: "preferences failure", id: "2", prefsErr: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAdminHandler(&fakeUserService{
+				getProfile: func(userID uint) (*models.User, *models.UserProfile, error) {
+					if tt.err != nil {
+						return nil, nil, tt.err
+					}
+					return testUser(userID, "user"), &models.UserProfile{UserID: userID}, nil
+				},
+			}, nil, nil, nil, &fakeNotificationService{
+				preferences: func(userID uint) (*models.NotificationPreferences, error) {
+					if tt.prefsErr != nil {
+						return nil, tt.prefsErr
+					}
+					return &models.NotificationPreferences{UserID: userID}, nil
+				},
+			}, nil, testLogger())
+			admin := authtest.Admin(1)
+			w := serve(h.PreviewUser, http.MethodGet, "/api/v1/admin/users/"+tt.id+"/preview", "", &admin, tt.id)
+			body := checkResponse(t, w, tt.status, "")
+			if tt.status == http.StatusOK {
+				if _, ok := body["notifications"]; !ok {
+					t.Errorf("no notifications in %v", body)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminHandlerEraseUser(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		err    error
+		status int
+		mode   string
+	}{
+		{name: "configured policy", id: "2", status: http.StatusOK},
+		{name: "given mode", id: "2", body: `{"mode":"anonymize"}`, status: http.StatusOK, mode: "anonymize"},
+		{name: "unknown mode", id: "2", body: `{"mode":"shred"}`, status: http.StatusBadRequest},
+		{name: "invalid id", id: "0", status: http.StatusBadRequest},
+		{name: "user gone", id: "2", err: service.ErrUserNotFound, status: http.StatusNotFound},
+		{name: "failure", id: "2", err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAdminHandler(nil, &fakeErasureService{
+				erase: func(userID uint, mode string) (string, error) {
+					if mode != tt.mode {
+						t.Errorf("mode = %q, want %q", mode, tt.mode)
+					}
+					if mode == "" {
+						mode = "soft"
+					}
+					return mode, tt.err
+				},
+			}, nil, nil, nil, nil, testLogger())
+			admin := authtest.Admin(1)
+			w := serve(h.EraseUser, http.MethodDelete, "/api/v1/admin/users/"+tt.id, tt.body, &admin, tt.id)
+			checkResponse(t, w, tt.status, "")
+		})
+	}
+}
+
+func TestAdminHandlerListDeletedUsers(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{name: "listed", status: http.StatusOK},
+		{name: "failure", err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAdminHandler(&fakeUserService{
+				listDeleted: func() ([]models.User, error) {
+					return []models.User{*testUser(2, "user")}, tt.err
+				},
+			}, nil, nil, nil, nil, nil, testLogger())
+			admin := authtest.Admin(1)
+			w := serve(h.ListDeletedUsers, http.MethodGet, "/api/v1/admin/users/deleted", "", &admin, "")
+			checkResponse(t, w, tt.status, "")
+		})
+	}
+}
+
+func TestAdminHandlerRestoreAndPurgeUser(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		err    error
+		status int
+	}{
+		{name: "done", id: "2", status: http.StatusOK},
+		{name: "invalid id", id: "-1", status: http.StatusBadRequest},
+		{name: "user gone", id: "2", err: service.ErrUserNotFound, status: http.StatusNotFound},
+		{name: "not deleted", id: "2", err: service.ErrUserNotDeleted, status: http.StatusConflict},
+		{name: "failure", id: "2", err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		h := NewAdminHandler(&fakeUserService{
+			restore: func(userID, adminID uint) (*models.User, error) {
+				return testUser(userID, "user"), tt.err
+			},
+		}, &fakeErasureService{
+			purge: func(userID uint) error {
+				return tt.err
+			},
+		}, nil, nil, nil, nil, testLogger())
+		admin := authtest.Admin(1)
+		t.Run("restore "+tt.name, func(t *testing.T) {
+			w := serve(h.RestoreUser, http.MethodPost, "/api/v1/admin/users/"+tt.id+"/restore", "", &admin, tt.id)
+			checkResponse(t, w, tt.status, "")
+		})
+		t.Run("purge "+tt.name, func(t *testing.T) {
+			w := serve(h.PurgeUser, http.MethodDelete, "/api/v1/admin/users/"+tt.id+"/purge", "", &admin, tt.id)
+			checkResponse(t, w, tt.status, "")
+		})
+	}
+}
+
+func TestAdminHandlerSendPasswordReset(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		err      error
+		external bool
+		resetErr error
+		status   int
+	}{
+		{name: "sent", id: "2", status: http.StatusOK},
+		{name: "invalid id", id: "x", status: http.StatusBadRequest},
+		{name: "user gone", id: "2", err: service.ErrUserNotFound, status: http.StatusNotFound},
+		{name: "lookup failure", id: "2", err: errDatabase, status: http.StatusInternalServerError},
+		{name: "external password", id: "2", external: true, status: http.StatusConflict},
+		{name: "send failure", id: "2", resetErr: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAdminHandler(&fakeUserService{
+				getProfile: func(userID uint) (*models.User, *models.UserProfile, error) {
+					if tt.err != nil {
+						return nil, nil, tt.err
+					}
+					user := testUser(userID, "user")
+					if tt.external {
+						user.AuthSource = models.AuthSourceLDAP
+					}
+					return user, &models.UserProfile{UserID: userID}, nil
+				},
+			}, nil, nil, nil, nil, &fakeResetService{
+				request: func(email string, client service.ClientInfo) error {
+					if email != "ada@example.com" {
+						t.Errorf("email = %q", email)
+					}
+					return tt.resetErr
+				},
+			}, testLogger())
+			admin := authtest.Admin(1)
+			w := serve(h.SendPasswordReset, http.MethodPost, "/api/v1/admin/users/"+tt.id+"/password-reset", "", &admin, tt.id)
+			checkResponse(t, w, tt.status, "")
+		})
+	}
+}
+
+func TestAdminHandlerRevokeSessions(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		err    error
+		status int
+		notify bool
+	}{
+		{name: "revoked", id: "2", status: http.StatusOK},
+		{name: "revoked with notice", id: "2", body: `{"notify":true}`, status: http.StatusOK, notify: true},
+		{name: "malformed body", id: "2", body: `{"notify":"yes"}`, status: http.StatusBadRequest},
+		{name: "invalid id", id: "0", status: http.StatusBadRequest},
+		{name: "user gone", id: "2", err: service.ErrUserNotFound, status: http.StatusNotFound},
+		{name: "failure", id: "2", err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAdminHandler(&fakeUserService{
+				revokeAllSessions: func(userID, adminID uint, notify bool) (int, error) {
+					if notify != tt.notify {
+						t.Errorf("notify = %v, want %v", notify, tt.notify)
+					}
+					return 3, tt.err
+				},
+			}, nil, nil, nil, nil, nil, testLogger())
+			admin := authtest.Admin(1)
+			w := serve(h.RevokeSessions, http.MethodPost, "/api/v1/admin/users/"+tt.id+"/revoke-sessions", tt.body, &admin, tt.id)
+			body := checkResponse(t, w, tt.status, "")
+			if tt.status == http.StatusOK && body["revokedSessions"] != float64(3) {
+				t.Errorf("revokedSessions = %v", body["revokedSessions"])
+			}
+		})
+	}
+}
+
+func TestAdminHandlerSuspendUser(t *testing.T) {
+	valid := `{"reason":"Repeated spam reports"}`
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		err    error
+		status int
+	}{
+		{name: "suspended", id: "2", body: valid, status: http.StatusOK},
+		{name: "banned", id: "2", body: `{"ban":true,"reason":"Fraud"}`, status: http.StatusOK},
+		{name: "missing reason", id: "2", body: `{"ban":true}`, status: http.StatusBadRequest},
+		{name: "invalid id", id: "x", body: valid, status: http.StatusBadRequest},
+		{name: "invalid suspension", id: "2", body: valid, err: service.ErrInvalidSuspension, status: http.StatusBadRequest},
+		{name: "user gone", id: "2", body: valid, err: service.ErrUserNotFound, status: http.StatusNotFound},
+		{name: "failure", id: "2", body: valid, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAdminHandler(&fakeUserService{
+				suspend: func(userID, adminID uint, input service.SuspendInput) (*models.User, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					user := testUser(userID, "user")
+					user.Status = models.UserStatusSuspended
+					if input.Ban {
+						user.Status = models.UserStatusBanned
+					}
+					user.SuspensionReason = input.Reason
+					return user, nil
+				},
+			}, nil, nil, nil, nil, nil, testLogger())
+			admin := authtest.Admin(1)
+			w := serve(h.SuspendUser, http.MethodPost, "/api/v1/admin/users/"+tt.id+"/suspend", tt.body, &admin, tt.id)
+			body := checkResponse(t, w, tt.status, "")
+			if tt.status == http.StatusOK && !strings.Contains(tt.body, `"reason":"`+body["suspensionReason"].(string)+`"`) {
+				t.Errorf("suspensionReason = %v", body["suspensionReason"])
+			}
+		})
+	}
+}
+
+func TestAdminHandlerReinstateUser(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		err    error
+		status int
+	}{
+		{name: "reinstated", id: "2", status: http.StatusOK},
+		{name: "invalid id", id: "x", status: http.StatusBadRequest},
+		{name: "user gone", id: "2", err: service.ErrUserNotFound, status: http.StatusNotFound},
+		{name: "failure", id: "2", err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAdminHandler(&fakeUserService{
+				reinstate: func(userID, adminID uint) (*models.User, error) {
+					return testUser(userID, "user"), tt.err
+				},
+			}, nil, nil, nil, nil, nil, testLogger())
+			admin := authtest.Admin(1)
+			w := serve(h.ReinstateUser, http.MethodPost, "/api/v1/admin/users/"+tt.id+"/reinstate", "", &admin, tt.id)
+			body := checkResponse(t, w, tt.status, "")
+			if tt.status == http.StatusOK && body["status"] != models.UserStatusActive {
+				t.Errorf("status = %v", body["status"])
+			}
+		})
+	}
+}
+
+func TestAdminHandlerChangeUserRole(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		err    error
+		status int
+	}{
+		{name: "changed", id: "2", body: `{"role":"admin"}`, status: http.StatusOK},
+		{name: "unknown role", id: "2", body: `{"role":"owner"}`, status: http.StatusBadRequest},
+		{name: "invalid id", id: "x", body: `{"role":"admin"}`, status: http.StatusBadRequest},
+		{name: "user gone", id: "2", body: `{"role":"admin"}`, err: service.ErrUserNotFound, status: http.StatusNotFound},
+		{name: "failure", id: "2", body: `{"role":"admin"}`, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAdminHandler(&fakeUserService{
+				changeRole: func(userID uint, role string) (*models.User, error) {
+					return testUser(userID, role), tt.err
+				},
+			}, nil, nil, nil, nil, nil, testLogger())
+			admin := authtest.Admin(1)
+			w := serve(h.ChangeUserRole, http.MethodPut, "/api/v1/admin/users/"+tt.id+"/role", tt.body, &admin, tt.id)
+			body := checkResponse(t, w, tt.status, "")
+			if tt.status == http.StatusOK {
+				if user, _ := body["user"].(map[string]interface{}); user["role"] != "admin" {
+					t.Errorf("user = %v", body["user"])
+				}
+			}
+		})
+	}
+}
+
+func TestAdminHandlerBulkUpdateUsers(t *testing.T) {
+	valid := `{"action":"role","userIds":[2,3],"role":"admin"}`
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{name: "applied", body: valid, status: http.StatusOK},
+		{name: "suspension", body: `{"action":"suspend","userIds":[2],"suspension":{"reason":"Spam"}}`, status: http.StatusOK},
+		{name: "role missing", body: `{"action":"role","userIds":[2]}`, status: http.StatusBadRequest},
+		{name: "no users", body: `{"action":"verify_email","userIds":[]}`, status: http.StatusBadRequest},
+		{name: "unknown action", body: `{"action":"promote","userIds":[2]}`, status: http.StatusBadRequest},
+		{name: "rejected", body: valid, err: service.ErrInvalidBulkRequest, status: http.StatusBadRequest},
+		{name: "failure", body: valid, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAdminHandler(nil, nil, &fakeBulkService{
+				apply: func(adminID uint, request service.BulkRequest) ([]service.BulkResult, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					results := make([]service.BulkResult, len(request.UserIDs))
+					for i, id := range request.UserIDs {
+						results[i] = service.BulkResult{UserID: id, Success: i == 0}
+						if i > 0 {
+							results[i].Error = "user not found"
+						}
+					}
+					return results, nil
+				},
+			}, nil, nil, nil, testLogger())
+			admin := authtest.Admin(1)
+			w := serve(h.BulkUpdateUsers, http.MethodPost, "/api/v1/admin/users/bulk", tt.body, &admin, "")
+			body := checkResponse(t, w, tt.status, "")
+			if tt.name == "applied" && (body["succeeded"] != float64(1) || body["failed"] != float64(1)) {
+				t.Errorf("succeeded = %v, failed = %v", body["succeeded"], body["failed"])
+			}
+		})
+	}
+}
+
+func TestAdminHandlerPatchUser(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		contentType string
+		body        string
+		getErr      error
+		err         error
+		status      int
+		firstName   string
+	}{
+		{name: "merge patch", id: "2", contentType: "application/merge-patch+json", body: `{"profile":{"firstName":"Augusta"}}`, status: http.StatusOK, firstName: "Augusta"},
+		{name: "json patch", id: "2", contentType: "application/json-patch+json", body: `[{"op":"replace","path":"/profile/firstName","value":"Augusta"}]`, status: http.StatusOK, firstName: "Augusta"},
+		{name: "failed test", id: "2", contentType: "application/json-patch+json", body: `[{"op":"test","path":"/email","value":"other@example.com"}]`, status: http.StatusConflict},
+		{name: "protected path", id: "2", contentType: "application/json-patch+json", body: `[{"op":"remove","path":"/email"}]`, status: http.StatusBadRequest},
+		{name: "unknown path", id: "2", contentType: "application/merge-patch+json", body: `{"passwordHash":"x"}`, status: http.StatusBadRequest},
+		{name: "invalid document", id: "2", contentType: "application/merge-patch+json", body: `{"profile":`, status: http.StatusBadRequest},
+		{name: "invalid result", id: "2", contentType: "application/merge-patch+json", body: `{"email":"not an email"}`, status: http.StatusBadRequest},
+		{name: "unsupported format", id: "2", contentType: "text/plain", body: `firstName=Augusta`, status: http.StatusUnsupportedMediaType},
+		{name: "invalid id", id: "x", contentType: "application/merge-patch+json", body: `{}`, status: http.StatusBadRequest},
+		{name: "user gone", id: "2", contentType: "application/merge-patch+json", body: `{}`, getErr: service.ErrUserNotFound, status: http.StatusNotFound},
+		{name: "lookup failure", id: "2", contentType: "application/merge-patch+json", body: `{}`, getErr: errDatabase, status: http.StatusInternalServerError},
+		{name: "email taken", id: "2", contentType: "application/merge-patch+json", body: `{"email":"grace@example.com"}`, err: service.ErrEmailTaken, status: http.StatusConflict},
+		{name: "unsupported locale", id: "2", contentType: "application/merge-patch+json", body: `{"profile":{"locale":"tlh"}}`, err: service.ErrUnsupportedLocale, status: http.StatusBadRequest},
+		{name: "unknown timezone", id: "2", contentType: "application/merge-patch+json", body: `{"profile":{"timezone":"Mars/Olympus"}}`, err: service.ErrInvalidTimezone, status: http.StatusBadRequest},
+		{name: "update failure", id: "2", contentType: "application/merge-patch+json", body: `{}`, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAdminHandler(&fakeUserService{
+				getProfile: func(userID uint) (*models.User, *models.UserProfile, error) {
+					if tt.getErr != nil {
+						return nil, nil, tt.getErr
+					}
+					return testUser(userID, "user"), &models.UserProfile{UserID: userID, FirstName: "Ada"}, nil
+				},
+				updateUser: func(userID uint, update service.UserUpdate) (*service.UserWithProfile, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					updated := testUserWithProfile(userID)
+					updated.Profile.FirstName = update.Profile.FirstName
+					return &updated, nil
+				},
+			}, nil, nil, nil, nil, nil, testLogger())
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/admin/users/"+tt.id, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			admin := authtest.Admin(1)
+			c, w := authtest.Context(req, &admin)
+			c.Params = []gin.Param{{Key: "id", Value: tt.id}}
+			h.PatchUser(c)
+			body := checkResponse(t, w, tt.status, "")
+			if tt.firstName != "" {
+				if profile, _ := body["profile"].(map[string]interface{}); profile["firstName"] != tt.firstName {
+					t.Errorf("profile = %v", body["profile"])
+				}
+			}
+		})
+	}
+}
+
+func TestAllowUserPatch(t *testing.T) {
+	tests := []struct {
+		op, path string
+		allowed  bool
+	}{
+		{"replace", "/email", true},
+		{"remove", "/email", false},
+		{"remove", "/profile/bio", true},
+		{"replace", "/profile/visibility/pronouns", true},
+		{"remove", "/profile/visibility/pronouns", false},
+		{"replace", "/profile/visibility/shoeSize", false},
+		{"replace", "/passwordHash", false},
+	}
+	for _, tt := range tests {
+		if err := allowUserPatch(tt.op, tt.path); (err == nil) != tt.allowed {
+			t.Errorf("allowUserPatch(%s, %s) = %v, want allowed %v", tt.op, tt.path, err, tt.allowed)
+		}
+	}
+}
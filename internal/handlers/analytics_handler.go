@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"api/internal/service"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// maxAnalyticsDays bounds the date range of one analytics request
+const maxAnalyticsDays = 366
+
+type AnalyticsHandler struct {
+	analytics service.AnalyticsService
+	logger    *logrus.Logger
+}
+
+func NewAnalyticsHandler(analytics service.AnalyticsService, logger *logrus.Logger) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		analytics: analytics,
+		logger:    logger,
+	}
+}
+
+// GetAnalytics godoc
+// @Summary User growth and retention analytics
+// @Description Daily active users, weekly active users (the seven days ending each day), signups, deletions and total accounts per UTC day, and the weekly retention of signup cohorts: of the users who signed up in a week (starting Monday), how many signed in each following week. Active users are derived from sign-ins. Figures are aggregated hourly by the analytics.aggregate job, so the current day is incomplete. With format=csv one table is downloaded instead, daily or cohorts (admin only).
+// @Tags admin
+// @Produce json
+// @Produce text/csv
+// @Security Bearer
+// @Param from query string false "First day, YYYY-MM-DD (default 29 days before to)"
+// @Param to query string false "Last day, YYYY-MM-DD (default today, UTC)"
+// @Param format query string false "json (default) or csv"
+// @Param table query string false "Table of the CSV export: daily (default) or cohorts"
+// @Success 200 {object} AnalyticsResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid date, range over 366 days, format or table"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/analytics [get]
+func (h *AnalyticsHandler) GetAnalytics(c *gin.Context) {
+	to := time.Now().UTC()
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date, YYYY-MM-DD"})
+			return
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 0, -29)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date, YYYY-MM-DD"})
+			return
+		}
+		from = parsed
+	}
+	if from.After(to) || to.Sub(from) >= maxAnalyticsDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("from must not be after to, and the range at most %d days", maxAnalyticsDays)})
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	table := c.DefaultQuery("table", service.AnalyticsTableDaily)
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, use json or csv"})
+		return
+	}
+	if table != service.AnalyticsTableDaily && table != service.AnalyticsTableCohorts {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid table, use daily or cohorts"})
+		return
+	}
+
+	report, err := h.analytics.Report(from, to)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to load analytics")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="analytics-%s-%s-%s.csv"`,
+			table, report.From.Format("20060102"), report.To.Format("20060102")))
+		c.Status(http.StatusOK)
+		if err := h.analytics.WriteCSV(c.Writer, report, table); err != nil {
+			h.logger.WithError(err).Error("Failed to write analytics CSV")
+		}
+		return
+	}
+
+	response := AnalyticsResponse{
+		From:    report.From.Format("2006-01-02"),
+		To:      report.To.Format("2006-01-02"),
+		Days:    make([]AnalyticsDayResponse, 0, len(report.Days)),
+		Cohorts: []AnalyticsCohortResponse{},
+	}
+	for _, d := range report.Days {
+		response.Days = append(response.Days, AnalyticsDayResponse{
+			Date:              d.Day.UTC().Format("2006-01-02"),
+			ActiveUsers:       d.ActiveUsers,
+			WeeklyActiveUsers: d.WeeklyActiveUsers,
+			Signups:           d.Signups,
+			Deletions:         d.Deletions,
+			TotalUsers:        d.TotalUsers,
+		})
+	}
+	// Cohorts come ordered by week, then offset
+	for _, cohort := range report.Cohorts {
+		week := cohort.CohortWeek.UTC().Format("2006-01-02")
+		last := len(response.Cohorts) - 1
+		if last < 0 || response.Cohorts[last].CohortWeek != week {
+			response.Cohorts = append(response.Cohorts, AnalyticsCohortResponse{CohortWeek: week, Size: cohort.Size})
+			last++
+		}
+		response.Cohorts[last].Retention = append(response.Cohorts[last].Retention, AnalyticsRetentionWeek{
+			WeekOffset: cohort.WeekOffset,
+			Retained:   cohort.Retained,
+			Rate:       service.RetentionRate(cohort),
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
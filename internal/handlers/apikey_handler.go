@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type APIKeyHandler struct {
+	keys   service.APIKeyService
+	logger *logrus.Logger
+}
+
+func NewAPIKeyHandler(keys service.APIKeyService, logger *logrus.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		keys:   keys,
+		logger: logger,
+	}
+}
+
+func apiKeyJSON(key *models.APIKey) gin.H {
+	return gin.H{
+		"id":            key.ID,
+		"name":          key.Name,
+		"prefix":        key.Prefix,
+		"scopes":        service.SplitScopes(key.Scopes),
+		"createdAt":     key.CreatedAt,
+		"expiresAt":     key.ExpiresAt,
+		"lastUsedAt":    key.LastUsedAt,
+		"suspended":     key.SuspendedAt != nil,
+		"suspendReason": key.SuspendReason,
+	}
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Create an API key for scripts and service integrations. The key is only returned once; send it in the X-API-Key header. Scopes: profile:read, profile:write, admin:users (the admin user routes) or admin (all admin routes), the admin ones for admins only. A scoped session can only create keys within its own scopes.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param key body CreateAPIKeyRequest true "API key details"
+// @Success 201 {object} CreateAPIKeyResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope, code: insufficient_scope"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var input struct {
+		Name          string   `json:"name" binding:"required,max=100"`
+		Scopes        []string `json:"scopes" binding:"required,min=1"`
+		ExpiresInDays int      `json:"expiresInDays" binding:"min=0,max=3650"`
+	}
+
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+	if !withinScopes(c, input.Scopes) {
+		return
+	}
+
+	var expiresAt *time.Time
+	if input.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	key, plaintext, err := h.keys.Create(userID, input.Name, input.Scopes, expiresAt)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidScope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to create API key")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	response := apiKeyJSON(key)
+	response["key"] = plaintext
+	c.JSON(http.StatusCreated, response)
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description List the authenticated user's API keys (without the secret part)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} APIKeysListResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/api-keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.keys.List(c.GetUint("userID"))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list API keys")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	list := make([]gin.H, 0, len(keys))
+	for i := range keys {
+		list = append(list, apiKeyJSON(&keys[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"apiKeys": list})
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Permanently revoke one of the authenticated user's API keys
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "API key ID"
+// @Success 200 {object} map[string]string "message: API key revoked"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 404 {object} map[string]string "error: API key not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.keys.Revoke(c.GetUint("userID"), id); err != nil {
+		if errors.Is(err, service.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to revoke API key")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
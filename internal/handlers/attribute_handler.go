@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type AttributeHandler struct {
+	attributes service.AttributeService
+	logger     *logrus.Logger
+}
+
+func NewAttributeHandler(attributes service.AttributeService, logger *logrus.Logger) *AttributeHandler {
+	return &AttributeHandler{
+		attributes: attributes,
+		logger:     logger,
+	}
+}
+
+func attributeDefinitionResponse(definition *models.AttributeDefinition) AttributeDefinitionResponse {
+	response := AttributeDefinitionResponse{
+		Key:         definition.Key,
+		Type:        definition.Type,
+		MaxLength:   definition.MaxLength,
+		UserAccess:  definition.UserAccess,
+		Description: definition.Description,
+		UpdatedAt:   definition.UpdatedAt.Format(time.RFC3339),
+	}
+	if definition.Options != "" {
+		response.Options = strings.Split(definition.Options, ",")
+	}
+	return response
+}
+
+// attributeError writes the response for the errors shared by the attribute endpoints;
+// false means err is unexpected
+func attributeError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrAttributeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attribute not found"})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, service.ErrInvalidAttributeDefinition), errors.Is(err, service.ErrInvalidAttribute):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAttributeReadOnly):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAttributeInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": "Attribute type cannot change while users have values"})
+	default:
+		return false
+	}
+	return true
+}
+
+// ListAttributes godoc
+// @Summary List custom attributes
+// @Description List the custom user attributes admins have defined (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} AttributeDefinitionListResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/attributes [get]
+func (h *AttributeHandler) ListAttributes(c *gin.Context) {
+	definitions, err := h.attributes.ListDefinitions()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list attribute definitions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attributes"})
+		return
+	}
+
+	response := AttributeDefinitionListResponse{Attributes: make([]AttributeDefinitionResponse, 0, len(definitions))}
+	for i := range definitions {
+		response.Attributes = append(response.Attributes, attributeDefinitionResponse(&definitions[i]))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DefineAttribute godoc
+// @Summary Define a custom attribute
+// @Description Create or update a custom user attribute. Values are checked against the type: string (up to maxLength characters), number, boolean or enum (one of options). userAccess controls the user's own access through /users/profile/attributes: none (admins only, the default), read or write. The type cannot change while users have values (admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param key path string true "Attribute key: letters, digits and _, starting with a letter"
+// @Param attribute body AttributeDefinitionRequest true "Definition"
+// @Success 200 {object} AttributeDefinitionResponse
+// @Success 201 {object} AttributeDefinitionResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error or invalid definition"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 409 {object} map[string]string "error: Attribute type cannot change while users have values"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/attributes/{key} [put]
+func (h *AttributeHandler) DefineAttribute(c *gin.Context) {
+	var input AttributeDefinitionRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	definition, created, err := h.attributes.Define(c.Param("key"), service.AttributeDefinitionInput{
+		Type:        input.Type,
+		Options:     input.Options,
+		MaxLength:   input.MaxLength,
+		UserAccess:  input.UserAccess,
+		Description: input.Description,
+	})
+	if err != nil {
+		if attributeError(c, err) {
+			return
+		}
+		h.logger.WithError(err).Error("Failed to save attribute definition")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attribute"})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, attributeDefinitionResponse(definition))
+}
+
+// DeleteAttribute godoc
+// @Summary Delete a custom attribute
+// @Description Delete a custom user attribute and every user's value of it (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param key path string true "Attribute key"
+// @Success 200 {object} map[string]string "message: Attribute deleted"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: Attribute not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/attributes/{key} [delete]
+func (h *AttributeHandler) DeleteAttribute(c *gin.Context) {
+	if err := h.attributes.Delete(c.Param("key")); err != nil {
+		if attributeError(c, err) {
+			return
+		}
+		h.logger.WithError(err).Error("Failed to delete attribute definition")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attribute"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Attribute deleted"})
+}
+
+// GetUserAttributes godoc
+// @Summary Get a user's custom attributes
+// @Description Get every custom attribute value of a user (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Success 200 {object} UserAttributesResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/{id}/attributes [get]
+func (h *AttributeHandler) GetUserAttributes(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	h.getAttributes(c, userID, false)
+}
+
+// SetUserAttributes godoc
+// @Summary Set a user's custom attributes
+// @Description Set custom attribute values of a user; null removes a value and attributes left out are kept. Every value is checked before any is stored (admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Param attributes body UserAttributesRequest true "Values by key"
+// @Success 200 {object} UserAttributesResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid attribute value"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/{id}/attributes [put]
+func (h *AttributeHandler) SetUserAttributes(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	h.setAttributes(c, userID, false)
+}
+
+// GetOwnAttributes godoc
+// @Summary Get your custom attributes
+// @Description Get the custom attribute values of the authenticated user that they may read
+// @Tags users
+// @Produce json
+// @Security Bearer
+// @Security ApiKey
+// @Success 200 {object} UserAttributesResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/profile/attributes [get]
+func (h *AttributeHandler) GetOwnAttributes(c *gin.Context) {
+	h.getAttributes(c, c.GetUint("userID"), true)
+}
+
+// SetOwnAttributes godoc
+// @Summary Set your custom attributes
+// @Description Set custom attribute values of the authenticated user; only attributes defined with userAccess write may be changed. null removes a value and attributes left out are kept.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Security ApiKey
+// @Param attributes body UserAttributesRequest true "Values by key"
+// @Success 200 {object} UserAttributesResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid attribute value"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: attribute cannot be changed"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/profile/attributes [put]
+func (h *AttributeHandler) SetOwnAttributes(c *gin.Context) {
+	h.setAttributes(c, c.GetUint("userID"), true)
+}
+
+func (h *AttributeHandler) getAttributes(c *gin.Context, userID uint, self bool) {
+	values, err := h.attributes.Get(userID, self)
+	if err != nil {
+		if attributeError(c, err) {
+			return
+		}
+		h.logger.WithError(err).Error("Failed to fetch user attributes")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attributes"})
+		return
+	}
+	c.JSON(http.StatusOK, UserAttributesResponse{UserID: userID, Attributes: values})
+}
+
+func (h *AttributeHandler) setAttributes(c *gin.Context, userID uint, self bool) {
+	var input UserAttributesRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	values, err := h.attributes.Set(userID, c.GetUint("userID"), input.Attributes, self)
+	if err != nil {
+		if attributeError(c, err) {
+			return
+		}
+		h.logger.WithError(err).Error("Failed to save user attributes")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attributes"})
+		return
+	}
+	c.JSON(http.StatusOK, UserAttributesResponse{UserID: userID, Attributes: values})
+}
@@ -1,99 +1,108 @@
 package handlers
 
 import (
-	"api/internal/auth"
-	"api/internal/models"
+	"api/internal/service"
+	"api/internal/throttle"
+	"errors"
 	"net/http"
-	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jinzhu/gorm"
 	"github.com/sirupsen/logrus"
 )
 
 type AuthHandler struct {
-	db     *gorm.DB
-	logger *logrus.Logger
-	config *struct {
-		AccessSecret  string
-		RefreshSecret string
-		AccessExpiry  int
-		RefreshExpiry int
-	}
+	auth     service.AuthService
+	resets   service.PasswordResetService
+	accounts service.AccountService
+	throttle *throttle.Throttle // nil disables the delays
+	logger   *logrus.Logger
 }
 
-func NewAuthHandler(db *gorm.DB, logger *logrus.Logger, config *struct {
-	AccessSecret  string
-	RefreshSecret string
-	AccessExpiry  int
-	RefreshExpiry int
-}) *AuthHandler {
+func NewAuthHandler(auth service.AuthService, resets service.PasswordResetService, accounts service.AccountService, throttle *throttle.Throttle, logger *logrus.Logger) *AuthHandler {
 	return &AuthHandler{
-		db:     db,
-		logger: logger,
-		config: config,
+		auth:     auth,
+		resets:   resets,
+		accounts: accounts,
+		throttle: throttle,
+		logger:   logger,
+	}
+}
+
+// Actions throttled separately
+const (
+	throttleLogin        = "login"
+	throttleResetRequest = "password_reset"
+	throttleResetConfirm = "password_reset_confirm"
+)
+
+// wait holds the request back for the delay earned by recent failures of action for
+// account (empty for none) or the client IP. It returns false when the client went
+// away meanwhile. Throttle errors are logged and let the request through.
+//
+// The client IP is the connection's peer, or the client named by one of
+// server.trustedProxies: X-Forwarded-For from anyone else is ignored, so a client
+// cannot spread its failures over made-up addresses.
+func (h *AuthHandler) wait(c *gin.Context, action, account string) bool {
+	if h.throttle == nil {
+		return true
+	}
+	err := h.throttle.Wait(c.Request.Context(), action, account, c.ClientIP())
+	if err != nil && c.Request.Context().Err() != nil {
+		c.Abort()
+		return false
+	}
+	if err != nil {
+		h.logger.WithError(err).WithField("action", action).Warn("Throttle unavailable, request not delayed")
+	}
+	return true
+}
+
+// failed records a failure of action, lengthening the delay of the next attempts
+func (h *AuthHandler) failed(c *gin.Context, action, account string) {
+	if h.throttle == nil {
+		return
+	}
+	if err := h.throttle.Fail(c.Request.Context(), action, account, c.ClientIP()); err != nil {
+		h.logger.WithError(err).WithField("action", action).Warn("Failed to record throttled failure")
 	}
 }
 
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user with email, username and password
+// @Description Register a new user with email, username and password. With CAPTCHA enabled, the widget's response token is required.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param registration body RegisterRequest true "Registration Details"
+// @Param X-Captcha-Token header string false "CAPTCHA response token, when CAPTCHA is enabled"
 // @Success 201 {object} map[string]string "message: Registration successful"
-// @Failure 400 {object} map[string]string "error: Validation error message"
-// @Failure 409 {object} map[string]string "error: Email or username already exists"
+// @Failure 400 {object} map[string]interface{} "error: Validation error message; violations: password policy rules the password breaks"
+// @Failure 403 {object} map[string]string "error: CAPTCHA verification failed, code: captcha_required"
+// @Failure 409 {object} map[string]string "error: Email or username already taken, field: email or username"
 // @Failure 500 {object} map[string]string "error: Internal server error message"
+// @Failure 503 {object} map[string]string "error: Password breach check or CAPTCHA verification unavailable"
 // @Router /auth/register [post]
 func (h *AuthHandler) Register(c *gin.Context) {
 	var input struct {
 		Email    string `json:"email" binding:"required,email"`
-		Username string `json:"username" binding:"required,min=3"`
-		Password string `json:"password" binding:"required,min=8"`
-	}
-
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		Username string `json:"username" binding:"required,min=3,max=50,username"`
+		Password string `json:"password" binding:"required"`
 	}
 
-	// Check if email or username already exists
-	var existingUser models.User
-	if err := h.db.Where("email = ? OR username = ?", input.Email, input.Username).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "Email or username already exists"})
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
 		return
 	}
 
-	// Hash password
-	hashedPassword, err := auth.HashPassword(input.Password)
-	if err != nil {
-		h.logger.WithError(err).Error("Failed to hash password")
+	if _, err := h.auth.Register(input.Email, input.Username, input.Password, chosenLocale(c)); err != nil {
+		if userExists(c, err) || passwordRejected(c, err) {
+			return
+		}
+		h.logger.WithError(err).Error("Failed to register user")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process registration"})
 		return
 	}
 
-	user := models.User{
-		Email:        input.Email,
-		Username:     input.Username,
-		PasswordHash: hashedPassword,
-		Role:         "user",
-	}
-
-	if err := h.db.Create(&user).Error; err != nil {
-		h.logger.WithError(err).Error("Failed to create user")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
-		return
-	}
-
-	// Simulate email verification
-	h.logger.WithFields(logrus.Fields{
-		"email": user.Email,
-		"id":    user.ID,
-	}).Info("Verification email would be sent here")
-
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Registration successful. Please check your email for verification.",
 	})
@@ -101,15 +110,18 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 // Login godoc
 // @Summary Login user
-// @Description Authenticate user with email/username and password
+// @Description Authenticate user with email/username and password. With LDAP enabled the credentials are checked against the directory first, and directory users sign in with their directory login; accounts the directory does not know use their local password. A directory entry with the email of an account it is not bound to mails the account a link to confirm binding them and answers 403 with code link_confirmation_required. Signing in to a deactivated account mails a reactivation link and answers 403 with code account_deactivated; signing in to an account deleted within the grace period mails the link undoing the deletion and answers 403 with code account_pending_deletion. With device verification enabled, a sign-in from an unrecognized device (X-Device-ID header, or the user agent and Accept-Language/Accept-Encoding headers) mails a confirmation link and answers 403 with code device_confirmation_required. With CAPTCHA enabled, an address with repeated failed logins must send the widget's response token; until it does, logins answer 403 with code captcha_required. With throttling enabled, repeated failed logins for a login or from an address delay further attempts, doubling the delay with each failure.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param login body LoginRequest true "Login Credentials"
+// @Param X-Captcha-Token header string false "CAPTCHA response token, required after repeated failed logins"
 // @Success 200 {object} TokenResponse "Returns access_token, refresh_token and user details"
-// @Failure 400 {object} map[string]string "error: Validation error message"
+// @Failure 400 {object} map[string]interface{} "error: Validation error message"
 // @Failure 401 {object} map[string]string "error: Invalid credentials"
+// @Failure 403 {object} map[string]string "error: Account suspended, banned, deactivated or pending deletion, password expired, sign-in location refused, new device, unconfirmed directory link or CAPTCHA needed, code: account_suspended, account_banned, account_deactivated, account_pending_deletion, password_expired, country_blocked, impossible_travel, device_confirmation_required, link_confirmation_required or captcha_required"
 // @Failure 500 {object} map[string]string "error: Internal server error message"
+// @Failure 503 {object} map[string]string "error: CAPTCHA verification unavailable"
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var input struct {
@@ -117,63 +129,33 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		Password string `json:"password" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
 		return
 	}
 
-	var user models.User
-	if strings.Contains(input.Login, "@") {
-		if err := h.db.Where("email = ?", input.Login).First(&user).Error; err != nil {
+	if !h.wait(c, throttleLogin, input.Login) {
+		return
+	}
+	user, tokens, err := h.auth.Login(input.Login, input.Password, clientInfo(c))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			h.failed(c, throttleLogin, input.Login)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
 		}
-	} else {
-		if err := h.db.Where("username = ?", input.Login).First(&user).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		if accountBlocked(c, err) || passwordExpired(c, err) || loginLocationRejected(c, err) || deviceUnconfirmed(c, err) || linkUnconfirmed(c, err) {
 			return
 		}
-	}
-
-	if err := auth.ComparePasswords(user.PasswordHash, input.Password); err != nil {
-		h.logger.WithFields(logrus.Fields{
-			"user_id": user.ID,
-			"error":   err,
-		}).Warn("Failed login attempt")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
-		return
-	}
-
-	tokens, err := auth.GenerateTokenPair(
-		user.ID,
-		user.Role,
-		h.config.AccessSecret,
-		h.config.RefreshSecret,
-		h.config.AccessExpiry,
-		h.config.RefreshExpiry,
-	)
-	if err != nil {
-		h.logger.WithError(err).Error("Failed to generate tokens")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
-		return
-	}
-
-	// Store refresh token
-	refreshToken := models.RefreshToken{
-		UserID:    user.ID,
-		TokenHash: tokens.RefreshToken, // In production, hash this before storing
-		ExpiresAt: time.Now().Add(time.Hour * 24 * time.Duration(h.config.RefreshExpiry)),
-	}
-
-	if err := h.db.Create(&refreshToken).Error; err != nil {
-		h.logger.WithError(err).Error("Failed to store refresh token")
+		h.logger.WithError(err).Error("Failed to complete login")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete login"})
 		return
 	}
-
-	h.logger.WithFields(logrus.Fields{
-		"user_id": user.ID,
-	}).Info("Successful login")
+	if h.throttle != nil {
+		if err := h.throttle.Reset(c.Request.Context(), throttleLogin, input.Login); err != nil {
+			h.logger.WithError(err).Warn("Failed to reset login throttle")
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"access_token":  tokens.AccessToken,
@@ -189,14 +171,15 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 // RefreshToken godoc
 // @Summary Refresh access token
-// @Description Get new access token using refresh token
+// @Description Exchange a refresh token for a new token pair. Each refresh token can be used once; presenting an already rotated token revokes every session issued from the same login. With device binding enabled, a token presented by another device than the one it was issued to is refused.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param refresh body RefreshTokenRequest true "Refresh Token"
 // @Success 200 {object} TokenPairResponse
-// @Failure 400 {object} map[string]string "error: Validation error message"
-// @Failure 401 {object} map[string]string "error: Invalid refresh token"
+// @Failure 400 {object} map[string]interface{} "error: Validation error message"
+// @Failure 401 {object} map[string]string "error: Invalid refresh token or reuse detected"
+// @Failure 403 {object} map[string]string "error: Account suspended or banned or password expired, code: account_suspended, account_banned or password_expired"
 // @Failure 500 {object} map[string]string "error: Internal server error message"
 // @Router /auth/refresh [post]
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
@@ -204,81 +187,101 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		RefreshToken string `json:"refresh_token" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
 		return
 	}
 
-	// Validate refresh token
-	userID, err := auth.ValidateRefreshToken(input.RefreshToken, h.config.RefreshSecret)
+	_, tokens, err := h.auth.Refresh(input.RefreshToken, clientInfo(c))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		if accountBlocked(c, err) || passwordExpired(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrInvalidRefreshToken):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		case errors.Is(err, service.ErrRefreshTokenReused):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, please log in again"})
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		default:
+			h.logger.WithError(err).Error("Failed to refresh tokens")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh tokens"})
+		}
 		return
 	}
 
-	// Check if token exists in database
-	var storedToken models.RefreshToken
-	if err := h.db.Where("token_hash = ? AND user_id = ?", input.RefreshToken, userID).First(&storedToken).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
-		return
-	}
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+	})
+}
 
-	// Get user details
-	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+// CreateScopedSession godoc
+// @Summary Create a scoped session
+// @Description Start a session whose access tokens only reach the routes of the given scopes, to hand to a third-party integration instead of a full login: profile:read, profile:write, account (credentials, sessions, devices, API keys and exports), organizations, admin:users (the admin user routes) or admin (all admin routes, admins only). The session is refreshed like any other, keeps its scopes on rotation, and is listed and revoked with the user's sessions. A scoped session can only create sessions within its own scopes.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param session body CreateScopedSessionRequest true "Scopes of the session"
+// @Success 201 {object} TokenPairResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error message or invalid scope"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error message"
+// @Router /users/sessions [post]
+func (h *AuthHandler) CreateScopedSession(c *gin.Context) {
+	var input CreateScopedSessionRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
 		return
 	}
-
-	// Generate new token pair
-	tokens, err := auth.GenerateTokenPair(
-		user.ID,
-		user.Role,
-		h.config.AccessSecret,
-		h.config.RefreshSecret,
-		h.config.AccessExpiry,
-		h.config.RefreshExpiry,
-	)
-	if err != nil {
-		h.logger.WithError(err).Error("Failed to generate new tokens")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh tokens"})
+	if !withinScopes(c, input.Scopes) {
 		return
 	}
 
-	// Update refresh token in database
-	if err := h.db.Delete(&storedToken).Error; err != nil {
-		h.logger.WithError(err).Error("Failed to delete old refresh token")
-	}
-
-	newRefreshToken := models.RefreshToken{
-		UserID:    user.ID,
-		TokenHash: tokens.RefreshToken,
-		ExpiresAt: time.Now().Add(time.Hour * 24 * time.Duration(h.config.RefreshExpiry)),
-	}
-
-	if err := h.db.Create(&newRefreshToken).Error; err != nil {
-		h.logger.WithError(err).Error("Failed to store new refresh token")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh tokens"})
+	user, tokens, err := h.auth.CreateScopedSession(c.GetUint("userID"), input.Scopes, clientInfo(c))
+	if err != nil {
+		if accountBlocked(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrInvalidScope):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		default:
+			h.logger.WithError(err).Error("Failed to create scoped session")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"access_token":  tokens.AccessToken,
-		"refresh_token": tokens.RefreshToken,
+	c.JSON(http.StatusCreated, TokenPairResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		User: UserResponse{
+			ID:       user.ID,
+			Email:    user.Email,
+			Username: user.Username,
+			Role:     user.Role,
+		},
 	})
 }
 
 // Logout godoc
 // @Summary Logout user
-// @Description Invalidate the refresh token and logout the user
+// @Description Invalidate the refresh token and revoke the access token used for the request
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Security Bearer
 // @Param logout body LogoutRequest true "Refresh Token"
 // @Success 200 {object} map[string]string "message: Successfully logged out"
-// @Failure 400 {object} map[string]string "error: Validation error message"
+// @Failure 400 {object} map[string]interface{} "error: Validation error message"
 // @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
 // @Failure 500 {object} map[string]string "error: Internal server error message"
 // @Router /auth/logout [post]
 func (h *AuthHandler) Logout(c *gin.Context) {
@@ -286,13 +289,13 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		RefreshToken string `json:"refresh_token" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
 		return
 	}
 
 	// Delete refresh token from database
-	if err := h.db.Where("token_hash = ?", input.RefreshToken).Delete(&models.RefreshToken{}).Error; err != nil {
+	if err := h.auth.Logout(input.RefreshToken, accessToken(c)); err != nil {
 		h.logger.WithError(err).Error("Failed to delete refresh token")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
 		return
@@ -300,3 +303,145 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Successfully logged out"})
 }
+
+// RequestPasswordReset godoc
+// @Summary Request a password reset
+// @Description Email a password reset link. The response is the same whether or not the address belongs to an account; the owner is told who asked and what to do if it wasn't them, and the attempt appears in their activity feed. With CAPTCHA enabled, the widget's response token is required. With throttling enabled, repeated requests for an address or from a client are answered after growing delays.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body PasswordResetRequest true "Account email"
+// @Param X-Captcha-Token header string false "CAPTCHA response token, when CAPTCHA is enabled"
+// @Success 200 {object} map[string]string "message: If the address belongs to an account, a reset link was sent"
+// @Failure 400 {object} map[string]interface{} "error: Validation error message"
+// @Failure 403 {object} map[string]string "error: CAPTCHA verification failed, code: captcha_required"
+// @Failure 503 {object} map[string]string "error: CAPTCHA verification unavailable"
+// @Router /auth/password-reset [post]
+func (h *AuthHandler) RequestPasswordReset(c *gin.Context) {
+	var input PasswordResetRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	// Every request counts, as the response does not tell whether a link was sent
+	if !h.wait(c, throttleResetRequest, input.Email) {
+		return
+	}
+	h.failed(c, throttleResetRequest, input.Email)
+
+	// Handled in the background so response timing does not reveal whether the account exists
+	client := clientInfo(c)
+	go func() {
+		if err := h.resets.Request(input.Email, client); err != nil {
+			h.logger.WithError(err).Error("Failed to process password reset request")
+		}
+	}()
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the address belongs to an account, a reset link was sent"})
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password with the token from a reset link. Every session of the account is ended. With throttling enabled, repeated invalid tokens from a client delay its further attempts.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param reset body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]string "message: Password reset successfully"
+// @Failure 400 {object} map[string]interface{} "error: Validation error or invalid token; violations: password policy rules the password breaks"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Failure 503 {object} map[string]string "error: Password breach check unavailable"
+// @Router /auth/password-reset/confirm [post]
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var input ResetPasswordRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	if !h.wait(c, throttleResetConfirm, "") {
+		return
+	}
+	if err := h.resets.Reset(input.Token, input.NewPassword, clientInfo(c)); err != nil {
+		if errors.Is(err, service.ErrInvalidResetToken) {
+			h.failed(c, throttleResetConfirm, "")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		if passwordRejected(c, err) {
+			return
+		}
+		h.logger.WithError(err).Error("Failed to reset password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
+// ConfirmEmailChange godoc
+// @Summary Confirm an email change
+// @Description Switch the account to the new email address with the token from the confirmation link sent to it. The new address counts as verified.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param confirmation body ConfirmEmailChangeRequest true "Confirmation token"
+// @Success 200 {object} map[string]string "message: Email address changed"
+// @Failure 400 {object} map[string]interface{} "error: Validation error or invalid token"
+// @Failure 409 {object} map[string]string "error: Email is already registered, field: email"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /auth/email-change/confirm [post]
+func (h *AuthHandler) ConfirmEmailChange(c *gin.Context) {
+	var input ConfirmEmailChangeRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	if _, err := h.accounts.ConfirmEmailChange(input.Token, clientInfo(c)); err != nil {
+		if errors.Is(err, service.ErrInvalidEmailChangeToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation token"})
+			return
+		}
+		if userExists(c, err) {
+			return
+		}
+		h.logger.WithError(err).Error("Failed to confirm email change")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email address changed"})
+}
+
+// ReactivateAccount godoc
+// @Summary Reactivate a deactivated account
+// @Description Make a deactivated account active again with the token from the reactivation link, which is mailed when its holder signs in. The token of the link undoing an account deletion, mailed on deletion and on sign-in during the grace period, restores that account the same way. Sign in again afterwards.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param reactivation body ReactivateAccountRequest true "Reactivation token"
+// @Success 200 {object} map[string]string "message: Account reactivated"
+// @Failure 400 {object} map[string]interface{} "error: Validation error or invalid token"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /auth/reactivate [post]
+func (h *AuthHandler) ReactivateAccount(c *gin.Context) {
+	var input ReactivateAccountRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	if _, err := h.accounts.Reactivate(input.Token, clientInfo(c)); err != nil {
+		if errors.Is(err, service.ErrInvalidReactivationToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reactivation token"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to reactivate account")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reactivate account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account reactivated, you can now log in"})
+}
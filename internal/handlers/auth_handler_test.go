@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"api/internal/auth"
+	"api/internal/middleware/authtest"
+	"api/internal/models"
+	"api/internal/service"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAuthHandlerRegister(t *testing.T) {
+	valid := `{"email":"ada@example.com","username":"ada","password":"Correct-Horse-42"}`
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+		field  string
+	}{
+		{name: "registered", body: valid, status: http.StatusCreated},
+		{name: "invalid email", body: `{"email":"ada","username":"ada","password":"x"}`, status: http.StatusBadRequest},
+		{name: "invalid username", body: `{"email":"ada@example.com","username":"a b","password":"x"}`, status: http.StatusBadRequest},
+		{name: "malformed body", body: `{"email":`, status: http.StatusBadRequest},
+		{name: "email taken", body: valid, err: service.ErrEmailTaken, status: http.StatusConflict, field: "email"},
+		{name: "username taken", body: valid, err: service.ErrUsernameTaken, status: http.StatusConflict, field: "username"},
+		{name: "password rejected", body: valid, err: &service.PasswordRejectedError{Violations: []auth.PasswordViolation{{Message: "too short"}}}, status: http.StatusBadRequest},
+		{name: "breach check unavailable", body: valid, err: service.ErrPasswordCheckUnavailable, status: http.StatusServiceUnavailable},
+		{name: "failure", body: valid, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAuthHandler(&fakeAuthService{
+				register: func(email, username, password, locale string) (*models.User, error) {
+					return testUser(1, "user"), tt.err
+				},
+			}, nil, nil, nil, testLogger())
+			w := serve(h.Register, http.MethodPost, "/api/v1/auth/register", tt.body, nil, "")
+			body := checkResponse(t, w, tt.status, "")
+			if tt.field != "" && body["field"] != tt.field {
+				t.Errorf("field = %v, want %s", body["field"], tt.field)
+			}
+		})
+	}
+}
+
+func TestAuthHandlerLogin(t *testing.T) {
+	valid := `{"login":"ada@example.com","password":"Correct-Horse-42"}`
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+		code   string
+	}{
+		{name: "signed in", body: valid, status: http.StatusOK},
+		{name: "missing password", body: `{"login":"ada@example.com"}`, status: http.StatusBadRequest},
+		{name: "invalid credentials", body: valid, err: service.ErrInvalidCredentials, status: http.StatusUnauthorized},
+		{name: "suspended", body: valid, err: &service.AccountBlockedError{Status: models.UserStatusSuspended}, status: http.StatusForbidden, code: "account_suspended"},
+		{name: "banned", body: valid, err: &service.AccountBlockedError{Status: models.UserStatusBanned}, status: http.StatusForbidden, code: "account_banned"},
+		{name: "deactivated", body: valid, err: service.ErrAccountDeactivated, status: http.StatusForbidden, code: "account_deactivated"},
+		{name: "pending deletion", body: valid, err: service.ErrAccountPendingDeletion, status: http.StatusForbidden, code: "account_pending_deletion"},
+		{name: "password expired", body: valid, err: service.ErrPasswordExpired, status: http.StatusForbidden, code: "password_expired"},
+		{name: "country blocked", body: valid, err: service.ErrLoginCountryBlocked, status: http.StatusForbidden, code: "country_blocked"},
+		{name: "impossible travel", body: valid, err: service.ErrImpossibleTravel, status: http.StatusForbidden, code: "impossible_travel"},
+		{name: "unrecognized device", body: valid, err: service.ErrDeviceConfirmationRequired, status: http.StatusForbidden, code: "device_confirmation_required"},
+		{name: "unconfirmed directory link", body: valid, err: service.ErrLinkConfirmationRequired, status: http.StatusForbidden, code: "link_confirmation_required"},
+		{name: "failure", body: valid, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAuthHandler(&fakeAuthService{
+				login: func(login, password string, client service.ClientInfo) (*models.User, *auth.TokenPair, error) {
+					if tt.err != nil {
+						return nil, nil, tt.err
+					}
+					return testUser(1, "user"), testTokens(), nil
+				},
+			}, nil, nil, nil, testLogger())
+			w := serve(h.Login, http.MethodPost, "/api/v1/auth/login", tt.body, nil, "")
+			body := checkResponse(t, w, tt.status, tt.code)
+			if tt.status != http.StatusOK {
+				return
+			}
+			if body["access_token"] != "access-token" || body["refresh_token"] != "refresh-token" {
+				t.Errorf("tokens = %v, %v", body["access_token"], body["refresh_token"])
+			}
+			if user, _ := body["user"].(map[string]interface{}); user["email"] != "ada@example.com" {
+				t.Errorf("user = %v", body["user"])
+			}
+		})
+	}
+}
+
+func TestAuthHandlerRefreshToken(t *testing.T) {
+	valid := `{"refresh_token":"refresh-token"}`
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+		code   string
+	}{
+		{name: "refreshed", body: valid, status: http.StatusOK},
+		{name: "missing token", body: `{}`, status: http.StatusBadRequest},
+		{name: "invalid token", body: valid, err: service.ErrInvalidRefreshToken, status: http.StatusUnauthorized},
+		{name: "reused token", body: valid, err: service.ErrRefreshTokenReused, status: http.StatusUnauthorized},
+		{name: "user gone", body: valid, err: service.ErrUserNotFound, status: http.StatusUnauthorized},
+		{name: "suspended", body: valid, err: &service.AccountBlockedError{Status: models.UserStatusSuspended}, status: http.StatusForbidden, code: "account_suspended"},
+		{name: "password expired", body: valid, err: service.ErrPasswordExpired, status: http.StatusForbidden, code: "password_expired"},
+		{name: "failure", body: valid, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAuthHandler(&fakeAuthService{
+				refresh: func(refreshToken string, client service.ClientInfo) (*models.User, *auth.TokenPair, error) {
+					if tt.err != nil {
+						return nil, nil, tt.err
+					}
+					return testUser(1, "user"), testTokens(), nil
+				},
+			}, nil, nil, nil, testLogger())
+			w := serve(h.RefreshToken, http.MethodPost, "/api/v1/auth/refresh", tt.body, nil, "")
+			body := checkResponse(t, w, tt.status, tt.code)
+			if tt.status == http.StatusOK && body["refresh_token"] != "refresh-token" {
+				t.Errorf("refresh_token = %v", body["refresh_token"])
+			}
+		})
+	}
+}
+
+func TestAuthHandlerCreateScopedSession(t *testing.T) {
+	user := authtest.User(1)
+	scoped := authtest.User(1).WithScopes("profile:read")
+	tests := []struct {
+		name     string
+		identity *authtest.Identity
+		body     string
+		err      error
+		status   int
+		code     string
+	}{
+		{name: "created", identity: &user, body: `{"scopes":["profile:read"]}`, status: http.StatusCreated},
+		{name: "no scopes", identity: &user, body: `{"scopes":[]}`, status: http.StatusBadRequest},
+		{name: "beyond own scopes", identity: &scoped, body: `{"scopes":["account"]}`, status: http.StatusForbidden, code: "insufficient_scope"},
+		{name: "within own scopes", identity: &scoped, body: `{"scopes":["profile:read"]}`, status: http.StatusCreated},
+		{name: "unknown scope", identity: &user, body: `{"scopes":["everything"]}`, err: service.ErrInvalidScope, status: http.StatusBadRequest},
+		{name: "user gone", identity: &user, body: `{"scopes":["profile:read"]}`, err: service.ErrUserNotFound, status: http.StatusUnauthorized},
+		{name: "banned", identity: &user, body: `{"scopes":["profile:read"]}`, err: &service.AccountBlockedError{Status: models.UserStatusBanned}, status: http.StatusForbidden, code: "account_banned"},
+		{name: "failure", identity: &user, body: `{"scopes":["profile:read"]}`, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAuthHandler(&fakeAuthService{
+				createScopedSession: func(userID uint, scopes []string, client service.ClientInfo) (*models.User, *auth.TokenPair, error) {
+					if userID != tt.identity.UserID {
+						t.Errorf("userID = %d, want %d", userID, tt.identity.UserID)
+					}
+					if tt.err != nil {
+						return nil, nil, tt.err
+					}
+					return testUser(userID, "user"), testTokens(), nil
+				},
+			}, nil, nil, nil, testLogger())
+			w := serve(h.CreateScopedSession, http.MethodPost, "/api/v1/users/sessions", tt.body, tt.identity, "")
+			checkResponse(t, w, tt.status, tt.code)
+		})
+	}
+}
+
+func TestAuthHandlerLogout(t *testing.T) {
+	identity := authtest.User(1)
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{name: "signed out", body: `{"refresh_token":"refresh-token"}`, status: http.StatusOK},
+		{name: "missing token", body: `{}`, status: http.StatusBadRequest},
+		{name: "failure", body: `{"refresh_token":"refresh-token"}`, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAuthHandler(&fakeAuthService{
+				logout: func(refreshToken string, access service.AccessToken) error {
+					if access.ID != identity.TokenID || access.UserID != identity.UserID {
+						t.Errorf("access token = %+v, want the one of the request", access)
+					}
+					return tt.err
+				},
+			}, nil, nil, nil, testLogger())
+			w := serve(h.Logout, http.MethodPost, "/api/v1/auth/logout", tt.body, &identity, "")
+			checkResponse(t, w, tt.status, "")
+		})
+	}
+}
+
+func TestAuthHandlerRequestPasswordReset(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+		sent   bool
+	}{
+		{name: "requested", body: `{"email":"ada@example.com"}`, status: http.StatusOK, sent: true},
+		// The response must not reveal that the request failed
+		{name: "failure hidden", body: `{"email":"ada@example.com"}`, err: errDatabase, status: http.StatusOK, sent: true},
+		{name: "invalid email", body: `{"email":"ada"}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requested := make(chan string, 1)
+			h := NewAuthHandler(nil, &fakeResetService{
+				request: func(email string, client service.ClientInfo) error {
+					requested <- email
+					return tt.err
+				},
+			}, nil, nil, testLogger())
+			w := serve(h.RequestPasswordReset, http.MethodPost, "/api/v1/auth/password-reset", tt.body, nil, "")
+			checkResponse(t, w, tt.status, "")
+			if !tt.sent {
+				return
+			}
+			select {
+			case email := <-requested:
+				if email != "ada@example.com" {
+					t.Errorf("email = %q", email)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("reset was not requested")
+			}
+		})
+	}
+}
+
+func TestAuthHandlerResetPassword(t *testing.T) {
+	valid := `{"token":"reset-token","newPassword":"Correct-Horse-42"}`
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{name: "reset", body: valid, status: http.StatusOK},
+		{name: "missing token", body: `{"newPassword":"Correct-Horse-42"}`, status: http.StatusBadRequest},
+		{name: "invalid token", body: valid, err: service.ErrInvalidResetToken, status: http.StatusBadRequest},
+		{name: "password rejected", body: valid, err: &service.PasswordRejectedError{Violations: []auth.PasswordViolation{{Message: "too short"}}}, status: http.StatusBadRequest},
+		{name: "breach check unavailable", body: valid, err: service.ErrPasswordCheckUnavailable, status: http.StatusServiceUnavailable},
+		{name: "failure", body: valid, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAuthHandler(nil, &fakeResetService{
+				reset: func(token, newPassword string, client service.ClientInfo) error {
+					return tt.err
+				},
+			}, nil, nil, testLogger())
+			w := serve(h.ResetPassword, http.MethodPost, "/api/v1/auth/password-reset/confirm", tt.body, nil, "")
+			checkResponse(t, w, tt.status, "")
+		})
+	}
+}
+
+func TestAuthHandlerConfirmEmailChange(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{name: "confirmed", body: `{"token":"change-token"}`, status: http.StatusOK},
+		{name: "missing token", body: `{}`, status: http.StatusBadRequest},
+		{name: "invalid token", body: `{"token":"change-token"}`, err: service.ErrInvalidEmailChangeToken, status: http.StatusBadRequest},
+		{name: "email taken", body: `{"token":"change-token"}`, err: service.ErrEmailTaken, status: http.StatusConflict},
+		{name: "failure", body: `{"token":"change-token"}`, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAuthHandler(nil, nil, &fakeAccountService{
+				confirmEmailChange: func(token string, client service.ClientInfo) (*models.User, error) {
+					return testUser(1, "user"), tt.err
+				},
+			}, nil, testLogger())
+			w := serve(h.ConfirmEmailChange, http.MethodPost, "/api/v1/auth/email-change/confirm", tt.body, nil, "")
+			checkResponse(t, w, tt.status, "")
+		})
+	}
+}
+
+func TestAuthHandlerReactivateAccount(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{name: "reactivated", body: `{"token":"reactivation-token"}`, status: http.StatusOK},
+		{name: "missing token", body: `{}`, status: http.StatusBadRequest},
+		{name: "invalid token", body: `{"token":"reactivation-token"}`, err: service.ErrInvalidReactivationToken, status: http.StatusBadRequest},
+		{name: "failure", body: `{"token":"reactivation-token"}`, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAuthHandler(nil, nil, &fakeAccountService{
+				reactivate: func(token string, client service.ClientInfo) (*models.User, error) {
+					return testUser(1, "user"), tt.err
+				},
+			}, nil, testLogger())
+			w := serve(h.ReactivateAccount, http.MethodPost, "/api/v1/auth/reactivate", tt.body, nil, "")
+			checkResponse(t, w, tt.status, "")
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"api/internal/logging"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type DebugLogHandler struct {
+	filter *logging.DebugFilter
+	logger *logrus.Logger
+}
+
+func NewDebugLogHandler(filter *logging.DebugFilter, logger *logrus.Logger) *DebugLogHandler {
+	return &DebugLogHandler{
+		filter: filter,
+		logger: logger,
+	}
+}
+
+// ListRules godoc
+// @Summary List debug logging rules
+// @Description List the users and request ID patterns currently logged at debug level (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} DebugRuleListResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Security ApiKey
+// @Router /admin/debug-logging [get]
+func (h *DebugLogHandler) ListRules(c *gin.Context) {
+	rules := h.filter.Rules()
+	response := DebugRuleListResponse{Rules: make([]DebugRuleResponse, 0, len(rules))}
+	for _, rule := range rules {
+		response.Rules = append(response.Rules, debugRuleResponse(rule))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateRule godoc
+// @Summary Enable debug logging for a user or requests
+// @Description Log at debug level for one user, for requests whose X-Request-ID matches a pattern, or for both combined, until the rule expires. The rest of the log stays at the configured level. Rules are kept in memory by the instance that receives the request (admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param rule body CreateDebugRuleRequest true "Who to log and for how long"
+// @Success 201 {object} DebugRuleResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Security ApiKey
+// @Router /admin/debug-logging [post]
+func (h *DebugLogHandler) CreateRule(c *gin.Context) {
+	var input CreateDebugRuleRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	rule, err := h.filter.Add(logging.DebugRule{
+		UserID:           input.UserID,
+		RequestIDPattern: input.RequestIDPattern,
+		CreatedBy:        c.GetUint("userID"),
+	}, time.Duration(input.DurationMinutes)*time.Minute)
+	if err != nil {
+		if errors.Is(err, logging.ErrInvalidDebugRule) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Provide a user ID or a valid request ID pattern"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to enable debug logging")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable debug logging"})
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"rule_id":            rule.ID,
+		"debug_user_id":      rule.UserID,
+		"request_id_pattern": rule.RequestIDPattern,
+		"admin_id":           rule.CreatedBy,
+		"expires_at":         rule.ExpiresAt,
+	}).Warn("Debug logging enabled")
+	c.JSON(http.StatusCreated, debugRuleResponse(rule))
+}
+
+// DeleteRule godoc
+// @Summary Disable a debug logging rule
+// @Description Stop debug logging for a rule before it expires (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Rule ID"
+// @Success 200 {object} map[string]string "message: Debug logging disabled"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: Rule not found"
+// @Security ApiKey
+// @Router /admin/debug-logging/{id} [delete]
+func (h *DebugLogHandler) DeleteRule(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if !h.filter.Remove(id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"rule_id":  id,
+		"admin_id": c.GetUint("userID"),
+	}).Warn("Debug logging disabled")
+	c.JSON(http.StatusOK, gin.H{"message": "Debug logging disabled"})
+}
+
+func debugRuleResponse(rule logging.DebugRule) DebugRuleResponse {
+	return DebugRuleResponse{
+		ID:               rule.ID,
+		UserID:           rule.UserID,
+		RequestIDPattern: rule.RequestIDPattern,
+		CreatedBy:        rule.CreatedBy,
+		ExpiresAt:        rule.ExpiresAt,
+	}
+}
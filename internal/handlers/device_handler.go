@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"api/internal/service"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type DeviceHandler struct {
+	devices service.DeviceService
+	logger  *logrus.Logger
+}
+
+func NewDeviceHandler(devices service.DeviceService, logger *logrus.Logger) *DeviceHandler {
+	return &DeviceHandler{
+		devices: devices,
+		logger:  logger,
+	}
+}
+
+// ListDevices godoc
+// @Summary List trusted devices
+// @Description List the devices the authenticated user signed in from and confirmed, most recently seen first. current marks the device of this request.
+// @Tags users
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} TrustedDevicesListResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/devices [get]
+func (h *DeviceHandler) ListDevices(c *gin.Context) {
+	devices, err := h.devices.List(c.GetUint("userID"))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list trusted devices")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch devices"})
+		return
+	}
+
+	current := deviceFingerprint(c)
+	response := TrustedDevicesListResponse{Devices: make([]TrustedDeviceResponse, 0, len(devices))}
+	for _, d := range devices {
+		response.Devices = append(response.Devices, TrustedDeviceResponse{
+			ID:         d.ID,
+			UserAgent:  d.UserAgent,
+			IPAddress:  d.IPAddress,
+			CreatedAt:  localTime(c, d.CreatedAt).Format(time.RFC3339),
+			LastSeenAt: localTime(c, d.LastSeenAt).Format(time.RFC3339),
+			Current:    d.Fingerprint == current,
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeDevice godoc
+// @Summary Revoke a trusted device
+// @Description Forget a trusted device. Its sessions are not ended; revoke them separately. Signing in from it again needs confirmation when device verification is enabled.
+// @Tags users
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Device ID"
+// @Success 200 {object} map[string]string "message: Device revoked"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 404 {object} map[string]string "error: Device not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/devices/{id} [delete]
+func (h *DeviceHandler) RevokeDevice(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.devices.Revoke(c.GetUint("userID"), id, clientInfo(c)); err != nil {
+		if errors.Is(err, service.ErrDeviceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to revoke trusted device")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke device"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device revoked"})
+}
+
+// ConfirmDevice godoc
+// @Summary Confirm a new device
+// @Description Trust the device of a sign-in that was held back, with the token from the link mailed for it. The link may be opened on any device; log in again from the confirmed one afterwards.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param confirmation body ConfirmDeviceRequest true "Confirmation token"
+// @Success 200 {object} map[string]string "message: Device confirmed"
+// @Failure 400 {object} map[string]interface{} "error: Validation error or invalid token"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /auth/devices/confirm [post]
+func (h *DeviceHandler) ConfirmDevice(c *gin.Context) {
+	var input ConfirmDeviceRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	if _, err := h.devices.Confirm(input.Token, clientInfo(c)); err != nil {
+		if errors.Is(err, service.ErrInvalidDeviceToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation token"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to confirm device")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm device"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device confirmed, you can now log in"})
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type DSARHandler struct {
+	dsar   service.DSARService
+	logger *logrus.Logger
+}
+
+func NewDSARHandler(dsar service.DSARService, logger *logrus.Logger) *DSARHandler {
+	return &DSARHandler{
+		dsar:   dsar,
+		logger: logger,
+	}
+}
+
+func dsarResponse(request *models.DSARRequest) gin.H {
+	return gin.H{
+		"id":              request.ID,
+		"subjectUserId":   request.SubjectUserID,
+		"type":            request.Type,
+		"status":          request.Status,
+		"openedById":      request.OpenedByID,
+		"receivedAt":      request.ReceivedAt,
+		"dueAt":           request.DueAt,
+		"overdue":         request.Status != models.DSARClosed && time.Now().After(request.DueAt),
+		"notes":           request.Notes,
+		"exportId":        request.ExportJobID,
+		"disposition":     request.Disposition,
+		"dispositionNote": request.DispositionNote,
+		"closedAt":        request.ClosedAt,
+	}
+}
+
+// dsarError writes the response for errors shared by the DSAR endpoints
+func (h *DSARHandler) dsarError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, service.ErrDSARNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "DSAR request not found"})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, service.ErrDSARClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": "DSAR request is closed"})
+	case errors.Is(err, service.ErrInvalidDSARType),
+		errors.Is(err, service.ErrInvalidDSARDisposition),
+		errors.Is(err, service.ErrInvalidDSARExtension):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrDSARNoPackage), errors.Is(err, service.ErrExportNotReady):
+		c.JSON(http.StatusConflict, gin.H{"error": "Data package is not ready"})
+	case errors.Is(err, service.ErrExportNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Data package not found"})
+	default:
+		h.logger.WithError(err).Error("Failed to " + action)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action})
+	}
+}
+
+// OpenRequest godoc
+// @Summary Open a DSAR request
+// @Description Record a data subject request received for a user; the legal deadline is computed from the receipt date (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body OpenDSARRequest true "Request details"
+// @Success 201 {object} DSARResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/dsar [post]
+func (h *DSARHandler) OpenRequest(c *gin.Context) {
+	var input OpenDSARRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	request, err := h.dsar.Open(c.GetUint("userID"), input.SubjectUserID, input.Type, input.ReceivedAt, input.Notes)
+	if err != nil {
+		h.dsarError(c, err, "open DSAR request")
+		return
+	}
+	c.JSON(http.StatusCreated, dsarResponse(request))
+}
+
+// ListRequests godoc
+// @Summary List DSAR requests
+// @Description List data subject requests ordered by deadline (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param status query string false "open, in_progress or closed"
+// @Success 200 {object} DSARListResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/dsar [get]
+func (h *DSARHandler) ListRequests(c *gin.Context) {
+	requests, err := h.dsar.List(c.Query("status"))
+	if err != nil {
+		h.dsarError(c, err, "list DSAR requests")
+		return
+	}
+
+	response := make([]gin.H, 0, len(requests))
+	for i := range requests {
+		response = append(response, dsarResponse(&requests[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"requests": response})
+}
+
+// GetRequest godoc
+// @Summary Get a DSAR request
+// @Description Get a data subject request with its evidence trail (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "DSAR request ID"
+// @Success 200 {object} DSARDetailResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: DSAR request not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/dsar/{id} [get]
+func (h *DSARHandler) GetRequest(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	request, events, err := h.dsar.Get(id)
+	if err != nil {
+		h.dsarError(c, err, "fetch DSAR request")
+		return
+	}
+
+	trail := make([]gin.H, 0, len(events))
+	for _, e := range events {
+		trail = append(trail, gin.H{
+			"at":      e.CreatedAt,
+			"actorId": e.ActorID,
+			"action":  e.Action,
+			"details": e.Details,
+		})
+	}
+	response := dsarResponse(request)
+	response["events"] = trail
+	c.JSON(http.StatusOK, response)
+}
+
+// AssemblePackage godoc
+// @Summary Assemble the DSAR data package
+// @Description Start generating the subject's personal data archive; poll the request until the package is ready (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "DSAR request ID"
+// @Success 202 {object} ExportJobResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: DSAR request not found"
+// @Failure 409 {object} map[string]string "error: DSAR request is closed"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/dsar/{id}/package [post]
+func (h *DSARHandler) AssemblePackage(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	_, job, err := h.dsar.AssemblePackage(c.GetUint("userID"), id)
+	if err != nil {
+		h.dsarError(c, err, "assemble data package")
+		return
+	}
+
+	response := gin.H{
+		"id":        job.ID,
+		"format":    job.Format,
+		"status":    job.Status,
+		"createdAt": job.CreatedAt,
+		"expiresAt": job.ExpiresAt,
+	}
+	if job.Status == models.ExportCompleted {
+		response["downloadURL"] = fmt.Sprintf("/api/v1/admin/dsar/%d/package", id)
+	}
+	c.JSON(http.StatusAccepted, response)
+}
+
+// DownloadPackage godoc
+// @Summary Download the DSAR data package
+// @Description Download the assembled personal data archive of the subject (admin only)
+// @Tags admin
+// @Produce application/zip
+// @Security Bearer
+// @Param id path int true "DSAR request ID"
+// @Success 200 {file} binary "ZIP archive"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: DSAR request not found"
+// @Failure 409 {object} map[string]string "error: Data package is not ready"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/dsar/{id}/package [get]
+func (h *DSARHandler) DownloadPackage(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	body, job, err := h.dsar.OpenPackage(c.Request.Context(), c.GetUint("userID"), id)
+	if err != nil {
+		h.dsarError(c, err, "download data package")
+		return
+	}
+	defer body.Close()
+
+	c.Header("Cache-Control", "no-store")
+	c.DataFromReader(http.StatusOK, job.Size, "application/zip", body, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="dsar-%d-package.zip"`, id),
+	})
+}
+
+// ExtendDeadline godoc
+// @Summary Extend a DSAR deadline
+// @Description Extend the response deadline, within the configured maximum extension (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "DSAR request ID"
+// @Param extension body ExtendDSARRequest true "Extension"
+// @Success 200 {object} DSARResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: DSAR request not found"
+// @Failure 409 {object} map[string]string "error: DSAR request is closed"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/dsar/{id}/extend [post]
+func (h *DSARHandler) ExtendDeadline(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input ExtendDSARRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	request, err := h.dsar.Extend(c.GetUint("userID"), id, input.Days, input.Reason)
+	if err != nil {
+		h.dsarError(c, err, "extend DSAR deadline")
+		return
+	}
+	c.JSON(http.StatusOK, dsarResponse(request))
+}
+
+// CloseRequest godoc
+// @Summary Close a DSAR request
+// @Description Record the disposition of a data subject request (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "DSAR request ID"
+// @Param disposition body CloseDSARRequest true "Disposition"
+// @Success 200 {object} DSARResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: DSAR request not found"
+// @Failure 409 {object} map[string]string "error: DSAR request is closed"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/dsar/{id}/close [post]
+func (h *DSARHandler) CloseRequest(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var input CloseDSARRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	request, err := h.dsar.Close(c.GetUint("userID"), id, input.Disposition, input.Note)
+	if err != nil {
+		h.dsarError(c, err, "close DSAR request")
+		return
+	}
+	c.JSON(http.StatusOK, dsarResponse(request))
+}
+
+// ExportEvidence godoc
+// @Summary Export the DSAR evidence trail
+// @Description Download the request, every recorded step and the data package metadata as a JSON document (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "DSAR request ID"
+// @Success 200 {object} service.DSAREvidence
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: DSAR request not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/dsar/{id}/evidence [get]
+func (h *DSARHandler) ExportEvidence(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	evidence, err := h.dsar.Evidence(id)
+	if err != nil {
+		h.dsarError(c, err, "export DSAR evidence")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="dsar-%d-evidence.json"`, id))
+	c.JSON(http.StatusOK, evidence)
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// providerEventNames maps provider specific event names to normalized ones
+var providerEventNames = map[string]string{
+	"processed":   models.EmailEventSent,
+	"send":        models.EmailEventSent,
+	"sent":        models.EmailEventSent,
+	"delivered":   models.EmailEventDelivered,
+	"delivery":    models.EmailEventDelivered,
+	"open":        models.EmailEventOpened,
+	"opened":      models.EmailEventOpened,
+	"bounce":      models.EmailEventBounced,
+	"bounced":     models.EmailEventBounced,
+	"dropped":     models.EmailEventBounced,
+	"complaint":   models.EmailEventBounced,
+	"hard_bounce": models.EmailEventBounced,
+}
+
+type EmailHandler struct {
+	emails        service.EmailService
+	logger        *logrus.Logger
+	webhookSecret string
+}
+
+func NewEmailHandler(emails service.EmailService, logger *logrus.Logger, webhookSecret string) *EmailHandler {
+	return &EmailHandler{
+		emails:        emails,
+		logger:        logger,
+		webhookSecret: webhookSecret,
+	}
+}
+
+// ProviderWebhook godoc
+// @Summary Receive email provider events
+// @Description Ingest delivery, open and bounce notifications from an email provider webhook
+// @Tags email
+// @Accept json
+// @Produce json
+// @Param X-Webhook-Secret header string true "Shared webhook secret"
+// @Param provider path string true "Provider name (e.g. sendgrid, ses, smtp)"
+// @Param events body []EmailWebhookEvent true "Provider events"
+// @Success 200 {object} map[string]int "accepted: number of stored events"
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Invalid webhook secret"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /webhooks/email/{provider} [post]
+func (h *EmailHandler) ProviderWebhook(c *gin.Context) {
+	secret := c.GetHeader("X-Webhook-Secret")
+	if h.webhookSecret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(h.webhookSecret)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook secret"})
+		return
+	}
+
+	var input []EmailWebhookEvent
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	provider := c.Param("provider")
+	accepted := 0
+	for _, e := range input {
+		eventName, ok := providerEventNames[strings.ToLower(e.Event)]
+		if !ok || e.MessageID == "" {
+			continue
+		}
+
+		if err := h.emails.RecordProviderEvent(provider, e.MessageID, eventName, e.Email, e.Template); err != nil {
+			h.logger.WithError(err).Error("Failed to store email event")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store email events"})
+			return
+		}
+		accepted++
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accepted": accepted})
+}
+
+// GetEmailStats godoc
+// @Summary Email deliverability statistics
+// @Description Get sent/delivered/opened/bounced counts per email template (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param days query int false "Only include events from the last N days"
+// @Success 200 {object} EmailStatsResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/email-stats [get]
+func (h *EmailHandler) GetEmailStats(c *gin.Context) {
+	var since time.Time
+	if days := c.Query("days"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a positive integer"})
+			return
+		}
+		since = time.Now().AddDate(0, 0, -n)
+	}
+
+	counts, err := h.emails.Stats(since)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to aggregate email events")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch email stats"})
+		return
+	}
+
+	stats := map[string]*EmailTemplateStats{}
+	var order []string
+	for _, count := range counts {
+		s, ok := stats[count.Template]
+		if !ok {
+			s = &EmailTemplateStats{Template: count.Template}
+			stats[count.Template] = s
+			order = append(order, count.Template)
+		}
+		switch count.Event {
+		case models.EmailEventSent:
+			s.Sent = count.Count
+		case models.EmailEventDelivered:
+			s.Delivered = count.Count
+		case models.EmailEventOpened:
+			s.Opened = count.Count
+		case models.EmailEventBounced:
+			s.Bounced = count.Count
+		}
+	}
+
+	templates := make([]EmailTemplateStats, 0, len(order))
+	for _, name := range order {
+		s := stats[name]
+		if s.Sent > 0 {
+			s.DeliveryRate = float64(s.Delivered) / float64(s.Sent)
+			s.BounceRate = float64(s.Bounced) / float64(s.Sent)
+		}
+		templates = append(templates, *s)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
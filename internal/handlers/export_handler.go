@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type ExportHandler struct {
+	exports service.ExportService
+	logger  *logrus.Logger
+}
+
+func NewExportHandler(exports service.ExportService, logger *logrus.Logger) *ExportHandler {
+	return &ExportHandler{
+		exports: exports,
+		logger:  logger,
+	}
+}
+
+func exportJobResponse(job *models.ExportJob) gin.H {
+	response := gin.H{
+		"id":          job.ID,
+		"format":      job.Format,
+		"status":      job.Status,
+		"createdAt":   job.CreatedAt,
+		"completedAt": job.CompletedAt,
+		"expiresAt":   job.ExpiresAt,
+		"statusURL":   fmt.Sprintf("/api/v1/users/export/%d", job.ID),
+	}
+	if job.Status == models.ExportCompleted {
+		response["downloadURL"] = fmt.Sprintf("/api/v1/users/export/%d/download", job.ID)
+		response["size"] = job.Size
+	}
+	if job.Error != "" {
+		response["error"] = job.Error
+	}
+	return response
+}
+
+// RequestExport godoc
+// @Summary Export personal data
+// @Description Start generating a ZIP archive of everything stored about the authenticated user (account, profile, sessions, API keys, audit entries, security events, emails). An export that is still running or downloadable is returned instead of starting a new one. Poll the status URL until the export is completed.
+// @Tags users
+// @Produce json
+// @Security Bearer
+// @Param format query string false "json (default) or csv"
+// @Success 202 {object} ExportJobResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid format"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/export [get]
+func (h *ExportHandler) RequestExport(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	job, err := h.exports.Request(userID, c.DefaultQuery("format", service.ExportFormatJSON))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidExportFormat) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to start export")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start export"})
+		return
+	}
+
+	response := exportJobResponse(job)
+	c.Header("Location", response["statusURL"].(string))
+	c.JSON(http.StatusAccepted, response)
+}
+
+// GetExport godoc
+// @Summary Get export status
+// @Description Get the status of a personal data export
+// @Tags users
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Export ID"
+// @Success 200 {object} ExportJobResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 404 {object} map[string]string "error: Export not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/export/{id} [get]
+func (h *ExportHandler) GetExport(c *gin.Context) {
+	jobID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	job, err := h.exports.Get(c.GetUint("userID"), jobID)
+	if err != nil {
+		if errors.Is(err, service.ErrExportNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to fetch export")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch export"})
+		return
+	}
+
+	c.JSON(http.StatusOK, exportJobResponse(job))
+}
+
+// DownloadExport godoc
+// @Summary Download export
+// @Description Download the archive of a completed personal data export
+// @Tags users
+// @Produce application/zip
+// @Security Bearer
+// @Param id path int true "Export ID"
+// @Success 200 {file} binary "ZIP archive"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 404 {object} map[string]string "error: Export not found"
+// @Failure 409 {object} map[string]string "error: Export is not ready"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/export/{id}/download [get]
+func (h *ExportHandler) DownloadExport(c *gin.Context) {
+	jobID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	body, job, err := h.exports.Open(c.Request.Context(), c.GetUint("userID"), jobID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrExportNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		case errors.Is(err, service.ErrExportNotReady):
+			c.JSON(http.StatusConflict, gin.H{"error": "Export is not ready"})
+		default:
+			h.logger.WithError(err).Error("Failed to read export")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download export"})
+		}
+		return
+	}
+	defer body.Close()
+
+	c.Header("Cache-Control", "no-store")
+	c.DataFromReader(http.StatusOK, job.Size, "application/zip", body, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="user-data-%s.zip"`, job.CreatedAt.Format("20060102")),
+	})
+}
+
+// ExportUserList godoc
+// @Summary Export the user list
+// @Description Download every user with their profile fields as JSON, CSV or XLSX (admins in the user-export group only; API keys are refused). When the access token acts for an organization only its members are exported, as in the user list. The response carries an ETag fingerprinting the data (user, profile and membership counts and latest changes): a request with a matching If-None-Match gets 304 without the export being generated, and Range requests resume an interrupted download. Files are generated a batch of users at a time and cached in the storage backend until exports.ttlHours passes. Every download is recorded in the admin's audit trail.
+// @Tags admin
+// @Produce json
+// @Produce text/csv
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Security Bearer
+// @Param format query string false "json (default), csv or xlsx"
+// @Param If-None-Match header string false "ETag of a previous download"
+// @Success 200 {file} file "User list"
+// @Success 206 {file} file "Requested byte range"
+// @Success 304 {string} string "Unchanged since the given ETag"
+// @Failure 400 {object} map[string]interface{} "error: Invalid format"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access and user-export group membership required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/export [get]
+func (h *ExportHandler) ExportUserList(c *gin.Context) {
+	format := c.DefaultQuery("format", service.ExportFormatJSON)
+	orgID := c.GetUint("orgID")
+	etag, err := h.exports.UserListETag(format, orgID)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUserListFormat) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, use json, csv or xlsx"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to fingerprint user list")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export users"})
+		return
+	}
+
+	// Admins may keep a copy, but must check it is still current before using it
+	c.Header("Cache-Control", "private, no-cache")
+	c.Writer.Header().Del("Pragma")
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	content, job, err := h.exports.OpenUserList(c.Request.Context(), c.GetUint("userID"), format, orgID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to export user list")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export users"})
+		return
+	}
+	defer content.Close()
+
+	// ServeContent answers Range and If-Range requests from the seekable file
+	c.Header("Content-Type", service.UserListContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="users-%s.%s"`, job.CreatedAt.Format("20060102"), format))
+	http.ServeContent(c.Writer, c.Request, "", *job.CompletedAt, content)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"api/internal/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type ExternalLoginHandler struct {
+	logins service.ExternalLoginService
+	logger *logrus.Logger
+}
+
+func NewExternalLoginHandler(logins service.ExternalLoginService, logger *logrus.Logger) *ExternalLoginHandler {
+	return &ExternalLoginHandler{
+		logins: logins,
+		logger: logger,
+	}
+}
+
+// ConfirmExternalLogin godoc
+// @Summary Confirm linking an account to an identity provider
+// @Description Bind an existing account to the LDAP or SAML identity that signed in with its email, with the token from the link mailed to the account. Sign in through the identity provider again afterwards; the account keeps its password and role.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param confirmation body ConfirmExternalLoginRequest true "Confirmation token"
+// @Success 200 {object} map[string]string "message: Account linked"
+// @Failure 400 {object} map[string]interface{} "error: Validation error or invalid token"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /auth/external-logins/confirm [post]
+func (h *ExternalLoginHandler) ConfirmExternalLogin(c *gin.Context) {
+	var input ConfirmExternalLoginRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	if _, err := h.logins.Confirm(input.Token, clientInfo(c)); err != nil {
+		if errors.Is(err, service.ErrInvalidLinkToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation token"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to confirm external login")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account linked, you can now sign in through the identity provider"})
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type FeatureFlagHandler struct {
+	flags  service.FeatureFlagService
+	logger *logrus.Logger
+}
+
+func NewFeatureFlagHandler(flags service.FeatureFlagService, logger *logrus.Logger) *FeatureFlagHandler {
+	return &FeatureFlagHandler{
+		flags:  flags,
+		logger: logger,
+	}
+}
+
+func featureFlagResponse(flag *models.FeatureFlag) FeatureFlagResponse {
+	return FeatureFlagResponse{
+		Key:         flag.Key,
+		Description: flag.Description,
+		Enabled:     flag.Enabled,
+		Percentage:  flag.Percentage,
+		Roles:       service.FeatureFlagRolePercentages(flag),
+		UpdatedAt:   flag.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// ListFeatureFlags godoc
+// @Summary List feature flags
+// @Description List the feature flags by key (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} FeatureFlagListResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/feature-flags [get]
+func (h *FeatureFlagHandler) ListFeatureFlags(c *gin.Context) {
+	flags, err := h.flags.List()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list feature flags")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feature flags"})
+		return
+	}
+
+	response := FeatureFlagListResponse{Flags: make([]FeatureFlagResponse, 0, len(flags))}
+	for i := range flags {
+		response.Flags = append(response.Flags, featureFlagResponse(&flags[i]))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetFeatureFlag godoc
+// @Summary Get a feature flag
+// @Description Get a feature flag and its rollout rules (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param key path string true "Flag key"
+// @Success 200 {object} FeatureFlagResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: Feature flag not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/feature-flags/{key} [get]
+func (h *FeatureFlagHandler) GetFeatureFlag(c *gin.Context) {
+	flag, err := h.flags.Get(c.Param("key"))
+	if err != nil {
+		if errors.Is(err, service.ErrFeatureFlagNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Feature flag not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to fetch feature flag")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feature flag"})
+		return
+	}
+	c.JSON(http.StatusOK, featureFlagResponse(flag))
+}
+
+// DefineFeatureFlag godoc
+// @Summary Define a feature flag
+// @Description Create or update a feature flag. An enabled flag is on for percentage percent of users, picked by a stable hash of the flag key and user ID, so raising the percentage only adds users. roles overrides the percentage for users of a role, e.g. {"admin": 100} to try a feature on admins first. Flags rolled out to less than 100 percent are off for anonymous callers. Other instances pick up changes within featureFlags.reloadSeconds (admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param key path string true "Flag key: letters, digits, _, . and -, starting with a letter"
+// @Param flag body FeatureFlagRequest true "Flag"
+// @Success 200 {object} FeatureFlagResponse
+// @Success 201 {object} FeatureFlagResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error or invalid flag"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/feature-flags/{key} [put]
+func (h *FeatureFlagHandler) DefineFeatureFlag(c *gin.Context) {
+	var input FeatureFlagRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	flag, created, err := h.flags.Define(c.Param("key"), service.FeatureFlagInput{
+		Description:     input.Description,
+		Enabled:         input.Enabled,
+		Percentage:      input.Percentage,
+		RolePercentages: input.Roles,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidFeatureFlag) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to save feature flag")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save feature flag"})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, featureFlagResponse(flag))
+}
+
+// DeleteFeatureFlag godoc
+// @Summary Delete a feature flag
+// @Description Delete a feature flag; it is off for everyone afterwards (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param key path string true "Flag key"
+// @Success 200 {object} map[string]string "message: Feature flag deleted"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: Feature flag not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/feature-flags/{key} [delete]
+func (h *FeatureFlagHandler) DeleteFeatureFlag(c *gin.Context) {
+	if err := h.flags.Delete(c.Param("key")); err != nil {
+		if errors.Is(err, service.ErrFeatureFlagNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Feature flag not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to delete feature flag")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete feature flag"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Feature flag deleted"})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fieldSet is a parsed fields query parameter: the requested fields, each with the
+// requested fields of its value, or nil to keep the whole value
+type fieldSet map[string]fieldSet
+
+func parseFields(value string) fieldSet {
+	fields := fieldSet{}
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		set := fields
+		parts := strings.Split(path, ".")
+		for i, part := range parts {
+			if i == len(parts)-1 {
+				set[part] = nil
+				break
+			}
+			sub, seen := set[part]
+			if seen && sub == nil {
+				break // the whole value was asked for already
+			}
+			if !seen {
+				sub = fieldSet{}
+				set[part] = sub
+			}
+			set = sub
+		}
+	}
+	return fields
+}
+
+// apply keeps the fields of f in v, an object or a list of objects as decoded from JSON
+func (f fieldSet) apply(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		kept := make(map[string]any, len(f))
+		for key, sub := range f {
+			if value, ok := v[key]; ok {
+				if sub != nil {
+					value = sub.apply(value)
+				}
+				kept[key] = value
+			}
+		}
+		return kept
+	case []any:
+		for i := range v {
+			v[i] = f.apply(v[i])
+		}
+		return v
+	}
+	return v
+}
+
+// selectFields trims v, an object or a list of objects, to the fields named in the
+// fields query parameter, e.g. fields=email,username,profile.firstName, so clients on
+// slow connections only download what they show. Fields of nested objects are joined
+// with dots and unknown fields are ignored. Without the parameter v is returned as is.
+func selectFields(c *gin.Context, v any) any {
+	value := c.Query("fields")
+	if value == "" {
+		return v
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var decoded any
+	if err := decoder.Decode(&decoded); err != nil {
+		return v
+	}
+	return parseFields(value).apply(decoded)
+}
+
+// setMeta adds key to the meta object of the response envelope, if one is used
+func setMeta(c *gin.Context, key string, value any) {
+	meta, ok := c.Get("meta")
+	if !ok {
+		meta = map[string]any{}
+		c.Set("meta", meta)
+	}
+	if meta, ok := meta.(map[string]any); ok {
+		meta[key] = value
+	}
+}
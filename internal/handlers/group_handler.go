@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type GroupHandler struct {
+	groups service.GroupService
+	logger *logrus.Logger
+}
+
+func NewGroupHandler(groups service.GroupService, logger *logrus.Logger) *GroupHandler {
+	return &GroupHandler{
+		groups: groups,
+		logger: logger,
+	}
+}
+
+func groupResponse(group *models.Group, members int) GroupResponse {
+	return GroupResponse{
+		ID:          group.ID,
+		Name:        group.Name,
+		Description: group.Description,
+		MemberCount: members,
+		CreatedAt:   group.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// groupError writes the response for the errors shared by the group endpoints; false
+// means err is unexpected
+func groupError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrGroupNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+	case errors.Is(err, service.ErrInvalidGroupName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Group names are 1-50 lowercase letters, digits, - and _", "field": "name"})
+	case errors.Is(err, service.ErrGroupNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Group name is already taken", "field": "name"})
+	default:
+		return false
+	}
+	return true
+}
+
+// ListGroups godoc
+// @Summary List groups
+// @Description List every group with its number of members (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} GroupListResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/groups [get]
+func (h *GroupHandler) ListGroups(c *gin.Context) {
+	groups, err := h.groups.List()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list groups")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch groups"})
+		return
+	}
+
+	response := GroupListResponse{Groups: make([]GroupResponse, 0, len(groups))}
+	for _, g := range groups {
+		response.Groups = append(response.Groups, groupResponse(&g.Group, g.Members))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateGroup godoc
+// @Summary Create a group
+// @Description Create a group of users. Members' access tokens list the group names in the "groups" claim, for RequireGroup here and in downstream services (admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param group body GroupRequest true "Group"
+// @Success 201 {object} GroupResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error or invalid name"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 409 {object} map[string]string "error: Group name is already taken, field: name"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/groups [post]
+func (h *GroupHandler) CreateGroup(c *gin.Context) {
+	var input GroupRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	group, err := h.groups.Create(input.Name, input.Description)
+	if err != nil {
+		if groupError(c, err) {
+			return
+		}
+		h.logger.WithError(err).Error("Failed to create group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
+		return
+	}
+	c.JSON(http.StatusCreated, groupResponse(group, 0))
+}
+
+// GetGroup godoc
+// @Summary Get a group
+// @Description Get a group and its members (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Group ID"
+// @Success 200 {object} GroupDetailResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: Group not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/groups/{id} [get]
+func (h *GroupHandler) GetGroup(c *gin.Context) {
+	groupID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	group, members, err := h.groups.Get(groupID)
+	if err != nil {
+		if groupError(c, err) {
+			return
+		}
+		h.logger.WithError(err).Error("Failed to fetch group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch group"})
+		return
+	}
+
+	response := GroupDetailResponse{
+		GroupResponse: groupResponse(group, len(members)),
+		Members:       make([]GroupMemberResponse, 0, len(members)),
+	}
+	for _, m := range members {
+		response.Members = append(response.Members, GroupMemberResponse{ID: m.ID, Email: m.Email, Username: m.Username})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateGroup godoc
+// @Summary Update a group
+// @Description Rename a group or change its description. Renaming revokes the members' access tokens, which carry the old name (admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Group ID"
+// @Param group body GroupRequest true "Group"
+// @Success 200 {object} GroupResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error or invalid name"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: Group not found"
+// @Failure 409 {object} map[string]string "error: Group name is already taken, field: name"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/groups/{id} [put]
+func (h *GroupHandler) UpdateGroup(c *gin.Context) {
+	groupID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	var input GroupRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	group, err := h.groups.Update(groupID, input.Name, input.Description)
+	if err != nil {
+		if groupError(c, err) {
+			return
+		}
+		h.logger.WithError(err).Error("Failed to update group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		return
+	}
+	_, members, err := h.groups.Get(groupID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch group"})
+		return
+	}
+	c.JSON(http.StatusOK, groupResponse(group, len(members)))
+}
+
+// DeleteGroup godoc
+// @Summary Delete a group
+// @Description Delete a group and its memberships; the members' access tokens are revoked (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Group ID"
+// @Success 200 {object} map[string]string "message: Group deleted"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: Group not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/groups/{id} [delete]
+func (h *GroupHandler) DeleteGroup(c *gin.Context) {
+	groupID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.groups.Delete(groupID); err != nil {
+		if groupError(c, err) {
+			return
+		}
+		h.logger.WithError(err).Error("Failed to delete group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted"})
+}
+
+// AddGroupMember godoc
+// @Summary Add a user to a group
+// @Description Put a user in a group; their next access token lists it. Adding a member twice is not an error (admin only).
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Group ID"
+// @Param userId path int true "User ID"
+// @Success 200 {object} map[string]string "message: User added to group"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: Group or user not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/groups/{id}/members/{userId} [put]
+func (h *GroupHandler) AddGroupMember(c *gin.Context) {
+	groupID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := parseIDParam(c, "userId")
+	if !ok {
+		return
+	}
+
+	if err := h.groups.AddMember(groupID, userID); err != nil {
+		if groupError(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to add group member")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add group member"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User added to group"})
+}
+
+// RemoveGroupMember godoc
+// @Summary Remove a user from a group
+// @Description Take a user out of a group. Their access tokens are revoked so the group claim does not outlive the membership (admin only).
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Group ID"
+// @Param userId path int true "User ID"
+// @Success 200 {object} map[string]string "message: User removed from group"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: Group not found or user is not a member"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/groups/{id}/members/{userId} [delete]
+func (h *GroupHandler) RemoveGroupMember(c *gin.Context) {
+	groupID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := parseIDParam(c, "userId")
+	if !ok {
+		return
+	}
+
+	if err := h.groups.RemoveMember(groupID, userID); err != nil {
+		if groupError(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrNotGroupMember) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of the group"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to remove group member")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove group member"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User removed from group"})
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"api/internal/auth"
+	"api/internal/middleware/authtest"
+	"api/internal/models"
+	"api/internal/service"
+	"api/internal/validation"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		if err := validation.Register(v); err != nil {
+			panic(err)
+		}
+	}
+	os.Exit(m.Run())
+}
+
+// errDatabase stands in for any failure the handlers do not map to a response of its own
+var errDatabase = errors.New("database unavailable")
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// serve calls handler with a request for target carrying body as JSON unless it is
+// empty, signed in as identity unless it is nil, with the path parameter id when set
+func serve(handler gin.HandlerFunc, method, target, body string, identity *authtest.Identity, id string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c, w := authtest.Context(req, identity)
+	if id != "" {
+		c.Params = gin.Params{{Key: "id", Value: id}}
+	}
+	handler(c)
+	return w
+}
+
+// checkResponse fails the test unless w has status and, when code is set, that error
+// code. It returns the decoded body.
+func checkResponse(t *testing.T, w *httptest.ResponseRecorder, status int, code string) map[string]interface{} {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d; body %s", w.Code, status, w.Body)
+	}
+	var body map[string]interface{}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode body %q: %v", w.Body, err)
+		}
+	}
+	if code != "" && body["code"] != code {
+		t.Fatalf("code = %v, want %s; body %s", body["code"], code, w.Body)
+	}
+	return body
+}
+
+func testUser(id uint, role string) *models.User {
+	user := &models.User{Email: "ada@example.com", Username: "ada", Role: role, Status: models.UserStatusActive}
+	user.ID = id
+	return user
+}
+
+func testTokens() *auth.TokenPair {
+	return &auth.TokenPair{AccessToken: "access-token", RefreshToken: "refresh-token"}
+}
+
+// The fakes below stand in for the services of the handlers under test. Only the
+// methods a handler calls are implemented; any other panics on the nil interface.
+
+type fakeAuthService struct {
+	service.AuthService
+	register            func(email, username, password, locale string) (*models.User, error)
+	login               func(login, password string, client service.ClientInfo) (*models.User, *auth.TokenPair, error)
+	refresh             func(refreshToken string, client service.ClientInfo) (*models.User, *auth.TokenPair, error)
+	logout              func(refreshToken string, access service.AccessToken) error
+	createScopedSession func(userID uint, scopes []string, client service.ClientInfo) (*models.User, *auth.TokenPair, error)
+}
+
+func (f *fakeAuthService) Register(email, username, password, locale string) (*models.User, error) {
+	return f.register(email, username, password, locale)
+}
+
+func (f *fakeAuthService) Login(login, password string, client service.ClientInfo) (*models.User, *auth.TokenPair, error) {
+	return f.login(login, password, client)
+}
+
+func (f *fakeAuthService) Refresh(refreshToken string, client service.ClientInfo) (*models.User, *auth.TokenPair, error) {
+	return f.refresh(refreshToken, client)
+}
+
+func (f *fakeAuthService) Logout(refreshToken string, access service.AccessToken) error {
+	return f.logout(refreshToken, access)
+}
+
+func (f *fakeAuthService) CreateScopedSession(userID uint, scopes []string, client service.ClientInfo) (*models.User, *auth.TokenPair, error) {
+	return f.createScopedSession(userID, scopes, client)
+}
+
+type fakeResetService struct {
+	service.PasswordResetService
+	request func(email string, client service.ClientInfo) error
+	reset   func(token, newPassword string, client service.ClientInfo) error
+}
+
+func (f *fakeResetService) Request(email string, client service.ClientInfo) error {
+	return f.request(email, client)
+}
+
+func (f *fakeResetService) Reset(token, newPassword string, client service.ClientInfo) error {
+	return f.reset(token, newPassword, client)
+}
+
+type fakeAccountService struct {
+	service.AccountService
+	requestEmailChange  func(userID uint, password, newEmail string, client service.ClientInfo) error
+	confirmEmailChange  func(token string, client service.ClientInfo) (*models.User, error)
+	changeUsername      func(userID uint, username string, client service.ClientInfo) (*models.User, error)
+	deactivate          func(userID uint, client service.ClientInfo) error
+	reactivate          func(token string, client service.ClientInfo) (*models.User, error)
+	deletionGracePeriod time.Duration
+	scheduleDeletion    func(userID uint, client service.ClientInfo) (*models.User, error)
+}
+
+func (f *fakeAccountService) RequestEmailChange(userID uint, password, newEmail string, client service.ClientInfo) error {
+	return f.requestEmailChange(userID, password, newEmail, client)
+}
+
+func (f *fakeAccountService) ConfirmEmailChange(token string, client service.ClientInfo) (*models.User, error) {
+	return f.confirmEmailChange(token, client)
+}
+
+func (f *fakeAccountService) ChangeUsername(userID uint, username string, client service.ClientInfo) (*models.User, error) {
+	return f.changeUsername(userID, username, client)
+}
+
+func (f *fakeAccountService) Deactivate(userID uint, client service.ClientInfo) error {
+	return f.deactivate(userID, client)
+}
+
+func (f *fakeAccountService) Reactivate(token string, client service.ClientInfo) (*models.User, error) {
+	return f.reactivate(token, client)
+}
+
+func (f *fakeAccountService) DeletionGracePeriod() time.Duration {
+	return f.deletionGracePeriod
+}
+
+func (f *fakeAccountService) ScheduleDeletion(userID uint, client service.ClientInfo) (*models.User, error) {
+	return f.scheduleDeletion(userID, client)
+}
+
+type fakeUserService struct {
+	service.UserService
+	getProfile            func(userID uint) (*models.User, *models.UserProfile, error)
+	updateProfile         func(userID uint, update service.ProfileUpdate) (*models.UserProfile, error)
+	changePassword        func(userID uint, currentPassword, newPassword, currentSession string) (int, error)
+	listUsers             func() ([]service.UserWithProfile, error)
+	listOrganizationUsers func(orgID uint) ([]service.UserWithProfile, error)
+	filterUsers           func(orgID uint, attributes map[string]string) ([]service.UserWithProfile, error)
+	search                func(query string, orgID uint, limit int) ([]service.UserSearchHit, error)
+	directory             func() ([]service.UserWithProfile, error)
+	changeRole            func(userID uint, role string) (*models.User, error)
+	updateUser            func(userID uint, update service.UserUpdate) (*service.UserWithProfile, error)
+	revokeAllSessions     func(userID, adminID uint, notify bool) (int, error)
+	suspend               func(userID, adminID uint, input service.SuspendInput) (*models.User, error)
+	reinstate             func(userID, adminID uint) (*models.User, error)
+	listDeleted           func() ([]models.User, error)
+	restore               func(userID, adminID uint) (*models.User, error)
+	incompleteProfiles    func(orgID uint, threshold int) (*service.IncompleteProfilesReport, error)
+}
+
+func (f *fakeUserService) GetProfile(userID uint) (*models.User, *models.UserProfile, error) {
+	return f.getProfile(userID)
+}
+
+func (f *fakeUserService) UpdateProfile(userID uint, update service.ProfileUpdate) (*models.UserProfile, error) {
+	return f.updateProfile(userID, update)
+}
+
+func (f *fakeUserService) ChangePassword(userID uint, currentPassword, newPassword, currentSession string) (int, error) {
+	return f.changePassword(userID, currentPassword, newPassword, currentSession)
+}
+
+func (f *fakeUserService) ListUsers() ([]service.UserWithProfile, error) {
+	return f.listUsers()
+}
+
+func (f *fakeUserService) ListOrganizationUsers(orgID uint) ([]service.UserWithProfile, error) {
+	return f.listOrganizationUsers(orgID)
+}
+
+func (f *fakeUserService) FilterUsers(orgID uint, attributes map[string]string) ([]service.UserWithProfile, error) {
+	return f.filterUsers(orgID, attributes)
+}
+
+func (f *fakeUserService) Search(query string, orgID uint, limit int) ([]service.UserSearchHit, error) {
+	return f.search(query, orgID, limit)
+}
+
+func (f *fakeUserService) Directory() ([]service.UserWithProfile, error) {
+	return f.directory()
+}
+
+func (f *fakeUserService) ChangeRole(userID uint, role string) (*models.User, error) {
+	return f.changeRole(userID, role)
+}
+
+func (f *fakeUserService) UpdateUser(userID uint, update service.UserUpdate) (*service.UserWithProfile, error) {
+	return f.updateUser(userID, update)
+}
+
+func (f *fakeUserService) RevokeAllSessions(userID, adminID uint, notify bool) (int, error) {
+	return f.revokeAllSessions(userID, adminID, notify)
+}
+
+func (f *fakeUserService) Suspend(userID, adminID uint, input service.SuspendInput) (*models.User, error) {
+	return f.suspend(userID, adminID, input)
+}
+
+func (f *fakeUserService) Reinstate(userID, adminID uint) (*models.User, error) {
+	return f.reinstate(userID, adminID)
+}
+
+func (f *fakeUserService) ListDeleted() ([]models.User, error) {
+	return f.listDeleted()
+}
+
+func (f *fakeUserService) Restore(userID, adminID uint) (*models.User, error) {
+	return f.restore(userID, adminID)
+}
+
+func (f *fakeUserService) ProfileCompleteness(profile *models.UserProfile) service.ProfileCompleteness {
+	return service.ProfileCompleteness{Score: 50, Missing: []string{"bio"}, MissingRequired: []string{}}
+}
+
+func (f *fakeUserService) IncompleteProfiles(orgID uint, threshold int) (*service.IncompleteProfilesReport, error) {
+	return f.incompleteProfiles(orgID, threshold)
+}
+
+type fakeErasureService struct {
+	service.ErasureService
+	erase func(userID uint, mode string) (string, error)
+	purge func(userID uint) error
+}
+
+func (f *fakeErasureService) Erase(ctx context.Context, userID uint, mode string) (string, error) {
+	return f.erase(userID, mode)
+}
+
+func (f *fakeErasureService) Purge(ctx context.Context, userID uint) error {
+	return f.purge(userID)
+}
+
+type fakeBulkService struct {
+	apply func(adminID uint, request service.BulkRequest) ([]service.BulkResult, error)
+}
+
+func (f *fakeBulkService) Apply(ctx context.Context, adminID uint, request service.BulkRequest) ([]service.BulkResult, error) {
+	return f.apply(adminID, request)
+}
+
+type fakeAttributeService struct {
+	service.AttributeService
+	filter func(values map[string]string) (map[string]string, error)
+}
+
+func (f *fakeAttributeService) Filter(values map[string]string) (map[string]string, error) {
+	return f.filter(values)
+}
+
+type fakeNotificationService struct {
+	service.NotificationService
+	preferences func(userID uint) (*models.NotificationPreferences, error)
+}
+
+func (f *fakeNotificationService) Preferences(userID uint) (*models.NotificationPreferences, error) {
+	return f.preferences(userID)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"api/internal/jobs"
+	"api/internal/logging"
+	"api/internal/repository"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler reports whether the API is up and ready to serve traffic
+type HealthHandler struct {
+	db        *sql.DB
+	logOutput *logging.Output
+	scheduler *jobs.Scheduler
+	replicas  *repository.ReadReplicas
+}
+
+func NewHealthHandler(db *sql.DB, logOutput *logging.Output, scheduler *jobs.Scheduler, replicas *repository.ReadReplicas) *HealthHandler {
+	return &HealthHandler{
+		db:        db,
+		logOutput: logOutput,
+		scheduler: scheduler,
+		replicas:  replicas,
+	}
+}
+
+// Health godoc
+// @Summary Check API health
+// @Description Get the health status of the API
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string "status: OK"
+// @Router /health [get]
+func (h *HealthHandler) Health(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "OK",
+		"time":   time.Now().Format(time.RFC3339),
+	})
+}
+
+// Ready godoc
+// @Summary Check API readiness
+// @Description Report whether the API can serve traffic. The database must be reachable; a degraded log output (stdout fallback or lowered log level) or an unreachable read replica is reported but does not fail the check.
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]interface{} "status: OK or DEGRADED"
+// @Failure 503 {object} map[string]interface{} "status: UNAVAILABLE"
+// @Router /health/ready [get]
+func (h *HealthHandler) Ready(c *gin.Context) {
+	status, code := "OK", http.StatusOK
+	database := "OK"
+	if err := h.db.Ping(); err != nil {
+		database = "UNAVAILABLE"
+		status, code = "UNAVAILABLE", http.StatusServiceUnavailable
+	}
+	logStatus := h.logOutput.Status()
+	jobsStatus := gin.H{"instance": h.scheduler.Instance(), "leader": h.scheduler.IsLeader()}
+	replicaStatus := h.replicas.Status()
+	replicaDown := false
+	for _, healthy := range replicaStatus {
+		replicaDown = replicaDown || !healthy
+	}
+	if code == http.StatusOK && (logStatus.Degraded || logStatus.LevelLowered || replicaDown) {
+		status = "DEGRADED"
+	}
+	c.JSON(code, gin.H{
+		"status": status,
+		"checks": gin.H{
+			"database": database,
+			"logging":  logStatus,
+			"jobs":     jobsStatus,
+			"replicas": replicaStatus,
+		},
+		"time": time.Now().Format(time.RFC3339),
+	})
+}
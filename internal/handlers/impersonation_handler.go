@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"api/internal/service"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type ImpersonationHandler struct {
+	impersonation service.ImpersonationService
+	logger        *logrus.Logger
+}
+
+func NewImpersonationHandler(impersonation service.ImpersonationService, logger *logrus.Logger) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		impersonation: impersonation,
+		logger:        logger,
+	}
+}
+
+func impersonationResponse(token *service.ImpersonationToken, impersonatorID uint) ImpersonationResponse {
+	return ImpersonationResponse{
+		AccessToken:    token.AccessToken,
+		ExpiresAt:      token.ExpiresAt.UTC().Format(time.RFC3339),
+		ImpersonatorID: impersonatorID,
+		User: UserResponse{
+			ID:       token.User.ID,
+			Email:    token.User.Email,
+			Username: token.User.Username,
+			Role:     token.User.Role,
+		},
+	}
+}
+
+// Impersonate godoc
+// @Summary Impersonate a user
+// @Description Issue a short-lived access token acting as the user, with the admin in its impersonator claim, to debug what they see. There is no refresh token. Every request made with it is written to the audit trail with both identities; changing the password, email address, username, API keys, sessions or devices, exporting data and deactivating or deleting the account are refused. Admins and blocked accounts cannot be impersonated. Requires a signed-in admin session, not an API key; POST /auth/impersonation/exit returns to it (admin only).
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "User ID"
+// @Success 200 {object} ImpersonationResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID or signed-in session required"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required, or user cannot be impersonated"
+// @Failure 404 {object} map[string]string "error: User not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/{id}/impersonate [post]
+func (h *ImpersonationHandler) Impersonate(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if c.GetUint("impersonatorID") != 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Already impersonating", "code": "impersonation_forbidden"})
+		return
+	}
+
+	adminID := c.GetUint("userID")
+	token, err := h.impersonation.Start(adminID, c.GetString("sessionID"), userID, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, service.ErrImpersonationNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrImpersonationSessionRequired), errors.Is(err, service.ErrAdminSessionEnded):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Impersonation requires a signed-in session, not an API key"})
+		default:
+			h.logger.WithError(err).Error("Failed to start impersonation")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to impersonate user"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, impersonationResponse(token, adminID))
+}
+
+// ExitImpersonation godoc
+// @Summary Stop impersonating
+// @Description Revoke the impersonation token used for the request and return a new access token for the admin's own session. The admin's refresh token stays valid. Returns 401 when that session was signed out in the meantime; the impersonation ends either way.
+// @Tags auth
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} ImpersonationResponse
+// @Failure 400 {object} map[string]interface{} "error: Not impersonating"
+// @Failure 401 {object} map[string]string "error: Admin session ended, sign in again"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /auth/impersonation/exit [post]
+func (h *ImpersonationHandler) ExitImpersonation(c *gin.Context) {
+	impersonatorID := c.GetUint("impersonatorID")
+	token, err := h.impersonation.Exit(accessToken(c), impersonatorID, c.GetString("impersonatorSessionID"), clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotImpersonating):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Not impersonating"})
+		case errors.Is(err, service.ErrAdminSessionEnded):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Admin session ended, sign in again"})
+		default:
+			h.logger.WithError(err).Error("Failed to exit impersonation")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to exit impersonation"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, impersonationResponse(token, 0))
+}
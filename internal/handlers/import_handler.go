@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type ImportHandler struct {
+	imports service.UserImportService
+	logger  *logrus.Logger
+}
+
+func NewImportHandler(imports service.UserImportService, logger *logrus.Logger) *ImportHandler {
+	return &ImportHandler{
+		imports: imports,
+		logger:  logger,
+	}
+}
+
+func importJobResponse(job *models.ImportJob) ImportJobResponse {
+	response := ImportJobResponse{
+		ID:        job.ID,
+		Format:    job.Format,
+		Mode:      job.Mode,
+		Status:    job.Status,
+		Rows:      job.Rows,
+		Succeeded: job.Succeeded,
+		Failed:    job.Failed,
+		CreatedAt: job.CreatedAt.Format(time.RFC3339),
+		StatusURL: fmt.Sprintf("/api/v1/admin/users/import/%d", job.ID),
+		Error:     job.Error,
+	}
+	if job.CompletedAt != nil {
+		response.CompletedAt = job.CompletedAt.Format(time.RFC3339)
+	}
+	if job.ExpiresAt != nil {
+		response.ExpiresAt = job.ExpiresAt.Format(time.RFC3339)
+	}
+	if job.Status == models.ExportCompleted {
+		response.ReportURL = fmt.Sprintf("/api/v1/admin/users/import/%d/report", job.ID)
+	}
+	return response
+}
+
+// importFormat picks the format of an upload from the format field, the file extension
+// or the content type
+func importFormat(c *gin.Context, filename, contentType string) string {
+	if format := c.PostForm("format"); format != "" {
+		return format
+	}
+	switch {
+	case strings.EqualFold(filepath.Ext(filename), ".csv"), strings.HasPrefix(contentType, "text/csv"):
+		return service.ExportFormatCSV
+	case strings.EqualFold(filepath.Ext(filename), ".json"), strings.HasPrefix(contentType, "application/json"):
+		return service.ExportFormatJSON
+	}
+	return ""
+}
+
+// ImportUsers godoc
+// @Summary Import users
+// @Description Upload a CSV or JSON file of users to create in the background (admin only). CSV files start with a header naming the email, username and role columns in any order; JSON files hold an array of {email, username, role} objects. Role defaults to user. With mode password (default) accounts are created and each user is mailed a link to set their password, along with the verification email; they cannot sign in until the password is set; with mode invite each address is mailed a registration invitation and the username column is optional. The file is checked before it is accepted; rows with an invalid email address or username, duplicates within the file and addresses already registered fail individually. Poll the status URL until the import is completed, then download the report.
+// @Tags admin
+// @Accept multipart/form-data
+// @Produce json
+// @Security Bearer
+// @Param file formData file true "CSV or JSON file of users"
+// @Param mode formData string false "password (default) or invite"
+// @Param format formData string false "csv or json; taken from the file name or content type when omitted"
+// @Success 202 {object} ImportJobResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid import file"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 413 {object} map[string]string "error: Import file is too large"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/import [post]
+func (h *ImportHandler) ImportUsers(c *gin.Context) {
+	// Leave some room for the multipart envelope; the file itself is checked below
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.imports.MaxUploadBytes()+64<<10)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Import file is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if file.Size > h.imports.MaxUploadBytes() {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Import file is too large"})
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	defer src.Close()
+	data, err := io.ReadAll(src)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+		return
+	}
+
+	format := importFormat(c, file.Filename, file.Header.Get("Content-Type"))
+	mode := c.DefaultPostForm("mode", models.ImportModePassword)
+	job, err := h.imports.Start(c.GetUint("userID"), format, mode, data)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidImportFormat), errors.Is(err, service.ErrInvalidImportMode),
+			errors.Is(err, service.ErrInvalidImportFile):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			h.logger.WithError(err).Error("Failed to start import")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start import"})
+		}
+		return
+	}
+
+	response := importJobResponse(job)
+	c.Header("Location", response.StatusURL)
+	c.JSON(http.StatusAccepted, response)
+}
+
+// GetImport godoc
+// @Summary Get import status
+// @Description Get the progress of a bulk user import started by the authenticated admin
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Import ID"
+// @Success 200 {object} ImportJobResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: Import not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/import/{id} [get]
+func (h *ImportHandler) GetImport(c *gin.Context) {
+	jobID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	job, err := h.imports.Get(c.GetUint("userID"), jobID)
+	if err != nil {
+		if errors.Is(err, service.ErrImportNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to fetch import")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch import"})
+		return
+	}
+
+	c.JSON(http.StatusOK, importJobResponse(job))
+}
+
+// DownloadImportReport godoc
+// @Summary Download import report
+// @Description Download the outcome of every row of a completed import, in the format of the uploaded file: row number, email, username, role, status (created, invited or failed), error and user ID. The report is deleted after imports.ttlHours.
+// @Tags admin
+// @Produce json
+// @Produce text/csv
+// @Security Bearer
+// @Param id path int true "Import ID"
+// @Success 200 {file} file "Import report"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: Import not found"
+// @Failure 409 {object} map[string]string "error: Import is not finished"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/users/import/{id}/report [get]
+func (h *ImportHandler) DownloadImportReport(c *gin.Context) {
+	jobID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	body, job, err := h.imports.OpenReport(c.Request.Context(), c.GetUint("userID"), jobID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrImportNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		case errors.Is(err, service.ErrImportNotReady):
+			c.JSON(http.StatusConflict, gin.H{"error": "Import is not finished"})
+		default:
+			h.logger.WithError(err).Error("Failed to read import report")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download import report"})
+		}
+		return
+	}
+	defer body.Close()
+
+	c.Header("Cache-Control", "no-store")
+	c.DataFromReader(http.StatusOK, -1, service.UserListContentType(job.Format), body, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="user-import-%d.%s"`, job.ID, job.Format),
+	})
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type InvitationHandler struct {
+	invitations service.InvitationService
+	logger      *logrus.Logger
+}
+
+func NewInvitationHandler(invitations service.InvitationService, logger *logrus.Logger) *InvitationHandler {
+	return &InvitationHandler{
+		invitations: invitations,
+		logger:      logger,
+	}
+}
+
+func registrationInvitationResponse(invitation *models.RegistrationInvitation) RegistrationInvitationResponse {
+	return RegistrationInvitationResponse{
+		ID:          invitation.ID,
+		Email:       invitation.Email,
+		Role:        invitation.Role,
+		InvitedByID: invitation.InvitedByID,
+		CreatedAt:   invitation.CreatedAt.Format(time.RFC3339),
+		ExpiresAt:   invitation.ExpiresAt.Format(time.RFC3339),
+	}
+}
+
+// CreateInvitation godoc
+// @Summary Invite a user to register
+// @Description Email a single-use registration link to an address, optionally granting the admin role. The address counts as verified once the link is used. A new invitation replaces the pending ones for the same address (admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param invitation body CreateRegistrationInvitationRequest true "Invitation"
+// @Success 201 {object} RegistrationInvitationResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 409 {object} map[string]string "error: Email is already registered, field: email"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/invitations [post]
+func (h *InvitationHandler) CreateInvitation(c *gin.Context) {
+	var input CreateRegistrationInvitationRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	invitation, err := h.invitations.Invite(c.GetUint("userID"), input.Email, input.Role)
+	if err != nil {
+		if userExists(c, err) {
+			return
+		}
+		h.logger.WithError(err).Error("Failed to invite user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send invitation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, registrationInvitationResponse(invitation))
+}
+
+// ListInvitations godoc
+// @Summary List pending invitations
+// @Description List the registration invitations that have not been used, revoked or expired, newest first (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} RegistrationInvitationListResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/invitations [get]
+func (h *InvitationHandler) ListInvitations(c *gin.Context) {
+	invitations, err := h.invitations.ListPending()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list invitations")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+
+	response := RegistrationInvitationListResponse{Invitations: make([]RegistrationInvitationResponse, 0, len(invitations))}
+	for i := range invitations {
+		response.Invitations = append(response.Invitations, registrationInvitationResponse(&invitations[i]))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeInvitation godoc
+// @Summary Revoke an invitation
+// @Description Withdraw a pending registration invitation so its link stops working (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Invitation ID"
+// @Success 200 {object} map[string]string "message: Invitation revoked"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: No pending invitation with this ID"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/invitations/{id} [delete]
+func (h *InvitationHandler) RevokeInvitation(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.invitations.Revoke(id); err != nil {
+		if errors.Is(err, service.ErrInvitationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No pending invitation with this ID"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to revoke invitation")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
+
+// GetInvitation godoc
+// @Summary Check an invitation link
+// @Description Return the email address and role an invitation link registers, so the sign-up form can be prefilled
+// @Tags auth
+// @Produce json
+// @Param token path string true "Token from the invitation link"
+// @Success 200 {object} InvitationDetailsResponse
+// @Failure 404 {object} map[string]string "error: Invalid or expired invitation"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /auth/invitations/{token} [get]
+func (h *InvitationHandler) GetInvitation(c *gin.Context) {
+	invitation, err := h.invitations.Validate(c.Param("token"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidInvitation) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid or expired invitation"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to check invitation")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, InvitationDetailsResponse{
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		ExpiresAt: invitation.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// RegisterWithInvitation godoc
+// @Summary Register with an invitation
+// @Description Create the invited account with the token from an invitation link. The email address and role come from the invitation, and the address needs no further verification.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param registration body InvitationRegisterRequest true "Registration Details"
+// @Success 201 {object} map[string]string "message: Registration successful"
+// @Failure 400 {object} map[string]interface{} "error: Validation error or invalid or expired invitation; violations: password policy rules the password breaks"
+// @Failure 409 {object} map[string]string "error: Email or username already taken, field: email or username"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Failure 503 {object} map[string]string "error: Password breach check unavailable"
+// @Router /auth/register/invite [post]
+func (h *InvitationHandler) RegisterWithInvitation(c *gin.Context) {
+	var input InvitationRegisterRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	if _, err := h.invitations.Register(input.Token, input.Username, input.Password); err != nil {
+		if userExists(c, err) || passwordRejected(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidInvitation) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to register invited user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process registration"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Registration successful. You can now log in.",
+	})
+}
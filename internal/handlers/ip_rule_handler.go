@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"api/internal/ipfilter"
+	"api/internal/models"
+	"api/internal/service"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type IPRuleHandler struct {
+	rules  service.IPRuleService
+	logger *logrus.Logger
+}
+
+func NewIPRuleHandler(rules service.IPRuleService, logger *logrus.Logger) *IPRuleHandler {
+	return &IPRuleHandler{
+		rules:  rules,
+		logger: logger,
+	}
+}
+
+func ipRuleResponse(rule *models.IPRule) IPRuleResponse {
+	return IPRuleResponse{
+		ID:          rule.ID,
+		Path:        rule.Path,
+		Action:      rule.Action,
+		CIDR:        rule.CIDR,
+		Description: rule.Description,
+		CreatedByID: rule.CreatedByID,
+		CreatedAt:   rule.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// ListRules godoc
+// @Summary List IP filter rules
+// @Description List the IP allow and deny rules managed through the API, and the read-only rules from the configuration file (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} IPRuleListResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/ip-rules [get]
+func (h *IPRuleHandler) ListRules(c *gin.Context) {
+	rules, err := h.rules.List()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list IP rules")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch IP rules"})
+		return
+	}
+
+	configured := h.rules.Configured()
+	response := IPRuleListResponse{
+		Rules:      make([]IPRuleResponse, 0, len(rules)),
+		Configured: make([]IPRuleResponse, 0, len(configured)),
+	}
+	for i := range rules {
+		response.Rules = append(response.Rules, ipRuleResponse(&rules[i]))
+	}
+	for _, rule := range configured {
+		response.Configured = append(response.Configured, IPRuleResponse{
+			Path:   rule.Path,
+			Action: rule.Action,
+			CIDR:   rule.Network.String(),
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateRule godoc
+// @Summary Add an IP filter rule
+// @Description Allow or deny an address range on the routes matching a path, or on every route when the path is empty. A matching deny rule always blocks; once allow rules match a route, only their ranges can reach it. The rule applies to this instance at once and to the others within the reload interval. Rules that would block the caller's own address here are refused (admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param rule body CreateIPRuleRequest true "Rule"
+// @Success 201 {object} IPRuleResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 409 {object} map[string]string "error: The rule would block your own address"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/ip-rules [post]
+func (h *IPRuleHandler) CreateRule(c *gin.Context) {
+	var input CreateIPRuleRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	rule := &models.IPRule{
+		Path:        input.Path,
+		Action:      input.Action,
+		CIDR:        input.CIDR,
+		Description: input.Description,
+		CreatedByID: c.GetUint("userID"),
+	}
+	if err := h.rules.Create(rule, clientInfo(c), c.FullPath()); err != nil {
+		switch {
+		case errors.Is(err, ipfilter.ErrInvalidRule):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Provide a path starting with / and an IP address or CIDR range"})
+		case errors.Is(err, service.ErrIPRuleLockout):
+			c.JSON(http.StatusConflict, gin.H{"error": "The rule would block your own address"})
+		default:
+			h.logger.WithError(err).Error("Failed to create IP rule")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create IP rule"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, ipRuleResponse(rule))
+}
+
+// DeleteRule godoc
+// @Summary Delete an IP filter rule
+// @Description Remove an IP filter rule managed through the API. Rules from the configuration file cannot be removed here. Deleting a rule that would leave the caller's own address blocked is refused (admin only).
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Rule ID"
+// @Success 200 {object} map[string]string "message: IP rule deleted"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: Rule not found"
+// @Failure 409 {object} map[string]string "error: Deleting the rule would block your own address"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/ip-rules/{id} [delete]
+func (h *IPRuleHandler) DeleteRule(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.rules.Delete(id, c.GetUint("userID"), clientInfo(c), c.FullPath()); err != nil {
+		switch {
+		case errors.Is(err, service.ErrIPRuleNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		case errors.Is(err, service.ErrIPRuleLockout):
+			c.JSON(http.StatusConflict, gin.H{"error": "Deleting the rule would block your own address"})
+		default:
+			h.logger.WithError(err).Error("Failed to delete IP rule")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete IP rule"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "IP rule deleted"})
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"api/internal/auth"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler struct {
+	keys *auth.KeySet
+}
+
+func NewJWKSHandler(keys *auth.KeySet) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// JWKS godoc
+// @Summary Get access token verification keys
+// @Description Public keys for verifying access token signatures, as a JSON Web Key Set: the current signing key followed by retired keys that are still accepted. Tokens name their key in the kid header. Empty when only HS256 keys are in use.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} auth.JWKSet
+// @Router /.well-known/jwks.json [get]
+func (h *JWKSHandler) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
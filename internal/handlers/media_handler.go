@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"api/internal/storage"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type MediaHandler struct {
+	users           service.UserService
+	avatars         service.AvatarService
+	storage         storage.Storage
+	logger          *logrus.Logger
+	proxy           bool
+	signedURLExpiry time.Duration
+}
+
+func NewMediaHandler(users service.UserService, avatars service.AvatarService, store storage.Storage, logger *logrus.Logger, serveMode string, signedURLExpiry int) *MediaHandler {
+	return &MediaHandler{
+		users:           users,
+		avatars:         avatars,
+		storage:         store,
+		logger:          logger,
+		proxy:           serveMode == "proxy",
+		signedURLExpiry: time.Minute * time.Duration(signedURLExpiry),
+	}
+}
+
+// avatarURL returns the link clients should use to load the profile's avatar.
+// Uploaded avatars are served through the media route; the version parameter
+// changes whenever the profile is updated so cached copies are not reused.
+func avatarURL(profile *models.UserProfile) string {
+	if profile.AvatarKey == "" {
+		return profile.AvatarURL
+	}
+	return fmt.Sprintf("/media/avatars/%d?v=%d", profile.UserID, profile.UpdatedAt.Unix())
+}
+
+// GetAvatar godoc
+// @Summary Get user avatar
+// @Description Serve an uploaded avatar. Redirects to a time limited signed URL when the storage backend supports it, otherwise streams the image.
+// @Tags media
+// @Produce image/jpeg,image/png,image/gif,image/webp
+// @Param id path int true "User ID"
+// @Param size query int false "Thumbnail size in pixels; omit for the full image"
+// @Success 200 {file} binary "Avatar image"
+// @Success 302 {string} string "Redirect to a signed URL"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 404 {object} map[string]string "error: Avatar not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /media/avatars/{id} [get]
+func (h *MediaHandler) GetAvatar(c *gin.Context) {
+	userID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	_, profile, err := h.users.GetProfile(userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to fetch user profile")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch avatar"})
+		return
+	}
+	if profile.AvatarKey == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+		return
+	}
+
+	size := 0
+	if raw := c.Query("size"); raw != "" {
+		if size, err = strconv.Atoi(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid size"})
+			return
+		}
+	}
+	key, err := h.avatars.Key(profile, size)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avatar size not available"})
+		return
+	}
+
+	if signer, ok := h.storage.(storage.URLSigner); ok && !h.proxy {
+		url, err := signer.SignedURL(key, h.signedURLExpiry)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to sign avatar URL")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch avatar"})
+			return
+		}
+		// The redirect must not outlive the signature
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(h.signedURLExpiry.Seconds()/2)))
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+
+	body, contentType, err := h.storage.Get(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to read avatar from storage")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch avatar"})
+		return
+	}
+	defer body.Close()
+
+	c.DataFromReader(http.StatusOK, -1, contentType, body, nil)
+}
+
+// UploadAvatar godoc
+// @Summary Upload avatar
+// @Description Upload a JPEG, PNG or GIF profile picture. The image is re-encoded, scaled down and square thumbnails are generated; the previous avatar is removed.
+// @Tags users
+// @Accept multipart/form-data
+// @Produce json
+// @Security Bearer
+// @Param avatar formData file true "Avatar image"
+// @Success 200 {object} AvatarUploadResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 413 {object} map[string]string "error: Avatar is too large"
+// @Failure 415 {object} map[string]string "error: Unsupported image type"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /users/profile/avatar [post]
+func (h *MediaHandler) UploadAvatar(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	// Leave some room for the multipart envelope; the service enforces the exact limit
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.avatars.MaxUploadBytes()+64<<10)
+
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": service.ErrAvatarTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "avatar file is required"})
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	defer src.Close()
+
+	profile, err := h.avatars.Upload(c.Request.Context(), userID, src)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAvatarTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrAvatarUnsupported):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrAvatarDimensions):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			h.logger.WithError(err).Error("Failed to upload avatar")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload avatar"})
+		}
+		return
+	}
+
+	url := avatarURL(profile)
+	thumbnails := gin.H{}
+	for _, size := range h.avatars.Sizes() {
+		thumbnails[strconv.Itoa(size)] = fmt.Sprintf("%s&size=%d", url, size)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"avatarURL":  url,
+		"thumbnails": thumbnails,
+	})
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type NotificationHandler struct {
+	notifications service.NotificationService
+	logger        *logrus.Logger
+}
+
+func NewNotificationHandler(notifications service.NotificationService, logger *logrus.Logger) *NotificationHandler {
+	return &NotificationHandler{
+		notifications: notifications,
+		logger:        logger,
+	}
+}
+
+// GetPreferences godoc
+// @Summary Get notification preferences
+// @Description Show which notification emails the authenticated user receives. Every notification is enabled until the user changes it.
+// @Tags users
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} NotificationPreferencesResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/notifications [get]
+func (h *NotificationHandler) GetPreferences(c *gin.Context) {
+	prefs, err := h.notifications.Preferences(c.GetUint("userID"))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch notification preferences")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, preferencesResponse(prefs))
+}
+
+// UpdatePreferences godoc
+// @Summary Update notification preferences
+// @Description Turn individual notification emails on or off. Omitted fields keep their current value.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param preferences body UpdateNotificationPreferencesRequest true "Preferences to change"
+// @Success 200 {object} NotificationPreferencesResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/notifications [put]
+func (h *NotificationHandler) UpdatePreferences(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	var input UpdateNotificationPreferencesRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	current, err := h.notifications.Preferences(userID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch notification preferences")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification preferences"})
+		return
+	}
+	settings := service.NotificationSettings{
+		Welcome:         valueOr(input.Welcome, current.Welcome),
+		PasswordChanged: valueOr(input.PasswordChanged, current.PasswordChanged),
+		NewLogin:        valueOr(input.NewLogin, current.NewLogin),
+		RoleChanged:     valueOr(input.RoleChanged, current.RoleChanged),
+	}
+
+	prefs, err := h.notifications.UpdatePreferences(userID, settings)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to update notification preferences")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, preferencesResponse(prefs))
+}
+
+func preferencesResponse(prefs *models.NotificationPreferences) NotificationPreferencesResponse {
+	return NotificationPreferencesResponse{
+		Welcome:         prefs.Welcome,
+		PasswordChanged: prefs.PasswordChanged,
+		NewLogin:        prefs.NewLogin,
+		RoleChanged:     prefs.RoleChanged,
+	}
+}
+
+func valueOr(v *bool, fallback bool) bool {
+	if v == nil {
+		return fallback
+	}
+	return *v
+}
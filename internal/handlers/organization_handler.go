@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type OrganizationHandler struct {
+	organizations service.OrganizationService
+	auth          service.AuthService
+	logger        *logrus.Logger
+}
+
+func NewOrganizationHandler(organizations service.OrganizationService, auth service.AuthService, logger *logrus.Logger) *OrganizationHandler {
+	return &OrganizationHandler{
+		organizations: organizations,
+		auth:          auth,
+		logger:        logger,
+	}
+}
+
+// CreateOrganization godoc
+// @Summary Create an organization
+// @Description Create an organization with the caller as its owner. Refresh the session through the switch endpoint to act for it.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param organization body CreateOrganizationRequest true "Organization"
+// @Success 201 {object} OrganizationResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error or invalid slug"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 409 {object} map[string]string "error: Slug is already taken, field: slug"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /organizations [post]
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	var input CreateOrganizationRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	org, err := h.organizations.Create(c.GetUint("userID"), input.Name, input.Slug)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidSlug):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Slug must be 3-50 lowercase letters, digits and hyphens", "field": "slug"})
+		case errors.Is(err, service.ErrSlugTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": "Slug is already taken", "field": "slug"})
+		default:
+			h.logger.WithError(err).Error("Failed to create organization")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, OrganizationResponse{
+		ID:        org.ID,
+		Name:      org.Name,
+		Slug:      org.Slug,
+		Role:      models.OrgRoleOwner,
+		CreatedAt: org.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+// ListOrganizations godoc
+// @Summary List my organizations
+// @Description List the organizations the caller belongs to with their role in each, and the one the access token acts for
+// @Tags organizations
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} OrganizationListResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /organizations [get]
+func (h *OrganizationHandler) ListOrganizations(c *gin.Context) {
+	memberships, err := h.organizations.Memberships(c.GetUint("userID"))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list organizations")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organizations"})
+		return
+	}
+
+	response := OrganizationListResponse{Organizations: make([]OrganizationResponse, 0, len(memberships))}
+	for _, m := range memberships {
+		response.Organizations = append(response.Organizations, OrganizationResponse{
+			ID:        m.Organization.ID,
+			Name:      m.Organization.Name,
+			Slug:      m.Organization.Slug,
+			Role:      m.Role,
+			CreatedAt: localTime(c, m.Organization.CreatedAt).Format(time.RFC3339),
+		})
+	}
+	if orgID := c.GetUint("orgID"); orgID != 0 {
+		response.Current = &orgID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ListMembers godoc
+// @Summary List organization members
+// @Description List the members of the organization the access token acts for (organization owners and admins)
+// @Tags organizations
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Success 200 {object} OrganizationMemberListResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid organization ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Token does not act for this organization or insufficient organization role"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /organizations/{id}/members [get]
+func (h *OrganizationHandler) ListMembers(c *gin.Context) {
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	members, err := h.organizations.Members(orgID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list organization members")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+		return
+	}
+
+	response := OrganizationMemberListResponse{Members: make([]OrganizationMemberResponse, 0, len(members))}
+	for _, m := range members {
+		response.Members = append(response.Members, OrganizationMemberResponse{
+			UserID:   m.User.ID,
+			Email:    m.User.Email,
+			Username: m.User.Username,
+			Role:     m.Role,
+			JoinedAt: localTime(c, m.JoinedAt).Format(time.RFC3339),
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// InviteMember godoc
+// @Summary Invite a member
+// @Description Email a single-use invitation to join the organization the access token acts for. Owners invite admins and members, admins only members. The link expires after the configured time.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Param invitation body InviteMemberRequest true "Invitation"
+// @Success 201 {object} InvitationResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Token does not act for this organization, insufficient organization role or role cannot be granted"
+// @Failure 404 {object} map[string]string "error: Organization not found"
+// @Failure 409 {object} map[string]string "error: Already a member"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /organizations/{id}/invitations [post]
+func (h *OrganizationHandler) InviteMember(c *gin.Context) {
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	var input InviteMemberRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	invitation, err := h.organizations.Invite(orgID, c.GetUint("userID"), c.GetString("orgRole"), input.Email, input.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvitationRole):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can invite admins"})
+		case errors.Is(err, service.ErrAlreadyMember):
+			c.JSON(http.StatusConflict, gin.H{"error": "Already a member"})
+		case errors.Is(err, service.ErrOrganizationNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		default:
+			h.logger.WithError(err).Error("Failed to invite organization member")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send invitation"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, InvitationResponse{
+		ID:        invitation.ID,
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		ExpiresAt: invitation.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// AcceptInvitation godoc
+// @Summary Accept an organization invitation
+// @Description Join the organization with the token from an invitation link. The invitation must have been sent to the caller's email address. Switch to the organization to act for it.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param invitation body AcceptInvitationRequest true "Invitation token"
+// @Success 200 {object} map[string]interface{} "organizationId, role"
+// @Failure 400 {object} map[string]interface{} "error: Invalid or expired invitation"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 409 {object} map[string]string "error: Already a member"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /organizations/invitations/accept [post]
+func (h *OrganizationHandler) AcceptInvitation(c *gin.Context) {
+	var input AcceptInvitationRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	membership, err := h.organizations.AcceptInvitation(c.GetUint("userID"), input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidInvitation):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		case errors.Is(err, service.ErrAlreadyMember):
+			c.JSON(http.StatusConflict, gin.H{"error": "Already a member"})
+		default:
+			h.logger.WithError(err).Error("Failed to accept organization invitation")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"organizationId": membership.OrganizationID,
+		"role":           membership.Role,
+	})
+}
+
+// TransferOwnership godoc
+// @Summary Transfer organization ownership
+// @Description Offer the organization the access token acts for to another of its members, who is emailed a link to accept it. The caller stays owner until then and becomes an admin afterwards. A new offer replaces a pending one; the link expires after the configured time.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Param transfer body TransferOwnershipRequest true "New owner"
+// @Success 201 {object} OwnershipTransferResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error or not another member"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Token does not act for this organization or caller is not its owner"
+// @Failure 404 {object} map[string]string "error: Organization not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /organizations/{id}/transfer-ownership [post]
+func (h *OrganizationHandler) TransferOwnership(c *gin.Context) {
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	var input TransferOwnershipRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	transfer, err := h.organizations.TransferOwnership(orgID, c.GetUint("userID"), input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTransferRecipient):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ownership can only be transferred to another member"})
+		case errors.Is(err, service.ErrOrganizationNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		default:
+			h.logger.WithError(err).Error("Failed to transfer organization ownership")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, OwnershipTransferResponse{
+		ID:             transfer.ID,
+		OrganizationID: transfer.OrganizationID,
+		ToUserID:       transfer.ToUserID,
+		ExpiresAt:      transfer.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// AcceptOwnership godoc
+// @Summary Accept organization ownership
+// @Description Become the owner of an organization with the token from an ownership transfer link sent to the caller. The previous owner becomes an admin, and both sign in again or refresh for tokens with their new roles.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param transfer body AcceptOwnershipRequest true "Transfer token"
+// @Success 200 {object} map[string]interface{} "organizationId, role"
+// @Failure 400 {object} map[string]interface{} "error: Invalid or expired transfer"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /organizations/ownership-transfers/accept [post]
+func (h *OrganizationHandler) AcceptOwnership(c *gin.Context) {
+	var input AcceptOwnershipRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	transfer, err := h.organizations.AcceptOwnership(c.GetUint("userID"), input.Token)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTransfer) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired ownership transfer"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to accept organization ownership")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept ownership"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"organizationId": transfer.OrganizationID,
+		"role":           models.OrgRoleOwner,
+	})
+}
+
+// SwitchOrganization godoc
+// @Summary Switch organization
+// @Description Exchange the session's refresh token for a token pair acting for another organization the caller belongs to. The refresh token is rotated as by /auth/refresh.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Organization ID"
+// @Param refresh body SwitchOrganizationRequest true "Refresh Token"
+// @Success 200 {object} TokenPairResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Invalid refresh token or reuse detected"
+// @Failure 403 {object} map[string]string "error: Not a member of the organization"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /organizations/{id}/switch [post]
+func (h *OrganizationHandler) SwitchOrganization(c *gin.Context) {
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	var input SwitchOrganizationRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	_, tokens, err := h.auth.SwitchOrganization(c.GetUint("userID"), input.RefreshToken, orgID, clientInfo(c))
+	if err != nil {
+		if accountBlocked(c, err) || passwordExpired(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrNotOrganizationMember):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not a member of the organization"})
+		case errors.Is(err, service.ErrInvalidRefreshToken):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		case errors.Is(err, service.ErrRefreshTokenReused):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, please log in again"})
+		default:
+			h.logger.WithError(err).Error("Failed to switch organization")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to switch organization"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+	})
+}
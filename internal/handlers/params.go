@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"api/internal/auth"
+	"api/internal/i18n"
+	"api/internal/middleware"
+	"api/internal/models"
+	"api/internal/service"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// parseIDParam reads a numeric ID path parameter, writing a 400 response if it is invalid
+func parseIDParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// accountBlocked writes a 403 response if err reports a suspended, banned, deactivated
+// or deleted account
+func accountBlocked(c *gin.Context, err error) bool {
+	if errors.Is(err, service.ErrAccountDeactivated) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account deactivated, open the link sent to your email address to reactivate it", "code": "account_deactivated"})
+		return true
+	}
+	if errors.Is(err, service.ErrAccountPendingDeletion) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account scheduled for deletion, open the link sent to your email address to restore it", "code": "account_pending_deletion"})
+		return true
+	}
+	var blocked *service.AccountBlockedError
+	if !errors.As(err, &blocked) {
+		return false
+	}
+	body := gin.H{"error": "Account suspended", "code": "account_suspended"}
+	switch blocked.Status {
+	case models.UserStatusBanned:
+		body = gin.H{"error": "Account banned", "code": "account_banned"}
+	case models.UserStatusDeactivated:
+		body = gin.H{"error": "Account deactivated", "code": "account_deactivated"}
+	case models.UserStatusPendingDeletion:
+		body = gin.H{"error": "Account scheduled for deletion", "code": "account_pending_deletion"}
+	}
+	if blocked.Until != nil {
+		body["suspendedUntil"] = blocked.Until.UTC().Format(time.RFC3339)
+	}
+	c.JSON(http.StatusForbidden, body)
+	return true
+}
+
+// passwordExpired writes a 403 response if err reports that the password must be reset
+func passwordExpired(c *gin.Context, err error) bool {
+	if !errors.Is(err, service.ErrPasswordExpired) {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Password expired, reset it to sign in", "code": "password_expired"})
+	return true
+}
+
+// deviceUnconfirmed writes a 403 response if err reports a sign-in from an unrecognized
+// device that awaits confirmation
+func deviceUnconfirmed(c *gin.Context, err error) bool {
+	if !errors.Is(err, service.ErrDeviceConfirmationRequired) {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "New device, confirm the sign-in with the link sent to your email address and log in again", "code": "device_confirmation_required"})
+	return true
+}
+
+// linkUnconfirmed writes a 403 response if err reports a sign-in through an identity
+// provider with the email of an account whose holder has not yet confirmed the link
+func linkUnconfirmed(c *gin.Context, err error) bool {
+	if !errors.Is(err, service.ErrLinkConfirmationRequired) {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "An account with this email already exists, confirm the link sent to it and sign in again", "code": "link_confirmation_required"})
+	return true
+}
+
+// loginLocationRejected writes a 403 response if err reports a sign-in refused because
+// of where it came from
+func loginLocationRejected(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrLoginCountryBlocked):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sign-ins from your country are not allowed", "code": "country_blocked"})
+	case errors.Is(err, service.ErrImpossibleTravel):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sign-in refused: your location is too far from your previous sign-in", "code": "impossible_travel"})
+	default:
+		return false
+	}
+	return true
+}
+
+// userExists writes a 409 response naming the taken field if err reports a duplicate
+// email or username
+func userExists(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already registered", "field": "email"})
+	case errors.Is(err, service.ErrUsernameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Username is already taken", "field": "username"})
+	case errors.Is(err, service.ErrUserExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email or username already exists"})
+	default:
+		return false
+	}
+	return true
+}
+
+// passwordRejected writes a 400 response listing the policy violations if err reports
+// a rejected password, or a 503 if the password could not be checked
+func passwordRejected(c *gin.Context, err error) bool {
+	if errors.Is(err, service.ErrPasswordCheckUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Password could not be checked, please try again later"})
+		return true
+	}
+	var rejected *service.PasswordRejectedError
+	if !errors.As(err, &rejected) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Password does not meet the password policy", "violations": rejected.Violations})
+	return true
+}
+
+// clientInfo extracts the caller's device details from the request. The IP decides
+// country blocking and impossible travel, so it is gin's ClientIP: the connection's
+// peer, or the client named by one of server.trustedProxies, never a header the caller
+// set itself.
+func clientInfo(c *gin.Context) service.ClientInfo {
+	return service.ClientInfo{
+		IP:          c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+		Fingerprint: deviceFingerprint(c),
+	}
+}
+
+// deviceFingerprint identifies the caller's device by the X-Device-ID header apps send,
+// or else by the user agent and the content negotiation headers of the browser
+func deviceFingerprint(c *gin.Context) string {
+	if id := strings.TrimSpace(c.GetHeader("X-Device-ID")); id != "" {
+		return auth.HashToken("id:" + id)
+	}
+	return auth.HashToken(strings.Join([]string{
+		c.Request.UserAgent(),
+		c.GetHeader("Accept-Language"),
+		c.GetHeader("Accept-Encoding"),
+	}, "\n"))
+}
+
+// accessToken returns the access token details stored by the auth middleware
+func accessToken(c *gin.Context) service.AccessToken {
+	expiresAt, _ := c.Get("tokenExpiresAt")
+	exp, _ := expiresAt.(time.Time)
+	return service.AccessToken{
+		ID:        c.GetString("tokenID"),
+		UserID:    c.GetUint("userID"),
+		ExpiresAt: exp,
+	}
+}
+
+// withinScopes answers 403 and returns false when the caller is limited to scopes (an
+// API key or a scoped session) and one of scopes is beyond them, so credentials
+// created with a scoped session cannot reach further than it
+func withinScopes(c *gin.Context, scopes []string) bool {
+	if _, limited := c.Get("scopes"); !limited {
+		return true
+	}
+	for _, scope := range scopes {
+		if !auth.HasScope(c.GetStringSlice("scopes"), scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient scope", "code": "insufficient_scope", "scope": scope})
+			return false
+		}
+	}
+	return true
+}
+
+// bindJSON is ShouldBindJSON, also rejecting fields input does not have on routes
+// marked with middleware.StrictJSONMiddleware
+func bindJSON(c *gin.Context, input any) error {
+	if c.GetBool("strictJSON") {
+		return c.ShouldBindWith(input, strictJSON{})
+	}
+	return c.ShouldBindJSON(input)
+}
+
+// strictJSON is binding.JSON with unknown fields rejected
+type strictJSON struct{}
+
+func (strictJSON) Name() string {
+	return "json"
+}
+
+func (strictJSON) Bind(req *http.Request, obj any) error {
+	if req == nil || req.Body == nil {
+		return errors.New("invalid request")
+	}
+	decoder := json.NewDecoder(req.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(obj); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// validationError writes a 400 response describing a rejected request body in the
+// request's locale, with every rejected field under "fields", or 413 when the body was
+// cut off at the size limit
+func validationError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		middleware.BodyTooLarge(c, tooLarge.Limit)
+		return
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field, _ = strconv.Unquote(field)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown field " + field, "code": "unknown_field", "field": field})
+		return
+	}
+	body := gin.H{"error": i18n.Validation(requestLocale(c), err)}
+	if fields := i18n.FieldErrors(requestLocale(c), err); len(fields) > 0 {
+		body["fields"] = fields
+	}
+	c.JSON(http.StatusBadRequest, body)
+}
+
+// requestLocale returns the locale resolved by the locale middleware
+func requestLocale(c *gin.Context) string {
+	if locale := c.GetString("locale"); locale != "" {
+		return locale
+	}
+	return i18n.Default
+}
+
+// chosenLocale is the locale the client asked for in Accept-Language, "" when it
+// named none of the supported ones
+func chosenLocale(c *gin.Context) string {
+	if c.GetString("localeSource") != "header" {
+		return ""
+	}
+	return c.GetString("locale")
+}
+
+// localTime moves t into the authenticated user's timezone, resolved by the locale
+// middleware, leaving it unchanged when they chose none
+func localTime(c *gin.Context, t time.Time) time.Time {
+	if value, ok := c.Get("timezone"); ok {
+		if loc, ok := value.(*time.Location); ok {
+			return t.In(loc)
+		}
+	}
+	return t
+}
+
+// notModified sets Last-Modified to the latest of modified, and a weak ETag with their
+// full precision since the header only has seconds. It writes 304 and returns true when
+// the request's If-None-Match, or else If-Modified-Since, shows the client is current.
+func notModified(c *gin.Context, modified ...time.Time) bool {
+	var latest time.Time
+	tag := make([]string, 0, len(modified))
+	for _, t := range modified {
+		if t.After(latest) {
+			latest = t
+		}
+		tag = append(tag, strconv.FormatInt(t.UnixNano(), 36))
+	}
+	etag := `W/"` + strings.Join(tag, "-") + `"`
+	c.Header("Last-Modified", latest.UTC().Format(http.TimeFormat))
+	c.Header("ETag", etag)
+
+	current := false
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		current = etagMatches(match, strings.TrimPrefix(etag, "W/"))
+	} else if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil {
+		current = !latest.Truncate(time.Second).After(since)
+	}
+	if current {
+		c.Status(http.StatusNotModified)
+	}
+	return current
+}
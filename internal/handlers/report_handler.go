@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type ReportHandler struct {
+	reports service.ReportService
+	logger  *logrus.Logger
+}
+
+func NewReportHandler(reports service.ReportService, logger *logrus.Logger) *ReportHandler {
+	return &ReportHandler{
+		reports: reports,
+		logger:  logger,
+	}
+}
+
+func reportScheduleResponse(schedule *models.ReportSchedule) ReportScheduleResponse {
+	response := ReportScheduleResponse{
+		ID:          schedule.ID,
+		CreatedByID: schedule.CreatedByID,
+		Frequency:   schedule.Frequency,
+		Timezone:    schedule.Timezone,
+		Hour:        schedule.Hour,
+		Recipients:  strings.Split(schedule.Recipients, ","),
+		NextRunAt:   schedule.NextRunAt.Format(time.RFC3339),
+	}
+	if schedule.Frequency == models.ReportWeekly {
+		weekday := schedule.Weekday
+		response.Weekday = &weekday
+	} else {
+		day := schedule.DayOfMonth
+		response.DayOfMonth = &day
+	}
+	if schedule.LastRunAt != nil {
+		response.LastRunAt = schedule.LastRunAt.Format(time.RFC3339)
+	}
+	return response
+}
+
+// CreateSchedule godoc
+// @Summary Schedule a statistics report
+// @Description Email a weekly or monthly summary of signups, active users and security events to the recipients. Weekly reports go out on weekday (0 = Sunday), monthly ones on dayOfMonth (1-28), at hour in the given IANA timezone; each report covers the week or month before it (admin only).
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param schedule body CreateReportScheduleRequest true "Schedule"
+// @Success 201 {object} ReportScheduleResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/reports/schedules [post]
+func (h *ReportHandler) CreateSchedule(c *gin.Context) {
+	var input CreateReportScheduleRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	schedule, err := h.reports.CreateSchedule(c.GetUint("userID"), service.ReportScheduleInput{
+		Frequency:  input.Frequency,
+		Timezone:   input.Timezone,
+		Weekday:    input.Weekday,
+		DayOfMonth: input.DayOfMonth,
+		Hour:       input.Hour,
+		Recipients: input.Recipients,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTimezone) || errors.Is(err, service.ErrInvalidReportSchedule) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to create report schedule")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create report schedule"})
+		return
+	}
+	c.JSON(http.StatusCreated, reportScheduleResponse(schedule))
+}
+
+// ListSchedules godoc
+// @Summary List scheduled reports
+// @Description List the scheduled statistics reports, next run first (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} ReportScheduleListResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/reports/schedules [get]
+func (h *ReportHandler) ListSchedules(c *gin.Context) {
+	schedules, err := h.reports.ListSchedules()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list report schedules")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report schedules"})
+		return
+	}
+
+	response := ReportScheduleListResponse{Schedules: make([]ReportScheduleResponse, 0, len(schedules))}
+	for i := range schedules {
+		response.Schedules = append(response.Schedules, reportScheduleResponse(&schedules[i]))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteSchedule godoc
+// @Summary Delete a scheduled report
+// @Description Stop sending a scheduled statistics report (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Schedule ID"
+// @Success 200 {object} map[string]string "message: Report schedule deleted"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Forbidden - Admin access required"
+// @Failure 404 {object} map[string]string "error: Report schedule not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
+// @Router /admin/reports/schedules/{id} [delete]
+func (h *ReportHandler) DeleteSchedule(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.reports.DeleteSchedule(id); err != nil {
+		if errors.Is(err, service.ErrReportScheduleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Report schedule not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to delete report schedule")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete report schedule"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Report schedule deleted"})
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"api/internal/sso"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// samlRequestCookie carries the ID of the pending authentication request from the
+// login redirect to the ACS, so only responses to requests this browser started are
+// accepted
+const samlRequestCookie = "saml_request"
+
+// samlRequestTTL is how long a user has to sign in at the identity provider, in seconds
+const samlRequestTTL = 10 * 60
+
+type SAMLHandler struct {
+	providers *sso.Registry
+	auth      service.AuthService
+	logger    *logrus.Logger
+	// completeURL receives the tokens in its fragment after sign-in; the ACS answers
+	// with JSON when it is empty
+	completeURL  string
+	secureCookie bool
+}
+
+func NewSAMLHandler(providers *sso.Registry, auth service.AuthService, logger *logrus.Logger, completeURL string, secureCookie bool) *SAMLHandler {
+	return &SAMLHandler{providers: providers, auth: auth, logger: logger, completeURL: completeURL, secureCookie: secureCookie}
+}
+
+// provider looks up the identity provider named in the path, answering 404 if unknown
+func (h *SAMLHandler) provider(c *gin.Context) (*sso.Provider, bool) {
+	provider, err := h.providers.Provider(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity provider not found"})
+		return nil, false
+	}
+	return provider, true
+}
+
+// Metadata godoc
+// @Summary Get SAML service provider metadata
+// @Description SAML 2.0 metadata of this service provider for the named identity provider: entity ID, assertion consumer service and, when configured, the certificate used to sign requests and decrypt assertions. Register it with the identity provider.
+// @Tags auth
+// @Produce xml
+// @Param provider path string true "Identity provider name"
+// @Success 200 {string} string "EntityDescriptor XML"
+// @Failure 404 {object} map[string]string "error: Identity provider not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /auth/saml/{provider}/metadata [get]
+func (h *SAMLHandler) Metadata(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+	metadata, err := provider.Metadata()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to build SAML metadata")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build metadata"})
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// Login godoc
+// @Summary Start SAML sign-in
+// @Description Redirect the browser to the identity provider with a SAML authentication request. The request ID is kept in a short-lived cookie scoped to the ACS, which only accepts the response to it.
+// @Tags auth
+// @Param provider path string true "Identity provider name"
+// @Success 302 "Redirect to the identity provider"
+// @Failure 404 {object} map[string]string "error: Identity provider not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /auth/saml/{provider}/login [get]
+func (h *SAMLHandler) Login(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+	redirect, requestID, err := provider.AuthnRequest()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to create SAML authentication request")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+	h.setRequestCookie(c, requestID, samlRequestTTL)
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// ACS godoc
+// @Summary SAML assertion consumer service
+// @Description Receive the identity provider's SAML response (HTTP-POST binding). The signature, issuer, audience, recipient, validity window and InResponseTo are checked; unsolicited responses are rejected. The user is found by the identity provider and NameID, and created on first sign-in with the role mapped from their groups, which later sign-ins keep up to date. An existing account with the same email is not signed in to: it is mailed a link to confirm binding it to the NameID, and the ACS answers 403 with code link_confirmation_required. Linked accounts keep their password and role. Answers with a token pair, or redirects to the configured completion URL with the tokens in the fragment.
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param provider path string true "Identity provider name"
+// @Param SAMLResponse formData string true "Base64 encoded SAML response"
+// @Success 200 {object} TokenResponse
+// @Success 303 "Redirect to the completion URL with access_token and refresh_token in the fragment"
+// @Failure 400 {object} map[string]interface{} "error: No sign-in in progress"
+// @Failure 401 {object} map[string]string "error: Invalid SAML response"
+// @Failure 403 {object} map[string]string "error: Account suspended, banned, deactivated or pending deletion, sign-in location refused, new device or unconfirmed link, code: account_suspended, account_banned, account_deactivated, account_pending_deletion, country_blocked, impossible_travel, device_confirmation_required or link_confirmation_required"
+// @Failure 404 {object} map[string]string "error: Identity provider not found"
+// @Failure 409 {object} map[string]string "error: Username is already taken, field: username"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /auth/saml/{provider}/acs [post]
+func (h *SAMLHandler) ACS(c *gin.Context) {
+	provider, ok := h.provider(c)
+	if !ok {
+		return
+	}
+	// Without the cookie an unsolicited response would be checked against no request
+	requestID, err := c.Cookie(samlRequestCookie)
+	if err != nil || requestID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No sign-in in progress"})
+		return
+	}
+	h.setRequestCookie(c, "", -1)
+
+	identity, err := provider.Identity(c.Request, requestID)
+	if err != nil {
+		h.logger.WithError(err).WithField("provider", c.Param("provider")).Warn("Rejected SAML response")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid SAML response"})
+		return
+	}
+
+	user, tokens, err := h.auth.SignInExternal(service.ExternalIdentity{
+		Source:   models.AuthSourceSAML,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		Username: identity.Username,
+		Role:     identity.Role,
+	}, clientInfo(c))
+	if err != nil {
+		if accountBlocked(c, err) || userExists(c, err) || loginLocationRejected(c, err) || deviceUnconfirmed(c, err) || linkUnconfirmed(c, err) {
+			return
+		}
+		h.logger.WithError(err).Error("Failed to complete SAML sign-in")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete login"})
+		return
+	}
+
+	if h.completeURL != "" {
+		fragment := url.Values{
+			"access_token":  {tokens.AccessToken},
+			"refresh_token": {tokens.RefreshToken},
+		}
+		c.Redirect(http.StatusSeeOther, h.completeURL+"#"+fragment.Encode())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"user": gin.H{
+			"id":       user.ID,
+			"email":    user.Email,
+			"username": user.Username,
+			"role":     user.Role,
+		},
+	})
+}
+
+// setRequestCookie sets or, with a negative maxAge, clears the request ID cookie. The
+// identity provider posts to the ACS from another site, so over HTTPS the cookie is
+// SameSite=None.
+func (h *SAMLHandler) setRequestCookie(c *gin.Context, requestID string, maxAge int) {
+	path := strings.TrimSuffix(strings.TrimSuffix(c.Request.URL.Path, "/login"), "/acs") + "/acs"
+	sameSite := http.SameSiteLaxMode
+	if h.secureCookie {
+		sameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     samlRequestCookie,
+		Value:    requestID,
+		Path:     path,
+		MaxAge:   maxAge,
+		Secure:   h.secureCookie,
+		HttpOnly: true,
+		SameSite: sameSite,
+	})
+}
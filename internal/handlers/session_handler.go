@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"api/internal/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type SessionHandler struct {
+	sessions service.SessionService
+	logger   *logrus.Logger
+}
+
+func NewSessionHandler(sessions service.SessionService, logger *logrus.Logger) *SessionHandler {
+	return &SessionHandler{
+		sessions: sessions,
+		logger:   logger,
+	}
+}
+
+// ListSessions godoc
+// @Summary List active sessions
+// @Description List the authenticated user's active sessions with device details captured at login
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} SessionsListResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/sessions [get]
+func (h *SessionHandler) ListSessions(c *gin.Context) {
+	userID := c.GetUint("userID")
+	currentSession := c.GetString("sessionID")
+
+	tokens, err := h.sessions.ListSessions(userID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list sessions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	sessions := make([]gin.H, 0, len(tokens))
+	for _, t := range tokens {
+		createdAt := t.SessionStartedAt
+		if createdAt.IsZero() {
+			createdAt = t.CreatedAt
+		}
+		lastUsedAt := t.LastUsedAt
+		if lastUsedAt.IsZero() {
+			lastUsedAt = t.CreatedAt
+		}
+
+		sessions = append(sessions, gin.H{
+			"id":         t.ID,
+			"ipAddress":  t.IPAddress,
+			"userAgent":  t.UserAgent,
+			"createdAt":  localTime(c, createdAt),
+			"lastUsedAt": localTime(c, lastUsedAt),
+			"expiresAt":  localTime(c, t.ExpiresAt),
+			"current":    currentSession != "" && t.FamilyID == currentSession,
+			"scopes":     service.SplitScopes(t.Scopes),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession godoc
+// @Summary Revoke a session
+// @Description Log out one of the authenticated user's sessions
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Session ID"
+// @Success 200 {object} map[string]string "message: Session revoked"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 404 {object} map[string]string "error: Session not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/sessions/{id} [delete]
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	userID := c.GetUint("userID")
+	sessionID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.sessions.RevokeSession(userID, sessionID); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to revoke session")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions godoc
+// @Summary Revoke all other sessions
+// @Description Log out every session of the authenticated user except the one making the request
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "message: Other sessions revoked, revoked: count"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/sessions [delete]
+func (h *SessionHandler) RevokeOtherSessions(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	count, err := h.sessions.RevokeOtherSessions(userID, c.GetString("sessionID"))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to revoke sessions")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Other sessions revoked",
+		"revoked": count,
+	})
+}
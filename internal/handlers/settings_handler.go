@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"api/internal/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type SettingsHandler struct {
+	settings service.SettingsService
+	logger   *logrus.Logger
+}
+
+func NewSettingsHandler(settings service.SettingsService, logger *logrus.Logger) *SettingsHandler {
+	return &SettingsHandler{
+		settings: settings,
+		logger:   logger,
+	}
+}
+
+func settingsResponse(c *gin.Context, settings *service.Settings) SettingsResponse {
+	response := SettingsResponse{
+		Locale:           settings.Locale,
+		Timezone:         settings.Timezone,
+		Theme:            settings.Theme,
+		MarketingConsent: settings.MarketingConsent,
+		Notifications: NotificationPreferencesResponse{
+			Welcome:         settings.Notifications.Welcome,
+			PasswordChanged: settings.Notifications.PasswordChanged,
+			NewLogin:        settings.Notifications.NewLogin,
+			RoleChanged:     settings.Notifications.RoleChanged,
+		},
+	}
+	if settings.MarketingConsentAt != nil {
+		at := localTime(c, *settings.MarketingConsentAt)
+		response.MarketingConsentAt = &at
+	}
+	return response
+}
+
+// GetSettings godoc
+// @Summary Get account settings
+// @Description Get the authenticated user's settings: locale, timezone, theme, marketing consent and notification emails. Timestamps in responses and notification emails use the timezone, and emails the locale.
+// @Tags users
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} SettingsResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/settings [get]
+func (h *SettingsHandler) GetSettings(c *gin.Context) {
+	settings, err := h.settings.Get(c.GetUint("userID"))
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to fetch settings")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
+		return
+	}
+	c.JSON(http.StatusOK, settingsResponse(c, settings))
+}
+
+// UpdateSettings godoc
+// @Summary Update account settings
+// @Description Change account settings; omitted fields keep their value. Every field is checked before any is saved and the rejected ones are listed in fields. Changes of marketing consent are recorded in the audit trail.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param settings body UpdateSettingsRequest true "Settings to change"
+// @Success 200 {object} SettingsResponse
+// @Failure 400 {object} map[string]interface{} "error: Invalid settings, fields: reason by field"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/settings [put]
+func (h *SettingsHandler) UpdateSettings(c *gin.Context) {
+	var input UpdateSettingsRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	update := service.SettingsUpdate{
+		Locale:           input.Locale,
+		Timezone:         input.Timezone,
+		Theme:            input.Theme,
+		MarketingConsent: input.MarketingConsent,
+	}
+	if n := input.Notifications; n != nil {
+		update.Notifications = service.NotificationUpdate{
+			Welcome:         n.Welcome,
+			PasswordChanged: n.PasswordChanged,
+			NewLogin:        n.NewLogin,
+			RoleChanged:     n.RoleChanged,
+		}
+	}
+
+	settings, err := h.settings.Update(c.GetUint("userID"), update, clientInfo(c))
+	if err != nil {
+		var invalid *service.SettingsError
+		switch {
+		case errors.As(err, &invalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid settings", "fields": invalid.Fields})
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			h.logger.WithError(err).Error("Failed to update settings")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update settings"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, settingsResponse(c, settings))
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"api/internal/service"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type ShareTokenHandler struct {
+	tokens service.ShareTokenService
+	logger *logrus.Logger
+}
+
+func NewShareTokenHandler(tokens service.ShareTokenService, logger *logrus.Logger) *ShareTokenHandler {
+	return &ShareTokenHandler{
+		tokens: tokens,
+		logger: logger,
+	}
+}
+
+func shareTokenJSON(token *models.ShareToken) gin.H {
+	return gin.H{
+		"id":         token.ID,
+		"app":        token.App,
+		"prefix":     token.Prefix,
+		"fields":     strings.Split(token.Fields, ","),
+		"createdAt":  token.CreatedAt,
+		"expiresAt":  token.ExpiresAt,
+		"lastUsedAt": token.LastUsedAt,
+	}
+}
+
+// CreateShareToken godoc
+// @Summary Share profile fields with an app
+// @Description Create a token letting a third-party app read the chosen fields of the authenticated user's profile, and nothing else, until it expires or is revoked. Fields: any profile field (firstName, lastName, preferredName, pronouns, honorific, bio, avatarURL, locale, timezone), displayName (the preferred name, else the full name, else the username), username or email. The token is only returned once; the app sends it in the X-Share-Token header to GET /shared/profile.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param token body CreateShareTokenRequest true "App and shared fields"
+// @Success 201 {object} CreateShareTokenResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error or field cannot be shared"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/share-tokens [post]
+func (h *ShareTokenHandler) CreateShareToken(c *gin.Context) {
+	var input CreateShareTokenRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	var expiresAt *time.Time
+	if input.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	token, plaintext, err := h.tokens.Create(c.GetUint("userID"), input.App, input.Fields, expiresAt)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidShareField) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to create share token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share token"})
+		return
+	}
+
+	response := shareTokenJSON(token)
+	response["token"] = plaintext
+	c.JSON(http.StatusCreated, response)
+}
+
+// ListShareTokens godoc
+// @Summary List share tokens
+// @Description List the apps the authenticated user shares profile fields with (without the secret part of the tokens)
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} ShareTokensListResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/share-tokens [get]
+func (h *ShareTokenHandler) ListShareTokens(c *gin.Context) {
+	tokens, err := h.tokens.List(c.GetUint("userID"))
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list share tokens")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch share tokens"})
+		return
+	}
+
+	list := make([]gin.H, 0, len(tokens))
+	for i := range tokens {
+		list = append(list, shareTokenJSON(&tokens[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"shareTokens": list})
+}
+
+// RevokeShareToken godoc
+// @Summary Revoke a share token
+// @Description Stop sharing profile fields with an app; its token is refused from then on
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Share token ID"
+// @Success 200 {object} map[string]string "message: Share token revoked"
+// @Failure 400 {object} map[string]interface{} "error: Invalid ID"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 404 {object} map[string]string "error: Share token not found"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/share-tokens/{id} [delete]
+func (h *ShareTokenHandler) RevokeShareToken(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.tokens.Revoke(c.GetUint("userID"), id); err != nil {
+		if errors.Is(err, service.ErrShareTokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Share token not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to revoke share token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke share token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share token revoked"})
+}
+
+// GetSharedProfile godoc
+// @Summary Read shared profile fields
+// @Description For third-party apps: the profile fields the user shared with the app holding the token, by name. Unset fields are empty strings. Tokens that expired or were revoked, and those of accounts that are not active, are refused.
+// @Tags shared
+// @Produce json
+// @Param X-Share-Token header string true "Share token"
+// @Success 200 {object} SharedProfileResponse
+// @Failure 401 {object} map[string]string "error: Invalid share token"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /shared/profile [get]
+func (h *ShareTokenHandler) GetSharedProfile(c *gin.Context) {
+	shared, err := h.tokens.Resolve(c.GetHeader("X-Share-Token"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidShareToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid share token"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to resolve share token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shared profile"})
+		return
+	}
+
+	if _, ok := shared.Fields["avatarURL"]; ok {
+		shared.Fields["avatarURL"] = avatarURL(shared.Profile)
+	}
+	c.JSON(http.StatusOK, gin.H{"fields": shared.Fields})
+}
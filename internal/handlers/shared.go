@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Helpers shared with the handlers of later API versions, which live in their own
+// packages (internal/handlers/v2) so each version's Swagger document is generated
+// from its own handlers, and with the GraphQL resolvers (internal/graph)
+
+// AvatarURL is the URL the profile's avatar is served at
+func AvatarURL(profile *models.UserProfile) string {
+	return avatarURL(profile)
+}
+
+// LocalTime moves t into the authenticated user's timezone
+func LocalTime(c *gin.Context, t time.Time) time.Time {
+	return localTime(c, t)
+}
+
+// NotModified answers conditional requests, see notModified
+func NotModified(c *gin.Context, modified ...time.Time) bool {
+	return notModified(c, modified...)
+}
+
+// SelectFields applies the fields query parameter to v, see selectFields
+func SelectFields(c *gin.Context, v any) any {
+	return selectFields(c, v)
+}
+
+// SetMeta adds key to the meta object of the response envelope
+func SetMeta(c *gin.Context, key string, value any) {
+	setMeta(c, key, value)
+}
+
+// ProfileUpdateError maps profile validation errors to a 400 response body, see
+// profileUpdateError
+func ProfileUpdateError(err error) (gin.H, bool) {
+	return profileUpdateError(err)
+}
@@ -1,10 +1,12 @@
 package handlers
 
+import "time"
+
 // RegisterRequest represents the registration request body
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email" example:"user@example.com"`
-	Username string `json:"username" binding:"required,min=3" example:"johndoe"`
-	Password string `json:"password" binding:"required,min=8" example:"strongpassword123"`
+	Username string `json:"username" binding:"required,min=3,max=50,username" example:"johndoe"`
+	Password string `json:"password" binding:"required" example:"strongpassword123"`
 }
 
 // LoginRequest represents the login request body
@@ -13,6 +15,17 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required" example:"strongpassword123"`
 }
 
+// PasswordResetRequest asks for a password reset link
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email" example:"user@example.com"`
+}
+
+// ResetPasswordRequest sets a new password with a reset link token
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required" example:"3q2-7wEAAAA..."`
+	NewPassword string `json:"newPassword" binding:"required" example:"newpassword123"`
+}
+
 // TokenResponse represents the response containing tokens
 type TokenResponse struct {
 	AccessToken  string       `json:"access_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
@@ -28,6 +41,15 @@ type UserResponse struct {
 	Role     string `json:"role" example:"user"`
 }
 
+// ImpersonationResponse is an access token without a refresh token: one acting as User
+// for the admin ImpersonatorID, or the admin's own after leaving the impersonation
+type ImpersonationResponse struct {
+	AccessToken    string       `json:"access_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	ExpiresAt      string       `json:"expiresAt" example:"2024-08-05T09:45:00Z"`
+	ImpersonatorID uint         `json:"impersonatorId,omitempty" example:"1"`
+	User           UserResponse `json:"user"`
+}
+
 // RefreshTokenRequest represents the refresh token request
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
@@ -47,30 +69,107 @@ type TokenPairResponse struct {
 
 // UpdateProfileRequest represents the profile update request
 type UpdateProfileRequest struct {
-	FirstName string `json:"firstName" example:"John"`
-	LastName  string `json:"lastName" example:"Doe"`
-	Bio       string `json:"bio" example:"Software Developer"`
-	AvatarURL string `json:"avatarURL" example:"https://example.com/avatar.jpg"`
+	FirstName     string `json:"firstName" example:"John"`
+	LastName      string `json:"lastName" example:"Doe"`
+	Bio           string `json:"bio" example:"Software Developer"`
+	AvatarURL     string `json:"avatarURL" binding:"omitempty,httpurl" example:"https://example.com/avatar.jpg"`
+	Locale        string `json:"locale" example:"es"`
+	PreferredName string `json:"preferredName" binding:"max=100" example:"Johnny"`
+	Pronouns      string `json:"pronouns" binding:"max=40" example:"he/him"`
+	Honorific     string `json:"honorific" binding:"max=20" example:"Dr."`
+	Timezone      string `json:"timezone" binding:"max=64" example:"Europe/Berlin"`
+	// Visibility sets fields to public or private in the directory; omitted keeps the current settings
+	Visibility map[string]string `json:"visibility,omitempty" binding:"omitempty,dive,keys,oneof=firstName lastName preferredName pronouns honorific bio avatarURL locale timezone,endkeys,oneof=public private"`
 }
 
 // ProfileResponse represents the profile information in responses
 type ProfileResponse struct {
-	FirstName string `json:"firstName" example:"John"`
-	LastName  string `json:"lastName" example:"Doe"`
-	Bio       string `json:"bio" example:"Software Developer"`
-	AvatarURL string `json:"avatarURL" example:"https://example.com/avatar.jpg"`
+	FirstName     string            `json:"firstName" example:"John"`
+	LastName      string            `json:"lastName" example:"Doe"`
+	PreferredName string            `json:"preferredName" example:"Johnny"`
+	Pronouns      string            `json:"pronouns" example:"he/him"`
+	Honorific     string            `json:"honorific" example:"Dr."`
+	Bio           string            `json:"bio" example:"Software Developer"`
+	AvatarURL     string            `json:"avatarURL" example:"https://example.com/avatar.jpg"`
+	Locale        string            `json:"locale" example:"es"`
+	Timezone      string            `json:"timezone" example:"Europe/Berlin"`
+	Visibility    map[string]string `json:"visibility"`
+}
+
+// UpdateProfileResponse is the profile after an update
+type UpdateProfileResponse struct {
+	Profile ProfileResponse `json:"profile"`
+}
+
+// DirectoryEntry is a user as listed in the directory; profile fields the user made
+// private are left out
+type DirectoryEntry struct {
+	ID       uint   `json:"id" example:"1"`
+	Username string `json:"username" example:"johndoe"`
+	Profile  struct {
+		FirstName     string `json:"firstName,omitempty" example:"John"`
+		LastName      string `json:"lastName,omitempty" example:"Doe"`
+		PreferredName string `json:"preferredName,omitempty" example:"Johnny"`
+		Pronouns      string `json:"pronouns,omitempty" example:"he/him"`
+		Honorific     string `json:"honorific,omitempty" example:"Dr."`
+		Bio           string `json:"bio,omitempty" example:"Software Developer"`
+		AvatarURL     string `json:"avatarURL,omitempty" example:"https://example.com/avatar.jpg"`
+		Locale        string `json:"locale,omitempty" example:"es"`
+		Timezone      string `json:"timezone,omitempty" example:"Europe/Berlin"`
+	} `json:"profile"`
+}
+
+// DirectoryResponse represents the user directory
+type DirectoryResponse struct {
+	Users []DirectoryEntry `json:"users"`
+}
+
+// AvatarUploadResponse is returned after a successful avatar upload
+type AvatarUploadResponse struct {
+	AvatarURL  string            `json:"avatarURL" example:"/media/avatars/1?v=1722846600"`
+	Thumbnails map[string]string `json:"thumbnails"`
 }
 
 // UserProfileResponse represents the complete user profile response
 type UserProfileResponse struct {
-	User    UserResponse    `json:"user"`
-	Profile ProfileResponse `json:"profile"`
+	User         UserResponse                `json:"user"`
+	Profile      ProfileResponse             `json:"profile"`
+	Completeness ProfileCompletenessResponse `json:"completeness"`
+	Features     []string                    `json:"features" example:"profile-editor"` // feature flags on for the user
+}
+
+// ProfileCompletenessResponse tells how much of the profile is filled in
+type ProfileCompletenessResponse struct {
+	Score           int      `json:"score" example:"60"` // percent of the field weights filled in
+	Missing         []string `json:"missing" example:"bio,avatarURL,lastName"`
+	MissingRequired []string `json:"missingRequired" example:"lastName"`
+}
+
+// IncompleteProfileResponse is a user listed by the incomplete profiles report
+type IncompleteProfileResponse struct {
+	ID           uint                        `json:"id" example:"1"`
+	Email        string                      `json:"email" example:"john@example.com"`
+	Username     string                      `json:"username" example:"johndoe"`
+	CreatedAt    time.Time                   `json:"createdAt"`
+	Completeness ProfileCompletenessResponse `json:"completeness"`
+}
+
+// IncompleteProfilesResponse lists the active users whose profile scores below threshold
+type IncompleteProfilesResponse struct {
+	Threshold int                         `json:"threshold" example:"80"`
+	Users     []IncompleteProfileResponse `json:"users"`
 }
 
 // ChangePasswordRequest represents the password change request
 type ChangePasswordRequest struct {
 	CurrentPassword string `json:"currentPassword" binding:"required" example:"oldpassword123"`
-	NewPassword     string `json:"newPassword" binding:"required,min=8" example:"newpassword123"`
+	NewPassword     string `json:"newPassword" binding:"required" example:"newpassword123"`
+}
+
+// ChangePasswordResponse represents the response after a password change
+type ChangePasswordResponse struct {
+	Message            string `json:"message" example:"Password changed successfully"`
+	TerminatedSessions int    `json:"terminatedSessions" example:"2"`
 }
 
 // ChangeRoleRequest represents the role change request
@@ -92,10 +191,763 @@ type UsersListResponse struct {
 		Username  string `json:"username" example:"johndoe"`
 		Role      string `json:"role" example:"user"`
 		Verified  bool   `json:"verified" example:"true"`
+		Status    string `json:"status" example:"active"`
 		CreatedAt string `json:"createdAt" example:"2025-08-04T12:00:00Z"`
 		Profile   struct {
-			FirstName string `json:"firstName" example:"John"`
-			LastName  string `json:"lastName" example:"Doe"`
+			FirstName     string `json:"firstName" example:"John"`
+			LastName      string `json:"lastName" example:"Doe"`
+			PreferredName string `json:"preferredName" example:"Johnny"`
+			Pronouns      string `json:"pronouns" example:"he/him"`
+			Honorific     string `json:"honorific" example:"Dr."`
 		} `json:"profile"`
 	} `json:"users"`
 }
+
+// UserSearchResponse lists the users matching a search, most relevant first
+type UserSearchResponse struct {
+	Query string           `json:"query" example:"jon smith"`
+	Users []UserSearchItem `json:"users"`
+}
+
+// UserSearchItem is a user matching a search. Highlights holds the matching fields
+// (email, username, name), HTML escaped, with the matching words wrapped in <mark>.
+type UserSearchItem struct {
+	ID         uint              `json:"id" example:"1"`
+	Email      string            `json:"email" example:"john.smith@example.com"`
+	Username   string            `json:"username" example:"jsmith"`
+	Role       string            `json:"role" example:"user"`
+	Verified   bool              `json:"verified" example:"true"`
+	Status     string            `json:"status" example:"active"`
+	FirstName  string            `json:"firstName" example:"John"`
+	LastName   string            `json:"lastName" example:"Smith"`
+	Score      float64           `json:"score" example:"0.62"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// EmailWebhookEvent represents a single event delivered by an email provider webhook
+type EmailWebhookEvent struct {
+	MessageID string `json:"message_id" example:"3f2a9c0d1b7e4a55"`
+	Event     string `json:"event" example:"delivered"`
+	Email     string `json:"email" example:"user@example.com"`
+	Template  string `json:"template,omitempty" example:"verification"`
+}
+
+// EmailTemplateStats represents deliverability counters for one email template
+type EmailTemplateStats struct {
+	Template     string  `json:"template" example:"verification"`
+	Sent         int     `json:"sent" example:"120"`
+	Delivered    int     `json:"delivered" example:"118"`
+	Opened       int     `json:"opened" example:"87"`
+	Bounced      int     `json:"bounced" example:"2"`
+	DeliveryRate float64 `json:"deliveryRate" example:"0.98"`
+	BounceRate   float64 `json:"bounceRate" example:"0.02"`
+}
+
+// EmailStatsResponse represents the email deliverability statistics response
+type EmailStatsResponse struct {
+	Templates []EmailTemplateStats `json:"templates"`
+}
+
+// AdminUserDocument is the editable representation of a user targeted by PATCH /admin/users/{id}
+type AdminUserDocument struct {
+	Email         string                   `json:"email" binding:"required,email" example:"user@example.com"`
+	Username      string                   `json:"username" binding:"required,min=3,max=50,username" example:"johndoe"`
+	Role          string                   `json:"role" binding:"required,oneof=user admin" example:"user"`
+	EmailVerified bool                     `json:"emailVerified" example:"true"`
+	Profile       AdminUserProfileDocument `json:"profile"`
+}
+
+// PatchedUserResponse is the document of a user after PATCH /admin/users/{id}, with the user's ID
+type PatchedUserResponse struct {
+	ID uint `json:"id" example:"1"`
+	AdminUserDocument
+}
+
+// AdminUserProfileDocument holds the profile part of AdminUserDocument
+type AdminUserProfileDocument struct {
+	FirstName     string            `json:"firstName" example:"John"`
+	LastName      string            `json:"lastName" example:"Doe"`
+	Bio           string            `json:"bio" example:"Software Developer"`
+	AvatarURL     string            `json:"avatarURL" binding:"omitempty,httpurl" example:"https://example.com/avatar.jpg"`
+	Locale        string            `json:"locale" example:"es"`
+	PreferredName string            `json:"preferredName" binding:"max=100" example:"Johnny"`
+	Pronouns      string            `json:"pronouns" binding:"max=40" example:"he/him"`
+	Honorific     string            `json:"honorific" binding:"max=20" example:"Dr."`
+	Timezone      string            `json:"timezone" binding:"max=64" example:"Europe/Berlin"`
+	Visibility    map[string]string `json:"visibility"`
+}
+
+// JSONPatchOperation represents one RFC 6902 JSON Patch operation
+type JSONPatchOperation struct {
+	Op    string      `json:"op" example:"replace"`
+	Path  string      `json:"path" example:"/profile/firstName"`
+	From  string      `json:"from,omitempty" example:""`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// SessionResponse represents an active login session
+type SessionResponse struct {
+	ID         uint   `json:"id" example:"12"`
+	IPAddress  string `json:"ipAddress" example:"203.0.113.7"`
+	UserAgent  string `json:"userAgent" example:"Mozilla/5.0 (X11; Linux x86_64)"`
+	CreatedAt  string `json:"createdAt" example:"2025-08-04T12:00:00Z"`
+	LastUsedAt string `json:"lastUsedAt" example:"2025-08-05T08:30:00Z"`
+	ExpiresAt  string `json:"expiresAt" example:"2025-08-11T12:00:00Z"`
+	Current    bool   `json:"current" example:"true"`
+	// Scopes of a scoped session, empty for a full one
+	Scopes []string `json:"scopes" example:"profile:read"`
+}
+
+// CreateScopedSessionRequest lists the scopes of a new scoped session
+type CreateScopedSessionRequest struct {
+	Scopes []string `json:"scopes" binding:"required,min=1" example:"profile:read"`
+}
+
+// SessionsListResponse represents the list of the user's active sessions
+type SessionsListResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// TrustedDeviceResponse represents a device the user confirmed signing in from
+type TrustedDeviceResponse struct {
+	ID         uint   `json:"id" example:"4"`
+	UserAgent  string `json:"userAgent" example:"Mozilla/5.0 (X11; Linux x86_64)"`
+	IPAddress  string `json:"ipAddress" example:"203.0.113.7"`
+	CreatedAt  string `json:"createdAt" example:"2025-08-04T12:00:00Z"`
+	LastSeenAt string `json:"lastSeenAt" example:"2025-08-05T08:30:00Z"`
+	Current    bool   `json:"current" example:"true"`
+}
+
+// TrustedDevicesListResponse represents the list of the user's trusted devices
+type TrustedDevicesListResponse struct {
+	Devices []TrustedDeviceResponse `json:"devices"`
+}
+
+// ConfirmDeviceRequest carries the token from a device confirmation link
+type ConfirmDeviceRequest struct {
+	Token string `json:"token" binding:"required" example:"3q2-7wAA..."`
+}
+
+// ConfirmExternalLoginRequest carries the token from a link confirmation email
+type ConfirmExternalLoginRequest struct {
+	Token string `json:"token" binding:"required" example:"3q2-7wAA..."`
+}
+
+// CreateAPIKeyRequest represents the API key creation request
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required" example:"CI deploy script"`
+	Scopes        []string `json:"scopes" binding:"required" example:"profile:read"`
+	ExpiresInDays int      `json:"expiresInDays" example:"90"`
+}
+
+// APIKeyResponse represents an API key without its secret
+type APIKeyResponse struct {
+	ID            uint     `json:"id" example:"3"`
+	Name          string   `json:"name" example:"CI deploy script"`
+	Prefix        string   `json:"prefix" example:"umk_1a2b3c4d"`
+	Scopes        []string `json:"scopes" example:"profile:read"`
+	CreatedAt     string   `json:"createdAt" example:"2025-08-04T12:00:00Z"`
+	ExpiresAt     string   `json:"expiresAt,omitempty" example:"2025-11-02T12:00:00Z"`
+	LastUsedAt    string   `json:"lastUsedAt,omitempty" example:"2025-08-05T08:30:00Z"`
+	Suspended     bool     `json:"suspended" example:"false"`
+	SuspendReason string   `json:"suspendReason" example:""`
+}
+
+// CreateAPIKeyResponse represents a newly created API key including the one-time plaintext key
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key" example:"umk_1a2b3c4d5e6f..."`
+}
+
+// APIKeysListResponse represents the list of the user's API keys
+type APIKeysListResponse struct {
+	APIKeys []APIKeyResponse `json:"apiKeys"`
+}
+
+// CreateShareTokenRequest names the app a share token is for and the fields it may read
+type CreateShareTokenRequest struct {
+	App           string   `json:"app" binding:"required,max=100" example:"Acme Chat"`
+	Fields        []string `json:"fields" binding:"required,min=1" example:"displayName,avatarURL"`
+	ExpiresInDays int      `json:"expiresInDays" binding:"min=0,max=3650" example:"365"`
+}
+
+// ShareTokenResponse represents a share token without its secret
+type ShareTokenResponse struct {
+	ID         uint     `json:"id" example:"5"`
+	App        string   `json:"app" example:"Acme Chat"`
+	Prefix     string   `json:"prefix" example:"ums_1a2b3c4d"`
+	Fields     []string `json:"fields" example:"displayName,avatarURL"`
+	CreatedAt  string   `json:"createdAt" example:"2025-08-04T12:00:00Z"`
+	ExpiresAt  string   `json:"expiresAt,omitempty" example:"2026-08-04T12:00:00Z"`
+	LastUsedAt string   `json:"lastUsedAt,omitempty" example:"2025-08-05T08:30:00Z"`
+}
+
+// CreateShareTokenResponse represents a newly created share token including the one-time plaintext token
+type CreateShareTokenResponse struct {
+	ShareTokenResponse
+	Token string `json:"token" example:"ums_1a2b3c4d5e6f..."`
+}
+
+// ShareTokensListResponse represents the list of the user's share tokens
+type ShareTokensListResponse struct {
+	ShareTokens []ShareTokenResponse `json:"shareTokens"`
+}
+
+// SharedProfileResponse holds the fields a share token grants, by name
+type SharedProfileResponse struct {
+	Fields map[string]string `json:"fields"`
+}
+
+// ExportJobResponse describes a personal data export
+type ExportJobResponse struct {
+	ID          uint   `json:"id" example:"1"`
+	Format      string `json:"format" example:"json"`
+	Status      string `json:"status" example:"completed"`
+	CreatedAt   string `json:"createdAt" example:"2025-08-05T08:30:00Z"`
+	CompletedAt string `json:"completedAt,omitempty" example:"2025-08-05T08:30:05Z"`
+	ExpiresAt   string `json:"expiresAt,omitempty" example:"2025-08-06T08:30:05Z"`
+	StatusURL   string `json:"statusURL" example:"/api/v1/users/export/1"`
+	DownloadURL string `json:"downloadURL,omitempty" example:"/api/v1/users/export/1/download"`
+	Size        int64  `json:"size,omitempty" example:"4096"`
+	Error       string `json:"error,omitempty" example:""`
+}
+
+// ImportJobResponse describes a bulk user import
+type ImportJobResponse struct {
+	ID          uint   `json:"id" example:"1"`
+	Format      string `json:"format" example:"csv"`
+	Mode        string `json:"mode" example:"password"`
+	Status      string `json:"status" example:"completed"`
+	Rows        int    `json:"rows" example:"120"`
+	Succeeded   int    `json:"succeeded" example:"118"`
+	Failed      int    `json:"failed" example:"2"`
+	CreatedAt   string `json:"createdAt" example:"2025-08-05T08:30:00Z"`
+	CompletedAt string `json:"completedAt,omitempty" example:"2025-08-05T08:30:40Z"`
+	ExpiresAt   string `json:"expiresAt,omitempty" example:"2025-08-06T08:30:40Z"`
+	StatusURL   string `json:"statusURL" example:"/api/v1/admin/users/import/1"`
+	ReportURL   string `json:"reportURL,omitempty" example:"/api/v1/admin/users/import/1/report"`
+	Error       string `json:"error,omitempty" example:""`
+}
+
+// BulkUserRequest applies one action to a list of users. Role is required for the role
+// action and suspension for suspend; mode selects the erasure of delete.
+type BulkUserRequest struct {
+	UserIDs    []uint              `json:"userIds" binding:"required,min=1,dive,min=1" example:"12,15,18"`
+	Action     string              `json:"action" binding:"required,oneof=role suspend verify_email delete" example:"suspend"`
+	Role       string              `json:"role" binding:"required_if=Action role,omitempty,oneof=user admin" example:"user"`
+	Suspension *SuspendUserRequest `json:"suspension" binding:"required_if=Action suspend"`
+	Mode       string              `json:"mode" binding:"omitempty,oneof=soft anonymize hard" example:"anonymize"`
+}
+
+// BulkUserResult is the outcome of a bulk action for one user
+type BulkUserResult struct {
+	UserID  uint   `json:"userId" example:"12"`
+	Success bool   `json:"success" example:"false"`
+	Error   string `json:"error,omitempty" example:"user not found"`
+}
+
+// BulkUserResponse reports the outcome of a bulk action per user
+type BulkUserResponse struct {
+	Action    string           `json:"action" example:"suspend"`
+	Succeeded int              `json:"succeeded" example:"2"`
+	Failed    int              `json:"failed" example:"1"`
+	Results   []BulkUserResult `json:"results"`
+}
+
+// EraseUserRequest selects how an account is erased; empty uses the configured policy
+type EraseUserRequest struct {
+	Mode string `json:"mode" binding:"omitempty,oneof=soft anonymize hard" example:"anonymize"`
+}
+
+// EraseUserResponse reports the erasure mode that was applied
+type EraseUserResponse struct {
+	Message string `json:"message" example:"User erased successfully"`
+	Mode    string `json:"mode" example:"anonymize"`
+}
+
+// RevokeSessionsRequest controls the force logout of a user
+type RevokeSessionsRequest struct {
+	Notify bool `json:"notify" example:"true"`
+}
+
+// RevokeSessionsResponse reports how many sessions a force logout ended
+type RevokeSessionsResponse struct {
+	Message         string `json:"message" example:"All sessions revoked"`
+	RevokedSessions int    `json:"revokedSessions" example:"3"`
+}
+
+// ChangeEmailRequest asks to move the account to a new email address
+type ChangeEmailRequest struct {
+	NewEmail string `json:"newEmail" binding:"required,email" example:"new@example.com"`
+	Password string `json:"password" binding:"required" example:"currentpassword123"`
+}
+
+// ConfirmEmailChangeRequest carries the token from an email change confirmation link
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" binding:"required" example:"3q2-7wAA..."`
+}
+
+// ReactivateAccountRequest carries the token from an account reactivation link
+type ReactivateAccountRequest struct {
+	Token string `json:"token" binding:"required" example:"3q2-7wAA..."`
+}
+
+// ChangeUsernameRequest renames the authenticated user
+type ChangeUsernameRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=50,username" example:"johnny"`
+}
+
+// DeletedUsersResponse lists soft deleted accounts
+type DeletedUsersResponse struct {
+	Users []struct {
+		ID        uint   `json:"id" example:"7"`
+		Email     string `json:"email" example:"user@example.com"`
+		Username  string `json:"username" example:"johndoe"`
+		Role      string `json:"role" example:"user"`
+		CreatedAt string `json:"createdAt" example:"2025-08-04T12:00:00Z"`
+		DeletedAt string `json:"deletedAt" example:"2025-08-20T09:15:00Z"`
+	} `json:"users"`
+}
+
+// SuspendUserRequest suspends a user; bans are permanent and take no expiry
+type SuspendUserRequest struct {
+	Ban    bool       `json:"ban" example:"false"`
+	Reason string     `json:"reason" binding:"required,max=500" example:"Repeated spam reports"`
+	Until  *time.Time `json:"until" example:"2025-09-01T00:00:00Z"` // omit for an indefinite suspension
+}
+
+// AccountStatusResponse is the account status after a suspension or reinstatement
+type AccountStatusResponse struct {
+	UserID           uint       `json:"userId" example:"42"`
+	Status           string     `json:"status" example:"suspended"`
+	SuspensionReason string     `json:"suspensionReason,omitempty" example:"Repeated spam reports"`
+	SuspendedAt      *time.Time `json:"suspendedAt,omitempty" example:"2025-08-05T08:30:00Z"`
+	SuspendedUntil   *time.Time `json:"suspendedUntil,omitempty" example:"2025-09-01T00:00:00Z"`
+}
+
+// OpenDSARRequest opens a data subject request
+type OpenDSARRequest struct {
+	SubjectUserID uint      `json:"subjectUserId" binding:"required" example:"42"`
+	Type          string    `json:"type" binding:"required,oneof=access erasure rectification" example:"access"`
+	ReceivedAt    time.Time `json:"receivedAt" example:"2025-08-05T08:30:00Z"` // defaults to now
+	Notes         string    `json:"notes" example:"Received by email from the subject"`
+}
+
+// ExtendDSARRequest extends a DSAR deadline
+type ExtendDSARRequest struct {
+	Days   int    `json:"days" binding:"required,min=1" example:"30"`
+	Reason string `json:"reason" binding:"required" example:"Request is complex"`
+}
+
+// CloseDSARRequest records the disposition of a DSAR request
+type CloseDSARRequest struct {
+	Disposition string `json:"disposition" binding:"required,oneof=fulfilled partially_fulfilled rejected" example:"fulfilled"`
+	Note        string `json:"note" example:"Data package sent to the subject"`
+}
+
+// DSARResponse describes a data subject request
+type DSARResponse struct {
+	ID              uint   `json:"id" example:"1"`
+	SubjectUserID   uint   `json:"subjectUserId" example:"42"`
+	Type            string `json:"type" example:"access"`
+	Status          string `json:"status" example:"in_progress"`
+	OpenedByID      uint   `json:"openedById" example:"1"`
+	ReceivedAt      string `json:"receivedAt" example:"2025-08-05T08:30:00Z"`
+	DueAt           string `json:"dueAt" example:"2025-09-04T08:30:00Z"`
+	Overdue         bool   `json:"overdue" example:"false"`
+	Notes           string `json:"notes" example:""`
+	ExportID        *uint  `json:"exportId" example:"7"`
+	Disposition     string `json:"disposition" example:""`
+	DispositionNote string `json:"dispositionNote" example:""`
+	ClosedAt        string `json:"closedAt,omitempty" example:""`
+}
+
+// DSAREventResponse is one step of a DSAR evidence trail
+type DSAREventResponse struct {
+	At      string `json:"at" example:"2025-08-05T08:30:00Z"`
+	ActorID *uint  `json:"actorId" example:"1"`
+	Action  string `json:"action" example:"opened"`
+	Details string `json:"details" example:"{}"`
+}
+
+// DSARDetailResponse is a DSAR request with its evidence trail
+type DSARDetailResponse struct {
+	DSARResponse
+	Events []DSAREventResponse `json:"events"`
+}
+
+// DSARListResponse lists DSAR requests
+type DSARListResponse struct {
+	Requests []DSARResponse `json:"requests"`
+}
+
+// NotificationPreferencesResponse lists which notification emails a user receives
+type NotificationPreferencesResponse struct {
+	Welcome         bool `json:"welcome" example:"true"`
+	PasswordChanged bool `json:"passwordChanged" example:"true"`
+	NewLogin        bool `json:"newLogin" example:"true"`
+	RoleChanged     bool `json:"roleChanged" example:"false"`
+}
+
+// UpdateNotificationPreferencesRequest changes notification preferences; omitted fields are kept
+type UpdateNotificationPreferencesRequest struct {
+	Welcome         *bool `json:"welcome" example:"true"`
+	PasswordChanged *bool `json:"passwordChanged" example:"true"`
+	NewLogin        *bool `json:"newLogin" example:"true"`
+	RoleChanged     *bool `json:"roleChanged" example:"false"`
+}
+
+// SettingsResponse is a user's account settings. Locale and timezone are also part of
+// the profile, and notifications of GET /users/notifications.
+type SettingsResponse struct {
+	Locale             string                          `json:"locale" example:"de"`
+	Timezone           string                          `json:"timezone" example:"Europe/Berlin"`
+	Theme              string                          `json:"theme" example:"dark"`
+	MarketingConsent   bool                            `json:"marketingConsent" example:"true"`
+	MarketingConsentAt *time.Time                      `json:"marketingConsentAt,omitempty" example:"2024-08-05T11:30:00+02:00"`
+	Notifications      NotificationPreferencesResponse `json:"notifications"`
+}
+
+// UpdateSettingsRequest changes account settings; omitted fields are kept and an empty
+// locale or timezone clears it
+type UpdateSettingsRequest struct {
+	Locale           *string                               `json:"locale" example:"de"`
+	Timezone         *string                               `json:"timezone" example:"Europe/Berlin"`
+	Theme            *string                               `json:"theme" example:"dark"` // system, light or dark
+	MarketingConsent *bool                                 `json:"marketingConsent" example:"true"`
+	Notifications    *UpdateNotificationPreferencesRequest `json:"notifications"`
+}
+
+// UserPreviewResponse is what a user sees from GET /users/profile and GET /users/notifications
+type UserPreviewResponse struct {
+	Profile       UserProfileResponse             `json:"profile"`
+	Notifications NotificationPreferencesResponse `json:"notifications"`
+}
+
+// ActivityItem is one entry of an activity feed or timeline
+type ActivityItem struct {
+	At       time.Time   `json:"at" example:"2024-08-05T09:30:00Z"`
+	Kind     string      `json:"kind" example:"security_event"`
+	Type     string      `json:"type" example:"password_reset_requested"`
+	Severity string      `json:"severity,omitempty" example:"info"`
+	ActorID  *uint       `json:"actorId,omitempty" example:"1"`
+	Details  interface{} `json:"details"`
+}
+
+// ActivityResponse lists activity, newest first
+type ActivityResponse struct {
+	Items []ActivityItem `json:"items"`
+}
+
+// CreateDebugRuleRequest enables debug logging for a user or for request IDs matching a pattern
+type CreateDebugRuleRequest struct {
+	UserID           uint   `json:"userId" example:"42"`
+	RequestIDPattern string `json:"requestIdPattern" example:"3f2a*"` // path.Match syntax
+	DurationMinutes  int    `json:"durationMinutes" binding:"required,min=1,max=240" example:"30"`
+}
+
+// DebugRuleResponse describes an active debug logging rule
+type DebugRuleResponse struct {
+	ID               uint      `json:"id" example:"1"`
+	UserID           uint      `json:"userId,omitempty" example:"42"`
+	RequestIDPattern string    `json:"requestIdPattern,omitempty" example:"3f2a*"`
+	CreatedBy        uint      `json:"createdBy" example:"1"`
+	ExpiresAt        time.Time `json:"expiresAt" example:"2024-08-05T10:00:00Z"`
+}
+
+// DebugRuleListResponse lists the active debug logging rules
+type DebugRuleListResponse struct {
+	Rules []DebugRuleResponse `json:"rules"`
+}
+
+// CreateReportScheduleRequest schedules a recurring statistics report
+type CreateReportScheduleRequest struct {
+	Frequency  string   `json:"frequency" binding:"required,oneof=weekly monthly" example:"weekly"`
+	Timezone   string   `json:"timezone" example:"Europe/Berlin"` // IANA name, defaults to UTC
+	Weekday    int      `json:"weekday" example:"1"`              // weekly reports, 0 = Sunday
+	DayOfMonth int      `json:"dayOfMonth" example:"1"`           // monthly reports, 1-28
+	Hour       int      `json:"hour" example:"8"`                 // local time in timezone
+	Recipients []string `json:"recipients" binding:"required,min=1,max=20,dive,email" example:"ops@example.com"`
+}
+
+// ReportScheduleResponse describes a scheduled report
+type ReportScheduleResponse struct {
+	ID          uint     `json:"id" example:"1"`
+	CreatedByID uint     `json:"createdById" example:"1"`
+	Frequency   string   `json:"frequency" example:"weekly"`
+	Timezone    string   `json:"timezone" example:"Europe/Berlin"`
+	Weekday     *int     `json:"weekday,omitempty" example:"1"`
+	DayOfMonth  *int     `json:"dayOfMonth,omitempty"`
+	Hour        int      `json:"hour" example:"8"`
+	Recipients  []string `json:"recipients" example:"ops@example.com"`
+	NextRunAt   string   `json:"nextRunAt" example:"2025-08-11T06:00:00Z"`
+	LastRunAt   string   `json:"lastRunAt,omitempty" example:""`
+}
+
+// ReportScheduleListResponse lists scheduled reports
+type ReportScheduleListResponse struct {
+	Schedules []ReportScheduleResponse `json:"schedules"`
+}
+
+// CreateOrganizationRequest creates an organization owned by the caller
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=100" example:"Acme Inc."`
+	Slug string `json:"slug" binding:"required" example:"acme"` // 3-50 lowercase letters, digits and hyphens
+}
+
+// OrganizationResponse describes an organization and the caller's role in it
+type OrganizationResponse struct {
+	ID        uint   `json:"id" example:"1"`
+	Name      string `json:"name" example:"Acme Inc."`
+	Slug      string `json:"slug" example:"acme"`
+	Role      string `json:"role" example:"owner"`
+	CreatedAt string `json:"createdAt" example:"2025-08-11T06:00:00Z"`
+}
+
+// OrganizationListResponse lists the caller's organizations
+type OrganizationListResponse struct {
+	Organizations []OrganizationResponse `json:"organizations"`
+	// Current is the organization the access token acts for, omitted for none
+	Current *uint `json:"current,omitempty" example:"1"`
+}
+
+// OrganizationMemberResponse describes a member of an organization
+type OrganizationMemberResponse struct {
+	UserID   uint   `json:"userId" example:"7"`
+	Email    string `json:"email" example:"user@example.com"`
+	Username string `json:"username" example:"johndoe"`
+	Role     string `json:"role" example:"member"`
+	JoinedAt string `json:"joinedAt" example:"2025-08-11T06:00:00Z"`
+}
+
+// OrganizationMemberListResponse lists the members of an organization
+type OrganizationMemberListResponse struct {
+	Members []OrganizationMemberResponse `json:"members"`
+}
+
+// InviteMemberRequest invites an email address to an organization
+type InviteMemberRequest struct {
+	Email string `json:"email" binding:"required,email" example:"user@example.com"`
+	Role  string `json:"role" binding:"required,oneof=admin member" example:"member"`
+}
+
+// InvitationResponse describes a sent invitation
+type InvitationResponse struct {
+	ID        uint   `json:"id" example:"1"`
+	Email     string `json:"email" example:"user@example.com"`
+	Role      string `json:"role" example:"member"`
+	ExpiresAt string `json:"expiresAt" example:"2025-08-18T06:00:00Z"`
+}
+
+// AcceptInvitationRequest accepts an invitation with the token from its link
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required" example:"3q2-7wEAAAA..."`
+}
+
+// TransferOwnershipRequest offers the organization to another member
+type TransferOwnershipRequest struct {
+	UserID uint `json:"userId" binding:"required" example:"7"`
+}
+
+// OwnershipTransferResponse describes an ownership transfer awaiting the new owner
+type OwnershipTransferResponse struct {
+	ID             uint   `json:"id" example:"1"`
+	OrganizationID uint   `json:"organizationId" example:"1"`
+	ToUserID       uint   `json:"toUserId" example:"7"`
+	ExpiresAt      string `json:"expiresAt" example:"2025-08-14T06:00:00Z"`
+}
+
+// AcceptOwnershipRequest accepts an ownership transfer with the token from its link
+type AcceptOwnershipRequest struct {
+	Token string `json:"token" binding:"required" example:"3q2-7wEAAAA..."`
+}
+
+// SwitchOrganizationRequest exchanges the session's refresh token for a pair acting for another organization
+type SwitchOrganizationRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+}
+
+// GroupRequest creates or updates a group
+type GroupRequest struct {
+	Name        string `json:"name" binding:"required" example:"support"` // lowercase letters, digits, - and _, up to 50
+	Description string `json:"description" binding:"max=255" example:"Customer support team"`
+}
+
+// GroupResponse describes a group
+type GroupResponse struct {
+	ID          uint   `json:"id" example:"1"`
+	Name        string `json:"name" example:"support"`
+	Description string `json:"description" example:"Customer support team"`
+	MemberCount int    `json:"memberCount" example:"3"`
+	CreatedAt   string `json:"createdAt" example:"2025-08-11T06:00:00Z"`
+}
+
+// GroupListResponse lists the groups
+type GroupListResponse struct {
+	Groups []GroupResponse `json:"groups"`
+}
+
+// GroupMemberResponse describes a user in a group
+type GroupMemberResponse struct {
+	ID       uint   `json:"id" example:"7"`
+	Email    string `json:"email" example:"user@example.com"`
+	Username string `json:"username" example:"johndoe"`
+}
+
+// GroupDetailResponse describes a group and its members
+type GroupDetailResponse struct {
+	GroupResponse
+	Members []GroupMemberResponse `json:"members"`
+}
+
+// CreateRegistrationInvitationRequest invites an email address to register
+type CreateRegistrationInvitationRequest struct {
+	Email string `json:"email" binding:"required,email" example:"user@example.com"`
+	Role  string `json:"role" binding:"omitempty,oneof=user admin" example:"user"` // defaults to user
+}
+
+// RegistrationInvitationResponse describes a registration invitation
+type RegistrationInvitationResponse struct {
+	ID          uint   `json:"id" example:"1"`
+	Email       string `json:"email" example:"user@example.com"`
+	Role        string `json:"role" example:"user"`
+	InvitedByID uint   `json:"invitedById" example:"1"`
+	CreatedAt   string `json:"createdAt" example:"2025-08-11T06:00:00Z"`
+	ExpiresAt   string `json:"expiresAt" example:"2025-08-18T06:00:00Z"`
+}
+
+// RegistrationInvitationListResponse lists the pending registration invitations
+type RegistrationInvitationListResponse struct {
+	Invitations []RegistrationInvitationResponse `json:"invitations"`
+}
+
+// InvitationDetailsResponse describes the account an invitation link registers
+type InvitationDetailsResponse struct {
+	Email     string `json:"email" example:"user@example.com"`
+	Role      string `json:"role" example:"user"`
+	ExpiresAt string `json:"expiresAt" example:"2025-08-18T06:00:00Z"`
+}
+
+// InvitationRegisterRequest registers the invited email address
+type InvitationRegisterRequest struct {
+	Token    string `json:"token" binding:"required" example:"3q2-7wEAAAA..."`
+	Username string `json:"username" binding:"required,min=3,max=50,username" example:"johndoe"`
+	Password string `json:"password" binding:"required" example:"strongpassword123"`
+}
+
+// CreateIPRuleRequest allows or denies an address range on some routes
+type CreateIPRuleRequest struct {
+	Path        string `json:"path" binding:"max=255" example:"/api/v1/admin/*"` // route template, "/*" matches below a prefix, empty for every route
+	Action      string `json:"action" binding:"required,oneof=allow deny" example:"allow"`
+	CIDR        string `json:"cidr" binding:"required,max=50" example:"203.0.113.0/24"` // CIDR range or single address
+	Description string `json:"description" binding:"max=255" example:"Office network"`
+}
+
+// IPRuleResponse describes an IP filter rule
+type IPRuleResponse struct {
+	ID          uint   `json:"id,omitempty" example:"1"` // absent for rules from the configuration file
+	Path        string `json:"path" example:"/api/v1/admin/*"`
+	Action      string `json:"action" example:"allow"`
+	CIDR        string `json:"cidr" example:"203.0.113.0/24"`
+	Description string `json:"description,omitempty" example:"Office network"`
+	CreatedByID uint   `json:"createdById,omitempty" example:"1"`
+	CreatedAt   string `json:"createdAt,omitempty" example:"2024-08-05T10:00:00Z"`
+}
+
+// IPRuleListResponse lists the IP filter rules
+type IPRuleListResponse struct {
+	Rules      []IPRuleResponse `json:"rules"`      // managed through the API
+	Configured []IPRuleResponse `json:"configured"` // from the configuration file, read-only
+}
+
+// AttributeDefinitionRequest defines a custom user attribute
+type AttributeDefinitionRequest struct {
+	Type        string   `json:"type" binding:"required,oneof=string number boolean enum" example:"enum"`
+	Options     []string `json:"options" example:"sales,support,engineering"` // values of an enum
+	MaxLength   int      `json:"maxLength" example:"0"`                       // longest string, 0 for 1000
+	UserAccess  string   `json:"userAccess" binding:"omitempty,oneof=none read write" example:"read"`
+	Description string   `json:"description" binding:"max=255" example:"Department in the HR system"`
+}
+
+// AttributeDefinitionResponse describes a custom user attribute
+type AttributeDefinitionResponse struct {
+	Key         string   `json:"key" example:"department"`
+	Type        string   `json:"type" example:"enum"`
+	Options     []string `json:"options,omitempty" example:"sales,support,engineering"`
+	MaxLength   int      `json:"maxLength,omitempty" example:"0"`
+	UserAccess  string   `json:"userAccess" example:"read"`
+	Description string   `json:"description" example:"Department in the HR system"`
+	UpdatedAt   string   `json:"updatedAt" example:"2025-08-20T09:00:00Z"`
+}
+
+// AttributeDefinitionListResponse lists the custom user attributes
+type AttributeDefinitionListResponse struct {
+	Attributes []AttributeDefinitionResponse `json:"attributes"`
+}
+
+// FeatureFlagRequest defines a feature flag and its rollout
+type FeatureFlagRequest struct {
+	Description string         `json:"description" binding:"max=255" example:"New profile editor"`
+	Enabled     bool           `json:"enabled" example:"true"`
+	Percentage  int            `json:"percentage" binding:"min=0,max=100" example:"25"` // share of users the flag is on for
+	Roles       map[string]int `json:"roles"`                                           // percentages overriding it per role, e.g. {"admin": 100}
+}
+
+// FeatureFlagResponse describes a feature flag
+type FeatureFlagResponse struct {
+	Key         string         `json:"key" example:"profile-editor"`
+	Description string         `json:"description" example:"New profile editor"`
+	Enabled     bool           `json:"enabled" example:"true"`
+	Percentage  int            `json:"percentage" example:"25"`
+	Roles       map[string]int `json:"roles"`
+	UpdatedAt   string         `json:"updatedAt" example:"2025-08-20T09:00:00Z"`
+}
+
+// FeatureFlagListResponse lists the feature flags
+type FeatureFlagListResponse struct {
+	Flags []FeatureFlagResponse `json:"flags"`
+}
+
+// UserAttributesRequest sets custom attributes of a user; null removes a value and
+// attributes left out are kept
+type UserAttributesRequest struct {
+	Attributes map[string]interface{} `json:"attributes" binding:"required"`
+}
+
+// UserAttributesResponse holds a user's custom attribute values by key
+type UserAttributesResponse struct {
+	UserID     uint                   `json:"userId" example:"42"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// AnalyticsDayResponse represents the aggregated accounts of one UTC day
+type AnalyticsDayResponse struct {
+	Date              string `json:"date" example:"2026-03-02"`
+	ActiveUsers       int    `json:"activeUsers" example:"412"`
+	WeeklyActiveUsers int    `json:"weeklyActiveUsers" example:"1630"`
+	Signups           int    `json:"signups" example:"37"`
+	Deletions         int    `json:"deletions" example:"4"`
+	TotalUsers        int    `json:"totalUsers" example:"5210"`
+}
+
+// AnalyticsCohortResponse represents the retention of the users who signed up in one week
+type AnalyticsCohortResponse struct {
+	CohortWeek string                   `json:"cohortWeek" example:"2026-02-23"`
+	Size       int                      `json:"size" example:"120"`
+	Retention  []AnalyticsRetentionWeek `json:"retention"`
+}
+
+// AnalyticsRetentionWeek represents the cohort members who signed in weekOffset weeks after signing up
+type AnalyticsRetentionWeek struct {
+	WeekOffset int     `json:"weekOffset" example:"1"`
+	Retained   int     `json:"retained" example:"54"`
+	Rate       float64 `json:"rate" example:"0.45"`
+}
+
+// AnalyticsResponse represents the growth and retention analytics of a date range
+type AnalyticsResponse struct {
+	From    string                    `json:"from" example:"2026-02-01"`
+	To      string                    `json:"to" example:"2026-03-02"`
+	Days    []AnalyticsDayResponse    `json:"days"`
+	Cohorts []AnalyticsCohortResponse `json:"cohorts"`
+}
@@ -1,250 +1,424 @@
 package handlers
 
 import (
-	"api/internal/auth"
+	"api/internal/i18n"
+	"api/internal/middleware"
 	"api/internal/models"
+	"api/internal/service"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jinzhu/gorm"
 	"github.com/sirupsen/logrus"
 )
 
 type UserHandler struct {
-	db     *gorm.DB
-	logger *logrus.Logger
+	users    service.UserService
+	accounts service.AccountService
+	erasure  service.ErasureService
+	logger   *logrus.Logger
 }
 
-func NewUserHandler(db *gorm.DB, logger *logrus.Logger) *UserHandler {
+func NewUserHandler(users service.UserService, accounts service.AccountService, erasure service.ErasureService, logger *logrus.Logger) *UserHandler {
 	return &UserHandler{
-		db:     db,
-		logger: logger,
+		users:    users,
+		accounts: accounts,
+		erasure:  erasure,
+		logger:   logger,
 	}
 }
 
 // GetProfile godoc
 // @Summary Get user profile
-// @Description Get the profile information of the authenticated user
+// @Description Get the profile information of the authenticated user, with a completeness score: the percentage of the configured profile field weights that are filled in, and the fields still empty, and the keys of the feature flags on for the user, so clients can toggle UI features. The response carries Last-Modified, from the latest change to the user or profile, and an ETag: a request with a matching If-None-Match, or an If-Modified-Since not older than Last-Modified, gets 304 without a body.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Security Bearer
+// @Param If-None-Match header string false "ETag of a previous response"
+// @Param If-Modified-Since header string false "Last-Modified of a previous response"
+// @Param fields query string false "Fields to return, e.g. user.email,profile.firstName"
 // @Success 200 {object} UserProfileResponse
+// @Success 304 {string} string "Not modified"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
 // @Failure 404 {object} map[string]string "error: User not found"
 // @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
 // @Router /users/profile [get]
 func (h *UserHandler) GetProfile(c *gin.Context) {
 	userID := c.GetUint("userID")
 
-	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	user, profile, err := h.users.GetProfile(userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to fetch user profile")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
 		return
 	}
 
-	var profile models.UserProfile
-	if err := h.db.Where("user_id = ?", userID).First(&profile).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			profile = models.UserProfile{
-				UserID: userID,
-			}
-		} else {
-			h.logger.WithError(err).Error("Failed to fetch user profile")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
-			return
-		}
+	if notModified(c, user.UpdatedAt, profile.UpdatedAt) {
+		return
 	}
+	c.JSON(http.StatusOK, selectFields(c, profileView(user, profile, h.users.ProfileCompleteness(profile), middleware.EnabledFeatures(c))))
+}
 
-	c.JSON(http.StatusOK, gin.H{
+// profileView is the GetProfile response body, shared with the admin preview; features
+// are the keys of the feature flags on for the user
+func profileView(user *models.User, profile *models.UserProfile, completeness service.ProfileCompleteness, features []string) gin.H {
+	return gin.H{
 		"user": gin.H{
 			"id":       user.ID,
 			"email":    user.Email,
 			"username": user.Username,
 			"role":     user.Role,
 		},
-		"profile": gin.H{
-			"firstName": profile.FirstName,
-			"lastName":  profile.LastName,
-			"bio":       profile.Bio,
-			"avatarURL": profile.AvatarURL,
-		},
-	})
+		"profile":      profileFields(profile),
+		"completeness": completenessView(completeness),
+		"features":     features,
+	}
+}
+
+func completenessView(completeness service.ProfileCompleteness) gin.H {
+	return gin.H{
+		"score":           completeness.Score,
+		"missing":         completeness.Missing,
+		"missingRequired": completeness.MissingRequired,
+	}
+}
+
+// profileFields is the profile as its owner sees it, including the visibility settings
+func profileFields(profile *models.UserProfile) gin.H {
+	return gin.H{
+		"firstName":     profile.FirstName,
+		"lastName":      profile.LastName,
+		"preferredName": profile.PreferredName,
+		"pronouns":      profile.Pronouns,
+		"honorific":     profile.Honorific,
+		"bio":           profile.Bio,
+		"avatarURL":     avatarURL(profile),
+		"locale":        profile.Locale,
+		"timezone":      profile.Timezone,
+		"visibility":    service.ProfileVisibility(profile),
+	}
+}
+
+// publicProfileFields is the profile as other users see it in the directory
+func publicProfileFields(profile *models.UserProfile) gin.H {
+	fields := profileFields(profile)
+	delete(fields, "visibility")
+	for field, visibility := range service.ProfileVisibility(profile) {
+		if visibility != service.VisibilityPublic {
+			delete(fields, field)
+		}
+	}
+	return fields
 }
 
 // UpdateProfile godoc
 // @Summary Update user profile
-// @Description Update the profile information of the authenticated user
+// @Description Update the profile information of the authenticated user, including preferred name, pronouns, honorific and timezone. The locale, when set, is used for translated messages unless the request sends Accept-Language. visibility sets profile fields to public or private in the user directory; when omitted the current settings are kept.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Security Bearer
 // @Param profile body UpdateProfileRequest true "Profile Information"
-// @Success 200 {object} ProfileResponse
-// @Failure 400 {object} map[string]string "error: Validation error"
+// @Success 200 {object} UpdateProfileResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error, unsupported locale, unknown timezone or invalid visibility"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
 // @Failure 500 {object} map[string]string "error: Internal server error"
+// @Security ApiKey
 // @Router /users/profile [put]
 func (h *UserHandler) UpdateProfile(c *gin.Context) {
 	userID := c.GetUint("userID")
 
-	var input struct {
-		FirstName string `json:"firstName"`
-		LastName  string `json:"lastName"`
-		Bio       string `json:"bio"`
-		AvatarURL string `json:"avatarURL"`
-	}
-
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var input UpdateProfileRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
 		return
 	}
 
-	var profile models.UserProfile
-	result := h.db.Where("user_id = ?", userID).First(&profile)
-
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			profile = models.UserProfile{
-				UserID:    userID,
-				FirstName: input.FirstName,
-				LastName:  input.LastName,
-				Bio:       input.Bio,
-				AvatarURL: input.AvatarURL,
-			}
-			if err := h.db.Create(&profile).Error; err != nil {
-				h.logger.WithError(err).Error("Failed to create user profile")
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
-				return
-			}
-		} else {
-			h.logger.WithError(result.Error).Error("Failed to fetch user profile")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
-			return
-		}
-	} else {
-		profile.FirstName = input.FirstName
-		profile.LastName = input.LastName
-		profile.Bio = input.Bio
-		profile.AvatarURL = input.AvatarURL
-
-		if err := h.db.Save(&profile).Error; err != nil {
-			h.logger.WithError(err).Error("Failed to update user profile")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+	profile, err := h.users.UpdateProfile(userID, service.ProfileUpdate{
+		FirstName:     input.FirstName,
+		LastName:      input.LastName,
+		Bio:           input.Bio,
+		AvatarURL:     input.AvatarURL,
+		Locale:        input.Locale,
+		PreferredName: input.PreferredName,
+		Pronouns:      input.Pronouns,
+		Honorific:     input.Honorific,
+		Timezone:      input.Timezone,
+		Visibility:    input.Visibility,
+	})
+	if err != nil {
+		if response, ok := profileUpdateError(err); ok {
+			c.JSON(http.StatusBadRequest, response)
 			return
 		}
+		h.logger.WithError(err).Error("Failed to update user profile")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"profile": gin.H{
-			"firstName": profile.FirstName,
-			"lastName":  profile.LastName,
-			"bio":       profile.Bio,
-			"avatarURL": profile.AvatarURL,
-		},
-	})
+	c.JSON(http.StatusOK, gin.H{"profile": profileFields(profile)})
+}
+
+// profileUpdateError maps profile validation errors to a 400 response body
+func profileUpdateError(err error) (gin.H, bool) {
+	switch {
+	case errors.Is(err, service.ErrUnsupportedLocale):
+		return gin.H{"error": "Unsupported locale, use one of: " + strings.Join(i18n.Supported(), ", ")}, true
+	case errors.Is(err, service.ErrInvalidTimezone):
+		return gin.H{"error": "Unknown timezone, use an IANA name such as Europe/Berlin"}, true
+	case errors.Is(err, service.ErrInvalidVisibility):
+		return gin.H{"error": "Visibility must map profile fields to public or private"}, true
+	}
+	return nil, false
+}
+
+// GetDirectory godoc
+// @Summary List the user directory
+// @Description List verified users with the profile fields they made public. Names, preferred name, pronouns, honorific, bio and avatar are public unless the user hid them; locale and timezone are private unless shared.
+// @Tags users
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} DirectoryResponse
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/directory [get]
+func (h *UserHandler) GetDirectory(c *gin.Context) {
+	users, err := h.users.Directory()
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch user directory")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch directory"})
+		return
+	}
+
+	entries := make([]gin.H, 0, len(users))
+	for i := range users {
+		entries = append(entries, gin.H{
+			"id":       users[i].User.ID,
+			"username": users[i].User.Username,
+			"profile":  publicProfileFields(&users[i].Profile),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"users": entries})
 }
 
 // ChangePassword godoc
 // @Summary Change user password
-// @Description Change the password of the authenticated user
+// @Description Change the password of the authenticated user. All access tokens issued before the change are revoked, other sessions are terminated when configured, and a security alert listing the other signed-in devices is sent.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Security Bearer
 // @Param passwords body ChangePasswordRequest true "Password Information"
-// @Success 200 {object} map[string]string "message: Password changed successfully"
-// @Failure 400 {object} map[string]string "error: Validation error"
+// @Success 200 {object} ChangePasswordResponse
+// @Failure 400 {object} map[string]interface{} "error: Validation error; violations: password policy rules the new password breaks"
 // @Failure 401 {object} map[string]string "error: Current password is incorrect"
+// @Failure 403 {object} map[string]string "error: Password is managed by an identity provider"
 // @Failure 500 {object} map[string]string "error: Internal server error"
+// @Failure 429 {object} map[string]string "error: Password was changed recently, retryAt: when it may change again"
+// @Failure 503 {object} map[string]string "error: Password breach check unavailable"
 // @Router /users/change-password [put]
 func (h *UserHandler) ChangePassword(c *gin.Context) {
 	userID := c.GetUint("userID")
 
 	var input struct {
 		CurrentPassword string `json:"currentPassword" binding:"required"`
-		NewPassword     string `json:"newPassword" binding:"required,min=8"`
+		NewPassword     string `json:"newPassword" binding:"required"`
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
 		return
 	}
 
-	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	terminated, err := h.users.ChangePassword(userID, input.CurrentPassword, input.NewPassword, c.GetString("sessionID"))
+	if err != nil {
+		if passwordRejected(c, err) {
+			return
+		}
+		var tooRecent *service.PasswordTooRecentError
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, service.ErrIncorrectPassword):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		case errors.Is(err, service.ErrExternalPassword):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password is managed by an identity provider"})
+		case errors.As(err, &tooRecent):
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(tooRecent.RetryAt).Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":   "Password was changed recently",
+				"retryAt": tooRecent.RetryAt.UTC().Format(time.RFC3339),
+			})
+		default:
+			h.logger.WithError(err).Error("Failed to change password")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Password changed successfully",
+		"terminatedSessions": terminated,
+	})
+}
+
+// ChangeEmail godoc
+// @Summary Change email address
+// @Description Request a change of the authenticated user's email address. The current password is required. A confirmation link is sent to the new address and the current address is warned; the email only changes once the link is confirmed.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param email body ChangeEmailRequest true "New email address and current password"
+// @Success 202 {object} map[string]string "message: Confirmation sent to the new address"
+// @Failure 400 {object} map[string]interface{} "error: Validation error or unchanged email"
+// @Failure 401 {object} map[string]string "error: Current password is incorrect"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 409 {object} map[string]string "error: Email is already registered, field: email"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/email [put]
+func (h *UserHandler) ChangeEmail(c *gin.Context) {
+	var input ChangeEmailRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
 		return
 	}
 
-	if err := auth.ComparePasswords(user.PasswordHash, input.CurrentPassword); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+	if err := h.accounts.RequestEmailChange(c.GetUint("userID"), input.Password, input.NewEmail, clientInfo(c)); err != nil {
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, service.ErrIncorrectPassword):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		case errors.Is(err, service.ErrEmailUnchanged):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "New email is the current email"})
+		case userExists(c, err):
+		default:
+			h.logger.WithError(err).Error("Failed to request email change")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request email change"})
+		}
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(input.NewPassword)
+	c.JSON(http.StatusAccepted, gin.H{"message": "Confirmation sent to the new address"})
+}
+
+// ChangeUsername godoc
+// @Summary Change username
+// @Description Rename the authenticated user. Usernames are unique, and after a rename the next one is only allowed once the configured cooldown has passed.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param username body ChangeUsernameRequest true "New username"
+// @Success 200 {object} map[string]string "message: Username changed, username: new username"
+// @Failure 400 {object} map[string]interface{} "error: Validation error"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 409 {object} map[string]string "error: Username is already taken, field: username"
+// @Failure 429 {object} map[string]string "error: Username was changed recently, retryAt: time of the next allowed change"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/username [put]
+func (h *UserHandler) ChangeUsername(c *gin.Context) {
+	var input ChangeUsernameRequest
+	if err := bindJSON(c, &input); err != nil {
+		validationError(c, err)
+		return
+	}
+
+	user, err := h.accounts.ChangeUsername(c.GetUint("userID"), input.Username, clientInfo(c))
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to hash new password")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		var cooldown *service.UsernameCooldownError
+		switch {
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.As(err, &cooldown):
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(cooldown.RetryAt).Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":   "Username was changed recently",
+				"retryAt": cooldown.RetryAt.UTC().Format(time.RFC3339),
+			})
+		case userExists(c, err):
+		default:
+			h.logger.WithError(err).Error("Failed to change username")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change username"})
+		}
 		return
 	}
 
-	user.PasswordHash = hashedPassword
-	if err := h.db.Save(&user).Error; err != nil {
-		h.logger.WithError(err).Error("Failed to update password")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Username changed",
+		"username": user.Username,
+	})
+}
+
+// DeactivateAccount godoc
+// @Summary Deactivate user account
+// @Description Deactivate the authenticated user's account without deleting it. Every session is ended and the account's API keys stop working; signing in again mails a link that reactivates the account.
+// @Tags users
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} map[string]string "message: Account deactivated"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
+// @Failure 500 {object} map[string]string "error: Internal server error"
+// @Router /users/deactivate [post]
+func (h *UserHandler) DeactivateAccount(c *gin.Context) {
+	if err := h.accounts.Deactivate(c.GetUint("userID"), clientInfo(c)); err != nil {
+		h.logger.WithError(err).Error("Failed to deactivate account")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate account"})
 		return
 	}
 
-	h.logger.WithField("user_id", userID).Info("Password changed successfully")
-	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Account deactivated"})
 }
 
 // DeleteAccount godoc
 // @Summary Delete user account
-// @Description Soft delete the authenticated user's account
+// @Description Delete the authenticated user's account. With a deletion grace period configured, sessions end and the account is kept until deletionScheduledAt: signing in, or the link mailed now, restores it. Afterwards, or at once without a grace period, the account is soft deleted, anonymized or permanently deleted depending on the configured privacy policy.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Security Bearer
-// @Success 200 {object} map[string]string "message: Account deleted successfully"
+// @Success 200 {object} map[string]string "message: Account deleted successfully, deletionScheduledAt: end of the grace period"
+// @Failure 401 {object} map[string]string "error: Unauthorized"
+// @Failure 403 {object} map[string]string "error: Insufficient scope or account blocked, code: insufficient_scope, account_suspended or account_banned"
 // @Failure 500 {object} map[string]string "error: Internal server error"
 // @Router /users/account [delete]
 func (h *UserHandler) DeleteAccount(c *gin.Context) {
 	userID := c.GetUint("userID")
 
-	// Start a transaction
-	tx := h.db.Begin()
-
-	// Delete refresh tokens
-	if err := tx.Where("user_id = ?", userID).Delete(&models.RefreshToken{}).Error; err != nil {
-		tx.Rollback()
-		h.logger.WithError(err).Error("Failed to delete refresh tokens")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
-		return
-	}
-
-	// Delete user profile
-	if err := tx.Where("user_id = ?", userID).Delete(&models.UserProfile{}).Error; err != nil {
-		tx.Rollback()
-		h.logger.WithError(err).Error("Failed to delete user profile")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
-		return
-	}
-
-	// Soft delete user
-	if err := tx.Delete(&models.User{}, userID).Error; err != nil {
-		tx.Rollback()
-		h.logger.WithError(err).Error("Failed to delete user")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+	if h.accounts.DeletionGracePeriod() > 0 {
+		user, err := h.accounts.ScheduleDeletion(userID, clientInfo(c))
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to schedule account deletion")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":             "Account scheduled for deletion, open the link sent to your email address to undo it",
+			"deletionScheduledAt": user.DeletionScheduledAt.UTC().Format(time.RFC3339),
+		})
 		return
 	}
 
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		h.logger.WithError(err).Error("Failed to commit account deletion transaction")
+	if _, err := h.erasure.Erase(c.Request.Context(), userID, ""); err != nil {
+		h.logger.WithError(err).Error("Failed to delete account")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
 		return
 	}
 
-	h.logger.WithField("user_id", userID).Info("Account deleted successfully")
 	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
 }
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"api/internal/auth"
+	"api/internal/middleware/authtest"
+	"api/internal/models"
+	"api/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUserHandlerGetProfile(t *testing.T) {
+	updated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		err         error
+		ifModSince  string
+		status      int
+		wantProfile bool
+	}{
+		{name: "found", status: http.StatusOK, wantProfile: true},
+		{name: "not modified", ifModSince: updated.Format(http.TimeFormat), status: http.StatusNotModified},
+		{name: "modified since", ifModSince: updated.Add(-time.Hour).Format(http.TimeFormat), status: http.StatusOK, wantProfile: true},
+		{name: "user gone", err: service.ErrUserNotFound, status: http.StatusNotFound},
+		{name: "failure", err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewUserHandler(&fakeUserService{
+				getProfile: func(userID uint) (*models.User, *models.UserProfile, error) {
+					if tt.err != nil {
+						return nil, nil, tt.err
+					}
+					user := testUser(userID, "user")
+					user.UpdatedAt = updated
+					profile := &models.UserProfile{UserID: userID, FirstName: "Ada"}
+					profile.UpdatedAt = updated
+					return user, profile, nil
+				},
+			}, nil, nil, testLogger())
+			identity := authtest.User(7)
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users/profile", nil)
+			if tt.ifModSince != "" {
+				req.Header.Set("If-Modified-Since", tt.ifModSince)
+			}
+			c, w := authtest.Context(req, &identity)
+			h.GetProfile(c)
+			c.Writer.WriteHeaderNow()
+			body := checkResponse(t, w, tt.status, "")
+			if !tt.wantProfile {
+				return
+			}
+			user, _ := body["user"].(map[string]interface{})
+			profile, _ := body["profile"].(map[string]interface{})
+			if user["id"] != float64(7) || profile["firstName"] != "Ada" {
+				t.Errorf("body = %v", body)
+			}
+			if completeness, _ := body["completeness"].(map[string]interface{}); completeness["score"] != float64(50) {
+				t.Errorf("completeness = %v", body["completeness"])
+			}
+			if w.Header().Get("ETag") == "" {
+				t.Error("no ETag")
+			}
+		})
+	}
+}
+
+func TestUserHandlerUpdateProfile(t *testing.T) {
+	valid := `{"firstName":"Ada","timezone":"Europe/London"}`
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{name: "updated", body: valid, status: http.StatusOK},
+		{name: "invalid avatar URL", body: `{"avatarURL":"javascript:alert(1)"}`, status: http.StatusBadRequest},
+		{name: "invalid visibility", body: `{"visibility":{"firstName":"friends"}}`, status: http.StatusBadRequest},
+		{name: "unsupported locale", body: `{"locale":"tlh"}`, err: service.ErrUnsupportedLocale, status: http.StatusBadRequest},
+		{name: "unknown timezone", body: `{"timezone":"Mars/Olympus"}`, err: service.ErrInvalidTimezone, status: http.StatusBadRequest},
+		{name: "visibility rejected", body: valid, err: service.ErrInvalidVisibility, status: http.StatusBadRequest},
+		{name: "failure", body: valid, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewUserHandler(&fakeUserService{
+				updateProfile: func(userID uint, update service.ProfileUpdate) (*models.UserProfile, error) {
+					return &models.UserProfile{UserID: userID, FirstName: update.FirstName}, tt.err
+				},
+			}, nil, nil, testLogger())
+			identity := authtest.User(7)
+			w := serve(h.UpdateProfile, http.MethodPut, "/api/v1/users/profile", tt.body, &identity, "")
+			body := checkResponse(t, w, tt.status, "")
+			if tt.status == http.StatusOK {
+				if profile, _ := body["profile"].(map[string]interface{}); profile["firstName"] != "Ada" {
+					t.Errorf("profile = %v", body["profile"])
+				}
+			}
+		})
+	}
+}
+
+func TestUserHandlerGetDirectory(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{name: "listed", status: http.StatusOK},
+		{name: "failure", err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewUserHandler(&fakeUserService{
+				directory: func() ([]service.UserWithProfile, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return []service.UserWithProfile{{
+						User:    *testUser(1, "user"),
+						Profile: models.UserProfile{FirstName: "Ada", Timezone: "Europe/London"},
+					}}, nil
+				},
+			}, nil, nil, testLogger())
+			identity := authtest.User(7)
+			w := serve(h.GetDirectory, http.MethodGet, "/api/v1/users/directory", "", &identity, "")
+			body := checkResponse(t, w, tt.status, "")
+			if tt.status != http.StatusOK {
+				return
+			}
+			users, _ := body["users"].([]interface{})
+			if len(users) != 1 {
+				t.Fatalf("users = %v", body["users"])
+			}
+			profile, _ := users[0].(map[string]interface{})["profile"].(map[string]interface{})
+			if profile["firstName"] != "Ada" {
+				t.Errorf("public firstName missing: %v", profile)
+			}
+			if _, shown := profile["timezone"]; shown {
+				t.Errorf("private timezone shown: %v", profile)
+			}
+		})
+	}
+}
+
+func TestUserHandlerChangePassword(t *testing.T) {
+	valid := `{"currentPassword":"Old-Horse-42","newPassword":"New-Horse-42"}`
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{name: "changed", body: valid, status: http.StatusOK},
+		{name: "missing new password", body: `{"currentPassword":"Old-Horse-42"}`, status: http.StatusBadRequest},
+		{name: "user gone", body: valid, err: service.ErrUserNotFound, status: http.StatusNotFound},
+		{name: "incorrect password", body: valid, err: service.ErrIncorrectPassword, status: http.StatusUnauthorized},
+		{name: "external password", body: valid, err: service.ErrExternalPassword, status: http.StatusForbidden},
+		{name: "changed too recently", body: valid, err: &service.PasswordTooRecentError{RetryAt: time.Now().Add(time.Hour)}, status: http.StatusTooManyRequests},
+		{name: "password rejected", body: valid, err: &service.PasswordRejectedError{Violations: []auth.PasswordViolation{{Message: "too short"}}}, status: http.StatusBadRequest},
+		{name: "breach check unavailable", body: valid, err: service.ErrPasswordCheckUnavailable, status: http.StatusServiceUnavailable},
+		{name: "failure", body: valid, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity := authtest.User(7)
+			h := NewUserHandler(&fakeUserService{
+				changePassword: func(userID uint, currentPassword, newPassword, currentSession string) (int, error) {
+					if currentSession != identity.SessionID {
+						t.Errorf("current session = %q, want %q", currentSession, identity.SessionID)
+					}
+					return 2, tt.err
+				},
+			}, nil, nil, testLogger())
+			w := serve(h.ChangePassword, http.MethodPut, "/api/v1/users/change-password", tt.body, &identity, "")
+			body := checkResponse(t, w, tt.status, "")
+			switch tt.status {
+			case http.StatusOK:
+				if body["terminatedSessions"] != float64(2) {
+					t.Errorf("terminatedSessions = %v", body["terminatedSessions"])
+				}
+			case http.StatusTooManyRequests:
+				if w.Header().Get("Retry-After") == "" {
+					t.Error("no Retry-After")
+				}
+			}
+		})
+	}
+}
+
+func TestUserHandlerChangeEmail(t *testing.T) {
+	valid := `{"newEmail":"ada@example.org","password":"Correct-Horse-42"}`
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{name: "requested", body: valid, status: http.StatusAccepted},
+		{name: "invalid email", body: `{"newEmail":"ada","password":"Correct-Horse-42"}`, status: http.StatusBadRequest},
+		{name: "user gone", body: valid, err: service.ErrUserNotFound, status: http.StatusNotFound},
+		{name: "incorrect password", body: valid, err: service.ErrIncorrectPassword, status: http.StatusUnauthorized},
+		{name: "unchanged", body: valid, err: service.ErrEmailUnchanged, status: http.StatusBadRequest},
+		{name: "email taken", body: valid, err: service.ErrEmailTaken, status: http.StatusConflict},
+		{name: "failure", body: valid, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewUserHandler(nil, &fakeAccountService{
+				requestEmailChange: func(userID uint, password, newEmail string, client service.ClientInfo) error {
+					return tt.err
+				},
+			}, nil, testLogger())
+			identity := authtest.User(7)
+			w := serve(h.ChangeEmail, http.MethodPut, "/api/v1/users/email", tt.body, &identity, "")
+			checkResponse(t, w, tt.status, "")
+		})
+	}
+}
+
+func TestUserHandlerChangeUsername(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{name: "renamed", body: `{"username":"countess"}`, status: http.StatusOK},
+		{name: "too short", body: `{"username":"ad"}`, status: http.StatusBadRequest},
+		{name: "invalid characters", body: `{"username":"ada lovelace"}`, status: http.StatusBadRequest},
+		{name: "user gone", body: `{"username":"countess"}`, err: service.ErrUserNotFound, status: http.StatusNotFound},
+		{name: "cooldown", body: `{"username":"countess"}`, err: &service.UsernameCooldownError{RetryAt: time.Now().Add(24 * time.Hour)}, status: http.StatusTooManyRequests},
+		{name: "username taken", body: `{"username":"countess"}`, err: service.ErrUsernameTaken, status: http.StatusConflict},
+		{name: "failure", body: `{"username":"countess"}`, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewUserHandler(nil, &fakeAccountService{
+				changeUsername: func(userID uint, username string, client service.ClientInfo) (*models.User, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					user := testUser(userID, "user")
+					user.Username = username
+					return user, nil
+				},
+			}, nil, testLogger())
+			identity := authtest.User(7)
+			w := serve(h.ChangeUsername, http.MethodPut, "/api/v1/users/username", tt.body, &identity, "")
+			body := checkResponse(t, w, tt.status, "")
+			if tt.status == http.StatusOK && body["username"] != "countess" {
+				t.Errorf("username = %v", body["username"])
+			}
+		})
+	}
+}
+
+func TestUserHandlerDeactivateAccount(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{name: "deactivated", status: http.StatusOK},
+		{name: "failure", err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewUserHandler(nil, &fakeAccountService{
+				deactivate: func(userID uint, client service.ClientInfo) error {
+					return tt.err
+				},
+			}, nil, testLogger())
+			identity := authtest.User(7)
+			w := serve(h.DeactivateAccount, http.MethodPost, "/api/v1/users/deactivate", "", &identity, "")
+			checkResponse(t, w, tt.status, "")
+		})
+	}
+}
+
+func TestUserHandlerDeleteAccount(t *testing.T) {
+	scheduled := time.Now().Add(30 * 24 * time.Hour)
+	tests := []struct {
+		name        string
+		gracePeriod time.Duration
+		err         error
+		status      int
+		scheduled   bool
+	}{
+		{name: "erased", status: http.StatusOK},
+		{name: "erase failure", err: errDatabase, status: http.StatusInternalServerError},
+		{name: "scheduled", gracePeriod: 30 * 24 * time.Hour, status: http.StatusOK, scheduled: true},
+		{name: "schedule failure", gracePeriod: 30 * 24 * time.Hour, err: errDatabase, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewUserHandler(nil, &fakeAccountService{
+				deletionGracePeriod: tt.gracePeriod,
+				scheduleDeletion: func(userID uint, client service.ClientInfo) (*models.User, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					user := testUser(userID, "user")
+					user.DeletionScheduledAt = &scheduled
+					return user, nil
+				},
+			}, &fakeErasureService{
+				erase: func(userID uint, mode string) (string, error) {
+					if tt.gracePeriod > 0 {
+						t.Error("erased during the grace period")
+					}
+					return "soft", tt.err
+				},
+			}, testLogger())
+			identity := authtest.User(7)
+			w := serve(h.DeleteAccount, http.MethodDelete, "/api/v1/users/account", "", &identity, "")
+			body := checkResponse(t, w, tt.status, "")
+			if _, ok := body["deletionScheduledAt"]; ok != tt.scheduled {
+				t.Errorf("deletionScheduledAt = %v, want it set: %v", body["deletionScheduledAt"], tt.scheduled)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+// Package v2 holds the handlers of version 2 of the API, served below /api/v2 next to
+// version 1. The versions share the services; each has its own request and response
+// types, so a version's JSON only changes with the next version. Routes not redefined
+// here are only served by v1. Responses are wrapped by middleware.EnvelopeMiddleware,
+// so handlers write the data alone and put list positions in the meta object.
+//
+// The Swagger document of this version is generated from this package alone:
+//
+//	swag init -g doc.go -d internal/handlers/v2 --instanceName v2 -o docs/v2
+package v2
+
+// @title           User Management API
+// @version         2.0
+// @description     Version 2 of the user management API. Every response is an envelope: {"data", "meta"} on success, {"errors", "meta"} on failure. Lists are paged with cursors and timestamps are returned in the user's timezone.
+// @termsOfService  http://swagger.io/terms/
+
+// @contact.name   API Support
+// @contact.url    http://www.swagger.io/support
+// @contact.email  support@swagger.io
+
+// @license.name  MIT
+// @license.url   https://opensource.org/licenses/MIT
+
+// @host      localhost:8080
+// @BasePath  /api/v2
+
+// @securityDefinitions.apikey Bearer
+// @in header
+// @name Authorization
+// @description Type "Bearer" followed by a space and JWT token.
+
+// @securityDefinitions.apikey ApiKey
+// @in header
+// @name X-API-Key
+// @description API key created via POST /api/v1/users/api-keys, accepted on profile and admin routes.
@@ -0,0 +1,71 @@
+package v2
+
+import "time"
+
+// User is a user with their profile
+type User struct {
+	ID            uint      `json:"id" example:"1"`
+	Email         string    `json:"email" example:"user@example.com"`
+	Username      string    `json:"username" example:"johndoe"`
+	Role          string    `json:"role" example:"user"`
+	EmailVerified bool      `json:"emailVerified" example:"true"`
+	Status        string    `json:"status" example:"active"`
+	CreatedAt     time.Time `json:"createdAt" example:"2025-08-04T12:00:00Z"`
+	UpdatedAt     time.Time `json:"updatedAt" example:"2025-08-04T12:00:00Z"`
+	Profile       Profile   `json:"profile"`
+	// Features are the keys of the feature flags on for the user, given by /users/me only
+	Features []string `json:"features,omitempty" example:"profile-editor"`
+}
+
+// Profile holds the user's personal details
+type Profile struct {
+	FirstName     string `json:"firstName" example:"John"`
+	LastName      string `json:"lastName" example:"Doe"`
+	PreferredName string `json:"preferredName" example:"Johnny"`
+	Pronouns      string `json:"pronouns" example:"he/him"`
+	Honorific     string `json:"honorific" example:"Dr."`
+	Bio           string `json:"bio" example:"Software developer"`
+	AvatarURL     string `json:"avatarUrl" example:"/media/avatars/1?v=1722772800"`
+	Locale        string `json:"locale" example:"en"`
+	Timezone      string `json:"timezone" example:"Europe/Berlin"`
+}
+
+// Every v2 response is an envelope: data and meta on success, errors and meta on
+// failure. The types below describe it for the Swagger document.
+
+// Meta is the envelope's meta object
+type Meta struct {
+	RequestID string `json:"requestId" example:"3f2c9a1e7b4d5f60"`
+}
+
+// ListMeta is the meta object of a list. nextCursor is omitted on the last page.
+type ListMeta struct {
+	RequestID  string `json:"requestId" example:"3f2c9a1e7b4d5f60"`
+	NextCursor string `json:"nextCursor,omitempty" example:"MTAw"`
+}
+
+// Error describes one reason a request failed
+type Error struct {
+	Status  int    `json:"status" example:"404"`
+	Message string `json:"message" example:"User not found"`
+	Code    string `json:"code,omitempty" example:"account_suspended"`
+	Field   string `json:"field,omitempty" example:"email"`
+}
+
+// UserResponse is the envelope of a user
+type UserResponse struct {
+	Data User `json:"data"`
+	Meta Meta `json:"meta"`
+}
+
+// UserListResponse is the envelope of a page of users
+type UserListResponse struct {
+	Data []User   `json:"data"`
+	Meta ListMeta `json:"meta"`
+}
+
+// ErrorResponse is the envelope of a failed request
+type ErrorResponse struct {
+	Errors []Error `json:"errors"`
+	Meta   Meta    `json:"meta"`
+}
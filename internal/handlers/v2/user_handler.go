@@ -0,0 +1,162 @@
+package v2
+
+import (
+	"api/internal/handlers"
+	"api/internal/middleware"
+	"api/internal/models"
+	"api/internal/service"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Default and largest page size of user lists
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type UserHandler struct {
+	users  service.UserService
+	logger *logrus.Logger
+}
+
+func NewUserHandler(users service.UserService, logger *logrus.Logger) *UserHandler {
+	return &UserHandler{
+		users:  users,
+		logger: logger,
+	}
+}
+
+func userResponse(c *gin.Context, user *models.User, profile *models.UserProfile) User {
+	return User{
+		ID:            user.ID,
+		Email:         user.Email,
+		Username:      user.Username,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
+		Status:        user.AccountStatus(time.Now()),
+		CreatedAt:     handlers.LocalTime(c, user.CreatedAt),
+		UpdatedAt:     handlers.LocalTime(c, user.UpdatedAt),
+		Profile: Profile{
+			FirstName:     profile.FirstName,
+			LastName:      profile.LastName,
+			PreferredName: string(profile.PreferredName),
+			Pronouns:      string(profile.Pronouns),
+			Honorific:     profile.Honorific,
+			Bio:           string(profile.Bio),
+			AvatarURL:     handlers.AvatarURL(profile),
+			Locale:        profile.Locale,
+			Timezone:      profile.Timezone,
+		},
+	}
+}
+
+// encodeCursor and decodeCursor keep the position in a list opaque to clients, so it
+// can change without a new version
+func encodeCursor(lastID uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(lastID), 10)))
+}
+
+func decodeCursor(cursor string) (uint, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(string(raw), 10, 64)
+	return uint(id), err
+}
+
+// GetMe godoc
+// @Summary Get your user
+// @Description Get the authenticated user, their profile and the keys of the feature flags on for them. Timestamps are in the user's timezone. fields limits the response to the given fields, e.g. email,username,profile.firstName. The response carries Last-Modified and an ETag: a request with a matching If-None-Match, or an If-Modified-Since not older than Last-Modified, gets 304 without a body.
+// @Tags users
+// @Produce json
+// @Security Bearer
+// @Security ApiKey
+// @Param If-None-Match header string false "ETag of a previous response"
+// @Param If-Modified-Since header string false "Last-Modified of a previous response"
+// @Param fields query string false "Fields to return, e.g. email,username,profile.firstName"
+// @Success 200 {object} UserResponse
+// @Success 304 {string} string "Not modified"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "User not found"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /users/me [get]
+func (h *UserHandler) GetMe(c *gin.Context) {
+	user, profile, err := h.users.GetProfile(c.GetUint("userID"))
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.WithError(err).Error("Failed to fetch user profile")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch profile"})
+		return
+	}
+
+	if handlers.NotModified(c, user.UpdatedAt, profile.UpdatedAt) {
+		return
+	}
+	response := userResponse(c, user, profile)
+	response.Features = middleware.EnabledFeatures(c)
+	c.JSON(http.StatusOK, handlers.SelectFields(c, response))
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description List users in ID order a page at a time (admin only); pass meta.nextCursor of a page as cursor to get the next one. fields limits every user to the given fields, e.g. email,username,profile.firstName. When the access token acts for an organization only its members are listed.
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Security ApiKey
+// @Param cursor query string false "nextCursor of the previous page; omit for the first page"
+// @Param limit query int false "Page size, 50 by default and at most 200"
+// @Param fields query string false "Fields of each user to return, e.g. email,username,profile.firstName"
+// @Success 200 {object} UserListResponse
+// @Failure 400 {object} ErrorResponse "Invalid cursor or limit"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Forbidden - Admin access required"
+// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Router /admin/users [get]
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	afterID, err := decodeCursor(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	limit := defaultPageSize
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+			return
+		}
+	}
+
+	// One more than the page tells whether another page follows
+	users, err := h.users.ListUsersPage(c.GetUint("orgID"), afterID, limit+1)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to fetch users list")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		return
+	}
+
+	page := make([]User, 0, min(len(users), limit))
+	for i := range users {
+		if i == limit {
+			handlers.SetMeta(c, "nextCursor", encodeCursor(users[i-1].User.ID))
+			break
+		}
+		page = append(page, userResponse(c, &users[i].User, &users[i].Profile))
+	}
+	c.JSON(http.StatusOK, handlers.SelectFields(c, page))
+}
@@ -0,0 +1,248 @@
+// Package i18n resolves the language of a request and translates the
+// messages returned to clients and the events described in notification
+// emails, from the go-i18n catalogs embedded from locales/.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-playground/validator/v10"
+	goi18n "github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+// Default is used when neither the request nor the user picked a supported locale
+const Default = "en"
+
+//go:embed locales/*.toml
+var catalogFiles embed.FS
+
+// localizers holds a localizer per supported locale, loaded from the catalogs in
+// locales/, one active.<locale>.toml per language. Catalogs hold the validation
+// templates keyed by validator tag, the notification texts keyed with a "notify_"
+// prefix and the translations of API messages keyed by their English text.
+var localizers = loadCatalogs()
+
+func loadCatalogs() map[string]*goi18n.Localizer {
+	bundle := goi18n.NewBundle(language.English)
+	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+	files, err := fs.Glob(catalogFiles, "locales/*.toml")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		if _, err := bundle.LoadMessageFileFS(catalogFiles, file); err != nil {
+			panic(fmt.Sprintf("i18n catalog %s: %v", file, err))
+		}
+	}
+
+	result := make(map[string]*goi18n.Localizer)
+	for _, tag := range bundle.LanguageTags() {
+		base, _ := tag.Base()
+		result[base.String()] = goi18n.NewLocalizer(bundle, tag.String())
+	}
+	return result
+}
+
+// lookup returns the text stored under key for locale, falling back to the default locale
+func lookup(locale, key string) (string, bool) {
+	localizer, ok := localizers[locale]
+	if !ok {
+		localizer = localizers[Default]
+	}
+	text, err := localizer.Localize(&goi18n.LocalizeConfig{MessageID: key})
+	if err != nil && text == "" {
+		return "", false
+	}
+	return text, true
+}
+
+// Supported lists the available locales in alphabetical order
+func Supported() []string {
+	locales := make([]string, 0, len(localizers))
+	for locale := range localizers {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Normalize maps a language tag such as "es-MX" to a supported locale, or "" if there is none
+func Normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if _, ok := localizers[tag]; ok {
+		return tag
+	}
+	return ""
+}
+
+// FromAcceptLanguage returns the supported locale the client prefers most, or "" if
+// the header names none of them
+func FromAcceptLanguage(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		locale := Normalize(fields[0])
+		if locale == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = locale, q
+		}
+	}
+	return best
+}
+
+// Message translates key for locale, falling back to the default locale
+func Message(locale, key string, args ...interface{}) string {
+	format, _ := lookup(locale, key)
+	return fmt.Sprintf(format, args...)
+}
+
+// Translate returns the translation of an API message, given in English, for locale,
+// or text itself when the catalog has none
+func Translate(locale, text string) string {
+	if locale == Default {
+		return text
+	}
+	if translated, ok := lookup(locale, text); ok {
+		return translated
+	}
+	return text
+}
+
+// FieldError is one rejected field of a request body
+type FieldError struct {
+	Field   string `json:"field" example:"profile.firstName"` // path in the body, with [i] for list items
+	Code    string `json:"code" example:"max"`                // the rule that failed, e.g. required, max or type
+	Message string `json:"message" example:"firstName must be at most 100 characters long"`
+}
+
+// FieldErrors describes every rejected field of a binding error in locale: failed
+// validation rules, and values of the wrong JSON type. It returns nil for other errors,
+// such as a body that is not JSON.
+func FieldErrors(locale string, err error) []FieldError {
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) && typeError.Field != "" {
+		return []FieldError{{
+			Field:   typeError.Field,
+			Code:    "type",
+			Message: Message(locale, "type", typeError.Field, jsonType(typeError.Type)),
+		}}
+	}
+
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return nil
+	}
+	result := make([]FieldError, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		field := fieldPath(fe)
+		key := messageKey(fe)
+		result = append(result, FieldError{
+			Field:   field,
+			Code:    fe.Tag(),
+			Message: Message(locale, key, field, fe.Param()),
+		})
+	}
+	return result
+}
+
+// Validation turns a binding error into a message in locale. Validation failures
+// list every rejected field; malformed bodies get a generic message.
+func Validation(locale string, err error) string {
+	fields := FieldErrors(locale, err)
+	if len(fields) == 0 {
+		return Message(locale, "invalid_body")
+	}
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, field.Message)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// messageKey picks the template for a failed rule: lengths of lists and bounds of
+// numbers read differently from lengths of strings, and the conditional required_*
+// rules read like required
+func messageKey(fe validator.FieldError) string {
+	key := fe.Tag()
+	switch kind := fe.Kind(); {
+	case strings.HasPrefix(key, "required_"):
+		key = "required"
+	case key == "min" || key == "max":
+		switch kind {
+		case reflect.Slice, reflect.Array, reflect.Map:
+			key += "_items"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			key = map[string]string{"min": "gte", "max": "lte"}[key]
+		}
+	}
+	if _, ok := lookup(Default, key); !ok {
+		key = "default"
+	}
+	return key
+}
+
+// fieldPath is the field's path in the body without the name of the Go type bound to,
+// e.g. profile.firstName or emails[1]
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		path = fe.Field()
+	}
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		parts[i] = fieldName(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// jsonType names a Go type the way JSON clients know it
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Pointer:
+		return jsonType(t.Elem())
+	default:
+		return "number"
+	}
+}
+
+// fieldName converts a Go field name to the camelCase name used in request bodies
+func fieldName(field string) string {
+	if field == "" {
+		return field
+	}
+	return strings.ToLower(field[:1]) + field[1:]
+}
@@ -0,0 +1,143 @@
+// Package imaging contains the small amount of image processing needed for
+// user uploaded media: decoding the allowed formats, downscaling and encoding.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// Allowed content types mapped to the format name reported by image.Decode
+var formats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// Decode sniffs the content type of data and decodes it if it is an allowed format
+func Decode(data []byte) (image.Image, string, error) {
+	contentType := http.DetectContentType(data)
+	format, ok := formats[contentType]
+	if !ok {
+		return nil, "", ErrUnsupportedFormat
+	}
+
+	var img image.Image
+	var err error
+	switch format {
+	case "jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	case "png":
+		img, err = png.Decode(bytes.NewReader(data))
+	case "gif":
+		img, err = gif.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return img, contentType, nil
+}
+
+// DecodeConfig returns the dimensions of an allowed image without decoding the pixels
+func DecodeConfig(data []byte) (image.Config, error) {
+	if _, ok := formats[http.DetectContentType(data)]; !ok {
+		return image.Config{}, ErrUnsupportedFormat
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	return cfg, err
+}
+
+// Fit scales img down so neither side exceeds max, keeping the aspect ratio
+func Fit(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= max && h <= max {
+		return img
+	}
+	if w >= h {
+		return resize(img, b, max, h*max/w)
+	}
+	return resize(img, b, w*max/h, max)
+}
+
+// Thumbnail center crops img to a square and scales it to size x size
+func Thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+	return resize(img, image.Rect(x, y, x+side, y+side), size, size)
+}
+
+// resize scales the src region of img to w x h by averaging the source pixels
+// that fall into each destination pixel (a box filter), which is good enough
+// for downscaling photos
+func resize(img image.Image, src image.Rectangle, w, h int) image.Image {
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	// Work on an RGBA copy so pixel access is cheap regardless of the source model
+	rgba := image.NewRGBA(src)
+	draw.Draw(rgba, src, img, src.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := src.Dx(), src.Dy()
+	for dy := 0; dy < h; dy++ {
+		y0 := src.Min.Y + dy*sh/h
+		y1 := src.Min.Y + (dy+1)*sh/h
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for dx := 0; dx < w; dx++ {
+			x0 := src.Min.X + dx*sw/w
+			x1 := src.Min.X + (dx+1)*sw/w
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := rgba.PixOffset(sx, sy)
+					r += uint32(rgba.Pix[i])
+					g += uint32(rgba.Pix[i+1])
+					b += uint32(rgba.Pix[i+2])
+					a += uint32(rgba.Pix[i+3])
+					n++
+				}
+			}
+			dst.SetRGBA(dx, dy, color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)})
+		}
+	}
+	return dst
+}
+
+// Encode writes img in the given content type. GIFs are re-encoded as PNG since
+// only the first frame is kept; the returned content type reflects that.
+func Encode(w io.Writer, img image.Image, contentType string) (string, error) {
+	switch contentType {
+	case "image/jpeg":
+		return contentType, jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	case "image/png", "image/gif":
+		return "image/png", png.Encode(w, img)
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
@@ -0,0 +1,133 @@
+// Package ipfilter decides which client addresses may reach which routes
+package ipfilter
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Rule actions
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+// ErrInvalidRule is returned for rules with an unknown action, a malformed path or
+// an address that is neither an IP nor a CIDR range
+var ErrInvalidRule = errors.New("invalid IP filter rule")
+
+// Rule allows or denies the clients in Network on the routes matching Path. Path is
+// matched against the registered route template (e.g. /api/v1/admin/users/:id); a
+// trailing "/*" matches every route below the prefix and an empty path every route.
+type Rule struct {
+	Path    string
+	Action  string
+	Network *net.IPNet
+}
+
+// ParseRule validates a rule. address is a CIDR range or a single IP.
+func ParseRule(path, action, address string) (Rule, error) {
+	if action != Allow && action != Deny {
+		return Rule{}, fmt.Errorf("%w: action %q must be %s or %s", ErrInvalidRule, action, Allow, Deny)
+	}
+	if path != "" && !strings.HasPrefix(path, "/") {
+		return Rule{}, fmt.Errorf("%w: path %q must start with /", ErrInvalidRule, path)
+	}
+	address = strings.TrimSpace(address)
+	_, network, err := net.ParseCIDR(address)
+	if err != nil {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return Rule{}, fmt.Errorf("%w: %q is not an IP address or CIDR range", ErrInvalidRule, address)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+	return Rule{Path: path, Action: action, Network: network}, nil
+}
+
+func (r Rule) matches(route string) bool {
+	if r.Path == "" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(r.Path, "/*"); ok {
+		return route == prefix || strings.HasPrefix(route, prefix+"/")
+	}
+	return route == r.Path
+}
+
+// Allows reports whether rules let ip reach route. A matching deny rule containing ip
+// blocks it. When allow rules match the route, ip must be in one of them; routes
+// without matching allow rules are open to every address that is not denied.
+func Allows(rules []Rule, ip net.IP, route string) bool {
+	restricted, allowed := false, false
+	for _, rule := range rules {
+		if !rule.matches(route) {
+			continue
+		}
+		contains := ip != nil && rule.Network.Contains(ip)
+		if rule.Action == Deny {
+			if contains {
+				return false
+			}
+			continue
+		}
+		restricted = true
+		allowed = allowed || contains
+	}
+	return !restricted || allowed
+}
+
+// Filter holds the rules from the configuration file and those managed through the
+// admin API, which are checked together. Both sets are replaced as a whole while
+// requests are being checked.
+type Filter struct {
+	mu      sync.RWMutex
+	static  []Rule
+	dynamic []Rule
+	rules   []Rule // static followed by dynamic
+}
+
+func NewFilter() *Filter {
+	return &Filter{}
+}
+
+// SetStatic replaces the rules from the configuration file
+func (f *Filter) SetStatic(rules []Rule) {
+	f.mu.Lock()
+	f.static = rules
+	f.combine()
+	f.mu.Unlock()
+}
+
+// SetDynamic replaces the rules managed through the admin API
+func (f *Filter) SetDynamic(rules []Rule) {
+	f.mu.Lock()
+	f.dynamic = rules
+	f.combine()
+	f.mu.Unlock()
+}
+
+func (f *Filter) combine() {
+	f.rules = append(append(make([]Rule, 0, len(f.static)+len(f.dynamic)), f.static...), f.dynamic...)
+}
+
+// Static returns the rules from the configuration file
+func (f *Filter) Static() []Rule {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.static
+}
+
+// Allows reports whether the current rules let ip reach route
+func (f *Filter) Allows(ip net.IP, route string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return Allows(f.rules, ip, route)
+}
@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Lock elects the leader among the instances sharing a database. It is taken on a
+// connection of its own and held by its session, so it is released when the session
+// ends.
+type Lock interface {
+	// TryLock takes the lock on conn without waiting, reporting whether it was free
+	TryLock(ctx context.Context, conn *sql.Conn) (bool, error)
+	Unlock(ctx context.Context, conn *sql.Conn) error
+}
+
+// AdvisoryLock is the Postgres advisory lock key
+func AdvisoryLock(key int64) Lock {
+	return advisoryLock(key)
+}
+
+type advisoryLock int64
+
+func (l advisoryLock) TryLock(ctx context.Context, conn *sql.Conn) (bool, error) {
+	var acquired bool
+	err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", int64(l)).Scan(&acquired)
+	return acquired, err
+}
+
+func (l advisoryLock) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", int64(l))
+	return err
+}
+
+// NamedLock is the MySQL user lock name, taken with GET_LOCK
+func NamedLock(name string) Lock {
+	return namedLock(name)
+}
+
+type namedLock string
+
+func (l namedLock) TryLock(ctx context.Context, conn *sql.Conn) (bool, error) {
+	// 1 when taken, 0 when held by another session, NULL on an error such as a kill
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", string(l)).Scan(&acquired); err != nil {
+		return false, err
+	}
+	if !acquired.Valid {
+		return false, fmt.Errorf("GET_LOCK(%q) failed", string(l))
+	}
+	return acquired.Int64 == 1, nil
+}
+
+func (l namedLock) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", string(l))
+	return err
+}
+
+// LocalLock is always free: the instance is the only one, as with an SQLite file
+func LocalLock() Lock {
+	return localLock{}
+}
+
+type localLock struct{}
+
+func (localLock) TryLock(context.Context, *sql.Conn) (bool, error) {
+	return true, nil
+}
+
+func (localLock) Unlock(context.Context, *sql.Conn) error {
+	return nil
+}
@@ -0,0 +1,220 @@
+// Package jobs runs periodic background jobs. Jobs marked as singletons run on
+// exactly one instance of a cluster: the instance holding a database lock (a
+// Postgres advisory lock or a MySQL user lock), which is released automatically
+// when its database session ends.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// Job is a function run every Interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// Singleton jobs only run on the elected leader instance
+	Singleton bool
+	Run       func(ctx context.Context) error
+}
+
+var (
+	leaderGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jobs_leader",
+		Help: "1 if this instance holds the singleton job leadership, 0 otherwise.",
+	}, []string{"instance"})
+	runsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobs_runs_total",
+		Help: "Background job runs by job, instance and result.",
+	}, []string{"job", "instance", "result"})
+	lastRunGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jobs_last_run_timestamp_seconds",
+		Help: "Unix time of the last completed run of a background job on this instance.",
+	}, []string{"job", "instance"})
+	registerMetrics sync.Once
+)
+
+// Scheduler runs jobs and takes part in the leader election for singleton jobs
+type Scheduler struct {
+	db       *sql.DB
+	lock     Lock
+	instance string
+	logger   *logrus.Logger
+	jobs     []Job
+	leader   atomic.Bool
+}
+
+// NewScheduler creates a scheduler. Instances share leadership of singleton
+// jobs through lock; instance identifies this process in logs and metrics.
+func NewScheduler(db *sql.DB, lock Lock, instance string, logger *logrus.Logger) *Scheduler {
+	registerMetrics.Do(func() {
+		prometheus.MustRegister(leaderGauge, runsCounter, lastRunGauge)
+	})
+	leaderGauge.WithLabelValues(instance).Set(0)
+	return &Scheduler{
+		db:       db,
+		lock:     lock,
+		instance: instance,
+		logger:   logger,
+	}
+}
+
+// Add registers a job; it must be called before Start
+func (s *Scheduler) Add(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// IsLeader reports whether this instance currently runs the singleton jobs
+func (s *Scheduler) IsLeader() bool {
+	return s.leader.Load()
+}
+
+// Instance returns the name of this instance
+func (s *Scheduler) Instance() string {
+	return s.instance
+}
+
+// Start runs the leader election and every job until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context, electionInterval time.Duration) {
+	go s.elect(ctx, electionInterval)
+	for _, job := range s.jobs {
+		go s.loop(ctx, job)
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if job.Singleton && !s.IsLeader() {
+				continue
+			}
+			s.run(ctx, job)
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	logger := s.logger.WithFields(logrus.Fields{"job": job.Name, "instance": s.instance})
+	defer func() {
+		if r := recover(); r != nil {
+			runsCounter.WithLabelValues(job.Name, s.instance, "panic").Inc()
+			logger.WithField("panic", r).Error("Background job panicked")
+		}
+	}()
+
+	start := time.Now()
+	if err := job.Run(ctx); err != nil {
+		runsCounter.WithLabelValues(job.Name, s.instance, "error").Inc()
+		logger.WithError(err).Error("Background job failed")
+		return
+	}
+	runsCounter.WithLabelValues(job.Name, s.instance, "success").Inc()
+	lastRunGauge.WithLabelValues(job.Name, s.instance).SetToCurrentTime()
+	logger.WithField("duration", time.Since(start).String()).Debug("Background job completed")
+}
+
+// elect tries to take the lock until it succeeds, then keeps checking
+// that the session holding it is alive. The lock is session scoped, so it lives
+// on a dedicated connection taken out of the pool.
+func (s *Scheduler) elect(ctx context.Context, interval time.Duration) {
+	var conn *sql.Conn
+	release := func() {
+		if conn == nil {
+			return
+		}
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := s.lock.Unlock(unlockCtx, conn)
+		cancel()
+		if err != nil {
+			// Closing conn would put the session back in the pool still holding the
+			// lock, so it is closed for good instead
+			s.logger.WithError(err).Warn("Failed to release background job leadership")
+			discard(conn)
+		} else {
+			conn.Close()
+		}
+		conn = nil
+	}
+	setLeader := func(leader bool) {
+		if s.leader.Swap(leader) == leader {
+			return
+		}
+		if leader {
+			leaderGauge.WithLabelValues(s.instance).Set(1)
+			s.logger.WithField("instance", s.instance).Info("Acquired background job leadership")
+		} else {
+			leaderGauge.WithLabelValues(s.instance).Set(0)
+			s.logger.WithField("instance", s.instance).Warn("Lost background job leadership")
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if conn != nil {
+			if err := conn.PingContext(ctx); err != nil {
+				s.logger.WithError(err).Warn("Leader database session lost")
+				setLeader(false)
+				discard(conn)
+				conn = nil
+			}
+		}
+		if conn == nil {
+			acquired, c, err := s.tryLock(ctx)
+			if err != nil {
+				s.logger.WithError(err).Warn("Leader election failed")
+			}
+			if acquired {
+				conn = c
+				setLeader(true)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			setLeader(false)
+			release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tryLock(ctx context.Context) (bool, *sql.Conn, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return false, nil, err
+	}
+	acquired, err := s.lock.TryLock(ctx, conn)
+	if err != nil {
+		// The lock may have been taken before the error
+		discard(conn)
+		return false, nil, err
+	}
+	if !acquired {
+		conn.Close()
+		return false, nil, nil
+	}
+	return true, conn, nil
+}
+
+// discard closes the database session of conn instead of returning it to the pool. A
+// session scoped lock is held until its session ends, and Close keeps the session
+// open for the next user of the pool, so a session that may still hold the lock has
+// to go.
+func discard(conn *sql.Conn) {
+	conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
+}
@@ -0,0 +1,226 @@
+// Package jsonpatch applies RFC 6902 JSON Patch and RFC 7396 JSON Merge Patch
+// documents to JSON objects decoded into map[string]interface{}. Arrays are
+// treated as opaque values, which is all the admin documents need.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrTestFailed is returned when a "test" operation does not match the document
+var ErrTestFailed = errors.New("test failed")
+
+// Operation is a single RFC 6902 operation
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// OperationError reports which operation of a patch failed
+type OperationError struct {
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// ParsePointer splits an RFC 6901 JSON pointer into unescaped reference tokens
+func ParsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	parts := strings.Split(pointer[1:], "/")
+	for i, p := range parts {
+		parts[i] = strings.ReplaceAll(strings.ReplaceAll(p, "~1", "/"), "~0", "~")
+	}
+	return parts, nil
+}
+
+// Apply applies ops to doc in order. doc is modified in place; on error it may be partially patched.
+// Each operation's path is passed to allow before it is applied so callers can restrict writable fields.
+func Apply(doc map[string]interface{}, ops []Operation, allow func(op, path string) error) error {
+	for i, op := range ops {
+		if err := applyOne(doc, op, allow); err != nil {
+			return &OperationError{Index: i, Op: op.Op, Path: op.Path, Err: err}
+		}
+	}
+	return nil
+}
+
+func applyOne(doc map[string]interface{}, op Operation, allow func(op, path string) error) error {
+	if allow != nil && op.Op != "test" {
+		if err := allow(op.Op, op.Path); err != nil {
+			return err
+		}
+	}
+
+	path, err := ParsePointer(op.Path)
+	if err != nil {
+		return err
+	}
+	if len(path) == 0 {
+		return fmt.Errorf("replacing the whole document is not supported")
+	}
+
+	switch op.Op {
+	case "add", "replace":
+		value, err := decodeValue(op.Value)
+		if err != nil {
+			return err
+		}
+		parent, key, err := resolveParent(doc, path)
+		if err != nil {
+			return err
+		}
+		if _, exists := parent[key]; op.Op == "replace" && !exists {
+			return fmt.Errorf("path does not exist")
+		}
+		parent[key] = value
+	case "remove":
+		parent, key, err := resolveParent(doc, path)
+		if err != nil {
+			return err
+		}
+		if _, exists := parent[key]; !exists {
+			return fmt.Errorf("path does not exist")
+		}
+		delete(parent, key)
+	case "test":
+		expected, err := decodeValue(op.Value)
+		if err != nil {
+			return err
+		}
+		parent, key, err := resolveParent(doc, path)
+		if err != nil {
+			return err
+		}
+		actual, exists := parent[key]
+		if !exists || !reflect.DeepEqual(normalize(actual), normalize(expected)) {
+			return ErrTestFailed
+		}
+	case "move", "copy":
+		if allow != nil && op.Op == "move" {
+			if err := allow("remove", op.From); err != nil {
+				return err
+			}
+		}
+		from, err := ParsePointer(op.From)
+		if err != nil {
+			return err
+		}
+		if len(from) == 0 {
+			return fmt.Errorf("invalid from pointer")
+		}
+		srcParent, srcKey, err := resolveParent(doc, from)
+		if err != nil {
+			return err
+		}
+		value, exists := srcParent[srcKey]
+		if !exists {
+			return fmt.Errorf("from path does not exist")
+		}
+		if op.Op == "move" {
+			delete(srcParent, srcKey)
+		}
+		dstParent, dstKey, err := resolveParent(doc, path)
+		if err != nil {
+			return err
+		}
+		dstParent[dstKey] = value
+	default:
+		return fmt.Errorf("unsupported operation %q", op.Op)
+	}
+	return nil
+}
+
+// MergePatch applies an RFC 7396 merge patch to doc in place
+func MergePatch(doc map[string]interface{}, patch map[string]interface{}) {
+	for key, value := range patch {
+		if value == nil {
+			delete(doc, key)
+			continue
+		}
+		if patchObj, ok := value.(map[string]interface{}); ok {
+			target, ok := doc[key].(map[string]interface{})
+			if !ok {
+				target = map[string]interface{}{}
+			}
+			MergePatch(target, patchObj)
+			doc[key] = target
+			continue
+		}
+		doc[key] = value
+	}
+}
+
+// Paths lists the JSON pointers of every leaf value in a merge patch,
+// so merge patches can be checked against the same field rules as JSON Patch
+func Paths(patch map[string]interface{}) []string {
+	var paths []string
+	var walk func(prefix string, obj map[string]interface{})
+	walk = func(prefix string, obj map[string]interface{}) {
+		for key, value := range obj {
+			p := prefix + "/" + strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+			if child, ok := value.(map[string]interface{}); ok {
+				walk(p, child)
+				continue
+			}
+			paths = append(paths, p)
+		}
+	}
+	walk("", patch)
+	return paths
+}
+
+func resolveParent(doc map[string]interface{}, path []string) (map[string]interface{}, string, error) {
+	current := doc
+	for _, token := range path[:len(path)-1] {
+		next, ok := current[token].(map[string]interface{})
+		if !ok {
+			return nil, "", fmt.Errorf("path does not exist")
+		}
+		current = next
+	}
+	return current, path[len(path)-1], nil
+}
+
+func decodeValue(raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("missing value")
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, fmt.Errorf("invalid value: %w", err)
+	}
+	return value, nil
+}
+
+// normalize round-trips v through JSON so values of different Go types compare equal
+func normalize(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
@@ -0,0 +1,162 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER identifiers used by the LDAP operations this package performs (RFC 4511)
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+
+	appBindRequest      = 0x60
+	appBindResponse     = 0x61
+	appUnbindRequest    = 0x42
+	appSearchRequest    = 0x63
+	appSearchEntry      = 0x64
+	appSearchDone       = 0x65
+	appSearchReference  = 0x73
+	appExtendedRequest  = 0x77
+	appExtendedResponse = 0x78
+
+	ctxSimpleAuth     = 0x80 // [0] in BindRequest.authentication
+	ctxExtendedName   = 0x80 // [0] in ExtendedRequest
+	ctxFilterEquality = 0xa3 // [3] in Filter
+)
+
+// maxMessageSize bounds a single response; entries with many groups are a few KB
+const maxMessageSize = 4 << 20
+
+// packet is one decoded BER element
+type packet struct {
+	tag  byte
+	data []byte
+}
+
+// encode returns the BER encoding of an element with the given content
+func encode(tag byte, content ...[]byte) []byte {
+	n := 0
+	for _, c := range content {
+		n += len(c)
+	}
+	out := append([]byte{tag}, encodeLength(n)...)
+	for _, c := range content {
+		out = append(out, c...)
+	}
+	return out
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var digits []byte
+	for ; n > 0; n >>= 8 {
+		digits = append([]byte{byte(n)}, digits...)
+	}
+	return append([]byte{0x80 | byte(len(digits))}, digits...)
+}
+
+func encodeInt(tag byte, v int) []byte {
+	// Minimal two's complement; the values used here are never negative
+	b := []byte{byte(v)}
+	for v >>= 8; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return encode(tag, b)
+}
+
+func encodeString(tag byte, s string) []byte {
+	return encode(tag, []byte(s))
+}
+
+func encodeBool(v bool) []byte {
+	if v {
+		return encode(tagBoolean, []byte{0xff})
+	}
+	return encode(tagBoolean, []byte{0})
+}
+
+// readPacket reads one complete element from r
+func readPacket(r *bufio.Reader) (packet, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		count := int(first & 0x7f)
+		if count == 0 || count > 4 {
+			return packet{}, errors.New("ldap: unsupported length encoding")
+		}
+		length = 0
+		for i := 0; i < count; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return packet{}, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxMessageSize {
+		return packet{}, fmt.Errorf("ldap: message of %d bytes is too large", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return packet{}, err
+	}
+	return packet{tag: tag, data: data}, nil
+}
+
+// children decodes the elements inside a constructed element
+func (p packet) children() ([]packet, error) {
+	var out []packet
+	data := p.data
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, errors.New("ldap: truncated element")
+		}
+		tag, length, header := data[0], int(data[1]), 2
+		if length&0x80 != 0 {
+			count := length & 0x7f
+			if count == 0 || count > 4 || len(data) < 2+count {
+				return nil, errors.New("ldap: invalid length")
+			}
+			length = 0
+			for _, b := range data[2 : 2+count] {
+				length = length<<8 | int(b)
+			}
+			header += count
+		}
+		if length > len(data)-header {
+			return nil, errors.New("ldap: truncated element")
+		}
+		out = append(out, packet{tag: tag, data: data[header : header+length]})
+		data = data[header+length:]
+	}
+	return out, nil
+}
+
+func (p packet) int() (int, error) {
+	if len(p.data) == 0 || len(p.data) > 4 {
+		return 0, errors.New("ldap: invalid integer")
+	}
+	v := int(int8(p.data[0]))
+	for _, b := range p.data[1:] {
+		v = v<<8 | int(b)
+	}
+	return v, nil
+}
@@ -0,0 +1,310 @@
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LDAP result codes handled specially (RFC 4511 section 4.1.9)
+const (
+	resultSuccess            = 0
+	resultSizeLimitExceeded  = 4
+	resultInvalidCredentials = 49
+)
+
+const (
+	protocolVersion   = 3
+	startTLSOID       = "1.3.6.1.4.1.1466.20037"
+	scopeWholeSubtree = 2
+	derefAliasesNever = 0
+	// A login must match exactly one entry, so asking for two is enough to tell
+	searchSizeLimit  = 2
+	searchTimeLimit  = 10 // seconds
+	defaultLDAPPort  = "389"
+	defaultLDAPSPort = "636"
+)
+
+// ResultError is a non-success result returned by the server
+type ResultError struct {
+	Code    int
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ldap: result code %d", e.Code)
+	}
+	return fmt.Sprintf("ldap: result code %d: %s", e.Code, e.Message)
+}
+
+// entry is a search result: the DN and the values of the requested attributes, keyed
+// by lower case attribute name since attribute names are case insensitive
+type entry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+func (e entry) values(attribute string) []string {
+	return e.attributes[strings.ToLower(attribute)]
+}
+
+// conn is a single LDAPv3 connection performing one operation at a time
+type conn struct {
+	net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+	nextID  int
+}
+
+// dial connects to an ldap:// or ldaps:// URL and, when startTLS is set, upgrades a
+// plain connection before anything is sent over it
+func dial(rawURL string, startTLS bool, tlsConfig *tls.Config, timeout time.Duration) (*conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid URL: %w", err)
+	}
+	host := u.Host
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var c net.Conn
+	switch u.Scheme {
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), defaultLDAPPort)
+		}
+		c, err = dialer.Dial("tcp", host)
+	case "ldaps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), defaultLDAPSPort)
+		}
+		c, err = tls.DialWithDialer(dialer, "tcp", host, serverTLSConfig(tlsConfig, u.Hostname()))
+	default:
+		return nil, fmt.Errorf("ldap: unsupported URL scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	lc := &conn{Conn: c, r: bufio.NewReader(c), timeout: timeout}
+	if startTLS && u.Scheme == "ldap" {
+		if err := lc.startTLS(serverTLSConfig(tlsConfig, u.Hostname())); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return lc, nil
+}
+
+func serverTLSConfig(base *tls.Config, serverName string) *tls.Config {
+	cfg := base.Clone()
+	if cfg == nil {
+		cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = serverName
+	}
+	return cfg
+}
+
+// close sends an unbind request, which has no response, and closes the connection
+func (c *conn) close() {
+	c.send(encode(appUnbindRequest))
+	c.Conn.Close()
+}
+
+// send wraps op in an LDAPMessage and returns its message ID
+func (c *conn) send(op []byte) (int, error) {
+	c.nextID++
+	message := encode(tagSequence, encodeInt(tagInteger, c.nextID), op)
+	if err := c.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	if _, err := c.Write(message); err != nil {
+		return 0, err
+	}
+	return c.nextID, nil
+}
+
+// receive returns the protocol operation of the next message answering id
+func (c *conn) receive(id int) (packet, error) {
+	for {
+		message, err := readPacket(c.r)
+		if err != nil {
+			return packet{}, err
+		}
+		parts, err := message.children()
+		if err != nil {
+			return packet{}, err
+		}
+		if message.tag != tagSequence || len(parts) < 2 {
+			return packet{}, errors.New("ldap: malformed message")
+		}
+		messageID, err := parts[0].int()
+		if err != nil {
+			return packet{}, err
+		}
+		// Message ID 0 is an unsolicited notification, usually a notice of disconnection
+		if messageID == 0 {
+			return packet{}, errors.New("ldap: server closed the connection")
+		}
+		if messageID == id {
+			return parts[1], nil
+		}
+	}
+}
+
+// result decodes the LDAPResult that starts every response operation
+func result(op packet) error {
+	parts, err := op.children()
+	if err != nil {
+		return err
+	}
+	if len(parts) < 3 || parts[0].tag != tagEnumerated {
+		return errors.New("ldap: malformed result")
+	}
+	code, err := parts[0].int()
+	if err != nil {
+		return err
+	}
+	if code != resultSuccess {
+		return &ResultError{Code: code, Message: string(parts[2].data)}
+	}
+	return nil
+}
+
+func (c *conn) startTLS(tlsConfig *tls.Config) error {
+	id, err := c.send(encode(appExtendedRequest, encodeString(ctxExtendedName, startTLSOID)))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.tag != appExtendedResponse {
+		return errors.New("ldap: unexpected response to StartTLS")
+	}
+	if err := result(op); err != nil {
+		return fmt.Errorf("ldap: StartTLS refused: %w", err)
+	}
+
+	tlsConn := tls.Client(c.Conn, tlsConfig)
+	if err := tlsConn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.Conn = tlsConn
+	c.r = bufio.NewReader(tlsConn)
+	return nil
+}
+
+// bind performs a simple bind
+func (c *conn) bind(dn, password string) error {
+	id, err := c.send(encode(appBindRequest,
+		encodeInt(tagInteger, protocolVersion),
+		encodeString(tagOctetString, dn),
+		encodeString(ctxSimpleAuth, password),
+	))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+	if op.tag != appBindResponse {
+		return errors.New("ldap: unexpected response to bind")
+	}
+	return result(op)
+}
+
+// search returns the entries under base whose attribute equals value. The filter is
+// built as BER rather than parsed from a string, so value needs no escaping.
+func (c *conn) search(base, attribute, value string, attributes []string) ([]entry, error) {
+	var requested []byte
+	for _, a := range attributes {
+		requested = append(requested, encodeString(tagOctetString, a)...)
+	}
+	id, err := c.send(encode(appSearchRequest,
+		encodeString(tagOctetString, base),
+		encodeInt(tagEnumerated, scopeWholeSubtree),
+		encodeInt(tagEnumerated, derefAliasesNever),
+		encodeInt(tagInteger, searchSizeLimit),
+		encodeInt(tagInteger, searchTimeLimit),
+		encodeBool(false),
+		encode(ctxFilterEquality, encodeString(tagOctetString, attribute), encodeString(tagOctetString, value)),
+		encode(tagSequence, requested),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []entry
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case appSearchEntry:
+			e, err := decodeEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		case appSearchReference:
+			// Referrals to other servers are not followed
+		case appSearchDone:
+			err := result(op)
+			var resultErr *ResultError
+			// More matches than the size limit are reported to the caller as ambiguous
+			if errors.As(err, &resultErr) && resultErr.Code == resultSizeLimitExceeded {
+				err = nil
+			}
+			return entries, err
+		default:
+			return nil, errors.New("ldap: unexpected response to search")
+		}
+	}
+}
+
+func decodeEntry(op packet) (entry, error) {
+	parts, err := op.children()
+	if err != nil {
+		return entry{}, err
+	}
+	if len(parts) != 2 {
+		return entry{}, errors.New("ldap: malformed search entry")
+	}
+	e := entry{dn: string(parts[0].data), attributes: make(map[string][]string)}
+	attributes, err := parts[1].children()
+	if err != nil {
+		return entry{}, err
+	}
+	for _, attribute := range attributes {
+		fields, err := attribute.children()
+		if err != nil {
+			return entry{}, err
+		}
+		if len(fields) != 2 {
+			return entry{}, errors.New("ldap: malformed attribute")
+		}
+		values, err := fields[1].children()
+		if err != nil {
+			return entry{}, err
+		}
+		name := strings.ToLower(string(fields[0].data))
+		for _, v := range values {
+			e.attributes[name] = append(e.attributes[name], string(v.data))
+		}
+	}
+	return e, nil
+}
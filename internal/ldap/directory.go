@@ -0,0 +1,174 @@
+// Package ldap authenticates users against an LDAP directory or Active Directory with
+// a minimal LDAPv3 client: simple bind, equality search and StartTLS
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUserNotFound       = errors.New("ldap: user not found")
+	ErrInvalidCredentials = errors.New("ldap: invalid credentials")
+)
+
+// GroupRole grants role to members of Group
+type GroupRole struct {
+	Group string // group DN, or just its common name
+	Role  string
+}
+
+// Config configures the directory connection and how entries map to users
+type Config struct {
+	URL            string // ldap://host:389 or ldaps://host:636
+	StartTLS       bool   // upgrade ldap:// connections with StartTLS
+	CAFile         string // PEM CA bundle for the server certificate; system roots when empty
+	BindDN         string // service account used to look users up
+	BindPassword   string
+	BaseDN         string
+	LoginAttribute string // uid, or sAMAccountName for Active Directory
+	EmailAttribute string
+	GroupAttribute string // memberOf
+	GroupRoles     []GroupRole
+	DefaultRole    string
+	Timeout        time.Duration
+}
+
+// User is a directory entry that passed authentication
+type User struct {
+	DN     string
+	Login  string
+	Email  string
+	Groups []string
+	Role   string // from the first GroupRoles entry the user is a member of
+}
+
+// Authenticator checks credentials against a directory
+type Authenticator interface {
+	// Authenticate returns ErrUserNotFound when login has no directory entry and
+	// ErrInvalidCredentials when the password is wrong
+	Authenticate(login, password string) (*User, error)
+}
+
+// Directory authenticates by looking the login up with the service account and then
+// binding as the entry found. A connection is opened per attempt.
+type Directory struct {
+	cfg       Config
+	tlsConfig *tls.Config
+}
+
+func NewDirectory(cfg Config) (*Directory, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, errors.New("ldap: url and baseDN are required")
+	}
+	if cfg.LoginAttribute == "" {
+		cfg.LoginAttribute = "uid"
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	if cfg.DefaultRole == "" {
+		cfg.DefaultRole = "user"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ldap: read CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ldap: no certificates in %s", cfg.CAFile)
+		}
+	}
+	return &Directory{cfg: cfg, tlsConfig: tlsConfig}, nil
+}
+
+func (d *Directory) Authenticate(login, password string) (*User, error) {
+	// An empty password makes a simple bind unauthenticated, which servers accept
+	if login == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	c, err := dial(d.cfg.URL, d.cfg.StartTLS, d.tlsConfig, d.cfg.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	defer c.close()
+
+	if d.cfg.BindDN != "" {
+		if err := c.bind(d.cfg.BindDN, d.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("service account bind: %w", err)
+		}
+	}
+	entries, err := c.search(d.cfg.BaseDN, d.cfg.LoginAttribute, login,
+		[]string{d.cfg.LoginAttribute, d.cfg.EmailAttribute, d.cfg.GroupAttribute})
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	switch len(entries) {
+	case 0:
+		return nil, ErrUserNotFound
+	case 1:
+	default:
+		return nil, fmt.Errorf("ldap: %s=%s matches more than one entry", d.cfg.LoginAttribute, login)
+	}
+	found := entries[0]
+
+	if err := c.bind(found.dn, password); err != nil {
+		var resultErr *ResultError
+		if errors.As(err, &resultErr) && resultErr.Code == resultInvalidCredentials {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("user bind: %w", err)
+	}
+
+	user := &User{
+		DN:     found.dn,
+		Login:  login,
+		Groups: found.values(d.cfg.GroupAttribute),
+	}
+	if logins := found.values(d.cfg.LoginAttribute); len(logins) > 0 {
+		user.Login = logins[0]
+	}
+	if emails := found.values(d.cfg.EmailAttribute); len(emails) > 0 {
+		user.Email = emails[0]
+	}
+	user.Role = d.role(user.Groups)
+	return user, nil
+}
+
+// role returns the role of the first GroupRoles entry matching one of groups
+func (d *Directory) role(groups []string) string {
+	for _, mapping := range d.cfg.GroupRoles {
+		for _, group := range groups {
+			if strings.EqualFold(group, mapping.Group) || strings.EqualFold(commonName(group), mapping.Group) {
+				return mapping.Role
+			}
+		}
+	}
+	return d.cfg.DefaultRole
+}
+
+// commonName returns the value of the first RDN of a DN such as
+// "CN=Admins,OU=Groups,DC=example,DC=com"
+func commonName(dn string) string {
+	first, _, _ := strings.Cut(dn, ",")
+	_, value, ok := strings.Cut(first, "=")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
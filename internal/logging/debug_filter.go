@@ -0,0 +1,165 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidDebugRule is returned for rules without a user ID or request ID pattern,
+// or with a malformed pattern
+var ErrInvalidDebugRule = errors.New("debug rule needs a user ID or a valid request ID pattern")
+
+// DebugRule enables debug logging for one user or for matching request IDs until it expires
+type DebugRule struct {
+	ID               uint
+	UserID           uint   // 0 matches any user
+	RequestIDPattern string // path.Match pattern, "" matches any request
+	CreatedBy        uint
+	ExpiresAt        time.Time
+}
+
+func (r *DebugRule) matches(entry *logrus.Entry) bool {
+	if r.UserID != 0 && fieldString(entry, "user_id", "user-id") != fmt.Sprint(r.UserID) {
+		return false
+	}
+	if r.RequestIDPattern != "" {
+		requestID := fieldString(entry, "request_id")
+		if ok, _ := path.Match(r.RequestIDPattern, requestID); !ok || requestID == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// DebugFilter lets debug entries through for selected users or requests while the
+// rest of the log stays at the configured level. Logrus drops entries below the
+// logger's level before hooks or formatters see them, so while rules are active the
+// Output is asked to produce debug entries and the filter discards those no rule matches.
+type DebugFilter struct {
+	formatter logrus.Formatter
+	output    *Output
+
+	mu     sync.Mutex
+	rules  []DebugRule
+	nextID uint
+}
+
+// NewDebugFilter wraps formatter; install it with logger.SetFormatter
+func NewDebugFilter(formatter logrus.Formatter, output *Output) *DebugFilter {
+	return &DebugFilter{formatter: formatter, output: output, nextID: 1}
+}
+
+// Format formats entries at or above the configured level and debug entries matching a rule
+func (f *DebugFilter) Format(entry *logrus.Entry) ([]byte, error) {
+	if entry.Level <= f.output.Level() || f.match(entry) {
+		return f.formatter.Format(entry)
+	}
+	return nil, nil
+}
+
+func (f *DebugFilter) match(entry *logrus.Entry) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.rules {
+		if entry.Time.Before(f.rules[i].ExpiresAt) && f.rules[i].matches(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add activates a rule for duration and returns it with its ID
+func (f *DebugFilter) Add(rule DebugRule, duration time.Duration) (DebugRule, error) {
+	if rule.UserID == 0 && rule.RequestIDPattern == "" {
+		return DebugRule{}, ErrInvalidDebugRule
+	}
+	if _, err := path.Match(rule.RequestIDPattern, ""); err != nil {
+		return DebugRule{}, ErrInvalidDebugRule
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rule.ID = f.nextID
+	f.nextID++
+	rule.ExpiresAt = time.Now().Add(duration)
+	f.rules = append(f.rules, rule)
+	f.output.SetDebugOverride(true)
+	return rule, nil
+}
+
+// Remove deactivates a rule; it reports whether the rule was active
+func (f *DebugFilter) Remove(id uint) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, rule := range f.rules {
+		if rule.ID == id {
+			f.rules = append(f.rules[:i], f.rules[i+1:]...)
+			f.output.SetDebugOverride(len(f.rules) > 0)
+			return true
+		}
+	}
+	return false
+}
+
+// Rules returns the active rules, soonest to expire first
+func (f *DebugFilter) Rules() []DebugRule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rules := make([]DebugRule, 0, len(f.rules))
+	now := time.Now()
+	for _, rule := range f.rules {
+		if now.Before(rule.ExpiresAt) {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ExpiresAt.Before(rules[j].ExpiresAt) })
+	return rules
+}
+
+// Expire drops expired rules and stops producing debug entries once none are left
+func (f *DebugFilter) Expire(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	active := f.rules[:0]
+	for _, rule := range f.rules {
+		if now.Before(rule.ExpiresAt) {
+			active = append(active, rule)
+		}
+	}
+	f.rules = active
+	f.output.SetDebugOverride(len(f.rules) > 0)
+}
+
+// Run calls Expire every interval until stop is closed
+func (f *DebugFilter) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			f.Expire(now)
+		}
+	}
+}
+
+func fieldString(entry *logrus.Entry, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := entry.Data[key]; ok && value != nil {
+			return fmt.Sprint(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package logging
+
+import "syscall"
+
+// diskUsagePercent returns how full the filesystem holding dir is
+func diskUsagePercent(dir string) (int, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil || st.Blocks == 0 {
+		return 0, false
+	}
+	used := st.Blocks - st.Bfree
+	// Match df: blocks reserved for root count as unavailable
+	total := used + st.Bavail
+	if total == 0 {
+		return 0, false
+	}
+	return int(used * 100 / total), true
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package logging
+
+// diskUsagePercent is not implemented on Windows; the disk usage check is skipped
+func diskUsagePercent(dir string) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,240 @@
+// Package logging manages where application logs are written. Logs go to a
+// file while it is healthy; when the file cannot be written or the disk fills
+// up, output falls back to stdout instead of taking the process down.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Output destinations
+const (
+	DestinationFile   = "file"
+	DestinationStdout = "stdout"
+)
+
+// Config describes the log file and its limits. Zero limits disable the check.
+type Config struct {
+	File                string
+	MaxSizeMB           int          // soft quota: above this the log level is raised to FallbackLevel
+	MaxDiskUsagePercent int          // above this logs go to stdout
+	FallbackLevel       logrus.Level // level used while the soft quota is exceeded
+}
+
+// Status describes the current state of the log output, for readiness checks
+type Status struct {
+	Destination  string    `json:"destination"`
+	Degraded     bool      `json:"degraded"`
+	Reason       string    `json:"reason,omitempty"`
+	Since        time.Time `json:"since,omitempty"`
+	LevelLowered bool      `json:"levelLowered"`
+}
+
+// Output is an io.Writer for logrus that writes to the log file and falls back to stdout
+type Output struct {
+	config Config
+	logger *logrus.Logger
+	stdout io.Writer
+
+	mu            sync.Mutex
+	file          *os.File
+	reason        string
+	since         time.Time
+	normalLevel   logrus.Level
+	levelLowered  bool
+	debugOverride bool // debug entries are produced for a DebugFilter
+	alerted       bool // whether the current condition has been reported
+}
+
+// Open attaches an Output to logger. It never fails: if the log file cannot be
+// opened the logger writes to stdout and the condition is reported by Status.
+func Open(config Config, logger *logrus.Logger) *Output {
+	o := &Output{
+		config:      config,
+		logger:      logger,
+		stdout:      os.Stdout,
+		normalLevel: logger.GetLevel(),
+	}
+	if err := o.openFile(); err != nil {
+		o.degrade(fmt.Sprintf("log file unavailable: %v", err))
+	}
+	logger.SetOutput(o)
+	o.Check()
+	return o
+}
+
+func (o *Output) openFile() error {
+	if err := os.MkdirAll(filepath.Dir(o.config.File), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(o.config.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	o.file = file
+	return nil
+}
+
+// degrade switches to stdout; callers must hold mu (or be constructing o)
+func (o *Output) degrade(reason string) {
+	if o.file != nil {
+		o.file.Close()
+		o.file = nil
+	}
+	if o.reason == "" {
+		o.since = time.Now()
+		o.alerted = false
+	}
+	o.reason = reason
+}
+
+func (o *Output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.file != nil {
+		n, err := o.file.Write(p)
+		if err == nil {
+			return n, nil
+		}
+		// The logger's own lock is held while writing, so the alert is raised by the next Check
+		o.degrade(fmt.Sprintf("log file write failed: %v", err))
+	}
+	return o.stdout.Write(p)
+}
+
+// Status reports the current destination and any degraded condition
+func (o *Output) Status() Status {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	status := Status{
+		Destination:  DestinationFile,
+		Degraded:     o.reason != "",
+		Reason:       o.reason,
+		LevelLowered: o.levelLowered,
+	}
+	if o.file == nil {
+		status.Destination = DestinationStdout
+	}
+	if status.Degraded {
+		status.Since = o.since
+	}
+	return status
+}
+
+// Check re-evaluates disk usage and the soft quota, switching the destination
+// and level as needed, and recovers once the conditions clear.
+func (o *Output) Check() {
+	var alerts, recoveries []string
+
+	o.mu.Lock()
+	usage, usageKnown := diskUsagePercent(filepath.Dir(o.config.File))
+	diskFull := usageKnown && o.config.MaxDiskUsagePercent > 0 && usage >= o.config.MaxDiskUsagePercent
+
+	switch {
+	case diskFull && o.file != nil:
+		o.degrade(fmt.Sprintf("disk usage at %d%% (limit %d%%)", usage, o.config.MaxDiskUsagePercent))
+	case !diskFull && o.file == nil:
+		if err := o.openFile(); err == nil {
+			recoveries = append(recoveries, "log file writable again: "+o.reason)
+			o.reason = ""
+		} else if o.reason == "" {
+			o.degrade(fmt.Sprintf("log file unavailable: %v", err))
+		}
+	}
+	if o.reason != "" && !o.alerted {
+		o.alerted = true
+		alerts = append(alerts, "Logging to stdout: "+o.reason)
+	}
+
+	if o.file != nil && o.config.MaxSizeMB > 0 {
+		if info, err := o.file.Stat(); err == nil {
+			overQuota := info.Size() > int64(o.config.MaxSizeMB)<<20
+			switch {
+			case overQuota && !o.levelLowered:
+				o.levelLowered = true
+				o.applyLevel()
+				alerts = append(alerts, fmt.Sprintf("Log file exceeds %d MB, log level raised to %s", o.config.MaxSizeMB, o.logger.GetLevel()))
+			case !overQuota && o.levelLowered:
+				o.levelLowered = false
+				o.applyLevel()
+				recoveries = append(recoveries, "log file below its size quota, log level restored")
+			}
+		}
+	}
+	o.mu.Unlock()
+
+	for _, msg := range alerts {
+		o.logger.WithField("alert", "logging").Error(msg)
+	}
+	for _, msg := range recoveries {
+		o.logger.WithField("alert", "logging").Warn("Logging recovered: " + msg)
+	}
+}
+
+// SetLevel changes the configured log level. While the soft quota is exceeded the
+// new level takes effect once the file is below its quota again.
+func (o *Output) SetLevel(level logrus.Level) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.normalLevel = level
+	o.applyLevel()
+}
+
+// Level returns the level entries are written at, ignoring the debug override
+func (o *Output) Level() logrus.Level {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.level()
+}
+
+// SetDebugOverride makes the logger produce debug entries regardless of the level,
+// for a DebugFilter to select from. It has no effect while the soft quota is exceeded.
+func (o *Output) SetDebugOverride(enabled bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.debugOverride = enabled
+	o.applyLevel()
+}
+
+// level is the configured level, or the fallback level while the soft quota is
+// exceeded. Callers hold o.mu.
+func (o *Output) level() logrus.Level {
+	if o.levelLowered && o.config.FallbackLevel < o.normalLevel {
+		return o.config.FallbackLevel
+	}
+	return o.normalLevel
+}
+
+// applyLevel sets the logger's level from the current state. Callers hold o.mu.
+func (o *Output) applyLevel() {
+	level := o.level()
+	if o.debugOverride && !o.levelLowered && level < logrus.DebugLevel {
+		level = logrus.DebugLevel
+	}
+	o.logger.SetLevel(level)
+}
+
+// Run calls Check every interval until stop is closed
+func (o *Output) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			o.Check()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package mailer sends transactional email through a configurable provider
+// (SMTP, SendGrid or Amazon SES) from an asynchronous queue with retries.
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Message is a rendered email ready to be sent
+type Message struct {
+	MessageID string // our ID, passed to providers so webhooks can be matched
+	Template  string // template the message was rendered from, for bookkeeping
+	From      string
+	To        string
+	Subject   string
+	Text      string
+	HTML      string
+}
+
+// Mailer delivers a single message
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// PermanentError marks a failure that retrying cannot fix, such as a rejected recipient
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// IsPermanent reports whether err should not be retried
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// Config selects and configures the provider
+type Config struct {
+	Provider string // log, smtp, sendgrid or ses
+	SMTP     SMTPConfig
+	SendGrid SendGridConfig
+	SES      SESConfig
+}
+
+// New creates the mailer selected in cfg
+func New(cfg Config, logger *logrus.Logger) (Mailer, error) {
+	switch cfg.Provider {
+	case "", "log":
+		return NewLogMailer(logger), nil
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTP)
+	case "sendgrid":
+		return NewSendGridMailer(cfg.SendGrid)
+	case "ses":
+		return NewSESMailer(cfg.SES)
+	default:
+		return nil, fmt.Errorf("unknown mail provider %q", cfg.Provider)
+	}
+}
+
+// LogMailer only logs messages; it is the default for development
+type LogMailer struct {
+	logger *logrus.Logger
+}
+
+func NewLogMailer(logger *logrus.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	m.logger.WithFields(logrus.Fields{
+		"message_id": msg.MessageID,
+		"template":   msg.Template,
+		"to":         msg.To,
+		"subject":    msg.Subject,
+	}).Info("Email logged instead of sent (mail provider: log)")
+	return nil
+}
@@ -0,0 +1,140 @@
+package mailer
+
+import (
+	"api/internal/telemetry"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrQueueFull = errors.New("mail queue is full")
+
+var tracer = telemetry.Tracer("api/mailer")
+
+// QueueConfig controls asynchronous delivery
+type QueueConfig struct {
+	Workers     int
+	Size        int           // messages buffered before Enqueue fails
+	MaxAttempts int           // delivery attempts per message
+	RetryDelay  time.Duration // delay before the first retry, doubled on every further attempt
+}
+
+// ResultFunc is called once a message was delivered or finally gave up on (err != nil)
+type ResultFunc func(msg *Message, err error)
+
+type queuedMessage struct {
+	msg      *Message
+	attempts int
+}
+
+// Queue delivers messages in the background so sending never blocks a request
+type Queue struct {
+	mailer   Mailer
+	config   QueueConfig
+	logger   *logrus.Logger
+	messages chan queuedMessage
+	onResult ResultFunc
+}
+
+func NewQueue(mailer Mailer, config QueueConfig, logger *logrus.Logger) *Queue {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+	return &Queue{
+		mailer:   mailer,
+		config:   config,
+		logger:   logger,
+		messages: make(chan queuedMessage, config.Size),
+	}
+}
+
+// OnResult registers the delivery callback; it must be called before Start
+func (q *Queue) OnResult(fn ResultFunc) {
+	q.onResult = fn
+}
+
+// Start runs the delivery workers until ctx is cancelled
+func (q *Queue) Start(ctx context.Context) {
+	for i := 0; i < q.config.Workers; i++ {
+		go q.work(ctx)
+	}
+}
+
+// Enqueue schedules msg for delivery
+func (q *Queue) Enqueue(msg *Message) error {
+	select {
+	case q.messages <- queuedMessage{msg: msg}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item := <-q.messages:
+			q.deliver(ctx, item)
+		}
+	}
+}
+
+func (q *Queue) deliver(ctx context.Context, item queuedMessage) {
+	item.attempts++
+	sendCtx, span := tracer.Start(ctx, "mailer.send", trace.WithAttributes(
+		attribute.String("email.message_id", item.msg.MessageID),
+		attribute.String("email.template", item.msg.Template),
+		attribute.Int("email.attempt", item.attempts),
+	))
+	sendCtx, cancel := context.WithTimeout(sendCtx, time.Minute)
+	err := q.mailer.Send(sendCtx, item.msg)
+	cancel()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+
+	logger := q.logger.WithFields(logrus.Fields{
+		"message_id": item.msg.MessageID,
+		"template":   item.msg.Template,
+		"attempt":    item.attempts,
+	})
+	if err == nil {
+		logger.Debug("Email sent")
+		q.finish(item.msg, nil)
+		return
+	}
+	if IsPermanent(err) || item.attempts >= q.config.MaxAttempts {
+		logger.WithError(err).Error("Email delivery failed")
+		q.finish(item.msg, err)
+		return
+	}
+
+	delay := q.config.RetryDelay << (item.attempts - 1)
+	logger.WithError(err).WithField("retry_in", delay.String()).Warn("Email delivery failed, retrying")
+	time.AfterFunc(delay, func() {
+		select {
+		case q.messages <- item:
+		default:
+			logger.Error("Mail queue full, dropping retry")
+			q.finish(item.msg, ErrQueueFull)
+		}
+	})
+}
+
+func (q *Queue) finish(msg *Message, err error) {
+	if q.onResult != nil {
+		q.onResult(msg, err)
+	}
+}
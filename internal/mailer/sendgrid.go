@@ -0,0 +1,96 @@
+package mailer
+
+import (
+	"api/internal/telemetry"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// SendGridConfig configures delivery through the SendGrid v3 API
+type SendGridConfig struct {
+	APIKey   string
+	Endpoint string // defaults to https://api.sendgrid.com
+}
+
+type SendGridMailer struct {
+	cfg    SendGridConfig
+	client *http.Client
+}
+
+func NewSendGridMailer(cfg SendGridConfig) (*SendGridMailer, error) {
+	if cfg.APIKey == "" {
+		return nil, errors.New("sendgrid mailer requires an API key")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://api.sendgrid.com"
+	}
+	return &SendGridMailer{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 30 * time.Second, Transport: telemetry.Transport(nil)},
+	}, nil
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func (m *SendGridMailer) Send(ctx context.Context, msg *Message) error {
+	content := []sendGridContent{}
+	if msg.Text != "" {
+		content = append(content, sendGridContent{Type: "text/plain", Value: msg.Text})
+	}
+	if msg.HTML != "" {
+		content = append(content, sendGridContent{Type: "text/html", Value: msg.HTML})
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"personalizations": []map[string]interface{}{{"to": []sendGridAddress{{Email: msg.To}}}},
+		"from":             sendGridAddress{Email: msg.From},
+		"subject":          msg.Subject,
+		"content":          content,
+		// Echoed back in event webhooks
+		"custom_args": map[string]string{"message_id": msg.MessageID, "template": msg.Template},
+	})
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.cfg.Endpoint+"/v3/mail/send", bytes.NewReader(payload))
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	req.Header.Set("Authorization", "Bearer "+m.cfg.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return httpError("sendgrid", resp)
+}
+
+// httpError converts a provider API response into an error, treating client
+// errors other than rate limiting as permanent
+func httpError(provider string, resp *http.Response) error {
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err := fmt.Errorf("%s: %s: %s", provider, resp.Status, bytes.TrimSpace(body))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return &PermanentError{Err: err}
+	}
+	return err
+}
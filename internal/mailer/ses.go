@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"api/internal/awssig"
+	"api/internal/telemetry"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SESConfig configures delivery through the Amazon SES v2 API
+type SESConfig struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Endpoint        string // optional override, defaults to the regional endpoint
+}
+
+type SESMailer struct {
+	endpoint string
+	creds    awssig.Credentials
+	client   *http.Client
+}
+
+func NewSESMailer(cfg SESConfig) (*SESMailer, error) {
+	if cfg.Region == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("ses mailer requires region and access credentials")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://email.%s.amazonaws.com", cfg.Region)
+	}
+	return &SESMailer{
+		endpoint: endpoint,
+		creds: awssig.Credentials{
+			AccessKeyID:     cfg.AccessKeyID,
+			SecretAccessKey: cfg.SecretAccessKey,
+			Region:          cfg.Region,
+			Service:         "ses",
+		},
+		client: &http.Client{Timeout: 30 * time.Second, Transport: telemetry.Transport(nil)},
+	}, nil
+}
+
+func (m *SESMailer) Send(ctx context.Context, msg *Message) error {
+	body := map[string]interface{}{}
+	if msg.Text != "" {
+		body["Text"] = map[string]string{"Data": msg.Text, "Charset": "UTF-8"}
+	}
+	if msg.HTML != "" {
+		body["Html"] = map[string]string{"Data": msg.HTML, "Charset": "UTF-8"}
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"FromEmailAddress": msg.From,
+		"Destination":      map[string][]string{"ToAddresses": {msg.To}},
+		"Content": map[string]interface{}{
+			"Simple": map[string]interface{}{
+				"Subject": map[string]string{"Data": msg.Subject, "Charset": "UTF-8"},
+				"Body":    body,
+			},
+		},
+		// Included in SES event notifications
+		"EmailTags": []map[string]string{
+			{"Name": "message_id", "Value": msg.MessageID},
+			{"Name": "template", "Value": msg.Template},
+		},
+	})
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.endpoint+"/v2/email/outbound-emails", bytes.NewReader(payload))
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	m.creds.SignRequest(req, awssig.SHA256Hex(payload), time.Now())
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return httpError("ses", resp)
+}
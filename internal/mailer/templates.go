@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates/*.txt templates/*.html
+var templateFiles embed.FS
+
+// Templates renders the embedded email templates. Every email has a
+// <name>.txt template whose first line is "Subject: ..." and a <name>.html
+// template wrapped in the shared layout. Translations are named
+// <name>.<locale>.txt and <name>.<locale>.html.
+type Templates struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+func LoadTemplates() (*Templates, error) {
+	text, err := texttemplate.ParseFS(templateFiles, "templates/*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("parse text templates: %w", err)
+	}
+	html, err := htmltemplate.ParseFS(templateFiles, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("parse html templates: %w", err)
+	}
+	return &Templates{text: text, html: html}, nil
+}
+
+// Render produces the subject and both bodies of the named template in locale, falling
+// back to the untranslated template when there is no translation
+func (t *Templates) Render(name, locale string, data interface{}) (subject, text, html string, err error) {
+	if locale != "" && t.text.Lookup(name+"."+locale+".txt") != nil && t.html.Lookup(name+"."+locale+".html") != nil {
+		name += "." + locale
+	}
+
+	var buf bytes.Buffer
+	if err := t.text.ExecuteTemplate(&buf, name+".txt", data); err != nil {
+		return "", "", "", fmt.Errorf("render %s text: %w", name, err)
+	}
+	subjectLine, body, _ := strings.Cut(buf.String(), "\n")
+	subject, ok := strings.CutPrefix(subjectLine, "Subject: ")
+	if !ok {
+		return "", "", "", fmt.Errorf("template %s.txt must start with a Subject line", name)
+	}
+	text = strings.TrimLeft(body, "\n")
+
+	buf.Reset()
+	if err := t.html.ExecuteTemplate(&buf, name+".html", data); err != nil {
+		return "", "", "", fmt.Errorf("render %s html: %w", name, err)
+	}
+	return strings.TrimSpace(subject), text, buf.String(), nil
+}
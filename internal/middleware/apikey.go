@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyIdentity is the principal behind a valid API key
+type APIKeyIdentity struct {
+	KeyID  uint
+	UserID uint
+	Role   string
+	Scopes []string
+	// Status is the owner's account status; keys of suspended, banned or deactivated accounts are refused
+	Status string
+}
+
+// APIKeyAuthenticator resolves an X-API-Key header value to its identity
+type APIKeyAuthenticator func(key string) (*APIKeyIdentity, error)
+
+// APIKeyUsageObserver is told about every request made with an API key; an error rejects the request
+type APIKeyUsageObserver func(keyID uint, route, ip string) error
+
+// AuthOrAPIKeyMiddleware authenticates with X-API-Key when the header is present
+// and falls back to Bearer JWT authentication otherwise. cache, accounts and observe may be nil.
+func AuthOrAPIKeyMiddleware(verify AccessTokenVerifier, revocations RevocationChecker, cache *TokenCache, accounts AccountStatusLookup, authenticate APIKeyAuthenticator, observe APIKeyUsageObserver) gin.HandlerFunc {
+	jwtAuth := AuthMiddleware(verify, revocations, cache, accounts)
+
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-API-Key")
+		if key == "" {
+			jwtAuth(c)
+			return
+		}
+
+		identity, err := authenticate(key)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			c.Abort()
+			return
+		}
+		if identity.Status != "" && identity.Status != "active" {
+			c.JSON(http.StatusForbidden, accountBlockedResponse(identity.Status))
+			c.Abort()
+			return
+		}
+
+		if observe != nil {
+			// ClientIP only follows X-Forwarded-For from trusted proxies, so a key
+			// used from a new network cannot pass for one it was seen on
+			if err := observe(identity.KeyID, c.FullPath(), c.ClientIP()); err != nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": "API key suspended due to unusual activity"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("userID", identity.UserID)
+		c.Set("role", identity.Role)
+		c.Set("apiKeyID", identity.KeyID)
+		c.Set("scopes", identity.Scopes)
+		c.Set("authMethod", "api_key")
+		applyUserLocale(c, identity.UserID)
+		c.Next()
+	}
+}
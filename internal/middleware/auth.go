@@ -1,14 +1,50 @@
 package middleware
 
 import (
+	"api/internal/auth"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware(accessSecret string) gin.HandlerFunc {
+// RevocationChecker reports whether an access token was revoked before its expiry
+type RevocationChecker interface {
+	IsRevoked(jti string, userID uint, issuedAt time.Time) bool
+}
+
+// AccessTokenVerifier returns the claims of an access token with a valid signature and
+// valid registered claims
+type AccessTokenVerifier func(token string) (jwt.MapClaims, error)
+
+// AccountStatusLookup returns the effective account status of a user: active,
+// suspended, banned, deactivated or pending_deletion
+type AccountStatusLookup func(userID uint) string
+
+// accountBlockedResponse is the 403 body for requests from a suspended, banned,
+// deactivated or deleted account
+func accountBlockedResponse(status string) gin.H {
+	switch status {
+	case "banned":
+		return gin.H{"error": "Account banned", "code": "account_banned"}
+	case "deactivated":
+		return gin.H{"error": "Account deactivated", "code": "account_deactivated"}
+	case "pending_deletion":
+		return gin.H{"error": "Account scheduled for deletion", "code": "account_pending_deletion"}
+	}
+	return gin.H{"error": "Account suspended", "code": "account_suspended"}
+}
+
+// AuthMiddleware validates the Bearer access token with verify. Validated tokens are
+// kept in cache, which may be nil, under their SHA-256 (KeyOf) until they are revoked
+// or the cache TTL passes.
+// Suspending or deactivating an account revokes its tokens; accounts, which may be nil,
+// is consulted for revoked tokens so those requests get a 403 naming the status instead
+// of a 401.
+func AuthMiddleware(verify AccessTokenVerifier, revocations RevocationChecker, cache *TokenCache, accounts AccountStatusLookup) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -25,27 +61,106 @@ func AuthMiddleware(accessSecret string) gin.HandlerFunc {
 		}
 
 		tokenString := parts[1]
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(accessSecret), nil
-		})
+		key := KeyOf(tokenString)
+		claims, ok := cache.Get(key, time.Now())
+		if !ok {
+			generation := cache.Generation()
+			validated, status, body := validateAccessToken(tokenString, verify, revocations, accounts)
+			if validated == nil {
+				c.JSON(status, body)
+				c.Abort()
+				return
+			}
+			cache.Put(key, *validated, generation, time.Now())
+			claims = validated
+		}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
+		c.Set("userID", claims.UserID)
+		c.Set("tokenID", claims.JTI)
+		c.Set("tokenExpiresAt", claims.ExpiresAt)
+		c.Set("role", claims.Role)
+		c.Set("sessionID", claims.SessionID)
+		c.Set("groups", claims.Groups)
+		if claims.Scopes != nil {
+			c.Set("scopes", claims.Scopes)
+		}
+		if claims.OrgID != 0 {
+			c.Set("orgID", claims.OrgID)
+			c.Set("orgRole", claims.OrgRole)
 		}
+		if claims.ImpersonatorID != 0 {
+			c.Set("impersonatorID", claims.ImpersonatorID)
+			c.Set("impersonatorSessionID", claims.ImpersonatorSessionID)
+		}
+		applyUserLocale(c, claims.UserID)
+		c.Next()
+	}
+}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			c.Abort()
-			return
+// validateAccessToken checks the signature, claims and revocation state of an access
+// token. On failure it returns nil and the response status and body.
+func validateAccessToken(tokenString string, verify AccessTokenVerifier, revocations RevocationChecker, accounts AccountStatusLookup) (*TokenClaims, int, gin.H) {
+	claims, err := verify(tokenString)
+	if err != nil {
+		return nil, http.StatusUnauthorized, gin.H{"error": "Invalid token"}
+	}
+
+	// JSON numbers decode as float64; handlers read the ID with c.GetUint
+	userID, ok := claims["userID"].(float64)
+	if !ok {
+		return nil, http.StatusUnauthorized, gin.H{"error": "Invalid token claims"}
+	}
+
+	jti, _ := claims["jti"].(string)
+	var issuedAt, expiresAt time.Time
+	if iat, ok := claims["iat"].(float64); ok {
+		issuedAt = auth.IssuedAt(iat)
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		expiresAt = time.Unix(int64(exp), 0)
+	}
+
+	if revocations != nil && revocations.IsRevoked(jti, uint(userID), issuedAt) {
+		if accounts != nil {
+			if status := accounts(uint(userID)); status != "" && status != "active" {
+				return nil, http.StatusForbidden, accountBlockedResponse(status)
+			}
 		}
+		return nil, http.StatusUnauthorized, gin.H{"error": "Token has been revoked"}
+	}
 
-		c.Set("userID", claims["userID"])
-		c.Set("role", claims["role"])
-		c.Next()
+	validated := &TokenClaims{
+		UserID:    uint(userID),
+		JTI:       jti,
+		Role:      claims["role"],
+		SessionID: claims["sid"],
+		IssuedAt:  issuedAt,
+		ExpiresAt: expiresAt,
+	}
+	if groups, ok := claims["groups"].([]interface{}); ok {
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				validated.Groups = append(validated.Groups, name)
+			}
+		}
+	}
+	if scopes, ok := claims["scopes"].([]interface{}); ok {
+		validated.Scopes = []string{}
+		for _, scope := range scopes {
+			if name, ok := scope.(string); ok {
+				validated.Scopes = append(validated.Scopes, name)
+			}
+		}
+	}
+	if org, ok := claims["org"].(float64); ok {
+		validated.OrgID = uint(org)
+		validated.OrgRole, _ = claims["org_role"].(string)
 	}
+	if impersonator, ok := claims["impersonator"].(float64); ok {
+		validated.ImpersonatorID = uint(impersonator)
+		validated.ImpersonatorSessionID, _ = claims["impersonator_sid"].(string)
+	}
+	return validated, 0, nil
 }
 
 func AdminMiddleware() gin.HandlerFunc {
@@ -66,3 +181,66 @@ func AdminMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequireOrgRole admits requests for the organization in the :id path parameter when
+// the access token acts for that organization with one of roles. A token acts for one
+// organization at a time, so a member of several has to switch to reach another.
+func RequireOrgRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+			c.Abort()
+			return
+		}
+		if current := c.GetUint("orgID"); current == 0 || uint64(current) != orgID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Token does not act for this organization", "code": "organization_mismatch"})
+			c.Abort()
+			return
+		}
+		role := c.GetString("orgRole")
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient organization role"})
+		c.Abort()
+	}
+}
+
+// RequireGroup admits requests whose access token lists group in its "groups" claim.
+// API keys carry no groups and are rejected.
+func RequireGroup(group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, name := range c.GetStringSlice("groups") {
+			if name == group {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Group membership required", "group": group})
+		c.Abort()
+	}
+}
+
+// RequireScope admits requests whose credentials allow scope, see AllowsScope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if AllowsScope(c, scope) {
+			c.Next()
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient scope", "code": "insufficient_scope", "scope": scope})
+		c.Abort()
+	}
+}
+
+// AllowsScope reports whether the request's credentials allow scope (see auth.HasScope).
+// API keys and the access tokens of scoped sessions are limited to their scopes; other
+// access tokens are not limited.
+func AllowsScope(c *gin.Context, scope string) bool {
+	_, limited := c.Get("scopes")
+	return !limited || auth.HasScope(c.GetStringSlice("scopes"), scope)
+}
@@ -0,0 +1,215 @@
+// Package authtest builds authenticated requests for tests of handlers and
+// middleware. An Identity is put on the gin context under the same keys the auth
+// middleware uses, so handlers cannot tell it from a real login.
+//
+//	c, w := authtest.Context(httptest.NewRequest("GET", "/api/v1/users/profile", nil), authtest.User(7))
+//	handler.GetProfile(c)
+//
+// Router level tests use Middleware in place of jwtAuth/apiKeyAuth, or AccessToken
+// and Verifier to send a Bearer token through the real AuthMiddleware.
+package authtest
+
+import (
+	"api/internal/auth"
+	"api/internal/middleware"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Roles known to AdminMiddleware
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Identity is the principal of a test request
+type Identity struct {
+	UserID    uint
+	Role      string
+	TokenID   string
+	SessionID string
+	ExpiresAt time.Time
+	// APIKeyID is set for requests authenticated with an API key, limited to Scopes
+	APIKeyID uint
+	// Scopes limit an API key, or an access token when not nil (a scoped session)
+	Scopes []string
+	// OrgID is the organization the access token acts for, 0 for none, with OrgRole
+	OrgID   uint
+	OrgRole string
+	// Groups are the names of the user's groups, checked by RequireGroup
+	Groups []string
+	// ImpersonatorID is the admin acting as the user, 0 for the user's own login, with
+	// the admin's session
+	ImpersonatorID        uint
+	ImpersonatorSessionID string
+}
+
+// User returns a signed in user with the "user" role
+func User(id uint) Identity {
+	return Identity{
+		UserID:    id,
+		Role:      RoleUser,
+		TokenID:   "test-token",
+		SessionID: "test-session",
+		ExpiresAt: time.Now().Add(15 * time.Minute),
+	}
+}
+
+// Admin returns a signed in user with the "admin" role
+func Admin(id uint) Identity {
+	identity := User(id)
+	identity.Role = RoleAdmin
+	return identity
+}
+
+// WithRole returns a copy of i with another role
+func (i Identity) WithRole(role string) Identity {
+	i.Role = role
+	return i
+}
+
+// WithOrganization returns a copy of i acting for organization orgID with role
+func (i Identity) WithOrganization(orgID uint, role string) Identity {
+	i.OrgID = orgID
+	i.OrgRole = role
+	return i
+}
+
+// WithGroups returns a copy of i in the named groups
+func (i Identity) WithGroups(groups ...string) Identity {
+	i.Groups = groups
+	return i
+}
+
+// WithScopes returns a copy of i signed in with a scoped session limited to scopes
+func (i Identity) WithScopes(scopes ...string) Identity {
+	i.Scopes = append([]string{}, scopes...)
+	return i
+}
+
+// ImpersonatedBy returns a copy of i acting under an impersonation token of admin
+// adminID, signed in with session adminSessionID
+func (i Identity) ImpersonatedBy(adminID uint, adminSessionID string) Identity {
+	i.ImpersonatorID = adminID
+	i.ImpersonatorSessionID = adminSessionID
+	i.SessionID = ""
+	return i
+}
+
+// WithAPIKey returns a copy of i authenticated with an API key granting scopes
+// instead of an access token
+func (i Identity) WithAPIKey(keyID uint, scopes ...string) Identity {
+	i.APIKeyID = keyID
+	i.Scopes = scopes
+	i.TokenID = ""
+	i.SessionID = ""
+	i.ExpiresAt = time.Time{}
+	i.OrgID = 0
+	i.OrgRole = ""
+	i.Groups = nil
+	i.ImpersonatorID = 0
+	i.ImpersonatorSessionID = ""
+	return i
+}
+
+// Apply stores the identity on c the way AuthMiddleware or AuthOrAPIKeyMiddleware does
+func (i Identity) Apply(c *gin.Context) {
+	c.Set("userID", i.UserID)
+	c.Set("role", i.Role)
+	if i.APIKeyID != 0 {
+		c.Set("apiKeyID", i.APIKeyID)
+		c.Set("scopes", i.Scopes)
+		c.Set("authMethod", "api_key")
+		return
+	}
+	c.Set("tokenID", i.TokenID)
+	c.Set("tokenExpiresAt", i.ExpiresAt)
+	c.Set("sessionID", i.SessionID)
+	c.Set("groups", i.Groups)
+	if i.Scopes != nil {
+		c.Set("scopes", i.Scopes)
+	}
+	if i.OrgID != 0 {
+		c.Set("orgID", i.OrgID)
+		c.Set("orgRole", i.OrgRole)
+	}
+	if i.ImpersonatorID != 0 {
+		c.Set("impersonatorID", i.ImpersonatorID)
+		c.Set("impersonatorSessionID", i.ImpersonatorSessionID)
+	}
+}
+
+// Context returns a gin context for req and the recorder holding its response.
+// A nil identity leaves the request anonymous.
+func Context(req *http.Request, identity *Identity) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	if identity != nil {
+		identity.Apply(c)
+	}
+	return c, w
+}
+
+// Middleware authenticates every request as identity, standing in for the auth middleware
+func Middleware(identity Identity) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity.Apply(c)
+		c.Next()
+	}
+}
+
+// Issuer and audience of the tokens issued by AccessToken
+const (
+	TokenIssuer   = "authtest"
+	TokenAudience = "authtest"
+)
+
+// AccessToken issues an access token for identity signed with keys, accepted by
+// AuthMiddleware configured with Verifier(keys)
+func AccessToken(keys *auth.KeySet, identity Identity) (string, error) {
+	return IssuedAccessToken(keys, TokenIssuer, TokenAudience, identity)
+}
+
+// IssuedAccessToken issues an access token for identity as a server signing with keys
+// for issuer and audience would, so it passes that server's AuthMiddleware
+func IssuedAccessToken(keys *auth.KeySet, issuer, audience string, identity Identity) (string, error) {
+	var org *auth.Organization
+	if identity.OrgID != 0 {
+		org = &auth.Organization{ID: identity.OrgID, Role: identity.OrgRole}
+	}
+	subject := auth.Subject{
+		UserID:       identity.UserID,
+		Role:         identity.Role,
+		SessionID:    identity.SessionID,
+		Organization: org,
+		Groups:       identity.Groups,
+		Scopes:       identity.Scopes,
+	}
+	settings := auth.TokenSettings{
+		AccessKeys:    keys,
+		RefreshKeys:   keys,
+		Issuer:        issuer,
+		Audience:      audience,
+		AccessExpiry:  15,
+		RefreshExpiry: 1,
+	}
+	if identity.ImpersonatorID != 0 {
+		subject.Impersonator = &auth.Impersonator{UserID: identity.ImpersonatorID, SessionID: identity.ImpersonatorSessionID}
+		token, _, err := auth.GenerateAccessToken(subject, settings)
+		return token, err
+	}
+	pair, err := auth.GenerateTokenPair(subject, settings)
+	if err != nil {
+		return "", err
+	}
+	return pair.AccessToken, nil
+}
+
+// Verifier checks access tokens issued by AccessToken with keys
+func Verifier(keys *auth.KeySet) middleware.AccessTokenVerifier {
+	return auth.NewAccessTokenVerifier(keys, TokenIssuer, TokenAudience).Verify
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CacheRule assigns a Cache-Control policy to the routes matching Path.
+// Path is matched against the registered route template (e.g. /api/v1/admin/users/:id/role);
+// a trailing "/*" matches every route below the prefix.
+type CacheRule struct {
+	Path    string
+	Methods []string // empty matches every method
+	Policy  string
+}
+
+func (r CacheRule) matches(method, route string) bool {
+	if len(r.Methods) > 0 {
+		found := false
+		for _, m := range r.Methods {
+			if strings.EqualFold(m, method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if prefix, ok := strings.CutSuffix(r.Path, "/*"); ok {
+		return route == prefix || strings.HasPrefix(route, prefix+"/")
+	}
+	return route == r.Path
+}
+
+// CacheControlMiddleware sets the Cache-Control header from the first matching rule,
+// falling back to defaultPolicy. Handlers may still override the header.
+func CacheControlMiddleware(rules []CacheRule, defaultPolicy string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+
+		policy := defaultPolicy
+		for _, rule := range rules {
+			if rule.matches(c.Request.Method, route) {
+				policy = rule.Policy
+				break
+			}
+		}
+
+		if policy != "" {
+			c.Header("Cache-Control", policy)
+			if strings.Contains(policy, "no-store") {
+				c.Header("Pragma", "no-cache")
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"api/internal/captcha"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CaptchaHeader carries the response token of the CAPTCHA widget
+const CaptchaHeader = "X-Captcha-Token"
+
+// CaptchaVerifier checks a CAPTCHA response token, returning captcha.ErrRejected for
+// tokens the provider did not accept; see captcha.Verifier
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// CaptchaCheck is the CAPTCHA verification routes opt into with RequireCaptcha
+type CaptchaCheck struct {
+	Verifier CaptchaVerifier // nil disables the check
+	FailOpen bool            // let requests through while the provider cannot be reached
+}
+
+// RequireCaptcha rejects requests without a valid token in the X-Captcha-Token header.
+// required decides per request whether a token is needed, e.g. FailureCounter.Exceeded;
+// nil always requires one.
+func RequireCaptcha(check CaptchaCheck, required func(*gin.Context) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if check.Verifier == nil || (required != nil && !required(c)) {
+			c.Next()
+			return
+		}
+
+		err := check.Verifier.Verify(c.Request.Context(), c.GetHeader(CaptchaHeader), c.ClientIP())
+		switch {
+		case err == nil:
+		case errors.Is(err, captcha.ErrRejected):
+			c.JSON(http.StatusForbidden, gin.H{"error": "CAPTCHA verification failed", "code": "captcha_required"})
+			c.Abort()
+			return
+		case check.FailOpen:
+			_ = c.Error(err)
+		default:
+			_ = c.Error(err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "CAPTCHA verification unavailable"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+type failureWindow struct {
+	count int
+	start time.Time
+}
+
+// FailureCounter counts failed requests per client IP within a window, so routes can
+// ask for a CAPTCHA after repeated failures. Counts are kept in memory per instance.
+// The client IP is gin's ClientIP, which only follows X-Forwarded-For from the
+// router's trusted proxies: a client choosing its own address would never be asked.
+type FailureCounter struct {
+	threshold int
+	window    time.Duration
+
+	mu       sync.Mutex
+	failures map[string]*failureWindow
+	// expired windows are dropped when the map grows past pruneAt
+	pruneAt int
+}
+
+// NewFailureCounter reports clients with at least threshold failures within window
+func NewFailureCounter(threshold int, window time.Duration) *FailureCounter {
+	return &FailureCounter{
+		threshold: threshold,
+		window:    window,
+		failures:  map[string]*failureWindow{},
+		pruneAt:   1024,
+	}
+}
+
+// Track counts responses with failureStatus against the client IP and clears the
+// count after a successful response
+func (f *FailureCounter) Track(failureStatus int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		status := c.Writer.Status()
+		switch {
+		case status == failureStatus:
+			f.fail(c.ClientIP(), time.Now())
+		case status < http.StatusBadRequest:
+			f.mu.Lock()
+			delete(f.failures, c.ClientIP())
+			f.mu.Unlock()
+		}
+	}
+}
+
+// Exceeded reports whether the client reached the threshold
+func (f *FailureCounter) Exceeded(c *gin.Context) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	window, ok := f.failures[c.ClientIP()]
+	return ok && time.Since(window.start) < f.window && window.count >= f.threshold
+}
+
+func (f *FailureCounter) fail(ip string, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	window, ok := f.failures[ip]
+	if !ok || now.Sub(window.start) >= f.window {
+		if !ok && len(f.failures) >= f.pruneAt {
+			f.prune(now)
+		}
+		window = &failureWindow{start: now}
+		f.failures[ip] = window
+	}
+	window.count++
+}
+
+// prune drops expired windows. The next scan waits until the map doubles, so scans
+// stay rare while many clients are failing.
+func (f *FailureCounter) prune(now time.Time) {
+	for ip, window := range f.failures {
+		if now.Sub(window.start) >= f.window {
+			delete(f.failures, ip)
+		}
+	}
+	f.pruneAt = max(1024, 2*len(f.failures))
+}
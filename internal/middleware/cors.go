@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// CORSPolicy is the cross-origin policy. AllowOrigins holds exact origins
+// ("https://app.example.com"), wildcard subdomain patterns ("https://*.example.com",
+// which matches any subdomain but not example.com itself) or "*" for any origin.
+// An empty list allows no cross-origin requests.
+type CORSPolicy struct {
+	AllowOrigins     []string
+	AllowMethods     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+var (
+	httpToken = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+	hostLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+)
+
+// originPattern is a parsed AllowOrigins entry
+type originPattern struct {
+	scheme string
+	host   string // for wildcards, the domain below which any subdomain matches
+	port   string
+	// wildcard patterns match subdomains of host
+	wildcard bool
+}
+
+func (p originPattern) matches(origin *url.URL) bool {
+	if origin.Scheme != p.scheme || origin.Port() != p.port {
+		return false
+	}
+	host := strings.ToLower(origin.Hostname())
+	if !p.wildcard {
+		return host == p.host
+	}
+	subdomain, ok := strings.CutSuffix(host, "."+p.host)
+	if !ok {
+		return false
+	}
+	for _, label := range strings.Split(subdomain, ".") {
+		if !hostLabel.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseOrigin validates an AllowOrigins entry other than "*"
+func parseOrigin(origin string) (originPattern, error) {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return originPattern{}, fmt.Errorf("origin %q must be scheme://host[:port]", origin)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return originPattern{}, fmt.Errorf("origin %q must use http or https", origin)
+	}
+
+	p := originPattern{scheme: u.Scheme, host: strings.ToLower(u.Hostname()), port: u.Port()}
+	if rest, ok := strings.CutPrefix(p.host, "*."); ok {
+		p.wildcard = true
+		p.host = rest
+		// "*.com" would allow every site under a public suffix
+		if !strings.Contains(rest, ".") {
+			return originPattern{}, fmt.Errorf("origin %q: a wildcard needs a domain of at least two labels", origin)
+		}
+	}
+	if strings.Contains(p.host, "*") {
+		return originPattern{}, fmt.Errorf("origin %q: a wildcard is only allowed as the whole leftmost label", origin)
+	}
+	return p, nil
+}
+
+// config validates the policy and converts it for gin-contrib/cors
+func (p CORSPolicy) config() (cors.Config, error) {
+	config := cors.Config{
+		AllowMethods:     p.AllowMethods,
+		AllowHeaders:     p.AllowHeaders,
+		ExposeHeaders:    p.ExposeHeaders,
+		AllowCredentials: p.AllowCredentials,
+		MaxAge:           p.MaxAge,
+	}
+
+	var patterns []originPattern
+	for _, origin := range p.AllowOrigins {
+		if origin == "*" {
+			if len(p.AllowOrigins) > 1 {
+				return cors.Config{}, errors.New(`"*" allows every origin and cannot be combined with other origins`)
+			}
+			// Browsers reject credentialed responses with a wildcard origin, and echoing
+			// any origin instead would let every site act with the user's credentials
+			if p.AllowCredentials {
+				return cors.Config{}, errors.New(`"*" cannot be used with allowCredentials; list the allowed origins`)
+			}
+			config.AllowAllOrigins = true
+			continue
+		}
+		pattern, err := parseOrigin(origin)
+		if err != nil {
+			return cors.Config{}, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	if !config.AllowAllOrigins {
+		config.AllowOriginFunc = func(origin string) bool {
+			u, err := url.Parse(origin)
+			if err != nil {
+				return false
+			}
+			for _, pattern := range patterns {
+				if pattern.matches(u) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	for _, method := range p.AllowMethods {
+		if !httpToken.MatchString(method) {
+			return cors.Config{}, fmt.Errorf("invalid method %q", method)
+		}
+	}
+	for _, header := range append(append([]string{}, p.AllowHeaders...), p.ExposeHeaders...) {
+		if !httpToken.MatchString(header) {
+			return cors.Config{}, fmt.Errorf("invalid header name %q", header)
+		}
+	}
+	if p.MaxAge < 0 {
+		return cors.Config{}, errors.New("max age must not be negative")
+	}
+	if err := config.Validate(); err != nil {
+		return cors.Config{}, err
+	}
+	return config, nil
+}
+
+// CORS applies a CORS policy that can be replaced while the server is running
+type CORS struct {
+	handler atomic.Value // gin.HandlerFunc
+}
+
+// NewCORS creates the middleware with an initial policy
+func NewCORS(policy CORSPolicy) (*CORS, error) {
+	c := &CORS{}
+	if err := c.Update(policy); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Update validates policy and applies it to subsequent requests. An invalid policy is
+// rejected and the current one stays in place.
+func (c *CORS) Update(policy CORSPolicy) error {
+	config, err := policy.config()
+	if err != nil {
+		return err
+	}
+	c.handler.Store(cors.New(config))
+	return nil
+}
+
+// Handler returns the gin middleware
+func (c *CORS) Handler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c.handler.Load().(gin.HandlerFunc)(ctx)
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deprecation announces that the API version a route group serves is being retired
+type Deprecation struct {
+	Since     time.Time // when the version was deprecated; zero omits the Deprecation header
+	Sunset    time.Time // when it stops being served; zero omits the Sunset header
+	Successor string    // URL of the version replacing it, sent as a successor-version link
+	Docs      string    // URL of the migration guide, sent as a deprecation link
+}
+
+// DeprecationMiddleware adds the Deprecation (RFC 9745), Sunset (RFC 8594) and Link
+// headers of d to every response, so clients can warn about the upcoming removal
+func DeprecationMiddleware(d Deprecation) gin.HandlerFunc {
+	var links []string
+	if d.Successor != "" {
+		links = append(links, "<"+d.Successor+`>; rel="successor-version"`)
+	}
+	if d.Docs != "" {
+		links = append(links, "<"+d.Docs+`>; rel="deprecation"; type="text/html"`)
+	}
+
+	return func(c *gin.Context) {
+		if !d.Since.IsZero() {
+			c.Header("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+		}
+		if !d.Sunset.IsZero() {
+			c.Header("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		for _, link := range links {
+			c.Writer.Header().Add("Link", link)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetaKey is the context key of a map[string]any handlers fill with values for the
+// envelope's meta object, such as the cursor of the next page
+const MetaKey = "meta"
+
+// EnvelopeMiddleware wraps JSON responses as {"data": ..., "meta": {...}}, or
+// {"errors": [...], "meta": {...}} for 4xx and 5xx. An error body's "error" becomes the
+// message of its error object and the other fields ("code", "field") are kept; a
+// rejected body gets one error object per entry of its "fields". meta always has the
+// request ID. With optIn only requests with envelope=true are wrapped, so clients of an
+// existing version keep getting the bodies they parse today.
+func EnvelopeMiddleware(optIn bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if optIn {
+			if wrap, _ := strconv.ParseBool(c.Query("envelope")); !wrap {
+				c.Next()
+				return
+			}
+		}
+
+		original := c.Writer
+		writer := &jsonBodyWriter{ResponseWriter: original}
+		c.Writer = writer
+		c.Next()
+		c.Writer = original
+
+		if !writer.holding {
+			return
+		}
+		body := writer.body.Bytes()
+		if !json.Valid(body) {
+			original.Write(body)
+			return
+		}
+		wrapped, err := json.Marshal(envelope(c, original.Status(), body))
+		if err != nil {
+			original.Write(body)
+			return
+		}
+		original.Header().Del("Content-Length")
+		original.Write(wrapped)
+	}
+}
+
+func envelope(c *gin.Context, status int, body json.RawMessage) gin.H {
+	meta := gin.H{"requestId": c.GetString("requestID")}
+	if values, ok := c.Get(MetaKey); ok {
+		if values, ok := values.(map[string]any); ok {
+			for key, value := range values {
+				meta[key] = value
+			}
+		}
+	}
+	if status < http.StatusBadRequest {
+		return gin.H{"data": body, "meta": meta}
+	}
+
+	problem := gin.H{}
+	if err := json.Unmarshal(body, &problem); err != nil {
+		problem = gin.H{}
+	}
+	if message, ok := problem["error"]; ok {
+		delete(problem, "error")
+		problem["message"] = message
+	} else if _, ok := problem["message"]; !ok {
+		problem["message"] = http.StatusText(status)
+	}
+	problem["status"] = status
+
+	// A rejected body lists its fields; each becomes an error of its own
+	fields, _ := problem["fields"].([]any)
+	if len(fields) == 0 {
+		return gin.H{"errors": []gin.H{problem}, "meta": meta}
+	}
+	errs := make([]gin.H, 0, len(fields))
+	for _, field := range fields {
+		if field, ok := field.(map[string]any); ok {
+			field["status"] = status
+			errs = append(errs, field)
+		}
+	}
+	return gin.H{"errors": errs, "meta": meta}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FeatureFlags tells which feature flags are on for a user
+type FeatureFlags interface {
+	Enabled(key string, userID uint, role string) bool
+	EnabledFor(userID uint, role string) []string
+}
+
+// featureFlagsKey is the context key FeatureFlagMiddleware stores the flags under
+const featureFlagsKey = "featureFlags"
+
+// FeatureFlagMiddleware makes flags available to FeatureEnabled, EnabledFeatures and
+// RequireFeature. It runs before authentication; the flags are evaluated for the user
+// authenticated by the time they are asked for.
+func FeatureFlagMiddleware(flags FeatureFlags) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(featureFlagsKey, flags)
+		c.Next()
+	}
+}
+
+func featureFlags(c *gin.Context) FeatureFlags {
+	flags, _ := c.Get(featureFlagsKey)
+	f, _ := flags.(FeatureFlags)
+	return f
+}
+
+// FeatureEnabled reports whether the flag key is on for the caller. Without
+// FeatureFlagMiddleware every flag is off.
+func FeatureEnabled(c *gin.Context, key string) bool {
+	flags := featureFlags(c)
+	return flags != nil && flags.Enabled(key, c.GetUint("userID"), c.GetString("role"))
+}
+
+// EnabledFeatures returns the keys of the flags on for the caller, sorted
+func EnabledFeatures(c *gin.Context) []string {
+	return EnabledFeaturesFor(c, c.GetUint("userID"), c.GetString("role"))
+}
+
+// EnabledFeaturesFor returns the keys of the flags on for another user, sorted, such
+// as the one an admin previews
+func EnabledFeaturesFor(c *gin.Context, userID uint, role string) []string {
+	flags := featureFlags(c)
+	if flags == nil {
+		return []string{}
+	}
+	return flags.EnabledFor(userID, role)
+}
+
+// RequireFeature answers 404 unless the flag key is on for the caller, so routes of
+// features still rolling out do not exist for everyone else
+func RequireFeature(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !FeatureEnabled(c, key) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
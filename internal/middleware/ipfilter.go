@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"api/internal/ipfilter"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IPFilterMiddleware rejects requests from client addresses the filter does not allow on
+// the route. It runs before authentication, so blocked clients cannot try credentials.
+func IPFilterMiddleware(filter *ipfilter.Filter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+
+		if !filter.Allows(net.ParseIP(c.ClientIP()), route) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access from this network is not allowed", "code": "ip_blocked"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jsonBodyWriter holds back JSON bodies so a middleware can rewrite them once the
+// handler is done; anything else (files, exports, redirects) is written through
+// unchanged. When only is set, it also has to return true at the first write.
+type jsonBodyWriter struct {
+	gin.ResponseWriter
+	only    func() bool
+	body    bytes.Buffer
+	decided bool
+	holding bool
+}
+
+func (w *jsonBodyWriter) hold() bool {
+	if !w.decided {
+		w.decided = true
+		w.holding = strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") &&
+			(w.only == nil || w.only())
+	}
+	return w.holding
+}
+
+func (w *jsonBodyWriter) Write(data []byte) (int, error) {
+	if w.hold() {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *jsonBodyWriter) WriteString(s string) (int, error) {
+	if w.hold() {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
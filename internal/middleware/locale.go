@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"api/internal/i18n"
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserLocaleLookup returns the locale and timezone stored for a user, "" for those
+// not chosen
+type UserLocaleLookup func(userID uint) (locale, timezone string)
+
+const (
+	localeLookupKey = "localeLookup"
+	localeSourceKey = "localeSource"
+)
+
+// LocaleMiddleware resolves the language of the request. An Accept-Language header
+// naming a supported locale wins; otherwise the authenticated user's stored locale is
+// used once the auth middleware identified them, and the default locale before that.
+// The result is stored as "locale" and reported in the Content-Language header, with
+// X-Locale-Source (header, user or default) telling clients where it came from.
+//
+// Handlers write their messages in English. In any other locale the "error" and
+// "message" of JSON responses, and the messages of an envelope's errors, are replaced
+// by their translation when the catalog has one.
+func LocaleMiddleware(lookup UserLocaleLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Vary", "Accept-Language")
+		if locale := i18n.FromAcceptLanguage(c.GetHeader("Accept-Language")); locale != "" {
+			setLocale(c, locale, "header")
+		} else {
+			setLocale(c, i18n.Default, "default")
+		}
+		if lookup != nil {
+			c.Set(localeLookupKey, lookup)
+		}
+
+		// The user's locale is only known after authentication, so whether to translate
+		// is decided when the response is written
+		original := c.Writer
+		writer := &jsonBodyWriter{ResponseWriter: original, only: func() bool {
+			return c.GetString("locale") != i18n.Default
+		}}
+		c.Writer = writer
+		c.Next()
+		c.Writer = original
+
+		if writer.holding {
+			original.Write(translateBody(c.GetString("locale"), writer.body.Bytes()))
+		}
+	}
+}
+
+// translateBody translates the messages of a JSON body, returning it unchanged when
+// there is nothing to translate
+func translateBody(locale string, body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil {
+		return body
+	}
+
+	changed := false
+	translate := func(object map[string]any, key string) {
+		if text, ok := object[key].(string); ok {
+			if translated := i18n.Translate(locale, text); translated != text {
+				object[key] = translated
+				changed = true
+			}
+		}
+	}
+	translate(object, "error")
+	translate(object, "message")
+	if errs, ok := object["errors"].([]any); ok {
+		for _, e := range errs {
+			if e, ok := e.(map[string]any); ok {
+				translate(e, "message")
+			}
+		}
+	}
+	if !changed {
+		return body
+	}
+	translated, err := json.Marshal(object)
+	if err != nil {
+		return body
+	}
+	return translated
+}
+
+// applyUserLocale switches the request to the user's stored locale unless the client
+// asked for one explicitly, and stores the user's timezone as "timezone" (a
+// *time.Location) for the timestamps of the response. Called by the auth middlewares
+// after setting "userID".
+func applyUserLocale(c *gin.Context, userID uint) {
+	value, ok := c.Get(localeLookupKey)
+	if !ok {
+		return
+	}
+	lookup, _ := value.(UserLocaleLookup)
+	locale, timezone := lookup(userID)
+	if timezone != "" {
+		if loc, err := time.LoadLocation(timezone); err == nil {
+			c.Set("timezone", loc)
+		}
+	}
+	if c.GetString(localeSourceKey) == "header" {
+		return
+	}
+	if locale := i18n.Normalize(locale); locale != "" {
+		setLocale(c, locale, "user")
+	}
+}
+
+func setLocale(c *gin.Context, locale, source string) {
+	c.Set("locale", locale)
+	c.Set(localeSourceKey, source)
+	c.Header("Content-Language", locale)
+	c.Header("X-Locale-Source", source)
+}
@@ -1,16 +1,37 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
+// RequestIDHeader carries the request ID; a well-formed ID sent by the client or a
+// proxy is kept, otherwise one is generated
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// redactedHeaders are not written to debug logs
+var redactedHeaders = map[string]bool{"Authorization": true, "Proxy-Authorization": true, "Cookie": true, "X-Api-Key": true}
+
 func LoggingMiddleware(logger *logrus.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		startTime := time.Now()
 
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		c.Set("requestID", requestID)
+		c.Header(RequestIDHeader, requestID)
+
 		// Process request
 		c.Next()
 
@@ -18,16 +39,32 @@ func LoggingMiddleware(logger *logrus.Logger) gin.HandlerFunc {
 		duration := time.Since(startTime)
 		userID, _ := c.Get("userID")
 
-		entry := logger.WithFields(logrus.Fields{
+		// The request context carries the trace, if any, for the trace_id field
+		entry := logger.WithContext(c.Request.Context()).WithFields(logrus.Fields{
 			"method":     c.Request.Method,
 			"path":       c.Request.URL.Path,
 			"status":     c.Writer.Status(),
 			"duration":   duration,
 			"ip":         c.ClientIP(),
+			"port":       clientPort(c),
 			"user-agent": c.Request.UserAgent(),
 			"user-id":    userID,
+			"request_id": requestID,
 		})
 
+		// Only produced while debug logging is enabled globally or for this user or request
+		if logger.IsLevelEnabled(logrus.DebugLevel) {
+			entry.WithFields(logrus.Fields{
+				"query":          c.Request.URL.RawQuery,
+				"route":          c.FullPath(),
+				"handler":        c.HandlerName(),
+				"request_bytes":  c.Request.ContentLength,
+				"response_bytes": c.Writer.Size(),
+				"headers":        debugHeaders(c),
+				"errors":         c.Errors.String(),
+			}).Debug("Request details")
+		}
+
 		if c.Writer.Status() >= 500 {
 			entry.Error("Server error")
 		} else if c.Writer.Status() >= 400 {
@@ -37,3 +74,34 @@ func LoggingMiddleware(logger *logrus.Logger) gin.HandlerFunc {
 		}
 	}
 }
+
+// clientPort returns the source port of the connection, which is the original client's
+// when the listener accepts PROXY protocol
+func clientPort(c *gin.Context) string {
+	_, port, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	return port
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// debugHeaders returns the request headers without credentials
+func debugHeaders(c *gin.Context) map[string]string {
+	headers := make(map[string]string, len(c.Request.Header))
+	for name, values := range c.Request.Header {
+		if redactedHeaders[name] {
+			headers[name] = "[redacted]"
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
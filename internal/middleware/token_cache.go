@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// TokenClaims are the parts of a validated access token the middleware puts on the context
+type TokenClaims struct {
+	UserID    uint
+	JTI       string
+	Role      interface{}
+	SessionID interface{}
+	OrgID     uint // 0 when the token acts for no organization
+	OrgRole   string
+	Groups    []string
+	Scopes    []string // nil when the token is not limited to scopes
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// ImpersonatorID is the admin acting as the user, 0 for the user's own tokens
+	ImpersonatorID        uint
+	ImpersonatorSessionID string
+}
+
+// TokenKey identifies a token in a TokenCache: the SHA-256 of the whole token, so the
+// cache never holds a bearer credential that could be replayed if its memory leaked
+type TokenKey [sha256.Size]byte
+
+// KeyOf returns the cache key of token
+func KeyOf(token string) TokenKey {
+	return sha256.Sum256([]byte(token))
+}
+
+type cachedToken struct {
+	claims   TokenClaims
+	cachedAt time.Time
+}
+
+// TokenCache remembers access tokens that passed validation for a short time, so
+// repeated requests with the same token skip signature and revocation checks. Callers
+// look entries up by the TokenKey of the token, never the token itself; the JTI is not
+// a key, as it is only trustworthy once the signature is checked, which is the work the
+// cache saves. Entries are indexed by JTI, which is how Invalidate/InvalidateUser drop
+// them as soon as a token is revoked.
+type TokenCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[TokenKey]*cachedToken
+	byJTI   map[string]TokenKey
+	// generation changes on every invalidation so a validation that raced with a
+	// revocation is not cached
+	generation uint64
+}
+
+// NewTokenCache creates a cache holding up to maxEntries tokens for at most ttl
+func NewTokenCache(ttl time.Duration, maxEntries int) *TokenCache {
+	return &TokenCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    map[TokenKey]*cachedToken{},
+		byJTI:      map[string]TokenKey{},
+	}
+}
+
+// Get returns the cached claims of the token with key
+func (c *TokenCache) Get(key TokenKey, now time.Time) (*TokenClaims, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if c.stale(entry, now) {
+		c.remove(key)
+		return nil, false
+	}
+	claims := entry.claims
+	return &claims, true
+}
+
+// Generation returns a value to pass to Put; read it before validating a token
+func (c *TokenCache) Generation() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// Put caches the claims of the token with key, which passed validation, unless a
+// token was invalidated since generation was read
+func (c *TokenCache) Put(key TokenKey, claims TokenClaims, generation uint64, now time.Time) {
+	if c == nil || claims.JTI == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+	c.entries[key] = &cachedToken{claims: claims, cachedAt: now}
+	c.byJTI[claims.JTI] = key
+}
+
+// Invalidate drops a single token
+func (c *TokenCache) Invalidate(jti string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.generation++
+	if key, ok := c.byJTI[jti]; ok {
+		c.remove(key)
+	}
+	c.mu.Unlock()
+}
+
+// InvalidateUser drops every token of userID
+func (c *TokenCache) InvalidateUser(userID uint) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.generation++
+	for key, entry := range c.entries {
+		if entry.claims.UserID == userID {
+			c.remove(key)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// evict makes room by dropping stale entries, and arbitrary ones if all are fresh.
+// Callers hold c.mu.
+func (c *TokenCache) evict(now time.Time) {
+	for key, entry := range c.entries {
+		if c.stale(entry, now) {
+			c.remove(key)
+		}
+	}
+	for key := range c.entries {
+		if len(c.entries) < c.maxEntries {
+			break
+		}
+		c.remove(key)
+	}
+}
+
+func (c *TokenCache) stale(entry *cachedToken, now time.Time) bool {
+	return now.Sub(entry.cachedAt) >= c.ttl || !now.Before(entry.claims.ExpiresAt)
+}
+
+// remove drops an entry and its JTI index. Callers hold c.mu.
+func (c *TokenCache) remove(key TokenKey) {
+	if entry, ok := c.entries[key]; ok {
+		delete(c.byJTI, entry.claims.JTI)
+		delete(c.entries, key)
+	}
+}
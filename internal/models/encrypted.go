@@ -0,0 +1,55 @@
+package models
+
+import (
+	"api/internal/encryption"
+	"database/sql/driver"
+	"fmt"
+)
+
+// EncryptedString is a text column encrypted at rest with the keyring installed by
+// encryption.SetDefault. In memory it holds the plaintext; rows written before
+// encryption was enabled are read as they are and encrypted on their next save.
+type EncryptedString string
+
+func (s EncryptedString) Value() (driver.Value, error) {
+	keyring := encryption.Default()
+	if keyring == nil {
+		return string(s), nil
+	}
+	return keyring.Encrypt(string(s))
+}
+
+func (s *EncryptedString) Scan(src interface{}) error {
+	var stored string
+	switch v := src.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into EncryptedString", src)
+	}
+
+	keyring := encryption.Default()
+	if keyring == nil {
+		if encryption.KeyID(stored) != "" {
+			return encryption.ErrNoKey
+		}
+		*s = EncryptedString(stored)
+		return nil
+	}
+	plaintext, err := keyring.Decrypt(stored)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(plaintext)
+	return nil
+}
+
+// String returns the plaintext
+func (s EncryptedString) String() string {
+	return string(s)
+}
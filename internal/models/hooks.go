@@ -0,0 +1,224 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ActorKey is the gorm setting holding the ID of the user performing a change,
+// e.g. db.Set(models.ActorKey, adminID).Save(&user). It ends up in audit entries.
+const ActorKey = "audit:actor_id"
+
+const snapshotKey = "audit:before"
+
+// Fields whose values must never be copied into audit entries or webhooks
+var redactedFields = map[string]bool{
+	"PasswordHash": true,
+}
+
+// auditedFields lists the columns compared between the stored and updated row
+var auditedFields = map[string][]string{
+	"user":         {"Email", "Username", "PasswordHash", "Role", "EmailVerified", "Status", "SuspensionReason", "SuspendedUntil"},
+	"user_profile": {"FirstName", "LastName", "Bio", "AvatarURL", "AvatarKey"},
+}
+
+type fieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// BeforeUpdate keeps a copy of the stored row so AfterUpdate can tell what changed
+func (u *User) BeforeUpdate(scope *gorm.Scope) error {
+	return snapshot(scope, u.ID, &User{})
+}
+
+func (u *User) AfterUpdate(scope *gorm.Scope) error {
+	return recordChange(scope, "user", u.ID, u.ID, "update", u)
+}
+
+// AfterCreate queues the user.created event within the transaction creating the user
+func (u *User) AfterCreate(scope *gorm.Scope) error {
+	if u.ID == 0 {
+		return nil
+	}
+	return enqueueEvent(scope.NewDB(), "user.created", u.ID, nil)
+}
+
+func (u *User) AfterDelete(scope *gorm.Scope) error {
+	return recordChange(scope, "user", u.ID, u.ID, "delete", u)
+}
+
+func (p *UserProfile) BeforeUpdate(scope *gorm.Scope) error {
+	return snapshot(scope, p.ID, &UserProfile{})
+}
+
+func (p *UserProfile) AfterUpdate(scope *gorm.Scope) error {
+	return recordChange(scope, "user_profile", p.ID, p.UserID, "update", p)
+}
+
+func (p *UserProfile) AfterDelete(scope *gorm.Scope) error {
+	return recordChange(scope, "user_profile", p.ID, p.UserID, "delete", p)
+}
+
+func snapshot(scope *gorm.Scope, id uint, before interface{}) error {
+	// Batch updates without a loaded row cannot be diffed
+	if id == 0 {
+		return nil
+	}
+	err := scope.NewDB().Unscoped().First(before, id).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+	if err == nil {
+		scope.InstanceSet(snapshotKey, before)
+	}
+	return nil
+}
+
+// diff compares the audited fields of two values of the same struct type
+func diff(entity string, before, after interface{}) map[string]fieldChange {
+	changes := map[string]fieldChange{}
+	b := reflect.Indirect(reflect.ValueOf(before))
+	a := reflect.Indirect(reflect.ValueOf(after))
+	for _, name := range auditedFields[entity] {
+		from, to := b.FieldByName(name).Interface(), a.FieldByName(name).Interface()
+		if reflect.DeepEqual(from, to) {
+			continue
+		}
+		// Encrypted fields stay out of the audit trail, which stores plaintext
+		if _, encrypted := from.(EncryptedString); encrypted || redactedFields[name] {
+			from, to = "[redacted]", "[redacted]"
+		}
+		changes[name] = fieldChange{From: from, To: to}
+	}
+	return changes
+}
+
+// recordChange writes the audit entry, bumps the cache versions and queues the
+// webhook for a change. Everything goes through scope.NewDB so it is part of the
+// transaction gorm opened for the update or delete and rolls back with it.
+func recordChange(scope *gorm.Scope, entity string, id, userID uint, action string, value interface{}) error {
+	if id == 0 {
+		return nil
+	}
+	db := scope.NewDB()
+
+	var changes map[string]fieldChange
+	if action == "update" {
+		before, ok := scope.InstanceGet(snapshotKey)
+		if !ok {
+			return nil
+		}
+		changes = diff(entity, before, value)
+		if len(changes) == 0 {
+			return nil
+		}
+	}
+
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	entry := AuditEntry{
+		Entity:   entity,
+		EntityID: id,
+		UserID:   userID,
+		Action:   action,
+		Changes:  string(changesJSON),
+	}
+	if actor, ok := scope.Get(ActorKey); ok {
+		if actorID, ok := actor.(uint); ok {
+			entry.ActorID = &actorID
+		}
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		return fmt.Errorf("write audit entry: %w", err)
+	}
+
+	for _, key := range []string{fmt.Sprintf("user:%d", userID), "users"} {
+		if err := BumpCacheVersion(db, key); err != nil {
+			return fmt.Errorf("bump cache version: %w", err)
+		}
+	}
+
+	event := "user.updated"
+	switch {
+	case entity == "user" && action == "delete":
+		event = "user.deleted"
+	case entity == "user_profile" && action == "update":
+		event = "user.profile.updated"
+	case entity == "user_profile" && action == "delete":
+		event = "user.profile.deleted"
+	}
+	if err := enqueueEvent(db, event, userID, changedFields(changes)); err != nil {
+		return err
+	}
+
+	// Milestones consumers commonly wait for get their own event next to user.updated
+	if entity == "user" && action == "update" {
+		if _, ok := changes["Role"]; ok {
+			if err := enqueueEvent(db, "user.role_changed", userID, []string{"Role"}); err != nil {
+				return err
+			}
+		}
+		if change, ok := changes["EmailVerified"]; ok && change.To == true {
+			if err := enqueueEvent(db, "user.verified", userID, []string{"EmailVerified"}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// enqueueEvent writes a lifecycle event to the outbox with db, so it is only
+// published if the transaction db belongs to commits
+func enqueueEvent(db *gorm.DB, event string, userID uint, changed []string) error {
+	if changed == nil {
+		changed = []string{}
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"event":      event,
+		"userId":     userID,
+		"changed":    changed,
+		"occurredAt": time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	webhook := WebhookEvent{
+		Event:   event,
+		UserID:  userID,
+		Payload: string(payload),
+		Status:  WebhookEventPending,
+	}
+	if err := db.Create(&webhook).Error; err != nil {
+		return fmt.Errorf("enqueue webhook event: %w", err)
+	}
+	return nil
+}
+
+func changedFields(changes map[string]fieldChange) []string {
+	fields := make([]string, 0, len(changes))
+	for name := range changes {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// BumpCacheVersion increments the version of a cache key, creating it on first use
+func BumpCacheVersion(db *gorm.DB, key string) error {
+	if db.Dialect().GetName() == "mysql" {
+		return db.Exec(`INSERT INTO cache_versions ("key", version, updated_at) VALUES (?, 1, ?)
+			ON DUPLICATE KEY UPDATE version = version + 1, updated_at = VALUES(updated_at)`,
+			key, time.Now()).Error
+	}
+	return db.Exec(`INSERT INTO cache_versions ("key", version, updated_at) VALUES (?, 1, ?)
+		ON CONFLICT ("key") DO UPDATE SET version = cache_versions.version + 1, updated_at = EXCLUDED.updated_at`,
+		key, time.Now()).Error
+}
@@ -8,18 +8,98 @@ import (
 
 type User struct {
 	gorm.Model
-	Email         string `gorm:"unique;not null"`
-	Username      string `gorm:"unique;not null"`
-	PasswordHash  string `gorm:"not null"`
-	Role          string `gorm:"type:varchar(20);default:'user'"`
-	EmailVerified bool   `gorm:"default:false"`
+	Email         string     `gorm:"unique;not null"`
+	Username      string     `gorm:"unique;not null"`
+	PasswordHash  string     `gorm:"not null"`
+	Role          string     `gorm:"type:varchar(20);default:'user'"`
+	EmailVerified bool       `gorm:"default:false"`
+	AnonymizedAt  *time.Time // set when the account was erased by anonymization
+	// Account status; only active accounts can sign in and use the API
+	Status           string `gorm:"type:varchar(20);not null;default:'active'"`
+	SuspensionReason string
+	SuspendedAt      *time.Time
+	SuspendedUntil   *time.Time // a suspension is lifted after this; nil suspends until reinstated
+	DeactivatedAt    *time.Time // set while the user has deactivated their own account
+	// DeletionScheduledAt is when an account pending deletion is erased
+	DeletionScheduledAt *time.Time
+	// UsernameChangedAt starts the cooldown before the user can rename again
+	UsernameChangedAt *time.Time
+	// PasswordChangedAt is when the password was last set; nil means at sign-up
+	PasswordChangedAt *time.Time
+	// PasswordChangeRequired is set on accounts created with a password the user did not
+	// choose, such as imported ones; they cannot sign in until they set their own
+	PasswordChangeRequired bool `gorm:"not null;default:false"`
+	// AuthSource is where the user authenticates: locally, the LDAP directory, SAML or
+	// the source of another auth provider
+	AuthSource string `gorm:"type:varchar(20);not null;default:'local'"`
+}
+
+// Account statuses
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusBanned    = "banned"
+	// UserStatusDeactivated is set by users themselves; signing in offers reactivation
+	UserStatusDeactivated = "deactivated"
+	// UserStatusPendingDeletion is set when users delete their account; until the grace
+	// period ends, signing in or the emailed link restores it
+	UserStatusPendingDeletion = "pending_deletion"
+)
+
+// Authentication sources
+const (
+	AuthSourceLocal = "local"
+	AuthSourceLDAP  = "ldap"
+	AuthSourceSAML  = "saml"
+)
+
+// ExternallyManaged reports whether an identity provider checks the user's credentials,
+// in which case the local password is unusable and cannot be changed or reset
+func (u *User) ExternallyManaged() bool {
+	return u.AuthSource != "" && u.AuthSource != AuthSourceLocal
+}
+
+// AccountStatus returns the status in effect at now: a suspension whose expiry has
+// passed counts as active even before it is lifted in the database
+func (u *User) AccountStatus(now time.Time) string {
+	switch {
+	case u.Status == UserStatusBanned:
+		return UserStatusBanned
+	case u.Status == UserStatusDeactivated:
+		return UserStatusDeactivated
+	case u.Status == UserStatusPendingDeletion:
+		return UserStatusPendingDeletion
+	case u.Status == UserStatusSuspended && (u.SuspendedUntil == nil || now.Before(*u.SuspendedUntil)):
+		return UserStatusSuspended
+	default:
+		return UserStatusActive
+	}
 }
 
 type RefreshToken struct {
 	gorm.Model
-	UserID    uint      `gorm:"not null"`
-	TokenHash string    `gorm:"not null"`
-	ExpiresAt time.Time `gorm:"not null"`
+	UserID      uint      `gorm:"not null;index"`
+	TokenHash   string    `gorm:"not null;index"`
+	TokenDigest string    `gorm:"index"` // SHA-256 of the token, written outside of "raw" storage mode
+	ExpiresAt   time.Time `gorm:"not null"`
+	// Rotation: every token issued from the same login shares a family. A used token is
+	// kept with RotatedAt set and a link to its replacement so reuse can be detected.
+	FamilyID     string `gorm:"type:varchar(64);index"`
+	RotatedAt    *time.Time
+	ReplacedByID *uint
+	// Device metadata for session management, carried over on rotation
+	IPAddress string `gorm:"type:varchar(64)"`
+	UserAgent string `gorm:"type:text"`
+	// DeviceFingerprint is the device the token was issued to (see TrustedDevice); with
+	// device binding only that device can use it
+	DeviceFingerprint string `gorm:"type:varchar(64)"`
+	SessionStartedAt  time.Time
+	LastUsedAt        time.Time
+	// Organization the session acts for, carried over on rotation; nil for none
+	OrganizationID *uint
+	// Scopes limit the access tokens of a scoped session, comma separated and carried
+	// over on rotation; empty for a full session
+	Scopes string
 }
 
 type UserProfile struct {
@@ -27,6 +107,590 @@ type UserProfile struct {
 	UserID    uint `gorm:"unique;not null"`
 	FirstName string
 	LastName  string
-	Bio       string `gorm:"type:text"`
-	AvatarURL string
+	Bio       EncryptedString `gorm:"type:text"`
+	AvatarURL string          `gorm:"type:text"`
+	AvatarKey string          // storage key of an uploaded avatar, served through /media/avatars/:id
+	Locale    string          `gorm:"type:varchar(10)"` // preferred language for responses, empty to follow Accept-Language
+	// Identity fields shown alongside the name. Bio, preferred name and pronouns are
+	// encrypted at rest; the names stay plaintext for search.
+	PreferredName EncryptedString `gorm:"type:text"`
+	Pronouns      EncryptedString `gorm:"type:text"`
+	Honorific     string          `gorm:"type:varchar(20)"`
+	Timezone      string          `gorm:"type:varchar(64)"` // IANA name, e.g. Europe/Berlin
+	// Visibility holds the user's per-field directory visibility as "field=public,field=private";
+	// fields not listed use the defaults
+	Visibility string `gorm:"type:varchar(255)"`
+}
+
+// Normalized email event names
+const (
+	EmailEventSent      = "sent"
+	EmailEventDelivered = "delivered"
+	EmailEventOpened    = "opened"
+	EmailEventBounced   = "bounced"
+	EmailEventFailed    = "failed" // the provider could not be reached or rejected the message
+)
+
+type EmailEvent struct {
+	gorm.Model
+	MessageID string `gorm:"index;not null"`
+	Template  string `gorm:"type:varchar(50);index;not null"`
+	Recipient string
+	Provider  string `gorm:"type:varchar(30)"`
+	Event     string `gorm:"type:varchar(20);index;not null"` // sent, delivered, opened, bounced, failed
+}
+
+// TokenRevocation blacklists access tokens before they expire. A row either
+// revokes a single token by JTI or, with IssuedBefore set, every token of the user issued before that time.
+type TokenRevocation struct {
+	gorm.Model
+	JTI          string     `gorm:"type:varchar(64);index"`
+	UserID       uint       `gorm:"index"`
+	IssuedBefore *time.Time `gorm:"precision:6"`    // microseconds, as in token iat claims
+	ExpiresAt    time.Time  `gorm:"index;not null"` // the row can be dropped once every affected token has expired
+}
+
+type APIKey struct {
+	gorm.Model
+	UserID     uint   `gorm:"index;not null"`
+	Name       string `gorm:"not null"`
+	Prefix     string `gorm:"type:varchar(16);not null"` // first characters of the key, shown to identify it
+	KeyHash    string `gorm:"unique;not null"`
+	Scopes     string // comma separated
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	// Set when anomaly detection suspends the key
+	SuspendedAt   *time.Time
+	SuspendReason string
+}
+
+// APIKeyUsage counts the requests made with an API key per hour
+type APIKeyUsage struct {
+	gorm.Model
+	APIKeyID uint      `gorm:"index;not null"`
+	Hour     time.Time `gorm:"index;not null"`
+	Requests int       `gorm:"not null"`
+}
+
+// APIKeyFingerprint records an endpoint or IP range an API key has been seen using
+type APIKeyFingerprint struct {
+	gorm.Model
+	APIKeyID uint   `gorm:"index;not null"`
+	Kind     string `gorm:"type:varchar(20);not null"` // endpoint or ip_range
+	Value    string `gorm:"not null"`
+}
+
+// ShareToken lets a third-party app the user chose read some of their profile fields,
+// and nothing else
+type ShareToken struct {
+	gorm.Model
+	UserID     uint   `gorm:"index;not null"`
+	App        string `gorm:"not null"`                  // name of the app, shown to the user
+	Prefix     string `gorm:"type:varchar(16);not null"` // first characters of the token, shown to identify it
+	TokenHash  string `gorm:"unique;not null"`
+	Fields     string // comma separated
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+// SecurityEvent records suspicious activity worth an operator's attention
+type SecurityEvent struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	APIKeyID *uint  `gorm:"index"`
+	Type     string `gorm:"type:varchar(50);index;not null"`
+	Severity string `gorm:"type:varchar(20);not null"` // info, warning, critical
+	Details  string `gorm:"type:text"`
+}
+
+// AuditEntry records a change to a user or profile, written by the model hooks
+type AuditEntry struct {
+	gorm.Model
+	Entity   string `gorm:"type:varchar(30);index;not null"` // user or user_profile
+	EntityID uint   `gorm:"index;not null"`
+	UserID   uint   `gorm:"index"`                     // the account the entity belongs to
+	ActorID  *uint  `gorm:"index"`                     // who made the change, when known
+	Action   string `gorm:"type:varchar(20);not null"` // update, delete or revoke_sessions
+	Changes  string `gorm:"type:text"`                 // JSON object of field: {from, to}
+}
+
+// CacheVersion is bumped whenever the data behind a cache key changes, so
+// cached representations can be validated against it
+type CacheVersion struct {
+	Key       string `gorm:"primary_key;type:varchar(100)"`
+	Version   int64  `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+// Webhook event delivery states
+const (
+	WebhookEventPending   = "pending"
+	WebhookEventDelivered = "delivered"
+	WebhookEventFailed    = "failed"
+)
+
+// WebhookEvent is the outbox of user lifecycle events: written in the same transaction
+// as the change it describes, and published afterwards by the relay job
+type WebhookEvent struct {
+	gorm.Model
+	Event       string `gorm:"type:varchar(50);index;not null"` // e.g. user.updated
+	UserID      uint   `gorm:"index"`
+	Payload     string `gorm:"type:text"`
+	Status      string `gorm:"type:varchar(20);index;not null"`
+	Attempts    int
+	DeliveredAt *time.Time
+	// NextAttemptAt is when a pending event is due, nil for the first attempt
+	NextAttemptAt *time.Time `gorm:"index"`
+	LastError     string     `gorm:"type:text"`
+}
+
+// Export job states
+const (
+	ExportPending   = "pending"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+)
+
+// Export kinds
+const (
+	ExportKindPersonal = "personal"  // a user's personal data archive
+	ExportKindUserList = "user_list" // the admin user list, shared by all admins
+)
+
+// ExportJob tracks the asynchronous generation of a user's personal data archive, or
+// a cached admin user list export
+type ExportJob struct {
+	gorm.Model
+	UserID      uint   `gorm:"index;not null"`                               // owner, or the admin who generated a user list
+	Kind        string `gorm:"type:varchar(20);not null;default:'personal'"` // personal or user_list
+	Fingerprint string `gorm:"type:varchar(64);index"`                       // user list exports: ETag of the data they contain
+	Format      string `gorm:"type:varchar(10);not null"`                    // json or csv
+	Status      string `gorm:"type:varchar(20);index;not null"`
+	StorageKey  string // archive location in the media storage backend
+	Size        int64
+	Rows        int    // user list exports: users included
+	Error       string `gorm:"type:text"`
+	CompletedAt *time.Time
+	ExpiresAt   *time.Time `gorm:"index"` // the archive is deleted after this
+}
+
+// User import modes
+const (
+	ImportModePassword = "password" // accounts are created and mailed a link to set their password
+	ImportModeInvite   = "invite"   // registration invitations are mailed instead
+)
+
+// ImportJob tracks a bulk user import. Its states are those of export jobs.
+type ImportJob struct {
+	gorm.Model
+	AdminID     uint   `gorm:"index;not null"`                  // who started the import
+	Format      string `gorm:"type:varchar(10);not null"`       // json or csv, of the upload and the report
+	Mode        string `gorm:"type:varchar(10);not null"`       // password or invite
+	Status      string `gorm:"type:varchar(20);index;not null"` // pending, running, completed or failed
+	SourceKey   string // uploaded file in the media storage backend, deleted once processed
+	ReportKey   string // per-row report
+	Rows        int
+	Succeeded   int
+	Failed      int
+	Error       string `gorm:"type:text"`
+	CompletedAt *time.Time
+	ExpiresAt   *time.Time `gorm:"index"` // the report is deleted after this
+}
+
+// Data subject access request types, states and dispositions
+const (
+	DSARTypeAccess        = "access"
+	DSARTypeErasure       = "erasure"
+	DSARTypeRectification = "rectification"
+
+	DSAROpen       = "open"
+	DSARInProgress = "in_progress"
+	DSARClosed     = "closed"
+
+	DSARFulfilled          = "fulfilled"
+	DSARPartiallyFulfilled = "partially_fulfilled"
+	DSARRejected           = "rejected"
+)
+
+// DSARRequest tracks a data subject request handled by admins against its legal deadline
+type DSARRequest struct {
+	gorm.Model
+	SubjectUserID   uint      `gorm:"index;not null"`
+	Type            string    `gorm:"type:varchar(20);not null"`
+	Status          string    `gorm:"type:varchar(20);index;not null"`
+	OpenedByID      uint      `gorm:"not null"`
+	ReceivedAt      time.Time `gorm:"not null"`
+	DueAt           time.Time `gorm:"index;not null"`
+	Notes           string    `gorm:"type:text"`
+	ExportJobID     *uint     // data package assembled for access requests
+	Disposition     string    `gorm:"type:varchar(30)"`
+	DispositionNote string    `gorm:"type:text"`
+	ClosedAt        *time.Time
+	LastReminderAt  *time.Time
+}
+
+// DSAREvent is one step in the evidence trail of a DSAR request
+type DSAREvent struct {
+	gorm.Model
+	RequestID uint   `gorm:"index;not null"`
+	ActorID   *uint  // nil for system actions such as reminders
+	Action    string `gorm:"type:varchar(30);not null"`
+	Details   string `gorm:"type:text"`
+}
+
+// NotificationPreferences holds which notification emails a user receives. Users
+// without a row get every notification.
+type NotificationPreferences struct {
+	gorm.Model
+	UserID          uint `gorm:"unique;not null"`
+	Welcome         bool
+	PasswordChanged bool
+	NewLogin        bool
+	RoleChanged     bool
+}
+
+// Interface themes a user can pick
+const (
+	ThemeSystem = "system"
+	ThemeLight  = "light"
+	ThemeDark   = "dark"
+)
+
+// UserSettings holds the account settings that live neither on the profile (locale and
+// timezone) nor in NotificationPreferences
+type UserSettings struct {
+	ID               uint   `gorm:"primary_key"`
+	UserID           uint   `gorm:"unique;not null"`
+	Theme            string `gorm:"type:varchar(10);not null"`
+	MarketingConsent bool
+	// MarketingConsentAt is when consent was last given or withdrawn
+	MarketingConsentAt *time.Time
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+// KnownLogin is an IP address and device a user has signed in from, used to detect new ones
+type KnownLogin struct {
+	gorm.Model
+	UserID     uint   `gorm:"unique_index:idx_known_login;not null"`
+	IPAddress  string `gorm:"type:varchar(64);unique_index:idx_known_login"`
+	UserAgent  string `gorm:"unique_index:idx_known_login"`
+	LastSeenAt time.Time
+}
+
+// TrustedDevice is a device a user signed in from and confirmed. Revoking it deletes
+// the row, so the device has to be confirmed again.
+type TrustedDevice struct {
+	ID          uint   `gorm:"primary_key"`
+	UserID      uint   `gorm:"unique_index:idx_trusted_device;not null"`
+	Fingerprint string `gorm:"type:varchar(64);unique_index:idx_trusted_device;not null"`
+	UserAgent   string `gorm:"type:text"`
+	IPAddress   string `gorm:"type:varchar(64)"` // of the latest sign-in
+	CreatedAt   time.Time
+	LastSeenAt  time.Time
+}
+
+// DeviceConfirmation is a single-use link, mailed on a sign-in from an unrecognized
+// device, that makes the device trusted
+type DeviceConfirmation struct {
+	gorm.Model
+	UserID      uint      `gorm:"index;not null"`
+	Fingerprint string    `gorm:"type:varchar(64);not null"`
+	UserAgent   string    `gorm:"type:text"`
+	IPAddress   string    `gorm:"type:varchar(64)"`
+	TokenDigest string    `gorm:"unique;not null"` // SHA-256 of the token in the link
+	ExpiresAt   time.Time `gorm:"not null"`
+	ConfirmedAt *time.Time
+}
+
+// ExternalLogin binds a user to the subject (LDAP DN or SAML NameID) an identity
+// provider knows them by; sign-ins through the provider find the user by it
+type ExternalLogin struct {
+	ID       uint   `gorm:"primary_key"`
+	UserID   uint   `gorm:"index;not null"`
+	Source   string `gorm:"type:varchar(20);unique_index:idx_external_login;not null"`
+	Provider string `gorm:"type:varchar(100);unique_index:idx_external_login;not null"`
+	Subject  string `gorm:"type:varchar(255);unique_index:idx_external_login;not null"`
+	// Provisioned is set when the provider created the account. Only then does the
+	// provider decide the user's role.
+	Provisioned bool `gorm:"not null;default:false"`
+	CreatedAt   time.Time
+}
+
+// ExternalLoginConfirmation is a single-use link, mailed to the holder of an existing
+// account when an identity provider vouches for its email, that binds the account to
+// the provider's subject
+type ExternalLoginConfirmation struct {
+	gorm.Model
+	UserID      uint      `gorm:"index;not null"`
+	Source      string    `gorm:"type:varchar(20);not null"`
+	Provider    string    `gorm:"type:varchar(100);not null"`
+	Subject     string    `gorm:"type:varchar(255);not null"`
+	IPAddress   string    `gorm:"type:varchar(64)"` // of the sign-in that asked for the link
+	TokenDigest string    `gorm:"unique;not null"`  // SHA-256 of the token in the link
+	ExpiresAt   time.Time `gorm:"not null"`
+	ConfirmedAt *time.Time
+}
+
+// PasswordReset is a single-use password reset link sent by email
+type PasswordReset struct {
+	gorm.Model
+	UserID      uint      `gorm:"index;not null"`
+	TokenDigest string    `gorm:"unique;not null"` // SHA-256 of the token in the link
+	ExpiresAt   time.Time `gorm:"not null"`
+	UsedAt      *time.Time
+	IPAddress   string `gorm:"type:varchar(64)"` // who asked for the link
+	UserAgent   string `gorm:"type:text"`
+}
+
+// PasswordSetAt returns when the current password was chosen
+func (u *User) PasswordSetAt() time.Time {
+	if u.PasswordChangedAt != nil {
+		return *u.PasswordChangedAt
+	}
+	return u.CreatedAt
+}
+
+// PasswordHistory keeps the hash of a password the user has had, so it cannot be reused
+type PasswordHistory struct {
+	ID           uint      `gorm:"primary_key"`
+	UserID       uint      `gorm:"index;not null"`
+	PasswordHash string    `gorm:"not null"`
+	CreatedAt    time.Time `gorm:"index"`
+}
+
+// AccountReactivation is a single-use link that reactivates a deactivated account or
+// restores one pending deletion. It is mailed when the account holder signs in, and
+// when they delete the account.
+type AccountReactivation struct {
+	gorm.Model
+	UserID      uint      `gorm:"index;not null"`
+	TokenDigest string    `gorm:"unique;not null"` // SHA-256 of the token in the link
+	ExpiresAt   time.Time `gorm:"not null"`
+	UsedAt      *time.Time
+}
+
+// EmailChange is a pending switch to a new email address. The address is only changed
+// once the single-use link sent to it is confirmed.
+type EmailChange struct {
+	gorm.Model
+	UserID      uint      `gorm:"index;not null"`
+	NewEmail    string    `gorm:"not null"`
+	TokenDigest string    `gorm:"unique;not null"` // SHA-256 of the token in the link
+	ExpiresAt   time.Time `gorm:"not null"`
+	ConfirmedAt *time.Time
+}
+
+// Report schedule frequencies
+const (
+	ReportWeekly  = "weekly"
+	ReportMonthly = "monthly"
+)
+
+// ReportSchedule emails a summary of the admin statistics on a recurring schedule
+type ReportSchedule struct {
+	gorm.Model
+	CreatedByID uint   `gorm:"not null"`
+	Frequency   string `gorm:"type:varchar(10);not null"`
+	Timezone    string `gorm:"type:varchar(64);not null"` // IANA name; Weekday, DayOfMonth and Hour are local to it
+	Weekday     int    // weekly reports, 0 = Sunday
+	DayOfMonth  int    // monthly reports, 1-28
+	Hour        int
+	Recipients  string    `gorm:"type:text;not null"` // comma separated email addresses
+	NextRunAt   time.Time `gorm:"index;not null"`
+	LastRunAt   *time.Time
+}
+
+// Roles of a member within an organization
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// Organization is a tenant. Users belong to organizations through memberships, and an
+// access token acts for at most one of them.
+type Organization struct {
+	gorm.Model
+	Name        string `gorm:"not null"`
+	Slug        string `gorm:"unique;not null"` // URL-safe identifier chosen at creation
+	CreatedByID uint   `gorm:"not null"`
+}
+
+// Membership grants a user a role in an organization. Rows are deleted, not soft
+// deleted, so a user who left can be invited again.
+type Membership struct {
+	ID             uint   `gorm:"primary_key"`
+	OrganizationID uint   `gorm:"unique_index:idx_membership;not null"`
+	UserID         uint   `gorm:"unique_index:idx_membership;index;not null"`
+	Role           string `gorm:"type:varchar(20);not null"` // owner, admin or member
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// OrganizationInvitation is a single-use link inviting an email address to join an
+// organization with a role
+type OrganizationInvitation struct {
+	gorm.Model
+	OrganizationID uint      `gorm:"index;not null"`
+	Email          string    `gorm:"not null"`
+	Role           string    `gorm:"type:varchar(20);not null"`
+	TokenDigest    string    `gorm:"unique;not null"` // SHA-256 of the token in the link
+	InvitedByID    uint      `gorm:"not null"`
+	ExpiresAt      time.Time `gorm:"not null"`
+	AcceptedAt     *time.Time
+	AcceptedByID   *uint
+}
+
+// OwnershipTransfer is an owner's single-use offer of their organization to another
+// member. The member becomes owner by accepting it before it expires, and the previous
+// owner stays on as an admin.
+type OwnershipTransfer struct {
+	gorm.Model
+	OrganizationID uint      `gorm:"index;not null"`
+	FromUserID     uint      `gorm:"not null"`
+	ToUserID       uint      `gorm:"index;not null"`
+	TokenDigest    string    `gorm:"unique;not null"` // SHA-256 of the token in the link
+	ExpiresAt      time.Time `gorm:"not null"`
+	AcceptedAt     *time.Time
+	CancelledAt    *time.Time // set when a later transfer replaces it
+}
+
+// RegistrationInvitation is a single-use link an admin sent to let an email address
+// register, optionally with a role other than "user"
+type RegistrationInvitation struct {
+	gorm.Model
+	Email          string    `gorm:"index;not null"`
+	Role           string    `gorm:"type:varchar(20);not null"`
+	TokenDigest    string    `gorm:"unique;not null"` // SHA-256 of the token in the link
+	InvitedByID    uint      `gorm:"not null"`
+	ExpiresAt      time.Time `gorm:"not null"`
+	AcceptedAt     *time.Time
+	AcceptedUserID *uint
+	RevokedAt      *time.Time
+}
+
+// Group is a named team of users, such as "support". Group names are embedded in
+// access tokens so this and downstream services can authorize by group.
+type Group struct {
+	ID          uint   `gorm:"primary_key"`
+	Name        string `gorm:"type:varchar(50);unique;not null"`
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// GroupMember puts a user in a group
+type GroupMember struct {
+	GroupID   uint `gorm:"primary_key;auto_increment:false"`
+	UserID    uint `gorm:"primary_key;auto_increment:false;index"`
+	CreatedAt time.Time
+}
+
+// IPRule allows or denies an address range on some routes. These rules are managed
+// through the admin API and apply together with those in the configuration file.
+type IPRule struct {
+	gorm.Model
+	Path        string `gorm:"type:varchar(255);not null"` // route template, "" for every route
+	Action      string `gorm:"type:varchar(10);not null"`  // allow or deny
+	CIDR        string `gorm:"type:varchar(50);not null"`
+	Description string `gorm:"type:varchar(255)"`
+	CreatedByID uint   `gorm:"not null"`
+}
+
+// LoginLocation is where a user last signed in from, as resolved by the GeoIP
+// database. It is compared with the next sign-in to detect impossible travel.
+type LoginLocation struct {
+	ID         uint   `gorm:"primary_key"`
+	UserID     uint   `gorm:"unique_index;not null"`
+	IPAddress  string `gorm:"type:varchar(64)"`
+	Country    string `gorm:"type:varchar(2)"` // ISO 3166-1 alpha-2
+	City       string
+	Latitude   *float64 // nil when the database has no coordinates
+	Longitude  *float64
+	SignedInAt time.Time `gorm:"not null"`
+}
+
+// LoginEvent records a successful sign-in, the source of the active user analytics.
+// Events are purged after analytics.loginEventRetentionDays, once aggregated.
+type LoginEvent struct {
+	ID        uint      `gorm:"primary_key"`
+	UserID    uint      `gorm:"index;not null"`
+	CreatedAt time.Time `gorm:"index;not null"`
+}
+
+// AnalyticsDay aggregates the accounts of one UTC day. Days are recomputed until the
+// day after they end and kept afterwards, so they outlive the login events.
+type AnalyticsDay struct {
+	Day               time.Time `gorm:"primary_key;type:date"`
+	ActiveUsers       int       // signed in that day
+	WeeklyActiveUsers int       // signed in during the seven days ending that day
+	Signups           int
+	Deletions         int // accounts deleted that day, the churn
+	TotalUsers        int // accounts at the end of the day
+	ComputedAt        time.Time
+}
+
+// AnalyticsCohort is how many of the users who signed up in one week signed in
+// WeekOffset weeks later. Weeks start on Monday, UTC.
+type AnalyticsCohort struct {
+	ID         uint      `gorm:"primary_key"`
+	CohortWeek time.Time `gorm:"unique_index:idx_analytics_cohort;not null"`
+	WeekOffset int       `gorm:"unique_index:idx_analytics_cohort;not null"`
+	Size       int       // signups of the cohort week
+	Retained   int
+	ComputedAt time.Time
+}
+
+// Types of custom user attributes
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+	AttributeEnum    = "enum"
+)
+
+// Access users have to the custom attributes of their own account
+const (
+	AttributeAccessNone  = "none" // only admins see and change the attribute
+	AttributeAccessRead  = "read"
+	AttributeAccessWrite = "write"
+)
+
+// AttributeDefinition declares a custom user attribute that integrators can store on
+// accounts without changing the model. Values are checked against its type.
+type AttributeDefinition struct {
+	ID          uint   `gorm:"primary_key"`
+	Key         string `gorm:"type:varchar(64);unique;not null"`
+	Type        string `gorm:"type:varchar(10);not null"`
+	Options     string `gorm:"type:text"` // comma separated values allowed by an enum
+	MaxLength   int    // longest string value, 0 for the default
+	UserAccess  string `gorm:"type:varchar(10);not null"`
+	Description string `gorm:"type:varchar(255)"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// UserAttribute is a user's value of a custom attribute, stored as text in the
+// canonical form of its type so that it can be compared in filters
+type UserAttribute struct {
+	UserID    uint   `gorm:"primary_key;auto_increment:false"`
+	Key       string `gorm:"primary_key;type:varchar(64)"`
+	Value     string `gorm:"type:text;not null"`
+	UpdatedAt time.Time
+}
+
+// FeatureFlag turns a feature on for a share of users, so clients and handlers can
+// roll it out gradually. RolePercentages overrides Percentage for the listed roles.
+type FeatureFlag struct {
+	ID          uint   `gorm:"primary_key"`
+	Key         string `gorm:"type:varchar(64);unique;not null"`
+	Description string `gorm:"type:varchar(255)"`
+	Enabled     bool   `gorm:"not null"` // off turns the flag off for everyone
+	Percentage  int    `gorm:"not null"` // share of users the flag is on for, 0-100
+	// RolePercentages are comma separated role=percentage rules
+	RolePercentages string `gorm:"type:text"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
 }
@@ -0,0 +1,283 @@
+// Package proxyproto accepts connections carrying a PROXY protocol (v1 or v2) header,
+// as sent by TCP load balancers such as HAProxy or AWS NLB, and reports the original
+// client address as the connection's remote address.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy decides how PROXY headers are handled on a listener
+type Policy string
+
+const (
+	// PolicyOff never looks for a header; the connection's peer is the client
+	PolicyOff Policy = "off"
+	// PolicyOptional uses a header from a trusted proxy when one is sent
+	PolicyOptional Policy = "optional"
+	// PolicyRequired closes connections from trusted proxies that send no header
+	PolicyRequired Policy = "required"
+)
+
+var (
+	ErrNoHeader      = errors.New("proxyproto: missing PROXY header")
+	ErrInvalidHeader = errors.New("proxyproto: invalid PROXY header")
+)
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// v1 headers are at most 107 bytes including the CRLF
+const v1MaxLength = 107
+
+// Config configures a Listener
+type Config struct {
+	Policy Policy
+	// TrustedProxies lists the CIDRs allowed to send a header. Headers from other
+	// peers are not parsed, so clients cannot spoof their address. Empty trusts every peer.
+	TrustedProxies []string
+	// HeaderTimeout bounds how long a new connection may take to send its header
+	HeaderTimeout time.Duration
+}
+
+// ParsePolicy validates a policy name; "" means off
+func ParsePolicy(name string) (Policy, error) {
+	switch Policy(name) {
+	case "", PolicyOff:
+		return PolicyOff, nil
+	case PolicyOptional, PolicyRequired:
+		return Policy(name), nil
+	}
+	return "", fmt.Errorf("unknown proxy protocol policy %q", name)
+}
+
+// Listener wraps a net.Listener and strips PROXY headers from accepted connections
+type Listener struct {
+	net.Listener
+	policy  Policy
+	trusted []*net.IPNet
+	timeout time.Duration
+}
+
+// NewListener wraps inner according to cfg
+func NewListener(inner net.Listener, cfg Config) (*Listener, error) {
+	l := &Listener{
+		Listener: inner,
+		policy:   cfg.Policy,
+		timeout:  cfg.HeaderTimeout,
+	}
+	if l.policy == "" {
+		l.policy = PolicyOff
+	}
+	if l.timeout <= 0 {
+		l.timeout = 5 * time.Second
+	}
+	for _, cidr := range cfg.TrustedProxies {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", cidr, err)
+		}
+		l.trusted = append(l.trusted, network)
+	}
+	return l, nil
+}
+
+// Accept returns the next connection. The header is read lazily on first use so a
+// slow peer cannot stall the accept loop.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if l.policy == PolicyOff || !l.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &Conn{
+		Conn:     conn,
+		reader:   bufio.NewReader(conn),
+		required: l.policy == PolicyRequired,
+		timeout:  l.timeout,
+	}, nil
+}
+
+func (l *Listener) isTrusted(addr net.Addr) bool {
+	if len(l.trusted) == 0 {
+		return true
+	}
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, network := range l.trusted {
+		if network.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is a connection from a trusted proxy whose header has been or will be consumed
+type Conn struct {
+	net.Conn
+	reader   *bufio.Reader
+	required bool
+	timeout  time.Duration
+
+	once       sync.Once
+	err        error
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+// Read reads from the connection after the PROXY header
+func (c *Conn) Read(b []byte) (int, error) {
+	if err := c.readHeader(); err != nil {
+		return 0, err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the original client address when the proxy sent one
+func (c *Conn) RemoteAddr() net.Addr {
+	if c.readHeader() == nil && c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to when the proxy sent one
+func (c *Conn) LocalAddr() net.Addr {
+	if c.readHeader() == nil && c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *Conn) readHeader() error {
+	c.once.Do(func() {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+			c.err = err
+			return
+		}
+		c.remoteAddr, c.localAddr, c.err = parseHeader(c.reader, c.required)
+		if err := c.Conn.SetReadDeadline(time.Time{}); err != nil && c.err == nil {
+			c.err = err
+		}
+		if c.err != nil {
+			c.Conn.Close()
+		}
+	})
+	return c.err
+}
+
+// parseHeader consumes a v1 or v2 header from r. It returns nil addresses when there
+// is no header (and it is optional) or the proxy reports a local/unknown connection.
+func parseHeader(r *bufio.Reader, required bool) (net.Addr, net.Addr, error) {
+	peek, err := r.Peek(len(v2Signature))
+	switch {
+	case err == nil && bytes.Equal(peek, v2Signature):
+		return parseV2(r)
+	case len(peek) >= 6 && string(peek[:6]) == "PROXY ":
+		return parseV1(r)
+	case required:
+		return nil, nil, ErrNoHeader
+	case err != nil && len(peek) == 0:
+		return nil, nil, err
+	}
+	return nil, nil, nil
+}
+
+func parseV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, ErrInvalidHeader
+	}
+	src, err := v1Addr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := v1Addr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func v1Addr(ip, port string) (*net.TCPAddr, error) {
+	parsedIP := net.ParseIP(ip)
+	parsedPort, err := strconv.ParseUint(port, 10, 16)
+	if parsedIP == nil || err != nil {
+		return nil, ErrInvalidHeader
+	}
+	return &net.TCPAddr{IP: parsedIP, Port: int(parsedPort)}, nil
+}
+
+func parseV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	version, command := header[12]>>4, header[12]&0x0f
+	if version != 2 || command > 1 {
+		return nil, nil, ErrInvalidHeader
+	}
+	family := header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+
+	// LOCAL: health checks from the proxy itself
+	if command == 0 {
+		return nil, nil, nil
+	}
+
+	var ipLen int
+	switch family {
+	case 0x11: // TCP over IPv4
+		ipLen = net.IPv4len
+	case 0x21: // TCP over IPv6
+		ipLen = net.IPv6len
+	default: // UDP and unix sockets carry no usable TCP address
+		return nil, nil, nil
+	}
+	if len(payload) < 2*ipLen+4 {
+		return nil, nil, ErrInvalidHeader
+	}
+	src := &net.TCPAddr{
+		IP:   net.IP(payload[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+	}
+	dst := &net.TCPAddr{
+		IP:   net.IP(payload[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:])),
+	}
+	return src, dst, nil
+}
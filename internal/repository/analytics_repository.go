@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// AnalyticsRepository records sign-ins and keeps the aggregated growth and retention
+// figures. Periods are half-open, [from, to).
+type AnalyticsRepository interface {
+	RecordLogin(userID uint, at time.Time) error
+	PurgeLoginEvents(before time.Time) (int64, error)
+
+	// CountActive counts the distinct users who signed in during the period
+	CountActive(from, to time.Time) (int, error)
+	// CountSignups counts the accounts created during the period, deleted ones included
+	CountSignups(from, to time.Time) (int, error)
+	CountDeletions(from, to time.Time) (int, error)
+	// CountUsers counts accounts that existed at t
+	CountUsers(t time.Time) (int, error)
+	// CountRetained counts the users created during the signup period who signed in
+	// during the activity period
+	CountRetained(signupFrom, signupTo, activeFrom, activeTo time.Time) (int, error)
+
+	SaveDay(day *models.AnalyticsDay) error
+	// LatestDay returns the most recent aggregated day, nil before the first aggregation
+	LatestDay() (*models.AnalyticsDay, error)
+	ListDays(from, to time.Time) ([]models.AnalyticsDay, error)
+	SaveCohort(cohort *models.AnalyticsCohort) error
+	// ListCohorts returns the cohorts of the weeks starting in the period, by week and offset
+	ListCohorts(from, to time.Time) ([]models.AnalyticsCohort, error)
+}
+
+type gormAnalyticsRepository struct {
+	db *gorm.DB
+}
+
+func NewAnalyticsRepository(db *gorm.DB) AnalyticsRepository {
+	return &gormAnalyticsRepository{db: db}
+}
+
+func (r *gormAnalyticsRepository) RecordLogin(userID uint, at time.Time) error {
+	return r.db.Create(&models.LoginEvent{UserID: userID, CreatedAt: at}).Error
+}
+
+func (r *gormAnalyticsRepository) PurgeLoginEvents(before time.Time) (int64, error) {
+	result := r.db.Where("created_at < ?", before).Delete(&models.LoginEvent{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *gormAnalyticsRepository) CountActive(from, to time.Time) (int, error) {
+	var count int
+	err := r.db.Model(&models.LoginEvent{}).
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Select("COUNT(DISTINCT user_id)").Row().Scan(&count)
+	return count, err
+}
+
+func (r *gormAnalyticsRepository) CountSignups(from, to time.Time) (int, error) {
+	var count int
+	err := r.db.Unscoped().Model(&models.User{}).Where("created_at >= ? AND created_at < ?", from, to).Count(&count).Error
+	return count, err
+}
+
+func (r *gormAnalyticsRepository) CountDeletions(from, to time.Time) (int, error) {
+	var count int
+	err := r.db.Unscoped().Model(&models.User{}).Where("deleted_at >= ? AND deleted_at < ?", from, to).Count(&count).Error
+	return count, err
+}
+
+func (r *gormAnalyticsRepository) CountUsers(t time.Time) (int, error) {
+	var count int
+	err := r.db.Unscoped().Model(&models.User{}).
+		Where("created_at < ? AND (deleted_at IS NULL OR deleted_at >= ?)", t, t).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormAnalyticsRepository) CountRetained(signupFrom, signupTo, activeFrom, activeTo time.Time) (int, error) {
+	var count int
+	err := r.db.Table("login_events").
+		Joins("JOIN users ON users.id = login_events.user_id").
+		Where("users.created_at >= ? AND users.created_at < ?", signupFrom, signupTo).
+		Where("login_events.created_at >= ? AND login_events.created_at < ?", activeFrom, activeTo).
+		Select("COUNT(DISTINCT login_events.user_id)").Row().Scan(&count)
+	return count, err
+}
+
+func (r *gormAnalyticsRepository) SaveDay(day *models.AnalyticsDay) error {
+	return r.db.Save(day).Error
+}
+
+func (r *gormAnalyticsRepository) LatestDay() (*models.AnalyticsDay, error) {
+	var day models.AnalyticsDay
+	err := r.db.Order("day DESC").First(&day).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &day, nil
+}
+
+func (r *gormAnalyticsRepository) ListDays(from, to time.Time) ([]models.AnalyticsDay, error) {
+	var days []models.AnalyticsDay
+	err := r.db.Where("day >= ? AND day < ?", from, to).Order("day").Find(&days).Error
+	return days, err
+}
+
+func (r *gormAnalyticsRepository) SaveCohort(cohort *models.AnalyticsCohort) error {
+	// Maps, as structs leave out zero values such as week 0 or nobody retained
+	return r.db.Where("cohort_week = ? AND week_offset = ?", cohort.CohortWeek, cohort.WeekOffset).
+		Assign(map[string]interface{}{
+			"size":        cohort.Size,
+			"retained":    cohort.Retained,
+			"computed_at": cohort.ComputedAt,
+		}).
+		FirstOrCreate(cohort).Error
+}
+
+func (r *gormAnalyticsRepository) ListCohorts(from, to time.Time) ([]models.AnalyticsCohort, error) {
+	var cohorts []models.AnalyticsCohort
+	err := r.db.Where("cohort_week >= ? AND cohort_week < ?", from, to).Order("cohort_week, week_offset").Find(&cohorts).Error
+	return cohorts, err
+}
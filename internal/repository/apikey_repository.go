@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// APIKeyRepository stores hashed API keys
+type APIKeyRepository interface {
+	Create(key *models.APIKey) error
+	FindByHash(keyHash string) (*models.APIKey, error)
+	ListByUser(userID uint) ([]models.APIKey, error)
+	DeleteForUser(userID, id uint) (bool, error)
+	TouchLastUsed(id uint, at time.Time) error
+	FindByID(id uint) (*models.APIKey, error)
+	Suspend(id uint, reason string) error
+	// Usage tracking for anomaly detection
+	SaveHourlyUsage(keyID uint, hour time.Time, requests int) error
+	AverageHourlyUsage(keyID uint, since, before time.Time) (float64, error)
+	ListFingerprints(keyID uint) ([]models.APIKeyFingerprint, error)
+	AddFingerprint(fp *models.APIKeyFingerprint) error
+}
+
+type gormAPIKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &gormAPIKeyRepository{db: db}
+}
+
+func (r *gormAPIKeyRepository) Create(key *models.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *gormAPIKeyRepository) FindByHash(keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.Where("key_hash = ?", keyHash).First(&key).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &key, nil
+}
+
+func (r *gormAPIKeyRepository) ListByUser(userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *gormAPIKeyRepository) DeleteForUser(userID, id uint) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.APIKey{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormAPIKeyRepository) TouchLastUsed(id uint, at time.Time) error {
+	return r.db.Model(&models.APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
+
+func (r *gormAPIKeyRepository) FindByID(id uint) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.First(&key, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &key, nil
+}
+
+func (r *gormAPIKeyRepository) Suspend(id uint, reason string) error {
+	return r.db.Model(&models.APIKey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"suspended_at":   time.Now(),
+		"suspend_reason": reason,
+	}).Error
+}
+
+func (r *gormAPIKeyRepository) SaveHourlyUsage(keyID uint, hour time.Time, requests int) error {
+	var usage models.APIKeyUsage
+	err := r.db.Where("api_key_id = ? AND hour = ?", keyID, hour).First(&usage).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return r.db.Create(&models.APIKeyUsage{APIKeyID: keyID, Hour: hour, Requests: requests}).Error
+	}
+	if err != nil {
+		return err
+	}
+	return r.db.Model(&usage).Update("requests", requests).Error
+}
+
+func (r *gormAPIKeyRepository) AverageHourlyUsage(keyID uint, since, before time.Time) (float64, error) {
+	var avg struct{ Value *float64 }
+	err := r.db.Model(&models.APIKeyUsage{}).
+		Select("AVG(requests) AS value").
+		Where("api_key_id = ? AND hour >= ? AND hour < ?", keyID, since, before).
+		Scan(&avg).Error
+	if err != nil || avg.Value == nil {
+		return 0, err
+	}
+	return *avg.Value, nil
+}
+
+func (r *gormAPIKeyRepository) ListFingerprints(keyID uint) ([]models.APIKeyFingerprint, error) {
+	var fps []models.APIKeyFingerprint
+	if err := r.db.Where("api_key_id = ?", keyID).Find(&fps).Error; err != nil {
+		return nil, err
+	}
+	return fps, nil
+}
+
+func (r *gormAPIKeyRepository) AddFingerprint(fp *models.APIKeyFingerprint) error {
+	return r.db.Create(fp).Error
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"api/internal/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// AttributeRepository stores custom attribute definitions and the users' values
+type AttributeRepository interface {
+	// ListDefinitions returns every definition by key
+	ListDefinitions() ([]models.AttributeDefinition, error)
+	FindDefinition(key string) (*models.AttributeDefinition, error)
+	// SaveDefinition creates or updates the definition
+	SaveDefinition(definition *models.AttributeDefinition) error
+	// DeleteDefinition removes the definition and every user's value of it
+	DeleteDefinition(definition *models.AttributeDefinition) error
+	// CountValues returns the number of users with a value for key
+	CountValues(key string) (int, error)
+	// ListForUser returns the user's values
+	ListForUser(userID uint) ([]models.UserAttribute, error)
+	// SetForUser stores the values of set and removes the keys in remove, all or nothing
+	SetForUser(userID uint, set map[string]string, remove []string) error
+}
+
+type gormAttributeRepository struct {
+	db *gorm.DB
+}
+
+func NewAttributeRepository(db *gorm.DB) AttributeRepository {
+	return &gormAttributeRepository{db: db}
+}
+
+func (r *gormAttributeRepository) ListDefinitions() ([]models.AttributeDefinition, error) {
+	var definitions []models.AttributeDefinition
+	err := r.db.Order(`"key"`).Find(&definitions).Error
+	return definitions, err
+}
+
+func (r *gormAttributeRepository) FindDefinition(key string) (*models.AttributeDefinition, error) {
+	var definition models.AttributeDefinition
+	if err := r.db.Where(`"key" = ?`, key).First(&definition).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &definition, nil
+}
+
+func (r *gormAttributeRepository) SaveDefinition(definition *models.AttributeDefinition) error {
+	return translateError(r.db.Save(definition).Error)
+}
+
+func (r *gormAttributeRepository) DeleteDefinition(definition *models.AttributeDefinition) error {
+	tx := r.db.Begin()
+	if err := tx.Where(`"key" = ?`, definition.Key).Delete(&models.UserAttribute{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(definition).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func (r *gormAttributeRepository) CountValues(key string) (int, error) {
+	var count int
+	err := r.db.Model(&models.UserAttribute{}).Where(`"key" = ?`, key).Count(&count).Error
+	return count, err
+}
+
+func (r *gormAttributeRepository) ListForUser(userID uint) ([]models.UserAttribute, error) {
+	var attributes []models.UserAttribute
+	err := r.db.Where("user_id = ?", userID).Order(`"key"`).Find(&attributes).Error
+	return attributes, err
+}
+
+func (r *gormAttributeRepository) SetForUser(userID uint, set map[string]string, remove []string) error {
+	tx := r.db.Begin()
+	for key, value := range set {
+		if err := tx.Save(&models.UserAttribute{UserID: userID, Key: key, Value: value}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		if err := tx.Where(`user_id = ? AND "key" IN (?)`, userID, remove).Delete(&models.UserAttribute{}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"api/internal/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// AuditRepository reads the audit entries written by the model hooks and records
+// actions that do not change a model, such as ending a user's sessions
+type AuditRepository interface {
+	Create(entry *models.AuditEntry) error
+	ListByUser(userID uint) ([]models.AuditEntry, error)
+	// ListRecentByUser returns the user's latest entries, newest first
+	ListRecentByUser(userID uint, limit int) ([]models.AuditEntry, error)
+}
+
+type gormAuditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &gormAuditRepository{db: db}
+}
+
+func (r *gormAuditRepository) Create(entry *models.AuditEntry) error {
+	return r.db.Create(entry).Error
+}
+
+func (r *gormAuditRepository) ListByUser(userID uint) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	if err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *gormAuditRepository) ListRecentByUser(userID uint, limit int) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	if err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Limit(limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxPingBackoff caps the wait between pings while the database is unreachable
+const maxPingBackoff = time.Minute
+
+// DBMonitor pings the database periodically so an outage is noticed, and recovered
+// from, without waiting for a request to fail. database/sql opens new connections on
+// demand, so reconnecting amounts to dropping the idle ones that died with the server.
+type DBMonitor struct {
+	db       *sql.DB
+	maxIdle  int
+	interval time.Duration
+	timeout  time.Duration
+	logger   *logrus.Logger
+
+	mu        sync.RWMutex
+	healthy   bool
+	lastError error
+	failures  int
+}
+
+// NewDBMonitor creates a monitor pinging every interval; maxIdle is the configured idle
+// connection limit, restored after the idle connections are dropped
+func NewDBMonitor(db *sql.DB, maxIdle int, interval time.Duration, logger *logrus.Logger) *DBMonitor {
+	return &DBMonitor{
+		db:       db,
+		maxIdle:  maxIdle,
+		interval: interval,
+		timeout:  5 * time.Second,
+		logger:   logger,
+		healthy:  true,
+	}
+}
+
+// Healthy reports the result of the last ping and its error
+func (m *DBMonitor) Healthy() (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.healthy, m.lastError
+}
+
+// Check pings the database once and returns the wait before the next check: the
+// interval while healthy, backing off exponentially while it is not
+func (m *DBMonitor) Check(ctx context.Context) time.Duration {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	err := m.db.PingContext(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastError = err
+	if err == nil {
+		if !m.healthy {
+			m.logger.WithField("failures", m.failures).Info("Database connection restored")
+		}
+		m.healthy, m.failures = true, 0
+		return m.interval
+	}
+
+	m.failures++
+	if m.healthy {
+		m.logger.WithError(err).Error("Database unreachable")
+	} else {
+		m.logger.WithError(err).WithField("failures", m.failures).Warn("Database still unreachable")
+	}
+	m.healthy = false
+	// Connections idle in the pool are most likely dead; let the next use open fresh ones
+	m.db.SetMaxIdleConns(0)
+	m.db.SetMaxIdleConns(m.maxIdle)
+
+	delay := m.interval
+	for i := 1; i < m.failures && delay < maxPingBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxPingBackoff)
+}
+
+// Run checks the database until stop is closed
+func (m *DBMonitor) Run(stop <-chan struct{}) {
+	timer := time.NewTimer(m.interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+			timer.Reset(m.Check(context.Background()))
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DeviceRepository stores the devices users trust and the links confirming new ones
+type DeviceRepository interface {
+	FindTrusted(userID uint, fingerprint string) (*models.TrustedDevice, error)
+	CountTrusted(userID uint) (int, error)
+	// ListTrusted returns the user's trusted devices, most recently seen first
+	ListTrusted(userID uint) ([]models.TrustedDevice, error)
+	// Trust adds the device, or refreshes it when the user already trusts it
+	Trust(device *models.TrustedDevice) error
+	// Touch records a sign-in from a trusted device
+	Touch(device *models.TrustedDevice, ip string, now time.Time) error
+	// DeleteTrusted removes one of the user's devices; false means there was none with that ID
+	DeleteTrusted(userID, deviceID uint) (bool, error)
+	CreateConfirmation(confirmation *models.DeviceConfirmation) error
+	FindConfirmationByDigest(digest string) (*models.DeviceConfirmation, error)
+	// Confirm claims an unconfirmed link and trusts its device in one transaction;
+	// false means the link was already used
+	Confirm(confirmation *models.DeviceConfirmation, device *models.TrustedDevice, now time.Time) (bool, error)
+	CountConfirmationsSince(userID uint, since time.Time) (int, error)
+}
+
+type gormDeviceRepository struct {
+	db *gorm.DB
+}
+
+func NewDeviceRepository(db *gorm.DB) DeviceRepository {
+	return &gormDeviceRepository{db: db}
+}
+
+func (r *gormDeviceRepository) FindTrusted(userID uint, fingerprint string) (*models.TrustedDevice, error) {
+	var device models.TrustedDevice
+	if err := r.db.Where("user_id = ? AND fingerprint = ?", userID, fingerprint).First(&device).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &device, nil
+}
+
+func (r *gormDeviceRepository) CountTrusted(userID uint) (int, error) {
+	var count int
+	err := r.db.Model(&models.TrustedDevice{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *gormDeviceRepository) ListTrusted(userID uint) ([]models.TrustedDevice, error) {
+	var devices []models.TrustedDevice
+	err := r.db.Where("user_id = ?", userID).Order("last_seen_at DESC, id DESC").Find(&devices).Error
+	return devices, err
+}
+
+func (r *gormDeviceRepository) Trust(device *models.TrustedDevice) error {
+	return trustDevice(r.db, device)
+}
+
+// trustDevice inserts device, or updates the user's existing row for the fingerprint
+func trustDevice(db *gorm.DB, device *models.TrustedDevice) error {
+	return db.Where(models.TrustedDevice{UserID: device.UserID, Fingerprint: device.Fingerprint}).
+		Assign(models.TrustedDevice{UserAgent: device.UserAgent, IPAddress: device.IPAddress, LastSeenAt: device.LastSeenAt}).
+		FirstOrCreate(device).Error
+}
+
+func (r *gormDeviceRepository) Touch(device *models.TrustedDevice, ip string, now time.Time) error {
+	return r.db.Model(device).Updates(map[string]interface{}{"ip_address": ip, "last_seen_at": now}).Error
+}
+
+func (r *gormDeviceRepository) DeleteTrusted(userID, deviceID uint) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", deviceID, userID).Delete(&models.TrustedDevice{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *gormDeviceRepository) CreateConfirmation(confirmation *models.DeviceConfirmation) error {
+	return r.db.Create(confirmation).Error
+}
+
+func (r *gormDeviceRepository) FindConfirmationByDigest(digest string) (*models.DeviceConfirmation, error) {
+	var confirmation models.DeviceConfirmation
+	if err := r.db.Where("token_digest = ?", digest).First(&confirmation).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &confirmation, nil
+}
+
+func (r *gormDeviceRepository) Confirm(confirmation *models.DeviceConfirmation, device *models.TrustedDevice, now time.Time) (bool, error) {
+	tx := r.db.Begin()
+	result := tx.Model(&models.DeviceConfirmation{}).
+		Where("id = ? AND confirmed_at IS NULL", confirmation.ID).
+		Update("confirmed_at", now)
+	if result.Error != nil {
+		tx.Rollback()
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+	if err := trustDevice(tx, device); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+	confirmation.ConfirmedAt = &now
+	return true, nil
+}
+
+func (r *gormDeviceRepository) CountConfirmationsSince(userID uint, since time.Time) (int, error) {
+	var count int
+	err := r.db.Model(&models.DeviceConfirmation{}).Where("user_id = ? AND created_at > ?", userID, since).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DSARRepository stores data subject requests and their evidence trail
+type DSARRepository interface {
+	Create(request *models.DSARRequest) error
+	Save(request *models.DSARRequest) error
+	FindByID(id uint) (*models.DSARRequest, error)
+	// List returns requests ordered by deadline, filtered by status unless it is empty
+	List(status string) ([]models.DSARRequest, error)
+	// ListDueBefore returns unclosed requests due before t
+	ListDueBefore(t time.Time) ([]models.DSARRequest, error)
+	AddEvent(event *models.DSAREvent) error
+	ListEvents(requestID uint) ([]models.DSAREvent, error)
+}
+
+type gormDSARRepository struct {
+	db *gorm.DB
+}
+
+func NewDSARRepository(db *gorm.DB) DSARRepository {
+	return &gormDSARRepository{db: db}
+}
+
+func (r *gormDSARRepository) Create(request *models.DSARRequest) error {
+	return r.db.Create(request).Error
+}
+
+func (r *gormDSARRepository) Save(request *models.DSARRequest) error {
+	return r.db.Save(request).Error
+}
+
+func (r *gormDSARRepository) FindByID(id uint) (*models.DSARRequest, error) {
+	var request models.DSARRequest
+	if err := r.db.First(&request, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &request, nil
+}
+
+func (r *gormDSARRepository) List(status string) ([]models.DSARRequest, error) {
+	query := r.db.Order("due_at")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var requests []models.DSARRequest
+	if err := query.Find(&requests).Error; err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func (r *gormDSARRepository) ListDueBefore(t time.Time) ([]models.DSARRequest, error) {
+	var requests []models.DSARRequest
+	if err := r.db.Where("status <> ? AND due_at < ?", models.DSARClosed, t).Order("due_at").Find(&requests).Error; err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func (r *gormDSARRepository) AddEvent(event *models.DSAREvent) error {
+	return r.db.Create(event).Error
+}
+
+func (r *gormDSARRepository) ListEvents(requestID uint) ([]models.DSAREvent, error) {
+	var events []models.DSAREvent
+	if err := r.db.Where("request_id = ?", requestID).Order("created_at, id").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// EmailChangeRepository stores pending email address changes
+type EmailChangeRepository interface {
+	// Create stores change and drops the user's earlier pending changes, so only the
+	// newest link works
+	Create(change *models.EmailChange) error
+	FindByDigest(digest string) (*models.EmailChange, error)
+	// MarkConfirmed claims an unconfirmed change; false means it was already used
+	MarkConfirmed(change *models.EmailChange, now time.Time) (bool, error)
+}
+
+type gormEmailChangeRepository struct {
+	db *gorm.DB
+}
+
+func NewEmailChangeRepository(db *gorm.DB) EmailChangeRepository {
+	return &gormEmailChangeRepository{db: db}
+}
+
+func (r *gormEmailChangeRepository) Create(change *models.EmailChange) error {
+	tx := r.db.Begin()
+	if err := tx.Unscoped().Where("user_id = ? AND confirmed_at IS NULL", change.UserID).Delete(&models.EmailChange{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Create(change).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func (r *gormEmailChangeRepository) FindByDigest(digest string) (*models.EmailChange, error) {
+	var change models.EmailChange
+	if err := r.db.Where("token_digest = ?", digest).First(&change).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &change, nil
+}
+
+func (r *gormEmailChangeRepository) MarkConfirmed(change *models.EmailChange, now time.Time) (bool, error) {
+	result := r.db.Model(&models.EmailChange{}).
+		Where("id = ? AND confirmed_at IS NULL", change.ID).
+		Update("confirmed_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	change.ConfirmedAt = &now
+	return true, nil
+}
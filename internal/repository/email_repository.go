@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// EmailEventCount is the number of distinct messages per template and event
+type EmailEventCount struct {
+	Template string
+	Event    string
+	Count    int
+}
+
+// EmailEventRepository stores email deliverability events
+type EmailEventRepository interface {
+	Create(event *models.EmailEvent) error
+	FindSent(messageID string) (*models.EmailEvent, error)
+	// CountByTemplate aggregates events created after since (zero time means all)
+	CountByTemplate(since time.Time) ([]EmailEventCount, error)
+	ListByRecipient(recipient string) ([]models.EmailEvent, error)
+}
+
+type gormEmailEventRepository struct {
+	db *gorm.DB
+}
+
+func NewEmailEventRepository(db *gorm.DB) EmailEventRepository {
+	return &gormEmailEventRepository{db: db}
+}
+
+func (r *gormEmailEventRepository) Create(event *models.EmailEvent) error {
+	return r.db.Create(event).Error
+}
+
+func (r *gormEmailEventRepository) FindSent(messageID string) (*models.EmailEvent, error) {
+	var event models.EmailEvent
+	if err := r.db.Where("message_id = ? AND event = ?", messageID, models.EmailEventSent).First(&event).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &event, nil
+}
+
+func (r *gormEmailEventRepository) CountByTemplate(since time.Time) ([]EmailEventCount, error) {
+	query := r.db.Model(&models.EmailEvent{})
+	if !since.IsZero() {
+		query = query.Where("created_at >= ?", since)
+	}
+
+	// Count distinct messages so repeated provider notifications are not double counted
+	rows, err := query.Select("template, event, COUNT(DISTINCT message_id)").Group("template, event").Order("template").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []EmailEventCount
+	for rows.Next() {
+		var c EmailEventCount
+		if err := rows.Scan(&c.Template, &c.Event, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+func (r *gormEmailEventRepository) ListByRecipient(recipient string) ([]models.EmailEvent, error) {
+	var events []models.EmailEvent
+	if err := r.db.Where("recipient = ?", recipient).Order("created_at").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ExportJobRepository stores personal data export jobs and cached user list exports
+type ExportJobRepository interface {
+	Create(job *models.ExportJob) error
+	Save(job *models.ExportJob) error
+	FindForUser(userID, id uint) (*models.ExportJob, error)
+	// FindReusable returns an unfinished or still downloadable job of the same format
+	FindReusable(userID uint, format string, now time.Time) (*models.ExportJob, error)
+	ListUnfinished() ([]models.ExportJob, error)
+	// FindUserList returns an unexpired user list export of the data identified by fingerprint
+	FindUserList(fingerprint, format string, now time.Time) (*models.ExportJob, error)
+	ListExpired(now time.Time) ([]models.ExportJob, error)
+	Delete(job *models.ExportJob) error
+}
+
+type gormExportJobRepository struct {
+	db *gorm.DB
+}
+
+func NewExportJobRepository(db *gorm.DB) ExportJobRepository {
+	return &gormExportJobRepository{db: db}
+}
+
+func (r *gormExportJobRepository) Create(job *models.ExportJob) error {
+	return r.db.Create(job).Error
+}
+
+func (r *gormExportJobRepository) Save(job *models.ExportJob) error {
+	return r.db.Save(job).Error
+}
+
+func (r *gormExportJobRepository) FindForUser(userID, id uint) (*models.ExportJob, error) {
+	var job models.ExportJob
+	if err := r.db.Where("id = ? AND user_id = ? AND kind = ?", id, userID, models.ExportKindPersonal).First(&job).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &job, nil
+}
+
+func (r *gormExportJobRepository) FindReusable(userID uint, format string, now time.Time) (*models.ExportJob, error) {
+	var job models.ExportJob
+	err := r.db.Where("user_id = ? AND kind = ? AND format = ?", userID, models.ExportKindPersonal, format).
+		Where("status IN (?) OR (status = ? AND expires_at > ?)",
+			[]string{models.ExportPending, models.ExportRunning}, models.ExportCompleted, now).
+		Order("created_at DESC").
+		First(&job).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &job, nil
+}
+
+func (r *gormExportJobRepository) ListUnfinished() ([]models.ExportJob, error) {
+	var jobs []models.ExportJob
+	if err := r.db.Where("status IN (?)", []string{models.ExportPending, models.ExportRunning}).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (r *gormExportJobRepository) FindUserList(fingerprint, format string, now time.Time) (*models.ExportJob, error) {
+	var job models.ExportJob
+	err := r.db.Where("kind = ? AND fingerprint = ? AND format = ? AND status = ? AND expires_at > ?",
+		models.ExportKindUserList, fingerprint, format, models.ExportCompleted, now).
+		Order("created_at DESC").
+		First(&job).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &job, nil
+}
+
+func (r *gormExportJobRepository) ListExpired(now time.Time) ([]models.ExportJob, error) {
+	var jobs []models.ExportJob
+	if err := r.db.Where("expires_at <= ?", now).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (r *gormExportJobRepository) Delete(job *models.ExportJob) error {
+	return r.db.Unscoped().Delete(job).Error
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ExternalLoginRepository stores the bindings of users to identity provider subjects
+// and the links confirming new ones
+type ExternalLoginRepository interface {
+	Find(source, provider, subject string) (*models.ExternalLogin, error)
+	Delete(login *models.ExternalLogin) error
+	// Provision creates a user together with the binding to the provider that vouched
+	// for them, so a failed binding leaves no account behind
+	Provision(user *models.User, login *models.ExternalLogin) error
+	CreateConfirmation(confirmation *models.ExternalLoginConfirmation) error
+	FindConfirmationByDigest(digest string) (*models.ExternalLoginConfirmation, error)
+	// Confirm claims an unconfirmed link and creates its binding in one transaction;
+	// false means the link was already used
+	Confirm(confirmation *models.ExternalLoginConfirmation, login *models.ExternalLogin, now time.Time) (bool, error)
+	CountConfirmationsSince(userID uint, since time.Time) (int, error)
+}
+
+type gormExternalLoginRepository struct {
+	db *gorm.DB
+}
+
+func NewExternalLoginRepository(db *gorm.DB) ExternalLoginRepository {
+	return &gormExternalLoginRepository{db: db}
+}
+
+func (r *gormExternalLoginRepository) Find(source, provider, subject string) (*models.ExternalLogin, error) {
+	var login models.ExternalLogin
+	if err := r.db.Where("source = ? AND provider = ? AND subject = ?", source, provider, subject).First(&login).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &login, nil
+}
+
+func (r *gormExternalLoginRepository) Delete(login *models.ExternalLogin) error {
+	return r.db.Delete(login).Error
+}
+
+func (r *gormExternalLoginRepository) Provision(user *models.User, login *models.ExternalLogin) error {
+	tx := r.db.Begin()
+	if err := tx.Create(user).Error; err != nil {
+		tx.Rollback()
+		return translateError(err)
+	}
+	login.UserID = user.ID
+	if err := tx.Create(login).Error; err != nil {
+		tx.Rollback()
+		return translateError(err)
+	}
+	return tx.Commit().Error
+}
+
+func (r *gormExternalLoginRepository) CreateConfirmation(confirmation *models.ExternalLoginConfirmation) error {
+	return r.db.Create(confirmation).Error
+}
+
+func (r *gormExternalLoginRepository) FindConfirmationByDigest(digest string) (*models.ExternalLoginConfirmation, error) {
+	var confirmation models.ExternalLoginConfirmation
+	if err := r.db.Where("token_digest = ?", digest).First(&confirmation).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &confirmation, nil
+}
+
+func (r *gormExternalLoginRepository) Confirm(confirmation *models.ExternalLoginConfirmation, login *models.ExternalLogin, now time.Time) (bool, error) {
+	tx := r.db.Begin()
+	result := tx.Model(&models.ExternalLoginConfirmation{}).
+		Where("id = ? AND confirmed_at IS NULL", confirmation.ID).
+		Update("confirmed_at", now)
+	if result.Error != nil {
+		tx.Rollback()
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+	if err := tx.Create(login).Error; err != nil {
+		tx.Rollback()
+		return false, translateError(err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+	confirmation.ConfirmedAt = &now
+	return true, nil
+}
+
+func (r *gormExternalLoginRepository) CountConfirmationsSince(userID uint, since time.Time) (int, error) {
+	var count int
+	err := r.db.Model(&models.ExternalLoginConfirmation{}).Where("user_id = ? AND created_at > ?", userID, since).Count(&count).Error
+	return count, err
+}
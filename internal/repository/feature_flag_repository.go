@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"api/internal/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// FeatureFlagRepository stores the feature flags
+type FeatureFlagRepository interface {
+	List() ([]models.FeatureFlag, error)
+	FindByKey(key string) (*models.FeatureFlag, error)
+	// Save creates or updates the flag
+	Save(flag *models.FeatureFlag) error
+	Delete(flag *models.FeatureFlag) error
+}
+
+type gormFeatureFlagRepository struct {
+	db *gorm.DB
+}
+
+func NewFeatureFlagRepository(db *gorm.DB) FeatureFlagRepository {
+	return &gormFeatureFlagRepository{db: db}
+}
+
+func (r *gormFeatureFlagRepository) List() ([]models.FeatureFlag, error) {
+	var flags []models.FeatureFlag
+	err := r.db.Order(`"key"`).Find(&flags).Error
+	return flags, err
+}
+
+func (r *gormFeatureFlagRepository) FindByKey(key string) (*models.FeatureFlag, error) {
+	var flag models.FeatureFlag
+	if err := r.db.Where(`"key" = ?`, key).First(&flag).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &flag, nil
+}
+
+func (r *gormFeatureFlagRepository) Save(flag *models.FeatureFlag) error {
+	return translateError(r.db.Save(flag).Error)
+}
+
+func (r *gormFeatureFlagRepository) Delete(flag *models.FeatureFlag) error {
+	return r.db.Delete(flag).Error
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"api/internal/models"
+	"errors"
+
+	"github.com/jinzhu/gorm"
+)
+
+// GroupRepository stores groups and their members
+type GroupRepository interface {
+	// Create inserts the group; a taken name is reported as a *DuplicateError
+	Create(group *models.Group) error
+	FindByID(id uint) (*models.Group, error)
+	// List returns every group by name
+	List() ([]models.Group, error)
+	// MemberCounts returns the number of members of each group that has any
+	MemberCounts() (map[uint]int, error)
+	// Save updates the group; see Create for duplicates
+	Save(group *models.Group) error
+	// Delete removes the group and its memberships
+	Delete(group *models.Group) error
+	// ListMembers returns the users in the group
+	ListMembers(groupID uint) ([]models.User, error)
+	// AddMember puts the user in the group; false means they already were
+	AddMember(groupID, userID uint) (bool, error)
+	// RemoveMember takes the user out of the group; false means they were not in it
+	RemoveMember(groupID, userID uint) (bool, error)
+	// NamesForUser returns the names of the user's groups, sorted
+	NamesForUser(userID uint) ([]string, error)
+}
+
+type gormGroupRepository struct {
+	db *gorm.DB
+}
+
+func NewGroupRepository(db *gorm.DB) GroupRepository {
+	return &gormGroupRepository{db: db}
+}
+
+func (r *gormGroupRepository) Create(group *models.Group) error {
+	return translateError(r.db.Create(group).Error)
+}
+
+func (r *gormGroupRepository) FindByID(id uint) (*models.Group, error) {
+	var group models.Group
+	if err := r.db.First(&group, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &group, nil
+}
+
+func (r *gormGroupRepository) List() ([]models.Group, error) {
+	var groups []models.Group
+	err := r.db.Order("name").Find(&groups).Error
+	return groups, err
+}
+
+func (r *gormGroupRepository) MemberCounts() (map[uint]int, error) {
+	rows, err := r.db.Model(&models.GroupMember{}).Select("group_id, COUNT(*)").Group("group_id").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[uint]int{}
+	for rows.Next() {
+		var groupID uint
+		var count int
+		if err := rows.Scan(&groupID, &count); err != nil {
+			return nil, err
+		}
+		counts[groupID] = count
+	}
+	return counts, rows.Err()
+}
+
+func (r *gormGroupRepository) Save(group *models.Group) error {
+	return translateError(r.db.Save(group).Error)
+}
+
+func (r *gormGroupRepository) Delete(group *models.Group) error {
+	tx := r.db.Begin()
+	if err := tx.Where("group_id = ?", group.ID).Delete(&models.GroupMember{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(group).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func (r *gormGroupRepository) ListMembers(groupID uint) ([]models.User, error) {
+	members := r.db.Model(&models.GroupMember{}).Where("group_id = ?", groupID).Select("user_id").SubQuery()
+	var users []models.User
+	err := r.db.Where("id IN ?", members).Order("username").Find(&users).Error
+	return users, err
+}
+
+func (r *gormGroupRepository) AddMember(groupID, userID uint) (bool, error) {
+	err := translateError(r.db.Create(&models.GroupMember{GroupID: groupID, UserID: userID}).Error)
+	if errors.Is(err, ErrDuplicate) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *gormGroupRepository) RemoveMember(groupID, userID uint) (bool, error) {
+	result := r.db.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.GroupMember{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormGroupRepository) NamesForUser(userID uint) ([]string, error) {
+	var names []string
+	err := r.db.Model(&models.Group{}).
+		Joins("JOIN group_members ON group_members.group_id = groups.id").
+		Where("group_members.user_id = ?", userID).
+		Order("groups.name").
+		Pluck("groups.name", &names).Error
+	return names, err
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ImportJobRepository stores bulk user import jobs
+type ImportJobRepository interface {
+	Create(job *models.ImportJob) error
+	Save(job *models.ImportJob) error
+	// FindForAdmin returns a job started by adminID
+	FindForAdmin(adminID, id uint) (*models.ImportJob, error)
+	ListUnfinished() ([]models.ImportJob, error)
+	ListExpired(now time.Time) ([]models.ImportJob, error)
+	Delete(job *models.ImportJob) error
+}
+
+type gormImportJobRepository struct {
+	db *gorm.DB
+}
+
+func NewImportJobRepository(db *gorm.DB) ImportJobRepository {
+	return &gormImportJobRepository{db: db}
+}
+
+func (r *gormImportJobRepository) Create(job *models.ImportJob) error {
+	return r.db.Create(job).Error
+}
+
+func (r *gormImportJobRepository) Save(job *models.ImportJob) error {
+	return r.db.Save(job).Error
+}
+
+func (r *gormImportJobRepository) FindForAdmin(adminID, id uint) (*models.ImportJob, error) {
+	var job models.ImportJob
+	if err := r.db.Where("id = ? AND admin_id = ?", id, adminID).First(&job).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &job, nil
+}
+
+func (r *gormImportJobRepository) ListUnfinished() ([]models.ImportJob, error) {
+	var jobs []models.ImportJob
+	if err := r.db.Where("status IN (?)", []string{models.ExportPending, models.ExportRunning}).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (r *gormImportJobRepository) ListExpired(now time.Time) ([]models.ImportJob, error) {
+	var jobs []models.ImportJob
+	if err := r.db.Where("expires_at <= ?", now).Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (r *gormImportJobRepository) Delete(job *models.ImportJob) error {
+	return r.db.Unscoped().Delete(job).Error
+}
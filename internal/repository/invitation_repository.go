@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// InvitationRepository stores the registration invitations sent by admins
+type InvitationRepository interface {
+	// Create inserts the invitation and revokes the pending ones for the same email
+	Create(invitation *models.RegistrationInvitation, now time.Time) error
+	FindByDigest(digest string) (*models.RegistrationInvitation, error)
+	// ListPending returns the invitations that can still be accepted, newest first
+	ListPending(now time.Time) ([]models.RegistrationInvitation, error)
+	// Revoke withdraws a pending invitation; false means none was pending with that ID
+	Revoke(id uint, now time.Time) (bool, error)
+	// Accept claims a pending invitation and creates the user it lets register in one
+	// transaction; false means the invitation was accepted, revoked or expired meanwhile.
+	// A taken email or username is reported as a *DuplicateError.
+	Accept(invitation *models.RegistrationInvitation, user *models.User, now time.Time) (bool, error)
+}
+
+type gormInvitationRepository struct {
+	db *gorm.DB
+}
+
+func NewInvitationRepository(db *gorm.DB) InvitationRepository {
+	return &gormInvitationRepository{db: db}
+}
+
+// pendingInvitations limits a query to invitations that can still be accepted
+func pendingInvitations(db *gorm.DB, now time.Time) *gorm.DB {
+	return db.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now)
+}
+
+func (r *gormInvitationRepository) Create(invitation *models.RegistrationInvitation, now time.Time) error {
+	tx := r.db.Begin()
+	if err := pendingInvitations(tx.Model(&models.RegistrationInvitation{}), now).
+		Where("LOWER(email) = LOWER(?)", invitation.Email).
+		Update("revoked_at", now).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Create(invitation).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func (r *gormInvitationRepository) FindByDigest(digest string) (*models.RegistrationInvitation, error) {
+	var invitation models.RegistrationInvitation
+	if err := r.db.Where("token_digest = ?", digest).First(&invitation).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &invitation, nil
+}
+
+func (r *gormInvitationRepository) ListPending(now time.Time) ([]models.RegistrationInvitation, error) {
+	var invitations []models.RegistrationInvitation
+	err := pendingInvitations(r.db, now).Order("created_at DESC, id DESC").Find(&invitations).Error
+	return invitations, err
+}
+
+func (r *gormInvitationRepository) Revoke(id uint, now time.Time) (bool, error) {
+	result := pendingInvitations(r.db.Model(&models.RegistrationInvitation{}), now).
+		Where("id = ?", id).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *gormInvitationRepository) Accept(invitation *models.RegistrationInvitation, user *models.User, now time.Time) (bool, error) {
+	tx := r.db.Begin()
+	result := pendingInvitations(tx.Model(&models.RegistrationInvitation{}), now).
+		Where("id = ?", invitation.ID).
+		Update("accepted_at", now)
+	if result.Error != nil {
+		tx.Rollback()
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+	if err := tx.Create(user).Error; err != nil {
+		tx.Rollback()
+		return false, translateError(err)
+	}
+	if err := tx.Model(&models.RegistrationInvitation{}).Where("id = ?", invitation.ID).
+		Update("accepted_user_id", user.ID).Error; err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+	invitation.AcceptedAt = &now
+	invitation.AcceptedUserID = &user.ID
+	return true, nil
+}
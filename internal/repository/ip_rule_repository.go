@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"api/internal/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// IPRuleRepository stores the IP filter rules managed through the admin API
+type IPRuleRepository interface {
+	Create(rule *models.IPRule) error
+	FindByID(id uint) (*models.IPRule, error)
+	// List returns every rule, oldest first
+	List() ([]models.IPRule, error)
+	// Delete removes a rule; false means there was none with that ID
+	Delete(id uint) (bool, error)
+}
+
+type gormIPRuleRepository struct {
+	db *gorm.DB
+}
+
+func NewIPRuleRepository(db *gorm.DB) IPRuleRepository {
+	return &gormIPRuleRepository{db: db}
+}
+
+func (r *gormIPRuleRepository) Create(rule *models.IPRule) error {
+	return r.db.Create(rule).Error
+}
+
+func (r *gormIPRuleRepository) FindByID(id uint) (*models.IPRule, error) {
+	var rule models.IPRule
+	if err := r.db.First(&rule, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &rule, nil
+}
+
+func (r *gormIPRuleRepository) List() ([]models.IPRule, error) {
+	var rules []models.IPRule
+	err := r.db.Order("id").Find(&rules).Error
+	return rules, err
+}
+
+func (r *gormIPRuleRepository) Delete(id uint) (bool, error) {
+	result := r.db.Where("id = ?", id).Delete(&models.IPRule{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
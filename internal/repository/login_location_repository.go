@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"api/internal/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// LoginLocationRepository stores where each user last signed in from
+type LoginLocationRepository interface {
+	FindByUser(userID uint) (*models.LoginLocation, error)
+	// Save replaces the user's location with location
+	Save(location *models.LoginLocation) error
+}
+
+type gormLoginLocationRepository struct {
+	db *gorm.DB
+}
+
+func NewLoginLocationRepository(db *gorm.DB) LoginLocationRepository {
+	return &gormLoginLocationRepository{db: db}
+}
+
+func (r *gormLoginLocationRepository) FindByUser(userID uint) (*models.LoginLocation, error) {
+	var location models.LoginLocation
+	if err := r.db.Where("user_id = ?", userID).First(&location).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &location, nil
+}
+
+func (r *gormLoginLocationRepository) Save(location *models.LoginLocation) error {
+	return r.db.Where(models.LoginLocation{UserID: location.UserID}).
+		Assign(map[string]interface{}{
+			"ip_address":   location.IPAddress,
+			"country":      location.Country,
+			"city":         location.City,
+			"latitude":     location.Latitude,
+			"longitude":    location.Longitude,
+			"signed_in_at": location.SignedInAt,
+		}).
+		FirstOrCreate(location).Error
+}
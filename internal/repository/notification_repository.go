@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// NotificationRepository stores notification preferences and the logins used to detect new devices
+type NotificationRepository interface {
+	FindPreferences(userID uint) (*models.NotificationPreferences, error)
+	SavePreferences(prefs *models.NotificationPreferences) error
+	// RecordLogin remembers the IP address and user agent of a login. It reports whether
+	// that combination was seen before and whether the user had any recorded login at all.
+	RecordLogin(userID uint, ip, userAgent string, now time.Time) (known, firstLogin bool, err error)
+}
+
+type gormNotificationRepository struct {
+	db *gorm.DB
+}
+
+func NewNotificationRepository(db *gorm.DB) NotificationRepository {
+	return &gormNotificationRepository{db: db}
+}
+
+func (r *gormNotificationRepository) FindPreferences(userID uint) (*models.NotificationPreferences, error) {
+	var prefs models.NotificationPreferences
+	if err := r.db.Where("user_id = ?", userID).First(&prefs).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &prefs, nil
+}
+
+func (r *gormNotificationRepository) SavePreferences(prefs *models.NotificationPreferences) error {
+	return r.db.Save(prefs).Error
+}
+
+func (r *gormNotificationRepository) RecordLogin(userID uint, ip, userAgent string, now time.Time) (bool, bool, error) {
+	var login models.KnownLogin
+	err := r.db.Where("user_id = ? AND ip_address = ? AND user_agent = ?", userID, ip, userAgent).First(&login).Error
+	if err == nil {
+		return true, false, r.db.Model(&login).Update("last_seen_at", now).Error
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return false, false, err
+	}
+
+	var count int
+	if err := r.db.Model(&models.KnownLogin{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return false, false, err
+	}
+	login = models.KnownLogin{UserID: userID, IPAddress: ip, UserAgent: userAgent, LastSeenAt: now}
+	if err := r.db.Create(&login).Error; err != nil {
+		return false, false, err
+	}
+	return false, count == 0, nil
+}
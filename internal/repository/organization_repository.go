@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// OrganizationRepository stores organizations, their memberships and invitations
+type OrganizationRepository interface {
+	// Create inserts the organization and makes owner its first member. A taken slug is
+	// reported as a *DuplicateError.
+	Create(org *models.Organization, owner *models.Membership) error
+	FindByID(id uint) (*models.Organization, error)
+	FindMembership(orgID, userID uint) (*models.Membership, error)
+	// ListMemberships returns the user's memberships, oldest first
+	ListMemberships(userID uint) ([]models.Membership, error)
+	// ListMembers returns the memberships of an organization, oldest first
+	ListMembers(orgID uint) ([]models.Membership, error)
+	// AddMember inserts a membership; an existing one is reported as a *DuplicateError
+	AddMember(membership *models.Membership) error
+	CreateInvitation(invitation *models.OrganizationInvitation) error
+	FindInvitationByDigest(digest string) (*models.OrganizationInvitation, error)
+	// AcceptInvitation claims an unaccepted invitation for userID and adds the membership
+	// it grants in one transaction; false means the invitation was already accepted
+	AcceptInvitation(invitation *models.OrganizationInvitation, membership *models.Membership, now time.Time) (bool, error)
+	// CreateTransfer inserts an ownership transfer, cancelling the organization's pending ones
+	CreateTransfer(transfer *models.OwnershipTransfer, now time.Time) error
+	FindTransferByDigest(digest string) (*models.OwnershipTransfer, error)
+	// CompleteTransfer claims a pending transfer, makes its recipient the owner and the
+	// previous owner an admin, and writes the audit entries in one transaction; false
+	// means the transfer was already used or cancelled, the previous owner no longer owns
+	// the organization or the recipient left it
+	CompleteTransfer(transfer *models.OwnershipTransfer, audit []models.AuditEntry, now time.Time) (bool, error)
+}
+
+type gormOrganizationRepository struct {
+	db *gorm.DB
+}
+
+func NewOrganizationRepository(db *gorm.DB) OrganizationRepository {
+	return &gormOrganizationRepository{db: db}
+}
+
+func (r *gormOrganizationRepository) Create(org *models.Organization, owner *models.Membership) error {
+	tx := r.db.Begin()
+	if err := tx.Create(org).Error; err != nil {
+		tx.Rollback()
+		return translateError(err)
+	}
+	owner.OrganizationID = org.ID
+	if err := tx.Create(owner).Error; err != nil {
+		tx.Rollback()
+		return translateError(err)
+	}
+	return tx.Commit().Error
+}
+
+func (r *gormOrganizationRepository) FindByID(id uint) (*models.Organization, error) {
+	var org models.Organization
+	if err := r.db.First(&org, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &org, nil
+}
+
+func (r *gormOrganizationRepository) FindMembership(orgID, userID uint) (*models.Membership, error) {
+	var membership models.Membership
+	if err := r.db.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &membership, nil
+}
+
+func (r *gormOrganizationRepository) ListMemberships(userID uint) ([]models.Membership, error) {
+	var memberships []models.Membership
+	err := r.db.Where("user_id = ?", userID).Order("created_at, id").Find(&memberships).Error
+	return memberships, err
+}
+
+func (r *gormOrganizationRepository) ListMembers(orgID uint) ([]models.Membership, error) {
+	var memberships []models.Membership
+	err := r.db.Where("organization_id = ?", orgID).Order("created_at, id").Find(&memberships).Error
+	return memberships, err
+}
+
+func (r *gormOrganizationRepository) AddMember(membership *models.Membership) error {
+	return translateError(r.db.Create(membership).Error)
+}
+
+func (r *gormOrganizationRepository) CreateInvitation(invitation *models.OrganizationInvitation) error {
+	return r.db.Create(invitation).Error
+}
+
+func (r *gormOrganizationRepository) FindInvitationByDigest(digest string) (*models.OrganizationInvitation, error) {
+	var invitation models.OrganizationInvitation
+	if err := r.db.Where("token_digest = ?", digest).First(&invitation).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &invitation, nil
+}
+
+func (r *gormOrganizationRepository) AcceptInvitation(invitation *models.OrganizationInvitation, membership *models.Membership, now time.Time) (bool, error) {
+	tx := r.db.Begin()
+	result := tx.Model(&models.OrganizationInvitation{}).
+		Where("id = ? AND accepted_at IS NULL", invitation.ID).
+		Updates(map[string]interface{}{"accepted_at": now, "accepted_by_id": membership.UserID})
+	if result.Error != nil {
+		tx.Rollback()
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+	if err := tx.Create(membership).Error; err != nil {
+		tx.Rollback()
+		return false, translateError(err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+	invitation.AcceptedAt = &now
+	invitation.AcceptedByID = &membership.UserID
+	return true, nil
+}
+
+func (r *gormOrganizationRepository) CreateTransfer(transfer *models.OwnershipTransfer, now time.Time) error {
+	tx := r.db.Begin()
+	if err := tx.Model(&models.OwnershipTransfer{}).
+		Where("organization_id = ? AND accepted_at IS NULL AND cancelled_at IS NULL", transfer.OrganizationID).
+		Update("cancelled_at", now).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Create(transfer).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func (r *gormOrganizationRepository) FindTransferByDigest(digest string) (*models.OwnershipTransfer, error) {
+	var transfer models.OwnershipTransfer
+	if err := r.db.Where("token_digest = ?", digest).First(&transfer).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &transfer, nil
+}
+
+func (r *gormOrganizationRepository) CompleteTransfer(transfer *models.OwnershipTransfer, audit []models.AuditEntry, now time.Time) (bool, error) {
+	tx := r.db.Begin()
+	steps := []func() *gorm.DB{
+		func() *gorm.DB {
+			return tx.Model(&models.OwnershipTransfer{}).
+				Where("id = ? AND accepted_at IS NULL AND cancelled_at IS NULL", transfer.ID).
+				Update("accepted_at", now)
+		},
+		func() *gorm.DB {
+			return tx.Model(&models.Membership{}).
+				Where("organization_id = ? AND user_id = ? AND role = ?", transfer.OrganizationID, transfer.FromUserID, models.OrgRoleOwner).
+				Update("role", models.OrgRoleAdmin)
+		},
+		func() *gorm.DB {
+			return tx.Model(&models.Membership{}).
+				Where("organization_id = ? AND user_id = ?", transfer.OrganizationID, transfer.ToUserID).
+				Update("role", models.OrgRoleOwner)
+		},
+	}
+	for _, step := range steps {
+		result := step()
+		if result.Error != nil {
+			tx.Rollback()
+			return false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			tx.Rollback()
+			return false, nil
+		}
+	}
+	for i := range audit {
+		if err := tx.Create(&audit[i]).Error; err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+	transfer.AcceptedAt = &now
+	return true, nil
+}
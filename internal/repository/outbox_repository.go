@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// OutboxRepository reads and settles the lifecycle events the model hooks write to
+// the outbox
+type OutboxRepository interface {
+	// Due returns up to limit pending events whose next attempt is due at now, oldest first
+	Due(now time.Time, limit int) ([]models.WebhookEvent, error)
+	MarkDelivered(event *models.WebhookEvent, at time.Time) error
+	// MarkRetry records a failed attempt and when to try again
+	MarkRetry(event *models.WebhookEvent, next time.Time, reason string) error
+	// MarkFailed gives up on the event
+	MarkFailed(event *models.WebhookEvent, reason string) error
+	// PurgeDelivered removes events delivered before cutoff and returns how many
+	PurgeDelivered(cutoff time.Time) (int64, error)
+}
+
+type gormOutboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) OutboxRepository {
+	return &gormOutboxRepository{db: db}
+}
+
+func (r *gormOutboxRepository) Due(now time.Time, limit int) ([]models.WebhookEvent, error) {
+	var events []models.WebhookEvent
+	err := r.db.Where("status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", models.WebhookEventPending, now).
+		Order("id").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+func (r *gormOutboxRepository) MarkDelivered(event *models.WebhookEvent, at time.Time) error {
+	return r.db.Model(event).Updates(map[string]interface{}{
+		"status":          models.WebhookEventDelivered,
+		"attempts":        gorm.Expr("attempts + 1"),
+		"delivered_at":    at,
+		"next_attempt_at": nil,
+		"last_error":      "",
+	}).Error
+}
+
+func (r *gormOutboxRepository) MarkRetry(event *models.WebhookEvent, next time.Time, reason string) error {
+	return r.db.Model(event).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"next_attempt_at": next,
+		"last_error":      reason,
+	}).Error
+}
+
+func (r *gormOutboxRepository) MarkFailed(event *models.WebhookEvent, reason string) error {
+	return r.db.Model(event).Updates(map[string]interface{}{
+		"status":          models.WebhookEventFailed,
+		"attempts":        gorm.Expr("attempts + 1"),
+		"next_attempt_at": nil,
+		"last_error":      reason,
+	}).Error
+}
+
+func (r *gormOutboxRepository) PurgeDelivered(cutoff time.Time) (int64, error) {
+	result := r.db.Unscoped().Where("status = ? AND delivered_at < ?", models.WebhookEventDelivered, cutoff).Delete(&models.WebhookEvent{})
+	return result.RowsAffected, result.Error
+}
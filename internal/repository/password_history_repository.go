@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"api/internal/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// PasswordHistoryRepository stores the hashes of users' previous passwords
+type PasswordHistoryRepository interface {
+	// Create adds entry and drops all but the newest keep entries of its user
+	Create(entry *models.PasswordHistory, keep int) error
+	// Recent returns the user's newest n entries, newest first
+	Recent(userID uint, n int) ([]models.PasswordHistory, error)
+}
+
+type gormPasswordHistoryRepository struct {
+	db *gorm.DB
+}
+
+func NewPasswordHistoryRepository(db *gorm.DB) PasswordHistoryRepository {
+	return &gormPasswordHistoryRepository{db: db}
+}
+
+func (r *gormPasswordHistoryRepository) Create(entry *models.PasswordHistory, keep int) error {
+	tx := r.db.Begin()
+	if err := tx.Create(entry).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	kept := tx.Model(&models.PasswordHistory{}).Where("user_id = ?", entry.UserID).
+		Order("created_at DESC, id DESC").Limit(keep).Select("id").SubQuery()
+	if err := tx.Where("user_id = ? AND id NOT IN ?", entry.UserID, kept).Delete(&models.PasswordHistory{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func (r *gormPasswordHistoryRepository) Recent(userID uint, n int) ([]models.PasswordHistory, error) {
+	var entries []models.PasswordHistory
+	err := r.db.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Limit(n).Find(&entries).Error
+	return entries, err
+}
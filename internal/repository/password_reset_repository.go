@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// PasswordResetRepository stores password reset links
+type PasswordResetRepository interface {
+	Create(reset *models.PasswordReset) error
+	FindByDigest(digest string) (*models.PasswordReset, error)
+	// MarkUsed claims an unused link; false means it was already used
+	MarkUsed(reset *models.PasswordReset, now time.Time) (bool, error)
+	CountSince(userID uint, since time.Time) (int, error)
+}
+
+type gormPasswordResetRepository struct {
+	db *gorm.DB
+}
+
+func NewPasswordResetRepository(db *gorm.DB) PasswordResetRepository {
+	return &gormPasswordResetRepository{db: db}
+}
+
+func (r *gormPasswordResetRepository) Create(reset *models.PasswordReset) error {
+	return r.db.Create(reset).Error
+}
+
+func (r *gormPasswordResetRepository) FindByDigest(digest string) (*models.PasswordReset, error) {
+	var reset models.PasswordReset
+	if err := r.db.Where("token_digest = ?", digest).First(&reset).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &reset, nil
+}
+
+func (r *gormPasswordResetRepository) MarkUsed(reset *models.PasswordReset, now time.Time) (bool, error) {
+	result := r.db.Model(&models.PasswordReset{}).
+		Where("id = ? AND used_at IS NULL", reset.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	reset.UsedAt = &now
+	return true, nil
+}
+
+func (r *gormPasswordResetRepository) CountSince(userID uint, since time.Time) (int, error) {
+	var count int
+	err := r.db.Model(&models.PasswordReset{}).Where("user_id = ? AND created_at > ?", userID, since).Count(&count).Error
+	return count, err
+}
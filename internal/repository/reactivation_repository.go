@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ReactivationRepository stores the links that reactivate deactivated accounts
+type ReactivationRepository interface {
+	Create(reactivation *models.AccountReactivation) error
+	FindByDigest(digest string) (*models.AccountReactivation, error)
+	// MarkUsed claims an unused link; false means it was already used
+	MarkUsed(reactivation *models.AccountReactivation, now time.Time) (bool, error)
+	CountSince(userID uint, since time.Time) (int, error)
+}
+
+type gormReactivationRepository struct {
+	db *gorm.DB
+}
+
+func NewReactivationRepository(db *gorm.DB) ReactivationRepository {
+	return &gormReactivationRepository{db: db}
+}
+
+func (r *gormReactivationRepository) Create(reactivation *models.AccountReactivation) error {
+	return r.db.Create(reactivation).Error
+}
+
+func (r *gormReactivationRepository) FindByDigest(digest string) (*models.AccountReactivation, error) {
+	var reactivation models.AccountReactivation
+	if err := r.db.Where("token_digest = ?", digest).First(&reactivation).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &reactivation, nil
+}
+
+func (r *gormReactivationRepository) MarkUsed(reactivation *models.AccountReactivation, now time.Time) (bool, error) {
+	result := r.db.Model(&models.AccountReactivation{}).
+		Where("id = ? AND used_at IS NULL", reactivation.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	reactivation.UsedAt = &now
+	return true, nil
+}
+
+func (r *gormReactivationRepository) CountSince(userID uint, since time.Time) (int, error) {
+	var count int
+	err := r.db.Model(&models.AccountReactivation{}).Where("user_id = ? AND created_at > ?", userID, since).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+// ReadReplica is a read-only copy of the primary database with the monitor tracking
+// whether it can be reached
+type ReadReplica struct {
+	Name    string // for logs, without credentials
+	DB      *gorm.DB
+	Monitor *DBMonitor
+}
+
+// ReadReplicas spreads read-only queries over the healthy replicas in turn. With none
+// configured, or none healthy, reads go to the primary. Replicas lag slightly behind,
+// so only queries that tolerate that are routed here; read-modify-write stays on the
+// primary. A nil *ReadReplicas reads from the primary.
+type ReadReplicas struct {
+	replicas []ReadReplica
+	next     atomic.Uint32
+	logger   *logrus.Logger
+}
+
+// NewReadReplicas checks every replica once, so one that is down is skipped from the start
+func NewReadReplicas(replicas []ReadReplica, logger *logrus.Logger) *ReadReplicas {
+	for _, replica := range replicas {
+		replica.Monitor.Check(context.Background())
+	}
+	return &ReadReplicas{replicas: replicas, logger: logger}
+}
+
+// Run monitors every replica until stop is closed
+func (rr *ReadReplicas) Run(stop <-chan struct{}) {
+	if rr == nil {
+		return
+	}
+	for _, replica := range rr.replicas {
+		go replica.Monitor.Run(stop)
+	}
+}
+
+// Status reports whether each replica is healthy, by name
+func (rr *ReadReplicas) Status() map[string]bool {
+	status := map[string]bool{}
+	if rr == nil {
+		return status
+	}
+	for _, replica := range rr.replicas {
+		status[replica.Name], _ = replica.Monitor.Healthy()
+	}
+	return status
+}
+
+// pick returns the next healthy replica, or nil
+func (rr *ReadReplicas) pick() *ReadReplica {
+	if rr == nil || len(rr.replicas) == 0 {
+		return nil
+	}
+	start := rr.next.Add(1)
+	for i := range rr.replicas {
+		replica := &rr.replicas[(int(start)+i)%len(rr.replicas)]
+		if healthy, _ := replica.Monitor.Healthy(); healthy {
+			return replica
+		}
+	}
+	return nil
+}
+
+// Read runs fn on a healthy replica, or on primary when there is none. A replica
+// failing other than by finding no rows is assumed to be in trouble and fn runs again
+// on primary.
+func (rr *ReadReplicas) Read(primary *gorm.DB, fn func(db *gorm.DB) error) error {
+	replica := rr.pick()
+	if replica == nil {
+		return fn(primary)
+	}
+	err := fn(replica.DB)
+	if err == nil || gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+	rr.logger.WithError(err).WithField("replica", replica.Name).Warn("Read replica query failed, using the primary")
+	return fn(primary)
+}
+
+// ReadRecent is Read for lookups of rows that may have been written a moment ago: a
+// row the replica does not have yet is looked for on primary
+func (rr *ReadReplicas) ReadRecent(primary *gorm.DB, fn func(db *gorm.DB) error) error {
+	replica := rr.pick()
+	if replica == nil {
+		return fn(primary)
+	}
+	err := fn(replica.DB)
+	if err == nil {
+		return nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		rr.logger.WithError(err).WithField("replica", replica.Name).Warn("Read replica query failed, using the primary")
+	}
+	return fn(primary)
+}
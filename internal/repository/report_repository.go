@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ReportRepository stores scheduled email reports
+type ReportRepository interface {
+	Create(schedule *models.ReportSchedule) error
+	List() ([]models.ReportSchedule, error)
+	// Delete reports whether the schedule existed
+	Delete(id uint) (bool, error)
+	// ListDue returns schedules whose next run is at or before t
+	ListDue(t time.Time) ([]models.ReportSchedule, error)
+	// ClaimRun moves a due schedule to its next run. It reports false when another
+	// instance already did, so each run is sent once.
+	ClaimRun(schedule *models.ReportSchedule, ranAt, nextRunAt time.Time) (bool, error)
+}
+
+type gormReportRepository struct {
+	db *gorm.DB
+}
+
+func NewReportRepository(db *gorm.DB) ReportRepository {
+	return &gormReportRepository{db: db}
+}
+
+func (r *gormReportRepository) Create(schedule *models.ReportSchedule) error {
+	return r.db.Create(schedule).Error
+}
+
+func (r *gormReportRepository) List() ([]models.ReportSchedule, error) {
+	var schedules []models.ReportSchedule
+	if err := r.db.Order("next_run_at").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (r *gormReportRepository) Delete(id uint) (bool, error) {
+	result := r.db.Where("id = ?", id).Delete(&models.ReportSchedule{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormReportRepository) ListDue(t time.Time) ([]models.ReportSchedule, error) {
+	var schedules []models.ReportSchedule
+	if err := r.db.Where("next_run_at <= ?", t).Order("next_run_at").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (r *gormReportRepository) ClaimRun(schedule *models.ReportSchedule, ranAt, nextRunAt time.Time) (bool, error) {
+	result := r.db.Model(&models.ReportSchedule{}).
+		Where("id = ? AND next_run_at = ?", schedule.ID, schedule.NextRunAt).
+		Updates(map[string]interface{}{"next_run_at": nextRunAt, "last_run_at": ranAt})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	schedule.NextRunAt = nextRunAt
+	schedule.LastRunAt = &ranAt
+	return true, nil
+}
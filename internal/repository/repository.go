@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// ErrNotFound is returned when a requested record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// ErrDuplicate matches every DuplicateError
+var ErrDuplicate = errors.New("duplicate record")
+
+// uniqueViolation is the Postgres error code for a unique constraint violation, and
+// mysqlDuplicateEntry the MySQL one
+const (
+	uniqueViolation     = "23505"
+	mysqlDuplicateEntry = 1062
+)
+
+// violationKey extracts the column list from a detail such as "Key (email)=(a@b.c) already exists."
+var violationKey = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+
+// mysqlDuplicateKey extracts the index from a message such as "Duplicate entry 'a@b.c'
+// for key 'users.email'"; MySQL names the index of a unique column after the column
+var mysqlDuplicateKey = regexp.MustCompile(`for key '(?:[^'.]+\.)?([^']+)'$`)
+
+// sqliteUniqueFailed prefixes the columns in SQLite's message, "UNIQUE constraint
+// failed: users.email". The SQLite driver needs cgo, so its error type is not used.
+const sqliteUniqueFailed = "UNIQUE constraint failed: "
+
+// DuplicateError is returned when a write violates a unique constraint
+type DuplicateError struct {
+	Constraint string // e.g. users_email_key
+	Column     string // the violated column, "" if it could not be determined
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("duplicate %s (constraint %s)", e.Column, e.Constraint)
+}
+
+func (e *DuplicateError) Is(target error) bool {
+	return target == ErrDuplicate
+}
+
+// translateError maps GORM and database specific errors to repository errors
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrNotFound
+	}
+	// GORM collects the errors of a failed save, e.g. one from a hook, in gorm.Errors
+	causes := []error{err}
+	if errs, ok := err.(gorm.Errors); ok {
+		causes = errs
+	}
+	for _, cause := range causes {
+		var pqErr *pq.Error
+		if errors.As(cause, &pqErr) && pqErr.Code == uniqueViolation {
+			return &DuplicateError{Constraint: pqErr.Constraint, Column: violatedColumn(pqErr)}
+		}
+		var mysqlErr *mysql.MySQLError
+		if errors.As(cause, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+			duplicate := &DuplicateError{}
+			if m := mysqlDuplicateKey.FindStringSubmatch(mysqlErr.Message); m != nil {
+				duplicate.Constraint = m[1]
+				if !strings.HasPrefix(m[1], "idx_") && !strings.HasPrefix(m[1], "uix_") {
+					duplicate.Column = m[1]
+				}
+			}
+			return duplicate
+		}
+		if columns, ok := strings.CutPrefix(cause.Error(), sqliteUniqueFailed); ok {
+			return &DuplicateError{Constraint: columns, Column: sqliteColumns(columns)}
+		}
+	}
+	return err
+}
+
+// violatedColumn names the column of a unique violation from the error detail, or
+// failing that from a constraint named <table>_<column>_key as Postgres generates them
+func violatedColumn(err *pq.Error) string {
+	if m := violationKey.FindStringSubmatch(err.Detail); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+	if name := strings.TrimSuffix(err.Constraint, "_key"); name != err.Constraint && err.Table != "" {
+		return strings.TrimPrefix(name, err.Table+"_")
+	}
+	return ""
+}
+
+// sqliteColumns turns "known_logins.user_id, known_logins.ip_address" into
+// "user_id, ip_address", as Postgres lists them
+func sqliteColumns(columns string) string {
+	names := strings.Split(columns, ", ")
+	for i, name := range names {
+		if _, column, ok := strings.Cut(name, "."); ok {
+			names[i] = column
+		}
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"api/internal/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SecurityEventRepository stores security events
+type SecurityEventRepository interface {
+	Create(event *models.SecurityEvent) error
+	ListByUser(userID uint) ([]models.SecurityEvent, error)
+	// ListRecentByUser returns the user's latest events, newest first
+	ListRecentByUser(userID uint, limit int) ([]models.SecurityEvent, error)
+}
+
+type gormSecurityEventRepository struct {
+	db *gorm.DB
+}
+
+func NewSecurityEventRepository(db *gorm.DB) SecurityEventRepository {
+	return &gormSecurityEventRepository{db: db}
+}
+
+func (r *gormSecurityEventRepository) Create(event *models.SecurityEvent) error {
+	return r.db.Create(event).Error
+}
+
+func (r *gormSecurityEventRepository) ListByUser(userID uint) ([]models.SecurityEvent, error) {
+	var events []models.SecurityEvent
+	if err := r.db.Where("user_id = ?", userID).Order("created_at").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *gormSecurityEventRepository) ListRecentByUser(userID uint, limit int) ([]models.SecurityEvent, error) {
+	var events []models.SecurityEvent
+	if err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
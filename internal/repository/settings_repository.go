@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"api/internal/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SettingsRepository stores the users' account settings
+type SettingsRepository interface {
+	FindByUser(userID uint) (*models.UserSettings, error)
+	Save(settings *models.UserSettings) error
+}
+
+type gormSettingsRepository struct {
+	db *gorm.DB
+}
+
+func NewSettingsRepository(db *gorm.DB) SettingsRepository {
+	return &gormSettingsRepository{db: db}
+}
+
+func (r *gormSettingsRepository) FindByUser(userID uint) (*models.UserSettings, error) {
+	var settings models.UserSettings
+	if err := r.db.Where("user_id = ?", userID).First(&settings).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &settings, nil
+}
+
+func (r *gormSettingsRepository) Save(settings *models.UserSettings) error {
+	return translateError(r.db.Save(settings).Error)
+}
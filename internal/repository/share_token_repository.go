@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ShareTokenRepository stores hashed share tokens
+type ShareTokenRepository interface {
+	Create(token *models.ShareToken) error
+	FindByHash(tokenHash string) (*models.ShareToken, error)
+	ListByUser(userID uint) ([]models.ShareToken, error)
+	DeleteForUser(userID, id uint) (bool, error)
+	TouchLastUsed(id uint, at time.Time) error
+}
+
+type gormShareTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewShareTokenRepository(db *gorm.DB) ShareTokenRepository {
+	return &gormShareTokenRepository{db: db}
+}
+
+func (r *gormShareTokenRepository) Create(token *models.ShareToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *gormShareTokenRepository) FindByHash(tokenHash string) (*models.ShareToken, error) {
+	var token models.ShareToken
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+func (r *gormShareTokenRepository) ListByUser(userID uint) ([]models.ShareToken, error) {
+	var tokens []models.ShareToken
+	if err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *gormShareTokenRepository) DeleteForUser(userID, id uint) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.ShareToken{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormShareTokenRepository) TouchLastUsed(id uint, at time.Time) error {
+	return r.db.Model(&models.ShareToken{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
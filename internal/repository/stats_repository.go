@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SecurityEventCount is the number of security events of one type and severity
+type SecurityEventCount struct {
+	Type     string
+	Severity string
+	Count    int
+}
+
+// StatsRepository aggregates account activity for admin statistics
+type StatsRepository interface {
+	// CountUsers counts accounts that existed at t
+	CountUsers(t time.Time) (int, error)
+	CountSignups(from, to time.Time) (int, error)
+	// CountActiveUsers counts users who signed in or refreshed a session in the period
+	CountActiveUsers(from, to time.Time) (int, error)
+	CountSecurityEvents(from, to time.Time) ([]SecurityEventCount, error)
+}
+
+type gormStatsRepository struct {
+	db *gorm.DB
+}
+
+func NewStatsRepository(db *gorm.DB) StatsRepository {
+	return &gormStatsRepository{db: db}
+}
+
+func (r *gormStatsRepository) CountUsers(t time.Time) (int, error) {
+	var count int
+	err := r.db.Unscoped().Model(&models.User{}).
+		Where("created_at < ? AND (deleted_at IS NULL OR deleted_at >= ?)", t, t).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormStatsRepository) CountSignups(from, to time.Time) (int, error) {
+	var count int
+	err := r.db.Unscoped().Model(&models.User{}).Where("created_at >= ? AND created_at < ?", from, to).Count(&count).Error
+	return count, err
+}
+
+func (r *gormStatsRepository) CountActiveUsers(from, to time.Time) (int, error) {
+	// Rotated and revoked refresh tokens are soft deleted but still show activity
+	var count int
+	err := r.db.Unscoped().Model(&models.RefreshToken{}).
+		Where("last_used_at >= ? AND last_used_at < ?", from, to).
+		Select("COUNT(DISTINCT user_id)").Row().Scan(&count)
+	return count, err
+}
+
+func (r *gormStatsRepository) CountSecurityEvents(from, to time.Time) ([]SecurityEventCount, error) {
+	rows, err := r.db.Model(&models.SecurityEvent{}).
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Select("type, severity, COUNT(*)").Group("type, severity").Order("type, severity").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []SecurityEventCount
+	for rows.Next() {
+		var c SecurityEventCount
+		if err := rows.Scan(&c.Type, &c.Severity, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
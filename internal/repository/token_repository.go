@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"api/internal/compat"
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// TokenRepository stores refresh tokens. Lookups take the plaintext token;
+// how it is persisted is decided by the configured compat.RefreshTokenStore.
+type TokenRepository interface {
+	Create(userID uint, token string, rt *models.RefreshToken) error
+	// FindForUser returns the stored token, including already rotated ones
+	FindForUser(userID uint, token string) (*models.RefreshToken, error)
+	Save(rt *models.RefreshToken) error
+	// MarkRotated atomically flags an unused token as rotated, reporting false if it was already used
+	MarkRotated(rt *models.RefreshToken) (bool, error)
+	Delete(rt *models.RefreshToken) error
+	DeleteFamily(userID uint, familyID string) error
+	DeleteByToken(token string) error
+	DeleteByUser(userID uint) error
+	// ListActive returns the user's unrotated, unexpired tokens, one per session
+	ListActive(userID uint) ([]models.RefreshToken, error)
+	FindActiveByID(userID, id uint) (*models.RefreshToken, error)
+	// DeleteFamiliesExcept removes every token of the user outside keepFamilyID and returns the number of sessions ended
+	DeleteFamiliesExcept(userID uint, keepFamilyID string) (int, error)
+}
+
+// gormTokenRepository looks up refresh tokens on the read replicas, which may be nil;
+// claiming and deleting them always happens on the primary
+type gormTokenRepository struct {
+	db       *gorm.DB
+	replicas *ReadReplicas
+	store    *compat.RefreshTokenStore
+}
+
+func NewTokenRepository(db *gorm.DB, replicas *ReadReplicas, store *compat.RefreshTokenStore) TokenRepository {
+	return &gormTokenRepository{db: db, replicas: replicas, store: store}
+}
+
+func (r *gormTokenRepository) Create(userID uint, token string, rt *models.RefreshToken) error {
+	rt.UserID = userID
+	r.store.Apply(rt, token)
+	return r.db.Create(rt).Error
+}
+
+func (r *gormTokenRepository) FindForUser(userID uint, token string) (*models.RefreshToken, error) {
+	// A token issued a moment ago may not have reached the replica yet. One the replica
+	// still shows after it was rotated or deleted fails to be claimed with MarkRotated.
+	var rt models.RefreshToken
+	err := r.replicas.ReadRecent(r.db, func(db *gorm.DB) error {
+		rt = models.RefreshToken{}
+		return r.store.Where(db, token).Where("user_id = ?", userID).First(&rt).Error
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &rt, nil
+}
+
+func (r *gormTokenRepository) Save(rt *models.RefreshToken) error {
+	return r.db.Save(rt).Error
+}
+
+func (r *gormTokenRepository) MarkRotated(rt *models.RefreshToken) (bool, error) {
+	now := time.Now()
+	result := r.db.Model(&models.RefreshToken{}).
+		Where("id = ? AND rotated_at IS NULL", rt.ID).
+		Update("rotated_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	rt.RotatedAt = &now
+	return true, nil
+}
+
+func (r *gormTokenRepository) DeleteFamily(userID uint, familyID string) error {
+	return r.db.Where("user_id = ? AND family_id = ?", userID, familyID).Delete(&models.RefreshToken{}).Error
+}
+
+func (r *gormTokenRepository) Delete(rt *models.RefreshToken) error {
+	return r.db.Delete(rt).Error
+}
+
+func (r *gormTokenRepository) DeleteByToken(token string) error {
+	return r.store.Where(r.db, token).Delete(&models.RefreshToken{}).Error
+}
+
+func (r *gormTokenRepository) DeleteByUser(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&models.RefreshToken{}).Error
+}
+
+func (r *gormTokenRepository) activeQuery(userID uint) *gorm.DB {
+	return r.db.Where("user_id = ? AND rotated_at IS NULL AND expires_at > ?", userID, time.Now())
+}
+
+func (r *gormTokenRepository) ListActive(userID uint) ([]models.RefreshToken, error) {
+	var tokens []models.RefreshToken
+	if err := r.activeQuery(userID).Order("last_used_at DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *gormTokenRepository) FindActiveByID(userID, id uint) (*models.RefreshToken, error) {
+	var rt models.RefreshToken
+	if err := r.activeQuery(userID).Where("id = ?", id).First(&rt).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &rt, nil
+}
+
+func (r *gormTokenRepository) DeleteFamiliesExcept(userID uint, keepFamilyID string) (int, error) {
+	var count int
+	if err := r.activeQuery(userID).Model(&models.RefreshToken{}).Where("family_id <> ?", keepFamilyID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	if err := r.db.Where("user_id = ? AND family_id <> ?", userID, keepFamilyID).Delete(&models.RefreshToken{}).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,552 @@
+package repository
+
+import (
+	"api/internal/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// UserRepository provides access to users and their profiles
+type UserRepository interface {
+	FindByID(id uint) (*models.User, error)
+	FindByEmail(email string) (*models.User, error)
+	FindByUsername(username string) (*models.User, error)
+	// CountByRole counts the accounts with role, soft deleted ones excluded
+	CountByRole(role string) (int, error)
+	List() ([]models.User, error)
+	// ListByOrganization returns the members of an organization
+	ListByOrganization(orgID uint) ([]models.User, error)
+	// ListFiltered returns the users matching filter, in ID order
+	ListFiltered(filter UserListFilter) ([]models.User, error)
+	// ListVersion summarizes the users and profiles, and the memberships of a filter's
+	// organization, so that a change to any of them can be detected
+	ListVersion(filter UserListFilter) (*UserListVersion, error)
+	// ListPage returns up to limit users matching filter with IDs above afterID, in ID
+	// order, so long lists can be read in batches
+	ListPage(filter UserListFilter, afterID uint, limit int) ([]models.User, error)
+	// FindProfiles returns the profiles of the given users that have one
+	FindProfiles(userIDs []uint) ([]models.UserProfile, error)
+	// Search finds up to limit users whose email, username or name resemble query,
+	// most relevant first. On Postgres it needs the indexes of CreateUserSearchIndexes;
+	// other databases only find users containing every word of query.
+	Search(filter UserListFilter, query string, limit int) ([]UserSearchMatch, error)
+	// Create inserts the user. A taken email or username is reported as a *DuplicateError
+	// by the unique constraints, which unlike a prior lookup cannot race.
+	Create(user *models.User) error
+	// Save updates the user; see Create for duplicates
+	Save(user *models.User) error
+	// SaveAs saves the user, recording actorID as the author in the audit trail
+	SaveAs(user *models.User, actorID uint) error
+	// UpdatePasswordHash replaces the stored hash of an unchanged password, e.g. one made
+	// with older hashing parameters, if it is still oldHash. It bypasses the audit trail
+	// and webhooks since the password itself stays the same.
+	UpdatePasswordHash(userID uint, oldHash, newHash string) error
+	// LiftExpiredSuspensions reactivates accounts whose suspension ended before now
+	LiftExpiredSuspensions(now time.Time) (int64, error)
+	// ListDeletionsDue returns the accounts pending deletion whose grace period ended
+	// before now
+	ListDeletionsDue(now time.Time) ([]models.User, error)
+	FindProfile(userID uint) (*models.UserProfile, error)
+	// ReadProfile is FindProfile served by a read replica when there is one, for
+	// display only: the profile may be slightly behind, so do not save it back
+	ReadProfile(userID uint) (*models.UserProfile, error)
+	SaveProfile(profile *models.UserProfile) error
+	// DeleteAccount removes the user's refresh tokens and profile and soft deletes the user
+	DeleteAccount(userID uint) error
+	// FindIncludingDeleted finds a user whether or not it was soft deleted
+	FindIncludingDeleted(id uint) (*models.User, error)
+	// ListDeleted returns the soft deleted users, most recently deleted first
+	ListDeleted() ([]models.User, error)
+	// RestoreAccount undeletes a soft deleted user and their profile; a deletion the user
+	// scheduled is cancelled
+	RestoreAccount(userID uint) error
+	// AnonymizeAccount replaces the user's personal data with the given placeholders and
+	// scrubs or removes the data linked to the account. The user row is kept so that
+	// references to it stay valid.
+	AnonymizeAccount(userID uint, email, username, passwordHash string) (*ErasedMedia, error)
+	// HardDeleteAccount permanently removes the user and everything linked to the account
+	HardDeleteAccount(userID uint) (*ErasedMedia, error)
+}
+
+// UserListFilter narrows the admin user list
+type UserListFilter struct {
+	OrganizationID uint   // members of this organization; 0 for every user
+	Role           string // users with this role; "" for any
+	// Attributes keeps the users whose custom attributes have all these values, in
+	// their stored form
+	Attributes map[string]string
+}
+
+// UserListVersion changes whenever a user or profile is created, updated or deleted,
+// or a member joins or leaves the filtered organization
+type UserListVersion struct {
+	Users             int
+	Profiles          int
+	Members           int
+	UsersUpdatedAt    *time.Time
+	ProfilesUpdatedAt *time.Time
+	MembersUpdatedAt  *time.Time
+}
+
+// ErasedMedia lists the stored objects of an erased account, to be removed from media storage
+type ErasedMedia struct {
+	AvatarKey  string
+	ExportKeys []string
+}
+
+// gormUserRepository sends the lists, searches and ReadProfile to the read replicas,
+// which may be nil
+type gormUserRepository struct {
+	db       *gorm.DB
+	replicas *ReadReplicas
+}
+
+func NewUserRepository(db *gorm.DB, replicas *ReadReplicas) UserRepository {
+	return &gormUserRepository{db: db, replicas: replicas}
+}
+
+func (r *gormUserRepository) FindByID(id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.First(&user, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByEmail(email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByUsername(username string) (*models.User, error) {
+	var user models.User
+	if err := r.db.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) CountByRole(role string) (int, error) {
+	var count int
+	err := r.db.Model(&models.User{}).Where("role = ?", role).Count(&count).Error
+	return count, err
+}
+
+func (r *gormUserRepository) List() ([]models.User, error) {
+	var users []models.User
+	err := r.replicas.Read(r.db, func(db *gorm.DB) error {
+		users = nil
+		return db.Find(&users).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *gormUserRepository) ListByOrganization(orgID uint) ([]models.User, error) {
+	var users []models.User
+	err := r.replicas.Read(r.db, func(db *gorm.DB) error {
+		users = nil
+		members := db.Model(&models.Membership{}).Where("organization_id = ?", orgID).Select("user_id").SubQuery()
+		return db.Where("id IN ?", members).Find(&users).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ListVersion reads from the same replicas as the lists, so the version matches them
+func (r *gormUserRepository) ListVersion(filter UserListFilter) (*UserListVersion, error) {
+	var version UserListVersion
+	err := r.replicas.Read(r.db, func(db *gorm.DB) error {
+		version = UserListVersion{}
+		err := db.Model(&models.User{}).Select("COUNT(*), MAX(updated_at)").Row().
+			Scan(&version.Users, &version.UsersUpdatedAt)
+		if err != nil {
+			return err
+		}
+		err = db.Model(&models.UserProfile{}).Select("COUNT(*), MAX(updated_at)").Row().
+			Scan(&version.Profiles, &version.ProfilesUpdatedAt)
+		if err != nil {
+			return err
+		}
+		if filter.OrganizationID != 0 {
+			return db.Model(&models.Membership{}).Where("organization_id = ?", filter.OrganizationID).
+				Select("COUNT(*), MAX(updated_at)").Row().
+				Scan(&version.Members, &version.MembersUpdatedAt)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// filtered narrows a query on users in db to those matching filter
+func filtered(db *gorm.DB, filter UserListFilter) *gorm.DB {
+	query := db
+	if filter.OrganizationID != 0 {
+		members := db.Model(&models.Membership{}).Where("organization_id = ?", filter.OrganizationID).Select("user_id").SubQuery()
+		query = query.Where("id IN ?", members)
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	for key, value := range filter.Attributes {
+		holders := db.Model(&models.UserAttribute{}).Where(`"key" = ? AND value = ?`, key, value).Select("user_id").SubQuery()
+		query = query.Where("id IN ?", holders)
+	}
+	return query
+}
+
+func (r *gormUserRepository) ListFiltered(filter UserListFilter) ([]models.User, error) {
+	var users []models.User
+	err := r.replicas.Read(r.db, func(db *gorm.DB) error {
+		users = nil
+		return filtered(db, filter).Order("id").Find(&users).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *gormUserRepository) ListPage(filter UserListFilter, afterID uint, limit int) ([]models.User, error) {
+	var users []models.User
+	err := r.replicas.Read(r.db, func(db *gorm.DB) error {
+		users = nil
+		return filtered(db, filter).Where("id > ?", afterID).Order("id").Limit(limit).Find(&users).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *gormUserRepository) FindProfiles(userIDs []uint) ([]models.UserProfile, error) {
+	var profiles []models.UserProfile
+	err := r.replicas.Read(r.db, func(db *gorm.DB) error {
+		profiles = nil
+		return db.Where("user_id IN (?)", userIDs).Find(&profiles).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+func (r *gormUserRepository) Create(user *models.User) error {
+	return translateError(r.db.Create(user).Error)
+}
+
+func (r *gormUserRepository) Save(user *models.User) error {
+	return translateError(r.db.Save(user).Error)
+}
+
+func (r *gormUserRepository) FindProfile(userID uint) (*models.UserProfile, error) {
+	var profile models.UserProfile
+	if err := r.db.Where("user_id = ?", userID).First(&profile).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &profile, nil
+}
+
+func (r *gormUserRepository) ReadProfile(userID uint) (*models.UserProfile, error) {
+	var profile models.UserProfile
+	err := r.replicas.ReadRecent(r.db, func(db *gorm.DB) error {
+		profile = models.UserProfile{}
+		return db.Where("user_id = ?", userID).First(&profile).Error
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &profile, nil
+}
+
+func (r *gormUserRepository) SaveAs(user *models.User, actorID uint) error {
+	return translateError(r.db.Set(models.ActorKey, actorID).Save(user).Error)
+}
+
+func (r *gormUserRepository) LiftExpiredSuspensions(now time.Time) (int64, error) {
+	result := r.db.Model(&models.User{}).
+		Where("status = ? AND suspended_until IS NOT NULL AND suspended_until <= ?", models.UserStatusSuspended, now).
+		UpdateColumns(map[string]interface{}{
+			"status":            models.UserStatusActive,
+			"suspension_reason": "",
+			"suspended_at":      nil,
+			"suspended_until":   nil,
+		})
+	return result.RowsAffected, result.Error
+}
+
+func (r *gormUserRepository) ListDeletionsDue(now time.Time) ([]models.User, error) {
+	var users []models.User
+	err := r.db.Where("status = ? AND deletion_scheduled_at <= ?", models.UserStatusPendingDeletion, now).
+		Order("deletion_scheduled_at").Find(&users).Error
+	return users, err
+}
+
+func (r *gormUserRepository) SaveProfile(profile *models.UserProfile) error {
+	return r.db.Save(profile).Error
+}
+
+func (r *gormUserRepository) DeleteAccount(userID uint) error {
+	tx := r.db.Begin()
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RefreshToken{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Delete loaded rows rather than by condition so the model hooks see what is removed
+	var profile models.UserProfile
+	err := tx.Where("user_id = ?", userID).First(&profile).Error
+	if err == nil {
+		err = tx.Delete(&profile).Error
+	}
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return err
+	}
+
+	var user models.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		tx.Rollback()
+		return translateError(err)
+	}
+	if err := tx.Delete(&user).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func (r *gormUserRepository) FindIncludingDeleted(id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.Unscoped().First(&user, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) ListDeleted() ([]models.User, error) {
+	var users []models.User
+	err := r.db.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&users).Error
+	return users, err
+}
+
+func (r *gormUserRepository) RestoreAccount(userID uint) error {
+	tx := r.db.Begin()
+
+	// UpdateColumn skips the model hooks; the caller records the restore in the audit trail
+	result := tx.Unscoped().Model(&models.User{}).Where("id = ? AND deleted_at IS NOT NULL", userID).UpdateColumn("deleted_at", nil)
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return ErrNotFound
+	}
+	if err := tx.Unscoped().Model(&models.UserProfile{}).Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		UpdateColumn("deleted_at", nil).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	// Accounts erased when their deletion grace period ended come back active
+	if err := tx.Model(&models.User{}).Where("id = ? AND status = ?", userID, models.UserStatusPendingDeletion).
+		UpdateColumns(map[string]interface{}{"status": models.UserStatusActive, "deletion_scheduled_at": nil}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// erasedMedia collects the storage keys of the user's avatar and export archives
+func erasedMedia(tx *gorm.DB, userID uint) (*ErasedMedia, error) {
+	media := &ErasedMedia{}
+
+	var profile models.UserProfile
+	err := tx.Unscoped().Where("user_id = ?", userID).First(&profile).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	media.AvatarKey = profile.AvatarKey
+
+	if err := tx.Unscoped().Model(&models.ExportJob{}).Where("user_id = ? AND storage_key <> ''", userID).
+		Pluck("storage_key", &media.ExportKeys).Error; err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// deleteCredentials removes everything that lets the account sign in or be used
+func deleteCredentials(tx *gorm.DB, userID uint) error {
+	keyIDs := tx.Unscoped().Model(&models.APIKey{}).Where("user_id = ?", userID).Select("id").SubQuery()
+	steps := []*gorm.DB{
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RefreshToken{}),
+		tx.Unscoped().Where("api_key_id IN ?", keyIDs).Delete(&models.APIKeyUsage{}),
+		tx.Unscoped().Where("api_key_id IN ?", keyIDs).Delete(&models.APIKeyFingerprint{}),
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.APIKey{}),
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.ShareToken{}),
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.ExportJob{}),
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.KnownLogin{}),
+		tx.Where("user_id = ?", userID).Delete(&models.LoginEvent{}),
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.PasswordReset{}),
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.EmailChange{}),
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.AccountReactivation{}),
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.DeviceConfirmation{}),
+		tx.Where("user_id = ?", userID).Delete(&models.TrustedDevice{}),
+		tx.Where("user_id = ?", userID).Delete(&models.ExternalLogin{}),
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.ExternalLoginConfirmation{}),
+		tx.Where("user_id = ?", userID).Delete(&models.LoginLocation{}),
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.PasswordHistory{}),
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.NotificationPreferences{}),
+		tx.Where("user_id = ?", userID).Delete(&models.UserSettings{}),
+		tx.Where("user_id = ?", userID).Delete(&models.Membership{}),
+		tx.Unscoped().Where("from_user_id = ? OR to_user_id = ?", userID, userID).Delete(&models.OwnershipTransfer{}),
+		tx.Where("user_id = ?", userID).Delete(&models.GroupMember{}),
+	}
+	for _, step := range steps {
+		if step.Error != nil {
+			return step.Error
+		}
+	}
+	return nil
+}
+
+func (r *gormUserRepository) UpdatePasswordHash(userID uint, oldHash, newHash string) error {
+	return r.db.Model(&models.User{}).Where("id = ? AND password_hash = ?", userID, oldHash).
+		UpdateColumn("password_hash", newHash).Error
+}
+
+func (r *gormUserRepository) AnonymizeAccount(userID uint, email, username, passwordHash string) (*ErasedMedia, error) {
+	tx := r.db.Begin()
+
+	var user models.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		tx.Rollback()
+		return nil, translateError(err)
+	}
+	originalEmail := user.Email
+
+	media, err := erasedMedia(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := deleteCredentials(tx, userID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	now := time.Now()
+	user.Email = email
+	user.Username = username
+	user.PasswordHash = passwordHash
+	user.EmailVerified = false
+	user.AnonymizedAt = &now
+	if err := tx.Save(&user).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var profile models.UserProfile
+	err = tx.Where("user_id = ?", userID).First(&profile).Error
+	if err == nil {
+		profile.FirstName, profile.LastName, profile.Bio = "", "", ""
+		profile.AvatarURL, profile.AvatarKey = "", ""
+		profile.PreferredName, profile.Pronouns, profile.Honorific, profile.Timezone = "", "", "", ""
+		err = tx.Save(&profile).Error
+	}
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Free text linked to the account may contain personal data; the model hooks above
+	// also recorded the old values, so this runs last
+	steps := []*gorm.DB{
+		tx.Unscoped().Model(&models.AuditEntry{}).Where("user_id = ?", userID).Update("changes", "{}"),
+		tx.Unscoped().Model(&models.SecurityEvent{}).Where("user_id = ?", userID).Update("details", "{}"),
+		tx.Unscoped().Model(&models.EmailEvent{}).Where("recipient = ?", originalEmail).Update("recipient", email),
+		tx.Where("user_id = ?", userID).Delete(&models.UserAttribute{}),
+	}
+	for _, step := range steps {
+		if step.Error != nil {
+			tx.Rollback()
+			return nil, step.Error
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+func (r *gormUserRepository) HardDeleteAccount(userID uint) (*ErasedMedia, error) {
+	tx := r.db.Begin()
+
+	var user models.User
+	if err := tx.Unscoped().First(&user, userID).Error; err != nil {
+		tx.Rollback()
+		return nil, translateError(err)
+	}
+
+	media, err := erasedMedia(tx, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := deleteCredentials(tx, userID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var profile models.UserProfile
+	err = tx.Unscoped().Where("user_id = ?", userID).First(&profile).Error
+	if err == nil {
+		err = tx.Unscoped().Delete(&profile).Error
+	}
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Unscoped().Delete(&user).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Runs after the deletes so the entries written by the model hooks go as well. The
+	// pending user.deleted event is kept, holding nothing but the ID, so subscribers
+	// learn to erase the user too.
+	steps := []*gorm.DB{
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.AuditEntry{}),
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.SecurityEvent{}),
+		tx.Unscoped().Where("user_id = ? AND NOT (event = ? AND status = ?)", userID, "user.deleted", models.WebhookEventPending).Delete(&models.WebhookEvent{}),
+		tx.Unscoped().Where("user_id = ?", userID).Delete(&models.TokenRevocation{}),
+		tx.Unscoped().Where("recipient = ?", user.Email).Delete(&models.EmailEvent{}),
+		tx.Where("user_id = ?", userID).Delete(&models.UserAttribute{}),
+	}
+	for _, step := range steps {
+		if step.Error != nil {
+			tx.Rollback()
+			return nil, step.Error
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return media, nil
+}
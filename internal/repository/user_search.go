@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"api/internal/models"
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// profileNameSQL is the full name a search matches. Queries must use the same
+// expression as the indexes for Postgres to use them.
+const profileNameSQL = `(coalesce(first_name, '') || ' ' || coalesce(last_name, ''))`
+
+// userSearchIndexes back the trigram (fuzzy) and full text matches of Search
+var userSearchIndexes = []string{
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+	`CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING gin (email gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (username gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_user_profiles_name_trgm ON user_profiles USING gin (` + profileNameSQL + ` gin_trgm_ops)`,
+	`CREATE INDEX IF NOT EXISTS idx_user_profiles_name_fts ON user_profiles USING gin (to_tsvector('simple', ` + profileNameSQL + `))`,
+}
+
+// CreateUserSearchIndexes installs the pg_trgm extension and the indexes used by user
+// search on Postgres. It is safe to run on every start.
+func CreateUserSearchIndexes(db *gorm.DB) error {
+	for _, statement := range userSearchIndexes {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("%s: %w", statement, err)
+		}
+	}
+	return nil
+}
+
+// UserSearchMatch is a user found by a search and the relevance of the match
+type UserSearchMatch struct {
+	User    models.User
+	Profile *models.UserProfile // nil for users without a profile
+	Score   float64
+}
+
+func (r *gormUserRepository) Search(filter UserListFilter, query string, limit int) ([]UserSearchMatch, error) {
+	var sql string
+	var args []interface{}
+	if r.db.Dialect().GetName() == "postgres" {
+		sql, args = trigramSearch(query)
+	} else {
+		sql, args = likeSearch(query)
+	}
+	if filter.OrganizationID != 0 {
+		sql += ` AND u.id IN (SELECT user_id FROM memberships WHERE organization_id = ?)`
+		args = append(args, filter.OrganizationID)
+	}
+	sql += ` ORDER BY score DESC, u.id LIMIT ?`
+	args = append(args, limit)
+
+	var ranked []struct {
+		ID    uint
+		Score float64
+	}
+	var ids []uint
+	var users []models.User
+	err := r.replicas.Read(r.db, func(db *gorm.DB) error {
+		ranked, ids, users = nil, nil, nil
+		if err := db.Raw(sql, args...).Scan(&ranked).Error; err != nil {
+			return err
+		}
+		if len(ranked) == 0 {
+			return nil
+		}
+		ids = make([]uint, len(ranked))
+		for i, match := range ranked {
+			ids[i] = match.ID
+		}
+		return db.Where("id IN (?)", ids).Find(&users).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ranked) == 0 {
+		return nil, nil
+	}
+	profiles, err := r.FindProfiles(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*models.User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+	byUser := make(map[uint]*models.UserProfile, len(profiles))
+	for i := range profiles {
+		byUser[profiles[i].UserID] = &profiles[i]
+	}
+
+	matches := make([]UserSearchMatch, 0, len(ranked))
+	for _, match := range ranked {
+		// A user deleted between the two queries is left out
+		if user := byID[match.ID]; user != nil {
+			matches = append(matches, UserSearchMatch{User: *user, Profile: byUser[match.ID], Score: match.Score})
+		}
+	}
+	return matches, nil
+}
+
+// trigramSearch is the Postgres search query, up to the filters
+func trigramSearch(query string) (string, []interface{}) {
+	// Trigram similarity finds misspellings and partial words, the full text match
+	// finds the name's words in any order; the best of them ranks the user
+	sql := `SELECT u.id,
+		GREATEST(similarity(u.email, ?), word_similarity(?, u.email),
+			similarity(u.username, ?), word_similarity(?, u.username),
+			similarity(` + profileNameSQL + `, ?), word_similarity(?, ` + profileNameSQL + `))
+		+ coalesce(ts_rank(to_tsvector('simple', ` + profileNameSQL + `), plainto_tsquery('simple', ?)), 0) AS score
+	FROM users u LEFT JOIN user_profiles p ON p.user_id = u.id AND p.deleted_at IS NULL
+	WHERE u.deleted_at IS NULL AND (u.email % ? OR ? <% u.email OR u.username % ? OR ? <% u.username
+		OR ` + profileNameSQL + ` % ? OR ? <% ` + profileNameSQL + `
+		OR to_tsvector('simple', ` + profileNameSQL + `) @@ plainto_tsquery('simple', ?))`
+	args := []interface{}{query, query, query, query, query, query, query,
+		query, query, query, query, query, query, query}
+	return sql, args
+}
+
+// likeEscape escapes the LIKE wildcards of a search word, with ESCAPE '!' which reads
+// the same in MySQL and SQLite
+var likeEscape = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// likeSearch is the search query of MySQL and SQLite, which have no trigram matching:
+// every word of query must be part of the email, username or name. Exact and prefix
+// matches of the whole query rank first.
+func likeSearch(query string) (string, []interface{}) {
+	lowered := strings.ToLower(strings.TrimSpace(query))
+	prefix := likeEscape.Replace(lowered) + "%"
+	sql := `SELECT u.id,
+		CASE WHEN LOWER(u.email) = ? OR LOWER(u.username) = ? THEN 1
+			WHEN LOWER(u.email) LIKE ? ESCAPE '!' OR LOWER(u.username) LIKE ? ESCAPE '!'
+				OR LOWER(` + profileNameSQL + `) LIKE ? ESCAPE '!' THEN 0.75
+			ELSE 0.5 END AS score
+	FROM users u LEFT JOIN user_profiles p ON p.user_id = u.id AND p.deleted_at IS NULL
+	WHERE u.deleted_at IS NULL`
+	args := []interface{}{lowered, lowered, prefix, prefix, prefix}
+	for _, word := range strings.Fields(lowered) {
+		contains := "%" + likeEscape.Replace(word) + "%"
+		sql += ` AND (LOWER(u.email) LIKE ? ESCAPE '!' OR LOWER(u.username) LIKE ? ESCAPE '!'
+		OR LOWER(` + profileNameSQL + `) LIKE ? ESCAPE '!')`
+		args = append(args, contains, contains, contains)
+	}
+	return sql, args
+}
@@ -0,0 +1,201 @@
+package revocation
+
+import (
+	"api/internal/models"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+// Invalidator is told about new revocations, including those made by other instances,
+// so caches of validated tokens can drop them
+type Invalidator interface {
+	Invalidate(jti string)
+	InvalidateUser(userID uint)
+}
+
+// Store is a DB-backed access token blacklist with an in-memory cache, so the
+// per-request check never touches the database. The cache is reloaded
+// periodically to pick up revocations made by other instances.
+type Store struct {
+	db     *gorm.DB
+	logger *logrus.Logger
+
+	mu           sync.RWMutex
+	tokenTTL     time.Duration
+	revoked      map[string]time.Time // jti -> expiry
+	userCutoff   map[uint]time.Time   // user ID -> tokens issued before are revoked
+	invalidators []Invalidator
+}
+
+// NewStore creates a store; tokenTTL is the access token lifetime, after which revocations can be forgotten
+func NewStore(db *gorm.DB, logger *logrus.Logger, tokenTTL time.Duration) (*Store, error) {
+	s := &Store{
+		db:         db,
+		logger:     logger,
+		tokenTTL:   tokenTTL,
+		revoked:    map[string]time.Time{},
+		userCutoff: map[uint]time.Time{},
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Subscribe registers an invalidator for every later revocation
+func (s *Store) Subscribe(inv Invalidator) {
+	s.mu.Lock()
+	s.invalidators = append(s.invalidators, inv)
+	s.mu.Unlock()
+}
+
+// SetTokenTTL updates the access token lifetime after a configuration change. It only
+// ever grows: tokens issued under a longer lifetime are still in circulation.
+func (s *Store) SetTokenTTL(tokenTTL time.Duration) {
+	s.mu.Lock()
+	if tokenTTL > s.tokenTTL {
+		s.tokenTTL = tokenTTL
+	}
+	s.mu.Unlock()
+}
+
+// Revoke blacklists a single access token until it expires
+func (s *Store) Revoke(jti string, userID uint, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+	entry := models.TokenRevocation{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.db.Create(&entry).Error; err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.revoked[jti] = expiresAt
+	invalidators := s.invalidators
+	s.mu.Unlock()
+
+	for _, inv := range invalidators {
+		inv.Invalidate(jti)
+	}
+	return nil
+}
+
+// RevokeUser invalidates every access token of the user issued until now
+func (s *Store) RevokeUser(userID uint) error {
+	// Token iat claims and the stored cutoff have microsecond precision; a token issued
+	// in the same microsecond is revoked too
+	cutoff := time.Now().Truncate(time.Microsecond).Add(time.Microsecond)
+	s.mu.RLock()
+	tokenTTL := s.tokenTTL
+	s.mu.RUnlock()
+	entry := models.TokenRevocation{
+		UserID:       userID,
+		IssuedBefore: &cutoff,
+		ExpiresAt:    cutoff.Add(tokenTTL),
+	}
+	if err := s.db.Create(&entry).Error; err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if cutoff.After(s.userCutoff[userID]) {
+		s.userCutoff[userID] = cutoff
+	}
+	invalidators := s.invalidators
+	s.mu.Unlock()
+
+	for _, inv := range invalidators {
+		inv.InvalidateUser(userID)
+	}
+	return nil
+}
+
+// IsRevoked reports whether the token identified by jti, issued to userID at issuedAt, was revoked
+func (s *Store) IsRevoked(jti string, userID uint, issuedAt time.Time) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.revoked[jti]; ok && jti != "" {
+		return true
+	}
+	if cutoff, ok := s.userCutoff[userID]; ok && issuedAt.Before(cutoff) {
+		return true
+	}
+	return false
+}
+
+// Reload replaces the cache with the unexpired revocations from the database
+func (s *Store) Reload() error {
+	var entries []models.TokenRevocation
+	if err := s.db.Where("expires_at > ?", time.Now()).Find(&entries).Error; err != nil {
+		return err
+	}
+
+	revoked := make(map[string]time.Time, len(entries))
+	userCutoff := map[uint]time.Time{}
+	for _, e := range entries {
+		if e.IssuedBefore != nil {
+			if e.IssuedBefore.After(userCutoff[e.UserID]) {
+				userCutoff[e.UserID] = *e.IssuedBefore
+			}
+			continue
+		}
+		revoked[e.JTI] = e.ExpiresAt
+	}
+
+	s.mu.Lock()
+	// Revocations made by other instances since the last reload
+	var newJTIs []string
+	for jti := range revoked {
+		if _, ok := s.revoked[jti]; !ok {
+			newJTIs = append(newJTIs, jti)
+		}
+	}
+	var newUsers []uint
+	for userID, cutoff := range userCutoff {
+		if cutoff.After(s.userCutoff[userID]) {
+			newUsers = append(newUsers, userID)
+		}
+	}
+	s.revoked = revoked
+	s.userCutoff = userCutoff
+	invalidators := s.invalidators
+	s.mu.Unlock()
+
+	for _, inv := range invalidators {
+		for _, jti := range newJTIs {
+			inv.Invalidate(jti)
+		}
+		for _, userID := range newUsers {
+			inv.InvalidateUser(userID)
+		}
+	}
+	return nil
+}
+
+// Run reloads the cache every interval and purges expired rows until stop is closed
+func (s *Store) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.db.Unscoped().Where("expires_at <= ?", time.Now()).Delete(&models.TokenRevocation{}).Error; err != nil {
+				s.logger.WithError(err).Error("Failed to purge expired token revocations")
+			}
+			if err := s.Reload(); err != nil {
+				s.logger.WithError(err).Error("Failed to reload token revocations")
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package revocation_test
+
+import (
+	"api/internal/auth"
+	"api/internal/revocation"
+	"api/testutil"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// issuedAt is the issue time a token created at t carries, after its round trip
+// through the iat claim
+func issuedAt(t time.Time) time.Time {
+	return auth.IssuedAt(auth.IssuedAtClaim(t))
+}
+
+func TestRevokeUserSparesTokensIssuedAfter(t *testing.T) {
+	logger := logrus.New()
+	db := testutil.OpenDatabase(t, logger)
+	store, err := revocation.NewStore(db, logger, 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now()
+	time.Sleep(time.Millisecond)
+	if err := store.RevokeUser(1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	after := time.Now() // within the second of the revocation, almost always
+
+	// Another instance reads the cutoff back from the database
+	reloaded, err := revocation.NewStore(db, logger, 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]*revocation.Store{"store": store, "reloaded": reloaded} {
+		if !s.IsRevoked("", 1, issuedAt(before)) {
+			t.Errorf("%s: token issued before the revocation is not revoked", name)
+		}
+		if s.IsRevoked("", 1, issuedAt(after)) {
+			t.Errorf("%s: token issued after the revocation is revoked", name)
+		}
+		if s.IsRevoked("", 2, issuedAt(before)) {
+			t.Errorf("%s: token of another user is revoked", name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package secrets
+
+import (
+	"api/internal/awssig"
+	"api/internal/telemetry"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// AWSConfig reads a secret from AWS Secrets Manager. The secret string must be a JSON
+// object, as created for key/value pairs in the console.
+type AWSConfig struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SecretID        string // name or ARN of the secret
+	Endpoint        string // optional override, defaults to the regional endpoint
+}
+
+type AWSProvider struct {
+	endpoint string
+	secretID string
+	creds    awssig.Credentials
+	client   *http.Client
+}
+
+func NewAWSProvider(cfg AWSConfig) (*AWSProvider, error) {
+	if cfg.Region == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" || cfg.SecretID == "" {
+		return nil, errors.New("aws secrets provider requires region, access credentials and secretId")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", cfg.Region)
+	}
+	return &AWSProvider{
+		endpoint: endpoint,
+		secretID: cfg.SecretID,
+		creds: awssig.Credentials{
+			AccessKeyID:     cfg.AccessKeyID,
+			SecretAccessKey: cfg.SecretAccessKey,
+			Region:          cfg.Region,
+			Service:         "secretsmanager",
+		},
+		client: &http.Client{Timeout: 10 * time.Second, Transport: telemetry.Transport(nil)},
+	}, nil
+}
+
+func (p *AWSProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	payload, err := json.Marshal(map[string]string{"SecretId": p.secretID})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	p.creds.SignRequest(req, awssig.SHA256Hex(payload), time.Now())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("aws secrets manager: %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+
+	var body struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("aws secrets manager: %w", err)
+	}
+	return entries(json.RawMessage(body.SecretString))
+}
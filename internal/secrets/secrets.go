@@ -0,0 +1,192 @@
+// Package secrets reads the JWT secrets and the database password from HashiCorp
+// Vault or AWS Secrets Manager instead of the configuration file, and picks up
+// rotated values while the server runs.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Values are the secrets read from the provider; an empty one was not configured
+// and keeps the value of the configuration file
+type Values struct {
+	JWTAccessSecret  string
+	JWTRefreshSecret string
+	DatabasePassword string
+}
+
+// Keys name the entries of the secret holding each value; an empty name leaves the
+// value in the configuration file
+type Keys struct {
+	JWTAccessSecret  string
+	JWTRefreshSecret string
+	DatabasePassword string
+}
+
+// Config selects and configures the provider
+type Config struct {
+	Provider string // vault or aws
+	Keys     Keys
+	Vault    VaultConfig
+	AWS      AWSConfig
+}
+
+// Provider fetches the entries of the configured secret
+type Provider interface {
+	Fetch(ctx context.Context) (map[string]string, error)
+}
+
+// NewProvider returns the provider named by cfg.Provider
+func NewProvider(cfg Config) (Provider, error) {
+	switch cfg.Provider {
+	case "vault":
+		return NewVaultProvider(cfg.Vault)
+	case "aws":
+		return NewAWSProvider(cfg.AWS)
+	default:
+		return nil, fmt.Errorf("unknown secrets provider %q", cfg.Provider)
+	}
+}
+
+// Store holds the current values and tells its subscribers when they change
+type Store struct {
+	provider Provider
+	keys     Keys
+	timeout  time.Duration
+	logger   *logrus.Logger
+
+	mu          sync.Mutex
+	current     Values
+	subscribers []func(old, next Values)
+}
+
+// Load reads the secrets once; a secret missing one of the configured keys is an error
+func Load(ctx context.Context, provider Provider, keys Keys, logger *logrus.Logger) (*Store, error) {
+	s := &Store{provider: provider, keys: keys, timeout: 10 * time.Second, logger: logger}
+	values, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.current = values
+	return s, nil
+}
+
+// Current returns the most recently read values
+func (s *Store) Current() Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// Subscribe registers fn to be called with the previous and the new values after a
+// rotation. Subscribers are called one at a time and must not block.
+func (s *Store) Subscribe(fn func(old, next Values)) {
+	s.mu.Lock()
+	s.subscribers = append(s.subscribers, fn)
+	s.mu.Unlock()
+}
+
+// Refresh reads the secrets again and notifies the subscribers when a value changed
+func (s *Store) Refresh(ctx context.Context) error {
+	next, err := s.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if next == s.current {
+		return nil
+	}
+	old := s.current
+	s.current = next
+	for _, fn := range s.subscribers {
+		fn(old, next)
+	}
+	s.logger.WithField("rotated", rotated(old, next)).Info("Secrets rotated")
+	return nil
+}
+
+// Run refreshes the secrets every interval until stop is closed. A failed refresh is
+// logged and the current values stay in use.
+func (s *Store) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.Refresh(context.Background()); err != nil {
+				s.logger.WithError(err).Error("Failed to refresh secrets, keeping the current ones")
+			}
+		}
+	}
+}
+
+func (s *Store) fetch(ctx context.Context) (Values, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	fetched, err := s.provider.Fetch(ctx)
+	if err != nil {
+		return Values{}, err
+	}
+
+	var values Values
+	var missing []error
+	lookup := func(key string) string {
+		if key == "" {
+			return ""
+		}
+		value := fetched[key]
+		if value == "" {
+			missing = append(missing, fmt.Errorf("secret has no %q entry", key))
+		}
+		return value
+	}
+	values.JWTAccessSecret = lookup(s.keys.JWTAccessSecret)
+	values.JWTRefreshSecret = lookup(s.keys.JWTRefreshSecret)
+	values.DatabasePassword = lookup(s.keys.DatabasePassword)
+	return values, errors.Join(missing...)
+}
+
+// rotated lists the names of the changed values for the log, never the values
+func rotated(old, next Values) []string {
+	var names []string
+	if old.JWTAccessSecret != next.JWTAccessSecret {
+		names = append(names, "jwtAccessSecret")
+	}
+	if old.JWTRefreshSecret != next.JWTRefreshSecret {
+		names = append(names, "jwtRefreshSecret")
+	}
+	if old.DatabasePassword != next.DatabasePassword {
+		names = append(names, "databasePassword")
+	}
+	return names
+}
+
+// entries reads a JSON object of secret entries; numbers and booleans are kept as
+// their JSON text
+func entries(data json.RawMessage) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			s = string(value)
+		}
+		values[key] = s
+	}
+	return values, nil
+}
@@ -0,0 +1,95 @@
+package secrets
+
+import (
+	"api/internal/telemetry"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultConfig reads a secret from a HashiCorp Vault KV secrets engine
+type VaultConfig struct {
+	Address   string // e.g. https://vault.example.com:8200
+	Token     string
+	Namespace string // Vault Enterprise namespace, optional
+	Mount     string // mount path of the KV engine, "secret" by default
+	Path      string // path of the secret below the mount
+	KVVersion int    // 1 or 2 (default)
+}
+
+type VaultProvider struct {
+	url       string
+	token     string
+	namespace string
+	kvVersion int
+	client    *http.Client
+}
+
+func NewVaultProvider(cfg VaultConfig) (*VaultProvider, error) {
+	if cfg.Address == "" || cfg.Token == "" || cfg.Path == "" {
+		return nil, errors.New("vault secrets provider requires address, token and path")
+	}
+	mount := strings.Trim(cfg.Mount, "/")
+	if mount == "" {
+		mount = "secret"
+	}
+	kvVersion := cfg.KVVersion
+	if kvVersion == 0 {
+		kvVersion = 2
+	}
+	path := strings.Trim(cfg.Path, "/")
+	url := strings.TrimRight(cfg.Address, "/") + "/v1/" + mount + "/" + path
+	if kvVersion == 2 {
+		url = strings.TrimRight(cfg.Address, "/") + "/v1/" + mount + "/data/" + path
+	}
+	return &VaultProvider{
+		url:       url,
+		token:     cfg.Token,
+		namespace: cfg.Namespace,
+		kvVersion: kvVersion,
+		client:    &http.Client{Timeout: 10 * time.Second, Transport: telemetry.Transport(nil)},
+	}, nil
+}
+
+func (p *VaultProvider) Fetch(ctx context.Context) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault: %s", resp.Status)
+	}
+
+	// KV version 2 nests the entries in a second "data" next to the version metadata
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+	data := body.Data
+	if p.kvVersion == 2 {
+		var versioned struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &versioned); err != nil {
+			return nil, fmt.Errorf("vault: %w", err)
+		}
+		data = versioned.Data
+	}
+	return entries(data)
+}
@@ -0,0 +1,449 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrInvalidEmailChangeToken  = errors.New("invalid or expired email change token")
+	ErrEmailUnchanged           = errors.New("new email is the current email")
+	ErrInvalidReactivationToken = errors.New("invalid or expired reactivation token")
+)
+
+// UsernameCooldownError is returned when the username was changed too recently
+type UsernameCooldownError struct {
+	RetryAt time.Time
+}
+
+func (e *UsernameCooldownError) Error() string {
+	return "username was changed recently; retry after " + e.RetryAt.UTC().Format(time.RFC3339)
+}
+
+// Security event types recorded for account changes
+const (
+	EventEmailChangeRequested  = "email_change_requested"
+	EventEmailChanged          = "email_changed"
+	EventUsernameChanged       = "username_changed"
+	EventAccountDeactivated    = "account_deactivated"
+	EventReactivationRequested = "account_reactivation_requested"
+	EventAccountReactivated    = "account_reactivated"
+	EventDeletionScheduled     = "account_deletion_scheduled"
+	EventDeletionUndone        = "account_deletion_undone"
+)
+
+// AccountConfig holds the settings for changing an account's email and username, for
+// reactivating it and for undoing its deletion
+type AccountConfig struct {
+	EmailChangeURL         string        // the token is appended to this link
+	EmailChangeTokenTTL    time.Duration // how long a confirmation link stays valid
+	UsernameCooldown       time.Duration // minimum time between renames; 0 disables
+	ReactivationURL        string        // the token is appended to this link
+	ReactivationTokenTTL   time.Duration
+	ReactivationMaxPerHour int // reactivation emails per account and hour
+	// DeletionGracePeriod is how long deleted accounts can be restored; 0 erases them at once
+	DeletionGracePeriod time.Duration
+	DeletionUndoURL     string // the token is appended to this link
+}
+
+// AccountService changes the identifiers of an account, its email address and
+// username, lets users deactivate and reactivate it, and holds deleted accounts for a
+// grace period
+type AccountService interface {
+	// RequestEmailChange checks the password and mails a confirmation link to newEmail.
+	// The address only changes once the link is confirmed; the current address is warned.
+	RequestEmailChange(userID uint, password, newEmail string, client ClientInfo) error
+	// ConfirmEmailChange switches the account to the address the token was sent to
+	ConfirmEmailChange(token string, client ClientInfo) (*models.User, error)
+	// ChangeUsername renames the user, at most once per configured cooldown
+	ChangeUsername(userID uint, username string, client ClientInfo) (*models.User, error)
+	// Deactivate disables sign-in and ends every session while keeping the account's data
+	Deactivate(userID uint, client ClientInfo) error
+	// RequestReactivation mails a reactivation link to a deactivated account, or the link
+	// undoing the deletion to an account pending deletion; it is called when the account
+	// holder signs in
+	RequestReactivation(user *models.User, client ClientInfo) error
+	// Reactivate makes the account the token was sent for active again
+	Reactivate(token string, client ClientInfo) (*models.User, error)
+	// DeletionGracePeriod is how long deleted accounts can be restored; 0 erases them at once
+	DeletionGracePeriod() time.Duration
+	// ScheduleDeletion ends every session and mails a link undoing the deletion. The
+	// account is erased once the grace period has passed.
+	ScheduleDeletion(userID uint, client ClientInfo) (*models.User, error)
+}
+
+type accountService struct {
+	users         repository.UserRepository
+	changes       repository.EmailChangeRepository
+	reactivations repository.ReactivationRepository
+	tokens        repository.TokenRepository
+	events        repository.SecurityEventRepository
+	emails        EmailService
+	notifications NotificationService
+	revoker       TokenRevoker
+	config        AccountConfig
+	logger        *logrus.Logger
+}
+
+func NewAccountService(users repository.UserRepository, changes repository.EmailChangeRepository, reactivations repository.ReactivationRepository, tokens repository.TokenRepository, events repository.SecurityEventRepository, emails EmailService, notifications NotificationService, revoker TokenRevoker, config AccountConfig, logger *logrus.Logger) AccountService {
+	return &accountService{
+		users:         users,
+		changes:       changes,
+		reactivations: reactivations,
+		tokens:        tokens,
+		events:        events,
+		emails:        emails,
+		notifications: notifications,
+		revoker:       revoker,
+		config:        config,
+		logger:        logger,
+	}
+}
+
+func (s *accountService) findUser(userID uint) (*models.User, error) {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	return user, nil
+}
+
+func (s *accountService) RequestEmailChange(userID uint, password, newEmail string, client ClientInfo) error {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return err
+	}
+	if err := auth.ComparePasswords(user.PasswordHash, password); err != nil {
+		return ErrIncorrectPassword
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return ErrEmailUnchanged
+	}
+	// Checked again by the unique constraint on confirmation
+	if _, err := s.users.FindByEmail(newEmail); err == nil {
+		return ErrEmailTaken
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("find user: %w", err)
+	}
+
+	token, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	change := &models.EmailChange{
+		UserID:      user.ID,
+		NewEmail:    newEmail,
+		TokenDigest: auth.HashToken(token),
+		ExpiresAt:   now.Add(s.config.EmailChangeTokenTTL),
+	}
+	if err := s.changes.Create(change); err != nil {
+		return fmt.Errorf("create email change: %w", err)
+	}
+
+	messageID, err := s.emails.SendToUser("email_change", user, newEmail, map[string]interface{}{
+		"Username":   user.Username,
+		"ConfirmURL": s.config.EmailChangeURL + token,
+		"ExpiresIn":  s.config.EmailChangeTokenTTL.String(),
+		"Time":       now,
+	})
+	if err != nil {
+		return fmt.Errorf("send email change confirmation: %w", err)
+	}
+	s.notifications.EmailChangeRequested(user, newEmail)
+
+	s.recordEvent(user.ID, EventEmailChangeRequested, client, map[string]interface{}{"messageId": messageID})
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"message_id": messageID,
+	}).Info("Email change confirmation queued")
+	return nil
+}
+
+func (s *accountService) ConfirmEmailChange(token string, client ClientInfo) (*models.User, error) {
+	change, err := s.changes.FindByDigest(auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidEmailChangeToken
+		}
+		return nil, fmt.Errorf("find email change: %w", err)
+	}
+	now := time.Now()
+	if change.ConfirmedAt != nil || !now.Before(change.ExpiresAt) {
+		return nil, ErrInvalidEmailChangeToken
+	}
+
+	user, err := s.users.FindByID(change.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidEmailChangeToken
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+
+	claimed, err := s.changes.MarkConfirmed(change, now)
+	if err != nil {
+		return nil, fmt.Errorf("claim email change: %w", err)
+	}
+	if !claimed {
+		return nil, ErrInvalidEmailChangeToken
+	}
+
+	previous := user.Email
+	user.Email = change.NewEmail
+	// Opening the link proves the new address belongs to the user
+	user.EmailVerified = true
+	if err := s.users.Save(user); err != nil {
+		if conflict := userConflict(err); conflict != nil {
+			return nil, conflict
+		}
+		return nil, fmt.Errorf("save user: %w", err)
+	}
+
+	s.recordEvent(user.ID, EventEmailChanged, client, map[string]interface{}{"from": previous, "to": user.Email})
+	s.logger.WithField("user_id", user.ID).Info("Email address changed")
+	return user, nil
+}
+
+func (s *accountService) ChangeUsername(userID uint, username string, client ClientInfo) (*models.User, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if username == user.Username {
+		return user, nil
+	}
+
+	now := time.Now()
+	if s.config.UsernameCooldown > 0 && user.UsernameChangedAt != nil {
+		if retryAt := user.UsernameChangedAt.Add(s.config.UsernameCooldown); now.Before(retryAt) {
+			return nil, &UsernameCooldownError{RetryAt: retryAt}
+		}
+	}
+
+	previous := user.Username
+	user.Username = username
+	user.UsernameChangedAt = &now
+	if err := s.users.Save(user); err != nil {
+		if conflict := userConflict(err); conflict != nil {
+			return nil, conflict
+		}
+		return nil, fmt.Errorf("save user: %w", err)
+	}
+
+	s.recordEvent(user.ID, EventUsernameChanged, client, map[string]interface{}{"from": previous, "to": username})
+	s.logger.WithField("user_id", user.ID).Info("Username changed")
+	return user, nil
+}
+
+func (s *accountService) Deactivate(userID uint, client ClientInfo) error {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return err
+	}
+	if user.Status == models.UserStatusDeactivated {
+		return nil
+	}
+	now := time.Now()
+	user.Status = models.UserStatusDeactivated
+	user.DeactivatedAt = &now
+	if err := s.users.Save(user); err != nil {
+		return fmt.Errorf("save user: %w", err)
+	}
+
+	if err := s.tokens.DeleteByUser(userID); err != nil {
+		return fmt.Errorf("delete refresh tokens: %w", err)
+	}
+	if err := s.revoker.RevokeUser(userID); err != nil {
+		return fmt.Errorf("revoke access tokens: %w", err)
+	}
+
+	s.recordEvent(userID, EventAccountDeactivated, client, map[string]interface{}{})
+	s.logger.WithField("user_id", userID).Info("Account deactivated")
+	return nil
+}
+
+func (s *accountService) RequestReactivation(user *models.User, client ClientInfo) error {
+	now := time.Now()
+	recent, err := s.reactivations.CountSince(user.ID, now.Add(-time.Hour))
+	if err != nil {
+		return fmt.Errorf("count reactivation requests: %w", err)
+	}
+	if recent >= s.config.ReactivationMaxPerHour {
+		s.logger.WithField("user_id", user.ID).Warn("Reactivation requests throttled")
+		return nil
+	}
+
+	messageID, err := s.mailReactivation(user, now)
+	if err != nil {
+		return err
+	}
+	s.recordEvent(user.ID, EventReactivationRequested, client, map[string]interface{}{"messageId": messageID})
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"message_id": messageID,
+	}).Info("Reactivation email queued")
+	return nil
+}
+
+// mailReactivation mails a single-use link reactivating the account. Accounts pending
+// deletion get the undo email instead, with a link valid until the deletion.
+func (s *accountService) mailReactivation(user *models.User, now time.Time) (string, error) {
+	token, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	template := "reactivation"
+	expiresAt := now.Add(s.config.ReactivationTokenTTL)
+	data := map[string]interface{}{
+		"Username":      user.Username,
+		"ReactivateURL": s.config.ReactivationURL + token,
+		"ExpiresIn":     s.config.ReactivationTokenTTL.String(),
+		"Time":          now,
+	}
+	if user.Status == models.UserStatusPendingDeletion && user.DeletionScheduledAt != nil {
+		template = "account_deletion"
+		expiresAt = *user.DeletionScheduledAt
+		data = map[string]interface{}{
+			"Username": user.Username,
+			"UndoURL":  s.config.DeletionUndoURL + token,
+			"DeleteAt": expiresAt,
+			"Time":     now,
+		}
+	}
+
+	reactivation := &models.AccountReactivation{
+		UserID:      user.ID,
+		TokenDigest: auth.HashToken(token),
+		ExpiresAt:   expiresAt,
+	}
+	if err := s.reactivations.Create(reactivation); err != nil {
+		return "", fmt.Errorf("create reactivation: %w", err)
+	}
+	messageID, err := s.emails.SendToUser(template, user, user.Email, data)
+	if err != nil {
+		return "", fmt.Errorf("send %s email: %w", template, err)
+	}
+	return messageID, nil
+}
+
+func (s *accountService) Reactivate(token string, client ClientInfo) (*models.User, error) {
+	reactivation, err := s.reactivations.FindByDigest(auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidReactivationToken
+		}
+		return nil, fmt.Errorf("find reactivation: %w", err)
+	}
+	now := time.Now()
+	if reactivation.UsedAt != nil || !now.Before(reactivation.ExpiresAt) {
+		return nil, ErrInvalidReactivationToken
+	}
+
+	user, err := s.users.FindByID(reactivation.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidReactivationToken
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	// An admin may have suspended the account since; that is not undone here
+	if user.Status != models.UserStatusDeactivated && user.Status != models.UserStatusPendingDeletion {
+		return nil, ErrInvalidReactivationToken
+	}
+
+	claimed, err := s.reactivations.MarkUsed(reactivation, now)
+	if err != nil {
+		return nil, fmt.Errorf("claim reactivation: %w", err)
+	}
+	if !claimed {
+		return nil, ErrInvalidReactivationToken
+	}
+
+	event := EventAccountReactivated
+	if user.Status == models.UserStatusPendingDeletion {
+		event = EventDeletionUndone
+	}
+	user.Status = models.UserStatusActive
+	user.DeactivatedAt = nil
+	user.DeletionScheduledAt = nil
+	if err := s.users.Save(user); err != nil {
+		return nil, fmt.Errorf("save user: %w", err)
+	}
+
+	s.recordEvent(user.ID, event, client, map[string]interface{}{})
+	s.logger.WithFields(logrus.Fields{
+		"user_id": user.ID,
+		"event":   event,
+	}).Info("Account reactivated")
+	return user, nil
+}
+
+func (s *accountService) DeletionGracePeriod() time.Duration {
+	return s.config.DeletionGracePeriod
+}
+
+func (s *accountService) ScheduleDeletion(userID uint, client ClientInfo) (*models.User, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status == models.UserStatusPendingDeletion {
+		return user, nil
+	}
+	now := time.Now()
+	deleteAt := now.Add(s.config.DeletionGracePeriod)
+	user.Status = models.UserStatusPendingDeletion
+	user.DeletionScheduledAt = &deleteAt
+	if err := s.users.Save(user); err != nil {
+		return nil, fmt.Errorf("save user: %w", err)
+	}
+
+	if err := s.tokens.DeleteByUser(userID); err != nil {
+		return nil, fmt.Errorf("delete refresh tokens: %w", err)
+	}
+	if err := s.revoker.RevokeUser(userID); err != nil {
+		return nil, fmt.Errorf("revoke access tokens: %w", err)
+	}
+
+	// The deletion stands without the email; signing in mails the link again
+	messageID, err := s.mailReactivation(user, now)
+	if err != nil {
+		s.logger.WithError(err).WithField("user_id", userID).Error("Failed to mail account deletion undo link")
+	}
+	s.recordEvent(userID, EventDeletionScheduled, client, map[string]interface{}{
+		"deleteAt":  deleteAt,
+		"messageId": messageID,
+	})
+	s.logger.WithFields(logrus.Fields{
+		"user_id":   userID,
+		"delete_at": deleteAt,
+	}).Info("Account deletion scheduled")
+	return user, nil
+}
+
+func (s *accountService) recordEvent(userID uint, eventType string, client ClientInfo, details map[string]interface{}) {
+	details["ip"] = client.IP
+	details["userAgent"] = client.UserAgent
+	payload, _ := json.Marshal(details)
+
+	if err := s.events.Create(&models.SecurityEvent{
+		UserID:   userID,
+		Type:     eventType,
+		Severity: "info",
+		Details:  string(payload),
+	}); err != nil {
+		s.logger.WithError(err).Error("Failed to record security event")
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"api/internal/repository"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Activity item kinds
+const (
+	ActivitySecurityEvent = "security_event"
+	ActivityAudit         = "audit"
+)
+
+// ActivityItem is one entry of a user's activity feed or admin timeline
+type ActivityItem struct {
+	At       time.Time
+	Kind     string // security_event or audit
+	Type     string // event type, or the audited action
+	Severity string
+	ActorID  *uint
+	Details  json.RawMessage
+}
+
+// ActivityService lists what happened to an account, newest first
+type ActivityService interface {
+	// UserActivity is the feed shown to the account owner: sign-in and password events
+	UserActivity(userID uint, limit int) ([]ActivityItem, error)
+	// AdminTimeline adds the audit trail of account changes to the security events
+	AdminTimeline(userID uint, limit int) ([]ActivityItem, error)
+}
+
+type activityService struct {
+	events repository.SecurityEventRepository
+	audit  repository.AuditRepository
+}
+
+func NewActivityService(events repository.SecurityEventRepository, audit repository.AuditRepository) ActivityService {
+	return &activityService{events: events, audit: audit}
+}
+
+func (s *activityService) UserActivity(userID uint, limit int) ([]ActivityItem, error) {
+	events, err := s.events.ListRecentByUser(userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list security events: %w", err)
+	}
+
+	items := make([]ActivityItem, 0, len(events))
+	for _, e := range events {
+		items = append(items, ActivityItem{
+			At:       e.CreatedAt,
+			Kind:     ActivitySecurityEvent,
+			Type:     e.Type,
+			Severity: e.Severity,
+			Details:  rawDetails(e.Details),
+		})
+	}
+	return items, nil
+}
+
+func (s *activityService) AdminTimeline(userID uint, limit int) ([]ActivityItem, error) {
+	items, err := s.UserActivity(userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.audit.ListRecentByUser(userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list audit entries: %w", err)
+	}
+	for _, e := range entries {
+		items = append(items, ActivityItem{
+			At:      e.CreatedAt,
+			Kind:    ActivityAudit,
+			Type:    e.Entity + "." + e.Action,
+			ActorID: e.ActorID,
+			Details: rawDetails(e.Changes),
+		})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].At.After(items[j].At) })
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+// rawDetails passes stored JSON through, replacing anything unparsable with null
+func rawDetails(details string) json.RawMessage {
+	if details == "" || !json.Valid([]byte(details)) {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(details)
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"api/internal/models"
+	"api/internal/repository"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Tables of the analytics CSV export
+const (
+	AnalyticsTableDaily   = "daily"
+	AnalyticsTableCohorts = "cohorts"
+)
+
+// ErrInvalidAnalyticsTable is returned for a CSV export of an unknown table
+var ErrInvalidAnalyticsTable = errors.New("unknown analytics table")
+
+// AnalyticsConfig sets how far the aggregation looks back
+type AnalyticsConfig struct {
+	// BackfillDays are aggregated on the first run; later runs redo the last two days
+	BackfillDays int
+	// RetentionWeeks is how many weeks after signup cohorts are followed
+	RetentionWeeks int
+	// LoginEventRetention is how long raw sign-ins are kept after aggregation
+	LoginEventRetention time.Duration
+}
+
+// AnalyticsReport holds the aggregates of the days from From to To, both included,
+// and the cohorts of the weeks starting in that period
+type AnalyticsReport struct {
+	From    time.Time
+	To      time.Time
+	Days    []models.AnalyticsDay
+	Cohorts []models.AnalyticsCohort
+}
+
+// AnalyticsService aggregates sign-ins, signups and deletions into daily figures and
+// weekly retention cohorts for admins
+type AnalyticsService interface {
+	// Aggregate computes the figures up to now. It runs as a scheduled job.
+	Aggregate(now time.Time) error
+	Report(from, to time.Time) (*AnalyticsReport, error)
+	// WriteCSV writes one table of the report: daily or cohorts
+	WriteCSV(w io.Writer, report *AnalyticsReport, table string) error
+}
+
+type analyticsService struct {
+	analytics repository.AnalyticsRepository
+	config    AnalyticsConfig
+	logger    *logrus.Logger
+}
+
+func NewAnalyticsService(analytics repository.AnalyticsRepository, config AnalyticsConfig, logger *logrus.Logger) AnalyticsService {
+	return &analyticsService{analytics: analytics, config: config, logger: logger}
+}
+
+func utcDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// weekStart returns the Monday starting the UTC week of t
+func weekStart(t time.Time) time.Time {
+	day := utcDay(t.UTC())
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+func (s *analyticsService) Aggregate(now time.Time) error {
+	today := utcDay(now.UTC())
+	start := today.AddDate(0, 0, 1-s.config.BackfillDays)
+	latest, err := s.analytics.LatestDay()
+	if err != nil {
+		return fmt.Errorf("find latest day: %w", err)
+	}
+	// The day before the latest one may have changed after it was computed
+	if latest != nil && latest.Day.AddDate(0, 0, -1).After(start) {
+		start = latest.Day.AddDate(0, 0, -1)
+	}
+
+	days := 0
+	for day := start; !day.After(today); day = day.AddDate(0, 0, 1) {
+		if err := s.aggregateDay(day, now); err != nil {
+			return fmt.Errorf("aggregate %s: %w", day.Format("2006-01-02"), err)
+		}
+		days++
+	}
+	cohorts, err := s.aggregateCohorts(today, now)
+	if err != nil {
+		return err
+	}
+
+	purged, err := s.analytics.PurgeLoginEvents(now.Add(-s.config.LoginEventRetention))
+	if err != nil {
+		return fmt.Errorf("purge login events: %w", err)
+	}
+	s.logger.WithFields(logrus.Fields{
+		"days":          days,
+		"cohorts":       cohorts,
+		"purged_events": purged,
+	}).Info("Analytics aggregated")
+	return nil
+}
+
+func (s *analyticsService) aggregateDay(day, now time.Time) error {
+	next := day.AddDate(0, 0, 1)
+	aggregate := &models.AnalyticsDay{Day: day, ComputedAt: now}
+	var err error
+	if aggregate.ActiveUsers, err = s.analytics.CountActive(day, next); err != nil {
+		return err
+	}
+	if aggregate.WeeklyActiveUsers, err = s.analytics.CountActive(day.AddDate(0, 0, -6), next); err != nil {
+		return err
+	}
+	if aggregate.Signups, err = s.analytics.CountSignups(day, next); err != nil {
+		return err
+	}
+	if aggregate.Deletions, err = s.analytics.CountDeletions(day, next); err != nil {
+		return err
+	}
+	if aggregate.TotalUsers, err = s.analytics.CountUsers(next); err != nil {
+		return err
+	}
+	return s.analytics.SaveDay(aggregate)
+}
+
+// aggregateCohorts computes the retention of the cohorts still followed. Weeks that
+// ended more than a week ago are kept once computed.
+func (s *analyticsService) aggregateCohorts(today, now time.Time) (int, error) {
+	thisWeek := weekStart(today)
+	first := thisWeek.AddDate(0, 0, -7*s.config.RetentionWeeks)
+	existing, err := s.analytics.ListCohorts(first, thisWeek.AddDate(0, 0, 7))
+	if err != nil {
+		return 0, fmt.Errorf("list cohorts: %w", err)
+	}
+	done := make(map[string]bool, len(existing))
+	for _, c := range existing {
+		done[cohortKey(c.CohortWeek.UTC(), c.WeekOffset)] = true
+	}
+
+	computed := 0
+	for cohort := first; !cohort.After(thisWeek); cohort = cohort.AddDate(0, 0, 7) {
+		cohortEnd := cohort.AddDate(0, 0, 7)
+		size := -1
+		for offset := 0; offset <= s.config.RetentionWeeks; offset++ {
+			active := cohort.AddDate(0, 0, 7*offset)
+			if active.After(thisWeek) {
+				break
+			}
+			if active.Before(thisWeek.AddDate(0, 0, -7)) && done[cohortKey(cohort, offset)] {
+				continue
+			}
+			if size < 0 {
+				if size, err = s.analytics.CountSignups(cohort, cohortEnd); err != nil {
+					return computed, fmt.Errorf("count cohort signups: %w", err)
+				}
+			}
+			retained, err := s.analytics.CountRetained(cohort, cohortEnd, active, active.AddDate(0, 0, 7))
+			if err != nil {
+				return computed, fmt.Errorf("count retained users: %w", err)
+			}
+			if err := s.analytics.SaveCohort(&models.AnalyticsCohort{
+				CohortWeek: cohort,
+				WeekOffset: offset,
+				Size:       size,
+				Retained:   retained,
+				ComputedAt: now,
+			}); err != nil {
+				return computed, fmt.Errorf("save cohort: %w", err)
+			}
+			computed++
+		}
+	}
+	return computed, nil
+}
+
+func cohortKey(week time.Time, offset int) string {
+	return week.Format("2006-01-02") + "/" + strconv.Itoa(offset)
+}
+
+func (s *analyticsService) Report(from, to time.Time) (*AnalyticsReport, error) {
+	from, to = utcDay(from), utcDay(to)
+	end := to.AddDate(0, 0, 1)
+	days, err := s.analytics.ListDays(from, end)
+	if err != nil {
+		return nil, fmt.Errorf("list days: %w", err)
+	}
+	cohorts, err := s.analytics.ListCohorts(weekStart(from), end)
+	if err != nil {
+		return nil, fmt.Errorf("list cohorts: %w", err)
+	}
+	return &AnalyticsReport{From: from, To: to, Days: days, Cohorts: cohorts}, nil
+}
+
+func (s *analyticsService) WriteCSV(w io.Writer, report *AnalyticsReport, table string) error {
+	out := csv.NewWriter(w)
+	switch table {
+	case AnalyticsTableDaily:
+		out.Write([]string{"date", "active_users", "weekly_active_users", "signups", "deletions", "total_users"})
+		for _, d := range report.Days {
+			out.Write([]string{
+				d.Day.UTC().Format("2006-01-02"),
+				strconv.Itoa(d.ActiveUsers),
+				strconv.Itoa(d.WeeklyActiveUsers),
+				strconv.Itoa(d.Signups),
+				strconv.Itoa(d.Deletions),
+				strconv.Itoa(d.TotalUsers),
+			})
+		}
+	case AnalyticsTableCohorts:
+		out.Write([]string{"cohort_week", "size", "week_offset", "retained", "retention_rate"})
+		for _, c := range report.Cohorts {
+			out.Write([]string{
+				c.CohortWeek.UTC().Format("2006-01-02"),
+				strconv.Itoa(c.Size),
+				strconv.Itoa(c.WeekOffset),
+				strconv.Itoa(c.Retained),
+				strconv.FormatFloat(RetentionRate(c), 'f', 4, 64),
+			})
+		}
+	default:
+		return ErrInvalidAnalyticsTable
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// RetentionRate is the share of the cohort retained, 0 for an empty cohort
+func RetentionRate(c models.AnalyticsCohort) float64 {
+	if c.Size == 0 {
+		return 0
+	}
+	return float64(c.Retained) / float64(c.Size)
+}
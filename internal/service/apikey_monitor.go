@@ -0,0 +1,259 @@
+package service
+
+import (
+	"api/internal/models"
+	"api/internal/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Security event types raised by the API key monitor
+const (
+	EventAPIKeyVolumeSpike  = "api_key_volume_spike"
+	EventAPIKeyNewEndpoint  = "api_key_new_endpoint"
+	EventAPIKeyNewIPRange   = "api_key_new_ip_range"
+	EventAPIKeySuspended    = "api_key_suspended"
+	fingerprintKindEndpoint = "endpoint"
+	fingerprintKindIPRange  = "ip_range"
+)
+
+var ErrAPIKeySuspended = errors.New("api key suspended")
+
+// AnomalyConfig tunes API key anomaly detection
+type AnomalyConfig struct {
+	Enabled       bool
+	VolumeFactor  float64 // flag when the current hour exceeds the baseline by this factor
+	MinRequests   int     // ignore volume spikes below this many requests per hour
+	LearningHours int     // new endpoints/IP ranges are only flagged after the key has been in use this long
+	BaselineDays  int
+	AutoSuspend   bool
+}
+
+type keyUsageState struct {
+	key           *models.APIKey
+	hour          time.Time
+	count         int
+	baseline      float64
+	volumeFlagged bool
+	endpoints     map[string]bool
+	ipRanges      map[string]bool
+}
+
+// APIKeyMonitor learns the normal request pattern of every API key and raises
+// security events on significant deviations, optionally suspending the key.
+type APIKeyMonitor struct {
+	keys   repository.APIKeyRepository
+	events repository.SecurityEventRepository
+	config AnomalyConfig
+	logger *logrus.Logger
+
+	mu    sync.Mutex
+	state map[uint]*keyUsageState
+}
+
+func NewAPIKeyMonitor(keys repository.APIKeyRepository, events repository.SecurityEventRepository, config AnomalyConfig, logger *logrus.Logger) *APIKeyMonitor {
+	return &APIKeyMonitor{
+		keys:   keys,
+		events: events,
+		config: config,
+		logger: logger,
+		state:  map[uint]*keyUsageState{},
+	}
+}
+
+// ipRange reduces an address to its /24 (IPv4) or /48 (IPv6) network
+func ipRange(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// Observe records one request made with an API key. It returns ErrAPIKeySuspended
+// when the key is (or just became) suspended and the request must be rejected.
+func (m *APIKeyMonitor) Observe(keyID uint, route, ip string) error {
+	if !m.config.Enabled {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, err := m.loadState(keyID)
+	if err != nil {
+		return err
+	}
+	if st.key.SuspendedAt != nil {
+		return ErrAPIKeySuspended
+	}
+
+	now := time.Now()
+	hour := now.Truncate(time.Hour)
+	if !hour.Equal(st.hour) {
+		m.flush(keyID, st)
+		st.hour = hour
+		st.count = 0
+		st.volumeFlagged = false
+		st.baseline, err = m.keys.AverageHourlyUsage(keyID, hour.AddDate(0, 0, -m.config.BaselineDays), hour)
+		if err != nil {
+			m.logger.WithError(err).Warn("Failed to compute API key usage baseline")
+		}
+	}
+	st.count++
+
+	learned := now.Sub(st.key.CreatedAt) > time.Duration(m.config.LearningHours)*time.Hour
+
+	if st.baseline > 0 && !st.volumeFlagged && st.count >= m.config.MinRequests &&
+		float64(st.count) > st.baseline*m.config.VolumeFactor {
+		st.volumeFlagged = true
+		if m.flag(st, EventAPIKeyVolumeSpike, map[string]interface{}{"requests": st.count, "baseline": st.baseline}) {
+			return ErrAPIKeySuspended
+		}
+	}
+
+	if route != "" && !st.endpoints[route] {
+		st.endpoints[route] = true
+		m.remember(keyID, fingerprintKindEndpoint, route)
+		if learned && m.flag(st, EventAPIKeyNewEndpoint, map[string]interface{}{"endpoint": route}) {
+			return ErrAPIKeySuspended
+		}
+	}
+
+	if r := ipRange(ip); r != "" && !st.ipRanges[r] {
+		st.ipRanges[r] = true
+		m.remember(keyID, fingerprintKindIPRange, r)
+		if learned && m.flag(st, EventAPIKeyNewIPRange, map[string]interface{}{"ipRange": r, "ip": ip}) {
+			return ErrAPIKeySuspended
+		}
+	}
+
+	return nil
+}
+
+// Forget drops cached state for a key, e.g. after it was revoked or reinstated
+func (m *APIKeyMonitor) Forget(keyID uint) {
+	m.mu.Lock()
+	delete(m.state, keyID)
+	m.mu.Unlock()
+}
+
+// Flush persists the current hourly counters
+func (m *APIKeyMonitor) Flush() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for keyID, st := range m.state {
+		m.flush(keyID, st)
+	}
+}
+
+// Run flushes counters every interval until stop is closed
+func (m *APIKeyMonitor) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			m.Flush()
+			return
+		case <-ticker.C:
+			m.Flush()
+		}
+	}
+}
+
+func (m *APIKeyMonitor) loadState(keyID uint) (*keyUsageState, error) {
+	if st, ok := m.state[keyID]; ok {
+		return st, nil
+	}
+
+	key, err := m.keys.FindByID(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("find api key: %w", err)
+	}
+	fps, err := m.keys.ListFingerprints(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("list api key fingerprints: %w", err)
+	}
+
+	st := &keyUsageState{
+		key:       key,
+		endpoints: map[string]bool{},
+		ipRanges:  map[string]bool{},
+	}
+	for _, fp := range fps {
+		switch fp.Kind {
+		case fingerprintKindEndpoint:
+			st.endpoints[fp.Value] = true
+		case fingerprintKindIPRange:
+			st.ipRanges[fp.Value] = true
+		}
+	}
+	m.state[keyID] = st
+	return st, nil
+}
+
+func (m *APIKeyMonitor) flush(keyID uint, st *keyUsageState) {
+	if st.count == 0 {
+		return
+	}
+	if err := m.keys.SaveHourlyUsage(keyID, st.hour, st.count); err != nil {
+		m.logger.WithError(err).Warn("Failed to save API key usage")
+	}
+}
+
+func (m *APIKeyMonitor) remember(keyID uint, kind, value string) {
+	if err := m.keys.AddFingerprint(&models.APIKeyFingerprint{APIKeyID: keyID, Kind: kind, Value: value}); err != nil {
+		m.logger.WithError(err).Warn("Failed to store API key fingerprint")
+	}
+}
+
+// flag records a security event and suspends the key when configured, reporting whether it was suspended
+func (m *APIKeyMonitor) flag(st *keyUsageState, eventType string, details map[string]interface{}) bool {
+	m.recordEvent(st.key, eventType, "warning", details)
+	m.logger.WithFields(logrus.Fields{
+		"api_key_id": st.key.ID,
+		"user_id":    st.key.UserID,
+		"event":      eventType,
+		"details":    details,
+	}).Warn("API key anomaly detected")
+
+	if !m.config.AutoSuspend {
+		return false
+	}
+
+	reason := "automatic suspension: " + eventType
+	if err := m.keys.Suspend(st.key.ID, reason); err != nil {
+		m.logger.WithError(err).Error("Failed to suspend API key")
+		return false
+	}
+	now := time.Now()
+	st.key.SuspendedAt = &now
+	st.key.SuspendReason = reason
+	m.recordEvent(st.key, EventAPIKeySuspended, "critical", map[string]interface{}{"reason": reason})
+	return true
+}
+
+func (m *APIKeyMonitor) recordEvent(key *models.APIKey, eventType, severity string, details map[string]interface{}) {
+	payload, _ := json.Marshal(details)
+	keyID := key.ID
+	event := &models.SecurityEvent{
+		UserID:   key.UserID,
+		APIKeyID: &keyID,
+		Type:     eventType,
+		Severity: severity,
+		Details:  string(payload),
+	}
+	if err := m.events.Create(event); err != nil {
+		m.logger.WithError(err).Error("Failed to record security event")
+	}
+}
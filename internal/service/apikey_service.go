@@ -0,0 +1,153 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// APIKeyPrefix starts every generated key so leaked keys are easy to recognise
+const APIKeyPrefix = "umk_"
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+	ErrInvalidScope   = errors.New("invalid scope")
+)
+
+// APIKeyService manages API keys for machine clients
+type APIKeyService interface {
+	// Create returns the stored key and its plaintext value, which is never retrievable again
+	Create(userID uint, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error)
+	List(userID uint) ([]models.APIKey, error)
+	Revoke(userID, id uint) error
+	// Authenticate resolves a plaintext key to the key record and its owner
+	Authenticate(key string) (*models.APIKey, *models.User, error)
+}
+
+type apiKeyService struct {
+	keys   repository.APIKeyRepository
+	users  repository.UserRepository
+	logger *logrus.Logger
+}
+
+func NewAPIKeyService(keys repository.APIKeyRepository, users repository.UserRepository, logger *logrus.Logger) APIKeyService {
+	return &apiKeyService{
+		keys:   keys,
+		users:  users,
+		logger: logger,
+	}
+}
+
+// SplitScopes parses the comma separated scopes stored on a key
+func SplitScopes(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+	return strings.Split(scopes, ",")
+}
+
+func (s *apiKeyService) Create(userID uint, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, "", ErrUserNotFound
+		}
+		return nil, "", fmt.Errorf("find user: %w", err)
+	}
+
+	if err := checkScopes(scopes, apiKeyScopes, user); err != nil {
+		return nil, "", err
+	}
+
+	secret, err := auth.GenerateRandomToken(24)
+	if err != nil {
+		return nil, "", fmt.Errorf("generate api key: %w", err)
+	}
+	plaintext := APIKeyPrefix + secret
+
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plaintext[:len(APIKeyPrefix)+8],
+		KeyHash:   auth.HashToken(plaintext),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.keys.Create(key); err != nil {
+		return nil, "", fmt.Errorf("store api key: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    userID,
+		"api_key_id": key.ID,
+		"scopes":     key.Scopes,
+	}).Info("API key created")
+	return key, plaintext, nil
+}
+
+func (s *apiKeyService) List(userID uint) ([]models.APIKey, error) {
+	return s.keys.ListByUser(userID)
+}
+
+func (s *apiKeyService) Revoke(userID, id uint) error {
+	deleted, err := s.keys.DeleteForUser(userID, id)
+	if err != nil {
+		return fmt.Errorf("delete api key: %w", err)
+	}
+	if !deleted {
+		return ErrAPIKeyNotFound
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    userID,
+		"api_key_id": id,
+	}).Info("API key revoked")
+	return nil
+}
+
+func (s *apiKeyService) Authenticate(plaintext string) (*models.APIKey, *models.User, error) {
+	if !strings.HasPrefix(plaintext, APIKeyPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.keys.FindByHash(auth.HashToken(plaintext))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, fmt.Errorf("find api key: %w", err)
+	}
+
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if key.SuspendedAt != nil {
+		return nil, nil, ErrAPIKeySuspended
+	}
+
+	user, err := s.users.FindByID(key.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrInvalidAPIKey
+		}
+		return nil, nil, fmt.Errorf("find user: %w", err)
+	}
+
+	// Avoid a write per request for busy keys
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > time.Minute {
+		if err := s.keys.TouchLastUsed(key.ID, now); err != nil {
+			s.logger.WithError(err).Warn("Failed to update API key last used time")
+		}
+		key.LastUsedAt = &now
+	}
+
+	return key, user, nil
+}
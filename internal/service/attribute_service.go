@@ -0,0 +1,398 @@
+package service
+
+import (
+	"api/internal/models"
+	"api/internal/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrAttributeNotFound = errors.New("attribute not found")
+	// ErrInvalidAttributeDefinition is returned, wrapped with the reason, for definitions
+	// that cannot be stored
+	ErrInvalidAttributeDefinition = errors.New("invalid attribute definition")
+	// ErrInvalidAttribute is returned, wrapped with the key and reason, for values that do
+	// not match their definition; nothing is changed
+	ErrInvalidAttribute = errors.New("invalid attribute value")
+	// ErrAttributeReadOnly is returned when users set attributes they may not change
+	ErrAttributeReadOnly = errors.New("attribute cannot be changed")
+	// ErrAttributeInUse is returned for type changes of attributes users have values for
+	ErrAttributeInUse = errors.New("attribute type cannot change while users have values")
+)
+
+// attributeKeyPattern keeps keys usable as JSON fields and query parameters
+var attributeKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,63}$`)
+
+// Longest string value by default and at most
+const (
+	defaultAttributeLength = 1000
+	maxAttributeLength     = 10000
+)
+
+// AttributeDefinitionInput describes a custom attribute. Options lists the values of
+// an enum; MaxLength limits strings, 0 for the default.
+type AttributeDefinitionInput struct {
+	Type        string
+	Options     []string
+	MaxLength   int
+	UserAccess  string
+	Description string
+}
+
+// AttributeService manages custom user attributes: admins define them, then values
+// are set by admins or, when the definition allows it, by the users themselves.
+// Values are JSON strings, numbers or booleans according to the definition's type.
+type AttributeService interface {
+	ListDefinitions() ([]models.AttributeDefinition, error)
+	// Define creates or updates the definition of key and reports whether it was created.
+	// Narrowing an enum keeps values that are no longer allowed until they are changed.
+	Define(key string, input AttributeDefinitionInput) (*models.AttributeDefinition, bool, error)
+	// Delete removes the definition and every user's value of it
+	Delete(key string) error
+	// Get returns the user's values by key; self limits them to those the user may read
+	Get(userID uint, self bool) (map[string]interface{}, error)
+	// Set changes the user's values on behalf of actorID, removing those set to nil, and
+	// returns all of them. self limits changes to attributes the user may write.
+	Set(userID, actorID uint, values map[string]interface{}, self bool) (map[string]interface{}, error)
+	// Filter converts attribute values given as text, such as query parameters, to the
+	// stored form used by the user list filter
+	Filter(values map[string]string) (map[string]string, error)
+}
+
+type attributeService struct {
+	attributes repository.AttributeRepository
+	users      repository.UserRepository
+	audit      repository.AuditRepository
+	logger     *logrus.Logger
+}
+
+func NewAttributeService(attributes repository.AttributeRepository, users repository.UserRepository, audit repository.AuditRepository, logger *logrus.Logger) AttributeService {
+	return &attributeService{
+		attributes: attributes,
+		users:      users,
+		audit:      audit,
+		logger:     logger,
+	}
+}
+
+func (s *attributeService) ListDefinitions() ([]models.AttributeDefinition, error) {
+	definitions, err := s.attributes.ListDefinitions()
+	if err != nil {
+		return nil, fmt.Errorf("list attribute definitions: %w", err)
+	}
+	return definitions, nil
+}
+
+// definitions returns the definitions by key
+func (s *attributeService) definitions() (map[string]*models.AttributeDefinition, error) {
+	list, err := s.ListDefinitions()
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]*models.AttributeDefinition, len(list))
+	for i := range list {
+		byKey[list[i].Key] = &list[i]
+	}
+	return byKey, nil
+}
+
+func (s *attributeService) Define(key string, input AttributeDefinitionInput) (*models.AttributeDefinition, bool, error) {
+	if !attributeKeyPattern.MatchString(key) {
+		return nil, false, fmt.Errorf("%w: keys are 1-64 letters, digits and _, starting with a letter", ErrInvalidAttributeDefinition)
+	}
+	switch input.Type {
+	case models.AttributeString, models.AttributeNumber, models.AttributeBoolean, models.AttributeEnum:
+	default:
+		return nil, false, fmt.Errorf("%w: type must be string, number, boolean or enum", ErrInvalidAttributeDefinition)
+	}
+	switch input.UserAccess {
+	case "":
+		input.UserAccess = models.AttributeAccessNone
+	case models.AttributeAccessNone, models.AttributeAccessRead, models.AttributeAccessWrite:
+	default:
+		return nil, false, fmt.Errorf("%w: userAccess must be none, read or write", ErrInvalidAttributeDefinition)
+	}
+	if input.MaxLength < 0 || input.MaxLength > maxAttributeLength {
+		return nil, false, fmt.Errorf("%w: maxLength must be between 0 and %d", ErrInvalidAttributeDefinition, maxAttributeLength)
+	}
+	var options []string
+	if input.Type == models.AttributeEnum {
+		for _, option := range input.Options {
+			option = strings.TrimSpace(option)
+			if option == "" || strings.Contains(option, ",") {
+				return nil, false, fmt.Errorf("%w: enum options must be non-empty and not contain commas", ErrInvalidAttributeDefinition)
+			}
+			options = append(options, option)
+		}
+		if len(options) == 0 {
+			return nil, false, fmt.Errorf("%w: an enum needs options", ErrInvalidAttributeDefinition)
+		}
+	}
+
+	definition, err := s.attributes.FindDefinition(key)
+	created := errors.Is(err, repository.ErrNotFound)
+	switch {
+	case created:
+		definition = &models.AttributeDefinition{Key: key}
+	case err != nil:
+		return nil, false, fmt.Errorf("find attribute definition: %w", err)
+	case definition.Type != input.Type:
+		// Stored values are in the canonical form of the old type
+		count, err := s.attributes.CountValues(key)
+		if err != nil {
+			return nil, false, fmt.Errorf("count attribute values: %w", err)
+		}
+		if count > 0 {
+			return nil, false, ErrAttributeInUse
+		}
+	}
+	definition.Type = input.Type
+	definition.Options = strings.Join(options, ",")
+	definition.MaxLength = input.MaxLength
+	definition.UserAccess = input.UserAccess
+	definition.Description = strings.TrimSpace(input.Description)
+	if err := s.attributes.SaveDefinition(definition); err != nil {
+		return nil, false, fmt.Errorf("save attribute definition: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"key":     key,
+		"type":    definition.Type,
+		"created": created,
+	}).Info("Attribute definition saved")
+	return definition, created, nil
+}
+
+func (s *attributeService) Delete(key string) error {
+	definition, err := s.attributes.FindDefinition(key)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrAttributeNotFound
+		}
+		return fmt.Errorf("find attribute definition: %w", err)
+	}
+	if err := s.attributes.DeleteDefinition(definition); err != nil {
+		return fmt.Errorf("delete attribute definition: %w", err)
+	}
+	s.logger.WithField("key", key).Info("Attribute definition deleted")
+	return nil
+}
+
+func (s *attributeService) checkUser(userID uint) error {
+	if _, err := s.users.FindByID(userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("find user: %w", err)
+	}
+	return nil
+}
+
+func (s *attributeService) Get(userID uint, self bool) (map[string]interface{}, error) {
+	if err := s.checkUser(userID); err != nil {
+		return nil, err
+	}
+	definitions, err := s.definitions()
+	if err != nil {
+		return nil, err
+	}
+	return s.values(userID, definitions, self)
+}
+
+// values returns the user's values by key, leaving out those of deleted definitions
+// and, for self, those the user may not read
+func (s *attributeService) values(userID uint, definitions map[string]*models.AttributeDefinition, self bool) (map[string]interface{}, error) {
+	stored, err := s.attributes.ListForUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list attributes: %w", err)
+	}
+	values := make(map[string]interface{}, len(stored))
+	for _, attribute := range stored {
+		definition := definitions[attribute.Key]
+		if definition == nil || (self && definition.UserAccess == models.AttributeAccessNone) {
+			continue
+		}
+		values[attribute.Key] = decodeAttribute(definition, attribute.Value)
+	}
+	return values, nil
+}
+
+func (s *attributeService) Set(userID, actorID uint, values map[string]interface{}, self bool) (map[string]interface{}, error) {
+	if err := s.checkUser(userID); err != nil {
+		return nil, err
+	}
+	definitions, err := s.definitions()
+	if err != nil {
+		return nil, err
+	}
+
+	// Everything is checked before anything is stored
+	set := map[string]string{}
+	var remove []string
+	for key, value := range values {
+		definition := definitions[key]
+		if definition == nil {
+			return nil, fmt.Errorf("%w: %s is not a defined attribute", ErrInvalidAttribute, key)
+		}
+		if self && definition.UserAccess != models.AttributeAccessWrite {
+			return nil, fmt.Errorf("%w: %s", ErrAttributeReadOnly, key)
+		}
+		if value == nil {
+			remove = append(remove, key)
+			continue
+		}
+		encoded, err := encodeAttribute(definition, value)
+		if err != nil {
+			return nil, err
+		}
+		set[key] = encoded
+	}
+
+	before, err := s.values(userID, definitions, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attributes.SetForUser(userID, set, remove); err != nil {
+		return nil, fmt.Errorf("save attributes: %w", err)
+	}
+	after, err := s.values(userID, definitions, self)
+	if err != nil {
+		return nil, err
+	}
+	s.auditChanges(userID, actorID, definitions, before, set, remove)
+	return after, nil
+}
+
+// auditChanges records the changed values in the user's audit trail
+func (s *attributeService) auditChanges(userID, actorID uint, definitions map[string]*models.AttributeDefinition, before map[string]interface{}, set map[string]string, remove []string) {
+	type change struct {
+		From interface{} `json:"from"`
+		To   interface{} `json:"to"`
+	}
+	changes := map[string]change{}
+	for key, value := range set {
+		to := decodeAttribute(definitions[key], value)
+		if from, ok := before[key]; !ok || from != to {
+			changes[key] = change{From: before[key], To: to}
+		}
+	}
+	for _, key := range remove {
+		if from, ok := before[key]; ok {
+			changes[key] = change{From: from}
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(changes)
+	if err == nil {
+		err = s.audit.Create(&models.AuditEntry{
+			Entity:   "user_attribute",
+			EntityID: userID,
+			UserID:   userID,
+			ActorID:  &actorID,
+			Action:   "update",
+			Changes:  string(data),
+		})
+	}
+	if err != nil {
+		s.logger.WithError(err).WithField("user_id", userID).Error("Failed to write audit entry")
+	}
+}
+
+func (s *attributeService) Filter(values map[string]string) (map[string]string, error) {
+	definitions, err := s.definitions()
+	if err != nil {
+		return nil, err
+	}
+	filter := make(map[string]string, len(values))
+	for key, text := range values {
+		definition := definitions[key]
+		if definition == nil {
+			return nil, fmt.Errorf("%w: %s is not a defined attribute", ErrInvalidAttribute, key)
+		}
+		var value interface{} = text
+		switch definition.Type {
+		case models.AttributeNumber:
+			number, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s must be a number", ErrInvalidAttribute, key)
+			}
+			value = number
+		case models.AttributeBoolean:
+			b, err := strconv.ParseBool(text)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s must be true or false", ErrInvalidAttribute, key)
+			}
+			value = b
+		}
+		if filter[key], err = encodeAttribute(definition, value); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+// encodeAttribute checks a value decoded from JSON against its definition and returns
+// its stored form
+func encodeAttribute(definition *models.AttributeDefinition, value interface{}) (string, error) {
+	key := definition.Key
+	switch definition.Type {
+	case models.AttributeNumber:
+		number, ok := value.(float64)
+		if !ok {
+			return "", fmt.Errorf("%w: %s must be a number", ErrInvalidAttribute, key)
+		}
+		return strconv.FormatFloat(number, 'f', -1, 64), nil
+	case models.AttributeBoolean:
+		b, ok := value.(bool)
+		if !ok {
+			return "", fmt.Errorf("%w: %s must be true or false", ErrInvalidAttribute, key)
+		}
+		return strconv.FormatBool(b), nil
+	case models.AttributeEnum:
+		text, ok := value.(string)
+		options := strings.Split(definition.Options, ",")
+		if !ok || !slices.Contains(options, text) {
+			return "", fmt.Errorf("%w: %s must be one of %s", ErrInvalidAttribute, key, strings.Join(options, ", "))
+		}
+		return text, nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: %s must be a string", ErrInvalidAttribute, key)
+	}
+	limit := definition.MaxLength
+	if limit == 0 {
+		limit = defaultAttributeLength
+	}
+	if utf8.RuneCountInString(text) > limit {
+		return "", fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidAttribute, key, limit)
+	}
+	return text, nil
+}
+
+// decodeAttribute returns the JSON value of a stored attribute
+func decodeAttribute(definition *models.AttributeDefinition, stored string) interface{} {
+	switch definition.Type {
+	case models.AttributeNumber:
+		if number, err := strconv.ParseFloat(stored, 64); err == nil {
+			return number
+		}
+	case models.AttributeBoolean:
+		if b, err := strconv.ParseBool(stored); err == nil {
+			return b
+		}
+	}
+	return stored
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/ldap"
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Names of the built-in auth providers in authentication.providers
+const (
+	AuthProviderLocal = "local"
+	AuthProviderLDAP  = "ldap"
+)
+
+// localAuthProvider checks the password stored for a local account
+type localAuthProvider struct {
+	users  repository.UserRepository
+	logger *logrus.Logger
+}
+
+func NewLocalAuthProvider(users repository.UserRepository, logger *logrus.Logger) auth.AuthProvider {
+	return &localAuthProvider{users: users, logger: logger}
+}
+
+func (p *localAuthProvider) Authenticate(login, password string) (*auth.Identity, error) {
+	var user *models.User
+	var err error
+	if strings.Contains(login, "@") {
+		user, err = p.users.FindByEmail(login)
+	} else {
+		user, err = p.users.FindByUsername(login)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, auth.ErrUnknownLogin
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	// Accounts of an identity provider only sign in through it
+	if user.ExternallyManaged() {
+		p.logger.WithField("user_id", user.ID).Warn("Local login attempted for externally managed account")
+		return nil, auth.ErrUnknownLogin
+	}
+
+	if err := auth.ComparePasswords(user.PasswordHash, password); err != nil {
+		p.logger.WithFields(logrus.Fields{
+			"user_id": user.ID,
+			"error":   err,
+		}).Warn("Failed login attempt")
+		return nil, auth.ErrWrongPassword
+	}
+	p.rehashPassword(user, password)
+	return &auth.Identity{UserID: user.ID, Source: models.AuthSourceLocal}, nil
+}
+
+// rehashPassword replaces a hash made with another algorithm or older parameters than
+// the configured ones while the plaintext is at hand, so stored hashes migrate as
+// users sign in. A failure only delays the migration to the next sign-in.
+func (p *localAuthProvider) rehashPassword(user *models.User, password string) {
+	if !auth.PasswordNeedsRehash(user.PasswordHash) {
+		return
+	}
+	hash, err := auth.HashPassword(password)
+	if err == nil {
+		err = p.users.UpdatePasswordHash(user.ID, user.PasswordHash, hash)
+	}
+	if err != nil {
+		p.logger.WithError(err).WithField("user_id", user.ID).Warn("Failed to rehash password")
+	}
+}
+
+// directoryAuthProvider binds to the LDAP directory as the login
+type directoryAuthProvider struct {
+	directory ldap.Authenticator
+	logger    *logrus.Logger
+}
+
+func NewDirectoryAuthProvider(directory ldap.Authenticator, logger *logrus.Logger) auth.AuthProvider {
+	return &directoryAuthProvider{directory: directory, logger: logger}
+}
+
+// Authenticate lets the next provider try when the login is not in the directory, the
+// password is wrong (a local account may share the name) or the directory is down
+func (p *directoryAuthProvider) Authenticate(login, password string) (*auth.Identity, error) {
+	entry, err := p.directory.Authenticate(login, password)
+	switch {
+	case errors.Is(err, ldap.ErrUserNotFound):
+		return nil, auth.ErrUnknownLogin
+	case errors.Is(err, ldap.ErrInvalidCredentials):
+		p.logger.WithField("login", login).Warn("Failed LDAP login attempt")
+		return nil, auth.ErrWrongPassword
+	case err != nil:
+		// Directory accounts cannot pass local authentication, so only local accounts
+		// can still sign in while the directory is unavailable
+		p.logger.WithError(err).Error("LDAP authentication unavailable")
+		return nil, fmt.Errorf("%w: %v", auth.ErrProviderUnavailable, err)
+	}
+	if entry.Email == "" {
+		p.logger.WithField("dn", entry.DN).Error("LDAP entry has no email address")
+		return nil, ErrInvalidCredentials
+	}
+	return &auth.Identity{
+		Source:   models.AuthSourceLDAP,
+		Subject:  entry.DN,
+		Email:    entry.Email,
+		Username: entry.Login,
+		Role:     entry.Role,
+	}, nil
+}
@@ -0,0 +1,546 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AuthService implements registration, login and the refresh token lifecycle
+type AuthService interface {
+	// Register creates a local user and sends the verification email. locale, when not
+	// empty, is saved as the user's profile locale, so their emails use it from the start.
+	Register(email, username, password, locale string) (*models.User, error)
+	Login(login, password string, client ClientInfo) (*models.User, *auth.TokenPair, error)
+	Refresh(refreshToken string, client ClientInfo) (*models.User, *auth.TokenPair, error)
+	// Logout deletes the refresh token and revokes the access token used for the request
+	Logout(refreshToken string, access AccessToken) error
+	// SignInExternal signs in a user authenticated by an identity provider, provisioning
+	// the local account on first sign-in
+	SignInExternal(identity ExternalIdentity, client ClientInfo) (*models.User, *auth.TokenPair, error)
+	// SwitchOrganization exchanges a refresh token of userID for a pair acting for
+	// orgID, which the user must be a member of
+	SwitchOrganization(userID uint, refreshToken string, orgID uint, client ClientInfo) (*models.User, *auth.TokenPair, error)
+	// CreateScopedSession starts a session of userID whose access tokens are limited to
+	// scopes, to hand to an integration. It is refreshed, listed and revoked like any
+	// other session, and keeps its scopes on rotation.
+	CreateScopedSession(userID uint, scopes []string, client ClientInfo) (*models.User, *auth.TokenPair, error)
+	// SetTokenExpiry changes the lifetimes of token pairs issued from now on
+	SetTokenExpiry(accessMinutes, refreshDays int)
+}
+
+// ExternalIdentity is a user vouched for by the LDAP directory or a SAML identity provider
+type ExternalIdentity struct {
+	Source   string // models.AuthSourceLDAP, models.AuthSourceSAML or that of another auth provider
+	Provider string // name of the auth provider or SAML identity provider
+	Subject  string // directory DN or SAML NameID, which the user is found by
+	Email    string
+	Username string
+	Role     string
+}
+
+type authService struct {
+	users         repository.UserRepository
+	tokens        repository.TokenRepository
+	organizations repository.OrganizationRepository
+	groups        repository.GroupRepository
+	analytics     repository.AnalyticsRepository
+	emails        EmailService
+	notifications NotificationService
+	accounts      AccountService
+	devices       DeviceService
+	externals     ExternalLoginService
+	geo           GeoService
+	revoker       TokenRevoker
+	passwords     PasswordValidator
+	providers     *auth.ProviderChain
+	logger        *logrus.Logger
+
+	mu     sync.RWMutex
+	config TokenConfig
+}
+
+func NewAuthService(users repository.UserRepository, tokens repository.TokenRepository, organizations repository.OrganizationRepository, groups repository.GroupRepository, analytics repository.AnalyticsRepository, emails EmailService, notifications NotificationService, accounts AccountService, devices DeviceService, externals ExternalLoginService, geo GeoService, revoker TokenRevoker, passwords PasswordValidator, providers *auth.ProviderChain, config TokenConfig, logger *logrus.Logger) AuthService {
+	return &authService{
+		users:         users,
+		tokens:        tokens,
+		organizations: organizations,
+		groups:        groups,
+		analytics:     analytics,
+		emails:        emails,
+		notifications: notifications,
+		accounts:      accounts,
+		devices:       devices,
+		externals:     externals,
+		geo:           geo,
+		revoker:       revoker,
+		passwords:     passwords,
+		providers:     providers,
+		config:        config,
+		logger:        logger,
+	}
+}
+
+func (s *authService) Register(email, username, password, locale string) (*models.User, error) {
+	user := &models.User{
+		Email:      email,
+		Username:   username,
+		Role:       "user",
+		Status:     models.UserStatusActive,
+		AuthSource: models.AuthSourceLocal,
+	}
+	if err := s.passwords.Validate(password, user); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("hash password: %w", err)
+	}
+	user.PasswordHash = hashedPassword
+	if err := s.users.Create(user); err != nil {
+		if conflict := userConflict(err); conflict != nil {
+			return nil, conflict
+		}
+		return nil, fmt.Errorf("create user: %w", err)
+	}
+	s.passwords.Remember(user)
+	if locale != "" {
+		if err := s.users.SaveProfile(&models.UserProfile{UserID: user.ID, Locale: locale}); err != nil {
+			s.logger.WithError(err).WithField("user_id", user.ID).Warn("Failed to save the locale of a new user")
+		}
+	}
+
+	messageID, err := s.emails.SendToUser("verification", user, user.Email, map[string]interface{}{
+		"Username": user.Username,
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to send verification email")
+	}
+	s.logger.WithFields(logrus.Fields{
+		"email":      user.Email,
+		"id":         user.ID,
+		"message_id": messageID,
+	}).Info("Verification email queued")
+
+	return user, nil
+}
+
+func (s *authService) Login(login, password string, client ClientInfo) (*models.User, *auth.TokenPair, error) {
+	user, err := s.authenticate(login, password, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.signIn(user, client)
+}
+
+func (s *authService) SignInExternal(identity ExternalIdentity, client ClientInfo) (*models.User, *auth.TokenPair, error) {
+	user, err := s.externals.User(identity, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.signIn(user, client)
+}
+
+// authenticate checks the credentials with the configured providers and returns the
+// local user they belong to, provisioning the account of an external identity
+func (s *authService) authenticate(login, password string, client ClientInfo) (*models.User, error) {
+	identity, provider, err := s.providers.Authenticate(login, password)
+	if errors.Is(err, auth.ErrUnknownLogin) || errors.Is(err, auth.ErrWrongPassword) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if identity.UserID != 0 {
+		user, err := s.users.FindByID(identity.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("find user: %w", err)
+		}
+		return user, nil
+	}
+	if identity.Email == "" || identity.Source == "" || identity.Source == models.AuthSourceLocal {
+		return nil, fmt.Errorf("auth provider %s returned an identity without email or source", provider)
+	}
+	if identity.Role == "" {
+		identity.Role = "user"
+	}
+	s.logger.WithFields(logrus.Fields{
+		"provider": provider,
+		"subject":  identity.Subject,
+	}).Debug("Credentials accepted by identity provider")
+	return s.externals.User(ExternalIdentity{
+		Source:   identity.Source,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		Username: identity.Username,
+		Role:     identity.Role,
+	}, client)
+}
+
+// signIn starts a session for a user whose credentials were checked
+func (s *authService) signIn(user *models.User, client ClientInfo) (*models.User, *auth.TokenPair, error) {
+	// The holder of a deactivated account confirms the reactivation by email
+	if user.Status == models.UserStatusDeactivated {
+		if err := s.accounts.RequestReactivation(user, client); err != nil {
+			return nil, nil, err
+		}
+		s.logger.WithField("user_id", user.ID).Info("Login to deactivated account, reactivation offered")
+		return nil, nil, ErrAccountDeactivated
+	}
+	// Likewise for an account the user deleted, until its grace period ends
+	if user.Status == models.UserStatusPendingDeletion {
+		if err := s.accounts.RequestReactivation(user, client); err != nil {
+			return nil, nil, err
+		}
+		s.logger.WithField("user_id", user.ID).Info("Login to account pending deletion, restoration offered")
+		return nil, nil, ErrAccountPendingDeletion
+	}
+	// Checked after the password so the status is only revealed to the account holder
+	if err := accountBlocked(user); err != nil {
+		s.logger.WithField("user_id", user.ID).Warn("Login rejected for blocked account")
+		return nil, nil, err
+	}
+	if s.passwords.Expired(user, s.config.clock().Now()) {
+		s.logger.WithField("user_id", user.ID).Info("Login rejected for expired password")
+		return nil, nil, ErrPasswordExpired
+	}
+	location, err := s.geo.CheckSignIn(user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.devices.CheckSignIn(user, client); err != nil {
+		if errors.Is(err, ErrDeviceConfirmationRequired) {
+			s.logger.WithField("user_id", user.ID).Info("Login from unrecognized device awaits confirmation")
+		}
+		return nil, nil, err
+	}
+
+	orgID, err := s.firstOrganization(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, _, err := s.issueTokens(user, nil, orgID, nil, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.limitSessions(user.ID)
+	s.geo.RecordSignIn(location)
+	s.notifications.LoginSucceeded(user, client)
+	if err := s.analytics.RecordLogin(user.ID, s.config.clock().Now()); err != nil {
+		s.logger.WithError(err).WithField("user_id", user.ID).Warn("Failed to record login event")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": user.ID,
+	}).Info("Successful login")
+
+	return user, tokens, nil
+}
+
+// firstOrganization returns the organization new sessions act for, the one the user
+// joined first, or nil when they belong to none
+func (s *authService) firstOrganization(userID uint) (*uint, error) {
+	memberships, err := s.organizations.ListMemberships(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list memberships: %w", err)
+	}
+	if len(memberships) == 0 {
+		return nil, nil
+	}
+	return &memberships[0].OrganizationID, nil
+}
+
+func (s *authService) CreateScopedSession(userID uint, scopes []string, client ClientInfo) (*models.User, *auth.TokenPair, error) {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrUserNotFound
+		}
+		return nil, nil, fmt.Errorf("find user: %w", err)
+	}
+	if err := accountBlocked(user); err != nil {
+		return nil, nil, err
+	}
+	if len(scopes) == 0 {
+		return nil, nil, fmt.Errorf("%w: at least one is required", ErrInvalidScope)
+	}
+	if err := checkScopes(scopes, sessionScopes, user); err != nil {
+		return nil, nil, err
+	}
+	orgID, err := s.firstOrganization(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, _, err := s.issueTokens(user, nil, orgID, scopes, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.limitSessions(user.ID)
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": user.ID,
+		"scopes":  strings.Join(scopes, ","),
+	}).Info("Scoped session created")
+	return user, tokens, nil
+}
+
+func (s *authService) Refresh(refreshToken string, client ClientInfo) (*models.User, *auth.TokenPair, error) {
+	return s.rotate(refreshToken, nil, client)
+}
+
+func (s *authService) SwitchOrganization(userID uint, refreshToken string, orgID uint, client ClientInfo) (*models.User, *auth.TokenPair, error) {
+	verifier := auth.NewRefreshTokenVerifier(s.config.RefreshKeys, s.config.Issuer)
+	owner, err := auth.ValidateRefreshToken(refreshToken, verifier)
+	if err != nil || owner != userID {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	// Checked before the token is used up by the rotation
+	if _, err := s.organizations.FindMembership(orgID, userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrNotOrganizationMember
+		}
+		return nil, nil, fmt.Errorf("find membership: %w", err)
+	}
+	return s.rotate(refreshToken, &orgID, client)
+}
+
+// rotate exchanges a refresh token for a new pair continuing its session. The session
+// keeps its organization unless orgID is set.
+func (s *authService) rotate(refreshToken string, orgID *uint, client ClientInfo) (*models.User, *auth.TokenPair, error) {
+	verifier := auth.NewRefreshTokenVerifier(s.config.RefreshKeys, s.config.Issuer)
+	userID, err := auth.ValidateRefreshToken(refreshToken, verifier)
+	if err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	// Check if token exists in database
+	storedToken, err := s.tokens.FindForUser(userID, refreshToken)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, fmt.Errorf("find refresh token: %w", err)
+	}
+
+	// A copy taken to another device is refused without claiming it, so the device
+	// holding the token keeps its session. Tokens issued before binding are accepted
+	// and bound by their rotation.
+	s.mu.RLock()
+	bindDevice := s.config.BindDevice
+	s.mu.RUnlock()
+	if bindDevice && storedToken.RotatedAt == nil && storedToken.DeviceFingerprint != "" && storedToken.DeviceFingerprint != client.Fingerprint {
+		s.logger.WithFields(logrus.Fields{
+			"user_id":   userID,
+			"family_id": storedToken.FamilyID,
+			"ip":        client.IP,
+		}).Warn("Refresh token presented by another device")
+		return nil, nil, ErrRefreshTokenDevice
+	}
+
+	// Claim the token atomically so two concurrent refreshes cannot both succeed
+	claimed := false
+	if storedToken.RotatedAt == nil {
+		claimed, err = s.tokens.MarkRotated(storedToken)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rotate refresh token: %w", err)
+		}
+	}
+	if !claimed {
+		// A token that was already exchanged is being replayed: either the legitimate
+		// client or an attacker holds a stolen copy, so end the whole session family
+		s.logger.WithFields(logrus.Fields{
+			"user_id":   userID,
+			"family_id": storedToken.FamilyID,
+			"token_id":  storedToken.ID,
+		}).Warn("Refresh token reuse detected, revoking token family")
+		if storedToken.FamilyID != "" {
+			err = s.tokens.DeleteFamily(userID, storedToken.FamilyID)
+		} else {
+			err = s.tokens.Delete(storedToken)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("revoke token family: %w", err)
+		}
+		return nil, nil, ErrRefreshTokenReused
+	}
+
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrUserNotFound
+		}
+		return nil, nil, fmt.Errorf("find user: %w", err)
+	}
+	if err := accountBlocked(user); err != nil {
+		return nil, nil, err
+	}
+	// Sessions end once the password expires, so it has to be reset
+	if s.passwords.Expired(user, s.config.clock().Now()) {
+		return nil, nil, ErrPasswordExpired
+	}
+
+	if orgID == nil {
+		orgID = storedToken.OrganizationID
+	}
+	tokens, replacement, err := s.issueTokens(user, storedToken, orgID, nil, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Link the used token to its replacement for the session history
+	storedToken.ReplacedByID = &replacement.ID
+	storedToken.FamilyID = replacement.FamilyID
+	if err := s.tokens.Save(storedToken); err != nil {
+		s.logger.WithError(err).Error("Failed to link rotated refresh token")
+	}
+
+	return user, tokens, nil
+}
+
+// limitSessions ends the oldest sessions of userID beyond the configured maximum, after
+// a sign-in started a new one. A failure is logged; the extra sessions then end at the
+// next sign-in.
+func (s *authService) limitSessions(userID uint) {
+	s.mu.RLock()
+	limit := s.config.MaxSessions
+	s.mu.RUnlock()
+	if limit <= 0 {
+		return
+	}
+	sessions, err := s.tokens.ListActive(userID)
+	if err != nil {
+		s.logger.WithError(err).WithField("user_id", userID).Warn("Failed to list sessions to enforce the limit")
+		return
+	}
+	if len(sessions) <= limit {
+		return
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].SessionStartedAt.After(sessions[j].SessionStartedAt)
+	})
+	for _, session := range sessions[limit:] {
+		if session.FamilyID != "" {
+			err = s.tokens.DeleteFamily(userID, session.FamilyID)
+		} else {
+			err = s.tokens.Delete(&session)
+		}
+		if err != nil {
+			s.logger.WithError(err).WithField("user_id", userID).Warn("Failed to end session over the limit")
+			return
+		}
+	}
+	s.logger.WithFields(logrus.Fields{
+		"user_id": userID,
+		"ended":   len(sessions) - limit,
+	}).Info("Oldest sessions ended, session limit reached")
+}
+
+func (s *authService) Logout(refreshToken string, access AccessToken) error {
+	if err := s.tokens.DeleteByToken(refreshToken); err != nil {
+		return fmt.Errorf("delete refresh token: %w", err)
+	}
+	if err := s.revoker.Revoke(access.ID, access.UserID, access.ExpiresAt); err != nil {
+		return fmt.Errorf("revoke access token: %w", err)
+	}
+	return nil
+}
+
+func (s *authService) SetTokenExpiry(accessMinutes, refreshDays int) {
+	s.mu.Lock()
+	s.config.AccessExpiry = accessMinutes
+	s.config.RefreshExpiry = refreshDays
+	s.mu.Unlock()
+}
+
+// issueTokens generates a new token pair for user and stores the refresh token.
+// When previous is set the new token continues its session (family) and keeps its
+// scopes, otherwise a new session starts, limited to scopes when any are given.
+// The access token acts for orgID with the user's current role in it, or for no
+// organization when orgID is nil or the user is no longer a member, and lists the
+// user's current groups.
+func (s *authService) issueTokens(user *models.User, previous *models.RefreshToken, orgID *uint, scopes []string, client ClientInfo) (*auth.TokenPair, *models.RefreshToken, error) {
+	s.mu.RLock()
+	config := s.config
+	s.mu.RUnlock()
+
+	now := config.clock().Now()
+	refreshToken := &models.RefreshToken{
+		ExpiresAt:         now.Add(time.Hour * 24 * time.Duration(config.RefreshExpiry)),
+		IPAddress:         client.IP,
+		UserAgent:         client.UserAgent,
+		DeviceFingerprint: client.Fingerprint,
+		SessionStartedAt:  now,
+		LastUsedAt:        now,
+		Scopes:            strings.Join(scopes, ","),
+	}
+	if previous != nil {
+		refreshToken.FamilyID = previous.FamilyID
+		refreshToken.Scopes = previous.Scopes
+		if !previous.SessionStartedAt.IsZero() {
+			refreshToken.SessionStartedAt = previous.SessionStartedAt
+		}
+	}
+	if refreshToken.FamilyID == "" {
+		familyID, err := auth.GenerateRandomToken(16)
+		if err != nil {
+			return nil, nil, fmt.Errorf("generate token family: %w", err)
+		}
+		refreshToken.FamilyID = familyID
+	}
+
+	var org *auth.Organization
+	if orgID != nil {
+		membership, err := s.organizations.FindMembership(*orgID, user.ID)
+		switch {
+		case err == nil:
+			org = &auth.Organization{ID: membership.OrganizationID, Role: membership.Role}
+			refreshToken.OrganizationID = &membership.OrganizationID
+		case !errors.Is(err, repository.ErrNotFound):
+			return nil, nil, fmt.Errorf("find membership: %w", err)
+		}
+	}
+
+	groups, err := s.groups.NamesForUser(user.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list groups: %w", err)
+	}
+
+	tokens, err := config.generator().GenerateTokenPair(auth.Subject{
+		UserID:       user.ID,
+		Role:         user.Role,
+		SessionID:    refreshToken.FamilyID,
+		Organization: org,
+		Groups:       groups,
+		Scopes:       SplitScopes(refreshToken.Scopes),
+	}, auth.TokenSettings{
+		AccessKeys:    config.AccessKeys,
+		RefreshKeys:   config.RefreshKeys,
+		Issuer:        config.Issuer,
+		Audience:      config.Audience,
+		AccessExpiry:  config.AccessExpiry,
+		RefreshExpiry: config.RefreshExpiry,
+		Claims:        config.Claims,
+		Clock:         config.Clock,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate tokens: %w", err)
+	}
+
+	if err := s.tokens.Create(user.ID, tokens.RefreshToken, refreshToken); err != nil {
+		return nil, nil, fmt.Errorf("store refresh token: %w", err)
+	}
+
+	return tokens, refreshToken, nil
+}
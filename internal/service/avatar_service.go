@@ -0,0 +1,172 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/imaging"
+	"api/internal/models"
+	"api/internal/storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrAvatarTooLarge        = errors.New("avatar exceeds the maximum upload size")
+	ErrAvatarUnsupported     = errors.New("avatar must be a JPEG, PNG or GIF image")
+	ErrAvatarDimensions      = errors.New("avatar dimensions are out of range")
+	ErrAvatarSizeUnavailable = errors.New("avatar size not available")
+)
+
+// AvatarConfig limits uploads and lists the thumbnail sizes generated for every avatar
+type AvatarConfig struct {
+	MaxUploadBytes int64
+	MaxDimension   int // images are scaled down to fit within this many pixels
+	ThumbnailSizes []int
+}
+
+// AvatarService stores uploaded profile pictures in the media storage backend
+type AvatarService interface {
+	// Upload validates and stores the image read from r, replacing any previous avatar
+	Upload(ctx context.Context, userID uint, r io.Reader) (*models.UserProfile, error)
+	// Key returns the storage key of the avatar at the requested thumbnail size (0 for the full image)
+	Key(profile *models.UserProfile, size int) (string, error)
+	// Sizes lists the generated thumbnail sizes
+	Sizes() []int
+	MaxUploadBytes() int64
+}
+
+type avatarService struct {
+	users   UserService
+	storage storage.Storage
+	config  AvatarConfig
+	logger  *logrus.Logger
+}
+
+func NewAvatarService(users UserService, store storage.Storage, config AvatarConfig, logger *logrus.Logger) AvatarService {
+	return &avatarService{
+		users:   users,
+		storage: store,
+		config:  config,
+		logger:  logger,
+	}
+}
+
+// thumbnailKey derives the key of a thumbnail from the key of the full image
+func thumbnailKey(key string, size int) string {
+	ext := ""
+	if i := strings.LastIndex(key, "."); i > strings.LastIndex(key, "/") {
+		key, ext = key[:i], key[i:]
+	}
+	return fmt.Sprintf("%s_%d%s", key, size, ext)
+}
+
+func (s *avatarService) Sizes() []int {
+	return s.config.ThumbnailSizes
+}
+
+func (s *avatarService) MaxUploadBytes() int64 {
+	return s.config.MaxUploadBytes
+}
+
+func (s *avatarService) Key(profile *models.UserProfile, size int) (string, error) {
+	if size == 0 {
+		return profile.AvatarKey, nil
+	}
+	for _, allowed := range s.config.ThumbnailSizes {
+		if allowed == size {
+			return thumbnailKey(profile.AvatarKey, size), nil
+		}
+	}
+	return "", ErrAvatarSizeUnavailable
+}
+
+func (s *avatarService) Upload(ctx context.Context, userID uint, r io.Reader) (*models.UserProfile, error) {
+	data, err := io.ReadAll(io.LimitReader(r, s.config.MaxUploadBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read avatar: %w", err)
+	}
+	if int64(len(data)) > s.config.MaxUploadBytes {
+		return nil, ErrAvatarTooLarge
+	}
+
+	// Check dimensions before decoding so a tiny file cannot claim a huge canvas
+	cfg, err := imaging.DecodeConfig(data)
+	if err != nil {
+		return nil, ErrAvatarUnsupported
+	}
+	if cfg.Width < 1 || cfg.Height < 1 || cfg.Width > 10000 || cfg.Height > 10000 {
+		return nil, ErrAvatarDimensions
+	}
+
+	img, contentType, err := imaging.Decode(data)
+	if err != nil {
+		return nil, ErrAvatarUnsupported
+	}
+
+	// Objects get a random name so replaced avatars are never served from a stale cache
+	name, err := auth.GenerateRandomToken(8)
+	if err != nil {
+		return nil, err
+	}
+	base := fmt.Sprintf("avatars/%d/%s", userID, name)
+
+	// Re-encoding also strips any metadata (e.g. EXIF location) from the upload
+	var buf bytes.Buffer
+	storedType, err := imaging.Encode(&buf, imaging.Fit(img, s.config.MaxDimension), contentType)
+	if err != nil {
+		return nil, fmt.Errorf("encode avatar: %w", err)
+	}
+	key := base + ".jpg"
+	if storedType == "image/png" {
+		key = base + ".png"
+	}
+
+	written := []string{}
+	cleanup := func() {
+		for _, k := range written {
+			if err := s.storage.Delete(ctx, k); err != nil {
+				s.logger.WithError(err).WithField("key", k).Warn("Failed to delete avatar object")
+			}
+		}
+	}
+
+	if err := s.storage.Put(ctx, key, &buf, int64(buf.Len()), storedType); err != nil {
+		return nil, fmt.Errorf("store avatar: %w", err)
+	}
+	written = append(written, key)
+
+	for _, size := range s.config.ThumbnailSizes {
+		buf.Reset()
+		if _, err := imaging.Encode(&buf, imaging.Thumbnail(img, size), contentType); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("encode thumbnail: %w", err)
+		}
+		thumb := thumbnailKey(key, size)
+		if err := s.storage.Put(ctx, thumb, &buf, int64(buf.Len()), storedType); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("store thumbnail: %w", err)
+		}
+		written = append(written, thumb)
+	}
+
+	profile, previousKey, err := s.users.SetAvatar(userID, key, fmt.Sprintf("/media/avatars/%d", userID))
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	// The old objects are no longer referenced; failing to remove them only wastes space
+	if previousKey != "" {
+		written = []string{previousKey}
+		for _, size := range s.config.ThumbnailSizes {
+			written = append(written, thumbnailKey(previousKey, size))
+		}
+		cleanup()
+	}
+	return profile, nil
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"api/internal/models"
+	"api/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Bulk actions admins can apply to many users at once
+const (
+	BulkActionRole        = "role"
+	BulkActionSuspend     = "suspend"
+	BulkActionVerifyEmail = "verify_email"
+	BulkActionDelete      = "delete"
+)
+
+// MaxBulkUsers is the most users one bulk request may act on
+const MaxBulkUsers = 500
+
+// ErrInvalidBulkRequest is returned, wrapped with the reason, before any user is changed
+var ErrInvalidBulkRequest = errors.New("invalid bulk request")
+
+// errBulkOwnAccount fails the admin's own entry for actions that would lock them out
+var errBulkOwnAccount = errors.New("cannot apply to your own account")
+
+// BulkRequest is one action for a list of users. Role is used by the role action,
+// Suspension by suspend and ErasureMode by delete, where empty means the configured
+// privacy policy.
+type BulkRequest struct {
+	Action      string
+	UserIDs     []uint
+	Role        string
+	Suspension  SuspendInput
+	ErasureMode string
+}
+
+// BulkResult is the outcome of a bulk action for one user
+type BulkResult struct {
+	UserID  uint
+	Success bool
+	Error   string
+}
+
+// BulkUserService applies admin actions to many users in one request
+type BulkUserService interface {
+	// Apply runs the action for each user in turn on behalf of adminID. Users are
+	// handled independently, so a failure does not undo the users before it. Results
+	// follow the order of the request, with repeated IDs handled once.
+	Apply(ctx context.Context, adminID uint, request BulkRequest) ([]BulkResult, error)
+}
+
+type bulkUserService struct {
+	users   UserService
+	erasure ErasureService
+	audit   repository.AuditRepository
+	logger  *logrus.Logger
+}
+
+func NewBulkUserService(users UserService, erasure ErasureService, audit repository.AuditRepository, logger *logrus.Logger) BulkUserService {
+	return &bulkUserService{
+		users:   users,
+		erasure: erasure,
+		audit:   audit,
+		logger:  logger,
+	}
+}
+
+// validate checks everything that does not depend on the user, so a mistake in the
+// request fails it as a whole instead of every entry
+func (s *bulkUserService) validate(request BulkRequest) error {
+	if len(request.UserIDs) == 0 {
+		return fmt.Errorf("%w: no users given", ErrInvalidBulkRequest)
+	}
+	if len(request.UserIDs) > MaxBulkUsers {
+		return fmt.Errorf("%w: at most %d users per request", ErrInvalidBulkRequest, MaxBulkUsers)
+	}
+	switch request.Action {
+	case BulkActionRole:
+		if request.Role != "user" && request.Role != "admin" {
+			return fmt.Errorf("%w: role must be user or admin", ErrInvalidBulkRequest)
+		}
+	case BulkActionSuspend:
+		if request.Suspension.Reason == "" {
+			return fmt.Errorf("%w: a suspension reason is required", ErrInvalidBulkRequest)
+		}
+		if request.Suspension.Ban && request.Suspension.Until != nil {
+			return fmt.Errorf("%w: bans cannot expire", ErrInvalidBulkRequest)
+		}
+		if until := request.Suspension.Until; until != nil && !until.After(time.Now()) {
+			return fmt.Errorf("%w: expiry must be in the future", ErrInvalidBulkRequest)
+		}
+	case BulkActionDelete:
+		if request.ErasureMode != "" && !ValidErasureMode(request.ErasureMode) {
+			return fmt.Errorf("%w: %v", ErrInvalidBulkRequest, ErrInvalidErasureMode)
+		}
+	case BulkActionVerifyEmail:
+	default:
+		return fmt.Errorf("%w: action must be role, suspend, verify_email or delete", ErrInvalidBulkRequest)
+	}
+	return nil
+}
+
+func (s *bulkUserService) Apply(ctx context.Context, adminID uint, request BulkRequest) ([]BulkResult, error) {
+	if err := s.validate(request); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uint]bool, len(request.UserIDs))
+	results := make([]BulkResult, 0, len(request.UserIDs))
+	succeeded := []uint{}
+	failed := []uint{}
+	for _, userID := range request.UserIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		result := BulkResult{UserID: userID, Success: true}
+		if err := s.apply(ctx, adminID, userID, request); err != nil {
+			result.Success = false
+			result.Error = s.bulkError(err, userID, request.Action)
+			failed = append(failed, userID)
+		} else {
+			succeeded = append(succeeded, userID)
+		}
+		results = append(results, result)
+	}
+
+	changes, err := json.Marshal(map[string]interface{}{"succeeded": succeeded, "failed": failed})
+	if err == nil {
+		err = s.audit.Create(&models.AuditEntry{
+			Entity:  "user_bulk",
+			UserID:  adminID,
+			ActorID: &adminID,
+			Action:  request.Action,
+			Changes: string(changes),
+		})
+	}
+	if err != nil {
+		s.logger.WithError(err).WithField("admin_id", adminID).Error("Failed to write audit entry")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"admin_id":  adminID,
+		"action":    request.Action,
+		"succeeded": len(succeeded),
+		"failed":    len(failed),
+	}).Warn("Bulk user action applied")
+	return results, nil
+}
+
+func (s *bulkUserService) apply(ctx context.Context, adminID, userID uint, request BulkRequest) error {
+	if userID == adminID && request.Action != BulkActionVerifyEmail {
+		return errBulkOwnAccount
+	}
+	var err error
+	switch request.Action {
+	case BulkActionRole:
+		_, err = s.users.ChangeRole(userID, request.Role)
+	case BulkActionSuspend:
+		_, err = s.users.Suspend(userID, adminID, request.Suspension)
+	case BulkActionVerifyEmail:
+		_, err = s.users.VerifyEmail(userID, adminID)
+	case BulkActionDelete:
+		_, err = s.erasure.Erase(ctx, userID, request.ErasureMode)
+	}
+	return err
+}
+
+// bulkError is the message reported for a failed entry; unexpected errors are logged
+// and not shown
+func (s *bulkUserService) bulkError(err error, userID uint, action string) string {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		return "user not found"
+	case errors.Is(err, errBulkOwnAccount), errors.Is(err, ErrInvalidSuspension):
+		return err.Error()
+	}
+	s.logger.WithError(err).WithFields(logrus.Fields{
+		"user_id": userID,
+		"action":  action,
+	}).Error("Bulk user action failed")
+	return "internal error"
+}
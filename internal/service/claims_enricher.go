@@ -0,0 +1,131 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ClaimsEnricherFields is the name of the enricher copying account data into claims
+const ClaimsEnricherFields = "fields"
+
+// Sources of the fields enricher's claims, as "<kind>.<name>"
+const (
+	claimSourceUser      = "user"
+	claimSourceProfile   = "profile"
+	claimSourceAttribute = "attribute"
+)
+
+// claimUserFields and claimProfileFields are the account fields a claim can be mapped
+// to; the bio and avatar are left out as they make tokens large
+var (
+	claimUserFields    = map[string]bool{"email": true, "username": true, "emailVerified": true, "authSource": true}
+	claimProfileFields = map[string]bool{
+		"firstName": true, "lastName": true, "preferredName": true, "pronouns": true,
+		"honorific": true, "locale": true, "timezone": true,
+	}
+)
+
+type claimField struct {
+	claim string
+	kind  string
+	name  string
+}
+
+// fieldClaimsEnricher sets claims from the user, their profile and custom attributes
+type fieldClaimsEnricher struct {
+	users      repository.UserRepository
+	attributes AttributeService
+	fields     []claimField
+	// which of the user, profile and attributes need loading
+	kinds map[string]bool
+}
+
+// NewFieldClaimsEnricher returns an enricher setting each claim of fields from its
+// source: "user.<field>" (email, username, emailVerified or authSource),
+// "profile.<field>" (firstName, lastName, preferredName, pronouns, honorific, locale or
+// timezone) or "attribute.<key>" for a custom attribute. Empty profile fields and
+// attributes the user has no value for are left out of the token.
+func NewFieldClaimsEnricher(users repository.UserRepository, attributes AttributeService, fields map[string]string) (auth.ClaimsEnricher, error) {
+	enricher := &fieldClaimsEnricher{users: users, attributes: attributes, kinds: map[string]bool{}}
+	for claim, source := range fields {
+		if claim == "" || auth.IsReservedClaim(claim) {
+			return nil, fmt.Errorf("claim %q cannot be set from account fields", claim)
+		}
+		kind, name, _ := strings.Cut(source, ".")
+		valid := false
+		switch kind {
+		case claimSourceUser:
+			valid = claimUserFields[name]
+		case claimSourceProfile:
+			valid = claimProfileFields[name]
+		case claimSourceAttribute:
+			valid = name != ""
+		}
+		if !valid {
+			return nil, fmt.Errorf("claim %s has an unknown source %q", claim, source)
+		}
+		enricher.fields = append(enricher.fields, claimField{claim: claim, kind: kind, name: name})
+		enricher.kinds[kind] = true
+	}
+	return enricher, nil
+}
+
+func (e *fieldClaimsEnricher) Claims(subject auth.Subject) (map[string]interface{}, error) {
+	var user *models.User
+	profile := &models.UserProfile{}
+	var attributes map[string]interface{}
+	var err error
+	if e.kinds[claimSourceUser] {
+		if user, err = e.users.FindByID(subject.UserID); err != nil {
+			return nil, fmt.Errorf("find user: %w", err)
+		}
+	}
+	if e.kinds[claimSourceProfile] {
+		found, err := e.users.FindProfile(subject.UserID)
+		switch {
+		case err == nil:
+			profile = found
+		case !errors.Is(err, repository.ErrNotFound):
+			return nil, fmt.Errorf("find profile: %w", err)
+		}
+	}
+	if e.kinds[claimSourceAttribute] {
+		if attributes, err = e.attributes.Get(subject.UserID, false); err != nil {
+			return nil, fmt.Errorf("get attributes: %w", err)
+		}
+	}
+
+	claims := make(map[string]interface{}, len(e.fields))
+	for _, field := range e.fields {
+		switch field.kind {
+		case claimSourceUser:
+			claims[field.claim] = userClaim(user, field.name)
+		case claimSourceProfile:
+			if value := profileFieldValue(profile, field.name); value != "" {
+				claims[field.claim] = value
+			}
+		case claimSourceAttribute:
+			if value, ok := attributes[field.name]; ok {
+				claims[field.claim] = value
+			}
+		}
+	}
+	return claims, nil
+}
+
+func userClaim(user *models.User, field string) interface{} {
+	switch field {
+	case "email":
+		return user.Email
+	case "username":
+		return user.Username
+	case "emailVerified":
+		return user.EmailVerified
+	default:
+		return user.AuthSource
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrDeviceConfirmationRequired is returned for a sign-in from an unrecognized device;
+	// a confirmation link has been mailed to the account holder
+	ErrDeviceConfirmationRequired = errors.New("sign-in from an unrecognized device must be confirmed")
+	ErrInvalidDeviceToken         = errors.New("invalid or expired device confirmation token")
+	ErrDeviceNotFound             = errors.New("trusted device not found")
+)
+
+// Security event types recorded for trusted devices
+const (
+	EventDeviceConfirmationRequested = "device_confirmation_requested"
+	EventDeviceTrusted               = "device_trusted"
+	EventDeviceRevoked               = "device_revoked"
+)
+
+// DeviceConfig holds the settings for new device verification
+type DeviceConfig struct {
+	Verification bool          // require confirmation of sign-ins from unrecognized devices
+	URL          string        // the confirmation token is appended to this link
+	TokenTTL     time.Duration // how long a confirmation link stays valid
+	MaxPerHour   int           // confirmation emails per account and hour
+}
+
+// DeviceService keeps track of the devices users sign in from. Every sign-in from a
+// device makes it trusted, unless verification is enabled: then only the user's first
+// device is trusted right away, and others once the link mailed to the user is opened.
+type DeviceService interface {
+	// CheckSignIn is called once the user's credentials were checked. It returns
+	// ErrDeviceConfirmationRequired when the sign-in has to wait for a confirmation.
+	CheckSignIn(user *models.User, client ClientInfo) error
+	// Confirm trusts the device of the sign-in a confirmation link was sent for
+	Confirm(token string, client ClientInfo) (*models.TrustedDevice, error)
+	List(userID uint) ([]models.TrustedDevice, error)
+	// Revoke forgets a trusted device, so signing in from it needs confirmation again
+	Revoke(userID, deviceID uint, client ClientInfo) error
+}
+
+type deviceService struct {
+	devices repository.DeviceRepository
+	events  repository.SecurityEventRepository
+	emails  EmailService
+	config  DeviceConfig
+	logger  *logrus.Logger
+}
+
+func NewDeviceService(devices repository.DeviceRepository, events repository.SecurityEventRepository, emails EmailService, config DeviceConfig, logger *logrus.Logger) DeviceService {
+	return &deviceService{
+		devices: devices,
+		events:  events,
+		emails:  emails,
+		config:  config,
+		logger:  logger,
+	}
+}
+
+func (s *deviceService) CheckSignIn(user *models.User, client ClientInfo) error {
+	now := time.Now()
+	device, err := s.devices.FindTrusted(user.ID, client.Fingerprint)
+	if err == nil {
+		if err := s.devices.Touch(device, client.IP, now); err != nil {
+			s.logger.WithError(err).WithField("user_id", user.ID).Warn("Failed to record trusted device sign-in")
+		}
+		return nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("find trusted device: %w", err)
+	}
+
+	if s.config.Verification {
+		trusted, err := s.devices.CountTrusted(user.ID)
+		if err != nil {
+			return fmt.Errorf("count trusted devices: %w", err)
+		}
+		// There is nothing to compare the very first device against
+		if trusted > 0 {
+			if err := s.requestConfirmation(user, client, now); err != nil {
+				return err
+			}
+			return ErrDeviceConfirmationRequired
+		}
+	}
+
+	if err := s.devices.Trust(&models.TrustedDevice{
+		UserID:      user.ID,
+		Fingerprint: client.Fingerprint,
+		UserAgent:   client.UserAgent,
+		IPAddress:   client.IP,
+		LastSeenAt:  now,
+	}); err != nil {
+		return fmt.Errorf("trust device: %w", err)
+	}
+	return nil
+}
+
+// requestConfirmation mails a link that trusts the client's device
+func (s *deviceService) requestConfirmation(user *models.User, client ClientInfo, now time.Time) error {
+	recent, err := s.devices.CountConfirmationsSince(user.ID, now.Add(-time.Hour))
+	if err != nil {
+		return fmt.Errorf("count device confirmations: %w", err)
+	}
+	if recent >= s.config.MaxPerHour {
+		s.recordEvent(user.ID, EventDeviceConfirmationRequested, "warning", client, map[string]interface{}{"throttled": true})
+		s.logger.WithField("user_id", user.ID).Warn("Device confirmations throttled")
+		return nil
+	}
+
+	token, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	confirmation := &models.DeviceConfirmation{
+		UserID:      user.ID,
+		Fingerprint: client.Fingerprint,
+		UserAgent:   client.UserAgent,
+		IPAddress:   client.IP,
+		TokenDigest: auth.HashToken(token),
+		ExpiresAt:   now.Add(s.config.TokenTTL),
+	}
+	if err := s.devices.CreateConfirmation(confirmation); err != nil {
+		return fmt.Errorf("create device confirmation: %w", err)
+	}
+
+	messageID, err := s.emails.SendToUser("device_confirmation", user, user.Email, map[string]interface{}{
+		"Username":   user.Username,
+		"ConfirmURL": s.config.URL + token,
+		"ExpiresIn":  s.config.TokenTTL.String(),
+		"Time":       now,
+		"IP":         client.IP,
+		"Device":     client.UserAgent,
+	})
+	if err != nil {
+		return fmt.Errorf("send device confirmation: %w", err)
+	}
+
+	s.recordEvent(user.ID, EventDeviceConfirmationRequested, "warning", client, map[string]interface{}{"messageId": messageID})
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"message_id": messageID,
+	}).Info("Device confirmation queued")
+	return nil
+}
+
+func (s *deviceService) Confirm(token string, client ClientInfo) (*models.TrustedDevice, error) {
+	confirmation, err := s.devices.FindConfirmationByDigest(auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidDeviceToken
+		}
+		return nil, fmt.Errorf("find device confirmation: %w", err)
+	}
+	now := time.Now()
+	if confirmation.ConfirmedAt != nil || !now.Before(confirmation.ExpiresAt) {
+		return nil, ErrInvalidDeviceToken
+	}
+
+	// The link is often opened on another device than the one that signed in
+	device := &models.TrustedDevice{
+		UserID:      confirmation.UserID,
+		Fingerprint: confirmation.Fingerprint,
+		UserAgent:   confirmation.UserAgent,
+		IPAddress:   confirmation.IPAddress,
+		LastSeenAt:  now,
+	}
+	confirmed, err := s.devices.Confirm(confirmation, device, now)
+	if err != nil {
+		return nil, fmt.Errorf("confirm device: %w", err)
+	}
+	if !confirmed {
+		return nil, ErrInvalidDeviceToken
+	}
+
+	s.recordEvent(confirmation.UserID, EventDeviceTrusted, "info", client, map[string]interface{}{"deviceId": device.ID, "device": device.UserAgent})
+	s.logger.WithFields(logrus.Fields{
+		"user_id":   confirmation.UserID,
+		"device_id": device.ID,
+	}).Info("Device trusted")
+	return device, nil
+}
+
+func (s *deviceService) List(userID uint) ([]models.TrustedDevice, error) {
+	devices, err := s.devices.ListTrusted(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list trusted devices: %w", err)
+	}
+	return devices, nil
+}
+
+func (s *deviceService) Revoke(userID, deviceID uint, client ClientInfo) error {
+	deleted, err := s.devices.DeleteTrusted(userID, deviceID)
+	if err != nil {
+		return fmt.Errorf("delete trusted device: %w", err)
+	}
+	if !deleted {
+		return ErrDeviceNotFound
+	}
+	s.recordEvent(userID, EventDeviceRevoked, "info", client, map[string]interface{}{"deviceId": deviceID})
+	s.logger.WithFields(logrus.Fields{
+		"user_id":   userID,
+		"device_id": deviceID,
+	}).Info("Trusted device revoked")
+	return nil
+}
+
+func (s *deviceService) recordEvent(userID uint, eventType, severity string, client ClientInfo, details map[string]interface{}) {
+	details["ip"] = client.IP
+	details["userAgent"] = client.UserAgent
+	payload, _ := json.Marshal(details)
+
+	if err := s.events.Create(&models.SecurityEvent{
+		UserID:   userID,
+		Type:     eventType,
+		Severity: severity,
+		Details:  string(payload),
+	}); err != nil {
+		s.logger.WithError(err).Error("Failed to record security event")
+	}
+}
@@ -0,0 +1,374 @@
+package service
+
+import (
+	"api/internal/models"
+	"api/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrDSARNotFound           = errors.New("dsar request not found")
+	ErrDSARClosed             = errors.New("dsar request is closed")
+	ErrInvalidDSARType        = errors.New("request type must be access, erasure or rectification")
+	ErrInvalidDSARDisposition = errors.New("disposition must be fulfilled, partially_fulfilled or rejected")
+	ErrInvalidDSARExtension   = errors.New("extension exceeds the maximum allowed")
+	ErrDSARNoPackage          = errors.New("no data package has been assembled")
+)
+
+// DSAR evidence trail actions
+const (
+	DSARActionOpened            = "opened"
+	DSARActionPackageRequested  = "package_requested"
+	DSARActionPackageDownloaded = "package_downloaded"
+	DSARActionExtended          = "deadline_extended"
+	DSARActionReminderSent      = "reminder_sent"
+	DSARActionClosed            = "closed"
+)
+
+// DSARConfig holds the legal deadlines for data subject requests
+type DSARConfig struct {
+	DeadlineDays     int   // time to respond after receipt
+	MaxExtensionDays int   // total extension allowed on top of the deadline
+	ReminderDays     []int // remind the handling admin this many days before the deadline
+}
+
+// DSAREvidence is the exported record of how a request was handled
+type DSAREvidence struct {
+	GeneratedAt time.Time          `json:"generatedAt"`
+	Request     models.DSARRequest `json:"request"`
+	Events      []models.DSAREvent `json:"events"`
+	Package     *models.ExportJob  `json:"package,omitempty"`
+}
+
+// DSARService tracks data subject access requests handled by admins
+type DSARService interface {
+	Open(actorID, subjectID uint, requestType string, receivedAt time.Time, notes string) (*models.DSARRequest, error)
+	List(status string) ([]models.DSARRequest, error)
+	Get(id uint) (*models.DSARRequest, []models.DSAREvent, error)
+	// AssemblePackage starts (or reuses) a personal data export of the subject
+	AssemblePackage(actorID, id uint) (*models.DSARRequest, *models.ExportJob, error)
+	// OpenPackage returns the assembled data package for download
+	OpenPackage(ctx context.Context, actorID, id uint) (io.ReadCloser, *models.ExportJob, error)
+	Extend(actorID, id uint, days int, reason string) (*models.DSARRequest, error)
+	Close(actorID, id uint, disposition, note string) (*models.DSARRequest, error)
+	Evidence(id uint) (*DSAREvidence, error)
+	// SendReminders notifies the handling admins of requests approaching or past their deadline
+	SendReminders(now time.Time)
+}
+
+type dsarService struct {
+	requests repository.DSARRepository
+	users    repository.UserRepository
+	exports  ExportService
+	emails   EmailService
+	config   DSARConfig
+	logger   *logrus.Logger
+}
+
+func NewDSARService(requests repository.DSARRepository, users repository.UserRepository, exports ExportService, emails EmailService, config DSARConfig, logger *logrus.Logger) DSARService {
+	return &dsarService{
+		requests: requests,
+		users:    users,
+		exports:  exports,
+		emails:   emails,
+		config:   config,
+		logger:   logger,
+	}
+}
+
+func (s *dsarService) record(requestID uint, actorID *uint, action string, details map[string]interface{}) {
+	payload := ""
+	if details != nil {
+		b, _ := json.Marshal(details)
+		payload = string(b)
+	}
+	if err := s.requests.AddEvent(&models.DSAREvent{
+		RequestID: requestID,
+		ActorID:   actorID,
+		Action:    action,
+		Details:   payload,
+	}); err != nil {
+		s.logger.WithError(err).WithField("dsar_id", requestID).Error("Failed to record DSAR event")
+	}
+}
+
+func (s *dsarService) find(id uint) (*models.DSARRequest, error) {
+	request, err := s.requests.FindByID(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrDSARNotFound
+		}
+		return nil, fmt.Errorf("find dsar request: %w", err)
+	}
+	return request, nil
+}
+
+// findOpen returns the request if it can still be worked on, marking it in progress
+func (s *dsarService) findOpen(id uint) (*models.DSARRequest, error) {
+	request, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	if request.Status == models.DSARClosed {
+		return nil, ErrDSARClosed
+	}
+	request.Status = models.DSARInProgress
+	return request, nil
+}
+
+func (s *dsarService) Open(actorID, subjectID uint, requestType string, receivedAt time.Time, notes string) (*models.DSARRequest, error) {
+	switch requestType {
+	case models.DSARTypeAccess, models.DSARTypeErasure, models.DSARTypeRectification:
+	default:
+		return nil, ErrInvalidDSARType
+	}
+	if _, err := s.users.FindByID(subjectID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("find subject: %w", err)
+	}
+
+	if receivedAt.IsZero() {
+		receivedAt = time.Now()
+	}
+	request := &models.DSARRequest{
+		SubjectUserID: subjectID,
+		Type:          requestType,
+		Status:        models.DSAROpen,
+		OpenedByID:    actorID,
+		ReceivedAt:    receivedAt,
+		DueAt:         receivedAt.AddDate(0, 0, s.config.DeadlineDays),
+		Notes:         notes,
+	}
+	if err := s.requests.Create(request); err != nil {
+		return nil, fmt.Errorf("create dsar request: %w", err)
+	}
+
+	s.record(request.ID, &actorID, DSARActionOpened, map[string]interface{}{
+		"type":       requestType,
+		"subjectId":  subjectID,
+		"receivedAt": receivedAt,
+		"dueAt":      request.DueAt,
+	})
+	s.logger.WithFields(logrus.Fields{
+		"dsar_id":    request.ID,
+		"subject_id": subjectID,
+		"type":       requestType,
+		"due_at":     request.DueAt,
+	}).Info("DSAR request opened")
+	return request, nil
+}
+
+func (s *dsarService) List(status string) ([]models.DSARRequest, error) {
+	return s.requests.List(status)
+}
+
+func (s *dsarService) Get(id uint) (*models.DSARRequest, []models.DSAREvent, error) {
+	request, err := s.find(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	events, err := s.requests.ListEvents(id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list dsar events: %w", err)
+	}
+	return request, events, nil
+}
+
+func (s *dsarService) AssemblePackage(actorID, id uint) (*models.DSARRequest, *models.ExportJob, error) {
+	request, err := s.findOpen(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	job, err := s.exports.Request(request.SubjectUserID, ExportFormatJSON)
+	if err != nil {
+		return nil, nil, err
+	}
+	request.ExportJobID = &job.ID
+	if err := s.requests.Save(request); err != nil {
+		return nil, nil, fmt.Errorf("save dsar request: %w", err)
+	}
+
+	s.record(request.ID, &actorID, DSARActionPackageRequested, map[string]interface{}{"exportId": job.ID})
+	return request, job, nil
+}
+
+func (s *dsarService) OpenPackage(ctx context.Context, actorID, id uint) (io.ReadCloser, *models.ExportJob, error) {
+	request, err := s.find(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if request.ExportJobID == nil {
+		return nil, nil, ErrDSARNoPackage
+	}
+
+	body, job, err := s.exports.Open(ctx, request.SubjectUserID, *request.ExportJobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.record(request.ID, &actorID, DSARActionPackageDownloaded, map[string]interface{}{"exportId": job.ID})
+	return body, job, nil
+}
+
+func (s *dsarService) Extend(actorID, id uint, days int, reason string) (*models.DSARRequest, error) {
+	request, err := s.findOpen(id)
+	if err != nil {
+		return nil, err
+	}
+
+	due := request.DueAt.AddDate(0, 0, days)
+	limit := request.ReceivedAt.AddDate(0, 0, s.config.DeadlineDays+s.config.MaxExtensionDays)
+	if days < 1 || due.After(limit) {
+		return nil, ErrInvalidDSARExtension
+	}
+	previous := request.DueAt
+	request.DueAt = due
+	// Reminders start over for the new deadline
+	request.LastReminderAt = nil
+	if err := s.requests.Save(request); err != nil {
+		return nil, fmt.Errorf("save dsar request: %w", err)
+	}
+
+	s.record(request.ID, &actorID, DSARActionExtended, map[string]interface{}{
+		"from":   previous,
+		"to":     due,
+		"reason": reason,
+	})
+	return request, nil
+}
+
+func (s *dsarService) Close(actorID, id uint, disposition, note string) (*models.DSARRequest, error) {
+	switch disposition {
+	case models.DSARFulfilled, models.DSARPartiallyFulfilled, models.DSARRejected:
+	default:
+		return nil, ErrInvalidDSARDisposition
+	}
+
+	request, err := s.findOpen(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	request.Status = models.DSARClosed
+	request.Disposition = disposition
+	request.DispositionNote = note
+	request.ClosedAt = &now
+	if err := s.requests.Save(request); err != nil {
+		return nil, fmt.Errorf("save dsar request: %w", err)
+	}
+
+	s.record(request.ID, &actorID, DSARActionClosed, map[string]interface{}{
+		"disposition": disposition,
+		"note":        note,
+		"onTime":      !now.After(request.DueAt),
+	})
+	s.logger.WithFields(logrus.Fields{
+		"dsar_id":     request.ID,
+		"disposition": disposition,
+	}).Info("DSAR request closed")
+	return request, nil
+}
+
+func (s *dsarService) Evidence(id uint) (*DSAREvidence, error) {
+	request, events, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	evidence := &DSAREvidence{
+		GeneratedAt: time.Now().UTC(),
+		Request:     *request,
+		Events:      events,
+	}
+	if request.ExportJobID != nil {
+		job, err := s.exports.Get(request.SubjectUserID, *request.ExportJobID)
+		if err == nil {
+			evidence.Package = job
+		} else if !errors.Is(err, ErrExportNotFound) {
+			return nil, err
+		}
+	}
+	return evidence, nil
+}
+
+// reminderDue reports whether a reminder should go out for request at now: once
+// when each configured threshold is crossed and daily once the deadline has passed.
+func (s *dsarService) reminderDue(request *models.DSARRequest, now time.Time) bool {
+	if now.After(request.DueAt) {
+		return request.LastReminderAt == nil || now.Sub(*request.LastReminderAt) >= 24*time.Hour
+	}
+	for _, days := range s.config.ReminderDays {
+		threshold := request.DueAt.AddDate(0, 0, -days)
+		if now.After(threshold) && (request.LastReminderAt == nil || request.LastReminderAt.Before(threshold)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *dsarService) SendReminders(now time.Time) {
+	longest := 0
+	for _, days := range s.config.ReminderDays {
+		if days > longest {
+			longest = days
+		}
+	}
+
+	requests, err := s.requests.ListDueBefore(now.AddDate(0, 0, longest))
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to list DSAR requests for reminders")
+		return
+	}
+
+	for i := range requests {
+		request := &requests[i]
+		if !s.reminderDue(request, now) {
+			continue
+		}
+
+		recipient := ""
+		if admin, err := s.users.FindByID(request.OpenedByID); err == nil {
+			recipient = admin.Email
+		}
+		messageID := ""
+		if recipient != "" {
+			messageID, err = s.emails.Send("dsar_reminder", recipient, map[string]interface{}{
+				"RequestID": request.ID,
+				"Type":      request.Type,
+				"DueAt":     request.DueAt.UTC().Format(time.RFC1123),
+				"Overdue":   now.After(request.DueAt),
+			})
+			if err != nil {
+				s.logger.WithError(err).Error("Failed to send DSAR reminder email")
+			}
+		}
+
+		request.LastReminderAt = &now
+		if err := s.requests.Save(request); err != nil {
+			s.logger.WithError(err).WithField("dsar_id", request.ID).Error("Failed to save DSAR request")
+			continue
+		}
+		s.record(request.ID, nil, DSARActionReminderSent, map[string]interface{}{
+			"recipient": recipient,
+			"dueAt":     request.DueAt,
+			"overdue":   now.After(request.DueAt),
+		})
+		s.logger.WithFields(logrus.Fields{
+			"dsar_id":    request.ID,
+			"due_at":     request.DueAt,
+			"overdue":    now.After(request.DueAt),
+			"email":      recipient,
+			"message_id": messageID,
+		}).Warn("DSAR deadline reminder sent")
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/i18n"
+	"api/internal/mailer"
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EmailService sends templated emails and aggregates deliverability events
+type EmailService interface {
+	// Send renders template for recipient and queues it for delivery, returning the message ID.
+	// A "sent" (or "failed") event is recorded once the provider accepted (or rejected) it.
+	Send(template, recipient string, data map[string]interface{}) (string, error)
+	// SendLocalized is Send with the template's translation for locale, when there is one
+	SendLocalized(template, locale, recipient string, data map[string]interface{}) (string, error)
+	// SendToUser is SendLocalized in the locale saved in user's profile, to recipient
+	// (normally user.Email). A time.Time under "Time" is shown in the user's timezone.
+	SendToUser(template string, user *models.User, recipient string, data map[string]interface{}) (string, error)
+	// RecordProviderEvent stores a provider notification, resolving the template from the sent event when missing
+	RecordProviderEvent(provider, messageID, event, recipient, template string) error
+	Stats(since time.Time) ([]repository.EmailEventCount, error)
+}
+
+type emailService struct {
+	events    repository.EmailEventRepository
+	users     repository.UserRepository
+	templates *mailer.Templates
+	queue     *mailer.Queue
+	from      string
+	provider  string
+	logger    *logrus.Logger
+}
+
+func NewEmailService(events repository.EmailEventRepository, users repository.UserRepository, templates *mailer.Templates, queue *mailer.Queue, from, provider string, logger *logrus.Logger) EmailService {
+	s := &emailService{
+		events:    events,
+		users:     users,
+		templates: templates,
+		queue:     queue,
+		from:      from,
+		provider:  provider,
+		logger:    logger,
+	}
+	queue.OnResult(s.recordResult)
+	return s
+}
+
+func (s *emailService) Send(template, recipient string, data map[string]interface{}) (string, error) {
+	return s.SendLocalized(template, "", recipient, data)
+}
+
+func (s *emailService) SendToUser(template string, user *models.User, recipient string, data map[string]interface{}) (string, error) {
+	locale, location := i18n.Default, time.UTC
+	profile, err := s.users.FindProfile(user.ID)
+	switch {
+	case err == nil:
+		if l := i18n.Normalize(profile.Locale); l != "" {
+			locale = l
+		}
+		if profile.Timezone != "" {
+			if loc, err := time.LoadLocation(profile.Timezone); err == nil {
+				location = loc
+			}
+		}
+	case !errors.Is(err, repository.ErrNotFound):
+		s.logger.WithError(err).WithField("user_id", user.ID).Warn("Failed to load profile, sending email in the default locale")
+	}
+	for key, value := range data {
+		if at, ok := value.(time.Time); ok {
+			data[key] = at.In(location).Format(time.RFC1123)
+		}
+	}
+	return s.SendLocalized(template, locale, recipient, data)
+}
+
+func (s *emailService) SendLocalized(template, locale, recipient string, data map[string]interface{}) (string, error) {
+	subject, text, html, err := s.templates.Render(template, locale, data)
+	if err != nil {
+		return "", err
+	}
+	messageID, err := auth.GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	msg := &mailer.Message{
+		MessageID: messageID,
+		Template:  template,
+		From:      s.from,
+		To:        recipient,
+		Subject:   subject,
+		Text:      text,
+		HTML:      html,
+	}
+	if err := s.queue.Enqueue(msg); err != nil {
+		return "", fmt.Errorf("queue %s email: %w", template, err)
+	}
+	return messageID, nil
+}
+
+// recordResult stores the outcome of a delivery attempt reported by the mail queue
+func (s *emailService) recordResult(msg *mailer.Message, sendErr error) {
+	event := models.EmailEventSent
+	if sendErr != nil {
+		event = models.EmailEventFailed
+	}
+	if err := s.events.Create(&models.EmailEvent{
+		MessageID: msg.MessageID,
+		Template:  msg.Template,
+		Recipient: msg.To,
+		Provider:  s.provider,
+		Event:     event,
+	}); err != nil {
+		s.logger.WithError(err).WithField("message_id", msg.MessageID).Error("Failed to record email event")
+	}
+}
+
+func (s *emailService) RecordProviderEvent(provider, messageID, event, recipient, template string) error {
+	if template == "" {
+		// Providers usually only echo the message ID
+		sent, err := s.events.FindSent(messageID)
+		switch {
+		case err == nil:
+			template = sent.Template
+		case errors.Is(err, repository.ErrNotFound):
+			template = "unknown"
+		default:
+			return err
+		}
+	}
+
+	return s.events.Create(&models.EmailEvent{
+		MessageID: messageID,
+		Template:  template,
+		Recipient: recipient,
+		Provider:  provider,
+		Event:     event,
+	})
+}
+
+func (s *emailService) Stats(since time.Time) ([]repository.EmailEventCount, error) {
+	return s.events.CountByTemplate(since)
+}
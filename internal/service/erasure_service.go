@@ -0,0 +1,182 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"api/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Account erasure modes
+const (
+	// ErasureSoft soft deletes the user; the data stays in the database
+	ErasureSoft = "soft"
+	// ErasureAnonymize replaces personal data with placeholders and keeps the user row
+	ErasureAnonymize = "anonymize"
+	// ErasureHard permanently deletes the user and the data linked to the account
+	ErasureHard = "hard"
+)
+
+var ErrInvalidErasureMode = errors.New("erasure mode must be soft, anonymize or hard")
+
+// ValidErasureMode reports whether mode is one of the erasure modes
+func ValidErasureMode(mode string) bool {
+	return mode == ErasureSoft || mode == ErasureAnonymize || mode == ErasureHard
+}
+
+// ErasureService deletes accounts according to the configured privacy policy
+type ErasureService interface {
+	// Erase deletes the account using mode, or the configured policy when mode is empty.
+	// It returns the mode that was applied.
+	Erase(ctx context.Context, userID uint, mode string) (string, error)
+	// Purge permanently deletes a soft deleted user and everything linked to the account.
+	// It returns ErrUserNotDeleted for accounts that were not deleted.
+	Purge(ctx context.Context, userID uint) error
+	// EraseDue erases the accounts pending deletion whose grace period ended before now,
+	// using the configured policy. It returns how many were erased.
+	EraseDue(ctx context.Context, now time.Time) (int, error)
+}
+
+type erasureService struct {
+	users       repository.UserRepository
+	avatars     AvatarService
+	storage     storage.Storage
+	revoker     TokenRevoker
+	defaultMode string
+	logger      *logrus.Logger
+}
+
+func NewErasureService(users repository.UserRepository, avatars AvatarService, store storage.Storage, revoker TokenRevoker, defaultMode string, logger *logrus.Logger) ErasureService {
+	return &erasureService{
+		users:       users,
+		avatars:     avatars,
+		storage:     store,
+		revoker:     revoker,
+		defaultMode: defaultMode,
+		logger:      logger,
+	}
+}
+
+// anonymizedEmail derives a placeholder that stays unique per account without revealing the address
+func anonymizedEmail(email string) string {
+	return fmt.Sprintf("deleted-%s@deleted.invalid", auth.HashToken(email)[:24])
+}
+
+func (s *erasureService) Erase(ctx context.Context, userID uint, mode string) (string, error) {
+	if mode == "" {
+		mode = s.defaultMode
+	}
+	if !ValidErasureMode(mode) {
+		return "", ErrInvalidErasureMode
+	}
+
+	var media *repository.ErasedMedia
+	var err error
+	switch mode {
+	case ErasureSoft:
+		err = s.users.DeleteAccount(userID)
+	case ErasureAnonymize:
+		var user *models.User
+		user, err = s.users.FindByID(userID)
+		if err != nil {
+			break
+		}
+		// A random password nobody knows; the hash keeps the column valid
+		var password string
+		password, err = auth.GenerateRandomToken(32)
+		if err != nil {
+			return "", err
+		}
+		var hash string
+		hash, err = auth.HashPassword(password)
+		if err != nil {
+			return "", err
+		}
+		media, err = s.users.AnonymizeAccount(userID, anonymizedEmail(user.Email), fmt.Sprintf("deleted_user_%d", userID), hash)
+	case ErasureHard:
+		media, err = s.users.HardDeleteAccount(userID)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return "", ErrUserNotFound
+		}
+		return "", fmt.Errorf("erase account: %w", err)
+	}
+
+	// Access tokens outlive the deleted refresh tokens until they expire
+	if err := s.revoker.RevokeUser(userID); err != nil {
+		s.logger.WithError(err).WithField("user_id", userID).Error("Failed to revoke access tokens of erased account")
+	}
+
+	if media != nil {
+		s.deleteMedia(ctx, media)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": userID,
+		"mode":    mode,
+	}).Info("Account erased")
+	return mode, nil
+}
+
+func (s *erasureService) Purge(ctx context.Context, userID uint) error {
+	user, err := s.users.FindIncludingDeleted(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("find user: %w", err)
+	}
+	if user.DeletedAt == nil {
+		return ErrUserNotDeleted
+	}
+	_, err = s.Erase(ctx, userID, ErasureHard)
+	return err
+}
+
+func (s *erasureService) EraseDue(ctx context.Context, now time.Time) (int, error) {
+	users, err := s.users.ListDeletionsDue(now)
+	if err != nil {
+		return 0, fmt.Errorf("list deletions due: %w", err)
+	}
+	erased := 0
+	for _, user := range users {
+		if err := ctx.Err(); err != nil {
+			return erased, err
+		}
+		if _, err := s.Erase(ctx, user.ID, ""); err != nil {
+			// The next run retries it
+			s.logger.WithError(err).WithField("user_id", user.ID).Error("Failed to erase account at the end of its grace period")
+			continue
+		}
+		erased++
+	}
+	return erased, nil
+}
+
+// deleteMedia removes the avatar (with its thumbnails) and export archives from storage.
+// Failures are logged; the database no longer references the objects.
+func (s *erasureService) deleteMedia(ctx context.Context, media *repository.ErasedMedia) {
+	keys := append([]string{}, media.ExportKeys...)
+	if media.AvatarKey != "" {
+		profile := &models.UserProfile{AvatarKey: media.AvatarKey}
+		keys = append(keys, media.AvatarKey)
+		for _, size := range s.avatars.Sizes() {
+			if key, err := s.avatars.Key(profile, size); err == nil {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if err := s.storage.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			s.logger.WithError(err).WithField("key", key).Warn("Failed to delete media of erased account")
+		}
+	}
+}
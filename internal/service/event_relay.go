@@ -0,0 +1,121 @@
+package service
+
+import (
+	"api/internal/events"
+	"api/internal/repository"
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxEventRetryDelay caps the exponential backoff between attempts to publish an event
+const maxEventRetryDelay = time.Hour
+
+// EventRelayConfig controls how the relay works through the outbox
+type EventRelayConfig struct {
+	BatchSize   int           // events published per run
+	MaxAttempts int           // attempts before an event is marked failed
+	RetryDelay  time.Duration // before the second attempt, doubling after each failure
+	Retention   time.Duration // how long delivered events are kept
+}
+
+// EventRelay publishes the user lifecycle events the model hooks write to the outbox
+// table in the same transaction as the change. An event written is published at least
+// once, even when the process stops right after the change; one that keeps failing is
+// marked failed after MaxAttempts and left in the table, where resetting its status to
+// pending and its attempts to 0 sends it again.
+type EventRelay interface {
+	// Dispatch publishes the due events in order and returns how many were delivered.
+	// Run by a singleton job, so one instance publishes at a time.
+	Dispatch(ctx context.Context, now time.Time) int
+	// PurgeDelivered drops delivered events older than the retention
+	PurgeDelivered(now time.Time)
+}
+
+type eventRelay struct {
+	outbox    repository.OutboxRepository
+	publisher events.Publisher
+	config    EventRelayConfig
+	logger    *logrus.Logger
+}
+
+func NewEventRelay(outbox repository.OutboxRepository, publisher events.Publisher, config EventRelayConfig, logger *logrus.Logger) EventRelay {
+	return &eventRelay{
+		outbox:    outbox,
+		publisher: publisher,
+		config:    config,
+		logger:    logger,
+	}
+}
+
+func (r *eventRelay) Dispatch(ctx context.Context, now time.Time) int {
+	due, err := r.outbox.Due(now, r.config.BatchSize)
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to load outbox events")
+		return 0
+	}
+
+	delivered := 0
+	for i := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		event := &due[i]
+		logger := r.logger.WithFields(logrus.Fields{
+			"event_id": event.ID,
+			"event":    event.Event,
+			"user_id":  event.UserID,
+			"attempt":  event.Attempts + 1,
+		})
+
+		err := r.publisher.Publish(ctx, events.Event{
+			ID:         event.ID,
+			Name:       event.Event,
+			UserID:     event.UserID,
+			Payload:    []byte(event.Payload),
+			OccurredAt: event.CreatedAt,
+		})
+		switch {
+		case err == nil:
+			if err := r.outbox.MarkDelivered(event, time.Now()); err != nil {
+				// Published but still pending, so it goes out again on the next run
+				logger.WithError(err).Error("Failed to mark event delivered")
+				continue
+			}
+			delivered++
+		case events.IsPermanent(err) || event.Attempts+1 >= r.config.MaxAttempts:
+			logger.WithError(err).Error("Giving up on event")
+			if err := r.outbox.MarkFailed(event, err.Error()); err != nil {
+				logger.WithError(err).Error("Failed to mark event failed")
+			}
+		default:
+			next := now.Add(r.retryDelay(event.Attempts))
+			logger.WithError(err).WithField("next_attempt_at", next).Warn("Failed to publish event, will retry")
+			if err := r.outbox.MarkRetry(event, next, err.Error()); err != nil {
+				logger.WithError(err).Error("Failed to schedule event retry")
+			}
+		}
+	}
+	return delivered
+}
+
+// retryDelay is the wait after the attempt following attempts earlier ones
+func (r *eventRelay) retryDelay(attempts int) time.Duration {
+	delay := r.config.RetryDelay
+	for i := 0; i < attempts && delay < maxEventRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxEventRetryDelay)
+}
+
+func (r *eventRelay) PurgeDelivered(now time.Time) {
+	purged, err := r.outbox.PurgeDelivered(now.Add(-r.config.Retention))
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to purge delivered events")
+		return
+	}
+	if purged > 0 {
+		r.logger.WithField("count", purged).Info("Purged delivered events")
+	}
+}
@@ -0,0 +1,450 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"api/internal/storage"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrExportNotFound      = errors.New("export not found")
+	ErrExportNotReady      = errors.New("export is not ready")
+	ErrInvalidExportFormat = errors.New("export format must be json or csv")
+	// ErrInvalidUserListFormat is returned for user list formats other than json, csv or xlsx
+	ErrInvalidUserListFormat = errors.New("user list format must be json, csv or xlsx")
+)
+
+// Supported export formats
+const (
+	ExportFormatJSON = "json"
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx" // user list exports only
+)
+
+// ExportConfig controls personal data exports
+type ExportConfig struct {
+	TTL     time.Duration // how long a finished archive can be downloaded
+	Workers int           // exports generated concurrently
+}
+
+// ExportRepositories groups the data sources included in a personal data export
+type ExportRepositories struct {
+	Users          repository.UserRepository
+	Tokens         repository.TokenRepository
+	APIKeys        repository.APIKeyRepository
+	Audit          repository.AuditRepository
+	SecurityEvents repository.SecurityEventRepository
+	Emails         repository.EmailEventRepository
+	Jobs           repository.ExportJobRepository
+}
+
+// ExportService builds downloadable archives of everything stored about a user
+type ExportService interface {
+	// Request starts an export, or returns a matching one that is in progress or still downloadable
+	Request(userID uint, format string) (*models.ExportJob, error)
+	Get(userID, jobID uint) (*models.ExportJob, error)
+	// Open returns the archive of a completed export
+	Open(ctx context.Context, userID, jobID uint) (io.ReadCloser, *models.ExportJob, error)
+	// Resume restarts exports interrupted by a shutdown
+	Resume()
+	// PurgeExpired deletes expired archives and their jobs, including cached user lists
+	PurgeExpired()
+	// UserListETag fingerprints the data of the admin user list export in format,
+	// without generating it; see OpenUserList for orgID
+	UserListETag(format string, orgID uint) (string, error)
+	// OpenUserList returns the user list export of the current data, reusing a cached
+	// file with the same ETag while it has not expired. A non-zero orgID limits it to
+	// the organization's members. adminID is recorded as the requester, and every
+	// download is written to the audit trail.
+	OpenUserList(ctx context.Context, adminID uint, format string, orgID uint) (io.ReadSeekCloser, *models.ExportJob, error)
+}
+
+type exportService struct {
+	repos   ExportRepositories
+	storage storage.Storage
+	config  ExportConfig
+	logger  *logrus.Logger
+	slots   chan struct{}
+}
+
+func NewExportService(repos ExportRepositories, store storage.Storage, config ExportConfig, logger *logrus.Logger) ExportService {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	return &exportService{
+		repos:   repos,
+		storage: store,
+		config:  config,
+		logger:  logger,
+		slots:   make(chan struct{}, config.Workers),
+	}
+}
+
+func (s *exportService) Request(userID uint, format string) (*models.ExportJob, error) {
+	if format != ExportFormatJSON && format != ExportFormatCSV {
+		return nil, ErrInvalidExportFormat
+	}
+
+	job, err := s.repos.Jobs.FindReusable(userID, format, time.Now())
+	if err == nil {
+		return job, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("find export: %w", err)
+	}
+
+	job = &models.ExportJob{
+		UserID: userID,
+		Kind:   models.ExportKindPersonal,
+		Format: format,
+		Status: models.ExportPending,
+	}
+	if err := s.repos.Jobs.Create(job); err != nil {
+		return nil, fmt.Errorf("create export: %w", err)
+	}
+
+	go s.process(*job)
+	return job, nil
+}
+
+func (s *exportService) Get(userID, jobID uint) (*models.ExportJob, error) {
+	job, err := s.repos.Jobs.FindForUser(userID, jobID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrExportNotFound
+		}
+		return nil, fmt.Errorf("find export: %w", err)
+	}
+	return job, nil
+}
+
+func (s *exportService) Open(ctx context.Context, userID, jobID uint) (io.ReadCloser, *models.ExportJob, error) {
+	job, err := s.Get(userID, jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.Status != models.ExportCompleted {
+		return nil, nil, ErrExportNotReady
+	}
+	if job.ExpiresAt != nil && time.Now().After(*job.ExpiresAt) {
+		return nil, nil, ErrExportNotFound
+	}
+
+	body, _, err := s.storage.Get(ctx, job.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil, ErrExportNotFound
+		}
+		return nil, nil, fmt.Errorf("read export: %w", err)
+	}
+	return body, job, nil
+}
+
+func (s *exportService) Resume() {
+	jobs, err := s.repos.Jobs.ListUnfinished()
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to list unfinished exports")
+		return
+	}
+	for _, job := range jobs {
+		go s.process(job)
+	}
+}
+
+func (s *exportService) PurgeExpired() {
+	jobs, err := s.repos.Jobs.ListExpired(time.Now())
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to list expired exports")
+		return
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		if job.StorageKey != "" {
+			if err := s.storage.Delete(context.Background(), job.StorageKey); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				s.logger.WithError(err).WithField("export_id", job.ID).Warn("Failed to delete export archive")
+				continue
+			}
+		}
+		if err := s.repos.Jobs.Delete(job); err != nil {
+			s.logger.WithError(err).WithField("export_id", job.ID).Warn("Failed to delete export job")
+		}
+	}
+}
+
+// process generates the archive of a job, limited to config.Workers at a time
+func (s *exportService) process(job models.ExportJob) {
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	logger := s.logger.WithFields(logrus.Fields{"export_id": job.ID, "user_id": job.UserID})
+
+	job.Status = models.ExportRunning
+	if err := s.repos.Jobs.Save(&job); err != nil {
+		logger.WithError(err).Error("Failed to update export")
+		return
+	}
+
+	key, size, err := s.generate(&job)
+	now := time.Now()
+	if err != nil {
+		logger.WithError(err).Error("Export failed")
+		job.Status = models.ExportFailed
+		job.Error = "export could not be generated"
+		// Failed jobs are cleaned up like finished ones
+		expires := now.Add(s.config.TTL)
+		job.ExpiresAt = &expires
+	} else {
+		expires := now.Add(s.config.TTL)
+		job.Status = models.ExportCompleted
+		job.StorageKey = key
+		job.Size = size
+		job.CompletedAt = &now
+		job.ExpiresAt = &expires
+		logger.WithField("bytes", size).Info("Export completed")
+	}
+	if err := s.repos.Jobs.Save(&job); err != nil {
+		logger.WithError(err).Error("Failed to update export")
+	}
+}
+
+// exportSection is one kind of record in the archive. The same columns are used
+// for the CSV header and as JSON object keys.
+type exportSection struct {
+	Name    string
+	Single  bool // exported as one object rather than a list
+	Columns []string
+	Rows    [][]interface{}
+}
+
+func (s *exportService) collect(userID uint) ([]exportSection, error) {
+	user, err := s.repos.Users.FindByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	sections := []exportSection{{
+		Name:    "account",
+		Single:  true,
+		Columns: []string{"id", "email", "username", "role", "emailVerified", "createdAt", "updatedAt"},
+		Rows:    [][]interface{}{{user.ID, user.Email, user.Username, user.Role, user.EmailVerified, user.CreatedAt, user.UpdatedAt}},
+	}}
+
+	profile := exportSection{
+		Name:    "profile",
+		Single:  true,
+		Columns: []string{"firstName", "lastName", "preferredName", "pronouns", "honorific", "bio", "avatarURL", "locale", "timezone", "visibility", "updatedAt"},
+	}
+	p, err := s.repos.Users.FindProfile(userID)
+	switch {
+	case err == nil:
+		profile.Rows = [][]interface{}{{p.FirstName, p.LastName, string(p.PreferredName), string(p.Pronouns), p.Honorific, string(p.Bio), p.AvatarURL,
+			p.Locale, p.Timezone, ProfileVisibility(p), p.UpdatedAt}}
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, fmt.Errorf("find profile: %w", err)
+	}
+	sections = append(sections, profile)
+
+	tokens, err := s.repos.Tokens.ListActive(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	sessions := exportSection{
+		Name:    "sessions",
+		Columns: []string{"id", "ipAddress", "userAgent", "startedAt", "lastUsedAt", "expiresAt"},
+	}
+	for _, t := range tokens {
+		sessions.Rows = append(sessions.Rows, []interface{}{t.ID, t.IPAddress, t.UserAgent, t.SessionStartedAt, t.LastUsedAt, t.ExpiresAt})
+	}
+	sections = append(sections, sessions)
+
+	keys, err := s.repos.APIKeys.ListByUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	apiKeys := exportSection{
+		Name:    "api_keys",
+		Columns: []string{"id", "name", "prefix", "scopes", "createdAt", "expiresAt", "lastUsedAt", "suspendedAt"},
+	}
+	for _, k := range keys {
+		apiKeys.Rows = append(apiKeys.Rows, []interface{}{k.ID, k.Name, k.Prefix, k.Scopes, k.CreatedAt, k.ExpiresAt, k.LastUsedAt, k.SuspendedAt})
+	}
+	sections = append(sections, apiKeys)
+
+	entries, err := s.repos.Audit.ListByUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list audit entries: %w", err)
+	}
+	audit := exportSection{
+		Name:    "audit_entries",
+		Columns: []string{"createdAt", "entity", "entityId", "action", "actorId", "changes"},
+	}
+	for _, e := range entries {
+		audit.Rows = append(audit.Rows, []interface{}{e.CreatedAt, e.Entity, e.EntityID, e.Action, e.ActorID, e.Changes})
+	}
+	sections = append(sections, audit)
+
+	events, err := s.repos.SecurityEvents.ListByUser(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list security events: %w", err)
+	}
+	security := exportSection{
+		Name:    "security_events",
+		Columns: []string{"createdAt", "type", "severity", "details"},
+	}
+	for _, e := range events {
+		security.Rows = append(security.Rows, []interface{}{e.CreatedAt, e.Type, e.Severity, e.Details})
+	}
+	sections = append(sections, security)
+
+	mails, err := s.repos.Emails.ListByRecipient(user.Email)
+	if err != nil {
+		return nil, fmt.Errorf("list email events: %w", err)
+	}
+	emails := exportSection{
+		Name:    "emails",
+		Columns: []string{"createdAt", "template", "event", "provider"},
+	}
+	for _, e := range mails {
+		emails.Rows = append(emails.Rows, []interface{}{e.CreatedAt, e.Template, e.Event, e.Provider})
+	}
+	sections = append(sections, emails)
+
+	return sections, nil
+}
+
+func (s *exportService) generate(job *models.ExportJob) (string, int64, error) {
+	sections, err := s.collect(job.UserID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	if job.Format == ExportFormatCSV {
+		err = writeCSVSections(archive, sections)
+	} else {
+		err = writeJSONSections(archive, sections)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if err := archive.Close(); err != nil {
+		return "", 0, err
+	}
+
+	name, err := auth.GenerateRandomToken(16)
+	if err != nil {
+		return "", 0, err
+	}
+	key := fmt.Sprintf("exports/%d/%s.zip", job.UserID, name)
+	size := int64(buf.Len())
+	if err := s.storage.Put(context.Background(), key, &buf, size, "application/zip"); err != nil {
+		return "", 0, fmt.Errorf("store export: %w", err)
+	}
+	return key, size, nil
+}
+
+func writeJSONSections(archive *zip.Writer, sections []exportSection) error {
+	doc := map[string]interface{}{"generatedAt": time.Now().UTC()}
+	for _, section := range sections {
+		objects := make([]map[string]interface{}, 0, len(section.Rows))
+		for _, row := range section.Rows {
+			obj := make(map[string]interface{}, len(row))
+			for i, col := range section.Columns {
+				obj[col] = row[i]
+			}
+			objects = append(objects, obj)
+		}
+		if section.Single {
+			if len(objects) == 0 {
+				doc[section.Name] = nil
+			} else {
+				doc[section.Name] = objects[0]
+			}
+			continue
+		}
+		doc[section.Name] = objects
+	}
+
+	w, err := archive.Create("export.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func writeCSVSections(archive *zip.Writer, sections []exportSection) error {
+	for _, section := range sections {
+		w, err := archive.Create(section.Name + ".csv")
+		if err != nil {
+			return err
+		}
+		out := csv.NewWriter(w)
+		if err := out.Write(section.Columns); err != nil {
+			return err
+		}
+		for _, row := range section.Rows {
+			record := make([]string, len(row))
+			for i, v := range row {
+				record[i] = csvValue(v)
+			}
+			if err := out.Write(record); err != nil {
+				return err
+			}
+		}
+		out.Flush()
+		if err := out.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func csvValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return val.UTC().Format(time.RFC3339)
+	case *time.Time:
+		if val == nil {
+			return ""
+		}
+		return val.UTC().Format(time.RFC3339)
+	case *uint:
+		if val == nil {
+			return ""
+		}
+		return fmt.Sprint(*val)
+	case string:
+		// Keep spreadsheet applications from evaluating user supplied text as formulas
+		if val != "" && strings.ContainsRune("=+-@", rune(val[0])) {
+			return "'" + val
+		}
+		return val
+	case map[string]string:
+		pairs := make([]string, 0, len(val))
+		for key, value := range val {
+			pairs = append(pairs, key+"="+value)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ";")
+	default:
+		return fmt.Sprint(val)
+	}
+}
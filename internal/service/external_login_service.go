@@ -0,0 +1,275 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrLinkConfirmationRequired is returned for a sign-in through an identity provider
+	// with the email of an account not yet bound to it; a confirmation link has been
+	// mailed to the account holder
+	ErrLinkConfirmationRequired = errors.New("linking the account to the identity provider must be confirmed")
+	ErrInvalidLinkToken         = errors.New("invalid or expired link confirmation token")
+)
+
+// Security event types recorded for external logins
+const (
+	EventLinkConfirmationRequested = "external_login_confirmation_requested"
+	EventExternalLoginLinked       = "external_login_linked"
+)
+
+// AccountLinkingConfig holds the settings for confirming links to existing accounts
+type AccountLinkingConfig struct {
+	URL        string        // the confirmation token is appended to this link
+	TokenTTL   time.Duration // how long a confirmation link stays valid
+	MaxPerHour int           // confirmation emails per account and hour
+}
+
+// ExternalLoginService finds the local user of an identity vouched for by the LDAP
+// directory or a SAML identity provider, by the provider's name and the subject it
+// knows the user by. Only accounts the provider created follow the role it maps.
+type ExternalLoginService interface {
+	// User returns the user bound to the identity, creating one on first sign-in. An
+	// existing account with the identity's email is not taken over: its holder is
+	// mailed a link binding it, and ErrLinkConfirmationRequired returned.
+	User(identity ExternalIdentity, client ClientInfo) (*models.User, error)
+	// Confirm binds the account a confirmation link was sent for to its identity
+	Confirm(token string, client ClientInfo) (*models.ExternalLogin, error)
+}
+
+type externalLoginService struct {
+	logins        repository.ExternalLoginRepository
+	users         repository.UserRepository
+	events        repository.SecurityEventRepository
+	emails        EmailService
+	notifications NotificationService
+	revoker       TokenRevoker
+	config        AccountLinkingConfig
+	logger        *logrus.Logger
+}
+
+func NewExternalLoginService(logins repository.ExternalLoginRepository, users repository.UserRepository, events repository.SecurityEventRepository, emails EmailService, notifications NotificationService, revoker TokenRevoker, config AccountLinkingConfig, logger *logrus.Logger) ExternalLoginService {
+	return &externalLoginService{
+		logins:        logins,
+		users:         users,
+		events:        events,
+		emails:        emails,
+		notifications: notifications,
+		revoker:       revoker,
+		config:        config,
+		logger:        logger,
+	}
+}
+
+func (s *externalLoginService) User(identity ExternalIdentity, client ClientInfo) (*models.User, error) {
+	if identity.Provider == "" || identity.Subject == "" {
+		return nil, fmt.Errorf("identity from %s without provider or subject", identity.Source)
+	}
+	login, err := s.logins.Find(identity.Source, identity.Provider, identity.Subject)
+	switch {
+	case err == nil:
+		user, err := s.users.FindByID(login.UserID)
+		if err == nil {
+			return s.applyRole(user, login, identity)
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("find user: %w", err)
+		}
+		// The account was deleted; the identity starts over
+		if err := s.logins.Delete(login); err != nil {
+			return nil, fmt.Errorf("delete external login: %w", err)
+		}
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, fmt.Errorf("find external login: %w", err)
+	}
+
+	user, err := s.users.FindByEmail(identity.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return s.provision(identity)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	// Whoever controls the provider could vouch for any email, so the account holder
+	// decides whether it may sign in to their account
+	if err := s.requestConfirmation(user, identity, client); err != nil {
+		return nil, err
+	}
+	return nil, ErrLinkConfirmationRequired
+}
+
+// applyRole gives a user the provider created the role the provider mapped for them.
+// Accounts linked to the provider keep the role they were given here.
+func (s *externalLoginService) applyRole(user *models.User, login *models.ExternalLogin, identity ExternalIdentity) (*models.User, error) {
+	if !login.Provisioned || user.Role == identity.Role {
+		return user, nil
+	}
+	previousRole := user.Role
+	user.Role = identity.Role
+	if err := s.users.Save(user); err != nil {
+		return nil, fmt.Errorf("update external user: %w", err)
+	}
+	// Access tokens carry the role, so those of the previous one stop working
+	if err := s.revoker.RevokeUser(user.ID); err != nil {
+		return nil, fmt.Errorf("revoke access tokens: %w", err)
+	}
+	s.notifications.RoleChanged(user, previousRole)
+	return user, nil
+}
+
+// provision creates the local user for an external identity. The password hash is of
+// a random secret nobody knows, so the account cannot sign in locally.
+func (s *externalLoginService) provision(identity ExternalIdentity) (*models.User, error) {
+	secret, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := auth.HashPassword(secret)
+	if err != nil {
+		return nil, fmt.Errorf("hash password: %w", err)
+	}
+	user := &models.User{
+		Email:         identity.Email,
+		Username:      identity.Username,
+		PasswordHash:  hashedPassword,
+		Role:          identity.Role,
+		EmailVerified: true,
+		Status:        models.UserStatusActive,
+		AuthSource:    identity.Source,
+	}
+	login := &models.ExternalLogin{
+		Source:      identity.Source,
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		Provisioned: true,
+	}
+	if err := s.logins.Provision(user, login); err != nil {
+		if conflict := userConflict(err); conflict != nil {
+			return nil, conflict
+		}
+		return nil, fmt.Errorf("provision external user: %w", err)
+	}
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  user.ID,
+		"source":   identity.Source,
+		"provider": identity.Provider,
+		"subject":  identity.Subject,
+	}).Info("Provisioned user from identity provider")
+	return user, nil
+}
+
+// requestConfirmation mails the account holder a link that binds the account to identity
+func (s *externalLoginService) requestConfirmation(user *models.User, identity ExternalIdentity, client ClientInfo) error {
+	now := time.Now()
+	recent, err := s.logins.CountConfirmationsSince(user.ID, now.Add(-time.Hour))
+	if err != nil {
+		return fmt.Errorf("count link confirmations: %w", err)
+	}
+	if recent >= s.config.MaxPerHour {
+		s.recordEvent(user.ID, EventLinkConfirmationRequested, "warning", client, map[string]interface{}{"provider": identity.Provider, "throttled": true})
+		s.logger.WithField("user_id", user.ID).Warn("Link confirmations throttled")
+		return nil
+	}
+
+	token, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	confirmation := &models.ExternalLoginConfirmation{
+		UserID:      user.ID,
+		Source:      identity.Source,
+		Provider:    identity.Provider,
+		Subject:     identity.Subject,
+		IPAddress:   client.IP,
+		TokenDigest: auth.HashToken(token),
+		ExpiresAt:   now.Add(s.config.TokenTTL),
+	}
+	if err := s.logins.CreateConfirmation(confirmation); err != nil {
+		return fmt.Errorf("create link confirmation: %w", err)
+	}
+
+	messageID, err := s.emails.SendToUser("external_login_confirmation", user, user.Email, map[string]interface{}{
+		"Username":   user.Username,
+		"Provider":   identity.Provider,
+		"ConfirmURL": s.config.URL + token,
+		"ExpiresIn":  s.config.TokenTTL.String(),
+		"Time":       now,
+		"IP":         client.IP,
+	})
+	if err != nil {
+		return fmt.Errorf("send link confirmation: %w", err)
+	}
+
+	s.recordEvent(user.ID, EventLinkConfirmationRequested, "warning", client, map[string]interface{}{"provider": identity.Provider, "messageId": messageID})
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"provider":   identity.Provider,
+		"message_id": messageID,
+	}).Info("Link confirmation queued")
+	return nil
+}
+
+func (s *externalLoginService) Confirm(token string, client ClientInfo) (*models.ExternalLogin, error) {
+	confirmation, err := s.logins.FindConfirmationByDigest(auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidLinkToken
+		}
+		return nil, fmt.Errorf("find link confirmation: %w", err)
+	}
+	now := time.Now()
+	if confirmation.ConfirmedAt != nil || !now.Before(confirmation.ExpiresAt) {
+		return nil, ErrInvalidLinkToken
+	}
+
+	login := &models.ExternalLogin{
+		UserID:   confirmation.UserID,
+		Source:   confirmation.Source,
+		Provider: confirmation.Provider,
+		Subject:  confirmation.Subject,
+	}
+	confirmed, err := s.logins.Confirm(confirmation, login, now)
+	if err != nil {
+		// The identity was bound to an account in the meantime
+		var duplicate *repository.DuplicateError
+		if errors.As(err, &duplicate) {
+			return nil, ErrInvalidLinkToken
+		}
+		return nil, fmt.Errorf("confirm external login: %w", err)
+	}
+	if !confirmed {
+		return nil, ErrInvalidLinkToken
+	}
+
+	s.recordEvent(confirmation.UserID, EventExternalLoginLinked, "warning", client, map[string]interface{}{"source": login.Source, "provider": login.Provider})
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  confirmation.UserID,
+		"source":   login.Source,
+		"provider": login.Provider,
+		"subject":  login.Subject,
+	}).Info("Linked account to identity provider")
+	return login, nil
+}
+
+func (s *externalLoginService) recordEvent(userID uint, eventType, severity string, client ClientInfo, details map[string]interface{}) {
+	details["ip"] = client.IP
+	details["userAgent"] = client.UserAgent
+	payload, _ := json.Marshal(details)
+
+	if err := s.events.Create(&models.SecurityEvent{
+		UserID:   userID,
+		Type:     eventType,
+		Severity: severity,
+		Details:  string(payload),
+	}); err != nil {
+		s.logger.WithError(err).Error("Failed to record security event")
+	}
+}
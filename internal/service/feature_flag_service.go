@@ -0,0 +1,224 @@
+package service
+
+import (
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrFeatureFlagNotFound = errors.New("feature flag not found")
+	// ErrInvalidFeatureFlag is returned, wrapped with the reason, for flags that cannot be stored
+	ErrInvalidFeatureFlag = errors.New("invalid feature flag")
+)
+
+// featureFlagKeyPattern keeps keys usable in clients as identifiers
+var featureFlagKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.-]{0,63}$`)
+
+// featureFlagRoles are the roles rollout rules can name
+var featureFlagRoles = map[string]bool{"user": true, "admin": true}
+
+// FeatureFlagInput describes a feature flag. RolePercentages overrides Percentage for
+// the users of the listed roles.
+type FeatureFlagInput struct {
+	Description     string
+	Enabled         bool
+	Percentage      int
+	RolePercentages map[string]int
+}
+
+// FeatureFlagService manages the feature flags and tells which are on for a user.
+// Flags are evaluated from memory: changes apply to this instance right away and to
+// the others at their next Reload.
+type FeatureFlagService interface {
+	List() ([]models.FeatureFlag, error)
+	Get(key string) (*models.FeatureFlag, error)
+	// Define creates or updates the flag key and reports whether it was created
+	Define(key string, input FeatureFlagInput) (*models.FeatureFlag, bool, error)
+	Delete(key string) error
+	// Reload reads the stored flags into memory
+	Reload() error
+	// Enabled reports whether the flag key is on for the user; unknown flags are off
+	Enabled(key string, userID uint, role string) bool
+	// EnabledFor returns the keys of the flags on for the user, sorted
+	EnabledFor(userID uint, role string) []string
+}
+
+type featureFlagService struct {
+	flags  repository.FeatureFlagRepository
+	logger *logrus.Logger
+
+	mu     sync.RWMutex
+	loaded map[string]models.FeatureFlag
+}
+
+func NewFeatureFlagService(flags repository.FeatureFlagRepository, logger *logrus.Logger) FeatureFlagService {
+	return &featureFlagService{
+		flags:  flags,
+		logger: logger,
+		loaded: map[string]models.FeatureFlag{},
+	}
+}
+
+// FeatureFlagRolePercentages parses the role rules of flag
+func FeatureFlagRolePercentages(flag *models.FeatureFlag) map[string]int {
+	percentages := map[string]int{}
+	for _, rule := range strings.Split(flag.RolePercentages, ",") {
+		role, value, ok := strings.Cut(rule, "=")
+		if percentage, err := strconv.Atoi(value); ok && err == nil {
+			percentages[role] = percentage
+		}
+	}
+	return percentages
+}
+
+func (s *featureFlagService) List() ([]models.FeatureFlag, error) {
+	flags, err := s.flags.List()
+	if err != nil {
+		return nil, fmt.Errorf("list feature flags: %w", err)
+	}
+	return flags, nil
+}
+
+func (s *featureFlagService) Get(key string) (*models.FeatureFlag, error) {
+	flag, err := s.flags.FindByKey(key)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrFeatureFlagNotFound
+		}
+		return nil, fmt.Errorf("find feature flag: %w", err)
+	}
+	return flag, nil
+}
+
+func (s *featureFlagService) Define(key string, input FeatureFlagInput) (*models.FeatureFlag, bool, error) {
+	if !featureFlagKeyPattern.MatchString(key) {
+		return nil, false, fmt.Errorf("%w: keys are 1-64 letters, digits, _, . and -, starting with a letter", ErrInvalidFeatureFlag)
+	}
+	if input.Percentage < 0 || input.Percentage > 100 {
+		return nil, false, fmt.Errorf("%w: percentage must be between 0 and 100", ErrInvalidFeatureFlag)
+	}
+	rules := make([]string, 0, len(input.RolePercentages))
+	for role, percentage := range input.RolePercentages {
+		if !featureFlagRoles[role] {
+			return nil, false, fmt.Errorf("%w: unknown role %q", ErrInvalidFeatureFlag, role)
+		}
+		if percentage < 0 || percentage > 100 {
+			return nil, false, fmt.Errorf("%w: the percentage of %s must be between 0 and 100", ErrInvalidFeatureFlag, role)
+		}
+		rules = append(rules, role+"="+strconv.Itoa(percentage))
+	}
+	sort.Strings(rules)
+
+	flag, err := s.flags.FindByKey(key)
+	created := errors.Is(err, repository.ErrNotFound)
+	switch {
+	case created:
+		flag = &models.FeatureFlag{Key: key}
+	case err != nil:
+		return nil, false, fmt.Errorf("find feature flag: %w", err)
+	}
+	flag.Description = strings.TrimSpace(input.Description)
+	flag.Enabled = input.Enabled
+	flag.Percentage = input.Percentage
+	flag.RolePercentages = strings.Join(rules, ",")
+	if err := s.flags.Save(flag); err != nil {
+		return nil, false, fmt.Errorf("save feature flag: %w", err)
+	}
+
+	s.mu.Lock()
+	s.loaded[flag.Key] = *flag
+	s.mu.Unlock()
+	s.logger.WithFields(logrus.Fields{
+		"key":        key,
+		"enabled":    flag.Enabled,
+		"percentage": flag.Percentage,
+		"roles":      flag.RolePercentages,
+		"created":    created,
+	}).Info("Feature flag saved")
+	return flag, created, nil
+}
+
+func (s *featureFlagService) Delete(key string) error {
+	flag, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	if err := s.flags.Delete(flag); err != nil {
+		return fmt.Errorf("delete feature flag: %w", err)
+	}
+	s.mu.Lock()
+	delete(s.loaded, key)
+	s.mu.Unlock()
+	s.logger.WithField("key", key).Info("Feature flag deleted")
+	return nil
+}
+
+func (s *featureFlagService) Reload() error {
+	flags, err := s.List()
+	if err != nil {
+		return err
+	}
+	loaded := make(map[string]models.FeatureFlag, len(flags))
+	for _, flag := range flags {
+		loaded[flag.Key] = flag
+	}
+	s.mu.Lock()
+	s.loaded = loaded
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *featureFlagService) Enabled(key string, userID uint, role string) bool {
+	s.mu.RLock()
+	flag, ok := s.loaded[key]
+	s.mu.RUnlock()
+	return ok && flagOn(&flag, userID, role)
+}
+
+func (s *featureFlagService) EnabledFor(userID uint, role string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := []string{}
+	for key, flag := range s.loaded {
+		if flagOn(&flag, userID, role) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// flagOn evaluates flag for a user: the percentage of their role, or the flag's, says
+// how many of the 100 rollout buckets it is on for. Anonymous users (userID 0) only
+// get flags rolled out to everyone.
+func flagOn(flag *models.FeatureFlag, userID uint, role string) bool {
+	if !flag.Enabled {
+		return false
+	}
+	percentage := flag.Percentage
+	if rolePercentage, ok := FeatureFlagRolePercentages(flag)[role]; ok {
+		percentage = rolePercentage
+	}
+	if userID == 0 {
+		return percentage >= 100
+	}
+	return rolloutBucket(flag.Key, userID) < percentage
+}
+
+// rolloutBucket places a user in one of 100 buckets per flag, so a flag stays on for
+// the same users while its percentage is unchanged and raising it only adds users
+func rolloutBucket(key string, userID uint) int {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d", key, userID)
+	return int(h.Sum32() % 100)
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"api/internal/geoip"
+	"api/internal/models"
+	"api/internal/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrLoginCountryBlocked = errors.New("sign-ins from this country are blocked")
+	// ErrImpossibleTravel is returned when the distance to the previous sign-in could not
+	// have been covered in the time between them, and such sign-ins are denied
+	ErrImpossibleTravel = errors.New("sign-in location implies impossible travel")
+)
+
+// Audited actions of sign-in location checks
+const (
+	AuditGeoBlocked       = "geo_blocked"
+	AuditImpossibleTravel = "impossible_travel"
+)
+
+// GeoResolver resolves client addresses to locations; see geoip.Reader
+type GeoResolver interface {
+	Lookup(ip net.IP) (*geoip.Location, error)
+}
+
+// GeoConfig holds the sign-in location rules
+type GeoConfig struct {
+	BlockedCountries     []string // ISO 3166-1 alpha-2 codes
+	ImpossibleTravel     bool
+	MaxSpeedKmh          float64 // faster travel between two sign-ins is impossible
+	MinDistanceKm        float64 // shorter distances are within the database's accuracy
+	DenyImpossibleTravel bool    // refuse such sign-ins instead of only alerting
+}
+
+// GeoService checks where sign-ins come from. Refused and suspicious sign-ins are
+// recorded in the audit trail and reported to the user by email. Addresses the
+// database does not know, such as private ones, are not checked.
+type GeoService interface {
+	// CheckSignIn resolves the client's location and compares it with the user's
+	// previous sign-in. It returns ErrLoginCountryBlocked, or ErrImpossibleTravel when
+	// those sign-ins are denied. The location is nil when it could not be resolved.
+	CheckSignIn(user *models.User, client ClientInfo) (*models.LoginLocation, error)
+	// RecordSignIn remembers the location of a completed sign-in; nil is ignored
+	RecordSignIn(location *models.LoginLocation)
+}
+
+type geoService struct {
+	resolver      GeoResolver // nil when GeoIP is disabled
+	locations     repository.LoginLocationRepository
+	audit         repository.AuditRepository
+	notifications NotificationService
+	blocked       map[string]bool
+	config        GeoConfig
+	logger        *logrus.Logger
+}
+
+func NewGeoService(resolver GeoResolver, locations repository.LoginLocationRepository, audit repository.AuditRepository, notifications NotificationService, config GeoConfig, logger *logrus.Logger) GeoService {
+	blocked := make(map[string]bool, len(config.BlockedCountries))
+	for _, country := range config.BlockedCountries {
+		blocked[strings.ToUpper(strings.TrimSpace(country))] = true
+	}
+	return &geoService{
+		resolver:      resolver,
+		locations:     locations,
+		audit:         audit,
+		notifications: notifications,
+		blocked:       blocked,
+		config:        config,
+		logger:        logger,
+	}
+}
+
+func (s *geoService) CheckSignIn(user *models.User, client ClientInfo) (*models.LoginLocation, error) {
+	if s.resolver == nil {
+		return nil, nil
+	}
+	resolved, err := s.resolver.Lookup(net.ParseIP(client.IP))
+	if err != nil {
+		// A damaged database should not lock everyone out
+		s.logger.WithError(err).WithField("ip", client.IP).Warn("Failed to resolve sign-in location")
+		return nil, nil
+	}
+	if resolved == nil {
+		return nil, nil
+	}
+
+	now := time.Now()
+	current := &models.LoginLocation{
+		UserID:     user.ID,
+		IPAddress:  client.IP,
+		Country:    resolved.Country,
+		City:       resolved.City,
+		SignedInAt: now,
+	}
+	if resolved.HasCoordinates {
+		current.Latitude, current.Longitude = &resolved.Latitude, &resolved.Longitude
+	}
+
+	previous, err := s.locations.FindByUser(user.ID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("find login location: %w", err)
+	}
+
+	if s.blocked[current.Country] {
+		s.report(user, AuditGeoBlocked, previous, current, client, "A sign-in from a blocked country was refused", nil)
+		s.logger.WithFields(logrus.Fields{
+			"user_id": user.ID,
+			"country": current.Country,
+		}).Warn("Sign-in from blocked country refused")
+		return nil, ErrLoginCountryBlocked
+	}
+
+	if s.config.ImpossibleTravel && previous != nil && previous.IPAddress != client.IP {
+		if speed, distance, ok := s.travelSpeed(previous, current); ok {
+			details := []string{fmt.Sprintf("Distance from the previous sign-in: %.0f km in %s", distance, now.Sub(previous.SignedInAt).Round(time.Minute))}
+			event := "Sign-in from an unusual location"
+			if s.config.DenyImpossibleTravel {
+				event = "A sign-in from an unusual location was refused"
+			}
+			s.report(user, AuditImpossibleTravel, previous, current, client, event, details)
+			s.logger.WithFields(logrus.Fields{
+				"user_id":     user.ID,
+				"from":        locationName(previous),
+				"to":          locationName(current),
+				"distance_km": int(distance),
+				"speed_kmh":   int(speed),
+				"denied":      s.config.DenyImpossibleTravel,
+			}).Warn("Impossible travel between sign-ins")
+			if s.config.DenyImpossibleTravel {
+				return nil, ErrImpossibleTravel
+			}
+		}
+	}
+	return current, nil
+}
+
+// travelSpeed returns the speed needed to get from previous to current, and whether it
+// is impossible
+func (s *geoService) travelSpeed(previous, current *models.LoginLocation) (speed, distance float64, impossible bool) {
+	if previous.Latitude == nil || previous.Longitude == nil || current.Latitude == nil || current.Longitude == nil {
+		return 0, 0, false
+	}
+	distance = geoip.DistanceKm(
+		geoip.Location{Latitude: *previous.Latitude, Longitude: *previous.Longitude},
+		geoip.Location{Latitude: *current.Latitude, Longitude: *current.Longitude},
+	)
+	if distance < s.config.MinDistanceKm {
+		return 0, distance, false
+	}
+	hours := current.SignedInAt.Sub(previous.SignedInAt).Hours()
+	if hours <= 0 {
+		return distance, distance, true
+	}
+	speed = distance / hours
+	return speed, distance, speed > s.config.MaxSpeedKmh
+}
+
+func (s *geoService) RecordSignIn(location *models.LoginLocation) {
+	if location == nil {
+		return
+	}
+	if err := s.locations.Save(location); err != nil {
+		s.logger.WithError(err).WithField("user_id", location.UserID).Error("Failed to record login location")
+	}
+}
+
+// report writes an audit entry for a refused or suspicious sign-in and alerts the user
+func (s *geoService) report(user *models.User, action string, previous, current *models.LoginLocation, client ClientInfo, event string, details []string) {
+	var fromLocation, fromIP interface{}
+	if previous != nil {
+		fromLocation, fromIP = locationName(previous), previous.IPAddress
+	}
+	changes, _ := json.Marshal(map[string]interface{}{
+		"location": map[string]interface{}{"from": fromLocation, "to": locationName(current)},
+		"ip":       map[string]interface{}{"from": fromIP, "to": current.IPAddress},
+	})
+	if err := s.audit.Create(&models.AuditEntry{
+		Entity:   "user",
+		EntityID: user.ID,
+		UserID:   user.ID,
+		Action:   action,
+		Changes:  string(changes),
+	}); err != nil {
+		s.logger.WithError(err).WithField("user_id", user.ID).Error("Failed to write audit entry")
+	}
+
+	lines := []string{
+		"Location: " + locationName(current),
+		"IP address: " + client.IP,
+		"Device: " + client.UserAgent,
+	}
+	if previous != nil {
+		lines = append(lines, fmt.Sprintf("Previous sign-in: %s on %s", locationName(previous), previous.SignedInAt.UTC().Format(time.RFC1123)))
+	}
+	s.notifications.UnusualSignIn(user, event, append(lines, details...))
+}
+
+// locationName names the city and country of a sign-in, e.g. "Berlin, DE"
+func locationName(location *models.LoginLocation) string {
+	return geoip.Location{Country: location.Country, City: location.City}.String()
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrGroupNotFound    = errors.New("group not found")
+	ErrGroupNameTaken   = errors.New("group name is taken")
+	ErrInvalidGroupName = errors.New("invalid group name")
+	ErrNotGroupMember   = errors.New("user is not a member of the group")
+)
+
+// groupNamePattern keeps group names usable as token claims and in code, e.g. RequireGroup("support")
+var groupNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// GroupSummary is a group with its number of members
+type GroupSummary struct {
+	Group   models.Group
+	Members int
+}
+
+// GroupService manages groups of users. Group names are embedded in access tokens, so
+// membership changes reach tokens issued afterwards; removals revoke the user's
+// current access tokens so the group is not kept until they expire.
+type GroupService interface {
+	List() ([]GroupSummary, error)
+	Create(name, description string) (*models.Group, error)
+	// Get returns the group and its members
+	Get(groupID uint) (*models.Group, []models.User, error)
+	Update(groupID uint, name, description string) (*models.Group, error)
+	Delete(groupID uint) error
+	AddMember(groupID, userID uint) error
+	RemoveMember(groupID, userID uint) error
+}
+
+type groupService struct {
+	groups  repository.GroupRepository
+	users   repository.UserRepository
+	revoker TokenRevoker
+	logger  *logrus.Logger
+}
+
+func NewGroupService(groups repository.GroupRepository, users repository.UserRepository, revoker TokenRevoker, logger *logrus.Logger) GroupService {
+	return &groupService{
+		groups:  groups,
+		users:   users,
+		revoker: revoker,
+		logger:  logger,
+	}
+}
+
+func (s *groupService) findGroup(groupID uint) (*models.Group, error) {
+	group, err := s.groups.FindByID(groupID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, fmt.Errorf("find group: %w", err)
+	}
+	return group, nil
+}
+
+func (s *groupService) List() ([]GroupSummary, error) {
+	groups, err := s.groups.List()
+	if err != nil {
+		return nil, fmt.Errorf("list groups: %w", err)
+	}
+	counts, err := s.groups.MemberCounts()
+	if err != nil {
+		return nil, fmt.Errorf("count group members: %w", err)
+	}
+	result := make([]GroupSummary, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, GroupSummary{Group: group, Members: counts[group.ID]})
+	}
+	return result, nil
+}
+
+func (s *groupService) Create(name, description string) (*models.Group, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !groupNamePattern.MatchString(name) {
+		return nil, ErrInvalidGroupName
+	}
+	group := &models.Group{Name: name, Description: strings.TrimSpace(description)}
+	if err := s.groups.Create(group); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return nil, ErrGroupNameTaken
+		}
+		return nil, fmt.Errorf("create group: %w", err)
+	}
+	s.logger.WithField("group", group.Name).Info("Group created")
+	return group, nil
+}
+
+func (s *groupService) Get(groupID uint) (*models.Group, []models.User, error) {
+	group, err := s.findGroup(groupID)
+	if err != nil {
+		return nil, nil, err
+	}
+	members, err := s.groups.ListMembers(groupID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list group members: %w", err)
+	}
+	return group, members, nil
+}
+
+func (s *groupService) Update(groupID uint, name, description string) (*models.Group, error) {
+	group, err := s.findGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !groupNamePattern.MatchString(name) {
+		return nil, ErrInvalidGroupName
+	}
+	renamed := name != group.Name
+	group.Name = name
+	group.Description = strings.TrimSpace(description)
+	if err := s.groups.Save(group); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return nil, ErrGroupNameTaken
+		}
+		return nil, fmt.Errorf("update group: %w", err)
+	}
+	// Tokens carry the old name, which another group may take
+	if renamed {
+		members, err := s.groups.ListMembers(groupID)
+		if err != nil {
+			return nil, fmt.Errorf("list group members: %w", err)
+		}
+		if err := s.revokeUsers(members); err != nil {
+			return nil, err
+		}
+	}
+	return group, nil
+}
+
+func (s *groupService) Delete(groupID uint) error {
+	group, err := s.findGroup(groupID)
+	if err != nil {
+		return err
+	}
+	members, err := s.groups.ListMembers(groupID)
+	if err != nil {
+		return fmt.Errorf("list group members: %w", err)
+	}
+	if err := s.groups.Delete(group); err != nil {
+		return fmt.Errorf("delete group: %w", err)
+	}
+	if err := s.revokeUsers(members); err != nil {
+		return err
+	}
+	s.logger.WithField("group", group.Name).Info("Group deleted")
+	return nil
+}
+
+func (s *groupService) AddMember(groupID, userID uint) error {
+	if _, err := s.findGroup(groupID); err != nil {
+		return err
+	}
+	if _, err := s.users.FindByID(userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("find user: %w", err)
+	}
+	if _, err := s.groups.AddMember(groupID, userID); err != nil {
+		return fmt.Errorf("add group member: %w", err)
+	}
+	return nil
+}
+
+func (s *groupService) RemoveMember(groupID, userID uint) error {
+	if _, err := s.findGroup(groupID); err != nil {
+		return err
+	}
+	removed, err := s.groups.RemoveMember(groupID, userID)
+	if err != nil {
+		return fmt.Errorf("remove group member: %w", err)
+	}
+	if !removed {
+		return ErrNotGroupMember
+	}
+	if err := s.revoker.RevokeUser(userID); err != nil {
+		return fmt.Errorf("revoke access tokens: %w", err)
+	}
+	return nil
+}
+
+// revokeUsers revokes the access tokens of users who left or lost a group
+func (s *groupService) revokeUsers(users []models.User) error {
+	for _, user := range users {
+		if err := s.revoker.RevokeUser(user.ID); err != nil {
+			return fmt.Errorf("revoke access tokens: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrImpersonationNotAllowed = errors.New("user cannot be impersonated")
+	// ErrImpersonationSessionRequired is returned when the admin is not signed in with
+	// a session (API keys), so there is nothing to return to afterwards
+	ErrImpersonationSessionRequired = errors.New("impersonation requires a signed-in session")
+	ErrNotImpersonating             = errors.New("not impersonating")
+	// ErrAdminSessionEnded is returned when leaving an impersonation whose admin was
+	// signed out, or is no longer an active admin, in the meantime
+	ErrAdminSessionEnded = errors.New("admin session ended")
+)
+
+// ImpersonationToken is an access token without a refresh token, for User
+type ImpersonationToken struct {
+	User        *models.User
+	AccessToken string
+	ExpiresAt   time.Time
+}
+
+// ImpersonationService lets support staff act as a user for a short while. Starting,
+// leaving and every request in between are written to the audit trail with both
+// identities.
+type ImpersonationService interface {
+	// Start issues an access token for userID carrying the admin as impersonator. Admins
+	// cannot be impersonated, nor can blocked accounts.
+	Start(adminID uint, adminSessionID string, userID uint, client ClientInfo) (*ImpersonationToken, error)
+	// Exit revokes the impersonation token access and issues a new access token for the
+	// admin's session, which must still be signed in
+	Exit(access AccessToken, impersonatorID uint, adminSessionID string, client ClientInfo) (*ImpersonationToken, error)
+	RecordRequest(userID, impersonatorID uint, method, route string, status int, ip string)
+	// SetExpiry changes the lifetimes, in minutes, of impersonation tokens and of the
+	// admin access tokens issued on exit
+	SetExpiry(impersonationMinutes, accessMinutes int)
+}
+
+type impersonationService struct {
+	users   repository.UserRepository
+	tokens  repository.TokenRepository
+	groups  repository.GroupRepository
+	revoker TokenRevoker
+	audit   repository.AuditRepository
+	logger  *logrus.Logger
+
+	mu     sync.RWMutex
+	config TokenConfig
+	expiry int // minutes
+}
+
+func NewImpersonationService(users repository.UserRepository, tokens repository.TokenRepository, groups repository.GroupRepository, revoker TokenRevoker, audit repository.AuditRepository, config TokenConfig, expiryMinutes int, logger *logrus.Logger) ImpersonationService {
+	return &impersonationService{
+		users:   users,
+		tokens:  tokens,
+		groups:  groups,
+		revoker: revoker,
+		audit:   audit,
+		config:  config,
+		expiry:  expiryMinutes,
+		logger:  logger,
+	}
+}
+
+func (s *impersonationService) SetExpiry(impersonationMinutes, accessMinutes int) {
+	s.mu.Lock()
+	s.expiry = impersonationMinutes
+	s.config.AccessExpiry = accessMinutes
+	s.mu.Unlock()
+}
+
+func (s *impersonationService) Start(adminID uint, adminSessionID string, userID uint, client ClientInfo) (*ImpersonationToken, error) {
+	if adminSessionID == "" {
+		return nil, ErrImpersonationSessionRequired
+	}
+	if adminID == userID {
+		return nil, fmt.Errorf("%w: that is your own account", ErrImpersonationNotAllowed)
+	}
+	if err := s.checkAdminSession(adminID, adminSessionID); err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	if user.Role == "admin" {
+		return nil, fmt.Errorf("%w: admins cannot be impersonated", ErrImpersonationNotAllowed)
+	}
+	if accountBlocked(user) != nil {
+		return nil, fmt.Errorf("%w: the account is not active", ErrImpersonationNotAllowed)
+	}
+	groups, err := s.groups.NamesForUser(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list groups: %w", err)
+	}
+
+	s.mu.RLock()
+	expiry := s.expiry
+	s.mu.RUnlock()
+	token, expiresAt, err := s.issue(auth.Subject{
+		UserID:       user.ID,
+		Role:         user.Role,
+		Groups:       groups,
+		Impersonator: &auth.Impersonator{UserID: adminID, SessionID: adminSessionID},
+	}, expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(user.ID, adminID, "impersonation_start", map[string]interface{}{
+		"ip":        client.IP,
+		"userAgent": client.UserAgent,
+		"expiresAt": expiresAt.UTC().Format(time.RFC3339),
+	})
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  user.ID,
+		"admin_id": adminID,
+	}).Warn("Admin started impersonating user")
+	return &ImpersonationToken{User: user, AccessToken: token, ExpiresAt: expiresAt}, nil
+}
+
+func (s *impersonationService) Exit(access AccessToken, impersonatorID uint, adminSessionID string, client ClientInfo) (*ImpersonationToken, error) {
+	if impersonatorID == 0 {
+		return nil, ErrNotImpersonating
+	}
+	// The impersonation ends whether or not the admin can be signed back in
+	if err := s.revoker.Revoke(access.ID, access.UserID, access.ExpiresAt); err != nil {
+		return nil, fmt.Errorf("revoke impersonation token: %w", err)
+	}
+	s.record(access.UserID, impersonatorID, "impersonation_end", map[string]interface{}{
+		"ip":        client.IP,
+		"userAgent": client.UserAgent,
+	})
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  access.UserID,
+		"admin_id": impersonatorID,
+	}).Info("Admin stopped impersonating user")
+
+	if err := s.checkAdminSession(impersonatorID, adminSessionID); err != nil {
+		return nil, err
+	}
+	admin, err := s.users.FindByID(impersonatorID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrAdminSessionEnded
+		}
+		return nil, fmt.Errorf("find admin: %w", err)
+	}
+	if admin.Role != "admin" || accountBlocked(admin) != nil {
+		return nil, ErrAdminSessionEnded
+	}
+	groups, err := s.groups.NamesForUser(admin.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list groups: %w", err)
+	}
+
+	s.mu.RLock()
+	expiry := s.config.AccessExpiry
+	s.mu.RUnlock()
+	token, expiresAt, err := s.issue(auth.Subject{
+		UserID:    admin.ID,
+		Role:      admin.Role,
+		SessionID: adminSessionID,
+		Groups:    groups,
+	}, expiry)
+	if err != nil {
+		return nil, err
+	}
+	return &ImpersonationToken{User: admin, AccessToken: token, ExpiresAt: expiresAt}, nil
+}
+
+// checkAdminSession reports ErrAdminSessionEnded unless the admin's session still has
+// a live refresh token
+func (s *impersonationService) checkAdminSession(adminID uint, sessionID string) error {
+	sessions, err := s.tokens.ListActive(adminID)
+	if err != nil {
+		return fmt.Errorf("list sessions: %w", err)
+	}
+	for _, session := range sessions {
+		if session.FamilyID == sessionID {
+			return nil
+		}
+	}
+	return ErrAdminSessionEnded
+}
+
+func (s *impersonationService) issue(subject auth.Subject, expiryMinutes int) (string, time.Time, error) {
+	s.mu.RLock()
+	config := s.config
+	s.mu.RUnlock()
+
+	token, expiresAt, err := config.generator().GenerateAccessToken(subject, auth.TokenSettings{
+		AccessKeys:   config.AccessKeys,
+		Issuer:       config.Issuer,
+		Audience:     config.Audience,
+		AccessExpiry: expiryMinutes,
+		Claims:       config.Claims,
+		Clock:        config.Clock,
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("generate token: %w", err)
+	}
+	return token, expiresAt, nil
+}
+
+func (s *impersonationService) RecordRequest(userID, impersonatorID uint, method, route string, status int, ip string) {
+	s.record(userID, impersonatorID, "impersonated_request", map[string]interface{}{
+		"method": method,
+		"route":  route,
+		"status": status,
+		"ip":     ip,
+	})
+}
+
+// record writes an audit entry about userID with the impersonating admin as actor
+func (s *impersonationService) record(userID, adminID uint, action string, details map[string]interface{}) {
+	changes, err := json.Marshal(details)
+	if err == nil {
+		err = s.audit.Create(&models.AuditEntry{
+			Entity:   "user",
+			EntityID: userID,
+			UserID:   userID,
+			ActorID:  &adminID,
+			Action:   action,
+			Changes:  string(changes),
+		})
+	}
+	if err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"user_id":  userID,
+			"admin_id": adminID,
+			"action":   action,
+		}).Error("Failed to write audit entry")
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"api/internal/ipfilter"
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrIPRuleNotFound = errors.New("IP rule not found")
+	// ErrIPRuleLockout is returned for changes that would block the admin making them
+	ErrIPRuleLockout = errors.New("change would block the caller's address")
+)
+
+// IPRuleService manages the IP filter rules stored in the database. Changes apply to
+// this instance right away and to the others at their next Reload.
+type IPRuleService interface {
+	List() ([]models.IPRule, error)
+	// Configured returns the rules from the configuration file
+	Configured() []ipfilter.Rule
+	// Create validates and stores a rule. route is the route template of the request
+	// making the change; a rule that would block the caller there is refused.
+	Create(rule *models.IPRule, client ClientInfo, route string) error
+	Delete(id, adminID uint, client ClientInfo, route string) error
+	// Reload applies the stored rules to the filter
+	Reload() error
+}
+
+type ipRuleService struct {
+	rules  repository.IPRuleRepository
+	filter *ipfilter.Filter
+	logger *logrus.Logger
+}
+
+func NewIPRuleService(rules repository.IPRuleRepository, filter *ipfilter.Filter, logger *logrus.Logger) IPRuleService {
+	return &ipRuleService{
+		rules:  rules,
+		filter: filter,
+		logger: logger,
+	}
+}
+
+func (s *ipRuleService) List() ([]models.IPRule, error) {
+	rules, err := s.rules.List()
+	if err != nil {
+		return nil, fmt.Errorf("list IP rules: %w", err)
+	}
+	return rules, nil
+}
+
+func (s *ipRuleService) Configured() []ipfilter.Rule {
+	return s.filter.Static()
+}
+
+func (s *ipRuleService) Create(rule *models.IPRule, client ClientInfo, route string) error {
+	parsed, err := ipfilter.ParseRule(rule.Path, rule.Action, rule.CIDR)
+	if err != nil {
+		return err
+	}
+	rule.CIDR = parsed.Network.String()
+
+	stored, err := s.rules.List()
+	if err != nil {
+		return fmt.Errorf("list IP rules: %w", err)
+	}
+	if !s.allows(append(s.parse(stored), parsed), client, route) {
+		return ErrIPRuleLockout
+	}
+
+	if err := s.rules.Create(rule); err != nil {
+		return fmt.Errorf("create IP rule: %w", err)
+	}
+	s.logger.WithFields(logrus.Fields{
+		"rule_id":  rule.ID,
+		"path":     rule.Path,
+		"action":   rule.Action,
+		"cidr":     rule.CIDR,
+		"admin_id": rule.CreatedByID,
+	}).Warn("IP rule created")
+	s.reloadAfterChange()
+	return nil
+}
+
+func (s *ipRuleService) Delete(id, adminID uint, client ClientInfo, route string) error {
+	rule, err := s.rules.FindByID(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrIPRuleNotFound
+		}
+		return fmt.Errorf("find IP rule: %w", err)
+	}
+
+	// Removing an allow rule can leave the caller outside the remaining allowed ranges
+	stored, err := s.rules.List()
+	if err != nil {
+		return fmt.Errorf("list IP rules: %w", err)
+	}
+	remaining := make([]models.IPRule, 0, len(stored))
+	for _, other := range stored {
+		if other.ID != rule.ID {
+			remaining = append(remaining, other)
+		}
+	}
+	if !s.allows(s.parse(remaining), client, route) {
+		return ErrIPRuleLockout
+	}
+
+	deleted, err := s.rules.Delete(id)
+	if err != nil {
+		return fmt.Errorf("delete IP rule: %w", err)
+	}
+	if !deleted {
+		return ErrIPRuleNotFound
+	}
+	s.logger.WithFields(logrus.Fields{
+		"rule_id":  id,
+		"path":     rule.Path,
+		"action":   rule.Action,
+		"cidr":     rule.CIDR,
+		"admin_id": adminID,
+	}).Warn("IP rule deleted")
+	s.reloadAfterChange()
+	return nil
+}
+
+func (s *ipRuleService) Reload() error {
+	rules, err := s.rules.List()
+	if err != nil {
+		return fmt.Errorf("list IP rules: %w", err)
+	}
+	s.filter.SetDynamic(s.parse(rules))
+	return nil
+}
+
+func (s *ipRuleService) reloadAfterChange() {
+	if err := s.Reload(); err != nil {
+		s.logger.WithError(err).Error("Failed to apply IP rules")
+	}
+}
+
+// allows reports whether the configured rules together with dynamic let the client reach route
+func (s *ipRuleService) allows(dynamic []ipfilter.Rule, client ClientInfo, route string) bool {
+	rules := append(append([]ipfilter.Rule{}, s.filter.Static()...), dynamic...)
+	return ipfilter.Allows(rules, net.ParseIP(client.IP), route)
+}
+
+// parse converts stored rules, skipping any that no longer validate
+func (s *ipRuleService) parse(stored []models.IPRule) []ipfilter.Rule {
+	rules := make([]ipfilter.Rule, 0, len(stored))
+	for _, rule := range stored {
+		parsed, err := ipfilter.ParseRule(rule.Path, rule.Action, rule.CIDR)
+		if err != nil {
+			s.logger.WithError(err).WithField("rule_id", rule.ID).Warn("Ignoring invalid IP rule")
+			continue
+		}
+		rules = append(rules, parsed)
+	}
+	return rules
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"api/internal/i18n"
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// NotificationSettings toggles the individual notification emails
+type NotificationSettings struct {
+	Welcome         bool
+	PasswordChanged bool
+	NewLogin        bool
+	RoleChanged     bool
+}
+
+// NotificationService sends account notification emails the user has not opted out of,
+// in the locale and timezone of their profile. Delivery problems are logged; they never
+// fail the operation that triggered them.
+type NotificationService interface {
+	Preferences(userID uint) (*models.NotificationPreferences, error)
+	UpdatePreferences(userID uint, settings NotificationSettings) (*models.NotificationPreferences, error)
+	// Welcome greets a user whose email address was just verified
+	Welcome(user *models.User)
+	// PasswordChanged alerts the user, listing the other devices that were signed in
+	PasswordChanged(user *models.User, otherDevices []string)
+	// LoginSucceeded records the login's device and alerts the user when it is a new one
+	LoginSucceeded(user *models.User, client ClientInfo)
+	RoleChanged(user *models.User, previousRole string)
+	// SessionsRevoked tells the user an admin signed them out everywhere. It is sent
+	// regardless of preferences, as the admin asked for it.
+	SessionsRevoked(user *models.User)
+	// EmailChangeRequested warns the current address that a switch to newEmail awaits
+	// confirmation. It is sent regardless of preferences.
+	EmailChangeRequested(user *models.User, newEmail string)
+	// UnusualSignIn warns about a sign-in that was refused or looks suspicious because of
+	// where it came from. It is sent regardless of preferences; event and details are
+	// used as given, untranslated.
+	UnusualSignIn(user *models.User, event string, details []string)
+}
+
+type notificationService struct {
+	prefs  repository.NotificationRepository
+	users  repository.UserRepository
+	emails EmailService
+	logger *logrus.Logger
+}
+
+func NewNotificationService(prefs repository.NotificationRepository, users repository.UserRepository, emails EmailService, logger *logrus.Logger) NotificationService {
+	return &notificationService{prefs: prefs, users: users, emails: emails, logger: logger}
+}
+
+func (s *notificationService) Preferences(userID uint) (*models.NotificationPreferences, error) {
+	prefs, err := s.prefs.FindPreferences(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return &models.NotificationPreferences{
+				UserID:          userID,
+				Welcome:         true,
+				PasswordChanged: true,
+				NewLogin:        true,
+				RoleChanged:     true,
+			}, nil
+		}
+		return nil, fmt.Errorf("find notification preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+func (s *notificationService) UpdatePreferences(userID uint, settings NotificationSettings) (*models.NotificationPreferences, error) {
+	prefs, err := s.Preferences(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefs.Welcome = settings.Welcome
+	prefs.PasswordChanged = settings.PasswordChanged
+	prefs.NewLogin = settings.NewLogin
+	prefs.RoleChanged = settings.RoleChanged
+	if err := s.prefs.SavePreferences(prefs); err != nil {
+		return nil, fmt.Errorf("save notification preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+func (s *notificationService) Welcome(user *models.User) {
+	s.notify(user, "welcome", func(p *models.NotificationPreferences) bool { return p.Welcome }, func(string) map[string]interface{} {
+		return map[string]interface{}{"Username": user.Username}
+	})
+}
+
+func (s *notificationService) PasswordChanged(user *models.User, otherDevices []string) {
+	now := time.Now()
+	s.notify(user, "security_alert", func(p *models.NotificationPreferences) bool { return p.PasswordChanged }, func(locale string) map[string]interface{} {
+		return map[string]interface{}{
+			"Username": user.Username,
+			"Event":    i18n.Message(locale, "notify_password_changed"),
+			"Time":     now,
+			"Details":  otherDevices,
+		}
+	})
+}
+
+func (s *notificationService) LoginSucceeded(user *models.User, client ClientInfo) {
+	now := time.Now()
+	known, firstLogin, err := s.prefs.RecordLogin(user.ID, client.IP, client.UserAgent, now)
+	if err != nil {
+		s.logger.WithError(err).WithField("user_id", user.ID).Error("Failed to record login device")
+		return
+	}
+	// The very first login has nothing to compare against
+	if known || firstLogin {
+		return
+	}
+
+	s.notify(user, "security_alert", func(p *models.NotificationPreferences) bool { return p.NewLogin }, func(locale string) map[string]interface{} {
+		return map[string]interface{}{
+			"Username": user.Username,
+			"Event":    i18n.Message(locale, "notify_new_login"),
+			"Time":     now,
+			"Details": []string{
+				i18n.Message(locale, "notify_ip_address", client.IP),
+				i18n.Message(locale, "notify_device", client.UserAgent),
+			},
+		}
+	})
+}
+
+func (s *notificationService) RoleChanged(user *models.User, previousRole string) {
+	now := time.Now()
+	s.notify(user, "security_alert", func(p *models.NotificationPreferences) bool { return p.RoleChanged }, func(locale string) map[string]interface{} {
+		return map[string]interface{}{
+			"Username": user.Username,
+			"Event":    i18n.Message(locale, "notify_role_changed", previousRole, user.Role),
+			"Time":     now,
+		}
+	})
+}
+
+func (s *notificationService) SessionsRevoked(user *models.User) {
+	now := time.Now()
+	s.notify(user, "security_alert", func(*models.NotificationPreferences) bool { return true }, func(locale string) map[string]interface{} {
+		return map[string]interface{}{
+			"Username": user.Username,
+			"Event":    i18n.Message(locale, "notify_sessions_revoked"),
+			"Time":     now,
+			"Details":  []string{i18n.Message(locale, "notify_sign_in_again")},
+		}
+	})
+}
+
+func (s *notificationService) EmailChangeRequested(user *models.User, newEmail string) {
+	now := time.Now()
+	s.notify(user, "security_alert", func(*models.NotificationPreferences) bool { return true }, func(locale string) map[string]interface{} {
+		return map[string]interface{}{
+			"Username": user.Username,
+			"Event":    i18n.Message(locale, "notify_email_change"),
+			"Time":     now,
+			"Details":  []string{i18n.Message(locale, "notify_new_address", newEmail), i18n.Message(locale, "notify_email_change_pending")},
+		}
+	})
+}
+
+func (s *notificationService) UnusualSignIn(user *models.User, event string, details []string) {
+	now := time.Now()
+	s.notify(user, "security_alert", func(*models.NotificationPreferences) bool { return true }, func(string) map[string]interface{} {
+		return map[string]interface{}{
+			"Username": user.Username,
+			"Event":    event,
+			"Time":     now,
+			"Details":  details,
+		}
+	})
+}
+
+// notify sends template to the user unless enabled reports the notification as turned off.
+// data builds the template data for the user's locale; a time.Time "Time" is formatted
+// in their timezone, UTC when they chose none.
+func (s *notificationService) notify(user *models.User, template string, enabled func(*models.NotificationPreferences) bool, data func(locale string) map[string]interface{}) {
+	logger := s.logger.WithFields(logrus.Fields{
+		"user_id":  user.ID,
+		"template": template,
+	})
+
+	prefs, err := s.Preferences(user.ID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to load notification preferences")
+		return
+	}
+	if !enabled(prefs) {
+		logger.Debug("Notification disabled by user preference")
+		return
+	}
+
+	locale, location := i18n.Default, time.UTC
+	profile, err := s.users.FindProfile(user.ID)
+	switch {
+	case err == nil:
+		if l := i18n.Normalize(profile.Locale); l != "" {
+			locale = l
+		}
+		if profile.Timezone != "" {
+			if loc, err := time.LoadLocation(profile.Timezone); err == nil {
+				location = loc
+			}
+		}
+	case !errors.Is(err, repository.ErrNotFound):
+		logger.WithError(err).Warn("Failed to load profile, sending notification in the default locale")
+	}
+	values := data(locale)
+	if at, ok := values["Time"].(time.Time); ok {
+		values["Time"] = at.In(location).Format(time.RFC1123)
+	}
+
+	messageID, err := s.emails.SendLocalized(template, locale, user.Email, values)
+	if err != nil {
+		logger.WithError(err).Error("Failed to send notification email")
+		return
+	}
+	logger.WithField("message_id", messageID).Info("Notification email queued")
+}
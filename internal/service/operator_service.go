@@ -0,0 +1,219 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidRole is returned for roles other than user and admin
+var ErrInvalidRole = errors.New("role must be user or admin")
+
+// OperatorAccount describes an account an operator creates
+type OperatorAccount struct {
+	Email         string
+	Username      string
+	Role          string // user when empty
+	Password      string // generated when empty
+	EmailVerified bool
+}
+
+// OperatorService changes accounts for operators working on the database directly,
+// as umactl does without an API token. No email is sent, as no mail queue runs, and
+// the audit trail records the changes without an actor.
+type OperatorService interface {
+	// CreateUser creates a local account and returns the password when it was generated
+	CreateUser(account OperatorAccount) (*models.User, string, error)
+	SetRole(userID uint, role string) (*models.User, error)
+	// ResetPassword sets a new password, generated and returned when password is empty,
+	// and ends the user's sessions
+	ResetPassword(userID uint, password string) (string, error)
+	// RevokeSessions ends every session of the user and returns how many there were
+	RevokeSessions(userID uint) (int, error)
+	ListUsers() ([]models.User, error)
+	VerifyEmail(userID uint) (*models.User, error)
+}
+
+type operatorService struct {
+	users     repository.UserRepository
+	tokens    repository.TokenRepository
+	revoker   TokenRevoker
+	passwords PasswordValidator
+	logger    *logrus.Logger
+}
+
+func NewOperatorService(users repository.UserRepository, tokens repository.TokenRepository, revoker TokenRevoker, passwords PasswordValidator, logger *logrus.Logger) OperatorService {
+	return &operatorService{users: users, tokens: tokens, revoker: revoker, passwords: passwords, logger: logger}
+}
+
+func validRole(role string) bool {
+	return role == "user" || role == "admin"
+}
+
+func (s *operatorService) findUser(userID uint) (*models.User, error) {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	return user, nil
+}
+
+func (s *operatorService) CreateUser(account OperatorAccount) (*models.User, string, error) {
+	user := &models.User{
+		Email:         strings.TrimSpace(account.Email),
+		Username:      strings.TrimSpace(account.Username),
+		Role:          account.Role,
+		EmailVerified: account.EmailVerified,
+		Status:        models.UserStatusActive,
+		AuthSource:    models.AuthSourceLocal,
+	}
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	if !validRole(user.Role) {
+		return nil, "", ErrInvalidRole
+	}
+	if user.Email == "" || user.Username == "" {
+		return nil, "", errors.New("email and username are required")
+	}
+	password, generated := account.Password, ""
+	if password == "" {
+		var err error
+		if password, err = auth.GenerateTemporaryPassword(temporaryPasswordLength); err != nil {
+			return nil, "", fmt.Errorf("generate password: %w", err)
+		}
+		generated = password
+	}
+	if err := createAccount(s.users, s.passwords, user, password); err != nil {
+		return nil, "", err
+	}
+	s.logger.WithFields(logrus.Fields{
+		"user_id": user.ID,
+		"role":    user.Role,
+	}).Info("User created by operator")
+	return user, generated, nil
+}
+
+func (s *operatorService) SetRole(userID uint, role string) (*models.User, error) {
+	if !validRole(role) {
+		return nil, ErrInvalidRole
+	}
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == role {
+		return user, nil
+	}
+	user.Role = role
+	if err := s.users.Save(user); err != nil {
+		return nil, fmt.Errorf("save user: %w", err)
+	}
+	// Access tokens carry the role; sessions get tokens with the new one on refresh
+	if err := s.revoker.RevokeUser(userID); err != nil {
+		return nil, fmt.Errorf("revoke access tokens: %w", err)
+	}
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"new_role": role,
+	}).Info("User role updated by operator")
+	return user, nil
+}
+
+func (s *operatorService) ResetPassword(userID uint, password string) (string, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return "", err
+	}
+	if user.AuthSource != models.AuthSourceLocal {
+		return "", fmt.Errorf("the password of %s accounts is managed by the %s directory", user.AuthSource, user.AuthSource)
+	}
+	generated := ""
+	if password == "" {
+		if password, err = auth.GenerateTemporaryPassword(temporaryPasswordLength); err != nil {
+			return "", fmt.Errorf("generate password: %w", err)
+		}
+		generated = password
+	}
+	if err := s.passwords.Validate(password, user); err != nil {
+		return "", err
+	}
+	if user.PasswordHash, err = auth.HashPassword(password); err != nil {
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	now := time.Now()
+	user.PasswordChangedAt = &now
+	user.PasswordChangeRequired = false
+	if err := s.users.Save(user); err != nil {
+		return "", fmt.Errorf("save user: %w", err)
+	}
+	s.passwords.Remember(user)
+	// Whoever knew the old password is signed out
+	if _, err := s.revokeSessions(userID); err != nil {
+		return "", err
+	}
+	s.logger.WithField("user_id", userID).Info("Password reset by operator")
+	return generated, nil
+}
+
+func (s *operatorService) RevokeSessions(userID uint) (int, error) {
+	if _, err := s.findUser(userID); err != nil {
+		return 0, err
+	}
+	count, err := s.revokeSessions(userID)
+	if err != nil {
+		return 0, err
+	}
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"sessions": count,
+	}).Info("Sessions revoked by operator")
+	return count, nil
+}
+
+func (s *operatorService) revokeSessions(userID uint) (int, error) {
+	sessions, err := s.tokens.ListActive(userID)
+	if err != nil {
+		return 0, fmt.Errorf("list sessions: %w", err)
+	}
+	if err := s.tokens.DeleteByUser(userID); err != nil {
+		return 0, fmt.Errorf("delete refresh tokens: %w", err)
+	}
+	if err := s.revoker.RevokeUser(userID); err != nil {
+		return 0, fmt.Errorf("revoke access tokens: %w", err)
+	}
+	return len(sessions), nil
+}
+
+func (s *operatorService) ListUsers() ([]models.User, error) {
+	users, err := s.users.List()
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	return users, nil
+}
+
+func (s *operatorService) VerifyEmail(userID uint) (*models.User, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.EmailVerified {
+		return user, nil
+	}
+	user.EmailVerified = true
+	if err := s.users.Save(user); err != nil {
+		return nil, fmt.Errorf("save user: %w", err)
+	}
+	s.logger.WithField("user_id", userID).Info("Email address verified by operator")
+	return user, nil
+}
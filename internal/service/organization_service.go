@@ -0,0 +1,398 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrOrganizationNotFound  = errors.New("organization not found")
+	ErrSlugTaken             = errors.New("organization slug is taken")
+	ErrInvalidSlug           = errors.New("invalid organization slug")
+	ErrNotOrganizationMember = errors.New("not a member of the organization")
+	ErrAlreadyMember         = errors.New("already a member of the organization")
+	ErrInvalidInvitation     = errors.New("invalid or expired invitation")
+	// ErrInvitationRole is returned when the inviter may not grant the requested role
+	ErrInvitationRole = errors.New("role cannot be granted by the inviter")
+	// ErrTransferRecipient is returned when ownership is offered to someone other than
+	// another member of the organization
+	ErrTransferRecipient = errors.New("ownership can only be transferred to another member")
+	ErrInvalidTransfer   = errors.New("invalid or expired ownership transfer")
+)
+
+// slugPattern allows lowercase letters, digits and inner hyphens
+var slugPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{1,48}[a-z0-9])$`)
+
+// OrganizationConfig holds the settings for organization invitations and ownership
+// transfers
+type OrganizationConfig struct {
+	InvitationURL string        // the token is appended to this link
+	InvitationTTL time.Duration // how long an invitation link stays valid
+	TransferURL   string        // the token is appended to this link
+	TransferTTL   time.Duration // how long the new owner has to accept a transfer
+}
+
+// OrganizationMembership is an organization a user belongs to and their role in it
+type OrganizationMembership struct {
+	Organization models.Organization
+	Role         string
+	JoinedAt     time.Time
+}
+
+// OrganizationMember is a user belonging to an organization
+type OrganizationMember struct {
+	User     models.User
+	Role     string
+	JoinedAt time.Time
+}
+
+// OrganizationService manages organizations, the tenants users belong to
+type OrganizationService interface {
+	// Create makes a new organization owned by userID
+	Create(userID uint, name, slug string) (*models.Organization, error)
+	// Memberships lists the organizations the user belongs to, oldest membership first
+	Memberships(userID uint) ([]OrganizationMembership, error)
+	Members(orgID uint) ([]OrganizationMember, error)
+	// Invite mails an invitation link for role to email. Owners invite admins and
+	// members, admins only members.
+	Invite(orgID, inviterID uint, inviterRole, email, role string) (*models.OrganizationInvitation, error)
+	// AcceptInvitation makes the user a member; the invitation must have been sent to
+	// the user's email address
+	AcceptInvitation(userID uint, token string) (*models.Membership, error)
+	// TransferOwnership offers the organization to another member, mailing them a link
+	// to accept it. A new offer replaces a pending one.
+	TransferOwnership(orgID, ownerID, recipientID uint) (*models.OwnershipTransfer, error)
+	// AcceptOwnership makes the user the owner of the organization a transfer offered
+	// them, and its previous owner an admin
+	AcceptOwnership(userID uint, token string) (*models.OwnershipTransfer, error)
+}
+
+type organizationService struct {
+	organizations repository.OrganizationRepository
+	users         repository.UserRepository
+	emails        EmailService
+	revoker       TokenRevoker
+	config        OrganizationConfig
+	logger        *logrus.Logger
+}
+
+func NewOrganizationService(organizations repository.OrganizationRepository, users repository.UserRepository, emails EmailService, revoker TokenRevoker, config OrganizationConfig, logger *logrus.Logger) OrganizationService {
+	return &organizationService{
+		organizations: organizations,
+		users:         users,
+		emails:        emails,
+		revoker:       revoker,
+		config:        config,
+		logger:        logger,
+	}
+}
+
+func (s *organizationService) Create(userID uint, name, slug string) (*models.Organization, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if !slugPattern.MatchString(slug) {
+		return nil, ErrInvalidSlug
+	}
+	org := &models.Organization{
+		Name:        strings.TrimSpace(name),
+		Slug:        slug,
+		CreatedByID: userID,
+	}
+	owner := &models.Membership{UserID: userID, Role: models.OrgRoleOwner}
+	if err := s.organizations.Create(org, owner); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return nil, ErrSlugTaken
+		}
+		return nil, fmt.Errorf("create organization: %w", err)
+	}
+	s.logger.WithFields(logrus.Fields{
+		"organization_id": org.ID,
+		"user_id":         userID,
+	}).Info("Organization created")
+	return org, nil
+}
+
+func (s *organizationService) Memberships(userID uint) ([]OrganizationMembership, error) {
+	memberships, err := s.organizations.ListMemberships(userID)
+	if err != nil {
+		return nil, fmt.Errorf("list memberships: %w", err)
+	}
+	result := make([]OrganizationMembership, 0, len(memberships))
+	for _, membership := range memberships {
+		org, err := s.organizations.FindByID(membership.OrganizationID)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("find organization: %w", err)
+		}
+		result = append(result, OrganizationMembership{Organization: *org, Role: membership.Role, JoinedAt: membership.CreatedAt})
+	}
+	return result, nil
+}
+
+func (s *organizationService) Members(orgID uint) ([]OrganizationMember, error) {
+	memberships, err := s.organizations.ListMembers(orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list members: %w", err)
+	}
+	users, err := s.users.ListByOrganization(orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	byID := make(map[uint]models.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+
+	// Deleted accounts keep their membership until they are erased, but are not listed
+	result := make([]OrganizationMember, 0, len(memberships))
+	for _, membership := range memberships {
+		user, ok := byID[membership.UserID]
+		if !ok {
+			continue
+		}
+		result = append(result, OrganizationMember{User: user, Role: membership.Role, JoinedAt: membership.CreatedAt})
+	}
+	return result, nil
+}
+
+func (s *organizationService) Invite(orgID, inviterID uint, inviterRole, email, role string) (*models.OrganizationInvitation, error) {
+	switch {
+	case role == models.OrgRoleMember:
+	case role == models.OrgRoleAdmin && inviterRole == models.OrgRoleOwner:
+	default:
+		return nil, ErrInvitationRole
+	}
+	org, err := s.organizations.FindByID(orgID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, fmt.Errorf("find organization: %w", err)
+	}
+	inviter, err := s.users.FindByID(inviterID)
+	if err != nil {
+		return nil, fmt.Errorf("find inviter: %w", err)
+	}
+	if invitee, err := s.users.FindByEmail(email); err == nil {
+		if _, err := s.organizations.FindMembership(orgID, invitee.ID); err == nil {
+			return nil, ErrAlreadyMember
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("find membership: %w", err)
+		}
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+
+	token, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	invitation := &models.OrganizationInvitation{
+		OrganizationID: orgID,
+		Email:          email,
+		Role:           role,
+		TokenDigest:    auth.HashToken(token),
+		InvitedByID:    inviterID,
+		ExpiresAt:      time.Now().Add(s.config.InvitationTTL),
+	}
+	if err := s.organizations.CreateInvitation(invitation); err != nil {
+		return nil, fmt.Errorf("create invitation: %w", err)
+	}
+
+	messageID, err := s.emails.Send("organization_invitation", email, map[string]interface{}{
+		"Organization": org.Name,
+		"Inviter":      inviter.Username,
+		"Role":         role,
+		"AcceptURL":    s.config.InvitationURL + token,
+		"ExpiresIn":    s.config.InvitationTTL.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send invitation: %w", err)
+	}
+	s.logger.WithFields(logrus.Fields{
+		"organization_id": orgID,
+		"invitation_id":   invitation.ID,
+		"invited_by":      inviterID,
+		"message_id":      messageID,
+	}).Info("Organization invitation queued")
+	return invitation, nil
+}
+
+func (s *organizationService) AcceptInvitation(userID uint, token string) (*models.Membership, error) {
+	invitation, err := s.organizations.FindInvitationByDigest(auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, fmt.Errorf("find invitation: %w", err)
+	}
+	now := time.Now()
+	if invitation.AcceptedAt != nil || now.After(invitation.ExpiresAt) {
+		return nil, ErrInvalidInvitation
+	}
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	// A forwarded link does not let someone else join
+	if !strings.EqualFold(user.Email, invitation.Email) {
+		return nil, ErrInvalidInvitation
+	}
+	if _, err := s.organizations.FindMembership(invitation.OrganizationID, userID); err == nil {
+		return nil, ErrAlreadyMember
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("find membership: %w", err)
+	}
+
+	membership := &models.Membership{
+		OrganizationID: invitation.OrganizationID,
+		UserID:         userID,
+		Role:           invitation.Role,
+	}
+	accepted, err := s.organizations.AcceptInvitation(invitation, membership, now)
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return nil, ErrAlreadyMember
+		}
+		return nil, fmt.Errorf("accept invitation: %w", err)
+	}
+	if !accepted {
+		return nil, ErrInvalidInvitation
+	}
+	s.logger.WithFields(logrus.Fields{
+		"organization_id": invitation.OrganizationID,
+		"invitation_id":   invitation.ID,
+		"user_id":         userID,
+	}).Info("Organization invitation accepted")
+	return membership, nil
+}
+
+func (s *organizationService) TransferOwnership(orgID, ownerID, recipientID uint) (*models.OwnershipTransfer, error) {
+	if recipientID == ownerID {
+		return nil, ErrTransferRecipient
+	}
+	org, err := s.organizations.FindByID(orgID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, fmt.Errorf("find organization: %w", err)
+	}
+	if _, err := s.organizations.FindMembership(orgID, recipientID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrTransferRecipient
+		}
+		return nil, fmt.Errorf("find membership: %w", err)
+	}
+	// Deleted accounts keep their membership until they are erased
+	recipient, err := s.users.FindByID(recipientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrTransferRecipient
+		}
+		return nil, fmt.Errorf("find recipient: %w", err)
+	}
+	owner, err := s.users.FindByID(ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("find owner: %w", err)
+	}
+
+	token, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	transfer := &models.OwnershipTransfer{
+		OrganizationID: orgID,
+		FromUserID:     ownerID,
+		ToUserID:       recipientID,
+		TokenDigest:    auth.HashToken(token),
+		ExpiresAt:      now.Add(s.config.TransferTTL),
+	}
+	if err := s.organizations.CreateTransfer(transfer, now); err != nil {
+		return nil, fmt.Errorf("create ownership transfer: %w", err)
+	}
+
+	messageID, err := s.emails.SendToUser("ownership_transfer", recipient, recipient.Email, map[string]interface{}{
+		"Username":     recipient.Username,
+		"Organization": org.Name,
+		"Owner":        owner.Username,
+		"AcceptURL":    s.config.TransferURL + token,
+		"ExpiresIn":    s.config.TransferTTL.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send ownership transfer: %w", err)
+	}
+	s.logger.WithFields(logrus.Fields{
+		"organization_id": orgID,
+		"transfer_id":     transfer.ID,
+		"from_user_id":    ownerID,
+		"to_user_id":      recipientID,
+		"message_id":      messageID,
+	}).Info("Organization ownership transfer offered")
+	return transfer, nil
+}
+
+func (s *organizationService) AcceptOwnership(userID uint, token string) (*models.OwnershipTransfer, error) {
+	transfer, err := s.organizations.FindTransferByDigest(auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidTransfer
+		}
+		return nil, fmt.Errorf("find ownership transfer: %w", err)
+	}
+	now := time.Now()
+	// A forwarded link does not make someone else the owner
+	if transfer.ToUserID != userID || transfer.AcceptedAt != nil || transfer.CancelledAt != nil || !now.Before(transfer.ExpiresAt) {
+		return nil, ErrInvalidTransfer
+	}
+
+	changes, _ := json.Marshal(map[string]interface{}{
+		"owner": map[string]interface{}{"from": transfer.FromUserID, "to": transfer.ToUserID},
+	})
+	audit := make([]models.AuditEntry, 0, 2)
+	for _, member := range []uint{transfer.FromUserID, transfer.ToUserID} {
+		audit = append(audit, models.AuditEntry{
+			Entity:   "organization",
+			EntityID: transfer.OrganizationID,
+			UserID:   member,
+			ActorID:  &userID,
+			Action:   "transfer_ownership",
+			Changes:  string(changes),
+		})
+	}
+	completed, err := s.organizations.CompleteTransfer(transfer, audit, now)
+	if err != nil {
+		return nil, fmt.Errorf("complete ownership transfer: %w", err)
+	}
+	if !completed {
+		return nil, ErrInvalidTransfer
+	}
+
+	// Access tokens carry the organization role, so both members get new ones
+	for _, member := range []uint{transfer.FromUserID, transfer.ToUserID} {
+		if err := s.revoker.RevokeUser(member); err != nil {
+			s.logger.WithError(err).WithField("user_id", member).Error("Failed to revoke access tokens after ownership transfer")
+		}
+	}
+	s.logger.WithFields(logrus.Fields{
+		"organization_id": transfer.OrganizationID,
+		"transfer_id":     transfer.ID,
+		"from_user_id":    transfer.FromUserID,
+		"to_user_id":      transfer.ToUserID,
+	}).Info("Organization ownership transferred")
+	return transfer, nil
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrInvalidResetToken is returned for unknown, expired or already used reset links
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// Security event types recorded for password resets
+const (
+	EventPasswordResetRequested = "password_reset_requested"
+	EventPasswordResetCompleted = "password_reset_completed"
+)
+
+// PasswordResetConfig holds the password reset settings
+type PasswordResetConfig struct {
+	URL        string        // the token is appended to this link
+	TokenTTL   time.Duration // how long a link stays valid
+	MaxPerHour int           // emails per account and hour; further requests are recorded but not mailed
+	// SetPasswordTTL is how long the link mailed to accounts created without a password
+	// of the user's own stays valid
+	SetPasswordTTL time.Duration
+}
+
+// PasswordResetService sends password reset links and applies them
+type PasswordResetService interface {
+	// Request emails a reset link when email belongs to an account. It never reveals
+	// whether the account exists; every attempt on an account is recorded as a security event.
+	Request(email string, client ClientInfo) error
+	// Reset sets a new password with a token from a reset link and ends every session
+	Reset(token, newPassword string, client ClientInfo) error
+	// SendSetPasswordLink emails the holder of an account created for them, such as an
+	// imported one, a link to choose their password. It is applied by Reset; once it
+	// expires, a reset can be requested as usual.
+	SendSetPasswordLink(user *models.User) error
+}
+
+type passwordResetService struct {
+	users         repository.UserRepository
+	resets        repository.PasswordResetRepository
+	tokens        repository.TokenRepository
+	events        repository.SecurityEventRepository
+	emails        EmailService
+	notifications NotificationService
+	revoker       TokenRevoker
+	passwords     PasswordValidator
+	config        PasswordResetConfig
+	logger        *logrus.Logger
+}
+
+func NewPasswordResetService(users repository.UserRepository, resets repository.PasswordResetRepository, tokens repository.TokenRepository, events repository.SecurityEventRepository, emails EmailService, notifications NotificationService, revoker TokenRevoker, passwords PasswordValidator, config PasswordResetConfig, logger *logrus.Logger) PasswordResetService {
+	return &passwordResetService{
+		users:         users,
+		resets:        resets,
+		tokens:        tokens,
+		events:        events,
+		emails:        emails,
+		notifications: notifications,
+		revoker:       revoker,
+		passwords:     passwords,
+		config:        config,
+		logger:        logger,
+	}
+}
+
+func (s *passwordResetService) Request(email string, client ClientInfo) error {
+	user, err := s.users.FindByEmail(email)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			s.logger.WithField("ip", client.IP).Debug("Password reset requested for unknown email")
+			return nil
+		}
+		return fmt.Errorf("find user: %w", err)
+	}
+	// The identity provider owns these passwords; answer as for an unknown email
+	if user.ExternallyManaged() {
+		s.logger.WithField("user_id", user.ID).Info("Password reset requested for externally managed account")
+		return nil
+	}
+
+	now := time.Now()
+	recent, err := s.resets.CountSince(user.ID, now.Add(-time.Hour))
+	if err != nil {
+		return fmt.Errorf("count reset requests: %w", err)
+	}
+	if recent >= s.config.MaxPerHour {
+		s.recordEvent(user.ID, EventPasswordResetRequested, "warning", client, map[string]interface{}{"throttled": true})
+		s.logger.WithField("user_id", user.ID).Warn("Password reset requests throttled")
+		return nil
+	}
+
+	token, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	reset := &models.PasswordReset{
+		UserID:      user.ID,
+		TokenDigest: auth.HashToken(token),
+		ExpiresAt:   now.Add(s.config.TokenTTL),
+		IPAddress:   client.IP,
+		UserAgent:   client.UserAgent,
+	}
+	if err := s.resets.Create(reset); err != nil {
+		return fmt.Errorf("create password reset: %w", err)
+	}
+
+	// The email always explains what to do if the request was not the owner's
+	messageID, err := s.emails.SendToUser("password_reset", user, user.Email, map[string]interface{}{
+		"Username":  user.Username,
+		"ResetURL":  s.config.URL + token,
+		"ExpiresIn": s.config.TokenTTL.String(),
+		"Time":      now,
+		"IP":        client.IP,
+		"Device":    client.UserAgent,
+	})
+	if err != nil {
+		return fmt.Errorf("send password reset email: %w", err)
+	}
+
+	s.recordEvent(user.ID, EventPasswordResetRequested, "info", client, map[string]interface{}{"messageId": messageID})
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"message_id": messageID,
+	}).Info("Password reset email queued")
+	return nil
+}
+
+func (s *passwordResetService) SendSetPasswordLink(user *models.User) error {
+	token, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	reset := &models.PasswordReset{
+		UserID:      user.ID,
+		TokenDigest: auth.HashToken(token),
+		ExpiresAt:   time.Now().Add(s.config.SetPasswordTTL),
+	}
+	if err := s.resets.Create(reset); err != nil {
+		return fmt.Errorf("create password reset: %w", err)
+	}
+
+	messageID, err := s.emails.SendToUser("set_password", user, user.Email, map[string]interface{}{
+		"Username":       user.Username,
+		"SetPasswordURL": s.config.URL + token,
+		"ExpiresIn":      s.config.SetPasswordTTL.String(),
+	})
+	if err != nil {
+		return fmt.Errorf("send set password email: %w", err)
+	}
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"message_id": messageID,
+	}).Info("Set password email queued")
+	return nil
+}
+
+func (s *passwordResetService) Reset(token, newPassword string, client ClientInfo) error {
+	reset, err := s.resets.FindByDigest(auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		return fmt.Errorf("find password reset: %w", err)
+	}
+	now := time.Now()
+	if reset.UsedAt != nil || !now.Before(reset.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	user, err := s.users.FindByID(reset.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		return fmt.Errorf("find user: %w", err)
+	}
+	// Accounts whose password an identity provider manages have none to reset
+	if user.ExternallyManaged() {
+		return ErrInvalidResetToken
+	}
+	// Checked before the token is claimed so a rejected password can be retried
+	if err := s.passwords.Validate(newPassword, user); err != nil {
+		return err
+	}
+
+	claimed, err := s.resets.MarkUsed(reset, now)
+	if err != nil {
+		return fmt.Errorf("claim password reset: %w", err)
+	}
+	if !claimed {
+		return ErrInvalidResetToken
+	}
+
+	hashedPassword, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	user.PasswordHash = hashedPassword
+	user.PasswordChangedAt = &now
+	user.PasswordChangeRequired = false
+	if err := s.users.Save(user); err != nil {
+		return fmt.Errorf("save user: %w", err)
+	}
+	s.passwords.Remember(user)
+
+	// Whoever knew the old password must not stay signed in
+	if err := s.revoker.RevokeUser(user.ID); err != nil {
+		return fmt.Errorf("revoke access tokens: %w", err)
+	}
+	if err := s.tokens.DeleteByUser(user.ID); err != nil {
+		return fmt.Errorf("revoke sessions: %w", err)
+	}
+
+	s.recordEvent(user.ID, EventPasswordResetCompleted, "info", client, nil)
+	s.notifications.PasswordChanged(user, nil)
+	s.logger.WithField("user_id", user.ID).Info("Password reset completed")
+	return nil
+}
+
+func (s *passwordResetService) recordEvent(userID uint, eventType, severity string, client ClientInfo, details map[string]interface{}) {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	details["ip"] = client.IP
+	details["userAgent"] = client.UserAgent
+	payload, _ := json.Marshal(details)
+
+	if err := s.events.Create(&models.SecurityEvent{
+		UserID:   userID,
+		Type:     eventType,
+		Severity: severity,
+		Details:  string(payload),
+	}); err != nil {
+		s.logger.WithError(err).Error("Failed to record security event")
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrPasswordCheckUnavailable is returned when the breach check fails and is
+	// configured to fail closed
+	ErrPasswordCheckUnavailable = errors.New("password breach check unavailable")
+	ErrPasswordExpired          = errors.New("password expired")
+)
+
+// temporaryPasswordLength is the length of generated passwords
+const temporaryPasswordLength = 20
+
+// PasswordRejectedError lists the reasons a new password was refused
+type PasswordRejectedError struct {
+	Violations []auth.PasswordViolation
+}
+
+func (e *PasswordRejectedError) Error() string {
+	return "password rejected: " + e.Violations[0].Message
+}
+
+// PasswordTooRecentError is returned when the password was changed before the minimum age
+type PasswordTooRecentError struct {
+	RetryAt time.Time
+}
+
+func (e *PasswordTooRecentError) Error() string {
+	return "password was changed recently; retry after " + e.RetryAt.UTC().Format(time.RFC3339)
+}
+
+// BreachCheckConfig controls how breach lookups affect password validation
+type BreachCheckConfig struct {
+	Threshold int  // reject passwords seen in at least this many breaches
+	FailOpen  bool // accept the password when the lookup fails
+}
+
+// PasswordConfig holds the password rules beyond the policy itself
+type PasswordConfig struct {
+	Breach  BreachCheckConfig
+	History int           // recent passwords, the current one included, that cannot be reused; 0 disables
+	MinAge  time.Duration // minimum time between password changes; 0 disables
+	MaxAge  time.Duration // passwords older than this must be reset before signing in; 0 disables
+}
+
+// PasswordValidator vets new passwords and enforces password reuse and age rules
+type PasswordValidator interface {
+	// Validate checks a new password. user carries the email and username of the
+	// account, which may not be saved yet.
+	Validate(password string, user *models.User) error
+	// Remember records the user's current password hash so it cannot be reused
+	Remember(user *models.User)
+	// CheckMinAge returns a *PasswordTooRecentError if the password may not change yet
+	CheckMinAge(user *models.User, now time.Time) error
+	// Expired reports whether the password is past its maximum age, or was not chosen
+	// by the user and has to be replaced. Passwords of externally managed accounts never
+	// expire here.
+	Expired(user *models.User, now time.Time) bool
+}
+
+type passwordValidator struct {
+	policy   *auth.PasswordPolicy
+	breaches auth.BreachChecker
+	history  repository.PasswordHistoryRepository
+	config   PasswordConfig
+	logger   *logrus.Logger
+}
+
+// NewPasswordValidator checks passwords against policy and, unless breaches is nil,
+// against known data breaches
+func NewPasswordValidator(policy *auth.PasswordPolicy, breaches auth.BreachChecker, history repository.PasswordHistoryRepository, config PasswordConfig, logger *logrus.Logger) PasswordValidator {
+	if config.Breach.Threshold < 1 {
+		config.Breach.Threshold = 1
+	}
+	return &passwordValidator{policy: policy, breaches: breaches, history: history, config: config, logger: logger}
+}
+
+func (v *passwordValidator) Validate(password string, user *models.User) error {
+	if violations := v.policy.Check(password, user.Email, user.Username); len(violations) > 0 {
+		return &PasswordRejectedError{Violations: violations}
+	}
+	if reused, err := v.reused(password, user); err != nil {
+		return err
+	} else if reused {
+		return &PasswordRejectedError{Violations: []auth.PasswordViolation{{
+			Code:    "password_reused",
+			Message: fmt.Sprintf("Password must differ from your last %d passwords", v.config.History),
+		}}}
+	}
+	if v.breaches == nil {
+		return nil
+	}
+
+	count, err := v.breaches.BreachCount(context.Background(), password)
+	if err != nil {
+		if v.config.Breach.FailOpen {
+			v.logger.WithError(err).Warn("Password breach check failed; accepting password")
+			return nil
+		}
+		return fmt.Errorf("%w: %v", ErrPasswordCheckUnavailable, err)
+	}
+	if count >= v.config.Breach.Threshold {
+		return &PasswordRejectedError{Violations: []auth.PasswordViolation{{
+			Code:    "breached_password",
+			Message: "Password has appeared in a known data breach",
+		}}}
+	}
+	return nil
+}
+
+// reused reports whether password matches the current or a recent password of an
+// existing user
+func (v *passwordValidator) reused(password string, user *models.User) (bool, error) {
+	if v.config.History <= 0 || user.ID == 0 {
+		return false, nil
+	}
+	// Accounts created before the history was kept only have their current hash
+	if user.PasswordHash != "" && auth.ComparePasswords(user.PasswordHash, password) == nil {
+		return true, nil
+	}
+	entries, err := v.history.Recent(user.ID, v.config.History)
+	if err != nil {
+		return false, fmt.Errorf("load password history: %w", err)
+	}
+	for _, entry := range entries {
+		if auth.ComparePasswords(entry.PasswordHash, password) == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (v *passwordValidator) Remember(user *models.User) {
+	if v.config.History <= 0 {
+		return
+	}
+	entry := &models.PasswordHistory{UserID: user.ID, PasswordHash: user.PasswordHash}
+	if err := v.history.Create(entry, v.config.History); err != nil {
+		v.logger.WithError(err).WithField("user_id", user.ID).Error("Failed to record password history")
+	}
+}
+
+func (v *passwordValidator) CheckMinAge(user *models.User, now time.Time) error {
+	if v.config.MinAge <= 0 || user.PasswordChangedAt == nil {
+		return nil
+	}
+	if retryAt := user.PasswordChangedAt.Add(v.config.MinAge); now.Before(retryAt) {
+		return &PasswordTooRecentError{RetryAt: retryAt}
+	}
+	return nil
+}
+
+func (v *passwordValidator) Expired(user *models.User, now time.Time) bool {
+	// Identity providers enforce their own password age
+	if user.ExternallyManaged() {
+		return false
+	}
+	if user.PasswordChangeRequired {
+		return true
+	}
+	return v.config.MaxAge > 0 && !now.Before(user.PasswordSetAt().Add(v.config.MaxAge))
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"api/internal/models"
+	"fmt"
+	"strings"
+)
+
+// CompletenessRule counts a profile field towards the completeness score
+type CompletenessRule struct {
+	Field    string // profile field as named in the API, e.g. firstName or avatarURL
+	Weight   int
+	Required bool // listed in MissingRequired while empty, whatever the score
+}
+
+// DefaultCompletenessRules apply when none are configured: the names are required and
+// weigh most, with the avatar
+var DefaultCompletenessRules = []CompletenessRule{
+	{Field: "firstName", Weight: 2, Required: true},
+	{Field: "lastName", Weight: 2, Required: true},
+	{Field: "avatarURL", Weight: 2},
+	{Field: "bio", Weight: 1},
+	{Field: "preferredName", Weight: 1},
+	{Field: "pronouns", Weight: 1},
+	{Field: "locale", Weight: 1},
+	{Field: "timezone", Weight: 1},
+}
+
+// ProfileCompleteness tells how much of a profile is filled in
+type ProfileCompleteness struct {
+	Score           int      // percent of the rule weights whose fields are filled in
+	Missing         []string // empty fields, in rule order
+	MissingRequired []string // the required ones among Missing
+}
+
+// CompletenessScorer scores profiles against a set of rules
+type CompletenessScorer struct {
+	rules []CompletenessRule
+	total int
+}
+
+// NewCompletenessScorer checks the rules: known profile fields, each once, with
+// non-negative weights adding up to more than zero
+func NewCompletenessScorer(rules []CompletenessRule) (*CompletenessScorer, error) {
+	scorer := &CompletenessScorer{rules: rules}
+	seen := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if _, known := DefaultProfileVisibility[rule.Field]; !known {
+			return nil, fmt.Errorf("completeness rule for unknown profile field %q", rule.Field)
+		}
+		if seen[rule.Field] {
+			return nil, fmt.Errorf("completeness rule for %s given twice", rule.Field)
+		}
+		if rule.Weight < 0 {
+			return nil, fmt.Errorf("completeness rule for %s has a negative weight", rule.Field)
+		}
+		seen[rule.Field] = true
+		scorer.total += rule.Weight
+	}
+	if scorer.total == 0 {
+		return nil, fmt.Errorf("completeness rules must have a total weight above zero")
+	}
+	return scorer, nil
+}
+
+// Score rates profile; a user without a profile is scored with an empty one
+func (s *CompletenessScorer) Score(profile *models.UserProfile) ProfileCompleteness {
+	completeness := ProfileCompleteness{Missing: []string{}, MissingRequired: []string{}}
+	filled := 0
+	for _, rule := range s.rules {
+		if profileFieldFilled(profile, rule.Field) {
+			filled += rule.Weight
+			continue
+		}
+		completeness.Missing = append(completeness.Missing, rule.Field)
+		if rule.Required {
+			completeness.MissingRequired = append(completeness.MissingRequired, rule.Field)
+		}
+	}
+	completeness.Score = filled * 100 / s.total
+	return completeness
+}
+
+func profileFieldFilled(profile *models.UserProfile, field string) bool {
+	return strings.TrimSpace(profileFieldValue(profile, field)) != ""
+}
+
+// profileFieldValue returns a profile field by its API name; the avatar counts as set
+// when either a URL or an upload is
+func profileFieldValue(profile *models.UserProfile, field string) string {
+	switch field {
+	case "firstName":
+		return profile.FirstName
+	case "lastName":
+		return profile.LastName
+	case "preferredName":
+		return string(profile.PreferredName)
+	case "pronouns":
+		return string(profile.Pronouns)
+	case "honorific":
+		return profile.Honorific
+	case "bio":
+		return string(profile.Bio)
+	case "avatarURL":
+		return profile.AvatarURL + profile.AvatarKey
+	case "locale":
+		return profile.Locale
+	case "timezone":
+		return profile.Timezone
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"api/internal/models"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Visibility of a profile field in the user directory. Private fields are only
+// shown to the user themselves and to admins.
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+// DefaultProfileVisibility applies to fields the user has not chosen a visibility for:
+// names and identity fields are listed in the directory, locale and timezone are not
+var DefaultProfileVisibility = map[string]string{
+	"firstName":     VisibilityPublic,
+	"lastName":      VisibilityPublic,
+	"preferredName": VisibilityPublic,
+	"pronouns":      VisibilityPublic,
+	"honorific":     VisibilityPublic,
+	"bio":           VisibilityPublic,
+	"avatarURL":     VisibilityPublic,
+	"locale":        VisibilityPrivate,
+	"timezone":      VisibilityPrivate,
+}
+
+var ErrInvalidVisibility = errors.New("visibility must map profile fields to public or private")
+
+// ProfileVisibility returns the effective visibility of every profile field
+func ProfileVisibility(profile *models.UserProfile) map[string]string {
+	visibility := make(map[string]string, len(DefaultProfileVisibility))
+	for field, value := range DefaultProfileVisibility {
+		visibility[field] = value
+	}
+	for _, setting := range strings.Split(profile.Visibility, ",") {
+		field, value, ok := strings.Cut(setting, "=")
+		if _, known := DefaultProfileVisibility[field]; ok && known {
+			visibility[field] = value
+		}
+	}
+	return visibility
+}
+
+// applyVisibility validates settings and stores them on profile; only choices that
+// differ from the defaults are kept. nil keeps the current settings.
+func applyVisibility(profile *models.UserProfile, settings map[string]string) error {
+	if settings == nil {
+		return nil
+	}
+	visibility := ProfileVisibility(profile)
+	for field, value := range settings {
+		if _, known := DefaultProfileVisibility[field]; !known || (value != VisibilityPublic && value != VisibilityPrivate) {
+			return ErrInvalidVisibility
+		}
+		visibility[field] = value
+	}
+
+	var overrides []string
+	for field, value := range visibility {
+		if value != DefaultProfileVisibility[field] {
+			overrides = append(overrides, field+"="+value)
+		}
+	}
+	sort.Strings(overrides)
+	profile.Visibility = strings.Join(overrides, ",")
+	return nil
+}
+
+// normalizeTimezone checks an IANA timezone name; "" is kept as "not set"
+func normalizeTimezone(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	// LoadLocation also accepts "Local", which means nothing to other users
+	if name == "Local" {
+		return "", ErrInvalidTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return "", ErrInvalidTimezone
+	}
+	return loc.String(), nil
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrReportScheduleNotFound = errors.New("report schedule not found")
+	ErrInvalidTimezone        = errors.New("unknown timezone")
+	ErrInvalidReportSchedule  = errors.New("weekday must be 0-6, dayOfMonth 1-28 and hour 0-23")
+)
+
+// ReportScheduleInput describes a new scheduled report
+type ReportScheduleInput struct {
+	Frequency  string // weekly or monthly
+	Timezone   string // IANA name, defaults to UTC
+	Weekday    int    // weekly reports, 0 = Sunday
+	DayOfMonth int    // monthly reports
+	Hour       int
+	Recipients []string
+}
+
+// ReportService emails summaries of the admin statistics on recurring schedules
+type ReportService interface {
+	CreateSchedule(actorID uint, input ReportScheduleInput) (*models.ReportSchedule, error)
+	ListSchedules() ([]models.ReportSchedule, error)
+	DeleteSchedule(id uint) error
+	// SendDue sends the reports whose scheduled time has passed. Each one covers the
+	// week or month up to its scheduled time.
+	SendDue(now time.Time)
+}
+
+type reportService struct {
+	reports repository.ReportRepository
+	stats   StatsService
+	emails  EmailService
+	logger  *logrus.Logger
+}
+
+func NewReportService(reports repository.ReportRepository, stats StatsService, emails EmailService, logger *logrus.Logger) ReportService {
+	return &reportService{
+		reports: reports,
+		stats:   stats,
+		emails:  emails,
+		logger:  logger,
+	}
+}
+
+func (s *reportService) CreateSchedule(actorID uint, input ReportScheduleInput) (*models.ReportSchedule, error) {
+	if input.Timezone == "" {
+		input.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(input.Timezone)
+	if err != nil {
+		return nil, ErrInvalidTimezone
+	}
+	if input.Hour < 0 || input.Hour > 23 ||
+		(input.Frequency == models.ReportWeekly && (input.Weekday < 0 || input.Weekday > 6)) ||
+		(input.Frequency == models.ReportMonthly && (input.DayOfMonth < 1 || input.DayOfMonth > 28)) {
+		return nil, ErrInvalidReportSchedule
+	}
+
+	schedule := &models.ReportSchedule{
+		CreatedByID: actorID,
+		Frequency:   input.Frequency,
+		Timezone:    loc.String(),
+		Hour:        input.Hour,
+		Recipients:  strings.Join(input.Recipients, ","),
+	}
+	if input.Frequency == models.ReportWeekly {
+		schedule.Weekday = input.Weekday
+	} else {
+		schedule.DayOfMonth = input.DayOfMonth
+	}
+	schedule.NextRunAt = nextReportRun(schedule, loc, time.Now())
+
+	if err := s.reports.Create(schedule); err != nil {
+		return nil, fmt.Errorf("create report schedule: %w", err)
+	}
+	s.logger.WithFields(logrus.Fields{
+		"schedule_id": schedule.ID,
+		"admin_id":    actorID,
+		"frequency":   schedule.Frequency,
+		"next_run_at": schedule.NextRunAt,
+	}).Info("Report schedule created")
+	return schedule, nil
+}
+
+func (s *reportService) ListSchedules() ([]models.ReportSchedule, error) {
+	return s.reports.List()
+}
+
+func (s *reportService) DeleteSchedule(id uint) error {
+	deleted, err := s.reports.Delete(id)
+	if err != nil {
+		return fmt.Errorf("delete report schedule: %w", err)
+	}
+	if !deleted {
+		return ErrReportScheduleNotFound
+	}
+	return nil
+}
+
+func (s *reportService) SendDue(now time.Time) {
+	schedules, err := s.reports.ListDue(now)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to list due report schedules")
+		return
+	}
+
+	for i := range schedules {
+		schedule := &schedules[i]
+		logger := s.logger.WithField("schedule_id", schedule.ID)
+
+		loc, err := time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			logger.WithError(err).Error("Report schedule has an unknown timezone")
+			continue
+		}
+		to := schedule.NextRunAt.In(loc)
+		from := to.AddDate(0, 0, -7)
+		if schedule.Frequency == models.ReportMonthly {
+			from = to.AddDate(0, -1, 0)
+		}
+		summary, err := s.stats.Summary(from, to)
+		if err != nil {
+			logger.WithError(err).Error("Failed to compute report statistics")
+			continue
+		}
+
+		// Runs missed while no instance was up are not sent retroactively
+		next := nextReportRun(schedule, loc, now)
+		claimed, err := s.reports.ClaimRun(schedule, now, next)
+		if err != nil {
+			logger.WithError(err).Error("Failed to claim report run")
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		data := reportData(schedule, summary, loc)
+		for _, recipient := range strings.Split(schedule.Recipients, ",") {
+			if _, err := s.emails.Send("admin_report", recipient, data); err != nil {
+				logger.WithError(err).WithField("recipient", recipient).Error("Failed to send report")
+			}
+		}
+		logger.WithField("next_run_at", next).Info("Report sent")
+	}
+}
+
+// nextReportRun returns the first scheduled time after t
+func nextReportRun(schedule *models.ReportSchedule, loc *time.Location, t time.Time) time.Time {
+	local := t.In(loc)
+	if schedule.Frequency == models.ReportMonthly {
+		run := time.Date(local.Year(), local.Month(), schedule.DayOfMonth, schedule.Hour, 0, 0, 0, loc)
+		if !run.After(t) {
+			run = time.Date(local.Year(), local.Month()+1, schedule.DayOfMonth, schedule.Hour, 0, 0, 0, loc)
+		}
+		return run
+	}
+
+	days := (schedule.Weekday - int(local.Weekday()) + 7) % 7
+	run := time.Date(local.Year(), local.Month(), local.Day()+days, schedule.Hour, 0, 0, 0, loc)
+	if !run.After(t) {
+		run = time.Date(local.Year(), local.Month(), local.Day()+days+7, schedule.Hour, 0, 0, 0, loc)
+	}
+	return run
+}
+
+func reportData(schedule *models.ReportSchedule, summary *StatsSummary, loc *time.Location) map[string]interface{} {
+	events := make([]map[string]interface{}, 0, len(summary.SecurityEvents))
+	total := 0
+	for _, count := range summary.SecurityEvents {
+		events = append(events, map[string]interface{}{
+			"Type":     count.Type,
+			"Severity": count.Severity,
+			"Count":    count.Count,
+		})
+		total += count.Count
+	}
+	const layout = "Mon, 02 Jan 2006 15:04 MST"
+	return map[string]interface{}{
+		"Frequency":           schedule.Frequency,
+		"From":                summary.From.In(loc).Format(layout),
+		"To":                  summary.To.In(loc).Format(layout),
+		"TotalUsers":          summary.TotalUsers,
+		"Signups":             summary.Signups,
+		"ActiveUsers":         summary.ActiveUsers,
+		"SecurityEvents":      events,
+		"SecurityEventsTotal": total,
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"fmt"
+)
+
+// Scopes limit API keys and scoped sessions to parts of the API. A scope also allows
+// the scopes nested under it, so admin allows admin:users.
+const (
+	ScopeProfileRead   = "profile:read"
+	ScopeProfileWrite  = "profile:write"
+	ScopeAccount       = "account" // credentials, sessions, devices, API keys and exports
+	ScopeOrganizations = "organizations"
+	ScopeAdmin         = "admin"
+	ScopeAdminUsers    = "admin:users"
+)
+
+// apiKeyScopes can be given to API keys, which only reach the profile and admin routes
+var apiKeyScopes = map[string]bool{
+	ScopeProfileRead:  true,
+	ScopeProfileWrite: true,
+	ScopeAdmin:        true,
+	ScopeAdminUsers:   true,
+}
+
+// sessionScopes can be given to scoped sessions
+var sessionScopes = map[string]bool{
+	ScopeProfileRead:   true,
+	ScopeProfileWrite:  true,
+	ScopeAccount:       true,
+	ScopeOrganizations: true,
+	ScopeAdmin:         true,
+	ScopeAdminUsers:    true,
+}
+
+// checkScopes returns ErrInvalidScope unless every scope is one of valid and the admin
+// scopes are only given to admins
+func checkScopes(scopes []string, valid map[string]bool, user *models.User) error {
+	for _, scope := range scopes {
+		if !valid[scope] {
+			return fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+		if auth.HasScope([]string{ScopeAdmin}, scope) && user.Role != "admin" {
+			return fmt.Errorf("%w: %s requires the admin role", ErrInvalidScope, scope)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// BootstrapAdmin describes the first admin account
+type BootstrapAdmin struct {
+	Email    string
+	Username string // the local part of Email when empty
+	Password string // generated when empty
+}
+
+// SeedService creates the first admin account, so a new deployment can be managed
+// without editing the database, and sample data for development
+type SeedService interface {
+	// BootstrapAdmin creates admin unless an admin account exists. It returns the
+	// created user, nil when there was an admin already, and the password when it was
+	// generated, for the caller to show once.
+	BootstrapAdmin(admin BootstrapAdmin) (*models.User, string, error)
+	// SeedSampleUsers creates count verified users with profiles, all with password.
+	// Sample users left from an earlier run are kept; it returns how many were created.
+	SeedSampleUsers(count int, password string) (int, error)
+}
+
+type seedService struct {
+	users     repository.UserRepository
+	passwords PasswordValidator
+	logger    *logrus.Logger
+}
+
+func NewSeedService(users repository.UserRepository, passwords PasswordValidator, logger *logrus.Logger) SeedService {
+	return &seedService{users: users, passwords: passwords, logger: logger}
+}
+
+func (s *seedService) BootstrapAdmin(admin BootstrapAdmin) (*models.User, string, error) {
+	admins, err := s.users.CountByRole("admin")
+	if err != nil {
+		return nil, "", fmt.Errorf("count admins: %w", err)
+	}
+	if admins > 0 {
+		return nil, "", nil
+	}
+
+	email := strings.TrimSpace(admin.Email)
+	localPart, _, ok := strings.Cut(email, "@")
+	if !ok || localPart == "" {
+		return nil, "", fmt.Errorf("bootstrap admin email %q is not an email address", admin.Email)
+	}
+	user := &models.User{
+		Email:         email,
+		Username:      admin.Username,
+		Role:          "admin",
+		EmailVerified: true,
+		Status:        models.UserStatusActive,
+		AuthSource:    models.AuthSourceLocal,
+	}
+	if user.Username == "" {
+		user.Username = localPart
+	}
+	password, generated := admin.Password, ""
+	if password == "" {
+		if password, err = auth.GenerateTemporaryPassword(temporaryPasswordLength); err != nil {
+			return nil, "", fmt.Errorf("generate password: %w", err)
+		}
+		generated = password
+	}
+	if err := createAccount(s.users, s.passwords, user, password); err != nil {
+		return nil, "", err
+	}
+	s.logger.WithFields(logrus.Fields{
+		"user_id":            user.ID,
+		"email":              user.Email,
+		"generated_password": generated != "",
+	}).Info("Bootstrap admin created")
+	return user, generated, nil
+}
+
+// sampleNames are combined into the names of sample users
+var sampleNames = [][2]string{
+	{"Ada", "Lovelace"}, {"Grace", "Hopper"}, {"Alan", "Turing"}, {"Edsger", "Dijkstra"},
+	{"Barbara", "Liskov"}, {"Donald", "Knuth"}, {"Frances", "Allen"}, {"Ken", "Thompson"},
+	{"Margaret", "Hamilton"}, {"Dennis", "Ritchie"}, {"Radia", "Perlman"}, {"John", "Backus"},
+}
+
+func (s *seedService) SeedSampleUsers(count int, password string) (int, error) {
+	created := 0
+	for i := 1; i <= count; i++ {
+		name := sampleNames[(i-1)%len(sampleNames)]
+		user := &models.User{
+			Email:         fmt.Sprintf("sample%d@example.com", i),
+			Username:      fmt.Sprintf("sample%d", i),
+			Role:          "user",
+			EmailVerified: true,
+			Status:        models.UserStatusActive,
+			AuthSource:    models.AuthSourceLocal,
+		}
+		if err := createAccount(s.users, s.passwords, user, password); err != nil {
+			if errors.Is(err, ErrEmailTaken) || errors.Is(err, ErrUsernameTaken) {
+				continue
+			}
+			return created, fmt.Errorf("create %s: %w", user.Email, err)
+		}
+		if err := s.users.SaveProfile(&models.UserProfile{
+			UserID:    user.ID,
+			FirstName: name[0],
+			LastName:  name[1],
+			Bio:       models.EncryptedString("Sample account for development"),
+			Locale:    "en",
+			Timezone:  "UTC",
+		}); err != nil {
+			return created, fmt.Errorf("save profile of %s: %w", user.Email, err)
+		}
+		created++
+	}
+	s.logger.WithFields(logrus.Fields{"requested": count, "created": created}).Info("Sample users seeded")
+	return created, nil
+}
+
+// createAccount checks the password against the policy and stores the new account
+func createAccount(users repository.UserRepository, passwords PasswordValidator, user *models.User, password string) error {
+	if err := passwords.Validate(password, user); err != nil {
+		return err
+	}
+	hashed, err := auth.HashPassword(password)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	user.PasswordHash = hashed
+	if err := users.Create(user); err != nil {
+		if conflict := userConflict(err); conflict != nil {
+			return conflict
+		}
+		return fmt.Errorf("create user: %w", err)
+	}
+	passwords.Remember(user)
+	return nil
+}
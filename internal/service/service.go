@@ -0,0 +1,134 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Domain errors returned by the services. Handlers map them to HTTP responses;
+// any other error is an internal failure.
+var (
+	ErrUserExists          = errors.New("email or username already exists")
+	ErrEmailTaken          = fmt.Errorf("%w: email is taken", ErrUserExists)
+	ErrUsernameTaken       = fmt.Errorf("%w: username is taken", ErrUserExists)
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	// ErrRefreshTokenDevice is returned for a refresh token presented by another device
+	// than the one it was issued to
+	ErrRefreshTokenDevice = fmt.Errorf("%w: issued to another device", ErrInvalidRefreshToken)
+	ErrIncorrectPassword  = errors.New("current password is incorrect")
+	ErrUnsupportedLocale  = errors.New("unsupported locale")
+	ErrInvalidSuspension  = errors.New("invalid suspension")
+	ErrUserNotDeleted     = errors.New("user is not deleted")
+	// ErrAccountDeactivated is returned when the holder of a deactivated account signs
+	// in; a reactivation link has been mailed to them
+	ErrAccountDeactivated = errors.New("account deactivated")
+	// ErrAccountPendingDeletion is returned when the holder of an account pending deletion
+	// signs in; a link undoing the deletion has been mailed to them
+	ErrAccountPendingDeletion = errors.New("account pending deletion")
+	// ErrExternalPassword is returned for password changes of accounts that sign in
+	// through the LDAP directory or a SAML identity provider
+	ErrExternalPassword = errors.New("password is managed by an identity provider")
+)
+
+// userConflict maps a unique constraint violation on users to ErrEmailTaken or
+// ErrUsernameTaken, and returns nil for other errors
+func userConflict(err error) error {
+	var duplicate *repository.DuplicateError
+	if !errors.As(err, &duplicate) {
+		return nil
+	}
+	switch duplicate.Column {
+	case "email":
+		return ErrEmailTaken
+	case "username":
+		return ErrUsernameTaken
+	}
+	return ErrUserExists
+}
+
+// AccountBlockedError is returned when a suspended, banned or deactivated account tries
+// to sign in
+type AccountBlockedError struct {
+	Status string     // suspended, banned or deactivated
+	Until  *time.Time // end of a temporary suspension
+}
+
+func (e *AccountBlockedError) Error() string {
+	return "account " + e.Status
+}
+
+// accountBlocked returns an AccountBlockedError if user may not sign in now
+func accountBlocked(user *models.User) error {
+	status := user.AccountStatus(time.Now())
+	if status == models.UserStatusActive {
+		return nil
+	}
+	err := &AccountBlockedError{Status: status}
+	if status == models.UserStatusSuspended {
+		err.Until = user.SuspendedUntil
+	}
+	return err
+}
+
+// ClientInfo describes the device a request comes from
+type ClientInfo struct {
+	IP          string
+	UserAgent   string
+	Fingerprint string // identifies the device across IP addresses; see TrustedDevice
+}
+
+// AccessToken identifies the access token a request was authenticated with
+type AccessToken struct {
+	ID        string // jti claim
+	UserID    uint
+	ExpiresAt time.Time
+}
+
+// TokenRevoker blacklists access tokens before they expire
+type TokenRevoker interface {
+	Revoke(jti string, userID uint, expiresAt time.Time) error
+	// RevokeUser invalidates every access token issued to the user so far
+	RevokeUser(userID uint) error
+}
+
+// TokenConfig holds the JWT settings used to issue token pairs
+type TokenConfig struct {
+	AccessKeys    *auth.KeySet
+	RefreshKeys   *auth.KeySet
+	Issuer        string
+	Audience      string // of access tokens
+	AccessExpiry  int    // minutes
+	RefreshExpiry int    // days
+	// BindDevice rejects refresh tokens used from another device than they were issued to
+	BindDevice bool
+	// MaxSessions ends the oldest sessions of a user signing in beyond it; 0 for no limit
+	MaxSessions int
+	// Claims adds deployment specific claims to access tokens; nil adds none
+	Claims *auth.ClaimsChain
+	// Clock tells the time sessions start and tokens are issued at; nil for
+	// auth.SystemClock
+	Clock auth.Clock
+	// Generator signs the tokens; nil for auth.JWTGenerator
+	Generator auth.TokenGenerator
+}
+
+func (c TokenConfig) clock() auth.Clock {
+	if c.Clock == nil {
+		return auth.SystemClock
+	}
+	return c.Clock
+}
+
+func (c TokenConfig) generator() auth.TokenGenerator {
+	if c.Generator == nil {
+		return auth.JWTGenerator{}
+	}
+	return c.Generator
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionService lets users inspect and revoke their login sessions (refresh token families)
+type SessionService interface {
+	ListSessions(userID uint) ([]models.RefreshToken, error)
+	RevokeSession(userID, sessionID uint) error
+	// RevokeOtherSessions ends every session except currentFamilyID and returns how many were ended
+	RevokeOtherSessions(userID uint, currentFamilyID string) (int, error)
+}
+
+type sessionService struct {
+	tokens repository.TokenRepository
+	logger *logrus.Logger
+}
+
+func NewSessionService(tokens repository.TokenRepository, logger *logrus.Logger) SessionService {
+	return &sessionService{
+		tokens: tokens,
+		logger: logger,
+	}
+}
+
+func (s *sessionService) ListSessions(userID uint) ([]models.RefreshToken, error) {
+	return s.tokens.ListActive(userID)
+}
+
+func (s *sessionService) RevokeSession(userID, sessionID uint) error {
+	token, err := s.tokens.FindActiveByID(userID, sessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrSessionNotFound
+		}
+		return fmt.Errorf("find session: %w", err)
+	}
+
+	if token.FamilyID != "" {
+		err = s.tokens.DeleteFamily(userID, token.FamilyID)
+	} else {
+		err = s.tokens.Delete(token)
+	}
+	if err != nil {
+		return fmt.Errorf("revoke session: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    userID,
+		"session_id": sessionID,
+	}).Info("Session revoked")
+	return nil
+}
+
+func (s *sessionService) RevokeOtherSessions(userID uint, currentFamilyID string) (int, error) {
+	count, err := s.tokens.DeleteFamiliesExcept(userID, currentFamilyID)
+	if err != nil {
+		return 0, fmt.Errorf("revoke sessions: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": userID,
+		"revoked": count,
+	}).Info("Other sessions revoked")
+	return count, nil
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"api/internal/models"
+	"api/internal/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SettingsError lists the rejected settings by field with the reason; nothing was saved
+type SettingsError struct {
+	Fields map[string]string
+}
+
+func (e *SettingsError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field, reason := range e.Fields {
+		fields = append(fields, field+": "+reason)
+	}
+	sort.Strings(fields)
+	return "invalid settings: " + strings.Join(fields, "; ")
+}
+
+// Settings are a user's account settings, gathered from the profile (locale and
+// timezone), the notification preferences and UserSettings
+type Settings struct {
+	Locale             string
+	Timezone           string
+	Theme              string
+	MarketingConsent   bool
+	MarketingConsentAt *time.Time
+	Notifications      NotificationSettings
+}
+
+// SettingsUpdate changes the settings that are not nil. An empty locale or timezone
+// clears the preference.
+type SettingsUpdate struct {
+	Locale           *string
+	Timezone         *string
+	Theme            *string
+	MarketingConsent *bool
+	Notifications    NotificationUpdate
+}
+
+// NotificationUpdate turns the notification emails that are not nil on or off
+type NotificationUpdate struct {
+	Welcome         *bool
+	PasswordChanged *bool
+	NewLogin        *bool
+	RoleChanged     *bool
+}
+
+// SettingsService reads and changes a user's account settings in one place
+type SettingsService interface {
+	Get(userID uint) (*Settings, error)
+	// Update validates every field before saving any; a *SettingsError lists those
+	// rejected. Changes to marketing consent are written to the audit trail.
+	Update(userID uint, update SettingsUpdate, client ClientInfo) (*Settings, error)
+}
+
+type settingsService struct {
+	settings      repository.SettingsRepository
+	users         repository.UserRepository
+	notifications NotificationService
+	audit         repository.AuditRepository
+	logger        *logrus.Logger
+}
+
+func NewSettingsService(settings repository.SettingsRepository, users repository.UserRepository, notifications NotificationService, audit repository.AuditRepository, logger *logrus.Logger) SettingsService {
+	return &settingsService{
+		settings:      settings,
+		users:         users,
+		notifications: notifications,
+		audit:         audit,
+		logger:        logger,
+	}
+}
+
+// load returns the stored settings, or unsaved defaults, and the profile
+func (s *settingsService) load(userID uint) (*models.UserSettings, *models.UserProfile, error) {
+	if _, err := s.users.FindByID(userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrUserNotFound
+		}
+		return nil, nil, fmt.Errorf("find user: %w", err)
+	}
+	settings, err := s.settings.FindByUser(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		settings, err = &models.UserSettings{UserID: userID, Theme: models.ThemeSystem}, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("find settings: %w", err)
+	}
+	profile, err := s.users.FindProfile(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		profile, err = &models.UserProfile{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("find profile: %w", err)
+	}
+	return settings, profile, nil
+}
+
+func (s *settingsService) Get(userID uint) (*Settings, error) {
+	settings, profile, err := s.load(userID)
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := s.notifications.Preferences(userID)
+	if err != nil {
+		return nil, fmt.Errorf("find notification preferences: %w", err)
+	}
+	return combineSettings(settings, profile, prefs), nil
+}
+
+func combineSettings(settings *models.UserSettings, profile *models.UserProfile, prefs *models.NotificationPreferences) *Settings {
+	return &Settings{
+		Locale:             profile.Locale,
+		Timezone:           profile.Timezone,
+		Theme:              settings.Theme,
+		MarketingConsent:   settings.MarketingConsent,
+		MarketingConsentAt: settings.MarketingConsentAt,
+		Notifications: NotificationSettings{
+			Welcome:         prefs.Welcome,
+			PasswordChanged: prefs.PasswordChanged,
+			NewLogin:        prefs.NewLogin,
+			RoleChanged:     prefs.RoleChanged,
+		},
+	}
+}
+
+func (s *settingsService) Update(userID uint, update SettingsUpdate, client ClientInfo) (*Settings, error) {
+	settings, profile, err := s.load(userID)
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := s.notifications.Preferences(userID)
+	if err != nil {
+		return nil, fmt.Errorf("find notification preferences: %w", err)
+	}
+
+	invalid := map[string]string{}
+	locale, timezone := profile.Locale, profile.Timezone
+	if update.Locale != nil {
+		if locale, err = normalizeLocale(*update.Locale); err != nil {
+			invalid["locale"] = err.Error()
+		}
+	}
+	if update.Timezone != nil {
+		if timezone, err = normalizeTimezone(*update.Timezone); err != nil {
+			invalid["timezone"] = err.Error()
+		}
+	}
+	theme := settings.Theme
+	if update.Theme != nil {
+		theme = *update.Theme
+		if theme != models.ThemeSystem && theme != models.ThemeLight && theme != models.ThemeDark {
+			invalid["theme"] = "must be system, light or dark"
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, &SettingsError{Fields: invalid}
+	}
+
+	if locale != profile.Locale || timezone != profile.Timezone {
+		profile.Locale, profile.Timezone = locale, timezone
+		if err := s.users.SaveProfile(profile); err != nil {
+			return nil, fmt.Errorf("save profile: %w", err)
+		}
+	}
+
+	consentChanged := update.MarketingConsent != nil && *update.MarketingConsent != settings.MarketingConsent
+	if consentChanged {
+		now := time.Now()
+		settings.MarketingConsent = *update.MarketingConsent
+		settings.MarketingConsentAt = &now
+	}
+	if theme != settings.Theme || consentChanged || settings.ID == 0 {
+		settings.Theme = theme
+		if err := s.settings.Save(settings); err != nil {
+			return nil, fmt.Errorf("save settings: %w", err)
+		}
+	}
+	if consentChanged {
+		s.auditConsent(userID, settings.MarketingConsent, client)
+	}
+
+	n := update.Notifications
+	if n.Welcome != nil || n.PasswordChanged != nil || n.NewLogin != nil || n.RoleChanged != nil {
+		prefs, err = s.notifications.UpdatePreferences(userID, NotificationSettings{
+			Welcome:         valueOr(n.Welcome, prefs.Welcome),
+			PasswordChanged: valueOr(n.PasswordChanged, prefs.PasswordChanged),
+			NewLogin:        valueOr(n.NewLogin, prefs.NewLogin),
+			RoleChanged:     valueOr(n.RoleChanged, prefs.RoleChanged),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("save notification preferences: %w", err)
+		}
+	}
+
+	s.logger.WithField("user_id", userID).Info("Settings updated")
+	return combineSettings(settings, profile, prefs), nil
+}
+
+// auditConsent records a change of marketing consent, which has to be provable later
+func (s *settingsService) auditConsent(userID uint, consent bool, client ClientInfo) {
+	changes, err := json.Marshal(map[string]interface{}{
+		"marketingConsent": map[string]bool{"from": !consent, "to": consent},
+		"ip":               client.IP,
+		"userAgent":        client.UserAgent,
+	})
+	if err == nil {
+		err = s.audit.Create(&models.AuditEntry{
+			Entity:   "user_settings",
+			EntityID: userID,
+			UserID:   userID,
+			ActorID:  &userID,
+			Action:   "marketing_consent",
+			Changes:  string(changes),
+		})
+	}
+	if err != nil {
+		s.logger.WithError(err).WithField("user_id", userID).Error("Failed to write audit entry")
+	}
+}
+
+func valueOr(value *bool, fallback bool) bool {
+	if value != nil {
+		return *value
+	}
+	return fallback
+}
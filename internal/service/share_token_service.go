@@ -0,0 +1,190 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ShareTokenPrefix starts every share token, telling them apart from API keys
+const ShareTokenPrefix = "ums_"
+
+var (
+	ErrShareTokenNotFound = errors.New("share token not found")
+	ErrInvalidShareToken  = errors.New("invalid share token")
+	ErrInvalidShareField  = errors.New("field cannot be shared")
+)
+
+// shareableAccountFields can be shared besides the profile fields; displayName is the
+// preferred name, else the full name, else the username
+var shareableAccountFields = map[string]bool{"displayName": true, "username": true, "email": true}
+
+// SharedProfile is what a share token lets its app read
+type SharedProfile struct {
+	Token   *models.ShareToken
+	Profile *models.UserProfile
+	// Fields holds the shared fields by their API name; unset profile fields are empty
+	Fields map[string]string
+}
+
+// ShareTokenService manages the tokens users give third-party apps to read chosen
+// profile fields: a consent limited to those fields, revocable at any time
+type ShareTokenService interface {
+	// Create returns the stored token and its plaintext value, which is never retrievable again
+	Create(userID uint, app string, fields []string, expiresAt *time.Time) (*models.ShareToken, string, error)
+	List(userID uint) ([]models.ShareToken, error)
+	Revoke(userID, id uint) error
+	// Resolve returns the fields shared by a plaintext token. Tokens of accounts that
+	// are not active are refused like unknown ones.
+	Resolve(plaintext string) (*SharedProfile, error)
+}
+
+type shareTokenService struct {
+	tokens repository.ShareTokenRepository
+	users  repository.UserRepository
+	logger *logrus.Logger
+}
+
+func NewShareTokenService(tokens repository.ShareTokenRepository, users repository.UserRepository, logger *logrus.Logger) ShareTokenService {
+	return &shareTokenService{
+		tokens: tokens,
+		users:  users,
+		logger: logger,
+	}
+}
+
+func (s *shareTokenService) Create(userID uint, app string, fields []string, expiresAt *time.Time) (*models.ShareToken, string, error) {
+	if len(fields) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one field is required", ErrInvalidShareField)
+	}
+	seen := make(map[string]bool, len(fields))
+	unique := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if _, profileField := DefaultProfileVisibility[field]; !profileField && !shareableAccountFields[field] {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidShareField, field)
+		}
+		if !seen[field] {
+			seen[field] = true
+			unique = append(unique, field)
+		}
+	}
+
+	secret, err := auth.GenerateRandomToken(24)
+	if err != nil {
+		return nil, "", fmt.Errorf("generate share token: %w", err)
+	}
+	plaintext := ShareTokenPrefix + secret
+
+	token := &models.ShareToken{
+		UserID:    userID,
+		App:       app,
+		Prefix:    plaintext[:len(ShareTokenPrefix)+8],
+		TokenHash: auth.HashToken(plaintext),
+		Fields:    strings.Join(unique, ","),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.tokens.Create(token); err != nil {
+		return nil, "", fmt.Errorf("store share token: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":        userID,
+		"share_token_id": token.ID,
+		"app":            app,
+		"fields":         token.Fields,
+	}).Info("Share token created")
+	return token, plaintext, nil
+}
+
+func (s *shareTokenService) List(userID uint) ([]models.ShareToken, error) {
+	return s.tokens.ListByUser(userID)
+}
+
+func (s *shareTokenService) Revoke(userID, id uint) error {
+	deleted, err := s.tokens.DeleteForUser(userID, id)
+	if err != nil {
+		return fmt.Errorf("delete share token: %w", err)
+	}
+	if !deleted {
+		return ErrShareTokenNotFound
+	}
+	s.logger.WithFields(logrus.Fields{
+		"user_id":        userID,
+		"share_token_id": id,
+	}).Info("Share token revoked")
+	return nil
+}
+
+func (s *shareTokenService) Resolve(plaintext string) (*SharedProfile, error) {
+	if !strings.HasPrefix(plaintext, ShareTokenPrefix) {
+		return nil, ErrInvalidShareToken
+	}
+	token, err := s.tokens.FindByHash(auth.HashToken(plaintext))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidShareToken
+		}
+		return nil, fmt.Errorf("find share token: %w", err)
+	}
+	now := time.Now()
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return nil, ErrInvalidShareToken
+	}
+
+	user, err := s.users.FindByID(token.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidShareToken
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	if user.AccountStatus(now) != models.UserStatusActive {
+		return nil, ErrInvalidShareToken
+	}
+	profile, err := s.users.FindProfile(user.ID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		profile = &models.UserProfile{}
+	case err != nil:
+		return nil, fmt.Errorf("find profile: %w", err)
+	}
+
+	shared := &SharedProfile{Token: token, Profile: profile, Fields: map[string]string{}}
+	for _, field := range strings.Split(token.Fields, ",") {
+		switch field {
+		case "displayName":
+			shared.Fields[field] = displayName(user, profile)
+		case "username":
+			shared.Fields[field] = user.Username
+		case "email":
+			shared.Fields[field] = user.Email
+		default:
+			shared.Fields[field] = profileFieldValue(profile, field)
+		}
+	}
+
+	// Avoid a write per request for busy apps
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > time.Minute {
+		if err := s.tokens.TouchLastUsed(token.ID, now); err != nil {
+			s.logger.WithError(err).Warn("Failed to update share token last used time")
+		}
+		token.LastUsedAt = &now
+	}
+	return shared, nil
+}
+
+func displayName(user *models.User, profile *models.UserProfile) string {
+	if name := strings.TrimSpace(string(profile.PreferredName)); name != "" {
+		return name
+	}
+	if name := strings.TrimSpace(profile.FirstName + " " + profile.LastName); name != "" {
+		return name
+	}
+	return user.Username
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"api/internal/repository"
+	"fmt"
+	"time"
+)
+
+// StatsSummary describes account activity in a period
+type StatsSummary struct {
+	From           time.Time
+	To             time.Time
+	TotalUsers     int // accounts at the end of the period
+	Signups        int
+	ActiveUsers    int
+	SecurityEvents []repository.SecurityEventCount
+}
+
+// StatsService computes the statistics shown to admins
+type StatsService interface {
+	Summary(from, to time.Time) (*StatsSummary, error)
+}
+
+type statsService struct {
+	stats repository.StatsRepository
+}
+
+func NewStatsService(stats repository.StatsRepository) StatsService {
+	return &statsService{stats: stats}
+}
+
+func (s *statsService) Summary(from, to time.Time) (*StatsSummary, error) {
+	summary := &StatsSummary{From: from, To: to}
+	var err error
+	if summary.TotalUsers, err = s.stats.CountUsers(to); err != nil {
+		return nil, fmt.Errorf("count users: %w", err)
+	}
+	if summary.Signups, err = s.stats.CountSignups(from, to); err != nil {
+		return nil, fmt.Errorf("count signups: %w", err)
+	}
+	if summary.ActiveUsers, err = s.stats.CountActiveUsers(from, to); err != nil {
+		return nil, fmt.Errorf("count active users: %w", err)
+	}
+	if summary.SecurityEvents, err = s.stats.CountSecurityEvents(from, to); err != nil {
+		return nil, fmt.Errorf("count security events: %w", err)
+	}
+	return summary, nil
+}
@@ -0,0 +1,539 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/internal/repository"
+	"api/internal/storage"
+	"api/internal/validation"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrImportNotFound      = errors.New("import not found")
+	ErrImportNotReady      = errors.New("import is not finished")
+	ErrInvalidImportFormat = errors.New("import format must be json or csv")
+	ErrInvalidImportMode   = errors.New("import mode must be password or invite")
+	// ErrInvalidImportFile is wrapped with the reason the file could not be read
+	ErrInvalidImportFile = errors.New("invalid import file")
+)
+
+// Outcomes of imported rows
+const (
+	ImportRowCreated = "created"
+	ImportRowInvited = "invited"
+	ImportRowFailed  = "failed"
+)
+
+// errImportInterrupted fails imports that were running when the service stopped
+var errImportInterrupted = errors.New("import was interrupted by a restart; some rows may have been imported")
+
+// ImportConfig limits bulk user imports
+type ImportConfig struct {
+	MaxRows  int
+	MaxBytes int64         // largest accepted file
+	TTL      time.Duration // how long the report can be downloaded
+}
+
+// ImportRow is one user of an import file. Usernames are chosen by invited users, so
+// the column is only required for accounts created by the import.
+type ImportRow struct {
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// ImportResult is the report line of a row; rows are numbered from 1 without the CSV header
+type ImportResult struct {
+	Row      int    `json:"row"`
+	Email    string `json:"email"`
+	Username string `json:"username,omitempty"`
+	Role     string `json:"role,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	UserID   uint   `json:"userId,omitempty"`
+}
+
+// UserImportService creates users in bulk from CSV or JSON files uploaded by admins.
+// Files are checked when uploaded and imported in the background; a report with the
+// outcome of every row can then be downloaded by the admin who started the import
+// until it expires. Created accounts are mailed a link to set their password, which
+// nobody else ever learns.
+type UserImportService interface {
+	// Start checks and stores the file and queues its import
+	Start(adminID uint, format, mode string, data []byte) (*models.ImportJob, error)
+	Get(adminID, jobID uint) (*models.ImportJob, error)
+	// OpenReport returns the report of a completed import
+	OpenReport(ctx context.Context, adminID, jobID uint) (io.ReadCloser, *models.ImportJob, error)
+	// Resume restarts pending imports after a restart; imports that were running fail,
+	// since their rows cannot be safely imported twice
+	Resume()
+	// PurgeExpired deletes expired reports and their jobs
+	PurgeExpired()
+	MaxUploadBytes() int64
+}
+
+type userImportService struct {
+	jobs        repository.ImportJobRepository
+	users       repository.UserRepository
+	invitations InvitationService
+	emails      EmailService
+	resets      PasswordResetService
+	storage     storage.Storage
+	config      ImportConfig
+	logger      *logrus.Logger
+	// imports run one at a time per instance, so the mail queue is not flooded
+	slots chan struct{}
+}
+
+func NewUserImportService(jobs repository.ImportJobRepository, users repository.UserRepository, invitations InvitationService, emails EmailService, resets PasswordResetService, store storage.Storage, config ImportConfig, logger *logrus.Logger) UserImportService {
+	return &userImportService{
+		jobs:        jobs,
+		users:       users,
+		invitations: invitations,
+		emails:      emails,
+		resets:      resets,
+		storage:     store,
+		config:      config,
+		logger:      logger,
+		slots:       make(chan struct{}, 1),
+	}
+}
+
+func (s *userImportService) MaxUploadBytes() int64 {
+	return s.config.MaxBytes
+}
+
+func (s *userImportService) Start(adminID uint, format, mode string, data []byte) (*models.ImportJob, error) {
+	if format != ExportFormatJSON && format != ExportFormatCSV {
+		return nil, ErrInvalidImportFormat
+	}
+	if mode != models.ImportModePassword && mode != models.ImportModeInvite {
+		return nil, ErrInvalidImportMode
+	}
+	rows, err := parseImport(format, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: no users", ErrInvalidImportFile)
+	}
+	if s.config.MaxRows > 0 && len(rows) > s.config.MaxRows {
+		return nil, fmt.Errorf("%w: %d users, at most %d can be imported at once", ErrInvalidImportFile, len(rows), s.config.MaxRows)
+	}
+
+	name, err := auth.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("imports/%d/%s.%s", adminID, name, format)
+	if err := s.storage.Put(context.Background(), key, bytes.NewReader(data), int64(len(data)), UserListContentType(format)); err != nil {
+		return nil, fmt.Errorf("store import: %w", err)
+	}
+
+	job := &models.ImportJob{
+		AdminID:   adminID,
+		Format:    format,
+		Mode:      mode,
+		Status:    models.ExportPending,
+		SourceKey: key,
+		Rows:      len(rows),
+	}
+	if err := s.jobs.Create(job); err != nil {
+		return nil, fmt.Errorf("create import: %w", err)
+	}
+
+	go s.process(*job)
+	return job, nil
+}
+
+func (s *userImportService) Get(adminID, jobID uint) (*models.ImportJob, error) {
+	job, err := s.jobs.FindForAdmin(adminID, jobID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrImportNotFound
+		}
+		return nil, fmt.Errorf("find import: %w", err)
+	}
+	return job, nil
+}
+
+func (s *userImportService) OpenReport(ctx context.Context, adminID, jobID uint) (io.ReadCloser, *models.ImportJob, error) {
+	job, err := s.Get(adminID, jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if job.Status != models.ExportCompleted {
+		return nil, nil, ErrImportNotReady
+	}
+	if job.ExpiresAt != nil && time.Now().After(*job.ExpiresAt) {
+		return nil, nil, ErrImportNotFound
+	}
+
+	body, _, err := s.storage.Get(ctx, job.ReportKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil, ErrImportNotFound
+		}
+		return nil, nil, fmt.Errorf("read import report: %w", err)
+	}
+	return body, job, nil
+}
+
+func (s *userImportService) Resume() {
+	jobs, err := s.jobs.ListUnfinished()
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to list unfinished imports")
+		return
+	}
+	for _, job := range jobs {
+		if job.Status == models.ExportPending {
+			go s.process(job)
+			continue
+		}
+		s.finish(&job, nil, errImportInterrupted)
+	}
+}
+
+func (s *userImportService) PurgeExpired() {
+	jobs, err := s.jobs.ListExpired(time.Now())
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to list expired imports")
+		return
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		if !s.deleteFiles(job) {
+			continue
+		}
+		if err := s.jobs.Delete(job); err != nil {
+			s.logger.WithError(err).WithField("import_id", job.ID).Warn("Failed to delete import job")
+		}
+	}
+}
+
+// deleteFiles removes the upload and report of a job, reporting whether both are gone
+func (s *userImportService) deleteFiles(job *models.ImportJob) bool {
+	deleted := true
+	for _, key := range []string{job.SourceKey, job.ReportKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.storage.Delete(context.Background(), key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			s.logger.WithError(err).WithField("import_id", job.ID).Warn("Failed to delete import file")
+			deleted = false
+		}
+	}
+	return deleted
+}
+
+// process imports the rows of a job, one job at a time
+func (s *userImportService) process(job models.ImportJob) {
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	job.Status = models.ExportRunning
+	if err := s.jobs.Save(&job); err != nil {
+		s.logger.WithError(err).WithField("import_id", job.ID).Error("Failed to update import")
+		return
+	}
+
+	results, err := s.importRows(&job)
+	s.finish(&job, results, err)
+}
+
+func (s *userImportService) importRows(job *models.ImportJob) ([]ImportResult, error) {
+	body, _, err := s.storage.Get(context.Background(), job.SourceKey)
+	if err != nil {
+		return nil, fmt.Errorf("read import: %w", err)
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read import: %w", err)
+	}
+	rows, err := parseImport(job.Format, data)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ImportResult, 0, len(rows))
+	emails := make(map[string]int, len(rows))
+	usernames := make(map[string]int, len(rows))
+	for i, row := range rows {
+		result := ImportResult{
+			Row:      i + 1,
+			Email:    strings.TrimSpace(row.Email),
+			Username: strings.TrimSpace(row.Username),
+			Role:     strings.TrimSpace(row.Role),
+		}
+		if result.Role == "" {
+			result.Role = "user"
+		}
+
+		err := s.checkRow(job.Mode, &result, emails, usernames)
+		if err == nil {
+			if job.Mode == models.ImportModeInvite {
+				err = s.invite(job.AdminID, &result)
+			} else {
+				err = s.create(&result)
+			}
+		}
+		if err != nil {
+			result.Status = ImportRowFailed
+			result.Error = s.rowError(job, result.Row, err)
+			job.Failed++
+		} else {
+			job.Succeeded++
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// checkRow validates a row, remembering its email address and username to find
+// duplicates later in the file
+func (s *userImportService) checkRow(mode string, result *ImportResult, emails, usernames map[string]int) error {
+	if result.Email == "" {
+		return invalidRow("email is required")
+	}
+	if address, err := mail.ParseAddress(result.Email); err != nil || address.Address != result.Email {
+		return invalidRow("email is not a valid address")
+	}
+	if row, ok := emails[strings.ToLower(result.Email)]; ok {
+		return invalidRow(fmt.Sprintf("email is a duplicate of row %d", row))
+	}
+	emails[strings.ToLower(result.Email)] = result.Row
+
+	if mode == models.ImportModePassword || result.Username != "" {
+		if length := utf8.RuneCountInString(result.Username); length < 3 || length > 50 {
+			return invalidRow("username must be 3 to 50 characters long")
+		}
+		if !validation.Username(result.Username) {
+			return invalidRow(`username may only contain letters, digits, ".", "_" and "-", starting with a letter or digit`)
+		}
+		if row, ok := usernames[strings.ToLower(result.Username)]; ok {
+			return invalidRow(fmt.Sprintf("username is a duplicate of row %d", row))
+		}
+		usernames[strings.ToLower(result.Username)] = result.Row
+	}
+
+	if result.Role != "user" && result.Role != "admin" {
+		return invalidRow("role must be user or admin")
+	}
+	return nil
+}
+
+// create registers an account that cannot sign in until its holder sets a password
+// with the link mailed to them, and asks them to verify the email address, as after
+// signing up. The password hash is of a random secret nobody knows.
+func (s *userImportService) create(result *ImportResult) error {
+	secret, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := auth.HashPassword(secret)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	user := &models.User{
+		Email:                  result.Email,
+		Username:               result.Username,
+		PasswordHash:           hashedPassword,
+		PasswordChangeRequired: true,
+		Role:                   result.Role,
+		Status:                 models.UserStatusActive,
+		AuthSource:             models.AuthSourceLocal,
+	}
+	if err := s.users.Create(user); err != nil {
+		if conflict := userConflict(err); conflict != nil {
+			return conflict
+		}
+		return fmt.Errorf("create user: %w", err)
+	}
+
+	// Without the link the user can still request a password reset
+	if err := s.resets.SendSetPasswordLink(user); err != nil {
+		s.logger.WithError(err).WithField("user_id", user.ID).Error("Failed to send set password email")
+	}
+	if _, err := s.emails.SendToUser("verification", user, user.Email, map[string]interface{}{
+		"Username": user.Username,
+	}); err != nil {
+		s.logger.WithError(err).WithField("user_id", user.ID).Error("Failed to send verification email")
+	}
+
+	result.Status = ImportRowCreated
+	result.UserID = user.ID
+	return nil
+}
+
+func (s *userImportService) invite(adminID uint, result *ImportResult) error {
+	if _, err := s.invitations.Invite(adminID, result.Email, result.Role); err != nil {
+		return err
+	}
+	result.Status = ImportRowInvited
+	return nil
+}
+
+// invalidRow is the reason a row did not pass validation
+type invalidRow string
+
+func (e invalidRow) Error() string {
+	return string(e)
+}
+
+// rowError describes why a row failed for the report, logging unexpected errors
+func (s *userImportService) rowError(job *models.ImportJob, row int, err error) string {
+	var invalid invalidRow
+	switch {
+	case errors.As(err, &invalid):
+		return invalid.Error()
+	case errors.Is(err, ErrEmailTaken):
+		return "email is already registered"
+	case errors.Is(err, ErrUsernameTaken):
+		return "username is taken"
+	}
+	s.logger.WithError(err).WithFields(logrus.Fields{"import_id": job.ID, "row": row}).Error("Failed to import user")
+	return "user could not be imported"
+}
+
+// finish stores the report of a job, or records why it failed
+func (s *userImportService) finish(job *models.ImportJob, results []ImportResult, err error) {
+	logger := s.logger.WithFields(logrus.Fields{"import_id": job.ID, "admin_id": job.AdminID})
+
+	now := time.Now()
+	// Failed jobs are cleaned up like finished ones
+	expires := now.Add(s.config.TTL)
+	job.ExpiresAt = &expires
+	if err == nil {
+		job.ReportKey, err = s.storeReport(job, results)
+	}
+	if err != nil {
+		logger.WithError(err).Error("Import failed")
+		job.Status = models.ExportFailed
+		job.Error = "import could not be completed"
+		if errors.Is(err, ErrInvalidImportFile) || errors.Is(err, errImportInterrupted) {
+			job.Error = err.Error()
+		}
+	} else {
+		job.Status = models.ExportCompleted
+		job.CompletedAt = &now
+		logger.WithFields(logrus.Fields{
+			"rows":      job.Rows,
+			"succeeded": job.Succeeded,
+			"failed":    job.Failed,
+			"mode":      job.Mode,
+		}).Info("Import completed")
+	}
+
+	// Finished imports are never run again, so the upload is no longer needed
+	if err := s.storage.Delete(context.Background(), job.SourceKey); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		logger.WithError(err).Warn("Failed to delete import file")
+	} else {
+		job.SourceKey = ""
+	}
+	if err := s.jobs.Save(job); err != nil {
+		logger.WithError(err).Error("Failed to update import")
+	}
+}
+
+func (s *userImportService) storeReport(job *models.ImportJob, results []ImportResult) (string, error) {
+	var buf bytes.Buffer
+	if job.Format == ExportFormatCSV {
+		out := csv.NewWriter(&buf)
+		out.Write([]string{"row", "email", "username", "role", "status", "error", "userId"})
+		for _, r := range results {
+			var userID interface{}
+			if r.UserID != 0 {
+				userID = r.UserID
+			}
+			out.Write([]string{csvValue(r.Row), csvValue(r.Email), csvValue(r.Username), csvValue(r.Role),
+				r.Status, r.Error, csvValue(userID)})
+		}
+		out.Flush()
+		if err := out.Error(); err != nil {
+			return "", err
+		}
+	} else {
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return "", err
+		}
+	}
+
+	name, err := auth.GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("imports/%d/%s-report.%s", job.AdminID, name, job.Format)
+	if err := s.storage.Put(context.Background(), key, &buf, int64(buf.Len()), UserListContentType(job.Format)); err != nil {
+		return "", fmt.Errorf("store import report: %w", err)
+	}
+	return key, nil
+}
+
+// parseImport reads the rows of a file. CSV files start with a header naming the
+// email, username and role columns in any order; JSON files hold an array of objects.
+func parseImport(format string, data []byte) ([]ImportRow, error) {
+	if format == ExportFormatJSON {
+		var rows []ImportRow
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, fmt.Errorf("%w: expected a JSON array of users: %v", ErrInvalidImportFile, err)
+		}
+		return rows, nil
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, fmt.Errorf("%w: the CSV header has no email column", ErrInvalidImportFile)
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var rows []ImportRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+		rows = append(rows, ImportRow{
+			Email:    field(record, "email"),
+			Username: field(record, "username"),
+			Role:     field(record, "role"),
+		})
+	}
+	return rows, nil
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"api/internal/models"
+	"api/internal/repository"
+	"api/internal/storage"
+	"api/internal/xlsx"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// userListColumns are the fields of the admin user list export
+var userListColumns = []string{"id", "email", "username", "role", "emailVerified", "createdAt", "updatedAt",
+	"firstName", "lastName", "preferredName", "pronouns", "honorific", "locale", "timezone"}
+
+// userListBatch is the number of users read at a time while writing the export
+const userListBatch = 1000
+
+func (s *exportService) UserListETag(format string, orgID uint) (string, error) {
+	if format != ExportFormatJSON && format != ExportFormatCSV && format != ExportFormatXLSX {
+		return "", ErrInvalidUserListFormat
+	}
+	filter := repository.UserListFilter{OrganizationID: orgID}
+	version, err := s.repos.Users.ListVersion(filter)
+	if err != nil {
+		return "", fmt.Errorf("user list version: %w", err)
+	}
+
+	// Counts catch deletions, the latest update times catch every other change
+	sum := sha256.New()
+	fmt.Fprintf(sum, "users|%s|%d|%d|%s|%s", format, version.Users, version.Profiles,
+		formatVersionTime(version.UsersUpdatedAt), formatVersionTime(version.ProfilesUpdatedAt))
+	if filter.OrganizationID != 0 {
+		fmt.Fprintf(sum, "|org|%d|%d|%s", filter.OrganizationID, version.Members, formatVersionTime(version.MembersUpdatedAt))
+	}
+	return `"` + hex.EncodeToString(sum.Sum(nil))[:32] + `"`, nil
+}
+
+func formatVersionTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func (s *exportService) OpenUserList(ctx context.Context, adminID uint, format string, orgID uint) (io.ReadSeekCloser, *models.ExportJob, error) {
+	etag, err := s.UserListETag(format, orgID)
+	if err != nil {
+		return nil, nil, err
+	}
+	filter := repository.UserListFilter{OrganizationID: orgID}
+
+	job, err := s.repos.Jobs.FindUserList(etag, format, time.Now())
+	switch {
+	case err == nil:
+		body, _, err := s.storage.Get(ctx, job.StorageKey)
+		if err == nil {
+			file, err := seekable(body)
+			if err != nil {
+				return nil, nil, fmt.Errorf("read user list export: %w", err)
+			}
+			if err := s.auditUserList(adminID, job, filter); err != nil {
+				file.Close()
+				return nil, nil, err
+			}
+			return file, job, nil
+		}
+		// A cached file that went missing is generated again
+		if !errors.Is(err, storage.ErrNotFound) {
+			return nil, nil, fmt.Errorf("read user list export: %w", err)
+		}
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, nil, fmt.Errorf("find user list export: %w", err)
+	}
+
+	file, rows, err := s.generateUserList(format, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	job, err = s.storeUserList(ctx, file, adminID, etag, format, rows)
+	if err == nil {
+		err = s.auditUserList(adminID, job, filter)
+	}
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"admin_id":        adminID,
+		"organization_id": filter.OrganizationID,
+		"format":          format,
+		"rows":            rows,
+		"bytes":           job.Size,
+	}).Info("User list export generated")
+	return file, job, nil
+}
+
+// storeUserList caches a generated export in the storage backend, leaving file at its start
+func (s *exportService) storeUserList(ctx context.Context, file *tempFile, adminID uint, etag, format string, rows int) (*models.ExportJob, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	expires := now.Add(s.config.TTL)
+	job := &models.ExportJob{
+		UserID:      adminID,
+		Kind:        models.ExportKindUserList,
+		Fingerprint: etag,
+		Format:      format,
+		Status:      models.ExportCompleted,
+		StorageKey:  fmt.Sprintf("exports/users/%s.%s", etag[1:len(etag)-1], format),
+		Size:        info.Size(),
+		Rows:        rows,
+		CompletedAt: &now,
+		ExpiresAt:   &expires,
+	}
+	if err := s.storage.Put(ctx, job.StorageKey, file, job.Size, UserListContentType(format)); err != nil {
+		return nil, fmt.Errorf("store user list export: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := s.repos.Jobs.Create(job); err != nil {
+		return nil, fmt.Errorf("record user list export: %w", err)
+	}
+	return job, nil
+}
+
+// auditUserList records a download of the user list in the admin's audit trail. The
+// export is refused when it cannot be recorded.
+func (s *exportService) auditUserList(adminID uint, job *models.ExportJob, filter repository.UserListFilter) error {
+	details := map[string]interface{}{"format": job.Format, "rows": job.Rows, "bytes": job.Size}
+	if filter.OrganizationID != 0 {
+		details["organizationId"] = filter.OrganizationID
+	}
+	changes, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	if err := s.repos.Audit.Create(&models.AuditEntry{
+		Entity:   "user_list",
+		EntityID: filter.OrganizationID,
+		UserID:   adminID,
+		ActorID:  &adminID,
+		Action:   "export",
+		Changes:  string(changes),
+	}); err != nil {
+		return fmt.Errorf("write audit entry: %w", err)
+	}
+	return nil
+}
+
+// UserListContentType is the media type of a user list export
+func UserListContentType(format string) string {
+	switch format {
+	case ExportFormatCSV:
+		return "text/csv"
+	case ExportFormatXLSX:
+		return xlsx.ContentType
+	}
+	return "application/json"
+}
+
+// generateUserList writes the export to a temporary file, reading the users in batches
+// so that memory use does not grow with their number
+func (s *exportService) generateUserList(format string, filter repository.UserListFilter) (*tempFile, int, error) {
+	f, err := os.CreateTemp("", "user-list-*."+format)
+	if err != nil {
+		return nil, 0, err
+	}
+	file := &tempFile{f}
+
+	buffered := bufio.NewWriter(file)
+	rows, err := s.writeUserList(buffered, format, filter)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, rows, nil
+}
+
+func (s *exportService) writeUserList(w io.Writer, format string, filter repository.UserListFilter) (int, error) {
+	out, err := newUserListWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+
+	rows := 0
+	for afterID := uint(0); ; {
+		users, err := s.repos.Users.ListPage(filter, afterID, userListBatch)
+		if err != nil {
+			return 0, fmt.Errorf("list users: %w", err)
+		}
+		if len(users) == 0 {
+			break
+		}
+		ids := make([]uint, len(users))
+		for i, u := range users {
+			ids[i] = u.ID
+		}
+		profiles, err := s.repos.Users.FindProfiles(ids)
+		if err != nil {
+			return 0, fmt.Errorf("find profiles: %w", err)
+		}
+		byUser := make(map[uint]*models.UserProfile, len(profiles))
+		for i := range profiles {
+			byUser[profiles[i].UserID] = &profiles[i]
+		}
+
+		for _, u := range users {
+			p := byUser[u.ID]
+			if p == nil {
+				p = &models.UserProfile{}
+			}
+			err := out.Write([]interface{}{u.ID, u.Email, u.Username, u.Role, u.EmailVerified, u.CreatedAt, u.UpdatedAt,
+				p.FirstName, p.LastName, string(p.PreferredName), string(p.Pronouns), p.Honorific, p.Locale, p.Timezone})
+			if err != nil {
+				return 0, err
+			}
+		}
+		rows += len(users)
+		afterID = users[len(users)-1].ID
+		if len(users) < userListBatch {
+			break
+		}
+	}
+	return rows, out.Close()
+}
+
+// userListWriter encodes the rows of the user list export one at a time
+type userListWriter interface {
+	Write(row []interface{}) error
+	Close() error
+}
+
+func newUserListWriter(w io.Writer, format string) (userListWriter, error) {
+	switch format {
+	case ExportFormatCSV:
+		out := csv.NewWriter(w)
+		return &csvUserList{out: out}, out.Write(userListColumns)
+	case ExportFormatXLSX:
+		out, err := xlsx.NewWriter(w, "Users")
+		if err != nil {
+			return nil, err
+		}
+		header := make([]interface{}, len(userListColumns))
+		for i, col := range userListColumns {
+			header[i] = col
+		}
+		return &xlsxUserList{out: out}, out.WriteRow(header)
+	}
+	_, err := io.WriteString(w, `{"users": [`)
+	return &jsonUserList{w: w}, err
+}
+
+type csvUserList struct {
+	out *csv.Writer
+}
+
+func (l *csvUserList) Write(row []interface{}) error {
+	record := make([]string, len(row))
+	for i, v := range row {
+		record[i] = csvValue(v)
+	}
+	return l.out.Write(record)
+}
+
+func (l *csvUserList) Close() error {
+	l.out.Flush()
+	return l.out.Error()
+}
+
+type xlsxUserList struct {
+	out *xlsx.Writer
+}
+
+func (l *xlsxUserList) Write(row []interface{}) error {
+	return l.out.WriteRow(row)
+}
+
+func (l *xlsxUserList) Close() error {
+	return l.out.Close()
+}
+
+// jsonUserList writes {"users": [...]} with one object per line
+type jsonUserList struct {
+	w    io.Writer
+	rows int
+}
+
+func (l *jsonUserList) Write(row []interface{}) error {
+	obj := make(map[string]interface{}, len(row))
+	for i, col := range userListColumns {
+		obj[col] = row[i]
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	separator := ",\n  "
+	if l.rows == 0 {
+		separator = "\n  "
+	}
+	l.rows++
+	if _, err := io.WriteString(l.w, separator); err != nil {
+		return err
+	}
+	_, err = l.w.Write(data)
+	return err
+}
+
+func (l *jsonUserList) Close() error {
+	_, err := io.WriteString(l.w, "\n]}\n")
+	return err
+}
+
+// tempFile is a file spooled to disk, removed when it is closed
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// seekable returns body if it can seek, and otherwise a temporary copy of it
+func seekable(body io.ReadCloser) (io.ReadSeekCloser, error) {
+	if file, ok := body.(io.ReadSeekCloser); ok {
+		return file, nil
+	}
+	defer body.Close()
+	f, err := os.CreateTemp("", "user-list-*")
+	if err != nil {
+		return nil, err
+	}
+	file := &tempFile{f}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"api/internal/models"
+	"api/internal/repository"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidSearch is returned for search queries too short to match on
+var ErrInvalidSearch = errors.New("search query must be at least 2 characters")
+
+// UserSearchHit is a user found by a search. Highlights holds the email, username and
+// name with the matching words wrapped in <mark>, HTML escaped, for the fields that
+// matched.
+type UserSearchHit struct {
+	UserWithProfile
+	Score      float64
+	Highlights map[string]string
+}
+
+// highlightSimilarity is the trigram similarity from which a word counts as a match.
+// It is a little below pg_trgm's default of 0.3 because single short words share few
+// trigrams: "jon" and "john" score 0.29.
+const highlightSimilarity = 0.25
+
+func (s *userService) Search(query string, orgID uint, limit int) ([]UserSearchHit, error) {
+	query = strings.Join(strings.Fields(query), " ")
+	if len([]rune(query)) < 2 {
+		return nil, ErrInvalidSearch
+	}
+
+	matches, err := s.users.Search(repository.UserListFilter{OrganizationID: orgID}, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("search users: %w", err)
+	}
+	terms := searchWords(query)
+	hits := make([]UserSearchHit, 0, len(matches))
+	for _, match := range matches {
+		profile := models.UserProfile{UserID: match.User.ID}
+		if match.Profile != nil {
+			profile = *match.Profile
+		}
+		hit := UserSearchHit{
+			UserWithProfile: UserWithProfile{User: match.User, Profile: profile},
+			Score:           match.Score,
+			Highlights:      map[string]string{},
+		}
+		fields := map[string]string{
+			"email":    match.User.Email,
+			"username": match.User.Username,
+			"name":     strings.TrimSpace(profile.FirstName + " " + profile.LastName),
+		}
+		for field, value := range fields {
+			if marked, ok := highlight(value, terms); ok {
+				hit.Highlights[field] = marked
+			}
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// searchWords splits text into lower case words the way pg_trgm does, at every
+// character that is not a letter or digit
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// highlight escapes value and marks its words that contain or resemble one of terms.
+// It reports whether anything was marked.
+func highlight(value string, terms []string) (string, bool) {
+	var out strings.Builder
+	marked := false
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		text := html.EscapeString(string(word))
+		if wordMatches(strings.ToLower(string(word)), terms) {
+			out.WriteString("<mark>" + text + "</mark>")
+			marked = true
+		} else {
+			out.WriteString(text)
+		}
+		word = word[:0]
+	}
+	for _, r := range value {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		out.WriteString(html.EscapeString(string(r)))
+	}
+	flush()
+	return out.String(), marked
+}
+
+func wordMatches(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.Contains(word, term) || trigramSimilarity(word, term) >= highlightSimilarity {
+			return true
+		}
+	}
+	return false
+}
+
+// trigramSimilarity compares two words as pg_trgm's similarity does: the share of
+// their trigrams, with the word padded by two spaces in front and one behind, that
+// they have in common
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	common := 0
+	for t := range ta {
+		if tb[t] {
+			common++
+		}
+	}
+	union := len(ta) + len(tb) - common
+	if union == 0 {
+		return 0
+	}
+	return float64(common) / float64(union)
+}
+
+func trigrams(word string) map[string]bool {
+	padded := []rune("  " + word + " ")
+	set := make(map[string]bool, len(padded))
+	for i := 0; i+3 <= len(padded); i++ {
+		set[string(padded[i:i+3])] = true
+	}
+	return set
+}
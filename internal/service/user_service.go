@@ -0,0 +1,747 @@
+package service
+
+import (
+	"api/internal/auth"
+	"api/internal/i18n"
+	"api/internal/models"
+	"api/internal/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ProfileUpdate holds the editable profile fields
+type ProfileUpdate struct {
+	FirstName string
+	LastName  string
+	Bio       string
+	AvatarURL string
+	Locale    string // empty clears the preference
+	// Identity fields; lengths are checked by the handlers
+	PreferredName string
+	Pronouns      string
+	Honorific     string
+	Timezone      string            // IANA name, empty clears it
+	Visibility    map[string]string // per-field directory visibility, nil keeps the current settings
+}
+
+// UserUpdate holds the admin editable user fields
+type UserUpdate struct {
+	Email         string
+	Username      string
+	Role          string
+	EmailVerified bool
+	Profile       ProfileUpdate
+}
+
+// UserWithProfile pairs a user with their (possibly empty) profile
+type UserWithProfile struct {
+	User    models.User
+	Profile models.UserProfile
+}
+
+// UserService implements self-service account management and admin user operations
+type UserService interface {
+	GetProfile(userID uint) (*models.User, *models.UserProfile, error)
+	UpdateProfile(userID uint, update ProfileUpdate) (*models.UserProfile, error)
+	// Regional returns the user's stored locale and timezone, "" for those not chosen
+	Regional(userID uint) (locale, timezone string, err error)
+	// SetAvatar points the profile at an uploaded avatar and returns the key it replaced
+	SetAvatar(userID uint, key, url string) (*models.UserProfile, string, error)
+	// ChangePassword updates the password and, when configured, ends every session except
+	// currentSession. It returns the number of sessions that were terminated.
+	ChangePassword(userID uint, currentPassword, newPassword, currentSession string) (int, error)
+	ListUsers() ([]UserWithProfile, error)
+	// ListOrganizationUsers lists the members of an organization
+	ListOrganizationUsers(orgID uint) ([]UserWithProfile, error)
+	// FilterUsers lists the users with the given custom attribute values, in the form
+	// returned by AttributeService.Filter; a non-zero orgID keeps only its members
+	FilterUsers(orgID uint, attributes map[string]string) ([]UserWithProfile, error)
+	// ListUsersPage returns up to limit users with IDs above afterID, in ID order, so the
+	// list can be paged through; a non-zero orgID keeps only its members
+	ListUsersPage(orgID, afterID uint, limit int) ([]UserWithProfile, error)
+	// FilterUsersPage is ListUsersPage keeping the users with role, unless it is empty,
+	// and the custom attribute values, in the form returned by AttributeService.Filter
+	FilterUsersPage(orgID uint, role string, attributes map[string]string, afterID uint, limit int) ([]UserWithProfile, error)
+	// Search returns up to limit users whose email, username or name match query, even
+	// when misspelled, most relevant first. A non-zero orgID limits the search to the
+	// organization's members.
+	Search(query string, orgID uint, limit int) ([]UserSearchHit, error)
+	// Directory lists verified users for the user directory; callers show only the
+	// fields ProfileVisibility marks public
+	Directory() ([]UserWithProfile, error)
+	ChangeRole(userID uint, role string) (*models.User, error)
+	// UpdateUser overwrites the user's editable fields and profile (admin only)
+	UpdateUser(userID uint, update UserUpdate) (*UserWithProfile, error)
+	// RevokeAllSessions signs the user out everywhere on behalf of adminID: every refresh
+	// token is deleted and access tokens issued so far are revoked. It returns the number
+	// of sessions ended.
+	RevokeAllSessions(userID, adminID uint, notify bool) (int, error)
+	// Suspend suspends or bans the user on behalf of adminID and ends all their sessions
+	Suspend(userID, adminID uint, input SuspendInput) (*models.User, error)
+	// Reinstate returns a suspended, banned, deactivated or pending deletion user to active
+	Reinstate(userID, adminID uint) (*models.User, error)
+	// AccountStatus returns the effective status of the user's account
+	AccountStatus(userID uint) (string, error)
+	// LiftExpiredSuspensions reactivates accounts whose temporary suspension has ended
+	LiftExpiredSuspensions(now time.Time)
+	// ListDeleted returns the soft deleted users, most recently deleted first
+	ListDeleted() ([]models.User, error)
+	// Restore undeletes a soft deleted user on behalf of adminID. The user's sessions
+	// are not restored; they sign in again.
+	Restore(userID, adminID uint) (*models.User, error)
+	// VerifyEmail marks the user's email address as verified on behalf of adminID
+	VerifyEmail(userID, adminID uint) (*models.User, error)
+	// ProfileCompleteness scores how much of the profile is filled in
+	ProfileCompleteness(profile *models.UserProfile) ProfileCompleteness
+	// IncompleteProfiles lists the active users whose profile scores below the threshold,
+	// or the configured one when it is 0, least complete first. A non-zero orgID keeps
+	// only its members.
+	IncompleteProfiles(orgID uint, threshold int) (*IncompleteProfilesReport, error)
+}
+
+// IncompleteProfile is a user listed by the incomplete profiles report
+type IncompleteProfile struct {
+	UserWithProfile
+	Completeness ProfileCompleteness
+}
+
+// IncompleteProfilesReport lists the users whose profile scores below Threshold
+type IncompleteProfilesReport struct {
+	Threshold int
+	Users     []IncompleteProfile
+}
+
+// SuspendInput describes a suspension; Until is only allowed for temporary suspensions
+type SuspendInput struct {
+	Ban    bool
+	Reason string
+	Until  *time.Time
+}
+
+// UserServiceConfig holds the account security and profile settings of the user service
+type UserServiceConfig struct {
+	RevokeSessionsOnPasswordChange bool
+	Completeness                   *CompletenessScorer
+	// CompletenessThreshold is the score below which the incomplete profiles report
+	// lists users by default
+	CompletenessThreshold int
+}
+
+type userService struct {
+	users         repository.UserRepository
+	tokens        repository.TokenRepository
+	audit         repository.AuditRepository
+	notifications NotificationService
+	revoker       TokenRevoker
+	passwords     PasswordValidator
+	config        UserServiceConfig
+	logger        *logrus.Logger
+}
+
+func NewUserService(users repository.UserRepository, tokens repository.TokenRepository, audit repository.AuditRepository, notifications NotificationService, revoker TokenRevoker, passwords PasswordValidator, config UserServiceConfig, logger *logrus.Logger) UserService {
+	return &userService{
+		users:         users,
+		tokens:        tokens,
+		audit:         audit,
+		notifications: notifications,
+		revoker:       revoker,
+		passwords:     passwords,
+		config:        config,
+		logger:        logger,
+	}
+}
+
+func (s *userService) findUser(userID uint) (*models.User, error) {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	return user, nil
+}
+
+// findProfile returns the user's profile, or an unsaved empty one if none exists yet
+func (s *userService) findProfile(userID uint) (*models.UserProfile, error) {
+	profile, err := s.users.FindProfile(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return &models.UserProfile{UserID: userID}, nil
+		}
+		return nil, fmt.Errorf("find profile: %w", err)
+	}
+	return profile, nil
+}
+
+// readProfile is findProfile for display, possibly read from a replica
+func (s *userService) readProfile(userID uint) (*models.UserProfile, error) {
+	profile, err := s.users.ReadProfile(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return &models.UserProfile{UserID: userID}, nil
+		}
+		return nil, fmt.Errorf("find profile: %w", err)
+	}
+	return profile, nil
+}
+
+func (s *userService) GetProfile(userID uint) (*models.User, *models.UserProfile, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	profile, err := s.readProfile(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, profile, nil
+}
+
+func (s *userService) UpdateProfile(userID uint, update ProfileUpdate) (*models.UserProfile, error) {
+	profile, err := s.findProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyProfileUpdate(profile, update); err != nil {
+		return nil, err
+	}
+
+	if err := s.users.SaveProfile(profile); err != nil {
+		return nil, fmt.Errorf("save profile: %w", err)
+	}
+	return profile, nil
+}
+
+func (s *userService) Regional(userID uint) (string, string, error) {
+	profile, err := s.findProfile(userID)
+	if err != nil {
+		return "", "", err
+	}
+	return profile.Locale, profile.Timezone, nil
+}
+
+// applyProfileUpdate validates update and copies it onto profile
+func applyProfileUpdate(profile *models.UserProfile, update ProfileUpdate) error {
+	locale, err := normalizeLocale(update.Locale)
+	if err != nil {
+		return err
+	}
+	timezone, err := normalizeTimezone(update.Timezone)
+	if err != nil {
+		return err
+	}
+	if err := applyVisibility(profile, update.Visibility); err != nil {
+		return err
+	}
+
+	profile.FirstName = update.FirstName
+	profile.LastName = update.LastName
+	profile.Bio = models.EncryptedString(update.Bio)
+	profile.AvatarURL = update.AvatarURL
+	profile.Locale = locale
+	profile.PreferredName = models.EncryptedString(update.PreferredName)
+	profile.Pronouns = models.EncryptedString(update.Pronouns)
+	profile.Honorific = update.Honorific
+	profile.Timezone = timezone
+	return nil
+}
+
+// normalizeLocale maps a requested locale to its supported form; "" is kept as "no preference"
+func normalizeLocale(locale string) (string, error) {
+	if locale == "" {
+		return "", nil
+	}
+	normalized := i18n.Normalize(locale)
+	if normalized == "" {
+		return "", ErrUnsupportedLocale
+	}
+	return normalized, nil
+}
+
+func (s *userService) SetAvatar(userID uint, key, url string) (*models.UserProfile, string, error) {
+	if _, err := s.findUser(userID); err != nil {
+		return nil, "", err
+	}
+
+	profile, err := s.findProfile(userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	previousKey := profile.AvatarKey
+	profile.AvatarKey = key
+	profile.AvatarURL = url
+
+	if err := s.users.SaveProfile(profile); err != nil {
+		return nil, "", fmt.Errorf("save profile: %w", err)
+	}
+	return profile, previousKey, nil
+}
+
+func (s *userService) ChangePassword(userID uint, currentPassword, newPassword, currentSession string) (int, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return 0, err
+	}
+	if user.ExternallyManaged() {
+		return 0, ErrExternalPassword
+	}
+
+	if err := auth.ComparePasswords(user.PasswordHash, currentPassword); err != nil {
+		return 0, ErrIncorrectPassword
+	}
+	now := time.Now()
+	if err := s.passwords.CheckMinAge(user, now); err != nil {
+		return 0, err
+	}
+	if err := s.passwords.Validate(newPassword, user); err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := auth.HashPassword(newPassword)
+	if err != nil {
+		return 0, fmt.Errorf("hash password: %w", err)
+	}
+
+	user.PasswordHash = hashedPassword
+	user.PasswordChangedAt = &now
+	user.PasswordChangeRequired = false
+	if err := s.users.Save(user); err != nil {
+		return 0, fmt.Errorf("save user: %w", err)
+	}
+	s.passwords.Remember(user)
+
+	// Access tokens issued with the old password must not outlive it
+	if err := s.revoker.RevokeUser(userID); err != nil {
+		return 0, fmt.Errorf("revoke access tokens: %w", err)
+	}
+
+	// Other devices may still be signed in, possibly by whoever learned the old password
+	sessions, err := s.tokens.ListActive(userID)
+	if err != nil {
+		return 0, fmt.Errorf("list sessions: %w", err)
+	}
+	var otherDevices []string
+	for _, session := range sessions {
+		if session.FamilyID != currentSession {
+			otherDevices = append(otherDevices, fmt.Sprintf("%s (%s)", session.UserAgent, session.IPAddress))
+		}
+	}
+
+	terminated := 0
+	if s.config.RevokeSessionsOnPasswordChange && len(otherDevices) > 0 {
+		terminated, err = s.tokens.DeleteFamiliesExcept(userID, currentSession)
+		if err != nil {
+			return 0, fmt.Errorf("revoke sessions: %w", err)
+		}
+	}
+
+	s.notifications.PasswordChanged(user, otherDevices)
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    userID,
+		"devices":    otherDevices,
+		"terminated": terminated,
+	}).Info("Password changed successfully")
+	return terminated, nil
+}
+
+func (s *userService) ListUsers() ([]UserWithProfile, error) {
+	users, err := s.users.List()
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	return s.withProfiles(users)
+}
+
+func (s *userService) ListOrganizationUsers(orgID uint) ([]UserWithProfile, error) {
+	users, err := s.users.ListByOrganization(orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list organization users: %w", err)
+	}
+	return s.withProfiles(users)
+}
+
+func (s *userService) FilterUsers(orgID uint, attributes map[string]string) ([]UserWithProfile, error) {
+	users, err := s.users.ListFiltered(repository.UserListFilter{OrganizationID: orgID, Attributes: attributes})
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	return s.withProfiles(users)
+}
+
+func (s *userService) ListUsersPage(orgID, afterID uint, limit int) ([]UserWithProfile, error) {
+	users, err := s.users.ListPage(repository.UserListFilter{OrganizationID: orgID}, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	return s.withProfiles(users)
+}
+
+func (s *userService) FilterUsersPage(orgID uint, role string, attributes map[string]string, afterID uint, limit int) ([]UserWithProfile, error) {
+	filter := repository.UserListFilter{OrganizationID: orgID, Role: role, Attributes: attributes}
+	users, err := s.users.ListPage(filter, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	return s.withProfiles(users)
+}
+
+// ProfileBatch is the number of profiles the user listings load per query, well below
+// the bind parameter limits of Postgres and MySQL (65535) and SQLite (32766)
+const ProfileBatch = 5000
+
+// withProfiles loads the profiles of the users a batch at a time; users without one get
+// an empty profile
+func (s *userService) withProfiles(users []models.User) ([]UserWithProfile, error) {
+	result := make([]UserWithProfile, len(users))
+	index := make(map[uint]int, len(users))
+	for i, user := range users {
+		result[i] = UserWithProfile{User: user, Profile: models.UserProfile{UserID: user.ID}}
+		index[user.ID] = i
+	}
+	for start := 0; start < len(users); start += ProfileBatch {
+		batch := users[start:min(start+ProfileBatch, len(users))]
+		ids := make([]uint, len(batch))
+		for i, user := range batch {
+			ids[i] = user.ID
+		}
+		profiles, err := s.users.FindProfiles(ids)
+		if err != nil {
+			return nil, fmt.Errorf("find profiles: %w", err)
+		}
+		for _, profile := range profiles {
+			result[index[profile.UserID]].Profile = profile
+		}
+	}
+	return result, nil
+}
+
+func (s *userService) Directory() ([]UserWithProfile, error) {
+	users, err := s.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	verified := users[:0]
+	for _, u := range users {
+		if u.User.EmailVerified {
+			verified = append(verified, u)
+		}
+	}
+	return verified, nil
+}
+
+func (s *userService) ChangeRole(userID uint, role string) (*models.User, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	previousRole := user.Role
+	user.Role = role
+	if err := s.users.Save(user); err != nil {
+		return nil, fmt.Errorf("save user: %w", err)
+	}
+	if role != previousRole {
+		// Access tokens carry the role; sessions get tokens with the new one on refresh
+		if err := s.revoker.RevokeUser(userID); err != nil {
+			return nil, fmt.Errorf("revoke access tokens: %w", err)
+		}
+		s.notifications.RoleChanged(user, previousRole)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"new_role": role,
+	}).Info("User role updated")
+
+	return user, nil
+}
+
+func (s *userService) UpdateUser(userID uint, update UserUpdate) (*UserWithProfile, error) {
+	user, profile, err := s.GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+	// Validate the profile before anything is saved
+	if err := applyProfileUpdate(profile, update.Profile); err != nil {
+		return nil, err
+	}
+
+	previousRole, wasVerified := user.Role, user.EmailVerified
+	user.Email = update.Email
+	user.Username = update.Username
+	user.Role = update.Role
+	user.EmailVerified = update.EmailVerified
+	if err := s.users.Save(user); err != nil {
+		if conflict := userConflict(err); conflict != nil {
+			return nil, conflict
+		}
+		return nil, fmt.Errorf("save user: %w", err)
+	}
+	if user.Role != previousRole {
+		if err := s.revoker.RevokeUser(userID); err != nil {
+			return nil, fmt.Errorf("revoke access tokens: %w", err)
+		}
+		s.notifications.RoleChanged(user, previousRole)
+	}
+	if user.EmailVerified && !wasVerified {
+		s.notifications.Welcome(user)
+	}
+
+	if err := s.users.SaveProfile(profile); err != nil {
+		return nil, fmt.Errorf("save profile: %w", err)
+	}
+
+	s.logger.WithField("user_id", userID).Info("User updated by admin")
+	return &UserWithProfile{User: *user, Profile: *profile}, nil
+}
+
+func (s *userService) RevokeAllSessions(userID, adminID uint, notify bool) (int, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	sessions, err := s.tokens.ListActive(userID)
+	if err != nil {
+		return 0, fmt.Errorf("list sessions: %w", err)
+	}
+	if err := s.tokens.DeleteByUser(userID); err != nil {
+		return 0, fmt.Errorf("delete refresh tokens: %w", err)
+	}
+	if err := s.revoker.RevokeUser(userID); err != nil {
+		return 0, fmt.Errorf("revoke access tokens: %w", err)
+	}
+
+	changes, err := json.Marshal(map[string]interface{}{
+		"sessions": map[string]int{"from": len(sessions), "to": 0},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := s.audit.Create(&models.AuditEntry{
+		Entity:   "user",
+		EntityID: userID,
+		UserID:   userID,
+		ActorID:  &adminID,
+		Action:   "revoke_sessions",
+		Changes:  string(changes),
+	}); err != nil {
+		return 0, fmt.Errorf("write audit entry: %w", err)
+	}
+
+	if notify {
+		s.notifications.SessionsRevoked(user)
+	}
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"admin_id": adminID,
+		"sessions": len(sessions),
+		"notified": notify,
+	}).Warn("All sessions revoked by admin")
+	return len(sessions), nil
+}
+
+func (s *userService) Suspend(userID, adminID uint, input SuspendInput) (*models.User, error) {
+	if userID == adminID {
+		return nil, fmt.Errorf("%w: cannot suspend your own account", ErrInvalidSuspension)
+	}
+	if input.Ban && input.Until != nil {
+		return nil, fmt.Errorf("%w: bans cannot expire", ErrInvalidSuspension)
+	}
+	now := time.Now()
+	if input.Until != nil && !input.Until.After(now) {
+		return nil, fmt.Errorf("%w: expiry must be in the future", ErrInvalidSuspension)
+	}
+
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	user.Status = models.UserStatusSuspended
+	if input.Ban {
+		user.Status = models.UserStatusBanned
+	}
+	user.SuspensionReason = input.Reason
+	user.SuspendedAt = &now
+	user.SuspendedUntil = input.Until
+	if err := s.users.SaveAs(user, adminID); err != nil {
+		return nil, fmt.Errorf("save user: %w", err)
+	}
+
+	if err := s.tokens.DeleteByUser(userID); err != nil {
+		return nil, fmt.Errorf("delete refresh tokens: %w", err)
+	}
+	if err := s.revoker.RevokeUser(userID); err != nil {
+		return nil, fmt.Errorf("revoke access tokens: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"admin_id": adminID,
+		"status":   user.Status,
+		"until":    input.Until,
+	}).Warn("User account suspended")
+	return user, nil
+}
+
+func (s *userService) VerifyEmail(userID, adminID uint) (*models.User, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.EmailVerified {
+		return user, nil
+	}
+	user.EmailVerified = true
+	if err := s.users.SaveAs(user, adminID); err != nil {
+		return nil, fmt.Errorf("save user: %w", err)
+	}
+	s.notifications.Welcome(user)
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"admin_id": adminID,
+	}).Info("Email address verified by admin")
+	return user, nil
+}
+
+func (s *userService) Reinstate(userID, adminID uint) (*models.User, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status == models.UserStatusActive {
+		return user, nil
+	}
+	user.Status = models.UserStatusActive
+	user.SuspensionReason = ""
+	user.SuspendedAt = nil
+	user.SuspendedUntil = nil
+	user.DeactivatedAt = nil
+	user.DeletionScheduledAt = nil
+	if err := s.users.SaveAs(user, adminID); err != nil {
+		return nil, fmt.Errorf("save user: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"admin_id": adminID,
+	}).Info("User account reinstated")
+	return user, nil
+}
+
+func (s *userService) AccountStatus(userID uint) (string, error) {
+	user, err := s.findUser(userID)
+	if err != nil {
+		return "", err
+	}
+	return user.AccountStatus(time.Now()), nil
+}
+
+func (s *userService) LiftExpiredSuspensions(now time.Time) {
+	lifted, err := s.users.LiftExpiredSuspensions(now)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to lift expired suspensions")
+		return
+	}
+	if lifted > 0 {
+		s.logger.WithField("count", lifted).Info("Lifted expired suspensions")
+	}
+}
+
+func (s *userService) ListDeleted() ([]models.User, error) {
+	users, err := s.users.ListDeleted()
+	if err != nil {
+		return nil, fmt.Errorf("list deleted users: %w", err)
+	}
+	return users, nil
+}
+
+func (s *userService) Restore(userID, adminID uint) (*models.User, error) {
+	user, err := s.users.FindIncludingDeleted(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+	if user.DeletedAt == nil {
+		return nil, ErrUserNotDeleted
+	}
+	deletedAt := *user.DeletedAt
+
+	if err := s.users.RestoreAccount(userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrUserNotDeleted
+		}
+		return nil, fmt.Errorf("restore user: %w", err)
+	}
+	user.DeletedAt = nil
+
+	changes, err := json.Marshal(map[string]interface{}{
+		"deletedAt": map[string]interface{}{"from": deletedAt, "to": nil},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit.Create(&models.AuditEntry{
+		Entity:   "user",
+		EntityID: userID,
+		UserID:   userID,
+		ActorID:  &adminID,
+		Action:   "restore",
+		Changes:  string(changes),
+	}); err != nil {
+		return nil, fmt.Errorf("write audit entry: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  userID,
+		"admin_id": adminID,
+	}).Info("Deleted user restored")
+	return user, nil
+}
+
+func (s *userService) ProfileCompleteness(profile *models.UserProfile) ProfileCompleteness {
+	return s.config.Completeness.Score(profile)
+}
+
+func (s *userService) IncompleteProfiles(orgID uint, threshold int) (*IncompleteProfilesReport, error) {
+	if threshold == 0 {
+		threshold = s.config.CompletenessThreshold
+	}
+	var users []UserWithProfile
+	var err error
+	if orgID != 0 {
+		users, err = s.ListOrganizationUsers(orgID)
+	} else {
+		users, err = s.ListUsers()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	report := &IncompleteProfilesReport{Threshold: threshold, Users: []IncompleteProfile{}}
+	for _, user := range users {
+		if user.User.AccountStatus(now) != models.UserStatusActive {
+			continue
+		}
+		completeness := s.config.Completeness.Score(&user.Profile)
+		if completeness.Score < threshold {
+			report.Users = append(report.Users, IncompleteProfile{UserWithProfile: user, Completeness: completeness})
+		}
+	}
+	sort.SliceStable(report.Users, func(i, j int) bool {
+		return report.Users[i].Completeness.Score < report.Users[j].Completeness.Score
+	})
+	return report, nil
+}
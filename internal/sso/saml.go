@@ -0,0 +1,300 @@
+// Package sso signs users in through SAML 2.0 identity providers. This service is the
+// service provider: it publishes metadata per identity provider, redirects browsers to
+// the provider with an authentication request and validates the assertion posted back.
+package sso
+
+import (
+	"api/internal/telemetry"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown identity provider")
+	ErrInvalidAssertion = errors.New("invalid SAML response")
+)
+
+// maxMetadataSize bounds identity provider metadata fetched at startup
+const maxMetadataSize = 1 << 20
+
+// GroupRole grants Role to users whose groups attribute contains Group
+type GroupRole struct {
+	Group string
+	Role  string
+}
+
+// ProviderConfig describes one identity provider and how its attributes map to users
+type ProviderConfig struct {
+	Name              string // path segment identifying the provider
+	MetadataURL       string // fetched once at startup
+	MetadataFile      string // used instead of MetadataURL when set
+	EmailAttribute    string // falls back to the NameID when it is an email address
+	UsernameAttribute string // the local part of the email when empty or missing
+	GroupsAttribute   string
+	GroupRoles        []GroupRole // first match wins
+	DefaultRole       string
+}
+
+// Config configures the service provider side shared by all identity providers
+type Config struct {
+	// BaseURL is the public URL the provider endpoints are served under; a provider's
+	// metadata is at BaseURL/<name>/metadata and its ACS at BaseURL/<name>/acs
+	BaseURL         string
+	CertificateFile string // optional; with PrivateKeyFile, signs requests and decrypts assertions
+	PrivateKeyFile  string
+	Providers       []ProviderConfig
+	Timeout         time.Duration // metadata fetch timeout
+}
+
+// Identity is the user an identity provider vouched for
+type Identity struct {
+	Provider string
+	Subject  string // NameID, which the user is bound to
+	Email    string
+	Username string
+	Groups   []string
+	Role     string
+}
+
+// Provider is the service provider configured for one identity provider
+type Provider struct {
+	sp  *saml.ServiceProvider
+	cfg ProviderConfig
+}
+
+// Registry holds the configured identity providers by name
+type Registry struct {
+	providers map[string]*Provider
+}
+
+func NewRegistry(cfg Config) (*Registry, error) {
+	registry := &Registry{providers: make(map[string]*Provider)}
+	if len(cfg.Providers) == 0 {
+		return registry, nil
+	}
+	base, err := url.Parse(strings.TrimSuffix(cfg.BaseURL, "/"))
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("saml: invalid base URL %q", cfg.BaseURL)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	client := &http.Client{Timeout: cfg.Timeout, Transport: telemetry.Transport(nil)}
+
+	var key *rsa.PrivateKey
+	var certificate *x509.Certificate
+	if cfg.CertificateFile != "" || cfg.PrivateKeyFile != "" {
+		pair, err := tls.LoadX509KeyPair(cfg.CertificateFile, cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("saml: load key pair: %w", err)
+		}
+		var ok bool
+		if key, ok = pair.PrivateKey.(*rsa.PrivateKey); !ok {
+			return nil, errors.New("saml: the service provider key must be an RSA key")
+		}
+		if certificate, err = x509.ParseCertificate(pair.Certificate[0]); err != nil {
+			return nil, fmt.Errorf("saml: parse certificate: %w", err)
+		}
+	}
+
+	for _, provider := range cfg.Providers {
+		if provider.Name == "" || strings.ContainsAny(provider.Name, "/?#") {
+			return nil, fmt.Errorf("saml: invalid provider name %q", provider.Name)
+		}
+		if _, ok := registry.providers[provider.Name]; ok {
+			return nil, fmt.Errorf("saml: duplicate provider %q", provider.Name)
+		}
+		metadata, err := loadMetadata(client, provider)
+		if err != nil {
+			return nil, fmt.Errorf("saml: provider %s: %w", provider.Name, err)
+		}
+		if provider.EmailAttribute == "" {
+			provider.EmailAttribute = "email"
+		}
+		if provider.DefaultRole == "" {
+			provider.DefaultRole = "user"
+		}
+
+		metadataURL := *base.JoinPath(provider.Name, "metadata")
+		acsURL := *base.JoinPath(provider.Name, "acs")
+		sp := &saml.ServiceProvider{
+			Key:               key,
+			Certificate:       certificate,
+			HTTPClient:        client,
+			MetadataURL:       metadataURL,
+			AcsURL:            acsURL,
+			IDPMetadata:       metadata,
+			AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+		}
+		if key != nil {
+			sp.SignatureMethod = dsig.RSASHA256SignatureMethod
+		}
+		registry.providers[provider.Name] = &Provider{sp: sp, cfg: provider}
+	}
+	return registry, nil
+}
+
+// loadMetadata reads the identity provider's entity descriptor
+func loadMetadata(client *http.Client, cfg ProviderConfig) (*saml.EntityDescriptor, error) {
+	var data []byte
+	var err error
+	switch {
+	case cfg.MetadataFile != "":
+		data, err = os.ReadFile(cfg.MetadataFile)
+	case cfg.MetadataURL != "":
+		var resp *http.Response
+		resp, err = client.Get(cfg.MetadataURL)
+		if err != nil {
+			return nil, fmt.Errorf("fetch metadata: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetch metadata: %s", resp.Status)
+		}
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	default:
+		return nil, errors.New("metadataURL or metadataFile is required")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read metadata: %w", err)
+	}
+
+	metadata := &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(data, metadata); err != nil {
+		return nil, fmt.Errorf("parse metadata: %w", err)
+	}
+	if len(metadata.IDPSSODescriptors) == 0 {
+		return nil, errors.New("metadata does not describe an identity provider")
+	}
+	return metadata, nil
+}
+
+// Provider returns the identity provider called name
+func (r *Registry) Provider(name string) (*Provider, error) {
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// Metadata returns the service provider metadata to register with the identity provider
+func (p *Provider) Metadata() ([]byte, error) {
+	data, err := xml.MarshalIndent(p.sp.Metadata(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// AuthnRequest returns the identity provider URL to redirect the browser to and the ID
+// of the request, which the response has to answer
+func (p *Provider) AuthnRequest() (string, string, error) {
+	location := p.sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if location == "" {
+		return "", "", errors.New("saml: identity provider has no HTTP-Redirect sign-on endpoint")
+	}
+	request, err := p.sp.MakeAuthenticationRequest(location, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", "", err
+	}
+	redirect, err := request.Redirect("", p.sp)
+	if err != nil {
+		return "", "", err
+	}
+	return redirect.String(), request.ID, nil
+}
+
+// Identity validates the SAML response posted to the ACS: the signature against the
+// identity provider's certificates, issuer, audience, recipient, validity window and
+// that it answers requestID. Unsolicited (IdP-initiated) responses are rejected.
+func (p *Provider) Identity(r *http.Request, requestID string) (*Identity, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAssertion, err)
+	}
+	assertion, err := p.sp.ParseResponse(r, []string{requestID})
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAssertion, invalid.PrivateErr)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAssertion, err)
+	}
+
+	identity := &Identity{Provider: p.cfg.Name}
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		identity.Subject = strings.TrimSpace(assertion.Subject.NameID.Value)
+	}
+	// Users are found by the NameID, the email only offers to link an existing account
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%w: no NameID", ErrInvalidAssertion)
+	}
+	identity.Email = p.attribute(assertion, p.cfg.EmailAttribute)
+	if identity.Email == "" && strings.Contains(identity.Subject, "@") {
+		identity.Email = identity.Subject
+	}
+	if identity.Email == "" {
+		return nil, fmt.Errorf("%w: no email address for %q", ErrInvalidAssertion, identity.Subject)
+	}
+	if p.cfg.UsernameAttribute != "" {
+		identity.Username = p.attribute(assertion, p.cfg.UsernameAttribute)
+	}
+	if identity.Username == "" {
+		identity.Username, _, _ = strings.Cut(identity.Email, "@")
+	}
+	if p.cfg.GroupsAttribute != "" {
+		identity.Groups = p.attributeValues(assertion, p.cfg.GroupsAttribute)
+	}
+	identity.Role = p.role(identity.Groups)
+	return identity, nil
+}
+
+// attribute returns the first value of the attribute with the given name or friendly name
+func (p *Provider) attribute(assertion *saml.Assertion, name string) string {
+	if values := p.attributeValues(assertion, name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (p *Provider) attributeValues(assertion *saml.Assertion, name string) []string {
+	var values []string
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if attribute.Name != name && attribute.FriendlyName != name {
+				continue
+			}
+			for _, value := range attribute.Values {
+				if v := strings.TrimSpace(value.Value); v != "" {
+					values = append(values, v)
+				}
+			}
+		}
+	}
+	return values
+}
+
+// role returns the role of the first GroupRoles entry matching one of groups
+func (p *Provider) role(groups []string) string {
+	for _, mapping := range p.cfg.GroupRoles {
+		for _, group := range groups {
+			if strings.EqualFold(group, mapping.Group) {
+				return mapping.Role
+			}
+		}
+	}
+	return p.cfg.DefaultRole
+}
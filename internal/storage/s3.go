@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"api/internal/awssig"
+	"api/internal/telemetry"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3 compatible bucket
+type S3Config struct {
+	Bucket          string
+	Region          string
+	Endpoint        string // optional, for S3 compatible services such as MinIO
+	AccessKeyID     string
+	SecretAccessKey string
+	UsePathStyle    bool
+}
+
+// S3Storage talks to S3 using signature version 4 signed requests
+type S3Storage struct {
+	cfg    S3Config
+	creds  awssig.Credentials
+	client *http.Client
+}
+
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	if cfg.Bucket == "" || cfg.Region == "" {
+		return nil, errors.New("s3 storage requires bucket and region")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("s3 storage requires access credentials")
+	}
+	return &S3Storage{
+		cfg: cfg,
+		creds: awssig.Credentials{
+			AccessKeyID:     cfg.AccessKeyID,
+			SecretAccessKey: cfg.SecretAccessKey,
+			Region:          cfg.Region,
+			Service:         "s3",
+		},
+		client: &http.Client{Timeout: 30 * time.Second, Transport: telemetry.Transport(nil)},
+	}, nil
+}
+
+// objectURL returns the URL of key in the bucket
+func (s *S3Storage) objectURL(key string) *url.URL {
+	key = strings.TrimPrefix(key, "/")
+	u := &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", s.cfg.Bucket, s.cfg.Region)}
+	if s.cfg.UsePathStyle {
+		u.Host = fmt.Sprintf("s3.%s.amazonaws.com", s.cfg.Region)
+	}
+	if s.cfg.Endpoint != "" {
+		if endpoint, err := url.Parse(s.cfg.Endpoint); err == nil {
+			u.Scheme = endpoint.Scheme
+			u.Host = endpoint.Host
+			if !s.cfg.UsePathStyle {
+				u.Host = s.cfg.Bucket + "." + endpoint.Host
+			}
+		}
+	}
+
+	u.Path = "/" + key
+	u.RawPath = "/" + awssig.EncodePath(key)
+	if s.cfg.UsePathStyle {
+		u.Path = "/" + s.cfg.Bucket + u.Path
+		u.RawPath = "/" + awssig.URIEncode(s.cfg.Bucket) + u.RawPath
+	}
+	return u
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", contentType)
+	s.creds.SignRequest(req, awssig.SHA256Hex(body), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("s3 put %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	s.creds.SignRequest(req, awssig.SHA256Hex(nil), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, "", ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("s3 get %s: %s", key, resp.Status)
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+	s.creds.SignRequest(req, awssig.SHA256Hex(nil), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("s3 delete %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+// SignedURL returns a presigned GET URL for key valid for expiry
+func (s *S3Storage) SignedURL(key string, expiry time.Duration) (string, error) {
+	if expiry <= 0 || expiry > 7*24*time.Hour {
+		return "", errors.New("signed URL expiry must be between 1s and 7 days")
+	}
+
+	now := time.Now().UTC()
+	u := s.objectURL(key)
+	amzDate := now.Format("20060102T150405Z")
+	scope := s.creds.Scope(now)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.cfg.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", int(expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.RawPath,
+		awssig.CanonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	query.Set("X-Amz-Signature", s.creds.Signature(now, canonicalRequest))
+	u.RawQuery = awssig.CanonicalQuery(query)
+	return u.String(), nil
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when an object does not exist in the backend
+var ErrNotFound = errors.New("object not found")
+
+// Storage is a minimal blob store used for user uploaded media
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get returns the object content and its content type
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// URLSigner is implemented by backends that can hand out time limited direct links,
+// letting clients download objects without the bucket being public
+type URLSigner interface {
+	SignedURL(key string, expiry time.Duration) (string, error)
+}
+
+// Config selects and configures a storage backend
+type Config struct {
+	Backend  string // local or s3
+	LocalDir string
+	S3       S3Config
+}
+
+// New creates the backend selected in cfg
+func New(cfg Config) (Storage, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocalStorage(cfg.LocalDir)
+	case "s3":
+		return NewS3Storage(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,71 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const gormSpanKey = "telemetry:span"
+
+// InstrumentGORM records a span for every create, query, update, delete and raw
+// query. GORM v1 has no context API, so these spans start their own traces instead
+// of joining the request's.
+func InstrumentGORM(db *gorm.DB) {
+	tracer := Tracer("api/gorm")
+	before := func(operation string) func(*gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			_, span := tracer.Start(context.Background(), "gorm."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					dbSystem(scope.Dialect().GetName()),
+					semconv.DBOperationName(operation),
+				))
+			scope.InstanceSet(gormSpanKey, span)
+		}
+	}
+	after := func(scope *gorm.Scope) {
+		value, ok := scope.InstanceGet(gormSpanKey)
+		if !ok {
+			return
+		}
+		span := value.(trace.Span)
+		span.SetAttributes(
+			semconv.DBQueryText(scope.SQL),
+			semconv.DBCollectionName(scope.TableName()),
+			attribute.Int64("db.rows_affected", scope.DB().RowsAffected),
+		)
+		if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+
+	callbacks := db.Callback()
+	callbacks.Create().Before("gorm:begin_transaction").Register("telemetry:before_create", before("create"))
+	callbacks.Create().After("gorm:commit_or_rollback_transaction").Register("telemetry:after_create", after)
+	callbacks.Query().Before("gorm:query").Register("telemetry:before_query", before("query"))
+	callbacks.Query().After("gorm:after_query").Register("telemetry:after_query", after)
+	callbacks.Update().Before("gorm:begin_transaction").Register("telemetry:before_update", before("update"))
+	callbacks.Update().After("gorm:commit_or_rollback_transaction").Register("telemetry:after_update", after)
+	callbacks.Delete().Before("gorm:begin_transaction").Register("telemetry:before_delete", before("delete"))
+	callbacks.Delete().After("gorm:commit_or_rollback_transaction").Register("telemetry:after_delete", after)
+	callbacks.RowQuery().Before("gorm:row_query").Register("telemetry:before_row_query", before("row_query"))
+	callbacks.RowQuery().After("gorm:row_query").Register("telemetry:after_row_query", after)
+}
+
+// dbSystem names the database of a GORM dialect
+func dbSystem(dialect string) attribute.KeyValue {
+	switch dialect {
+	case "mysql":
+		return semconv.DBSystemMySQL
+	case "sqlite3":
+		return semconv.DBSystemSqlite
+	}
+	return semconv.DBSystemPostgreSQL
+}
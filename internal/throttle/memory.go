@@ -0,0 +1,76 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	count   int64
+	expires time.Time
+}
+
+// MemoryStore keeps the counts in process, so each instance throttles on its own
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	// expired entries are dropped when the map grows past pruneAt
+	pruneAt int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}, pruneAt: 1024}
+}
+
+func (s *MemoryStore) Incr(_ context.Context, key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := s.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		if !ok && len(s.entries) >= s.pruneAt {
+			s.prune(now)
+		}
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+	entry.count++
+	entry.expires = now.Add(ttl)
+	return entry.count, nil
+}
+
+func (s *MemoryStore) Counts(_ context.Context, keys ...string) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	counts := make([]int64, len(keys))
+	for i, key := range keys {
+		if entry, ok := s.entries[key]; ok && now.Before(entry.expires) {
+			counts[i] = entry.count
+		}
+	}
+	return counts, nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// prune drops expired entries. The next scan waits until the map doubles, so scans
+// stay rare while many clients are failing.
+func (s *MemoryStore) prune(now time.Time) {
+	for key, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+	s.pruneAt = max(1024, 2*len(s.entries))
+}
@@ -0,0 +1,259 @@
+package throttle
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// RedisConfig reaches the Redis server shared by all instances
+type RedisConfig struct {
+	Address   string // host:port
+	Username  string // Redis 6 ACL user; empty authenticates with the password alone
+	Password  string
+	DB        int
+	TLS       bool
+	KeyPrefix string
+	Timeout   time.Duration
+	PoolSize  int // idle connections kept open
+}
+
+// incrScript adds a failure and restarts the expiry in one round trip
+const incrScript = `local n = redis.call('INCR', KEYS[1]) redis.call('PEXPIRE', KEYS[1], ARGV[1]) return n`
+
+// RedisStore keeps the counts in Redis, so every instance throttles the same clients.
+// It speaks the subset of RESP the store needs over a small connection pool.
+type RedisStore struct {
+	cfg  RedisConfig
+	idle chan *redisConn
+}
+
+func NewRedisStore(cfg RedisConfig) (*RedisStore, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("redis address is required")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 2 * time.Second
+	}
+	if cfg.PoolSize <= 0 {
+		cfg.PoolSize = 8
+	}
+	s := &RedisStore{cfg: cfg, idle: make(chan *redisConn, cfg.PoolSize)}
+	// Fail at startup rather than on the first sign-in when the server is unreachable
+	if _, err := s.do(context.Background(), "PING"); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return s, nil
+}
+
+func (s *RedisStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	reply, err := s.do(ctx, "EVAL", incrScript, "1", s.cfg.KeyPrefix+key, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected reply %T to EVAL", reply)
+	}
+	return n, nil
+}
+
+func (s *RedisStore) Counts(ctx context.Context, keys ...string) ([]int64, error) {
+	args := make([]string, 0, len(keys)+1)
+	args = append(args, "MGET")
+	for _, key := range keys {
+		args = append(args, s.cfg.KeyPrefix+key)
+	}
+	reply, err := s.do(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != len(keys) {
+		return nil, errors.New("redis: unexpected reply to MGET")
+	}
+	counts := make([]int64, len(keys))
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		text, _ := value.(string)
+		if counts[i], err = strconv.ParseInt(text, 10, 64); err != nil {
+			return nil, fmt.Errorf("redis: count of %s: %w", keys[i], err)
+		}
+	}
+	return counts, nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	args := make([]string, 0, len(keys)+1)
+	args = append(args, "DEL")
+	for _, key := range keys {
+		args = append(args, s.cfg.KeyPrefix+key)
+	}
+	_, err := s.do(ctx, args...)
+	return err
+}
+
+// Close closes the idle connections
+func (s *RedisStore) Close() {
+	for {
+		select {
+		case conn := <-s.idle:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// do sends one command on a pooled connection. Connections that failed are dropped,
+// since a reply may still be pending on them.
+func (s *RedisStore) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(s.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	reply, err := conn.command(args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case s.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+func (s *RedisStore) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-s.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: s.cfg.Timeout}
+	var netConn net.Conn
+	var err error
+	if s.cfg.TLS {
+		host, _, _ := net.SplitHostPort(s.cfg.Address)
+		netConn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}}).DialContext(ctx, "tcp", s.cfg.Address)
+	} else {
+		netConn, err = dialer.DialContext(ctx, "tcp", s.cfg.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+	conn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+
+	if s.cfg.Password != "" {
+		args := []string{"AUTH", s.cfg.Password}
+		if s.cfg.Username != "" {
+			args = []string{"AUTH", s.cfg.Username, s.cfg.Password}
+		}
+		if _, err := conn.command(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if s.cfg.DB != 0 {
+		if _, err := conn.command("SELECT", strconv.Itoa(s.cfg.DB)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// redisError is an error reply; the connection stays usable after one
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *redisConn) command(args ...string) (interface{}, error) {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, err
+	}
+	return c.reply()
+}
+
+// reply reads one RESP2 reply: a string, an int64, nil or a slice of those
+func (c *redisConn) reply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	kind, text := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return text, nil
+	case '-':
+		return nil, redisError(text)
+	case ':':
+		return strconv.ParseInt(text, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(text)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(text)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			value, err := c.reply()
+			var replyErr redisError
+			if err != nil && !errors.As(err, &replyErr) {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply type %q", kind)
+	}
+}
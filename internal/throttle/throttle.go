@@ -0,0 +1,125 @@
+// Package throttle slows down repeated failures of an action, such as signing in,
+// with delays growing exponentially per account and per client IP. Unlike a lockout
+// the account stays usable: its holder only waits a little longer after mistyping,
+// while credential stuffing runs at a crawl.
+package throttle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Store counts failures per key. Counts expire ttl after the last failure.
+type Store interface {
+	// Incr adds a failure to key and returns the new count
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	// Counts returns the current count of each key, 0 for unknown keys
+	Counts(ctx context.Context, keys ...string) ([]int64, error)
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Config sets when delays start and how fast they grow
+type Config struct {
+	// AccountFree and IPFree are the failures allowed without delay per account and
+	// per client IP; addresses shared behind NAT need more
+	AccountFree int
+	IPFree      int
+	// BaseDelay is the delay after the first failure over the allowance; it doubles
+	// with every further failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long failures are remembered after the last one
+	Window time.Duration
+}
+
+// Throttle delays attempts at actions that failed recently for the same account or
+// client IP
+type Throttle struct {
+	store Store
+	cfg   Config
+}
+
+func New(store Store, cfg Config) *Throttle {
+	return &Throttle{store: store, cfg: cfg}
+}
+
+// Delay returns how long an attempt at action should wait. account may be empty for
+// actions not aimed at an account.
+func (t *Throttle) Delay(ctx context.Context, action, account, ip string) (time.Duration, error) {
+	keys := t.keys(action, account, ip)
+	counts, err := t.store.Counts(ctx, keys...)
+	if err != nil {
+		return 0, err
+	}
+	delay := t.delay(counts[0], t.cfg.IPFree)
+	if len(counts) > 1 {
+		delay = max(delay, t.delay(counts[1], t.cfg.AccountFree))
+	}
+	return delay, nil
+}
+
+// Wait sleeps for the delay of an attempt, returning early with the context's error
+// when it is done
+func (t *Throttle) Wait(ctx context.Context, action, account, ip string) error {
+	delay, err := t.Delay(ctx, action, account, ip)
+	if err != nil || delay == 0 {
+		return err
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Fail records a failed attempt
+func (t *Throttle) Fail(ctx context.Context, action, account, ip string) error {
+	for _, key := range t.keys(action, account, ip) {
+		if _, err := t.store.Incr(ctx, key, t.cfg.Window); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset forgets the failures of account after a successful attempt. Those of the IP
+// are kept, so one valid account does not clear the way for guessing others.
+func (t *Throttle) Reset(ctx context.Context, action, account string) error {
+	if account == "" {
+		return nil
+	}
+	return t.store.Delete(ctx, accountKey(action, account))
+}
+
+// keys returns the IP key, then the account key when there is an account
+func (t *Throttle) keys(action, account, ip string) []string {
+	keys := []string{action + ":ip:" + ip}
+	if account != "" {
+		keys = append(keys, accountKey(action, account))
+	}
+	return keys
+}
+
+// accountKey hashes the login, so the store does not hold email addresses
+func accountKey(action, account string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(account))))
+	return action + ":account:" + hex.EncodeToString(sum[:16])
+}
+
+func (t *Throttle) delay(failures int64, free int) time.Duration {
+	over := failures - int64(free)
+	if over <= 0 {
+		return 0
+	}
+	delay := t.cfg.BaseDelay
+	for i := int64(1); i < over && delay < t.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, t.cfg.MaxDelay)
+}
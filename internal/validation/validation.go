@@ -0,0 +1,61 @@
+// Package validation registers the rules request bodies are checked with beyond the
+// validator's built-in tags, so every handler binding a body applies the same ones.
+// Messages for the tags are translated by package i18n.
+package validation
+
+import (
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// usernamePattern allows letters, digits, dots, hyphens and underscores, starting with a
+// letter or digit, so usernames are safe in URLs and mentions
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Username reports whether s only uses the characters allowed in usernames. Length is
+// checked separately (min and max tags).
+func Username(s string) bool {
+	return usernamePattern.MatchString(s)
+}
+
+// HTTPURL reports whether s is an absolute http or https URL, the only schemes a
+// browser should be sent to for an avatar or link
+func HTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+// Register adds the custom tags to v, and makes it report fields by their JSON name so
+// error messages use the names clients send:
+//
+//	username  letters, digits, ".", "_" and "-", see Username
+//	httpurl   an http or https URL, see HTTPURL
+func Register(v *validator.Validate) error {
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	rules := map[string]func(string) bool{
+		"username": Username,
+		"httpurl":  HTTPURL,
+	}
+	for tag, valid := range rules {
+		if err := v.RegisterValidation(tag, func(fl validator.FieldLevel) bool {
+			return valid(fl.Field().String())
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package server_test
+
+import (
+	"api/internal/auth"
+	"api/internal/middleware/authtest"
+	"api/internal/models"
+	"api/internal/service"
+	"api/testutil"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// authLevel is who may call a route at all
+type authLevel int
+
+const (
+	public authLevel = iota
+	signedIn
+	admin
+)
+
+// routeAccess is the protection a route must have
+type routeAccess struct {
+	auth   authLevel
+	apiKey bool   // API keys are accepted
+	scope  string // required of API keys and scoped sessions
+	group  string // the access token must list
+	// orgRoles may call the route for the organization in the :id path parameter,
+	// with a token acting for it
+	orgRoles []string
+}
+
+// routeAccessTable is the required protection of every route. A route missing here, or
+// protected differently, fails TestRouteAccess; update it deliberately when a route is
+// added or its protection changes.
+var routeAccessTable = map[string]routeAccess{
+	// Documentation, public media and token verification keys
+	"GET /":                      {},
+	"HEAD /":                     {},
+	"GET /metrics":               {},
+	"GET /.well-known/jwks.json": {},
+	"GET /docs/swagger.json":     {},
+	"GET /docs/v2/swagger.json":  {},
+	"GET /media/avatars/:id":     {},
+	"GET /swagger/*any":          {},
+	"GET /swagger-v2/*any":       {},
+
+	// Health, sign-up and sign-in
+	"GET /api/v1/health":                        {},
+	"GET /api/v1/health/ready":                  {},
+	"POST /api/v1/auth/register":                {},
+	"POST /api/v1/auth/register/invite":         {},
+	"GET /api/v1/auth/invitations/:token":       {},
+	"POST /api/v1/auth/login":                   {},
+	"POST /api/v1/auth/refresh":                 {},
+	"POST /api/v1/auth/password-reset":          {},
+	"POST /api/v1/auth/password-reset/confirm":  {},
+	"POST /api/v1/auth/email-change/confirm":    {},
+	"POST /api/v1/auth/reactivate":              {},
+	"POST /api/v1/auth/devices/confirm":         {},
+	"POST /api/v1/auth/external-logins/confirm": {},
+	"GET /api/v1/auth/saml/:provider/metadata":  {},
+	"GET /api/v1/auth/saml/:provider/login":     {},
+	"POST /api/v1/auth/saml/:provider/acs":      {},
+
+	// Own account
+	"POST /api/v1/auth/logout":              {auth: signedIn},
+	"POST /api/v1/auth/impersonation/exit":  {auth: signedIn},
+	"GET /api/v1/users/profile":             {auth: signedIn, apiKey: true, scope: service.ScopeProfileRead},
+	"PUT /api/v1/users/profile":             {auth: signedIn, apiKey: true, scope: service.ScopeProfileWrite},
+	"POST /api/v1/users/profile/avatar":     {auth: signedIn, apiKey: true, scope: service.ScopeProfileWrite},
+	"GET /api/v1/users/profile/attributes":  {auth: signedIn, apiKey: true, scope: service.ScopeProfileRead},
+	"PUT /api/v1/users/profile/attributes":  {auth: signedIn, apiKey: true, scope: service.ScopeProfileWrite},
+	"GET /api/v1/users/directory":           {auth: signedIn, scope: service.ScopeProfileRead},
+	"PUT /api/v1/users/change-password":     {auth: signedIn, scope: service.ScopeAccount},
+	"PUT /api/v1/users/email":               {auth: signedIn, scope: service.ScopeAccount},
+	"PUT /api/v1/users/username":            {auth: signedIn, scope: service.ScopeAccount},
+	"POST /api/v1/users/deactivate":         {auth: signedIn, scope: service.ScopeAccount},
+	"DELETE /api/v1/users/account":          {auth: signedIn, scope: service.ScopeAccount},
+	"GET /api/v1/users/sessions":            {auth: signedIn, scope: service.ScopeAccount},
+	"POST /api/v1/users/sessions":           {auth: signedIn, scope: service.ScopeAccount},
+	"DELETE /api/v1/users/sessions":         {auth: signedIn, scope: service.ScopeAccount},
+	"DELETE /api/v1/users/sessions/:id":     {auth: signedIn, scope: service.ScopeAccount},
+	"GET /api/v1/users/devices":             {auth: signedIn, scope: service.ScopeAccount},
+	"DELETE /api/v1/users/devices/:id":      {auth: signedIn, scope: service.ScopeAccount},
+	"GET /api/v1/users/api-keys":            {auth: signedIn, scope: service.ScopeAccount},
+	"POST /api/v1/users/api-keys":           {auth: signedIn, scope: service.ScopeAccount},
+	"DELETE /api/v1/users/api-keys/:id":     {auth: signedIn, scope: service.ScopeAccount},
+	"GET /api/v1/users/share-tokens":        {auth: signedIn, scope: service.ScopeAccount},
+	"POST /api/v1/users/share-tokens":       {auth: signedIn, scope: service.ScopeAccount},
+	"DELETE /api/v1/users/share-tokens/:id": {auth: signedIn, scope: service.ScopeAccount},
+	"GET /api/v1/users/activity":            {auth: signedIn, scope: service.ScopeAccount},
+	"GET /api/v1/users/notifications":       {auth: signedIn, scope: service.ScopeProfileRead},
+	"PUT /api/v1/users/notifications":       {auth: signedIn, scope: service.ScopeProfileWrite},
+	"GET /api/v1/users/settings":            {auth: signedIn, scope: service.ScopeProfileRead},
+	"PUT /api/v1/users/settings":            {auth: signedIn, scope: service.ScopeProfileWrite},
+	"GET /api/v1/users/export":              {auth: signedIn, scope: service.ScopeAccount},
+	"GET /api/v1/users/export/:id":          {auth: signedIn, scope: service.ScopeAccount},
+	"GET /api/v1/users/export/:id/download": {auth: signedIn, scope: service.ScopeAccount},
+
+	// Profile fields shared with third-party apps, read with a share token
+	"GET /api/v1/shared/profile": {},
+
+	// GraphQL; fields check their own scopes and roles
+	"POST /api/v1/graphql": {auth: signedIn},
+
+	// Organizations
+	"POST /api/v1/organizations":                            {auth: signedIn, scope: service.ScopeOrganizations},
+	"GET /api/v1/organizations":                             {auth: signedIn, scope: service.ScopeOrganizations},
+	"POST /api/v1/organizations/invitations/accept":         {auth: signedIn, scope: service.ScopeOrganizations},
+	"POST /api/v1/organizations/ownership-transfers/accept": {auth: signedIn, scope: service.ScopeOrganizations},
+	"POST /api/v1/organizations/:id/switch":                 {auth: signedIn, scope: service.ScopeOrganizations},
+	"GET /api/v1/organizations/:id/members":                 {auth: signedIn, scope: service.ScopeOrganizations, orgRoles: []string{models.OrgRoleOwner, models.OrgRoleAdmin}},
+	"POST /api/v1/organizations/:id/invitations":            {auth: signedIn, scope: service.ScopeOrganizations, orgRoles: []string{models.OrgRoleOwner, models.OrgRoleAdmin}},
+	"POST /api/v1/organizations/:id/transfer-ownership":     {auth: signedIn, scope: service.ScopeOrganizations, orgRoles: []string{models.OrgRoleOwner}},
+
+	// Administration
+	"GET /api/v1/admin/users":                         {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"GET /api/v1/admin/users/export":                  {auth: admin, apiKey: true, scope: service.ScopeAdminUsers, group: "user-export"},
+	"POST /api/v1/admin/users/import":                 {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"POST /api/v1/admin/users/bulk":                   {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"GET /api/v1/admin/users/search":                  {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"GET /api/v1/admin/users/incomplete-profiles":     {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"GET /api/v1/admin/users/import/:id":              {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"GET /api/v1/admin/users/import/:id/report":       {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"PATCH /api/v1/admin/users/:id":                   {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"GET /api/v1/admin/users/:id/preview":             {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"GET /api/v1/admin/users/:id/timeline":            {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"GET /api/v1/admin/users/:id/attributes":          {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"PUT /api/v1/admin/users/:id/attributes":          {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"PUT /api/v1/admin/users/:id/role":                {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"POST /api/v1/admin/users/:id/erase":              {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"POST /api/v1/admin/users/:id/revoke-sessions":    {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"POST /api/v1/admin/users/:id/password-reset":     {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"POST /api/v1/admin/users/:id/impersonate":        {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"PUT /api/v1/admin/users/:id/suspend":             {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"PUT /api/v1/admin/users/:id/reinstate":           {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"GET /api/v1/admin/users/deleted":                 {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"POST /api/v1/admin/users/:id/restore":            {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"DELETE /api/v1/admin/users/:id/purge":            {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+	"GET /api/v1/admin/attributes":                    {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"PUT /api/v1/admin/attributes/:key":               {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"DELETE /api/v1/admin/attributes/:key":            {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"GET /api/v1/admin/groups":                        {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"POST /api/v1/admin/groups":                       {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"GET /api/v1/admin/groups/:id":                    {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"PUT /api/v1/admin/groups/:id":                    {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"DELETE /api/v1/admin/groups/:id":                 {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"PUT /api/v1/admin/groups/:id/members/:userId":    {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"DELETE /api/v1/admin/groups/:id/members/:userId": {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"GET /api/v1/admin/invitations":                   {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"POST /api/v1/admin/invitations":                  {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"DELETE /api/v1/admin/invitations/:id":            {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"POST /api/v1/admin/dsar":                         {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"GET /api/v1/admin/dsar":                          {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"GET /api/v1/admin/dsar/:id":                      {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"POST /api/v1/admin/dsar/:id/package":             {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"GET /api/v1/admin/dsar/:id/package":              {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"POST /api/v1/admin/dsar/:id/extend":              {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"POST /api/v1/admin/dsar/:id/close":               {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"GET /api/v1/admin/dsar/:id/evidence":             {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"GET /api/v1/admin/email-stats":                   {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"GET /api/v1/admin/analytics":                     {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"GET /api/v1/admin/reports/schedules":             {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"POST /api/v1/admin/reports/schedules":            {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"DELETE /api/v1/admin/reports/schedules/:id":      {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"GET /api/v1/admin/debug-logging":                 {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"POST /api/v1/admin/debug-logging":                {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"DELETE /api/v1/admin/debug-logging/:id":          {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"GET /api/v1/admin/ip-rules":                      {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"POST /api/v1/admin/ip-rules":                     {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"DELETE /api/v1/admin/ip-rules/:id":               {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"GET /api/v1/admin/feature-flags":                 {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"GET /api/v1/admin/feature-flags/:key":            {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"PUT /api/v1/admin/feature-flags/:key":            {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+	"DELETE /api/v1/admin/feature-flags/:key":         {auth: admin, apiKey: true, scope: service.ScopeAdmin},
+
+	// Provider webhooks authenticate with X-Webhook-Secret
+	"POST /api/v1/webhooks/email/:provider": {},
+
+	// Version 2
+	"GET /api/v2/users/me":    {auth: signedIn, apiKey: true, scope: service.ScopeProfileRead},
+	"GET /api/v2/admin/users": {auth: admin, apiKey: true, scope: service.ScopeAdminUsers},
+}
+
+// Organizations the callers' tokens act for. Every path parameter is testOrg, so
+// routes taking an organization see the one the "user" caller acts for.
+const (
+	testOrg  = 999999
+	otherOrg = 999998
+)
+
+// caller is one way of calling the API: anonymously when the identity has no role,
+// with an access token, or with an API key
+type caller struct {
+	name     string
+	identity authtest.Identity
+}
+
+// expect returns how the access middlewares must answer c on a route protected as a:
+// 0 when they let the request through to the handler, or the status they refuse it with
+func (a routeAccess) expect(c caller) int {
+	id := c.identity
+	switch {
+	case a.auth == public:
+		return 0
+	case id.Role == "", id.APIKeyID != 0 && !a.apiKey:
+		return http.StatusUnauthorized
+	case a.auth == admin && id.Role != authtest.RoleAdmin:
+		return http.StatusForbidden
+	case a.scope != "" && id.Scopes != nil && !auth.HasScope(id.Scopes, a.scope):
+		return http.StatusForbidden
+	case a.group != "" && !contains(id.Groups, a.group):
+		return http.StatusForbidden
+	case a.orgRoles != nil && (id.OrgID != testOrg || !contains(a.orgRoles, id.OrgRole)):
+		return http.StatusForbidden
+	}
+	return 0
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// accessRefusals are the errors the access middlewares refuse requests with, telling
+// their answers from a handler's own 401 or 403
+var accessRefusals = [][]byte{
+	[]byte("Authorization header required"),
+	[]byte("Invalid API key"),
+	[]byte("Admin access required"),
+	[]byte("Insufficient scope"),
+	[]byte("Group membership required"),
+	[]byte("Token does not act for this organization"),
+	[]byte("Insufficient organization role"),
+}
+
+// refusal returns the status of a response from an access middleware, 0 for one the
+// handler gave
+func refusal(resp *http.Response, body []byte) int {
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return 0
+	}
+	for _, message := range accessRefusals {
+		if bytes.Contains(body, message) {
+			return resp.StatusCode
+		}
+	}
+	return 0
+}
+
+// TestRouteAccess calls every route as each caller through the real middlewares and
+// checks they are refused with 401 or 403, or let through, as routeAccessTable
+// requires. Access tokens are issued fresh for every request, so a route ending a
+// session does not affect the next.
+func TestRouteAccess(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	user := srv.CreateUser(t, testEmail, testPassword, "user")
+	root := srv.CreateUser(t, "root@example.com", testPassword, "admin")
+
+	keyScopes := []string{service.ScopeAdmin, service.ScopeProfileRead, service.ScopeProfileWrite}
+	resp, body := srv.Do(t, http.MethodPost, "/api/v1/users/api-keys", map[string]interface{}{"name": "access test", "scopes": keyScopes}, srv.AccessToken(t, authtest.Admin(root.ID)))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create API key: %d %s", resp.StatusCode, body)
+	}
+	var key struct {
+		ID  uint   `json:"id"`
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(body, &key); err != nil {
+		t.Fatal(err)
+	}
+
+	callers := []caller{
+		{name: "anonymous"},
+		{name: "user", identity: authtest.User(user.ID).WithOrganization(testOrg, models.OrgRoleAdmin)},
+		{name: "admin", identity: authtest.Admin(root.ID)},
+		{name: "scoped token", identity: authtest.Admin(root.ID).WithScopes(service.ScopeProfileRead)},
+		{name: "other organization", identity: authtest.User(user.ID).WithOrganization(otherOrg, models.OrgRoleOwner)},
+		{name: "API key", identity: authtest.Admin(root.ID).WithAPIKey(key.ID, keyScopes...)},
+	}
+	header := func(c caller) http.Header {
+		switch {
+		case c.identity.APIKeyID != 0:
+			return http.Header{"X-Api-Key": {key.Key}}
+		case c.identity.Role != "":
+			return http.Header{"Authorization": {"Bearer " + srv.AccessToken(t, c.identity)}}
+		}
+		return http.Header{}
+	}
+
+	registered := map[string]bool{}
+	for _, route := range srv.Router.Routes() {
+		key := route.Method + " " + route.Path
+		registered[key] = true
+		access, ok := routeAccessTable[key]
+		if !ok {
+			t.Errorf("%s is missing from routeAccessTable", key)
+			continue
+		}
+		path := ginParam.ReplaceAllString(route.Path, strconv.Itoa(testOrg))
+		t.Run(key, func(t *testing.T) {
+			for _, c := range callers {
+				resp, body := srv.DoWithHeader(t, route.Method, path, nil, header(c))
+				if got, want := refusal(resp, body), access.expect(c); got != want {
+					t.Errorf("as %s: %s, want %s", c.name, outcome(got, resp, body), outcome(want, nil, nil))
+				}
+			}
+		})
+	}
+	for key := range routeAccessTable {
+		if !registered[key] {
+			t.Errorf("routeAccessTable lists %s, which is not registered", key)
+		}
+	}
+}
+
+// outcome describes a refusal status, or the handler's response when there is none
+func outcome(status int, resp *http.Response, body []byte) string {
+	switch {
+	case status != 0:
+		return "refused with " + strconv.Itoa(status)
+	case resp == nil:
+		return "let through"
+	}
+	return "let through, answered " + strconv.Itoa(resp.StatusCode) + " " + string(body)
+}
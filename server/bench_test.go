@@ -0,0 +1,172 @@
+package server_test
+
+import (
+	"api/internal/repository"
+	"api/internal/service"
+	"api/testutil"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+// countStatements counts the statements gorm runs on db from now on, so benchmarks can
+// report the database work behind each request
+func countStatements(db *gorm.DB) *atomic.Int64 {
+	var n atomic.Int64
+	count := func(*gorm.Scope) { n.Add(1) }
+	callbacks := db.Callback()
+	callbacks.Create().After("gorm:create").Register("bench:count", count)
+	callbacks.Query().After("gorm:query").Register("bench:count", count)
+	callbacks.RowQuery().After("gorm:row_query").Register("bench:count", count)
+	callbacks.Update().After("gorm:update").Register("bench:count", count)
+	callbacks.Delete().After("gorm:delete").Register("bench:count", count)
+	return &n
+}
+
+// reportStatements adds the statements per operation counted by n to the results of b
+func reportStatements(b *testing.B, n *atomic.Int64) {
+	b.ReportMetric(float64(n.Load())/float64(b.N), "queries/op")
+}
+
+// BenchmarkLogin measures POST /auth/login: bcrypt, the user lookup, the device and
+// session records and the token pair
+func BenchmarkLogin(b *testing.B) {
+	srv := testutil.NewServer(b, nil)
+	srv.CreateUser(b, testEmail, testPassword, "user")
+	srv.Login(b, testEmail, testPassword)
+	statements := countStatements(srv.DB)
+	body := map[string]string{"login": testEmail, "password": testPassword}
+
+	b.ResetTimer()
+	statements.Store(0)
+	for i := 0; i < b.N; i++ {
+		if resp, data := srv.Do(b, http.MethodPost, "/api/v1/auth/login", body, ""); resp.StatusCode != http.StatusOK {
+			b.Fatalf("login: %d %s", resp.StatusCode, data)
+		}
+	}
+	b.StopTimer()
+	reportStatements(b, statements)
+}
+
+// BenchmarkGetProfile measures GET /users/profile with a bearer token, where the
+// session check and the user and profile lookups hit the database on every request
+func BenchmarkGetProfile(b *testing.B) {
+	srv := testutil.NewServer(b, nil)
+	srv.CreateUser(b, testEmail, testPassword, "user")
+	token := srv.Login(b, testEmail, testPassword).AccessToken
+	statements := countStatements(srv.DB)
+
+	b.ResetTimer()
+	statements.Store(0)
+	for i := 0; i < b.N; i++ {
+		if resp, data := srv.Do(b, http.MethodGet, "/api/v1/users/profile", nil, token); resp.StatusCode != http.StatusOK {
+			b.Fatalf("profile: %d %s", resp.StatusCode, data)
+		}
+	}
+	b.StopTimer()
+	reportStatements(b, statements)
+}
+
+// seedUsers adds n users, each with a profile, numbered from first, straight to the
+// database a few hundred rows per statement
+func seedUsers(b *testing.B, db *gorm.DB, first, n int) {
+	b.Helper()
+	const rows = 500
+	tx := db.Begin()
+	now := time.Now()
+	for start := first; start < first+n; start += rows {
+		count := min(rows, first+n-start)
+		users := make([]string, count)
+		args := make([]interface{}, 0, count*6)
+		for i := range users {
+			users[i] = "(?, ?, ?, 'user', ?, ?, ?)"
+			args = append(args, fmt.Sprintf("user%d@example.com", start+i), fmt.Sprintf("user%d", start+i), "unusable", true, now, now)
+		}
+		if err := tx.Exec("INSERT INTO users (email, username, password_hash, role, email_verified, created_at, updated_at) VALUES "+strings.Join(users, ", "), args...).Error; err != nil {
+			tx.Rollback()
+			b.Fatal(err)
+		}
+		if err := tx.Exec(`INSERT INTO user_profiles (user_id, first_name, last_name, created_at, updated_at)
+			SELECT id, 'First', 'Last', created_at, updated_at FROM users WHERE email IN (?)`, seededEmails(start, count)).Error; err != nil {
+			tx.Rollback()
+			b.Fatal(err)
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		b.Fatal(err)
+	}
+}
+
+func seededEmails(start, count int) []string {
+	emails := make([]string, count)
+	for i := range emails {
+		emails[i] = fmt.Sprintf("user%d@example.com", start+i)
+	}
+	return emails
+}
+
+// BenchmarkListUsers measures UserService.ListUsers, behind GET /admin/users, on up to
+// 100k users with profiles in a testutil database. The profiles are loaded
+// service.ProfileBatch at a time, so a listing runs the users query and
+// ceil(n/ProfileBatch) profile queries, growing with the batches rather than with n;
+// the benchmark fails otherwise. The "per user" cases load the profiles one query per
+// user, as ListUsers did before, for comparison.
+func BenchmarkListUsers(b *testing.B) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	db := testutil.OpenDatabase(b, logger)
+	users := repository.NewUserRepository(db, nil)
+	userService := service.NewUserService(users, nil, nil, nil, nil, nil, service.UserServiceConfig{}, logger)
+	statements := countStatements(db)
+
+	seeded := 0
+	for _, n := range []int{1000, 10000, 100000} {
+		seedUsers(b, db, seeded, n-seeded)
+		seeded = n
+
+		b.Run(fmt.Sprintf("users=%d", n), func(b *testing.B) {
+			b.ResetTimer()
+			statements.Store(0)
+			for i := 0; i < b.N; i++ {
+				list, err := userService.ListUsers()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(list) != n {
+					b.Fatalf("%d users listed, want %d", len(list), n)
+				}
+			}
+			b.StopTimer()
+			reportStatements(b, statements)
+			if got, want := statements.Load()/int64(b.N), int64(1+(n+service.ProfileBatch-1)/service.ProfileBatch); got != want {
+				b.Fatalf("%d statements to list %d users, want %d: the users and one per %d profiles", got, n, want, service.ProfileBatch)
+			}
+		})
+
+		b.Run(fmt.Sprintf("users=%d/per user", n), func(b *testing.B) {
+			b.ResetTimer()
+			statements.Store(0)
+			for i := 0; i < b.N; i++ {
+				list, err := users.List()
+				if err != nil {
+					b.Fatal(err)
+				}
+				for _, user := range list {
+					if _, err := users.FindProfile(user.ID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.StopTimer()
+			reportStatements(b, statements)
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package server_test
+
+import (
+	"api/config"
+	"api/testutil"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// forwarded sends a request with X-Forwarded-For set to forwardedFor unless it is
+// empty, as a client claiming to be behind a proxy would, and returns the status and
+// body of the response
+func forwarded(t *testing.T, srv *testutil.Server, method, path string, body interface{}, forwardedFor string) (int, []byte) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+// allowAdminFrom restricts the admin routes to network
+func allowAdminFrom(network string) func(*config.Config) {
+	return func(cfg *config.Config) {
+		cfg.IPFilter.Rules = []config.IPRuleConfig{{Path: "/api/v1/admin/*", Action: "allow", CIDR: network}}
+	}
+}
+
+func TestIPFilterIgnoresForwardedForFromUntrustedPeer(t *testing.T) {
+	srv := testutil.NewServer(t, allowAdminFrom("10.0.0.0/8"))
+
+	for _, forwardedFor := range []string{"", "10.1.2.3", "10.1.2.3, 10.4.5.6"} {
+		if status, body := forwarded(t, srv, http.MethodGet, "/api/v1/admin/users", nil, forwardedFor); status != http.StatusForbidden {
+			t.Errorf("X-Forwarded-For %q: %d %s, want %d", forwardedFor, status, body, http.StatusForbidden)
+		}
+	}
+}
+
+func TestIPFilterUsesForwardedForFromTrustedProxy(t *testing.T) {
+	// The test client connects from loopback, standing in for the proxy
+	allow := allowAdminFrom("10.0.0.0/8")
+	srv := testutil.NewServer(t, func(cfg *config.Config) {
+		allow(cfg)
+		cfg.Server.TrustedProxies = []string{"127.0.0.1", "::1"}
+	})
+
+	// Past the filter, the request lacks a token
+	if status, body := forwarded(t, srv, http.MethodGet, "/api/v1/admin/users", nil, "10.1.2.3"); status != http.StatusUnauthorized {
+		t.Errorf("client in the allowed range: %d %s, want %d", status, body, http.StatusUnauthorized)
+	}
+	if status, body := forwarded(t, srv, http.MethodGet, "/api/v1/admin/users", nil, "192.0.2.7"); status != http.StatusForbidden {
+		t.Errorf("client outside the allowed range: %d %s, want %d", status, body, http.StatusForbidden)
+	}
+}
+
+func TestLoginThrottleIgnoresRotatedForwardedFor(t *testing.T) {
+	const delay = 400 * time.Millisecond
+	srv := testutil.NewServer(t, func(cfg *config.Config) {
+		cfg.Security.Throttle = config.ThrottleConfig{
+			Enabled:         true,
+			Store:           "memory",
+			AccountFree:     100,
+			IPFree:          2,
+			BaseDelayMs:     int(delay / time.Millisecond),
+			MaxDelaySeconds: 1,
+			WindowMinutes:   15,
+		}
+	})
+
+	// Every attempt claims another address and tries another account, so only the
+	// failures per peer address can slow it down
+	for i := 0; i < 4; i++ {
+		body := map[string]string{"login": fmt.Sprintf("user%d@example.com", i), "password": "wrong"}
+		start := time.Now()
+		status, data := forwarded(t, srv, http.MethodPost, "/api/v1/auth/login", body, fmt.Sprintf("198.51.100.%d", i+1))
+		elapsed := time.Since(start)
+		if status != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: %d %s, want %d", i+1, status, data, http.StatusUnauthorized)
+		}
+		// The third failure is one over the allowance and delays the fourth attempt
+		if throttled := elapsed >= delay; throttled != (i == 3) {
+			t.Errorf("attempt %d took %s, throttled %t, want %t", i+1, elapsed, throttled, i == 3)
+		}
+	}
+}
+
+func TestLoginCaptchaIgnoresRotatedForwardedFor(t *testing.T) {
+	srv := testutil.NewServer(t, func(cfg *config.Config) {
+		cfg.Security.Captcha = config.CaptchaConfig{
+			Enabled:                   true,
+			Provider:                  "turnstile",
+			Secret:                    "test-secret",
+			LoginFailures:             2,
+			LoginFailureWindowMinutes: 15,
+		}
+	})
+
+	// Requests without a CAPTCHA token are rejected without asking the provider
+	for i := 0; i < 3; i++ {
+		body := map[string]string{"login": "ada@example.com", "password": "wrong"}
+		status, data := forwarded(t, srv, http.MethodPost, "/api/v1/auth/login", body, fmt.Sprintf("198.51.100.%d", i+1))
+		want := http.StatusUnauthorized
+		if i == 2 {
+			want = http.StatusForbidden
+		}
+		if status != want {
+			t.Errorf("attempt %d: %d %s, want %d", i+1, status, data, want)
+		}
+	}
+}
+
+// sessionAddress signs in with X-Forwarded-For set to forwardedFor and returns the
+// address recorded for the session, the one country blocking and impossible travel
+// checks look up
+func sessionAddress(t *testing.T, srv *testutil.Server, forwardedFor string) string {
+	t.Helper()
+	body := map[string]string{"login": testEmail, "password": testPassword}
+	status, data := forwarded(t, srv, http.MethodPost, "/api/v1/auth/login", body, forwardedFor)
+	if status != http.StatusOK {
+		t.Fatalf("login: %d %s", status, data)
+	}
+	var tokens testutil.Tokens
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		t.Fatal(err)
+	}
+	resp, data := srv.Do(t, http.MethodGet, "/api/v1/users/sessions", nil, tokens.AccessToken)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("sessions: %d %s", resp.StatusCode, data)
+	}
+	var sessions struct {
+		Sessions []struct {
+			IPAddress string `json:"ipAddress"`
+			Current   bool   `json:"current"`
+		} `json:"sessions"`
+	}
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		t.Fatal(err)
+	}
+	for _, session := range sessions.Sessions {
+		if session.Current {
+			return session.IPAddress
+		}
+	}
+	t.Fatalf("no current session in %s", data)
+	return ""
+}
+
+func TestSignInAddressIgnoresForwardedForFromUntrustedPeer(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	srv.CreateUser(t, testEmail, testPassword, "user")
+
+	if ip := sessionAddress(t, srv, "203.0.113.9"); ip == "203.0.113.9" {
+		t.Errorf("session recorded the forged address %s", ip)
+	}
+}
+
+func TestSignInAddressFromTrustedProxy(t *testing.T) {
+	srv := testutil.NewServer(t, func(cfg *config.Config) {
+		cfg.Server.TrustedProxies = []string{"127.0.0.1", "::1"}
+	})
+	srv.CreateUser(t, testEmail, testPassword, "user")
+
+	if ip := sessionAddress(t, srv, "203.0.113.9"); ip != "203.0.113.9" {
+		t.Errorf("session address %s, want the forwarded 203.0.113.9", ip)
+	}
+}
@@ -0,0 +1,190 @@
+package server_test
+
+import (
+	"api/testutil"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// contractTour sends requests to a contract server, failing the test when one is not
+// answered with the expected status; the server fails it when a response does not
+// match the spec
+type contractTour struct {
+	t   *testing.T
+	srv *testutil.Server
+}
+
+func (c contractTour) expect(status int, method, path string, body interface{}, token string) map[string]interface{} {
+	c.t.Helper()
+	resp, data := c.srv.Do(c.t, method, path, body, token)
+	if resp.StatusCode != status {
+		c.t.Errorf("%s %s: %d, want %d: %s", method, path, resp.StatusCode, status, data)
+		return nil
+	}
+	var decoded map[string]interface{}
+	_ = json.Unmarshal(data, &decoded)
+	return decoded
+}
+
+// id returns the number at key of a decoded response, following nested objects for
+// keys like "group.id"
+func id(t *testing.T, response map[string]interface{}, key string) uint {
+	t.Helper()
+	var value interface{} = response
+	for _, part := range strings.Split(key, ".") {
+		obj, _ := value.(map[string]interface{})
+		value = obj[part]
+	}
+	n, ok := value.(float64)
+	if !ok {
+		t.Fatalf("no %s in %v", key, response)
+	}
+	return uint(n)
+}
+
+// TestContract drives the main flows of the API through a server checking every
+// response against docs/swagger.json, covering success and the usual failures
+func TestContract(t *testing.T) {
+	srv := testutil.NewContractServer(t, nil)
+	tour := contractTour{t: t, srv: srv}
+	const api = "/api/v1"
+
+	// Registration and sign-in
+	tour.expect(http.StatusCreated, "POST", api+"/auth/register", map[string]string{"email": "grace@example.com", "username": "grace", "password": testPassword}, "")
+	tour.expect(http.StatusConflict, "POST", api+"/auth/register", map[string]string{"email": "grace@example.com", "username": "grace2", "password": testPassword}, "")
+	tour.expect(http.StatusBadRequest, "POST", api+"/auth/register", map[string]string{"email": "grace", "username": "g"}, "")
+	tour.expect(http.StatusUnauthorized, "POST", api+"/auth/login", map[string]string{"login": "grace", "password": "wrong"}, "")
+	tour.expect(http.StatusBadRequest, "POST", api+"/auth/login", map[string]string{"login": "grace"}, "")
+	tour.expect(http.StatusOK, "POST", api+"/auth/password-reset", map[string]string{"email": "grace@example.com"}, "")
+	tour.expect(http.StatusBadRequest, "POST", api+"/auth/password-reset/confirm", map[string]string{"token": "unknown", "newPassword": testPassword}, "")
+	tour.expect(http.StatusBadRequest, "POST", api+"/auth/email-change/confirm", map[string]string{"token": "unknown"}, "")
+	tour.expect(http.StatusBadRequest, "POST", api+"/auth/reactivate", map[string]string{"token": "unknown"}, "")
+
+	srv.CreateUser(t, "ada@example.com", testPassword, "admin")
+	user := srv.CreateUser(t, "alan@example.com", testPassword, "user")
+	adminTokens := srv.Login(t, "ada@example.com", testPassword)
+	userTokens := srv.Login(t, "alan", testPassword)
+	adminToken, userToken := adminTokens.AccessToken, userTokens.AccessToken
+
+	tour.expect(http.StatusUnauthorized, "POST", api+"/auth/refresh", map[string]string{"refresh_token": "not-a-token"}, "")
+	refreshed := tour.expect(http.StatusOK, "POST", api+"/auth/refresh", map[string]string{"refresh_token": userTokens.RefreshToken}, "")
+	userRefresh, _ := refreshed["refresh_token"].(string)
+	userToken, _ = refreshed["access_token"].(string)
+
+	// Own account
+	tour.expect(http.StatusOK, "GET", api+"/users/profile", nil, userToken)
+	tour.expect(http.StatusOK, "PUT", api+"/users/profile", map[string]interface{}{"firstName": "Alan", "pronouns": "he/him", "visibility": map[string]string{"pronouns": "private"}}, userToken)
+	tour.expect(http.StatusBadRequest, "PUT", api+"/users/profile", map[string]string{"timezone": "Mars/Olympus"}, userToken)
+	tour.expect(http.StatusOK, "GET", api+"/users/directory", nil, userToken)
+	tour.expect(http.StatusOK, "GET", api+"/users/settings", nil, userToken)
+	tour.expect(http.StatusOK, "PUT", api+"/users/settings", map[string]interface{}{"theme": "dark"}, userToken)
+	tour.expect(http.StatusOK, "GET", api+"/users/notifications", nil, userToken)
+	tour.expect(http.StatusOK, "PUT", api+"/users/notifications", map[string]bool{"newLogin": false}, userToken)
+	tour.expect(http.StatusOK, "GET", api+"/users/devices", nil, userToken)
+	tour.expect(http.StatusOK, "GET", api+"/users/activity", nil, userToken)
+	tour.expect(http.StatusOK, "GET", api+"/users/sessions", nil, userToken)
+	tour.expect(http.StatusCreated, "POST", api+"/users/sessions", map[string][]string{"scopes": {"profile:read"}}, userToken)
+	tour.expect(http.StatusBadRequest, "POST", api+"/users/sessions", map[string][]string{"scopes": {}}, userToken)
+	key := tour.expect(http.StatusCreated, "POST", api+"/users/api-keys", map[string]interface{}{"name": "CI", "scopes": []string{"profile:read"}}, userToken)
+	tour.expect(http.StatusOK, "GET", api+"/users/api-keys", nil, userToken)
+	tour.expect(http.StatusOK, "DELETE", fmt.Sprintf("%s/users/api-keys/%d", api, id(t, key, "id")), nil, userToken)
+	tour.expect(http.StatusNotFound, "DELETE", api+"/users/api-keys/999999", nil, userToken)
+	share := tour.expect(http.StatusCreated, "POST", api+"/users/share-tokens", map[string]interface{}{"app": "Chat", "fields": []string{"displayName"}}, userToken)
+	tour.expect(http.StatusOK, "GET", api+"/users/share-tokens", nil, userToken)
+	tour.expect(http.StatusOK, "DELETE", fmt.Sprintf("%s/users/share-tokens/%d", api, id(t, share, "id")), nil, userToken)
+	tour.expect(http.StatusOK, "GET", api+"/users/profile/attributes", nil, userToken)
+	tour.expect(http.StatusConflict, "PUT", api+"/users/username", map[string]string{"username": "ada"}, userToken)
+	tour.expect(http.StatusOK, "PUT", api+"/users/username", map[string]string{"username": "turing"}, userToken)
+	tour.expect(http.StatusTooManyRequests, "PUT", api+"/users/username", map[string]string{"username": "alan"}, userToken)
+	tour.expect(http.StatusAccepted, "PUT", api+"/users/email", map[string]string{"newEmail": "alan@example.org", "password": testPassword}, userToken)
+	tour.expect(http.StatusUnauthorized, "PUT", api+"/users/email", map[string]string{"newEmail": "alan@example.org", "password": "wrong"}, userToken)
+	tour.expect(http.StatusUnauthorized, "PUT", api+"/users/change-password", map[string]string{"currentPassword": "wrong", "newPassword": "An0ther-Horse-42"}, userToken)
+	tour.expect(http.StatusOK, "GET", api+"/organizations", nil, userToken)
+	org := tour.expect(http.StatusCreated, "POST", api+"/organizations", map[string]string{"name": "Acme", "slug": "acme"}, userToken)
+	tour.expect(http.StatusConflict, "POST", api+"/organizations", map[string]string{"name": "Acme", "slug": "acme"}, userToken)
+	// Tokens act for the organization they were issued for, not one created with them
+	tour.expect(http.StatusForbidden, "GET", fmt.Sprintf("%s/organizations/%d/members", api, id(t, org, "id")), nil, userToken)
+
+	// Administration
+	users := fmt.Sprintf("%s/admin/users/%d", api, user.ID)
+	tour.expect(http.StatusForbidden, "GET", api+"/admin/users", nil, userToken)
+	tour.expect(http.StatusUnauthorized, "GET", api+"/admin/users", nil, "")
+	tour.expect(http.StatusOK, "GET", api+"/admin/users", nil, adminToken)
+	tour.expect(http.StatusOK, "GET", api+"/admin/users/incomplete-profiles?below=90", nil, adminToken)
+	tour.expect(http.StatusBadRequest, "GET", api+"/admin/users/incomplete-profiles?below=0", nil, adminToken)
+	tour.expect(http.StatusOK, "GET", users+"/preview", nil, adminToken)
+	tour.expect(http.StatusNotFound, "GET", api+"/admin/users/999999/preview", nil, adminToken)
+	tour.expect(http.StatusBadRequest, "GET", api+"/admin/users/abc/preview", nil, adminToken)
+	tour.expect(http.StatusOK, "PATCH", users, map[string]interface{}{"profile": map[string]string{"lastName": "Turing"}}, adminToken)
+	tour.expect(http.StatusOK, "PUT", users+"/role", map[string]string{"role": "user"}, adminToken)
+	tour.expect(http.StatusBadRequest, "PUT", users+"/role", map[string]string{"role": "owner"}, adminToken)
+	tour.expect(http.StatusOK, "PUT", users+"/suspend", map[string]string{"reason": "Spam"}, adminToken)
+	tour.expect(http.StatusForbidden, "GET", api+"/users/profile", nil, userToken)
+	tour.expect(http.StatusOK, "PUT", users+"/reinstate", nil, adminToken)
+	tour.expect(http.StatusOK, "POST", users+"/revoke-sessions", map[string]bool{"notify": true}, adminToken)
+	tour.expect(http.StatusUnauthorized, "POST", api+"/auth/refresh", map[string]string{"refresh_token": userRefresh}, "")
+	tour.expect(http.StatusOK, "POST", users+"/password-reset", nil, adminToken)
+	tour.expect(http.StatusOK, "POST", api+"/admin/users/bulk", map[string]interface{}{"action": "verify_email", "userIds": []uint{user.ID, 999999}}, adminToken)
+	tour.expect(http.StatusBadRequest, "POST", api+"/admin/users/bulk", map[string]interface{}{"action": "role", "userIds": []uint{user.ID}}, adminToken)
+	tour.expect(http.StatusOK, "GET", users+"/attributes", nil, adminToken)
+	tour.expect(http.StatusOK, "GET", api+"/admin/attributes", nil, adminToken)
+	tour.expect(http.StatusCreated, "PUT", api+"/admin/attributes/department", map[string]interface{}{"type": "enum", "options": []string{"sales", "support"}}, adminToken)
+	tour.expect(http.StatusOK, "PUT", users+"/attributes", map[string]interface{}{"attributes": map[string]string{"department": "sales"}}, adminToken)
+	tour.expect(http.StatusOK, "GET", api+"/admin/users?attr[department]=sales", nil, adminToken)
+	tour.expect(http.StatusOK, "DELETE", api+"/admin/attributes/department", nil, adminToken)
+	tour.expect(http.StatusOK, "GET", api+"/admin/feature-flags", nil, adminToken)
+	tour.expect(http.StatusCreated, "PUT", api+"/admin/feature-flags/new-editor", map[string]interface{}{"enabled": true, "percentage": 50, "roles": map[string]int{"admin": 100}}, adminToken)
+	tour.expect(http.StatusOK, "GET", api+"/admin/feature-flags/new-editor", nil, adminToken)
+	tour.expect(http.StatusOK, "DELETE", api+"/admin/feature-flags/new-editor", nil, adminToken)
+	tour.expect(http.StatusNotFound, "GET", api+"/admin/feature-flags/new-editor", nil, adminToken)
+	group := tour.expect(http.StatusCreated, "POST", api+"/admin/groups", map[string]string{"name": "support"}, adminToken)
+	groups := fmt.Sprintf("%s/admin/groups/%d", api, id(t, group, "id"))
+	tour.expect(http.StatusConflict, "POST", api+"/admin/groups", map[string]string{"name": "support"}, adminToken)
+	tour.expect(http.StatusOK, "GET", api+"/admin/groups", nil, adminToken)
+	tour.expect(http.StatusOK, "PUT", fmt.Sprintf("%s/members/%d", groups, user.ID), nil, adminToken)
+	tour.expect(http.StatusOK, "GET", groups, nil, adminToken)
+	tour.expect(http.StatusOK, "DELETE", fmt.Sprintf("%s/members/%d", groups, user.ID), nil, adminToken)
+	tour.expect(http.StatusOK, "DELETE", groups, nil, adminToken)
+	tour.expect(http.StatusOK, "GET", api+"/admin/invitations", nil, adminToken)
+	invitation := tour.expect(http.StatusCreated, "POST", api+"/admin/invitations", map[string]string{"email": "barbara@example.com"}, adminToken)
+	tour.expect(http.StatusOK, "DELETE", fmt.Sprintf("%s/admin/invitations/%d", api, id(t, invitation, "id")), nil, adminToken)
+	tour.expect(http.StatusOK, "GET", api+"/admin/ip-rules", nil, adminToken)
+	tour.expect(http.StatusBadRequest, "POST", api+"/admin/ip-rules", map[string]string{"action": "deny", "cidr": "not an address"}, adminToken)
+	tour.expect(http.StatusOK, "GET", api+"/admin/debug-logging", nil, adminToken)
+	rule := tour.expect(http.StatusCreated, "POST", api+"/admin/debug-logging", map[string]interface{}{"userId": user.ID, "durationMinutes": 5}, adminToken)
+	tour.expect(http.StatusOK, "DELETE", fmt.Sprintf("%s/admin/debug-logging/%d", api, id(t, rule, "id")), nil, adminToken)
+	tour.expect(http.StatusOK, "GET", api+"/admin/reports/schedules", nil, adminToken)
+	schedule := tour.expect(http.StatusCreated, "POST", api+"/admin/reports/schedules", map[string]interface{}{"frequency": "weekly", "weekday": 1, "hour": 8, "recipients": []string{"ops@example.com"}}, adminToken)
+	tour.expect(http.StatusOK, "DELETE", fmt.Sprintf("%s/admin/reports/schedules/%d", api, id(t, schedule, "id")), nil, adminToken)
+	tour.expect(http.StatusOK, "GET", api+"/admin/analytics", nil, adminToken)
+	tour.expect(http.StatusOK, "GET", api+"/admin/email-stats", nil, adminToken)
+	dsar := tour.expect(http.StatusCreated, "POST", api+"/admin/dsar", map[string]interface{}{"subjectUserId": user.ID, "type": "access"}, adminToken)
+	tour.expect(http.StatusOK, "GET", api+"/admin/dsar", nil, adminToken)
+	tour.expect(http.StatusOK, "GET", fmt.Sprintf("%s/admin/dsar/%d", api, id(t, dsar, "id")), nil, adminToken)
+	tour.expect(http.StatusNotFound, "GET", api+"/admin/dsar/999999", nil, adminToken)
+
+	// Deletion
+	tour.expect(http.StatusOK, "POST", users+"/erase", map[string]string{"mode": "soft"}, adminToken)
+	tour.expect(http.StatusOK, "GET", api+"/admin/users/deleted", nil, adminToken)
+	tour.expect(http.StatusOK, "POST", users+"/restore", nil, adminToken)
+	tour.expect(http.StatusConflict, "POST", users+"/restore", nil, adminToken)
+	tour.expect(http.StatusConflict, "DELETE", users+"/purge", nil, adminToken)
+	tour.expect(http.StatusOK, "POST", users+"/erase", nil, adminToken)
+	tour.expect(http.StatusOK, "DELETE", users+"/purge", nil, adminToken)
+	tour.expect(http.StatusNotFound, "POST", users+"/erase", nil, adminToken)
+
+	// Signing out
+	tour.expect(http.StatusOK, "POST", api+"/auth/logout", map[string]string{"refresh_token": adminTokens.RefreshToken}, adminToken)
+	tour.expect(http.StatusUnauthorized, "GET", api+"/users/profile", nil, adminToken)
+	tour.expect(http.StatusOK, "POST", api+"/users/deactivate", nil, srv.Login(t, "grace", testPassword).AccessToken)
+	tour.expect(http.StatusForbidden, "POST", api+"/auth/login", map[string]string{"login": "grace", "password": testPassword}, "")
+
+	if testing.Verbose() {
+		for _, op := range srv.Contract.Uncovered() {
+			t.Logf("not covered: %s", op)
+		}
+	}
+}
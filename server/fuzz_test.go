@@ -0,0 +1,458 @@
+package server_test
+
+import (
+	"api/internal/middleware/authtest"
+	"api/testutil"
+	"api/testutil/contract"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fuzzSpec is the part of a generated Swagger document the fuzz cases are built from
+type fuzzSpec struct {
+	BasePath    string                           `json:"basePath"`
+	Paths       map[string]map[string]fuzzSpecOp `json:"paths"`
+	Definitions map[string]fuzzSchema            `json:"definitions"`
+}
+
+type fuzzSpecOp struct {
+	Parameters []fuzzParameter       `json:"parameters"`
+	Security   []map[string][]string `json:"security"`
+}
+
+type fuzzParameter struct {
+	Name   string      `json:"name"`
+	In     string      `json:"in"` // path, query, header, body or formData
+	Type   string      `json:"type"`
+	Schema *fuzzSchema `json:"schema"`
+}
+
+type fuzzSchema struct {
+	Ref        string                `json:"$ref"`
+	Type       string                `json:"type"`
+	Format     string                `json:"format"`
+	Properties map[string]fuzzSchema `json:"properties"`
+	Enum       []interface{}         `json:"enum"`
+}
+
+// specParam matches the {param} placeholders of a spec path
+var specParam = regexp.MustCompile(`\{(\w+)\}`)
+
+func loadFuzzSpec(t *testing.T, path string) *fuzzSpec {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s fuzzSpec
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return &s
+}
+
+// resolve follows a local $ref such as #/definitions/handlers.LoginRequest
+func (s *fuzzSpec) resolve(sc *fuzzSchema) *fuzzSchema {
+	for depth := 0; sc != nil && sc.Ref != "" && depth < 10; depth++ {
+		def, ok := s.Definitions[strings.TrimPrefix(sc.Ref, "#/definitions/")]
+		if !ok {
+			return nil
+		}
+		sc = &def
+	}
+	return sc
+}
+
+// fuzzOperation is one method of one path in the spec
+type fuzzOperation struct {
+	method  string
+	path    string // below the base path, with {param} placeholders
+	params  []fuzzParameter
+	secured bool
+}
+
+func (s *fuzzSpec) operations() []fuzzOperation {
+	var ops []fuzzOperation
+	for path, methods := range s.Paths {
+		for method, raw := range methods {
+			ops = append(ops, fuzzOperation{
+				method:  strings.ToUpper(method),
+				path:    path,
+				params:  raw.Parameters,
+				secured: len(raw.Security) > 0,
+			})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].path != ops[j].path {
+			return ops[i].path < ops[j].path
+		}
+		return ops[i].method < ops[j].method
+	})
+	return ops
+}
+
+// fuzzCase is one malformed request for an operation
+type fuzzCase struct {
+	name        string
+	path        string // concrete path below the base path
+	query       url.Values
+	contentType string
+	body        []byte
+}
+
+// oversized is longer than any string field the API accepts
+var oversized = strings.Repeat("a", 64*1024)
+
+// badPathValues are invalid or extreme values for path parameters; all IDs are numeric
+var badPathValues = map[string]string{
+	"zero":      "0",
+	"negative":  "-1",
+	"text":      "abc",
+	"fraction":  "1.5",
+	"overflow":  "18446744073709551616",
+	"long":      strings.Repeat("9", 400),
+	"nul":       "\x00",
+	"oversized": strings.Repeat("a", 4096),
+}
+
+// badQueryValues are invalid or extreme query values by declared type
+var badQueryValues = map[string]map[string]string{
+	"integer": {"text": "abc", "negative": "-1", "overflow": "99999999999999999999", "exponent": "1e3"},
+	"number":  {"text": "abc", "infinity": "Inf", "nan": "NaN"},
+	"boolean": {"text": "maybe", "number": "2"},
+	"string":  {"oversized": strings.Repeat("a", 8*1024), "nul": "\x00", "injection": "' OR 1=1--"},
+}
+
+// rawBodies are request bodies that are not a JSON object
+var rawBodies = map[string]string{
+	"empty":       "",
+	"truncated":   `{"a":`,
+	"null":        "null",
+	"array":       "[]",
+	"string":      `"text"`,
+	"number":      "42",
+	"deep":        strings.Repeat("[", 10000) + strings.Repeat("]", 10000),
+	"invalid utf": "{\"a\":\"\xff\xfe\"}",
+}
+
+// badFieldValues are JSON values that are wrong or extreme for a field of the given type
+func badFieldValues(field *fuzzSchema) map[string]string {
+	values := map[string]string{"null": "null", "object": "{}"}
+	switch field.Type {
+	case "integer", "number":
+		values["string"] = `"1"`
+		values["negative"] = "-1"
+		values["zero"] = "0"
+		values["int32 overflow"] = "2147483648"
+		values["int64 overflow"] = "9223372036854775808"
+		values["huge"] = "1e400"
+		values["fraction"] = "1.5"
+	case "boolean":
+		values["string"] = `"true"`
+		values["number"] = "2"
+	case "array":
+		values["string"] = `"text"`
+		values["null items"] = "[null]"
+		values["many items"] = "[" + strings.TrimSuffix(strings.Repeat("0,", 10000), ",") + "]"
+	case "object":
+		values["array"] = "[]"
+		values["string"] = `"text"`
+	default:
+		values["number"] = "123"
+		values["array"] = `["a"]`
+		values["empty"] = `""`
+		values["oversized"] = strconv.Quote(oversized)
+		values["nul"] = `"\u0000"`
+		values["control"] = `"\u0007\u001b[2J"`
+		if field.Format == "date-time" {
+			values["bad date"] = `"2025-13-45T99:00:00Z"`
+			values["year zero"] = `"0000-01-01T00:00:00Z"`
+		}
+		if len(field.Enum) > 0 {
+			values["not in enum"] = `"not-an-allowed-value"`
+		}
+	}
+	return values
+}
+
+// cases returns the malformed requests for op. Path parameters that are not being
+// fuzzed are set to pathID so the request reaches the handler's own validation.
+func (op fuzzOperation) cases(s *fuzzSpec, pathID string) []fuzzCase {
+	var cases []fuzzCase
+	var bodySchema *fuzzSchema
+	hasForm := false
+	for i := range op.params {
+		switch p := op.params[i]; p.In {
+		case "body":
+			bodySchema = s.resolve(p.Schema)
+		case "formData":
+			hasForm = true
+		}
+	}
+	validBody := sampleBody(s, bodySchema)
+
+	// Path parameters
+	for _, p := range op.params {
+		if p.In != "path" {
+			continue
+		}
+		for _, name := range sortedKeys(badPathValues) {
+			cases = append(cases, fuzzCase{
+				name:        "path " + p.Name + " " + name,
+				path:        op.concretePath(pathID, map[string]string{p.Name: badPathValues[name]}),
+				contentType: "application/json",
+				body:        validBody,
+			})
+		}
+	}
+
+	// Query parameters
+	for _, p := range op.params {
+		if p.In != "query" {
+			continue
+		}
+		values := badQueryValues[p.Type]
+		if values == nil {
+			values = badQueryValues["string"]
+		}
+		for _, name := range sortedKeys(values) {
+			cases = append(cases, fuzzCase{
+				name:  "query " + p.Name + " " + name,
+				path:  op.concretePath(pathID, nil),
+				query: url.Values{p.Name: {values[name]}},
+			})
+		}
+	}
+
+	// Request bodies
+	if bodySchema != nil {
+		for _, name := range sortedKeys(rawBodies) {
+			cases = append(cases, fuzzCase{
+				name:        "body " + name,
+				path:        op.concretePath(pathID, nil),
+				contentType: "application/json",
+				body:        []byte(rawBodies[name]),
+			})
+		}
+		cases = append(cases, fuzzCase{
+			name:        "body oversized",
+			path:        op.concretePath(pathID, nil),
+			contentType: "application/json",
+			body:        []byte(`{"padding":"` + strings.Repeat(oversized, 32) + `"}`),
+		})
+		for _, field := range sortedKeys(bodySchema.Properties) {
+			prop := bodySchema.Properties[field]
+			fieldSchema := s.resolve(&prop)
+			if fieldSchema == nil {
+				continue
+			}
+			values := badFieldValues(fieldSchema)
+			for _, name := range sortedKeys(values) {
+				cases = append(cases, fuzzCase{
+					name:        "field " + field + " " + name,
+					path:        op.concretePath(pathID, nil),
+					contentType: "application/json",
+					body:        withField(validBody, field, values[name]),
+				})
+			}
+		}
+	}
+
+	// Multipart uploads
+	if hasForm {
+		cases = append(cases,
+			fuzzCase{name: "form as json", path: op.concretePath(pathID, nil), contentType: "application/json", body: []byte("{}")},
+			fuzzCase{name: "form garbage", path: op.concretePath(pathID, nil), contentType: "multipart/form-data; boundary=fuzz", body: []byte("--fuzz\r\nnot a part")},
+			fuzzCase{name: "form empty", path: op.concretePath(pathID, nil), contentType: "multipart/form-data; boundary=fuzz", body: []byte("--fuzz--\r\n")},
+		)
+	}
+
+	// Operations without inputs still get one plain request
+	if len(cases) == 0 {
+		cases = append(cases, fuzzCase{name: "plain", path: op.concretePath(pathID, nil)})
+	}
+	return cases
+}
+
+// concretePath fills the path placeholders from overrides, falling back to pathID
+func (op fuzzOperation) concretePath(pathID string, overrides map[string]string) string {
+	parts := strings.Split(op.path, "/")
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			continue
+		}
+		name := part[1 : len(part)-1]
+		value, ok := overrides[name]
+		if !ok {
+			value = pathID
+		}
+		parts[i] = url.PathEscape(value)
+	}
+	return strings.Join(parts, "/")
+}
+
+// sampleBody builds a well-formed body for sc with a plausible value for every field,
+// so each field case changes only the field under test
+func sampleBody(s *fuzzSpec, sc *fuzzSchema) []byte {
+	if sc == nil || len(sc.Properties) == 0 {
+		return []byte("{}")
+	}
+	body := make(map[string]interface{}, len(sc.Properties))
+	for name, prop := range sc.Properties {
+		body[name] = sampleValue(s, &prop, 0)
+	}
+	data, _ := json.Marshal(body)
+	return data
+}
+
+func sampleValue(s *fuzzSpec, sc *fuzzSchema, depth int) interface{} {
+	sc = s.resolve(sc)
+	if sc == nil || depth > 3 {
+		return nil
+	}
+	if len(sc.Enum) > 0 {
+		return sc.Enum[0]
+	}
+	switch sc.Type {
+	case "integer", "number":
+		return 1
+	case "boolean":
+		return false
+	case "array":
+		return []interface{}{}
+	case "object":
+		obj := map[string]interface{}{}
+		for name, prop := range sc.Properties {
+			obj[name] = sampleValue(s, &prop, depth+1)
+		}
+		return obj
+	}
+	if sc.Format == "date-time" {
+		return "2030-01-01T00:00:00Z"
+	}
+	return "fuzz"
+}
+
+// withField returns body with field replaced by the raw JSON value
+func withField(body []byte, field, value string) []byte {
+	obj := map[string]json.RawMessage{}
+	_ = json.Unmarshal(body, &obj)
+	obj[field] = json.RawMessage(value)
+	data, err := json.Marshal(obj)
+	if err != nil {
+		// Values json.Marshal rejects, such as 1e400, are spliced in as text
+		obj[field] = json.RawMessage("0")
+		data, _ = json.Marshal(obj)
+		return []byte(strings.Replace(string(data), strconv.Quote(field)+":0", strconv.Quote(field)+":"+value, 1))
+	}
+	return data
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// structuredError describes how a 4xx body differs from {"error": "..."}, or GraphQL's
+// {"errors": [{"message": "..."}]}, or returns "" if it does not
+func structuredError(contentType string, data []byte) string {
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "application/json" {
+		return "without a JSON body"
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return "with a body that is not a JSON object"
+	}
+	if message, _ := body["error"].(string); message != "" {
+		return ""
+	}
+	if errors, _ := body["errors"].([]interface{}); len(errors) > 0 {
+		if first, _ := errors[0].(map[string]interface{}); first != nil {
+			if message, _ := first["message"].(string); message != "" {
+				return ""
+			}
+		}
+	}
+	return "without an error message"
+}
+
+func snippet(data []byte) string {
+	if len(data) > 200 {
+		return string(data[:200]) + "..."
+	}
+	return string(data)
+}
+
+// TestMalformedRequests sends every documented operation of every API version invalid
+// path and query parameters, bodies that are not JSON objects, fields of the wrong
+// type, oversized strings and boundary numbers. It fails for any 5xx, dropped
+// connection, or 4xx without the usual {"error": "..."} JSON body. Protected
+// operations are called as an admin, with a fresh access token every request, so the
+// cases reach the handlers' own validation; path parameters not being fuzzed point at
+// a user of its own.
+func TestMalformedRequests(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	target := srv.CreateUser(t, "target@example.com", testPassword, "user")
+	root := srv.CreateUser(t, "root@example.com", testPassword, "admin")
+	pathID := strconv.FormatUint(uint64(target.ID), 10)
+
+	v1 := contract.SpecPath()
+	for _, specPath := range []string{v1, filepath.Join(filepath.Dir(v1), "v2", "v2_swagger.json")} {
+		spec := loadFuzzSpec(t, specPath)
+		for _, op := range spec.operations() {
+			base := spec.BasePath
+			if outsideBasePath[specParam.ReplaceAllString(op.path, ":$1")] {
+				base = ""
+			}
+			t.Run(op.method+" "+base+op.path, func(t *testing.T) {
+				for _, c := range op.cases(spec, pathID) {
+					target := srv.URL + base + c.path
+					if len(c.query) > 0 {
+						target += "?" + c.query.Encode()
+					}
+					req, err := http.NewRequest(op.method, target, bytes.NewReader(c.body))
+					if err != nil {
+						t.Fatalf("[%s]: %v", c.name, err)
+					}
+					if c.contentType != "" {
+						req.Header.Set("Content-Type", c.contentType)
+					}
+					if op.secured {
+						req.Header.Set("Authorization", "Bearer "+srv.AccessToken(t, authtest.Admin(root.ID)))
+					}
+					resp, err := srv.Client().Do(req)
+					if err != nil {
+						t.Errorf("[%s]: no response: %v", c.name, err)
+						continue
+					}
+					data, _ := io.ReadAll(resp.Body)
+					resp.Body.Close()
+					switch {
+					case resp.StatusCode >= 500:
+						t.Errorf("[%s]: status %d: %s", c.name, resp.StatusCode, snippet(data))
+					case resp.StatusCode >= 400:
+						if problem := structuredError(resp.Header.Get("Content-Type"), data); problem != "" {
+							t.Errorf("[%s]: status %d %s: %s", c.name, resp.StatusCode, problem, snippet(data))
+						}
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package server_test
+
+import (
+	"api/testutil"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// graphQLResponse is the body of a GraphQL response with data decoded into T
+type graphQLResponse[T any] struct {
+	Data   T `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// code is the extensions code of the first error, "" when there is none
+func (r graphQLResponse[T]) code() string {
+	if len(r.Errors) == 0 {
+		return ""
+	}
+	code, _ := r.Errors[0].Extensions["code"].(string)
+	return code
+}
+
+// graphQL posts query with variables to /api/v1/graphql, failing the test unless it
+// answers 200
+func graphQL[T any](t *testing.T, srv *testutil.Server, token, query string, variables map[string]interface{}) graphQLResponse[T] {
+	t.Helper()
+	resp, body := srv.Do(t, http.MethodPost, "/api/v1/graphql", map[string]interface{}{"query": query, "variables": variables}, token)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("graphql: %d %s", resp.StatusCode, body)
+	}
+	var response graphQLResponse[T]
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+type graphQLUser struct {
+	ID      string `json:"id"`
+	Email   string `json:"email"`
+	Profile struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+		Timezone  string `json:"timezone"`
+	} `json:"profile"`
+}
+
+func TestGraphQLRequiresAccessToken(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+
+	resp, body := srv.Do(t, http.MethodPost, "/api/v1/graphql", map[string]string{"query": "{ viewer { id } }"}, "")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("query without a token: %d %s, want 401", resp.StatusCode, body)
+	}
+}
+
+func TestGraphQLViewerAndProfileUpdate(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	user := srv.CreateUser(t, testEmail, testPassword, "user")
+	token := srv.Login(t, testEmail, testPassword).AccessToken
+
+	const update = `mutation($input: ProfileInput!) { updateProfile(input: $input) { firstName lastName timezone } }`
+	updated := graphQL[struct {
+		UpdateProfile struct {
+			FirstName string `json:"firstName"`
+			Timezone  string `json:"timezone"`
+		} `json:"updateProfile"`
+	}](t, srv, token, update, map[string]interface{}{"input": map[string]string{"firstName": "Ada", "timezone": "Europe/London"}})
+	if len(updated.Errors) > 0 || updated.Data.UpdateProfile.FirstName != "Ada" {
+		t.Fatalf("updateProfile: %+v", updated)
+	}
+	// Omitted fields keep their value
+	graphQL[json.RawMessage](t, srv, token, update, map[string]interface{}{"input": map[string]string{"lastName": "Lovelace"}})
+
+	viewer := graphQL[struct {
+		Viewer graphQLUser `json:"viewer"`
+	}](t, srv, token, `{ viewer { id email profile { firstName lastName timezone } } }`, nil)
+	if len(viewer.Errors) > 0 {
+		t.Fatalf("viewer: %+v", viewer.Errors)
+	}
+	got := viewer.Data.Viewer
+	if got.Email != user.Email || got.Profile.FirstName != "Ada" || got.Profile.LastName != "Lovelace" || got.Profile.Timezone != "Europe/London" {
+		t.Errorf("viewer %+v, want %s with the updated profile", got, user.Email)
+	}
+
+	invalid := graphQL[json.RawMessage](t, srv, token, update, map[string]interface{}{"input": map[string]string{"timezone": "Mars/Olympus"}})
+	if invalid.code() != "invalid_input" {
+		t.Errorf("updateProfile with an unknown timezone: %+v, want code invalid_input", invalid.Errors)
+	}
+	invalid = graphQL[json.RawMessage](t, srv, token, update, map[string]interface{}{"input": map[string]string{"avatarURL": "javascript:alert(1)"}})
+	if invalid.code() != "invalid_input" {
+		t.Errorf("updateProfile with a non-HTTP avatar URL: %+v, want code invalid_input", invalid.Errors)
+	}
+}
+
+type graphQLUsers struct {
+	Users struct {
+		Nodes    []graphQLUser `json:"nodes"`
+		PageInfo struct {
+			EndCursor   *string `json:"endCursor"`
+			HasNextPage bool    `json:"hasNextPage"`
+		} `json:"pageInfo"`
+	} `json:"users"`
+}
+
+const usersQuery = `query($filter: UserFilter, $first: Int, $after: String) {
+	users(filter: $filter, first: $first, after: $after) { nodes { id email } pageInfo { endCursor hasNextPage } }
+}`
+
+func TestGraphQLUsersIsForAdmins(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	srv.CreateUser(t, testEmail, testPassword, "user")
+	token := srv.Login(t, testEmail, testPassword).AccessToken
+
+	response := graphQL[json.RawMessage](t, srv, token, usersQuery, nil)
+	if response.code() != "forbidden" {
+		t.Errorf("users as a user: %+v, want code forbidden", response.Errors)
+	}
+}
+
+func TestGraphQLUsersFiltersAndPages(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	srv.CreateUser(t, "root@example.com", testPassword, "admin")
+	srv.CreateUser(t, "grace@example.com", testPassword, "user")
+	srv.CreateUser(t, testEmail, testPassword, "user")
+	srv.CreateUser(t, "alan@example.com", testPassword, "user")
+	token := srv.Login(t, "root@example.com", testPassword).AccessToken
+
+	var emails []string
+	variables := map[string]interface{}{"filter": map[string]string{"role": "user"}, "first": 2}
+	for page := 0; ; page++ {
+		response := graphQL[graphQLUsers](t, srv, token, usersQuery, variables)
+		if len(response.Errors) > 0 {
+			t.Fatalf("users: %+v", response.Errors)
+		}
+		for _, user := range response.Data.Users.Nodes {
+			emails = append(emails, user.Email)
+		}
+		if !response.Data.Users.PageInfo.HasNextPage {
+			break
+		}
+		if page == 3 {
+			t.Fatal("users keeps announcing another page")
+		}
+		variables["after"] = *response.Data.Users.PageInfo.EndCursor
+	}
+	want := []string{"grace@example.com", testEmail, "alan@example.com"}
+	if len(emails) != len(want) {
+		t.Fatalf("users with role user %v, want %v", emails, want)
+	}
+	for i := range want {
+		if emails[i] != want[i] {
+			t.Errorf("users with role user %v, want %v", emails, want)
+			break
+		}
+	}
+
+	response := graphQL[json.RawMessage](t, srv, token, usersQuery, map[string]interface{}{"first": 500})
+	if response.code() != "invalid_input" {
+		t.Errorf("users with first 500: %+v, want code invalid_input", response.Errors)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"api/internal/database"
+	"api/internal/models"
+	"api/internal/repository"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+// Migrate creates the tables of the models and adds missing columns and indexes. On
+// Postgres it also upgrades columns created by earlier versions and installs the
+// search indexes.
+func Migrate(db *gorm.DB, logger *logrus.Logger) error {
+	db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.UserProfile{}, &models.EmailEvent{}, &models.TokenRevocation{}, &models.APIKey{},
+		&models.APIKeyUsage{}, &models.APIKeyFingerprint{}, &models.ShareToken{}, &models.SecurityEvent{},
+		&models.AuditEntry{}, &models.CacheVersion{}, &models.WebhookEvent{},
+		&models.ExportJob{}, &models.DSARRequest{}, &models.DSAREvent{},
+		&models.NotificationPreferences{}, &models.UserSettings{}, &models.KnownLogin{}, &models.PasswordReset{}, &models.EmailChange{}, &models.AccountReactivation{},
+		&models.ReportSchedule{}, &models.PasswordHistory{}, &models.TrustedDevice{}, &models.DeviceConfirmation{},
+		&models.ExternalLogin{}, &models.ExternalLoginConfirmation{},
+		&models.Organization{}, &models.Membership{}, &models.OrganizationInvitation{}, &models.OwnershipTransfer{}, &models.RegistrationInvitation{},
+		&models.Group{}, &models.GroupMember{}, &models.IPRule{}, &models.LoginLocation{}, &models.ImportJob{},
+		&models.AttributeDefinition{}, &models.UserAttribute{}, &models.LoginEvent{}, &models.AnalyticsDay{}, &models.AnalyticsCohort{}, &models.FeatureFlag{})
+
+	// The rest upgrades and tunes Postgres databases; MySQL and SQLite ones were created
+	// with today's columns and search falls back to plain matching there
+	if db.Dialect().GetName() != database.Postgres {
+		return nil
+	}
+
+	// Encrypted values outgrow the varchar limits these columns were created with
+	for _, column := range []string{"preferred_name", "pronouns"} {
+		var dataType string
+		db.Raw("SELECT data_type FROM information_schema.columns WHERE table_name = 'user_profiles' AND column_name = ?", column).Row().Scan(&dataType)
+		if dataType == "text" {
+			continue
+		}
+		if err := db.Model(&models.UserProfile{}).ModifyColumn(column, "text").Error; err != nil {
+			return fmt.Errorf("migrate encrypted column %s: %w", column, err)
+		}
+	}
+
+	// Fuzzy user search needs the pg_trgm extension, which the database user may not be
+	// allowed to install; everything else works without it
+	if err := repository.CreateUserSearchIndexes(db); err != nil {
+		logger.WithError(err).Warn("User search indexes could not be created; install pg_trgm for /admin/users/search")
+	}
+
+	return nil
+}
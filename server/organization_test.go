@@ -0,0 +1,154 @@
+package server_test
+
+import (
+	"api/internal/auth"
+	"api/internal/models"
+	"api/testutil"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newOrganization has owner create an organization with member in it, and returns its
+// ID with a token of owner acting for it
+func newOrganization(t *testing.T, srv *testutil.Server, owner, member *models.User) (uint, string) {
+	t.Helper()
+	tokens := srv.Login(t, owner.Email, testPassword)
+	resp, body := srv.Do(t, http.MethodPost, "/api/v1/organizations", map[string]string{"name": "Acme Inc.", "slug": "acme"}, tokens.AccessToken)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create organization: %d %s", resp.StatusCode, body)
+	}
+	var org struct {
+		ID uint `json:"id"`
+	}
+	if err := json.Unmarshal(body, &org); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.DB.Create(&models.Membership{OrganizationID: org.ID, UserID: member.ID, Role: models.OrgRoleMember}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// A new session acts for the organization
+	return org.ID, srv.Login(t, owner.Email, testPassword).AccessToken
+}
+
+// offerOwnership transfers the organization to recipient and sets the token of the
+// link mailed to them
+func offerOwnership(t *testing.T, srv *testutil.Server, orgID uint, ownerToken string, recipient *models.User, token string) {
+	t.Helper()
+	path := fmt.Sprintf("/api/v1/organizations/%d/transfer-ownership", orgID)
+	resp, body := srv.Do(t, http.MethodPost, path, map[string]uint{"userId": recipient.ID}, ownerToken)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("transfer ownership: %d %s", resp.StatusCode, body)
+	}
+	var transfer struct {
+		ID uint `json:"id"`
+	}
+	if err := json.Unmarshal(body, &transfer); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.DB.Model(&models.OwnershipTransfer{}).Where("id = ?", transfer.ID).
+		Update("token_digest", auth.HashToken(token)).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func membershipRole(t *testing.T, srv *testutil.Server, orgID, userID uint) string {
+	t.Helper()
+	var membership models.Membership
+	if err := srv.DB.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error; err != nil {
+		t.Fatal(err)
+	}
+	return membership.Role
+}
+
+func TestOrganizationOwnershipTransfer(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	owner := srv.CreateUser(t, testEmail, testPassword, "user")
+	member := srv.CreateUser(t, "grace@example.com", testPassword, "user")
+	orgID, ownerToken := newOrganization(t, srv, owner, member)
+
+	const token = "ownership-transfer-token"
+	offerOwnership(t, srv, orgID, ownerToken, member, token)
+	if role := membershipRole(t, srv, orgID, owner.ID); role != models.OrgRoleOwner {
+		t.Errorf("owner's role %q before the transfer is accepted, want owner", role)
+	}
+
+	// The link only works for the member it was sent to
+	if resp, body := srv.Do(t, http.MethodPost, "/api/v1/organizations/ownership-transfers/accept", map[string]string{"token": token}, ownerToken); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("accepting as the owner: %d %s, want 400", resp.StatusCode, body)
+	}
+	memberToken := srv.Login(t, member.Email, testPassword).AccessToken
+	resp, body := srv.Do(t, http.MethodPost, "/api/v1/organizations/ownership-transfers/accept", map[string]string{"token": token}, memberToken)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("accept: %d %s", resp.StatusCode, body)
+	}
+	if resp, _ := srv.Do(t, http.MethodPost, "/api/v1/organizations/ownership-transfers/accept", map[string]string{"token": token}, srv.Login(t, member.Email, testPassword).AccessToken); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("accepting twice: %d, want 400", resp.StatusCode)
+	}
+
+	if role := membershipRole(t, srv, orgID, member.ID); role != models.OrgRoleOwner {
+		t.Errorf("new owner's role %q, want owner", role)
+	}
+	if role := membershipRole(t, srv, orgID, owner.ID); role != models.OrgRoleAdmin {
+		t.Errorf("previous owner's role %q, want admin", role)
+	}
+	var audit int
+	if err := srv.DB.Model(&models.AuditEntry{}).
+		Where("entity = ? AND entity_id = ? AND action = ? AND actor_id = ?", "organization", orgID, "transfer_ownership", member.ID).
+		Count(&audit).Error; err != nil {
+		t.Fatal(err)
+	}
+	if audit != 2 {
+		t.Errorf("%d audit entries, want one for each member", audit)
+	}
+	// The previous owner's token still claimed the owner role
+	path := fmt.Sprintf("/api/v1/organizations/%d/transfer-ownership", orgID)
+	if resp, body := srv.Do(t, http.MethodPost, path, map[string]uint{"userId": owner.ID}, ownerToken); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("transferring again with the previous owner's token: %d %s, want 401", resp.StatusCode, body)
+	}
+}
+
+func TestOrganizationOwnershipTransferExpires(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	owner := srv.CreateUser(t, testEmail, testPassword, "user")
+	member := srv.CreateUser(t, "grace@example.com", testPassword, "user")
+	orgID, ownerToken := newOrganization(t, srv, owner, member)
+
+	const token = "ownership-transfer-token"
+	offerOwnership(t, srv, orgID, ownerToken, member, token)
+	if err := srv.DB.Model(&models.OwnershipTransfer{}).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	memberToken := srv.Login(t, member.Email, testPassword).AccessToken
+	if resp, body := srv.Do(t, http.MethodPost, "/api/v1/organizations/ownership-transfers/accept", map[string]string{"token": token}, memberToken); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("accepting an expired transfer: %d %s, want 400", resp.StatusCode, body)
+	}
+	if role := membershipRole(t, srv, orgID, owner.ID); role != models.OrgRoleOwner {
+		t.Errorf("owner's role %q after an expired transfer, want owner", role)
+	}
+}
+
+func TestOrganizationOwnershipTransferToMembersOnly(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	owner := srv.CreateUser(t, testEmail, testPassword, "user")
+	member := srv.CreateUser(t, "grace@example.com", testPassword, "user")
+	outsider := srv.CreateUser(t, "mallory@example.com", testPassword, "user")
+	orgID, ownerToken := newOrganization(t, srv, owner, member)
+
+	path := fmt.Sprintf("/api/v1/organizations/%d/transfer-ownership", orgID)
+	for _, recipient := range []*models.User{owner, outsider} {
+		if resp, body := srv.Do(t, http.MethodPost, path, map[string]uint{"userId": recipient.ID}, ownerToken); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("transferring to %s: %d %s, want 400", recipient.Email, resp.StatusCode, body)
+		}
+	}
+	// Only the owner may transfer
+	if err := srv.DB.Model(&models.Membership{}).Where("user_id = ?", member.ID).Update("role", models.OrgRoleAdmin).Error; err != nil {
+		t.Fatal(err)
+	}
+	memberToken := srv.Login(t, member.Email, testPassword).AccessToken
+	if resp, body := srv.Do(t, http.MethodPost, path, map[string]uint{"userId": owner.ID}, memberToken); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("transferring as an admin: %d %s, want 403", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,161 @@
+package server_test
+
+import (
+	"api/testutil"
+	"api/testutil/contract"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// apiSpec is the part of a generated Swagger document the route checks read
+type apiSpec struct {
+	BasePath string                              `json:"basePath"`
+	Paths    map[string]map[string]specOperation `json:"paths"`
+}
+
+type specOperation struct {
+	Parameters []struct {
+		Name string `json:"name"`
+		In   string `json:"in"`
+	} `json:"parameters"`
+	Security []map[string][]string `json:"security"`
+}
+
+// schemes returns the names of the security schemes the operation accepts, sorted
+func (o specOperation) schemes() []string {
+	var names []string
+	for _, requirement := range o.Security {
+		for name := range requirement {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func loadSpec(t *testing.T, path string) apiSpec {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec apiSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return spec
+}
+
+// apiSpecs are the documents of every API version: v1 in docs/swagger.json, v2 in
+// docs/v2/v2_swagger.json
+func apiSpecs(t *testing.T) []apiSpec {
+	t.Helper()
+	v1 := contract.SpecPath()
+	return []apiSpec{
+		loadSpec(t, v1),
+		loadSpec(t, filepath.Join(filepath.Dir(v1), "v2", "v2_swagger.json")),
+	}
+}
+
+// outsideBasePath lists routes served at the root rather than below the v1 base path.
+// Swagger 2.0 cannot describe a path outside it, so they are documented as if they
+// were below it.
+var outsideBasePath = map[string]bool{"/media/avatars/:id": true, "/.well-known/jwks.json": true}
+
+var ginParam = regexp.MustCompile(`[:*](\w+)`)
+
+// specFor returns the spec documenting a gin route and the route's path within it.
+// Routes outside every base path, such as the docs and the Swagger UI, have none.
+func specFor(specs []apiSpec, path string) (apiSpec, string, bool) {
+	if outsideBasePath[path] {
+		return specs[0], path, true
+	}
+	for _, spec := range specs {
+		if strings.HasPrefix(path, spec.BasePath+"/") {
+			return spec, strings.TrimPrefix(path, spec.BasePath), true
+		}
+	}
+	return apiSpec{}, "", false
+}
+
+// samplePath fills every parameter of a gin path with 1
+func samplePath(path string) string {
+	return ginParam.ReplaceAllString(path, "1")
+}
+
+// routeSchemes finds the credentials a route accepts by asking it anonymously, and
+// then with an API key that does not exist: the auth middleware asks for a bearer
+// token, and the one also accepting API keys rejects the key
+func routeSchemes(t *testing.T, srv *testutil.Server, method, path string) []string {
+	t.Helper()
+	resp, body := srv.Do(t, method, samplePath(path), nil, "")
+	if resp.StatusCode != http.StatusUnauthorized || !bytes.Contains(body, []byte("Authorization header required")) {
+		return nil
+	}
+	resp, body = srv.DoWithHeader(t, method, samplePath(path), nil, http.Header{"X-Api-Key": {"uma_unknown"}})
+	if resp.StatusCode == http.StatusUnauthorized && bytes.Contains(body, []byte("Invalid API key")) {
+		return []string{"ApiKey", "Bearer"}
+	}
+	return []string{"Bearer"}
+}
+
+// TestRoutesMatchSpec walks the routes the router registered and fails for any route
+// without a documented operation, any operation without a route, path parameters
+// that differ, and documented credentials the route does not take
+func TestRoutesMatchSpec(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	specs := apiSpecs(t)
+
+	registered := map[string]bool{}
+	for _, route := range srv.Router.Routes() {
+		spec, path, ok := specFor(specs, route.Path)
+		if !ok {
+			continue
+		}
+		specPath := ginParam.ReplaceAllString(path, "{$1}")
+		operation, ok := spec.Paths[specPath][strings.ToLower(route.Method)]
+		if !ok {
+			t.Errorf("%s %s (%s) is not documented as %s %s%s", route.Method, route.Path, route.Handler, route.Method, spec.BasePath, specPath)
+			continue
+		}
+		registered[route.Method+" "+spec.BasePath+specPath] = true
+
+		var want, got []string
+		for _, m := range ginParam.FindAllStringSubmatch(route.Path, -1) {
+			want = append(want, m[1])
+		}
+		for _, param := range operation.Parameters {
+			if param.In == "path" {
+				got = append(got, param.Name)
+			}
+		}
+		sort.Strings(want)
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s %s documents path parameters %v, want %v", route.Method, route.Path, got, want)
+		}
+
+		schemes := routeSchemes(t, srv, route.Method, route.Path)
+		if documented := operation.schemes(); strings.Join(documented, ",") != strings.Join(schemes, ",") {
+			t.Errorf("%s %s documents security %v but accepts %v", route.Method, route.Path, documented, schemes)
+		}
+	}
+
+	for _, spec := range specs {
+		for path, operations := range spec.Paths {
+			for method := range operations {
+				key := strings.ToUpper(method) + " " + spec.BasePath + path
+				if !registered[key] {
+					t.Errorf("%s is documented but not registered", key)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package server_test
+
+import (
+	"api/config"
+	"api/internal/auth"
+	"api/internal/models"
+	"api/testutil"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/logger"
+)
+
+// testIdP is a SAML identity provider signing in whoever session names
+type testIdP struct {
+	idp     *saml.IdentityProvider
+	sp      *saml.EntityDescriptor
+	session *saml.Session
+}
+
+func (p *testIdP) GetServiceProvider(*http.Request, string) (*saml.EntityDescriptor, error) {
+	return p.sp, nil
+}
+
+func (p *testIdP) GetSession(http.ResponseWriter, *http.Request, *saml.IdpAuthnRequest) *saml.Session {
+	return p.session
+}
+
+// newSAMLServer starts the API with the identity provider acme, which maps the group
+// admins to the admin role
+func newSAMLServer(t *testing.T) (*testutil.Server, *testIdP) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testIdP{}
+	p.idp = &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             certificate,
+		Logger:                  logger.DefaultLogger,
+		MetadataURL:             url.URL{Scheme: "https", Host: "idp.example.com", Path: "/metadata"},
+		SSOURL:                  url.URL{Scheme: "https", Host: "idp.example.com", Path: "/sso"},
+		ServiceProviderProvider: p,
+		SessionProvider:         p,
+	}
+	metadata, err := xml.Marshal(p.idp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadataFile := filepath.Join(t.TempDir(), "idp.xml")
+	if err := os.WriteFile(metadataFile, metadata, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := testutil.NewServer(t, func(cfg *config.Config) {
+		cfg.SAML.Enabled = true
+		cfg.SAML.BaseURL = "http://sp.example.com/api/v1/auth/saml"
+		cfg.SAML.Providers = []config.SAMLProviderConfig{{
+			Name:            "acme",
+			MetadataFile:    metadataFile,
+			EmailAttribute:  "eduPersonPrincipalName",
+			GroupsAttribute: "eduPersonAffiliation",
+			GroupRoles:      []config.GroupRoleConfig{{Group: "admins", Role: "admin"}},
+		}}
+	})
+	resp, body := srv.Do(t, http.MethodGet, "/api/v1/auth/saml/acme/metadata", nil, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("service provider metadata: %d %s", resp.StatusCode, body)
+	}
+	p.sp = &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(body, p.sp); err != nil {
+		t.Fatal(err)
+	}
+	return srv, p
+}
+
+// samlUser is the user the ACS signed in
+type samlUser struct {
+	ID   uint   `json:"id"`
+	Role string `json:"role"`
+}
+
+// signInSAML goes through SAML sign-in as the holder of nameID at the identity
+// provider, with email and groups as attributes, and returns the ACS response
+func signInSAML(t *testing.T, srv *testutil.Server, p *testIdP, nameID, email string, groups ...string) (int, []byte) {
+	t.Helper()
+	now := time.Now()
+	p.session = &saml.Session{
+		ID:         "session-" + nameID,
+		CreateTime: now,
+		ExpireTime: now.Add(time.Hour),
+		Index:      "1",
+		NameID:     nameID,
+		UserEmail:  email,
+		Groups:     groups,
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(srv.URL + "/api/v1/auth/saml/acme/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("login: %d", resp.StatusCode)
+	}
+
+	request, err := saml.NewIdpAuthnRequest(p.idp, httptest.NewRequest(http.MethodGet, resp.Header.Get("Location"), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := request.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(request, p.session); err != nil {
+		t.Fatal(err)
+	}
+	form, err := request.PostBinding()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := url.Values{"SAMLResponse": {form.SAMLResponse}, "RelayState": {form.RelayState}}
+	acs, err := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/auth/saml/acme/acs", strings.NewReader(values.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	acs.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range resp.Cookies() {
+		acs.AddCookie(cookie)
+	}
+	resp, err = client.Do(acs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+// signedInSAML is signInSAML failing the test unless the ACS signs the user in
+func signedInSAML(t *testing.T, srv *testutil.Server, p *testIdP, nameID, email string, groups ...string) samlUser {
+	t.Helper()
+	status, body := signInSAML(t, srv, p, nameID, email, groups...)
+	if status != http.StatusOK {
+		t.Fatalf("SAML sign-in as %s: %d %s", nameID, status, body)
+	}
+	var response struct {
+		User samlUser `json:"user"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatal(err)
+	}
+	return response.User
+}
+
+func TestSAMLFindsProvisionedUserByNameID(t *testing.T) {
+	srv, idp := newSAMLServer(t)
+
+	first := signedInSAML(t, srv, idp, "emp-1001", "grace@example.com", "admins")
+	if first.Role != "admin" {
+		t.Errorf("role of the provisioned user %q, want the mapped admin", first.Role)
+	}
+
+	// The identity provider changed the user's email and groups
+	again := signedInSAML(t, srv, idp, "emp-1001", "grace.hopper@example.com")
+	if again.ID != first.ID {
+		t.Errorf("signed in as user %d, want %d bound to the NameID", again.ID, first.ID)
+	}
+	if again.Role != "user" {
+		t.Errorf("role %q after leaving admins, want user", again.Role)
+	}
+}
+
+func TestSAMLDoesNotTakeOverExistingAccount(t *testing.T) {
+	srv, idp := newSAMLServer(t)
+	for _, role := range []string{"user", "admin"} {
+		t.Run(role, func(t *testing.T) {
+			email := role + "@example.com"
+			existing := srv.CreateUser(t, email, testPassword, role)
+
+			status, body := signInSAML(t, srv, idp, "intruder-"+role, email, "admins")
+			if status != http.StatusForbidden || !strings.Contains(string(body), "link_confirmation_required") {
+				t.Fatalf("SAML sign-in with the email of an existing account: %d %s, want 403 link_confirmation_required", status, body)
+			}
+			var user models.User
+			if err := srv.DB.First(&user, existing.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if user.Role != role || user.AuthSource != models.AuthSourceLocal {
+				t.Errorf("account changed to role %q and source %q", user.Role, user.AuthSource)
+			}
+			srv.Login(t, email, testPassword)
+		})
+	}
+}
+
+func TestSAMLLinksExistingAccountOnceConfirmed(t *testing.T) {
+	srv, idp := newSAMLServer(t)
+	existing := srv.CreateUser(t, testEmail, testPassword, "user")
+
+	if status, body := signInSAML(t, srv, idp, "emp-1002", testEmail, "admins"); status != http.StatusForbidden {
+		t.Fatalf("SAML sign-in before confirming: %d %s, want 403", status, body)
+	}
+	// The token of the link mailed to the account
+	const token = "link-confirmation-token"
+	if err := srv.DB.Model(&models.ExternalLoginConfirmation{}).Where("user_id = ?", existing.ID).
+		Update("token_digest", auth.HashToken(token)).Error; err != nil {
+		t.Fatal(err)
+	}
+	resp, body := srv.Do(t, http.MethodPost, "/api/v1/auth/external-logins/confirm", map[string]string{"token": token}, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("confirm: %d %s", resp.StatusCode, body)
+	}
+	if resp, _ := srv.Do(t, http.MethodPost, "/api/v1/auth/external-logins/confirm", map[string]string{"token": token}, ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("confirming twice: %d, want 400", resp.StatusCode)
+	}
+
+	user := signedInSAML(t, srv, idp, "emp-1002", testEmail, "admins")
+	if user.ID != existing.ID {
+		t.Errorf("signed in as user %d, want the linked %d", user.ID, existing.ID)
+	}
+	if user.Role != "user" {
+		t.Errorf("linked account got role %q from the identity provider, want it to keep user", user.Role)
+	}
+	srv.Login(t, testEmail, testPassword)
+
+	// Another subject of the identity provider claiming the same email is not let in
+	if status, body := signInSAML(t, srv, idp, "emp-6666", testEmail); status != http.StatusForbidden {
+		t.Errorf("SAML sign-in as another NameID with the linked email: %d %s, want 403", status, body)
+	}
+}
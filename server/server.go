@@ -0,0 +1,1061 @@
+// Package server builds the HTTP API: the services, background jobs and routes
+// behind a *gin.Engine. cmd/api runs it on the configured listeners; tests serve it
+// with net/http/httptest, see package testutil.
+package server
+
+import (
+	"api/config"
+	"api/internal/adminui"
+	"api/internal/auth"
+	"api/internal/captcha"
+	"api/internal/compat"
+	"api/internal/database"
+	"api/internal/events"
+	"api/internal/geoip"
+	"api/internal/graph"
+	"api/internal/handlers"
+	handlersv2 "api/internal/handlers/v2"
+	"api/internal/ipfilter"
+	"api/internal/jobs"
+	"api/internal/ldap"
+	"api/internal/logging"
+	"api/internal/mailer"
+	"api/internal/middleware"
+	"api/internal/models"
+	"api/internal/repository"
+	"api/internal/revocation"
+	"api/internal/secrets"
+	"api/internal/service"
+	"api/internal/sso"
+	"api/internal/storage"
+	"api/internal/validation"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+	ginprometheus "github.com/zsais/go-gin-prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+
+	docs "api/docs"
+	docsv2 "api/docs/v2"
+)
+
+// Deps are what the server is built on that outlives it: the database, logging and
+// the process wide sources of configuration and secrets. DB, Logger, LogOutput and
+// DebugFilter are required.
+type Deps struct {
+	DB       *gorm.DB // migrated, see Migrate
+	Replicas *repository.ReadReplicas
+	Logger   *logrus.Logger
+	// LogOutput is where Logger writes, reported by the readiness check, and
+	// DebugFilter its formatter, managed through /admin/debug-logging
+	LogOutput   *logging.Output
+	DebugFilter *logging.DebugFilter
+	// Config reloads the configuration file; nil applies cfg until the server stops
+	Config *config.Watcher
+	// Secrets overrides the JWT secrets of cfg, rotating the signing keys with it; nil
+	// uses those of cfg
+	Secrets *secrets.Store
+	// Stop ends the background work of the server when closed: jobs, the mail queue,
+	// caches kept in sync with the database. Nil runs it for the life of the process.
+	Stop <-chan struct{}
+	// Clock tells the time sessions start and tokens are issued at; nil for the wall
+	// clock
+	Clock auth.Clock
+}
+
+// NewServer builds the services of cfg on deps, starts their background work and
+// returns the router serving the API
+func NewServer(cfg *config.Config, deps Deps) (*gin.Engine, error) {
+	if deps.DB == nil || deps.Logger == nil || deps.LogOutput == nil || deps.DebugFilter == nil {
+		return nil, errors.New("server: DB, Logger, LogOutput and DebugFilter are required")
+	}
+	db := deps.DB
+	logger := deps.Logger
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-deps.Stop // a nil channel blocks forever
+		cancel()
+	}()
+	// Settings that can change while running are applied by the subscribers
+	watchConfig := func(fn func(*config.Config)) {
+		if deps.Config != nil {
+			deps.Config.Subscribe(fn)
+		}
+	}
+
+	// Initialize Gin
+	router := gin.New()
+	// gin trusts forwarding headers from every peer unless told otherwise
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("server.trustedProxies: %w", err)
+	}
+
+	// Initialize Prometheus middleware
+	p := ginprometheus.NewPrometheus("gin")
+	p.Use(router)
+
+	// Initialize Swagger
+	docs.SwaggerInfo.Title = "User Management API"
+	docs.SwaggerInfo.Description = "A complete RESTful API for user management with authentication, authorization, and logging."
+	docs.SwaggerInfo.Version = "1.0"
+	docs.SwaggerInfo.Host = "localhost:8080"
+	docs.SwaggerInfo.BasePath = "/api/v1"
+	docs.SwaggerInfo.Schemes = []string{"http", "https"}
+	docsv2.SwaggerInfov2.Schemes = []string{"http", "https"}
+
+	// Validation rules shared by every request body
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		if err := validation.Register(v); err != nil {
+			return nil, fmt.Errorf("register validation rules: %w", err)
+		}
+	}
+
+	// Middleware
+	router.Use(gin.Recovery())
+	if cfg.Telemetry.Enabled {
+		router.Use(otelgin.Middleware(cfg.Telemetry.ServiceName))
+	}
+	router.Use(middleware.LoggingMiddleware(logger))
+
+	// CORS policy, validated at startup and replaced when the config file changes
+	corsPolicy := func(cfg *config.Config) middleware.CORSPolicy {
+		return middleware.CORSPolicy{
+			AllowOrigins:     cfg.CORS.AllowOrigins,
+			AllowMethods:     cfg.CORS.AllowMethods,
+			AllowHeaders:     cfg.CORS.AllowHeaders,
+			ExposeHeaders:    cfg.CORS.ExposeHeaders,
+			AllowCredentials: cfg.CORS.AllowCredentials,
+			MaxAge:           time.Duration(cfg.CORS.MaxAgeSeconds) * time.Second,
+		}
+	}
+	corsMiddleware, err := middleware.NewCORS(corsPolicy(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CORS configuration: %w", err)
+	}
+	router.Use(corsMiddleware.Handler())
+
+	watchConfig(func(next *config.Config) {
+		if err := corsMiddleware.Update(corsPolicy(next)); err != nil {
+			logger.WithError(err).Error("Ignoring invalid CORS configuration")
+		}
+	})
+
+	// IP allow and deny rules, checked before authentication. Rules from the config file
+	// are replaced when it changes; those managed through the admin API are loaded below.
+	ipRules := func(cfg *config.Config) ([]ipfilter.Rule, error) {
+		rules := make([]ipfilter.Rule, 0, len(cfg.IPFilter.Rules))
+		for i, rule := range cfg.IPFilter.Rules {
+			parsed, err := ipfilter.ParseRule(rule.Path, rule.Action, rule.CIDR)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+			rules = append(rules, parsed)
+		}
+		return rules, nil
+	}
+	ipFilter := ipfilter.NewFilter()
+	staticIPRules, err := ipRules(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP filter configuration: %w", err)
+	}
+	ipFilter.SetStatic(staticIPRules)
+	router.Use(middleware.IPFilterMiddleware(ipFilter))
+
+	watchConfig(func(next *config.Config) {
+		rules, err := ipRules(next)
+		if err != nil {
+			logger.WithError(err).Error("Ignoring invalid IP filter configuration")
+			return
+		}
+		ipFilter.SetStatic(rules)
+	})
+
+	// Cache-Control policies per route
+	cacheRules := make([]middleware.CacheRule, 0, len(cfg.Cache.Rules))
+	for _, rule := range cfg.Cache.Rules {
+		cacheRules = append(cacheRules, middleware.CacheRule{
+			Path:    rule.Path,
+			Methods: rule.Methods,
+			Policy:  rule.Policy,
+		})
+	}
+	router.Use(middleware.CacheControlMiddleware(cacheRules, cfg.Cache.Default))
+
+	// Request body limit; uploads check their own, larger limit
+	router.Use(middleware.BodyLimitMiddleware(int64(cfg.Server.MaxBodyKB)<<10,
+		"/api/v1/users/profile/avatar",
+		"/api/v1/admin/users/import",
+	))
+
+	// Refresh token storage format, switchable during rollouts
+	tokenStore, err := compat.NewRefreshTokenStore(cfg.Compat.RefreshTokenStorage)
+	if err != nil {
+		return nil, fmt.Errorf("invalid refresh token storage mode: %w", err)
+	}
+	logger.WithField("mode", tokenStore.Mode()).Info("Refresh token storage mode")
+	if tokenStore.Mode() != compat.ModeHashed {
+		logger.WithField("mode", tokenStore.Mode()).Warn("Refresh tokens are stored in plaintext; switch compat.refreshTokenStorage to hashed once migrate-refresh-tokens has run")
+	}
+
+	// Media storage backend
+	mediaStorage, err := storage.New(storage.Config{
+		Backend:  cfg.Storage.Backend,
+		LocalDir: cfg.Storage.LocalDir,
+		S3: storage.S3Config{
+			Bucket:          cfg.Storage.S3.Bucket,
+			Region:          cfg.Storage.S3.Region,
+			Endpoint:        cfg.Storage.S3.Endpoint,
+			AccessKeyID:     cfg.Storage.S3.AccessKeyID,
+			SecretAccessKey: cfg.Storage.S3.SecretAccessKey,
+			UsePathStyle:    cfg.Storage.S3.UsePathStyle,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("initialize media storage: %w", err)
+	}
+
+	// Access token blacklist, cached in memory and synced from the database
+	revocations, err := revocation.NewStore(db, logger, time.Minute*time.Duration(max(cfg.JWT.AccessExpiry, cfg.JWT.ImpersonationExpiry)))
+	if err != nil {
+		return nil, fmt.Errorf("load token revocations: %w", err)
+	}
+	go revocations.Run(30*time.Second, deps.Stop)
+
+	// Initialize repositories
+	userRepo := repository.NewUserRepository(db, deps.Replicas)
+	tokenRepo := repository.NewTokenRepository(db, deps.Replicas, tokenStore)
+	emailRepo := repository.NewEmailEventRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	shareTokenRepo := repository.NewShareTokenRepository(db)
+	securityEventRepo := repository.NewSecurityEventRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	exportJobRepo := repository.NewExportJobRepository(db)
+	importJobRepo := repository.NewImportJobRepository(db)
+	dsarRepo := repository.NewDSARRepository(db)
+	notificationRepo := repository.NewNotificationRepository(db)
+	passwordResetRepo := repository.NewPasswordResetRepository(db)
+	emailChangeRepo := repository.NewEmailChangeRepository(db)
+	reactivationRepo := repository.NewReactivationRepository(db)
+	deviceRepo := repository.NewDeviceRepository(db)
+	externalLoginRepo := repository.NewExternalLoginRepository(db)
+	loginLocationRepo := repository.NewLoginLocationRepository(db)
+	organizationRepo := repository.NewOrganizationRepository(db)
+	groupRepo := repository.NewGroupRepository(db)
+	attributeRepo := repository.NewAttributeRepository(db)
+	settingsRepo := repository.NewSettingsRepository(db)
+	invitationRepo := repository.NewInvitationRepository(db)
+	ipRuleRepo := repository.NewIPRuleRepository(db)
+	featureFlagRepo := repository.NewFeatureFlagRepository(db)
+	passwordHistoryRepo := repository.NewPasswordHistoryRepository(db)
+	statsRepo := repository.NewStatsRepository(db)
+	analyticsRepo := repository.NewAnalyticsRepository(db)
+	reportRepo := repository.NewReportRepository(db)
+
+	// Outgoing email, delivered asynchronously by the mail queue
+	mailProvider, err := mailer.New(mailer.Config{
+		Provider: cfg.Email.Provider,
+		SMTP: mailer.SMTPConfig{
+			Host:        cfg.Email.SMTP.Host,
+			Port:        cfg.Email.SMTP.Port,
+			Username:    cfg.Email.SMTP.Username,
+			Password:    cfg.Email.SMTP.Password,
+			ImplicitTLS: cfg.Email.SMTP.ImplicitTLS,
+		},
+		SendGrid: mailer.SendGridConfig{
+			APIKey:   cfg.Email.SendGrid.APIKey,
+			Endpoint: cfg.Email.SendGrid.Endpoint,
+		},
+		SES: mailer.SESConfig{
+			Region:          cfg.Email.SES.Region,
+			AccessKeyID:     cfg.Email.SES.AccessKeyID,
+			SecretAccessKey: cfg.Email.SES.SecretAccessKey,
+			Endpoint:        cfg.Email.SES.Endpoint,
+		},
+	}, logger)
+	if err != nil {
+		return nil, fmt.Errorf("initialize mail provider: %w", err)
+	}
+	mailTemplates, err := mailer.LoadTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("load email templates: %w", err)
+	}
+	mailQueue := mailer.NewQueue(mailProvider, mailer.QueueConfig{
+		Workers:     cfg.Email.Queue.Workers,
+		Size:        cfg.Email.Queue.Size,
+		MaxAttempts: cfg.Email.Queue.MaxAttempts,
+		RetryDelay:  time.Duration(cfg.Email.Queue.RetryDelaySeconds) * time.Second,
+	}, logger)
+
+	// Initialize services
+	emailService := service.NewEmailService(emailRepo, userRepo, mailTemplates, mailQueue, cfg.Email.From, cfg.Email.Provider, logger)
+	mailQueue.Start(ctx)
+	notificationService := service.NewNotificationService(notificationRepo, userRepo, emailService, logger)
+	accessKeys, refreshKeys, err := loadTokenKeys(jwtSecrets(cfg.JWT, deps.Secrets))
+	if err != nil {
+		return nil, fmt.Errorf("load token signing keys: %w", err)
+	}
+	if deps.Secrets != nil && cfg.Secrets.RefreshSeconds > 0 {
+		rotateTokenKeys(deps.Secrets, cfg.JWT.Algorithm, accessKeys, refreshKeys)
+	}
+	passwordValidator, err := SetupPasswords(&cfg.Security, passwordHistoryRepo, logger)
+	if err != nil {
+		return nil, err
+	}
+	// The first admin of a new deployment comes from the bootstrap settings
+	if cfg.Bootstrap.AdminEmail != "" {
+		err := BootstrapAdmin(service.NewSeedService(userRepo, passwordValidator, logger), cfg.Bootstrap, logger)
+		switch {
+		case errors.Is(err, service.ErrEmailTaken), errors.Is(err, service.ErrUsernameTaken):
+			// The account exists, e.g. created by another instance starting at the same time
+			logger.WithError(err).Warn("Bootstrap admin not created")
+		case err != nil:
+			return nil, fmt.Errorf("create the bootstrap admin: %w", err)
+		}
+	}
+	// Backends checking sign-in credentials register here under the name used in
+	// authentication.providers
+	authProviders := auth.NewProviderRegistry()
+	authProviders.Register(service.AuthProviderLocal, service.NewLocalAuthProvider(userRepo, logger))
+	if cfg.LDAP.Enabled {
+		groupRoles := make([]ldap.GroupRole, 0, len(cfg.LDAP.GroupRoles))
+		for _, mapping := range cfg.LDAP.GroupRoles {
+			groupRoles = append(groupRoles, ldap.GroupRole{Group: mapping.Group, Role: mapping.Role})
+		}
+		ldapDirectory, err := ldap.NewDirectory(ldap.Config{
+			URL:            cfg.LDAP.URL,
+			StartTLS:       cfg.LDAP.StartTLS,
+			CAFile:         cfg.LDAP.CAFile,
+			BindDN:         cfg.LDAP.BindDN,
+			BindPassword:   cfg.LDAP.BindPassword,
+			BaseDN:         cfg.LDAP.BaseDN,
+			LoginAttribute: cfg.LDAP.LoginAttribute,
+			EmailAttribute: cfg.LDAP.EmailAttribute,
+			GroupAttribute: cfg.LDAP.GroupAttribute,
+			GroupRoles:     groupRoles,
+			Timeout:        time.Duration(cfg.LDAP.TimeoutSeconds) * time.Second,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("configure LDAP: %w", err)
+		}
+		authProviders.Register(service.AuthProviderLDAP, service.NewDirectoryAuthProvider(ldapDirectory, logger))
+	}
+	providerNames := cfg.Authentication.Providers
+	if len(providerNames) == 0 {
+		// Directory accounts first, then local passwords for the other accounts
+		if cfg.LDAP.Enabled {
+			providerNames = append(providerNames, service.AuthProviderLDAP)
+		}
+		providerNames = append(providerNames, service.AuthProviderLocal)
+	}
+	authChain, err := authProviders.Chain(providerNames)
+	if err != nil {
+		return nil, fmt.Errorf("configure auth providers: %w", err)
+	}
+	logger.WithField("providers", authChain.Names()).Info("Auth providers configured")
+	accountService := service.NewAccountService(userRepo, emailChangeRepo, reactivationRepo, tokenRepo, securityEventRepo, emailService, notificationService, revocations, service.AccountConfig{
+		EmailChangeURL:         cfg.Security.EmailChange.URL,
+		EmailChangeTokenTTL:    time.Duration(cfg.Security.EmailChange.TokenTTLMinutes) * time.Minute,
+		UsernameCooldown:       time.Duration(cfg.Security.UsernameChangeCooldownHours) * time.Hour,
+		ReactivationURL:        cfg.Security.Reactivation.URL,
+		ReactivationTokenTTL:   time.Duration(cfg.Security.Reactivation.TokenTTLMinutes) * time.Minute,
+		ReactivationMaxPerHour: cfg.Security.Reactivation.MaxPerHour,
+		DeletionGracePeriod:    time.Duration(cfg.Privacy.DeletionGraceDays) * 24 * time.Hour,
+		DeletionUndoURL:        cfg.Privacy.DeletionUndoURL,
+	}, logger)
+	deviceService := service.NewDeviceService(deviceRepo, securityEventRepo, emailService, service.DeviceConfig{
+		Verification: cfg.Security.DeviceVerification.Enabled,
+		URL:          cfg.Security.DeviceVerification.URL,
+		TokenTTL:     time.Duration(cfg.Security.DeviceVerification.TokenTTLMinutes) * time.Minute,
+		MaxPerHour:   cfg.Security.DeviceVerification.MaxPerHour,
+	}, logger)
+	externalLoginService := service.NewExternalLoginService(externalLoginRepo, userRepo, securityEventRepo, emailService, notificationService, revocations, service.AccountLinkingConfig{
+		URL:        cfg.Security.AccountLinking.URL,
+		TokenTTL:   time.Duration(cfg.Security.AccountLinking.TokenTTLMinutes) * time.Minute,
+		MaxPerHour: cfg.Security.AccountLinking.MaxPerHour,
+	}, logger)
+	var geoResolver service.GeoResolver
+	if cfg.Security.GeoIP.Enabled {
+		geoReader, err := geoip.Open(cfg.Security.GeoIP.DatabaseFile)
+		if err != nil {
+			return nil, fmt.Errorf("load GeoIP database: %w", err)
+		}
+		logger.WithField("type", geoReader.DatabaseType()).Info("GeoIP database loaded")
+		geoResolver = geoReader
+	}
+	travel := cfg.Security.GeoIP.ImpossibleTravel
+	if travel.Action != "alert" && travel.Action != "deny" {
+		return nil, fmt.Errorf("invalid impossible travel action %q", travel.Action)
+	}
+	geoService := service.NewGeoService(geoResolver, loginLocationRepo, auditRepo, notificationService, service.GeoConfig{
+		BlockedCountries:     cfg.Security.GeoIP.BlockedCountries,
+		ImpossibleTravel:     travel.Enabled,
+		MaxSpeedKmh:          travel.MaxSpeedKmh,
+		MinDistanceKm:        travel.MinDistanceKm,
+		DenyImpossibleTravel: travel.Action == "deny",
+	}, logger)
+	attributeService := service.NewAttributeService(attributeRepo, userRepo, auditRepo, logger)
+	// Deployments register their own claims enrichers here and list them in
+	// jwt.claims.enrichers, e.g. claimsRegistry.Register("billing", billing.NewClaims(db))
+	claimsRegistry := auth.NewClaimsRegistry()
+	claimNames := cfg.JWT.Claims.Enrichers
+	if len(cfg.JWT.Claims.Fields) > 0 {
+		fields := make(map[string]string, len(cfg.JWT.Claims.Fields))
+		for _, field := range cfg.JWT.Claims.Fields {
+			fields[field.Claim] = field.Source
+		}
+		fieldClaims, err := service.NewFieldClaimsEnricher(userRepo, attributeService, fields)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwt.claims.fields: %w", err)
+		}
+		claimsRegistry.Register(service.ClaimsEnricherFields, fieldClaims)
+		if len(claimNames) == 0 {
+			claimNames = []string{service.ClaimsEnricherFields}
+		}
+	}
+	claimsChain, err := claimsRegistry.Chain(claimNames)
+	if err != nil {
+		return nil, fmt.Errorf("configure claims enrichers: %w", err)
+	}
+	authService := service.NewAuthService(userRepo, tokenRepo, organizationRepo, groupRepo, analyticsRepo, emailService, notificationService, accountService, deviceService, externalLoginService, geoService, revocations, passwordValidator, authChain, service.TokenConfig{
+		AccessKeys:    accessKeys,
+		RefreshKeys:   refreshKeys,
+		Issuer:        cfg.JWT.Issuer,
+		Audience:      cfg.JWT.Audience,
+		AccessExpiry:  cfg.JWT.AccessExpiry,
+		RefreshExpiry: cfg.JWT.RefreshExpiry,
+		BindDevice:    cfg.Security.Sessions.BindDevice,
+		MaxSessions:   cfg.Security.Sessions.MaxPerUser,
+		Claims:        claimsChain,
+		Clock:         deps.Clock,
+	}, logger)
+	samlConfig := sso.Config{BaseURL: cfg.SAML.BaseURL, CertificateFile: cfg.SAML.CertificateFile, PrivateKeyFile: cfg.SAML.PrivateKeyFile}
+	if cfg.SAML.Enabled {
+		for _, provider := range cfg.SAML.Providers {
+			groupRoles := make([]sso.GroupRole, 0, len(provider.GroupRoles))
+			for _, mapping := range provider.GroupRoles {
+				groupRoles = append(groupRoles, sso.GroupRole{Group: mapping.Group, Role: mapping.Role})
+			}
+			samlConfig.Providers = append(samlConfig.Providers, sso.ProviderConfig{
+				Name:              provider.Name,
+				MetadataURL:       provider.MetadataURL,
+				MetadataFile:      provider.MetadataFile,
+				EmailAttribute:    provider.EmailAttribute,
+				UsernameAttribute: provider.UsernameAttribute,
+				GroupsAttribute:   provider.GroupsAttribute,
+				GroupRoles:        groupRoles,
+			})
+		}
+	}
+	samlProviders, err := sso.NewRegistry(samlConfig)
+	if err != nil {
+		return nil, fmt.Errorf("configure SAML identity providers: %w", err)
+	}
+	impersonationService := service.NewImpersonationService(userRepo, tokenRepo, groupRepo, revocations, auditRepo, service.TokenConfig{
+		AccessKeys:   accessKeys,
+		Issuer:       cfg.JWT.Issuer,
+		Audience:     cfg.JWT.Audience,
+		AccessExpiry: cfg.JWT.AccessExpiry,
+		Claims:       claimsChain,
+		Clock:        deps.Clock,
+	}, cfg.JWT.ImpersonationExpiry, logger)
+	watchConfig(func(next *config.Config) {
+		authService.SetTokenExpiry(next.JWT.AccessExpiry, next.JWT.RefreshExpiry)
+		impersonationService.SetExpiry(next.JWT.ImpersonationExpiry, next.JWT.AccessExpiry)
+		revocations.SetTokenTTL(time.Minute * time.Duration(max(next.JWT.AccessExpiry, next.JWT.ImpersonationExpiry)))
+	})
+	completenessRules := service.DefaultCompletenessRules
+	if len(cfg.Profiles.Completeness.Rules) > 0 {
+		completenessRules = make([]service.CompletenessRule, 0, len(cfg.Profiles.Completeness.Rules))
+		for _, rule := range cfg.Profiles.Completeness.Rules {
+			completenessRules = append(completenessRules, service.CompletenessRule{Field: rule.Field, Weight: rule.Weight, Required: rule.Required})
+		}
+	}
+	completeness, err := service.NewCompletenessScorer(completenessRules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profile completeness rules: %w", err)
+	}
+	userService := service.NewUserService(userRepo, tokenRepo, auditRepo, notificationService, revocations, passwordValidator, service.UserServiceConfig{
+		RevokeSessionsOnPasswordChange: cfg.Security.RevokeSessionsOnPasswordChange,
+		Completeness:                   completeness,
+		CompletenessThreshold:          cfg.Profiles.Completeness.Threshold,
+	}, logger)
+	passwordResetService := service.NewPasswordResetService(userRepo, passwordResetRepo, tokenRepo, securityEventRepo, emailService, notificationService, revocations, passwordValidator, service.PasswordResetConfig{
+		URL:            cfg.Security.PasswordReset.URL,
+		TokenTTL:       time.Duration(cfg.Security.PasswordReset.TokenTTLMinutes) * time.Minute,
+		MaxPerHour:     cfg.Security.PasswordReset.MaxPerHour,
+		SetPasswordTTL: time.Duration(cfg.Security.PasswordReset.SetPasswordTTLHours) * time.Hour,
+	}, logger)
+	organizationService := service.NewOrganizationService(organizationRepo, userRepo, emailService, revocations, service.OrganizationConfig{
+		InvitationURL: cfg.Organizations.InvitationURL,
+		InvitationTTL: time.Duration(cfg.Organizations.InvitationTTLHours) * time.Hour,
+		TransferURL:   cfg.Organizations.TransferURL,
+		TransferTTL:   time.Duration(cfg.Organizations.TransferTTLHours) * time.Hour,
+	}, logger)
+	groupService := service.NewGroupService(groupRepo, userRepo, revocations, logger)
+	invitationService := service.NewInvitationService(invitationRepo, userRepo, emailService, notificationService, passwordValidator, service.InvitationConfig{
+		URL:      cfg.Security.Invitation.URL,
+		TokenTTL: time.Duration(cfg.Security.Invitation.TokenTTLHours) * time.Hour,
+	}, logger)
+	userImportService := service.NewUserImportService(importJobRepo, userRepo, invitationService, emailService, passwordResetService, mediaStorage, service.ImportConfig{
+		MaxRows:  cfg.Imports.MaxRows,
+		MaxBytes: int64(cfg.Imports.MaxFileMB) << 20,
+		TTL:      time.Hour * time.Duration(cfg.Imports.TTLHours),
+	}, logger)
+	userImportService.Resume()
+	ipRuleService := service.NewIPRuleService(ipRuleRepo, ipFilter, logger)
+	if err := ipRuleService.Reload(); err != nil {
+		return nil, fmt.Errorf("load IP rules: %w", err)
+	}
+	featureFlagService := service.NewFeatureFlagService(featureFlagRepo, logger)
+	if err := featureFlagService.Reload(); err != nil {
+		return nil, fmt.Errorf("load feature flags: %w", err)
+	}
+	activityService := service.NewActivityService(securityEventRepo, auditRepo)
+	sessionService := service.NewSessionService(tokenRepo, logger)
+	avatarService := service.NewAvatarService(userService, mediaStorage, service.AvatarConfig{
+		MaxUploadBytes: cfg.Storage.Avatars.MaxUploadBytes,
+		MaxDimension:   cfg.Storage.Avatars.MaxDimension,
+		ThumbnailSizes: cfg.Storage.Avatars.ThumbnailSizes,
+	}, logger)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo, userRepo, logger)
+	shareTokenService := service.NewShareTokenService(shareTokenRepo, userRepo, logger)
+	apiKeyMonitor := service.NewAPIKeyMonitor(apiKeyRepo, securityEventRepo, service.AnomalyConfig{
+		Enabled:       cfg.APIKeys.Anomaly.Enabled,
+		VolumeFactor:  cfg.APIKeys.Anomaly.VolumeFactor,
+		MinRequests:   cfg.APIKeys.Anomaly.MinRequests,
+		LearningHours: cfg.APIKeys.Anomaly.LearningHours,
+		BaselineDays:  cfg.APIKeys.Anomaly.BaselineDays,
+		AutoSuspend:   cfg.APIKeys.Anomaly.AutoSuspend,
+	}, logger)
+	exportService := service.NewExportService(service.ExportRepositories{
+		Users:          userRepo,
+		Tokens:         tokenRepo,
+		APIKeys:        apiKeyRepo,
+		Audit:          auditRepo,
+		SecurityEvents: securityEventRepo,
+		Emails:         emailRepo,
+		Jobs:           exportJobRepo,
+	}, mediaStorage, service.ExportConfig{
+		TTL:     time.Hour * time.Duration(cfg.Exports.TTLHours),
+		Workers: cfg.Exports.Workers,
+	}, logger)
+	exportService.Resume()
+	dsarService := service.NewDSARService(dsarRepo, userRepo, exportService, emailService, service.DSARConfig{
+		DeadlineDays:     cfg.DSAR.DeadlineDays,
+		MaxExtensionDays: cfg.DSAR.MaxExtensionDays,
+		ReminderDays:     cfg.DSAR.ReminderDays,
+	}, logger)
+	statsService := service.NewStatsService(statsRepo)
+	reportService := service.NewReportService(reportRepo, statsService, emailService, logger)
+	analyticsService := service.NewAnalyticsService(analyticsRepo, service.AnalyticsConfig{
+		BackfillDays:        cfg.Analytics.BackfillDays,
+		RetentionWeeks:      cfg.Analytics.RetentionWeeks,
+		LoginEventRetention: time.Duration(cfg.Analytics.LoginEventRetentionDays) * 24 * time.Hour,
+	}, logger)
+	go apiKeyMonitor.Run(time.Minute, deps.Stop)
+
+	// Cluster wide background jobs run only on the instance holding the jobs lock
+	instance := cfg.Jobs.Instance
+	if instance == "" {
+		hostname, _ := os.Hostname()
+		instance = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	leaderLock := jobs.AdvisoryLock(cfg.Jobs.LockKey)
+	switch cfg.Database.Driver {
+	case database.MySQL:
+		leaderLock = jobs.NamedLock(fmt.Sprintf("api-jobs-%d", cfg.Jobs.LockKey))
+	case database.SQLite:
+		// An SQLite file is not shared between hosts, so this instance is the only one
+		leaderLock = jobs.LocalLock()
+	}
+	scheduler := jobs.NewScheduler(db.DB(), leaderLock, instance, logger)
+	scheduler.Add(jobs.Job{
+		Name:      "exports.purge",
+		Interval:  10 * time.Minute,
+		Singleton: true,
+		Run: func(ctx context.Context) error {
+			exportService.PurgeExpired()
+			return nil
+		},
+	})
+	scheduler.Add(jobs.Job{
+		Name:      "imports.purge",
+		Interval:  10 * time.Minute,
+		Singleton: true,
+		Run: func(ctx context.Context) error {
+			userImportService.PurgeExpired()
+			return nil
+		},
+	})
+	scheduler.Add(jobs.Job{
+		Name:      "dsar.reminders",
+		Interval:  time.Hour,
+		Singleton: true,
+		Run: func(ctx context.Context) error {
+			dsarService.SendReminders(time.Now())
+			return nil
+		},
+	})
+	scheduler.Add(jobs.Job{
+		Name:      "reports.send",
+		Interval:  5 * time.Minute,
+		Singleton: true,
+		Run: func(ctx context.Context) error {
+			reportService.SendDue(time.Now())
+			return nil
+		},
+	})
+	scheduler.Add(jobs.Job{
+		Name:      "analytics.aggregate",
+		Interval:  time.Hour,
+		Singleton: true,
+		Run: func(ctx context.Context) error {
+			return analyticsService.Aggregate(time.Now())
+		},
+	})
+	scheduler.Add(jobs.Job{
+		Name:      "users.lift_suspensions",
+		Interval:  5 * time.Minute,
+		Singleton: true,
+		Run: func(ctx context.Context) error {
+			userService.LiftExpiredSuspensions(time.Now())
+			return nil
+		},
+	})
+	eventPublisher, err := events.New(events.Config{
+		Publisher: cfg.Events.Publisher,
+		Webhook: events.WebhookConfig{
+			URLs:    cfg.Events.Webhook.URLs,
+			Secret:  cfg.Events.Webhook.Secret,
+			Timeout: time.Duration(cfg.Events.Webhook.TimeoutSeconds) * time.Second,
+		},
+		Broker: events.BrokerConfig{
+			Enabled:     cfg.Events.Broker.Enabled,
+			Type:        cfg.Events.Broker.Type,
+			Brokers:     cfg.Events.Broker.Brokers,
+			TopicPrefix: cfg.Events.Broker.TopicPrefix,
+			Format:      cfg.Events.Broker.Format,
+			Timeout:     time.Duration(cfg.Events.Broker.TimeoutSeconds) * time.Second,
+		},
+	}, logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event publisher configuration: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		if err := events.Close(eventPublisher); err != nil {
+			logger.WithError(err).Warn("Failed to close event publisher")
+		}
+	}()
+	eventRelay := service.NewEventRelay(repository.NewOutboxRepository(db), eventPublisher, service.EventRelayConfig{
+		BatchSize:   cfg.Events.BatchSize,
+		MaxAttempts: cfg.Events.MaxAttempts,
+		RetryDelay:  time.Duration(cfg.Events.RetryDelaySeconds) * time.Second,
+		Retention:   time.Duration(cfg.Events.RetentionDays) * 24 * time.Hour,
+	}, logger)
+	scheduler.Add(jobs.Job{
+		Name:      "events.relay",
+		Interval:  time.Duration(cfg.Events.RelayIntervalSeconds) * time.Second,
+		Singleton: true,
+		Run: func(ctx context.Context) error {
+			eventRelay.Dispatch(ctx, time.Now())
+			return nil
+		},
+	})
+	scheduler.Add(jobs.Job{
+		Name:      "events.purge",
+		Interval:  time.Hour,
+		Singleton: true,
+		Run: func(ctx context.Context) error {
+			eventRelay.PurgeDelivered(time.Now())
+			return nil
+		},
+	})
+	// Every instance applies the IP rules other instances stored
+	scheduler.Add(jobs.Job{
+		Name:     "ipfilter.reload",
+		Interval: time.Duration(cfg.IPFilter.ReloadSeconds) * time.Second,
+		Run: func(ctx context.Context) error {
+			return ipRuleService.Reload()
+		},
+	})
+	// and the feature flags
+	scheduler.Add(jobs.Job{
+		Name:     "featureflags.reload",
+		Interval: time.Duration(cfg.FeatureFlags.ReloadSeconds) * time.Second,
+		Run: func(ctx context.Context) error {
+			return featureFlagService.Reload()
+		},
+	})
+	if !service.ValidErasureMode(cfg.Privacy.ErasureMode) {
+		return nil, fmt.Errorf("invalid account erasure mode %q", cfg.Privacy.ErasureMode)
+	}
+	erasureService := service.NewErasureService(userRepo, avatarService, mediaStorage, revocations, cfg.Privacy.ErasureMode, logger)
+
+	scheduler.Add(jobs.Job{
+		Name:      "users.erase_deleted",
+		Interval:  time.Hour,
+		Singleton: true,
+		Run: func(ctx context.Context) error {
+			erased, err := erasureService.EraseDue(ctx, time.Now())
+			if erased > 0 {
+				logger.WithField("count", erased).Info("Erased accounts at the end of their deletion grace period")
+			}
+			return err
+		},
+	})
+	scheduler.Start(ctx, time.Duration(cfg.Jobs.ElectionIntervalSeconds)*time.Second)
+
+	// Initialize handlers
+	authThrottle, err := loginThrottle(cfg.Security.Throttle)
+	if err != nil {
+		return nil, fmt.Errorf("configure login throttling: %w", err)
+	}
+	authHandler := handlers.NewAuthHandler(authService, passwordResetService, accountService, authThrottle, logger)
+	userHandler := handlers.NewUserHandler(userService, accountService, erasureService, logger)
+	bulkUserService := service.NewBulkUserService(userService, erasureService, auditRepo, logger)
+	adminHandler := handlers.NewAdminHandler(userService, erasureService, bulkUserService, attributeService, notificationService, passwordResetService, logger)
+	userHandlerV2 := handlersv2.NewUserHandler(userService, logger)
+	graphHandler := graph.NewHandler(userService, attributeService, logger)
+	attributeHandler := handlers.NewAttributeHandler(attributeService, logger)
+	emailHandler := handlers.NewEmailHandler(emailService, logger, cfg.Email.WebhookSecret)
+	sessionHandler := handlers.NewSessionHandler(sessionService, logger)
+	deviceHandler := handlers.NewDeviceHandler(deviceService, logger)
+	externalLoginHandler := handlers.NewExternalLoginHandler(externalLoginService, logger)
+	notificationHandler := handlers.NewNotificationHandler(notificationService, logger)
+	settingsService := service.NewSettingsService(settingsRepo, userRepo, notificationService, auditRepo, logger)
+	settingsHandler := handlers.NewSettingsHandler(settingsService, logger)
+	impersonationHandler := handlers.NewImpersonationHandler(impersonationService, logger)
+	activityHandler := handlers.NewActivityHandler(activityService, logger)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService, logger)
+	shareTokenHandler := handlers.NewShareTokenHandler(shareTokenService, logger)
+	exportHandler := handlers.NewExportHandler(exportService, logger)
+	importHandler := handlers.NewImportHandler(userImportService, logger)
+	dsarHandler := handlers.NewDSARHandler(dsarService, logger)
+	debugLogHandler := handlers.NewDebugLogHandler(deps.DebugFilter, logger)
+	reportHandler := handlers.NewReportHandler(reportService, logger)
+	analyticsHandler := handlers.NewAnalyticsHandler(analyticsService, logger)
+	jwksHandler := handlers.NewJWKSHandler(accessKeys)
+	healthHandler := handlers.NewHealthHandler(db.DB(), deps.LogOutput, scheduler, deps.Replicas)
+	groupHandler := handlers.NewGroupHandler(groupService, logger)
+	invitationHandler := handlers.NewInvitationHandler(invitationService, logger)
+	ipRuleHandler := handlers.NewIPRuleHandler(ipRuleService, logger)
+	featureFlagHandler := handlers.NewFeatureFlagHandler(featureFlagService, logger)
+	organizationHandler := handlers.NewOrganizationHandler(organizationService, authService, logger)
+	samlHandler := handlers.NewSAMLHandler(samlProviders, authService, logger, cfg.SAML.CompleteURL, strings.HasPrefix(cfg.SAML.BaseURL, "https://"))
+	mediaHandler := handlers.NewMediaHandler(userService, avatarService, mediaStorage, logger, cfg.Storage.ServeMode, cfg.Storage.SignedURLExpiry)
+
+	// Serve Scalar documentation
+	// Serve the main documentation page
+	router.StaticFile("/", "./statics/index.html") // Serve at root for better UX
+
+	// Serve the OpenAPI/Swagger specification
+	router.GET("/docs/swagger.json", func(c *gin.Context) {
+		c.File("./docs/swagger.json")
+	})
+	router.GET("/docs/v2/swagger.json", func(c *gin.Context) {
+		c.File("./docs/v2/v2_swagger.json")
+	})
+
+	// Public media
+	router.GET("/media/avatars/:id", mediaHandler.GetAvatar)
+
+	// Access token verification keys for other services
+	router.GET("/.well-known/jwks.json", jwksHandler.JWKS)
+
+	// Embedded admin UI (optional); it signs in and calls the admin API like any client
+	if cfg.AdminUI.Enabled {
+		router.Group("/admin-ui", adminui.Headers()).StaticFS("/", adminui.FileSystem())
+	}
+
+	// Legacy Swagger UI (optional)
+	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	router.GET("/swagger-v2/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.InstanceName("v2")))
+
+	// Authentication middleware; API keys are only accepted on the routes that use apiKeyAuth
+	// Validated access tokens, dropped as soon as the revocation store learns of a revocation
+	var tokenCache *middleware.TokenCache
+	if cfg.JWT.CacheTTLSeconds > 0 {
+		tokenCache = middleware.NewTokenCache(time.Duration(cfg.JWT.CacheTTLSeconds)*time.Second, cfg.JWT.CacheMaxEntries)
+		revocations.Subscribe(tokenCache)
+	}
+	// Only consulted for revoked tokens, to tell suspended accounts apart from signed-out sessions
+	accountStatus := func(userID uint) string {
+		status, err := userService.AccountStatus(userID)
+		if err != nil {
+			return ""
+		}
+		return status
+	}
+	accessVerifier := auth.NewAccessTokenVerifier(accessKeys, cfg.JWT.Issuer, cfg.JWT.Audience)
+	jwtAuth := middleware.AuthMiddleware(accessVerifier.Verify, revocations, tokenCache, accountStatus)
+	// Account changes only the user may make, refused to admins impersonating them
+	noImpersonation := middleware.ForbidImpersonation()
+	apiKeyAuth := middleware.AuthOrAPIKeyMiddleware(accessVerifier.Verify, revocations, tokenCache, accountStatus, func(key string) (*middleware.APIKeyIdentity, error) {
+		apiKey, user, err := apiKeyService.Authenticate(key)
+		if err != nil {
+			return nil, err
+		}
+		return &middleware.APIKeyIdentity{
+			KeyID:  apiKey.ID,
+			UserID: user.ID,
+			Role:   user.Role,
+			Scopes: service.SplitScopes(apiKey.Scopes),
+			Status: user.AccountStatus(time.Now()),
+		}, nil
+	}, apiKeyMonitor.Observe)
+
+	// CAPTCHA on registration, password reset requests and, after repeated failures, login
+	var captchaCheck middleware.CaptchaCheck
+	if cfg.Security.Captcha.Enabled {
+		verifier, err := captcha.New(captcha.Config{
+			Provider: cfg.Security.Captcha.Provider,
+			Secret:   cfg.Security.Captcha.Secret,
+			MinScore: cfg.Security.Captcha.MinScore,
+			Timeout:  time.Duration(cfg.Security.Captcha.TimeoutSeconds) * time.Second,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid CAPTCHA configuration: %w", err)
+		}
+		captchaCheck = middleware.CaptchaCheck{Verifier: verifier, FailOpen: cfg.Security.Captcha.FailOpen}
+	}
+	loginFailures := middleware.NewFailureCounter(cfg.Security.Captcha.LoginFailures, time.Duration(cfg.Security.Captcha.LoginFailureWindowMinutes)*time.Minute)
+
+	// Response language: Accept-Language, then the user's stored locale, then the default.
+	// Timestamps shown to users are in their stored timezone.
+	router.Use(middleware.LocaleMiddleware(func(userID uint) (string, string) {
+		locale, timezone, err := userService.Regional(userID)
+		if err != nil {
+			logger.WithError(err).WithField("user_id", userID).Warn("Failed to load preferred locale")
+		}
+		return locale, timezone
+	}))
+	// Requests made by admins acting as a user are audited with both identities
+	router.Use(middleware.ImpersonationAuditMiddleware(func(r middleware.ImpersonatedRequest) {
+		impersonationService.RecordRequest(r.UserID, r.ImpersonatorID, r.Method, r.Route, r.Status, r.IP)
+	}))
+	// Handlers and RequireFeature ask which feature flags are on for the caller
+	router.Use(middleware.FeatureFlagMiddleware(featureFlagService))
+
+	// API routes
+	v1 := router.Group("/api/v1")
+	deprecation, deprecated, err := apiDeprecation(cfg.API.V1, "/api/v2")
+	if err != nil {
+		return nil, err
+	}
+	if deprecated {
+		v1.Use(middleware.DeprecationMiddleware(deprecation))
+	}
+	// Existing v1 clients parse bare bodies; new ones can ask for the v2 envelope
+	v1.Use(middleware.EnvelopeMiddleware(true))
+	{
+		v1.GET("/health", healthHandler.Health)
+		v1.GET("/health/ready", healthHandler.Ready)
+
+		// Auth routes
+		auth := v1.Group("/auth")
+		{
+			auth.POST("/register", middleware.RequireCaptcha(captchaCheck, nil), authHandler.Register)
+			auth.POST("/register/invite", invitationHandler.RegisterWithInvitation)
+			auth.GET("/invitations/:token", invitationHandler.GetInvitation)
+			auth.POST("/login", loginFailures.Track(http.StatusUnauthorized), middleware.RequireCaptcha(captchaCheck, loginFailures.Exceeded), authHandler.Login)
+			auth.POST("/refresh", authHandler.RefreshToken)
+			auth.POST("/password-reset", middleware.RequireCaptcha(captchaCheck, nil), authHandler.RequestPasswordReset)
+			auth.POST("/password-reset/confirm", authHandler.ResetPassword)
+			auth.POST("/email-change/confirm", authHandler.ConfirmEmailChange)
+			auth.POST("/reactivate", authHandler.ReactivateAccount)
+			auth.POST("/devices/confirm", deviceHandler.ConfirmDevice)
+			auth.POST("/external-logins/confirm", externalLoginHandler.ConfirmExternalLogin)
+			auth.POST("/logout", jwtAuth, authHandler.Logout)
+			auth.POST("/impersonation/exit", jwtAuth, impersonationHandler.ExitImpersonation)
+			auth.GET("/saml/:provider/metadata", samlHandler.Metadata)
+			auth.GET("/saml/:provider/login", samlHandler.Login)
+			auth.POST("/saml/:provider/acs", samlHandler.ACS)
+		}
+
+		// Protected user routes. Each requires a scope, which limits API keys and the
+		// access tokens of scoped sessions; full sessions reach every route.
+		user := v1.Group("/users")
+		{
+			user.GET("/profile", apiKeyAuth, middleware.RequireScope(service.ScopeProfileRead), userHandler.GetProfile)
+			user.PUT("/profile", apiKeyAuth, middleware.RequireScope(service.ScopeProfileWrite), userHandler.UpdateProfile)
+			user.GET("/directory", jwtAuth, middleware.RequireScope(service.ScopeProfileRead), userHandler.GetDirectory)
+			user.POST("/profile/avatar", apiKeyAuth, middleware.RequireScope(service.ScopeProfileWrite), mediaHandler.UploadAvatar)
+			user.GET("/profile/attributes", apiKeyAuth, middleware.RequireScope(service.ScopeProfileRead), attributeHandler.GetOwnAttributes)
+			user.PUT("/profile/attributes", apiKeyAuth, middleware.RequireScope(service.ScopeProfileWrite), attributeHandler.SetOwnAttributes)
+			user.PUT("/change-password", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, userHandler.ChangePassword)
+			user.PUT("/email", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, userHandler.ChangeEmail)
+			user.PUT("/username", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, userHandler.ChangeUsername)
+			user.POST("/deactivate", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, userHandler.DeactivateAccount)
+			user.DELETE("/account", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, userHandler.DeleteAccount)
+			user.GET("/sessions", jwtAuth, middleware.RequireScope(service.ScopeAccount), sessionHandler.ListSessions)
+			user.POST("/sessions", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, authHandler.CreateScopedSession)
+			user.DELETE("/sessions", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, sessionHandler.RevokeOtherSessions)
+			user.DELETE("/sessions/:id", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, sessionHandler.RevokeSession)
+			user.GET("/devices", jwtAuth, middleware.RequireScope(service.ScopeAccount), deviceHandler.ListDevices)
+			user.DELETE("/devices/:id", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, deviceHandler.RevokeDevice)
+			user.GET("/api-keys", jwtAuth, middleware.RequireScope(service.ScopeAccount), apiKeyHandler.ListAPIKeys)
+			user.POST("/api-keys", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, apiKeyHandler.CreateAPIKey)
+			user.DELETE("/api-keys/:id", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, apiKeyHandler.RevokeAPIKey)
+			user.GET("/share-tokens", jwtAuth, middleware.RequireScope(service.ScopeAccount), shareTokenHandler.ListShareTokens)
+			user.POST("/share-tokens", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, shareTokenHandler.CreateShareToken)
+			user.DELETE("/share-tokens/:id", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, shareTokenHandler.RevokeShareToken)
+			user.GET("/activity", jwtAuth, middleware.RequireScope(service.ScopeAccount), activityHandler.GetActivity)
+			user.GET("/notifications", jwtAuth, middleware.RequireScope(service.ScopeProfileRead), notificationHandler.GetPreferences)
+			user.PUT("/notifications", jwtAuth, middleware.RequireScope(service.ScopeProfileWrite), notificationHandler.UpdatePreferences)
+			user.GET("/settings", jwtAuth, middleware.RequireScope(service.ScopeProfileRead), settingsHandler.GetSettings)
+			user.PUT("/settings", jwtAuth, middleware.RequireScope(service.ScopeProfileWrite), settingsHandler.UpdateSettings)
+			user.GET("/export", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, exportHandler.RequestExport)
+			user.GET("/export/:id", jwtAuth, middleware.RequireScope(service.ScopeAccount), exportHandler.GetExport)
+			user.GET("/export/:id/download", jwtAuth, middleware.RequireScope(service.ScopeAccount), noImpersonation, exportHandler.DownloadExport)
+		}
+
+		// Profile fields users shared with third-party apps, read with the app's share token
+		v1.GET("/shared/profile", shareTokenHandler.GetSharedProfile)
+
+		// GraphQL over the profile and admin user routes; each field checks the scope and
+		// role of its REST counterpart
+		v1.POST("/graphql", jwtAuth, graphHandler.Serve)
+
+		// Organizations; a token acts for one organization, and its routes require that one
+		organizations := v1.Group("/organizations")
+		organizations.Use(jwtAuth, middleware.RequireScope(service.ScopeOrganizations))
+		{
+			organizations.POST("", noImpersonation, organizationHandler.CreateOrganization)
+			organizations.GET("", organizationHandler.ListOrganizations)
+			organizations.POST("/invitations/accept", noImpersonation, organizationHandler.AcceptInvitation)
+			organizations.POST("/ownership-transfers/accept", noImpersonation, organizationHandler.AcceptOwnership)
+			organizations.POST("/:id/switch", organizationHandler.SwitchOrganization)
+			organizations.GET("/:id/members", middleware.RequireOrgRole(models.OrgRoleOwner, models.OrgRoleAdmin), organizationHandler.ListMembers)
+			organizations.POST("/:id/invitations", middleware.RequireOrgRole(models.OrgRoleOwner, models.OrgRoleAdmin), organizationHandler.InviteMember)
+			organizations.POST("/:id/transfer-ownership", noImpersonation, middleware.RequireOrgRole(models.OrgRoleOwner), organizationHandler.TransferOwnership)
+		}
+
+		// Admin routes
+		admin := v1.Group("/admin")
+		// Unknown fields in admin requests are rejected, so a misspelt one does not go unnoticed
+		admin.Use(apiKeyAuth, middleware.AdminMiddleware(), middleware.StrictJSONMiddleware())
+
+		// User management, which the admin:users scope is enough for
+		adminUsers := admin.Group("/users")
+		adminUsers.Use(middleware.RequireScope(service.ScopeAdminUsers))
+		{
+			adminUsers.GET("", adminHandler.ListUsers)
+			adminUsers.GET("/export", middleware.RequireGroup("user-export"), exportHandler.ExportUserList)
+			adminUsers.POST("/import", importHandler.ImportUsers)
+			adminUsers.POST("/bulk", adminHandler.BulkUpdateUsers)
+			adminUsers.GET("/search", adminHandler.SearchUsers)
+			adminUsers.GET("/incomplete-profiles", adminHandler.IncompleteProfiles)
+			adminUsers.GET("/import/:id", importHandler.GetImport)
+			adminUsers.GET("/import/:id/report", importHandler.DownloadImportReport)
+			adminUsers.GET("/deleted", adminHandler.ListDeletedUsers)
+			adminUsers.PATCH("/:id", adminHandler.PatchUser)
+			adminUsers.GET("/:id/preview", adminHandler.PreviewUser)
+			adminUsers.GET("/:id/timeline", activityHandler.GetTimeline)
+			adminUsers.GET("/:id/attributes", attributeHandler.GetUserAttributes)
+			adminUsers.PUT("/:id/attributes", attributeHandler.SetUserAttributes)
+			adminUsers.PUT("/:id/role", adminHandler.ChangeUserRole)
+			adminUsers.POST("/:id/erase", adminHandler.EraseUser)
+			adminUsers.POST("/:id/revoke-sessions", adminHandler.RevokeSessions)
+			adminUsers.POST("/:id/password-reset", adminHandler.SendPasswordReset)
+			// Impersonation tokens are not scoped, so they need the full admin scope
+			adminUsers.POST("/:id/impersonate", middleware.RequireScope(service.ScopeAdmin), impersonationHandler.Impersonate)
+			adminUsers.PUT("/:id/suspend", adminHandler.SuspendUser)
+			adminUsers.PUT("/:id/reinstate", adminHandler.ReinstateUser)
+			adminUsers.POST("/:id/restore", adminHandler.RestoreUser)
+			adminUsers.DELETE("/:id/purge", adminHandler.PurgeUser)
+		}
+
+		// Everything else needs the full admin scope
+		adminOther := admin.Group("")
+		adminOther.Use(middleware.RequireScope(service.ScopeAdmin))
+		{
+			adminOther.GET("/attributes", attributeHandler.ListAttributes)
+			adminOther.PUT("/attributes/:key", attributeHandler.DefineAttribute)
+			adminOther.DELETE("/attributes/:key", attributeHandler.DeleteAttribute)
+			adminOther.GET("/groups", groupHandler.ListGroups)
+			adminOther.POST("/groups", groupHandler.CreateGroup)
+			adminOther.GET("/groups/:id", groupHandler.GetGroup)
+			adminOther.PUT("/groups/:id", groupHandler.UpdateGroup)
+			adminOther.DELETE("/groups/:id", groupHandler.DeleteGroup)
+			adminOther.PUT("/groups/:id/members/:userId", groupHandler.AddGroupMember)
+			adminOther.DELETE("/groups/:id/members/:userId", groupHandler.RemoveGroupMember)
+			adminOther.GET("/invitations", invitationHandler.ListInvitations)
+			adminOther.POST("/invitations", invitationHandler.CreateInvitation)
+			adminOther.DELETE("/invitations/:id", invitationHandler.RevokeInvitation)
+			adminOther.POST("/dsar", dsarHandler.OpenRequest)
+			adminOther.GET("/dsar", dsarHandler.ListRequests)
+			adminOther.GET("/dsar/:id", dsarHandler.GetRequest)
+			adminOther.POST("/dsar/:id/package", dsarHandler.AssemblePackage)
+			adminOther.GET("/dsar/:id/package", dsarHandler.DownloadPackage)
+			adminOther.POST("/dsar/:id/extend", dsarHandler.ExtendDeadline)
+			adminOther.POST("/dsar/:id/close", dsarHandler.CloseRequest)
+			adminOther.GET("/dsar/:id/evidence", dsarHandler.ExportEvidence)
+			adminOther.GET("/email-stats", emailHandler.GetEmailStats)
+			adminOther.GET("/analytics", analyticsHandler.GetAnalytics)
+			adminOther.GET("/reports/schedules", reportHandler.ListSchedules)
+			adminOther.POST("/reports/schedules", reportHandler.CreateSchedule)
+			adminOther.DELETE("/reports/schedules/:id", reportHandler.DeleteSchedule)
+			adminOther.GET("/debug-logging", debugLogHandler.ListRules)
+			adminOther.POST("/debug-logging", debugLogHandler.CreateRule)
+			adminOther.DELETE("/debug-logging/:id", debugLogHandler.DeleteRule)
+			adminOther.GET("/ip-rules", ipRuleHandler.ListRules)
+			adminOther.POST("/ip-rules", ipRuleHandler.CreateRule)
+			adminOther.DELETE("/ip-rules/:id", ipRuleHandler.DeleteRule)
+			adminOther.GET("/feature-flags", featureFlagHandler.ListFeatureFlags)
+			adminOther.GET("/feature-flags/:key", featureFlagHandler.GetFeatureFlag)
+			adminOther.PUT("/feature-flags/:key", featureFlagHandler.DefineFeatureFlag)
+			adminOther.DELETE("/feature-flags/:key", featureFlagHandler.DeleteFeatureFlag)
+		}
+
+		// Email provider webhooks
+		v1.POST("/webhooks/email/:provider", emailHandler.ProviderWebhook)
+	}
+
+	// Version 2 shares the services with v1 and only redefines the routes whose
+	// responses changed; everything else is still served by v1
+	v2 := router.Group("/api/v2")
+	v2.Use(middleware.EnvelopeMiddleware(false), middleware.StrictJSONMiddleware())
+	{
+		v2.GET("/users/me", apiKeyAuth, middleware.RequireScope(service.ScopeProfileRead), userHandlerV2.GetMe)
+
+		admin := v2.Group("/admin")
+		admin.Use(apiKeyAuth, middleware.RequireScope(service.ScopeAdminUsers), middleware.AdminMiddleware())
+		{
+			admin.GET("/users", userHandlerV2.ListUsers)
+		}
+	}
+
+	return router, nil
+}
+
+// apiDeprecation reads the retirement announcement of an API version, reporting false
+// while there is none
+func apiDeprecation(cfg config.APIVersionConfig, successor string) (middleware.Deprecation, bool, error) {
+	if cfg.DeprecatedAt == "" {
+		return middleware.Deprecation{}, false, nil
+	}
+	since, err := time.Parse(time.DateOnly, cfg.DeprecatedAt)
+	if err != nil {
+		return middleware.Deprecation{}, false, fmt.Errorf("invalid api deprecatedAt date: %w", err)
+	}
+	deprecation := middleware.Deprecation{Since: since, Successor: successor, Docs: cfg.DocsURL}
+	if cfg.Sunset != "" {
+		if deprecation.Sunset, err = time.Parse(time.DateOnly, cfg.Sunset); err != nil {
+			return middleware.Deprecation{}, false, fmt.Errorf("invalid api sunset date: %w", err)
+		}
+	}
+	return deprecation, true, nil
+}
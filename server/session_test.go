@@ -0,0 +1,157 @@
+package server_test
+
+import (
+	"api/internal/auth"
+	"api/testutil"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const (
+	testEmail    = "ada@example.com"
+	testPassword = "Correct-Horse-42"
+)
+
+// refresh exchanges refreshToken, returning the response status and the new tokens
+func refresh(t *testing.T, srv *testutil.Server, refreshToken string) (int, testutil.Tokens) {
+	t.Helper()
+	resp, body := srv.Do(t, http.MethodPost, "/api/v1/auth/refresh", map[string]string{"refresh_token": refreshToken}, "")
+	var tokens testutil.Tokens
+	if resp.StatusCode == http.StatusOK {
+		if err := json.Unmarshal(body, &tokens); err != nil {
+			t.Fatalf("decode refresh response: %v", err)
+		}
+	}
+	return resp.StatusCode, tokens
+}
+
+// profileStatus is the status of GET /users/profile with accessToken
+func profileStatus(t *testing.T, srv *testutil.Server, accessToken string) int {
+	t.Helper()
+	resp, _ := srv.Do(t, http.MethodGet, "/api/v1/users/profile", nil, accessToken)
+	return resp.StatusCode
+}
+
+func TestLoginRefreshLogout(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	srv.CreateUser(t, testEmail, testPassword, "user")
+
+	tokens := srv.Login(t, testEmail, testPassword)
+	if status := profileStatus(t, srv, tokens.AccessToken); status != http.StatusOK {
+		t.Fatalf("profile after login: %d", status)
+	}
+
+	status, refreshed := refresh(t, srv, tokens.RefreshToken)
+	if status != http.StatusOK {
+		t.Fatalf("refresh: %d", status)
+	}
+	if refreshed.RefreshToken == tokens.RefreshToken || refreshed.AccessToken == tokens.AccessToken {
+		t.Fatal("refresh returned the tokens it was given")
+	}
+	if status := profileStatus(t, srv, refreshed.AccessToken); status != http.StatusOK {
+		t.Fatalf("profile after refresh: %d", status)
+	}
+
+	resp, body := srv.Do(t, http.MethodPost, "/api/v1/auth/logout", map[string]string{"refresh_token": refreshed.RefreshToken}, refreshed.AccessToken)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("logout: %d %s", resp.StatusCode, body)
+	}
+	if status, _ := refresh(t, srv, refreshed.RefreshToken); status != http.StatusUnauthorized {
+		t.Errorf("refresh after logout: %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := profileStatus(t, srv, refreshed.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("profile with the access token of the logout: %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	srv.CreateUser(t, testEmail, testPassword, "user")
+
+	tokens := srv.Login(t, testEmail, testPassword)
+	status, refreshed := refresh(t, srv, tokens.RefreshToken)
+	if status != http.StatusOK {
+		t.Fatalf("refresh: %d", status)
+	}
+	if status, _ := refresh(t, srv, tokens.RefreshToken); status != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: %d, want %d", status, http.StatusUnauthorized)
+	}
+	// Reuse ends the whole session, including the token that replaced the reused one
+	if status, _ := refresh(t, srv, refreshed.RefreshToken); status != http.StatusUnauthorized {
+		t.Errorf("refresh after reuse: %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestExpiredTokens(t *testing.T) {
+	// Tokens issued eight days ago, past the seven day refresh expiry of testutil.Config
+	srv := testutil.NewServerWithClock(t, auth.FixedClock(time.Now().Add(-8*24*time.Hour)), nil)
+	srv.CreateUser(t, testEmail, testPassword, "user")
+
+	tokens := srv.Login(t, testEmail, testPassword)
+	if status := profileStatus(t, srv, tokens.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("profile with expired access token: %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status, _ := refresh(t, srv, tokens.RefreshToken); status != http.StatusUnauthorized {
+		t.Errorf("refresh with expired token: %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestTokensAfterPasswordChange(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	srv.CreateUser(t, testEmail, testPassword, "user")
+
+	tokens := srv.Login(t, testEmail, testPassword)
+	resp, body := srv.Do(t, http.MethodPut, "/api/v1/users/change-password", map[string]string{"currentPassword": testPassword, "newPassword": "An0ther-Horse-42"}, tokens.AccessToken)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("change password: %d %s", resp.StatusCode, body)
+	}
+	if status := profileStatus(t, srv, tokens.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("profile with the token from before the change: %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// The session that changed the password goes on, with tokens issued right after
+	status, refreshed := refresh(t, srv, tokens.RefreshToken)
+	if status != http.StatusOK {
+		t.Fatalf("refresh after the change: %d", status)
+	}
+	if status := profileStatus(t, srv, refreshed.AccessToken); status != http.StatusOK {
+		t.Errorf("profile with the token refreshed after the change: %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestRoleChangeRevokesAccessTokens(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+	srv.CreateUser(t, testEmail, testPassword, "admin")
+	demoted := srv.CreateUser(t, "alan@example.com", testPassword, "admin")
+	adminToken := srv.Login(t, testEmail, testPassword).AccessToken
+	tokens := srv.Login(t, "alan@example.com", testPassword)
+
+	for _, change := range []struct {
+		method, path string
+		body         interface{}
+		adminStatus  int // of an admin route with the refreshed token
+	}{
+		{http.MethodPut, "/role", map[string]string{"role": "user"}, http.StatusForbidden},
+		{http.MethodPatch, "", map[string]interface{}{"role": "admin"}, http.StatusOK},
+	} {
+		resp, body := srv.Do(t, change.method, fmt.Sprintf("/api/v1/admin/users/%d%s", demoted.ID, change.path), change.body, adminToken)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", change.method, change.path, resp.StatusCode, body)
+		}
+		if status := profileStatus(t, srv, tokens.AccessToken); status != http.StatusUnauthorized {
+			t.Errorf("%s %s: profile with the token from before the change: %d, want %d", change.method, change.path, status, http.StatusUnauthorized)
+		}
+		// The session goes on with tokens carrying the new role
+		var status int
+		status, tokens = refresh(t, srv, tokens.RefreshToken)
+		if status != http.StatusOK {
+			t.Fatalf("%s %s: refresh: %d", change.method, change.path, status)
+		}
+		if resp, body := srv.Do(t, http.MethodGet, "/api/v1/admin/users", nil, tokens.AccessToken); resp.StatusCode != change.adminStatus {
+			t.Errorf("%s %s: admin route with the refreshed token: %d %s, want %d", change.method, change.path, resp.StatusCode, body, change.adminStatus)
+		}
+	}
+}
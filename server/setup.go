@@ -0,0 +1,171 @@
+package server
+
+import (
+	"api/config"
+	"api/internal/auth"
+	"api/internal/repository"
+	"api/internal/secrets"
+	"api/internal/service"
+	"api/internal/throttle"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetupPasswords installs the configured password hashing and returns the validator
+// of new passwords
+func SetupPasswords(cfg *config.SecurityConfig, history repository.PasswordHistoryRepository, logger *logrus.Logger) (service.PasswordValidator, error) {
+	passwordHasher, err := auth.NewPasswordHasher(auth.HashingConfig{
+		Algorithm:  cfg.PasswordHashing.Algorithm,
+		BcryptCost: cfg.PasswordHashing.BcryptCost,
+		Argon2: auth.Argon2Params{
+			MemoryKB:    cfg.PasswordHashing.Argon2.MemoryKB,
+			Iterations:  cfg.PasswordHashing.Argon2.Iterations,
+			Parallelism: cfg.PasswordHashing.Argon2.Parallelism,
+			SaltLength:  cfg.PasswordHashing.Argon2.SaltLength,
+			KeyLength:   cfg.PasswordHashing.Argon2.KeyLength,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid password hashing configuration: %w", err)
+	}
+	auth.SetPasswordHasher(passwordHasher)
+	passwordPolicy, err := auth.NewPasswordPolicy(auth.PasswordPolicy{
+		MinLength:        cfg.PasswordPolicy.MinLength,
+		RequireUpper:     cfg.PasswordPolicy.RequireUppercase,
+		RequireLower:     cfg.PasswordPolicy.RequireLowercase,
+		RequireDigit:     cfg.PasswordPolicy.RequireDigit,
+		RequireSymbol:    cfg.PasswordPolicy.RequireSymbol,
+		DisallowUserInfo: cfg.PasswordPolicy.DisallowUserInfo,
+	}, cfg.PasswordPolicy.BannedPasswordsFile)
+	if err != nil {
+		return nil, fmt.Errorf("load password policy: %w", err)
+	}
+	var breachChecker auth.BreachChecker
+	if cfg.PasswordPolicy.BreachCheck.Enabled {
+		breachChecker = auth.NewHIBPChecker(auth.HIBPConfig{
+			Endpoint: cfg.PasswordPolicy.BreachCheck.Endpoint,
+			Timeout:  time.Duration(cfg.PasswordPolicy.BreachCheck.TimeoutSeconds) * time.Second,
+		})
+	}
+	return service.NewPasswordValidator(passwordPolicy, breachChecker, history, service.PasswordConfig{
+		Breach: service.BreachCheckConfig{
+			Threshold: cfg.PasswordPolicy.BreachCheck.Threshold,
+			FailOpen:  cfg.PasswordPolicy.BreachCheck.FailOpen,
+		},
+		History: cfg.PasswordPolicy.HistorySize,
+		MinAge:  time.Duration(cfg.PasswordPolicy.MinAgeHours) * time.Hour,
+		MaxAge:  time.Duration(cfg.PasswordPolicy.MaxAgeDays) * 24 * time.Hour,
+	}, logger), nil
+}
+
+// loadTokenKeys builds the access and refresh token key sets, including retired keys
+func loadTokenKeys(cfg config.JWTConfig) (*auth.KeySet, *auth.KeySet, error) {
+	accessKeys := auth.NewHMACKeySet(cfg.AccessSecret)
+	if cfg.Algorithm != auth.AlgorithmHS256 {
+		var err error
+		if accessKeys, err = auth.LoadKeySet(cfg.Algorithm, cfg.PrivateKeyFile); err != nil {
+			return nil, nil, fmt.Errorf("access token key: %w", err)
+		}
+	}
+	for i, key := range cfg.PreviousAccessKeys {
+		if key.Algorithm == auth.AlgorithmHS256 {
+			accessKeys.AddHMAC(key.Secret)
+			continue
+		}
+		if err := accessKeys.AddPublicKey(key.Algorithm, key.PublicKeyFile); err != nil {
+			return nil, nil, fmt.Errorf("previous access key %d: %w", i, err)
+		}
+	}
+
+	refreshKeys := auth.NewHMACKeySet(cfg.RefreshSecret)
+	for _, secret := range cfg.PreviousRefreshSecrets {
+		refreshKeys.AddHMAC(secret)
+	}
+	return accessKeys, refreshKeys, nil
+}
+
+// jwtSecrets returns cfg with the JWT secrets the secrets manager holds
+func jwtSecrets(cfg config.JWTConfig, store *secrets.Store) config.JWTConfig {
+	if store == nil {
+		return cfg
+	}
+	values := store.Current()
+	if values.JWTAccessSecret != "" {
+		cfg.AccessSecret = values.JWTAccessSecret
+	}
+	if values.JWTRefreshSecret != "" {
+		cfg.RefreshSecret = values.JWTRefreshSecret
+	}
+	return cfg
+}
+
+// rotateTokenKeys signs new tokens with rotated JWT secrets. Tokens signed with the
+// previous secrets stay valid until they expire, on this instance until it restarts.
+func rotateTokenKeys(store *secrets.Store, algorithm string, accessKeys, refreshKeys *auth.KeySet) {
+	store.Subscribe(func(old, next secrets.Values) {
+		if next.JWTAccessSecret != old.JWTAccessSecret && algorithm == auth.AlgorithmHS256 {
+			accessKeys.RotateHMAC(next.JWTAccessSecret)
+		}
+		if next.JWTRefreshSecret != old.JWTRefreshSecret {
+			refreshKeys.RotateHMAC(next.JWTRefreshSecret)
+		}
+	})
+}
+
+// loginThrottle builds the throttle delaying logins and password reset requests, nil
+// when it is disabled
+func loginThrottle(cfg config.ThrottleConfig) (*throttle.Throttle, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	var store throttle.Store
+	switch cfg.Store {
+	case "memory":
+		store = throttle.NewMemoryStore()
+	case "redis":
+		redisStore, err := throttle.NewRedisStore(throttle.RedisConfig{
+			Address:   cfg.Redis.Address,
+			Username:  cfg.Redis.Username,
+			Password:  cfg.Redis.Password,
+			DB:        cfg.Redis.DB,
+			TLS:       cfg.Redis.TLS,
+			KeyPrefix: cfg.Redis.KeyPrefix,
+		})
+		if err != nil {
+			return nil, err
+		}
+		store = redisStore
+	default:
+		return nil, fmt.Errorf("unknown throttle store %q", cfg.Store)
+	}
+	return throttle.New(store, throttle.Config{
+		AccountFree: cfg.AccountFree,
+		IPFree:      cfg.IPFree,
+		BaseDelay:   time.Duration(cfg.BaseDelayMs) * time.Millisecond,
+		MaxDelay:    time.Duration(cfg.MaxDelaySeconds) * time.Second,
+		Window:      time.Duration(cfg.WindowMinutes) * time.Minute,
+	}), nil
+}
+
+// BootstrapAdmin creates the configured admin when the database has none. A generated
+// password goes to stdout rather than the log, which may be shipped elsewhere.
+func BootstrapAdmin(seeds service.SeedService, cfg config.BootstrapConfig, logger *logrus.Logger) error {
+	user, password, err := seeds.BootstrapAdmin(service.BootstrapAdmin{
+		Email:    cfg.AdminEmail,
+		Username: cfg.AdminUsername,
+		Password: cfg.AdminPassword,
+	})
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		logger.Info("An admin account exists, bootstrap admin not created")
+		return nil
+	}
+	if password != "" {
+		fmt.Printf("Bootstrap admin %s created with the password %s\nIt is not shown again: sign in and change it.\n", user.Email, password)
+	}
+	return nil
+}
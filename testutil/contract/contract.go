@@ -0,0 +1,397 @@
+// Package contract checks the API's responses against the OpenAPI 2.0 spec generated
+// from the handlers' Swagger annotations (docs/swagger.json), so the documentation
+// cannot drift from what the handlers really answer. Tests wrap the router with a
+// Validator:
+//
+//	v, err := contract.Load(contract.SpecPath())
+//	handler := v.Handler(router, func(err error) { t.Error(err) })
+//
+// Every response to a request below the spec's base path must be for a documented
+// operation and have a documented status; JSON bodies must match the response schema.
+// Objects declaring properties are closed: a field the schema does not list is a
+// mismatch, as is a missing required one. Swagger 2.0 cannot mark fields nullable, so
+// null is accepted for any field.
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpecPath is the location of docs/swagger.json in the source tree
+func SpecPath() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "docs", "swagger.json")
+}
+
+type spec struct {
+	BasePath    string                          `json:"basePath"`
+	Paths       map[string]map[string]operation `json:"paths"`
+	Definitions map[string]*schema              `json:"definitions"`
+}
+
+type operation struct {
+	Responses map[string]response `json:"responses"`
+}
+
+type response struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"` // a schema or a bool
+	Items                *schema            `json:"items"`
+	AllOf                []*schema          `json:"allOf"`
+	Enum                 []interface{}      `json:"enum"`
+	Required             []string           `json:"required"`
+}
+
+// route is a path of the spec, matched against request paths below the base path
+type route struct {
+	path    string
+	pattern *regexp.Regexp
+	params  int
+}
+
+// Validator checks responses against a spec and remembers which operations and
+// statuses it saw
+type Validator struct {
+	spec   spec
+	routes []route
+
+	mu   sync.Mutex
+	seen map[string]bool // "METHOD /path"
+}
+
+// Load reads the spec at path
+func Load(path string) (*Validator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read spec: %w", err)
+	}
+	v := &Validator{seen: make(map[string]bool)}
+	if err := json.Unmarshal(data, &v.spec); err != nil {
+		return nil, fmt.Errorf("parse spec %s: %w", path, err)
+	}
+	if len(v.spec.Paths) == 0 {
+		return nil, fmt.Errorf("spec %s has no paths", path)
+	}
+	for path := range v.spec.Paths {
+		params := 0
+		segments := strings.Split(path, "/")
+		for i, segment := range segments {
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				segments[i] = "[^/]+"
+				params++
+			} else {
+				segments[i] = regexp.QuoteMeta(segment)
+			}
+		}
+		v.routes = append(v.routes, route{
+			path:    path,
+			pattern: regexp.MustCompile("^" + strings.Join(segments, "/") + "$"),
+			params:  params,
+		})
+	}
+	// Literal segments win over parameters: /admin/users/search before /admin/users/{id}
+	sort.Slice(v.routes, func(i, j int) bool {
+		if v.routes[i].params != v.routes[j].params {
+			return v.routes[i].params < v.routes[j].params
+		}
+		return v.routes[i].path < v.routes[j].path
+	})
+	return v, nil
+}
+
+// Handler serves next, checking each response with Check and passing mismatches to report
+func (v *Validator) Handler(next http.Handler, report func(error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &recordingWriter{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if err := v.Check(r.Method, r.URL.Path, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			report(err)
+		}
+	})
+}
+
+// Check validates a response to method and path. Paths outside the spec's base path
+// are not checked.
+func (v *Validator) Check(method, path string, status int, contentType string, body []byte) error {
+	rel, ok := strings.CutPrefix(path, v.spec.BasePath)
+	if !ok || (rel != "" && !strings.HasPrefix(rel, "/")) {
+		return nil
+	}
+	name := method + " " + path
+	var op operation
+	found := false
+	for _, route := range v.routes {
+		if !route.pattern.MatchString(rel) {
+			continue
+		}
+		if op, found = v.spec.Paths[route.path][strings.ToLower(method)]; found {
+			name = method + " " + route.path
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s: undocumented operation (answered %d)", name, status)
+	}
+	v.mu.Lock()
+	v.seen[name] = true
+	v.mu.Unlock()
+
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		if resp, ok = op.Responses["default"]; !ok {
+			return fmt.Errorf("%s: undocumented status %d: %s", name, status, truncate(body))
+		}
+	}
+	if resp.Schema == nil || len(bytes.TrimSpace(body)) == 0 || !isJSON(contentType) {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("%s %d: invalid JSON body: %v", name, status, err)
+	}
+	var problems []string
+	v.validate(value, resp.Schema, "", true, &problems)
+	if len(problems) > 0 {
+		return fmt.Errorf("%s %d: body does not match the spec:\n\t%s\nbody: %s", name, status, strings.Join(problems, "\n\t"), truncate(body))
+	}
+	return nil
+}
+
+// Uncovered lists the documented operations Check saw no response for, sorted
+func (v *Validator) Uncovered() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var uncovered []string
+	for path, ops := range v.spec.Paths {
+		for method := range ops {
+			name := strings.ToUpper(method) + " " + path
+			if !v.seen[name] {
+				uncovered = append(uncovered, name)
+			}
+		}
+	}
+	sort.Strings(uncovered)
+	return uncovered
+}
+
+// validate appends to problems where value does not match s, naming fields by JSON
+// pointer
+func (v *Validator) validate(value interface{}, s *schema, pointer string, root bool, problems *[]string) {
+	s = v.resolve(s)
+	if s == nil {
+		return
+	}
+	at := pointer
+	if at == "" {
+		at = "/"
+	}
+	if value == nil {
+		if root {
+			*problems = append(*problems, at+": null body")
+		}
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(value, s.Enum) {
+		*problems = append(*problems, fmt.Sprintf("%s: %v is not one of %v", at, value, s.Enum))
+	}
+
+	switch s.Type {
+	case "object", "":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			if s.Type == "object" {
+				*problems = append(*problems, fmt.Sprintf("%s: %s, want object", at, kind(value)))
+			}
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s/%s: required field missing", pointer, name))
+			}
+		}
+		additional, open := v.additionalProperties(s)
+		for name, field := range obj {
+			if property, ok := s.Properties[name]; ok {
+				v.validate(field, property, pointer+"/"+name, false, problems)
+			} else if additional != nil {
+				v.validate(field, additional, pointer+"/"+name, false, problems)
+			} else if !open {
+				*problems = append(*problems, fmt.Sprintf("%s/%s: field not in the spec", pointer, name))
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: %s, want array", at, kind(value)))
+			return
+		}
+		for i, item := range items {
+			v.validate(item, s.Items, pointer+"/"+strconv.Itoa(i), false, problems)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: %s, want string", at, kind(value)))
+			return
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				*problems = append(*problems, fmt.Sprintf("%s: %q is not a date-time", at, str))
+			}
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			*problems = append(*problems, fmt.Sprintf("%s: %v, want integer", at, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: %s, want number", at, kind(value)))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: %s, want boolean", at, kind(value)))
+		}
+	}
+}
+
+// resolve follows $ref and merges allOf, which swag uses to override fields of a
+// definition, into a single schema
+func (v *Validator) resolve(s *schema) *schema {
+	for depth := 0; s != nil && s.Ref != ""; depth++ {
+		if depth > 32 {
+			return nil
+		}
+		s = v.spec.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+	}
+	if s == nil || len(s.AllOf) == 0 {
+		return s
+	}
+	merged := &schema{Type: s.Type, Properties: make(map[string]*schema), Required: s.Required}
+	for _, part := range append(s.AllOf, &schema{Properties: s.Properties}) {
+		part = v.resolve(part)
+		if part == nil {
+			continue
+		}
+		if merged.Type == "" {
+			merged.Type = part.Type
+		}
+		for name, property := range part.Properties {
+			merged.Properties[name] = property
+		}
+		merged.Required = append(merged.Required, part.Required...)
+		if len(part.AdditionalProperties) > 0 {
+			merged.AdditionalProperties = part.AdditionalProperties
+		}
+	}
+	return merged
+}
+
+// additionalProperties returns the schema of fields s does not list, or whether any
+// are allowed when there is none. Objects without declared properties are open.
+func (v *Validator) additionalProperties(s *schema) (*schema, bool) {
+	raw := bytes.TrimSpace(s.AdditionalProperties)
+	switch {
+	case len(raw) == 0:
+		return nil, len(s.Properties) == 0
+	case bytes.Equal(raw, []byte("true")):
+		return nil, true
+	case bytes.Equal(raw, []byte("false")):
+		return nil, false
+	}
+	var additional schema
+	if err := json.Unmarshal(raw, &additional); err != nil {
+		return nil, true
+	}
+	return &additional, true
+}
+
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, allowed := range enum {
+		if value == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func kind(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+func truncate(body []byte) string {
+	const limit = 500
+	if len(body) > limit {
+		return string(body[:limit]) + "..."
+	}
+	return string(body)
+}
+
+// recordingWriter passes a response through while keeping its status and body
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,275 @@
+// Package testutil runs the API against an in-memory SQLite database, so integration
+// tests exercise the endpoints without a database server:
+//
+//	srv := testutil.NewServer(t, nil)
+//	srv.CreateUser(t, "ada@example.com", "Correct-Horse-42", "admin")
+//	tokens := srv.Login(t, "ada@example.com", "Correct-Horse-42")
+//	resp, body := srv.Do(t, http.MethodGet, "/api/v1/admin/users", nil, tokens.AccessToken)
+//
+// Every server has a database of its own, so tests using one can run in parallel.
+package testutil
+
+import (
+	"api/config"
+	"api/internal/auth"
+	"api/internal/database"
+	"api/internal/logging"
+	"api/internal/middleware/authtest"
+	"api/internal/models"
+	"api/server"
+	"api/testutil/contract"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+// Server is the API served by an httptest.Server for the duration of a test
+type Server struct {
+	*httptest.Server
+	Config *config.Config
+	Router *gin.Engine
+	DB     *gorm.DB
+	Logger *logrus.Logger
+	// Contract checks every response of servers from NewContractServer, nil otherwise
+	Contract *contract.Validator
+}
+
+// Config returns the configuration of test servers: the defaults, with fixed JWT
+// secrets and logs and uploads kept in directories removed after the test
+func Config(t testing.TB) *config.Config {
+	t.Helper()
+	cfg, err := config.Defaults()
+	if err != nil {
+		t.Fatalf("testutil: default configuration: %v", err)
+	}
+	dir := t.TempDir()
+	cfg.Environment = "test"
+	cfg.Database.Driver = database.SQLite
+	cfg.Database.Path = database.InMemory
+	cfg.JWT.AccessSecret = "test-access-secret"
+	cfg.JWT.RefreshSecret = "test-refresh-secret"
+	cfg.JWT.AccessExpiry = 15
+	cfg.JWT.RefreshExpiry = 7
+	cfg.Log.Level = "warn"
+	cfg.Log.File = filepath.Join(dir, "logs", "app.log")
+	cfg.Storage.LocalDir = filepath.Join(dir, "uploads")
+	cfg.Email.Provider = "log"
+	cfg.Jobs.Instance = t.Name()
+	return cfg
+}
+
+// NewServer starts the API with Config, changed by configure unless it is nil. The
+// server, its background work and its database are gone when the test ends.
+func NewServer(t testing.TB, configure func(*config.Config)) *Server {
+	t.Helper()
+	return NewServerWithClock(t, nil, configure)
+}
+
+// NewServerWithClock is NewServer starting sessions and issuing tokens at the time
+// clock tells, so tests can hand out tokens that are already expired
+func NewServerWithClock(t testing.TB, clock auth.Clock, configure func(*config.Config)) *Server {
+	t.Helper()
+	return newServer(t, clock, nil, configure)
+}
+
+// NewContractServer is NewServer checking every response against docs/swagger.json:
+// a request to an undocumented operation, or a status or JSON body the spec does not
+// describe for it, fails the test
+func NewContractServer(t testing.TB, configure func(*config.Config)) *Server {
+	t.Helper()
+	validator, err := contract.Load(contract.SpecPath())
+	if err != nil {
+		t.Fatalf("testutil: %v", err)
+	}
+	return newServer(t, nil, validator, configure)
+}
+
+func newServer(t testing.TB, clock auth.Clock, validator *contract.Validator, configure func(*config.Config)) *Server {
+	t.Helper()
+	cfg := Config(t)
+	if configure != nil {
+		configure(cfg)
+	}
+
+	logger := logrus.New()
+	level, err := logrus.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		t.Fatalf("testutil: log level: %v", err)
+	}
+	logger.SetLevel(level)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logOutput := logging.Open(logging.Config{File: cfg.Log.File}, logger)
+	debugFilter := logging.NewDebugFilter(logger.Formatter, logOutput)
+	logger.SetFormatter(debugFilter)
+
+	db := OpenDatabase(t, logger)
+	stop := make(chan struct{})
+	gin.SetMode(gin.TestMode)
+	router, err := server.NewServer(cfg, server.Deps{
+		DB:          db,
+		Logger:      logger,
+		LogOutput:   logOutput,
+		DebugFilter: debugFilter,
+		Stop:        stop,
+		Clock:       clock,
+	})
+	if err != nil {
+		close(stop)
+		t.Fatalf("testutil: server: %v", err)
+	}
+	var handler http.Handler = router
+	if validator != nil {
+		handler = validator.Handler(router, func(err error) { t.Errorf("contract: %v", err) })
+	}
+	srv := &Server{
+		Server:   httptest.NewServer(handler),
+		Config:   cfg,
+		Router:   router,
+		DB:       db,
+		Logger:   logger,
+		Contract: validator,
+	}
+	t.Cleanup(func() {
+		srv.Close()
+		close(stop)
+	})
+	return srv
+}
+
+// OpenDatabase returns a migrated in-memory SQLite database, closed when the test ends
+func OpenDatabase(t testing.TB, logger *logrus.Logger) *gorm.DB {
+	t.Helper()
+	connector, err := database.Connector(database.Config{Driver: database.SQLite, Path: database.InMemory}, func() string { return "" })
+	if err != nil {
+		t.Fatalf("testutil: database: %v", err)
+	}
+	sqlDB := sql.OpenDB(connector)
+	// The database is dropped with its last connection, so an idle one is always kept
+	sqlDB.SetMaxIdleConns(4)
+	dialect, _ := database.Dialect(database.SQLite)
+	db, err := gorm.Open(dialect, sqlDB)
+	if err != nil {
+		t.Fatalf("testutil: database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := server.Migrate(db, logger); err != nil {
+		t.Fatalf("testutil: migrate: %v", err)
+	}
+	return db
+}
+
+// CreateUser adds an active user with a verified email straight to the database,
+// named after the local part of email
+func (s *Server) CreateUser(t testing.TB, email, password, role string) *models.User {
+	t.Helper()
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		t.Fatalf("testutil: hash password: %v", err)
+	}
+	username, _, _ := strings.Cut(email, "@")
+	user := &models.User{
+		Email:         email,
+		Username:      username,
+		PasswordHash:  hash,
+		Role:          role,
+		EmailVerified: true,
+		Status:        models.UserStatusActive,
+	}
+	if err := s.DB.Create(user).Error; err != nil {
+		t.Fatalf("testutil: create user %s: %v", email, err)
+	}
+	return user
+}
+
+// AccessToken issues an access token the server accepts for identity, signed with the
+// configured HS256 secret. No session is behind it, so tests can act with any role,
+// scope, group or organization without signing in; the server sees a distinct token
+// on every call.
+func (s *Server) AccessToken(t testing.TB, identity authtest.Identity) string {
+	t.Helper()
+	if s.Config.JWT.Algorithm != auth.AlgorithmHS256 {
+		t.Fatalf("testutil: access tokens need the %s algorithm, not %s", auth.AlgorithmHS256, s.Config.JWT.Algorithm)
+	}
+	keys := auth.NewHMACKeySet(s.Config.JWT.AccessSecret)
+	token, err := authtest.IssuedAccessToken(keys, s.Config.JWT.Issuer, s.Config.JWT.Audience, identity)
+	if err != nil {
+		t.Fatalf("testutil: access token: %v", err)
+	}
+	return token
+}
+
+// Tokens are the tokens of a session
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Login signs in through POST /api/v1/auth/login, failing the test unless it succeeds
+func (s *Server) Login(t testing.TB, login, password string) Tokens {
+	t.Helper()
+	resp, body := s.Do(t, http.MethodPost, "/api/v1/auth/login", map[string]string{"login": login, "password": password}, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("testutil: login %s: %d %s", login, resp.StatusCode, body)
+	}
+	var tokens Tokens
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		t.Fatalf("testutil: login %s: %v", login, err)
+	}
+	return tokens
+}
+
+// Do sends a request to the server with body encoded as JSON unless it is nil, and the
+// access token as bearer token unless it is empty. It returns the response with its
+// body read.
+func (s *Server) Do(t testing.TB, method, path string, body interface{}, token string) (*http.Response, []byte) {
+	t.Helper()
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return s.DoWithHeader(t, method, path, body, header)
+}
+
+// DoWithHeader is Do sending header instead of a bearer token, for credentials such as
+// X-API-Key
+func (s *Server) DoWithHeader(t testing.TB, method, path string, body interface{}, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("testutil: encode %s %s: %v", method, path, err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, s.URL+path, reader)
+	if err != nil {
+		t.Fatalf("testutil: %s %s: %v", method, path, err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("testutil: %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("testutil: %s %s: %v", method, path, err)
+	}
+	return resp, data
+}
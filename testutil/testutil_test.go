@@ -0,0 +1,23 @@
+package testutil_test
+
+import (
+	"api/testutil"
+	"net/http"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	srv := testutil.NewServer(t, nil)
+
+	resp, body := srv.Do(t, http.MethodGet, "/api/v1/health/ready", nil, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("readiness: %d %s", resp.StatusCode, body)
+	}
+
+	srv.CreateUser(t, "ada@example.com", "Correct-Horse-42", "admin")
+	tokens := srv.Login(t, "ada@example.com", "Correct-Horse-42")
+	resp, body = srv.Do(t, http.MethodGet, "/api/v1/admin/users", nil, tokens.AccessToken)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list users: %d %s", resp.StatusCode, body)
+	}
+}